@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// federationStateCookie binds a provider callback to the browser that started the login
+const federationStateCookie = "federation_state"
+
+// FederationHandler handles sign-in through external identity providers
+type FederationHandler struct {
+	FederationService *services.FederationService
+	Logger            *utils.Logger
+}
+
+// NewFederationHandler creates a new federation handler
+func NewFederationHandler(federationService *services.FederationService, logger *utils.Logger) *FederationHandler {
+	return &FederationHandler{
+		FederationService: federationService,
+		Logger:            logger,
+	}
+}
+
+// ProviderResponse describes an identity provider users can sign in with
+type ProviderResponse struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+// ConfirmLinkRequest is the body of a request confirming an identity link
+// with the account password, or with the passkey answering the second factor
+// challenge the password was met with
+type ConfirmLinkRequest struct {
+	LinkToken  string                      `json:"link_token" validate:"required"`
+	Password   string                      `json:"password"`
+	CeremonyID string                      `json:"ceremony_id"`
+	Credential *services.WebAuthnAssertion `json:"credential"`
+}
+
+// LinkIdentityRequest is the body of a request confirming an identity link as the signed-in user
+type LinkIdentityRequest struct {
+	LinkToken string `json:"link_token" validate:"required"`
+}
+
+// ListProviders handles listing the configured identity providers
+func (h *FederationHandler) ListProviders(c echo.Context) error {
+	providers := make([]ProviderResponse, 0, len(h.FederationService.Providers))
+	for _, provider := range h.FederationService.Providers {
+		providers = append(providers, ProviderResponse{
+			ID:       provider.ID,
+			Name:     provider.Name,
+			LoginURL: "/api/auth/federated/" + provider.ID + "/login",
+		})
+	}
+	return utils.SuccessResponse(c, providers, "Identity providers retrieved successfully")
+}
+
+// Login handles starting a sign-in by redirecting to the identity provider
+func (h *FederationHandler) Login(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	authURL, state, err := h.FederationService.BeginLogin(ctx, c.Param("provider"))
+	if errors.Is(err, services.ErrUnknownProvider) {
+		return utils.NotFoundErrorResponse(c, "Identity provider not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to start federated login")
+		return utils.ErrorResponse(c, http.StatusBadGateway, "Identity provider unavailable", nil)
+	}
+
+	h.setStateCookie(c, state, 600)
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles the identity provider redirecting back after sign-in
+func (h *FederationHandler) Callback(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx).WithField("provider", c.Param("provider"))
+
+	cookie, err := c.Cookie(federationStateCookie)
+	state := c.QueryParam("state")
+	if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Warn("Federated login callback with a missing or mismatched state")
+		return utils.ValidationErrorResponse(c, "Invalid or expired login attempt", nil)
+	}
+	h.setStateCookie(c, "", -1)
+
+	if providerError := c.QueryParam("error"); providerError != "" {
+		log.WithField("error", providerError).Warn("Identity provider returned an error")
+		return utils.UnauthorizedErrorResponse(c, "Sign-in with the identity provider was not completed")
+	}
+
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	login, err := h.FederationService.CompleteLogin(ctx, c.Param("provider"), state, c.QueryParam("code"), client)
+	if errors.Is(err, services.ErrUnknownProvider) {
+		return utils.NotFoundErrorResponse(c, "Identity provider not found")
+	}
+	if errors.Is(err, services.ErrFederatedLoginFailed) {
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	}
+	return federatedLoginResponse(c, log, login, err)
+}
+
+// federatedLoginResponse responds to a sign-in through an external identity
+// provider with a token, or with a link token if the user must confirm
+// linking the identity to an existing account
+func federatedLoginResponse(c echo.Context, log *logrus.Entry, login *services.FederatedLogin, err error) error {
+	var statusErr *services.AccountStatusError
+	var validationErr *services.ValidationError
+	switch {
+	case errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, services.ErrEmailDomainNotAllowed):
+		return utils.ErrorResponse(c, http.StatusForbidden, err.Error(), nil)
+	case errors.As(err, &validationErr):
+		return utils.ValidationErrorResponse(c, "The identity provider sent invalid profile attributes", validationErr.Violations)
+	case errors.As(err, &statusErr):
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	case err != nil:
+		log.WithError(err).Error("Federated login failed")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to sign in", []string{err.Error()})
+	}
+
+	if login.LinkToken != "" {
+		return c.JSON(http.StatusConflict, utils.Response{
+			Status:    "error",
+			RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+			Message:   "An account with this email already exists, confirm linking the identity to it",
+			Data: map[string]interface{}{
+				"link_required": true,
+				"link_token":    login.LinkToken,
+				"email":         login.Email,
+			},
+		})
+	}
+
+	return utils.SuccessResponse(c, map[string]interface{}{
+		"token":       login.Token,
+		"provisioned": login.Provisioned,
+	}, "Login successful")
+}
+
+// ConfirmLink handles linking an identity to an existing account by signing
+// in with the account password, and its passkey if the account has one
+func (h *FederationHandler) ConfirmLink(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req ConfirmLinkRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	var token string
+	var err error
+	if req.Credential != nil {
+		token, err = h.FederationService.ConfirmLinkWithPasskey(ctx, req.LinkToken, req.CeremonyID, *req.Credential, client)
+	} else {
+		token, err = h.FederationService.ConfirmLinkWithPassword(ctx, req.LinkToken, req.Password, client)
+	}
+
+	var secondFactorErr *services.SecondFactorRequiredError
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.Is(err, services.ErrInvalidLinkRequest):
+		return utils.UnauthorizedErrorResponse(c, "Invalid link request or password")
+	case errors.Is(err, services.ErrWebAuthnVerification):
+		log.WithError(err).Warn("Passkey rejected confirming identity link")
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	case errors.As(err, &secondFactorErr):
+		return secondFactorResponse(c, secondFactorErr)
+	case errors.Is(err, services.ErrPasswordExpired):
+		log.Warn("Identity link with expired password")
+		return passwordExpiredResponse(c, token)
+	case errors.As(err, &statusErr):
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	case err != nil:
+		log.WithError(err).Error("Failed to link identity")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to link identity", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Identity linked successfully")
+}
+
+// ListIdentities handles listing the current user's linked identities
+func (h *FederationHandler) ListIdentities(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	identities, err := h.FederationService.ListIdentities(ctx, userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to list identities")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list identities", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, identities, "Identities retrieved successfully")
+}
+
+// LinkIdentity handles linking an identity to the current user's account
+func (h *FederationHandler) LinkIdentity(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req LinkIdentityRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	identity, err := h.FederationService.ConfirmLink(ctx, userID, req.LinkToken)
+	if errors.Is(err, services.ErrInvalidLinkRequest) {
+		return utils.ValidationErrorResponse(c, err.Error(), nil)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to link identity")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to link identity", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, identity, "Identity linked successfully")
+}
+
+// UnlinkIdentity handles unlinking one of the current user's identities
+func (h *FederationHandler) UnlinkIdentity(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	err = h.FederationService.UnlinkIdentity(ctx, userID, c.Param("id"))
+	switch {
+	case errors.Is(err, repositories.ErrIdentityNotFound):
+		return utils.NotFoundErrorResponse(c, "Identity not found")
+	case errors.Is(err, services.ErrLastIdentity), errors.Is(err, services.ErrManagedIdentity):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error(), nil)
+	case err != nil:
+		log.WithError(err).Error("Failed to unlink identity")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to unlink identity", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, nil, "Identity unlinked successfully")
+}
+
+// setStateCookie sets or, with a negative maxAge, clears the login state cookie
+func (h *FederationHandler) setStateCookie(c echo.Context, state string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     federationStateCookie,
+		Value:    state,
+		Path:     "/api/auth/federated",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RegisterRoutes registers the federated login routes
+func (h *FederationHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+	e.GET("/api/auth/providers", h.ListProviders)
+	e.GET("/api/auth/federated/:provider/login", h.Login)
+	e.GET("/api/auth/federated/:provider/callback", h.Callback)
+	e.POST("/api/auth/federated/link", h.ConfirmLink)
+
+	identityGroup := e.Group("/api/users/me/identities")
+	identityGroup.Use(jwtMiddleware)
+
+	identityGroup.GET("", h.ListIdentities)
+	identityGroup.POST("", h.LinkIdentity)
+	identityGroup.DELETE("/:id", h.UnlinkIdentity)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// GroupHandler handles HTTP requests for groups and their members
+type GroupHandler struct {
+	GroupService *services.GroupService
+	Logger       *utils.Logger
+}
+
+// NewGroupHandler creates a new group handler
+func NewGroupHandler(groupService *services.GroupService, logger *utils.Logger) *GroupHandler {
+	return &GroupHandler{
+		GroupService: groupService,
+		Logger:       logger,
+	}
+}
+
+// CreateGroupRequest represents a request to create a group
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	ParentID    string `json:"parent_id"`
+}
+
+// UpdateGroupRequest represents a request to change a group. Omitted fields
+// are left as they are, and an empty parent_id moves the group to the top level.
+type UpdateGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	ParentID    *string `json:"parent_id"`
+}
+
+// SetGroupMemberRequest represents a request to add a member or change their role
+type SetGroupMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// groupErrorResponse writes the response for a group service error
+func groupErrorResponse(c echo.Context, log *logrus.Entry, err error, message string) error {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return utils.ValidationErrorResponse(c, validationErr.Message, validationErr.Violations)
+	case errors.Is(err, repositories.ErrGroupNotFound):
+		return utils.NotFoundErrorResponse(c, "Group not found")
+	case errors.Is(err, repositories.ErrUserNotFound):
+		return utils.NotFoundErrorResponse(c, "User not found")
+	case errors.Is(err, repositories.ErrGroupMemberNotFound):
+		return utils.NotFoundErrorResponse(c, "User is not a member of the group")
+	case errors.Is(err, services.ErrGroupForbidden):
+		return utils.ForbiddenErrorResponse(c, "Only admins and group owners can manage the group")
+	case errors.Is(err, services.ErrGroupManagedExternally):
+		return utils.ErrorResponse(c, http.StatusConflict, "Group is managed by its directory", []string{err.Error()})
+	case errors.Is(err, services.ErrGroupNameTaken):
+		return utils.ErrorResponse(c, http.StatusConflict, "Group name is already taken", []string{err.Error()})
+	case errors.Is(err, services.ErrGroupHasSubgroups):
+		return utils.ErrorResponse(c, http.StatusConflict, "Group has subgroups", []string{err.Error()})
+	case errors.Is(err, services.ErrGroupCycle):
+		return utils.ValidationErrorResponse(c, "Invalid parent group", []string{err.Error()})
+	}
+
+	log.WithError(err).Error(message)
+	return utils.InternalServerErrorResponse(c, message)
+}
+
+// parseGroupID parses the group ID path parameter
+func parseGroupID(c echo.Context) (string, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// CreateGroup handles creating a group
+func (h *GroupHandler) CreateGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req CreateGroupRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	group, err := h.GroupService.Create(ctx, req.Name, req.Description, req.ParentID)
+	if err != nil {
+		return groupErrorResponse(c, log, err, "Failed to create group")
+	}
+
+	return utils.SuccessResponse(c, group, "Group created successfully")
+}
+
+// ListGroups handles listing groups with pagination
+func (h *GroupHandler) ListGroups(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	perPage, _ := strconv.Atoi(c.QueryParam("per_page"))
+
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 1 {
+		perPage = 10
+	}
+
+	groups, total, err := h.GroupService.List(ctx, page, perPage)
+	if err != nil {
+		log.WithError(err).Error("Failed to list groups")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list groups", []string{err.Error()})
+	}
+
+	totalPages := total / int64(perPage)
+	if total%int64(perPage) > 0 {
+		totalPages++
+	}
+
+	return c.JSON(http.StatusOK, utils.Response{
+		Status:     "success",
+		RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
+		Message:    "Groups retrieved successfully",
+		Data:       groups,
+		PageInfo:   &utils.PageInfo{Page: page, PerPage: perPage, TotalPage: totalPages},
+		TotalCount: total,
+	})
+}
+
+// GetGroup handles getting a group
+func (h *GroupHandler) GetGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+
+	group, err := h.GroupService.Get(ctx, id)
+	if err != nil {
+		return groupErrorResponse(c, log, err, "Failed to get group")
+	}
+
+	return utils.SuccessResponse(c, group, "Group retrieved successfully")
+}
+
+// UpdateGroup handles changing a group's details or parent
+func (h *GroupHandler) UpdateGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+
+	var req UpdateGroupRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	group, err := h.GroupService.Update(ctx, actor, id, services.GroupUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		ParentID:    req.ParentID,
+	})
+	if err != nil {
+		return groupErrorResponse(c, log, err, "Failed to update group")
+	}
+
+	return utils.SuccessResponse(c, group, "Group updated successfully")
+}
+
+// DeleteGroup handles deleting a group
+func (h *GroupHandler) DeleteGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+
+	if err := h.GroupService.Delete(ctx, id); err != nil {
+		return groupErrorResponse(c, log, err, "Failed to delete group")
+	}
+
+	return utils.SuccessResponse(c, nil, "Group deleted successfully")
+}
+
+// ListMembers handles listing the direct members of a group
+func (h *GroupHandler) ListMembers(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+
+	members, err := h.GroupService.ListMembers(ctx, id)
+	if err != nil {
+		return groupErrorResponse(c, log, err, "Failed to list group members")
+	}
+
+	return utils.SuccessResponse(c, members, "Group members retrieved successfully")
+}
+
+// SetMember handles adding a member to a group or changing their role
+func (h *GroupHandler) SetMember(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	var req SetGroupMemberRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	if err := h.GroupService.SetMember(ctx, actor, id, userID.String(), req.Role); err != nil {
+		return groupErrorResponse(c, log, err, "Failed to set group member")
+	}
+
+	return utils.SuccessResponse(c, nil, "Group member saved successfully")
+}
+
+// RemoveMember handles removing a member from a group
+func (h *GroupHandler) RemoveMember(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	id, err := parseGroupID(c)
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid group ID", []string{err.Error()})
+	}
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	if err := h.GroupService.RemoveMember(ctx, actor, id, userID.String()); err != nil {
+		return groupErrorResponse(c, log, err, "Failed to remove group member")
+	}
+
+	return utils.SuccessResponse(c, nil, "Group member removed successfully")
+}
+
+// ListMyGroups handles listing the groups the authenticated user is in,
+// directly or through a subgroup
+func (h *GroupHandler) ListMyGroups(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	groups, err := h.GroupService.UserGroups(ctx, user)
+	if err != nil {
+		log.WithError(err).Error("Failed to list user groups")
+		return utils.InternalServerErrorResponse(c, "Failed to list groups")
+	}
+
+	return utils.SuccessResponse(c, groups, "Groups retrieved successfully")
+}
+
+// RegisterRoutes registers the group routes. Only admins create and delete
+// groups; owners manage their groups' details and members.
+func (h *GroupHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	e.GET("/api/users/me/groups", h.ListMyGroups, jwtMiddleware)
+
+	groupGroup := e.Group("/api/groups")
+	groupGroup.Use(jwtMiddleware)
+
+	groupGroup.GET("", h.ListGroups)
+	groupGroup.POST("", h.CreateGroup, adminMiddleware)
+	groupGroup.GET("/:id", h.GetGroup)
+	groupGroup.PATCH("/:id", h.UpdateGroup)
+	groupGroup.DELETE("/:id", h.DeleteGroup, adminMiddleware)
+	groupGroup.GET("/:id/members", h.ListMembers)
+	groupGroup.PUT("/:id/members/:user_id", h.SetMember)
+	groupGroup.DELETE("/:id/members/:user_id", h.RemoveMember)
+}
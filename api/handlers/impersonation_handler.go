@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// ImpersonationHandler handles HTTP requests for admin impersonation
+type ImpersonationHandler struct {
+	ImpersonationService *services.ImpersonationService
+	Logger               *utils.Logger
+}
+
+// NewImpersonationHandler creates a new impersonation handler
+func NewImpersonationHandler(impersonationService *services.ImpersonationService, logger *utils.Logger) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		ImpersonationService: impersonationService,
+		Logger:               logger,
+	}
+}
+
+// ImpersonateRequest represents a request to act as a user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// Impersonate handles an admin starting to act as a user
+func (h *ImpersonationHandler) Impersonate(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid user ID")
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	var req ImpersonateRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	token, impersonation, err := h.ImpersonationService.Start(ctx, actor, targetID.String(), req.Reason)
+	var validationErr *services.ValidationError
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.As(err, &validationErr):
+		return utils.ValidationErrorResponse(c, validationErr.Message, validationErr.Violations)
+	case errors.Is(err, repositories.ErrUserNotFound):
+		return utils.NotFoundErrorResponse(c, "User not found")
+	case errors.Is(err, services.ErrImpersonationNotAllowed):
+		return utils.ForbiddenErrorResponse(c, "Admins cannot be impersonated")
+	case errors.As(err, &statusErr):
+		return utils.ErrorResponseWithCode(c, http.StatusConflict, statusErr.Code(), "Account is "+statusErr.Status)
+	case err != nil:
+		log.WithError(err).Error("Failed to start impersonation")
+		return utils.InternalServerErrorResponse(c, "Failed to start impersonation")
+	}
+
+	return utils.SuccessResponse(c, map[string]interface{}{
+		"token":         token,
+		"impersonation": impersonation,
+	}, "Impersonation started")
+}
+
+// ListImpersonations handles listing the impersonations of a user
+func (h *ImpersonationHandler) ListImpersonations(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid user ID")
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	impersonations, err := h.ImpersonationService.ListForUser(ctx, targetID.String())
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return utils.NotFoundErrorResponse(c, "User not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to list impersonations")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list impersonations", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, impersonations, "Impersonations retrieved successfully")
+}
+
+// ListEvents handles listing the requests made during an impersonation
+func (h *ImpersonationHandler) ListEvents(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	impersonationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid impersonation ID")
+		return utils.ValidationErrorResponse(c, "Invalid impersonation ID", []string{err.Error()})
+	}
+
+	events, err := h.ImpersonationService.ListEvents(ctx, impersonationID.String())
+	if errors.Is(err, repositories.ErrImpersonationNotFound) {
+		return utils.NotFoundErrorResponse(c, "Impersonation not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to list impersonation events")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list impersonation events", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, events, "Impersonation events retrieved successfully")
+}
+
+// EndImpersonation handles an admin ending the impersonation they are making the request in
+func (h *ImpersonationHandler) EndImpersonation(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	impersonation := middleware.GetImpersonation(c)
+	if impersonation == nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Not impersonating a user", []string{"this endpoint requires an impersonation token"})
+	}
+
+	if err := h.ImpersonationService.End(ctx, impersonation); err != nil {
+		log.WithError(err).Error("Failed to end impersonation")
+		return utils.InternalServerErrorResponse(c, "Failed to end impersonation")
+	}
+
+	return utils.SuccessResponse(c, nil, "Impersonation ended")
+}
+
+// RegisterRoutes registers the impersonation routes. Starting an impersonation
+// requires a recent authentication.
+func (h *ImpersonationHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware, stepUpMiddleware echo.MiddlewareFunc) {
+	e.DELETE("/api/impersonation", h.EndImpersonation, jwtMiddleware)
+
+	adminGroup := e.Group("/api/admin")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.POST("/users/:id/impersonate", h.Impersonate, stepUpMiddleware)
+	adminGroup.GET("/users/:id/impersonations", h.ListImpersonations)
+	adminGroup.GET("/impersonations/:id/events", h.ListEvents)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// LDAPSyncHandler handles HTTP requests for synchronizing users with LDAP directories
+type LDAPSyncHandler struct {
+	SyncService *services.LDAPSyncService
+	Logger      *utils.Logger
+}
+
+// NewLDAPSyncHandler creates a new LDAP sync handler
+func NewLDAPSyncHandler(syncService *services.LDAPSyncService, logger *utils.Logger) *LDAPSyncHandler {
+	return &LDAPSyncHandler{
+		SyncService: syncService,
+		Logger:      logger,
+	}
+}
+
+// ldapDirectoryResponse describes a configured directory, without its credentials
+type ldapDirectoryResponse struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	BaseDN       string `json:"base_dn"`
+	Filter       string `json:"filter"`
+	SyncInterval int    `json:"sync_interval_minutes"`
+}
+
+// SyncRequest represents a request to sync a directory
+type SyncRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// ListDirectories handles listing the configured directories
+func (h *LDAPSyncHandler) ListDirectories(c echo.Context) error {
+	directories := make([]ldapDirectoryResponse, 0, len(h.SyncService.Directories))
+	for _, directory := range h.SyncService.Directories {
+		directories = append(directories, ldapDirectoryResponse{
+			ID:           directory.ID,
+			Name:         directory.Name,
+			URL:          directory.URL,
+			BaseDN:       directory.BaseDN,
+			Filter:       directory.Filter,
+			SyncInterval: directory.SyncInterval,
+		})
+	}
+	return utils.SuccessResponse(c, directories, "LDAP directories retrieved successfully")
+}
+
+// Sync handles synchronizing a directory's users now, or reporting the
+// changes a sync would make
+func (h *LDAPSyncHandler) Sync(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req SyncRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	run, err := h.SyncService.Sync(ctx, c.Param("id"), req.DryRun, actor)
+	switch {
+	case errors.Is(err, services.ErrLDAPDirectoryNotFound):
+		return utils.NotFoundErrorResponse(c, "LDAP directory not found")
+	case errors.Is(err, services.ErrLDAPSyncInProgress):
+		return utils.ErrorResponse(c, http.StatusConflict, "Failed to sync LDAP directory", []string{err.Error()})
+	case err != nil:
+		log.WithError(err).Error("Failed to sync LDAP directory")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to sync LDAP directory", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, run, "LDAP sync finished")
+}
+
+// ListRuns handles listing recent sync runs, optionally of one directory
+func (h *LDAPSyncHandler) ListRuns(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	runs, err := h.SyncService.ListRuns(ctx, c.QueryParam("directory"), limit)
+	if err != nil {
+		log.WithError(err).Error("Failed to list LDAP sync runs")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list LDAP sync runs", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, runs, "LDAP sync runs retrieved successfully")
+}
+
+// GetRun handles getting a sync run with its changes
+func (h *LDAPSyncHandler) GetRun(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	runID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid LDAP sync run ID")
+		return utils.ValidationErrorResponse(c, "Invalid LDAP sync run ID", []string{err.Error()})
+	}
+
+	run, err := h.SyncService.GetRun(ctx, runID.String())
+	if errors.Is(err, repositories.ErrLDAPSyncRunNotFound) {
+		return utils.NotFoundErrorResponse(c, "LDAP sync run not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to get LDAP sync run")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get LDAP sync run", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, run, "LDAP sync run retrieved successfully")
+}
+
+// RegisterRoutes registers the LDAP sync administration routes
+func (h *LDAPSyncHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	adminGroup := e.Group("/api/admin/ldap")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.GET("/directories", h.ListDirectories)
+	adminGroup.POST("/directories/:id/sync", h.Sync)
+	adminGroup.GET("/sync-runs", h.ListRuns)
+	adminGroup.GET("/sync-runs/:id", h.GetRun)
+}
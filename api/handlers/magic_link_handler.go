@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// magicLinkBindingCookie carries the nonce that binds a magic link to the browser that requested it
+const magicLinkBindingCookie = "magic_link_binding"
+
+// MagicLinkHandler handles HTTP requests for passwordless sign-in through emailed links
+type MagicLinkHandler struct {
+	MagicLinkService *services.MagicLinkService
+	Logger           *utils.Logger
+}
+
+// NewMagicLinkHandler creates a new magic link handler
+func NewMagicLinkHandler(magicLinkService *services.MagicLinkService, logger *utils.Logger) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		MagicLinkService: magicLinkService,
+		Logger:           logger,
+	}
+}
+
+// MagicLinkRequest represents a request for a sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+	// SameBrowser binds the link to the requesting browser, so a forwarded link cannot be used
+	SameBrowser bool `json:"same_browser"`
+}
+
+// ConsumeMagicLinkRequest represents a sign-in with a link's token
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+// Request handles emailing a sign-in link
+func (h *MagicLinkHandler) Request(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req MagicLinkRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+	if req.Email == "" {
+		return utils.ValidationErrorResponse(c, "Email is required", nil)
+	}
+
+	binding, err := h.MagicLinkService.Request(ctx, req.Email, req.SameBrowser)
+	if err != nil {
+		log.WithError(err).Error("Failed to request magic link")
+		return utils.InternalServerErrorResponse(c, "Failed to request magic link")
+	}
+	if binding != "" {
+		h.setBindingCookie(c, binding, h.MagicLinkService.Config.MagicLink.TTL*60)
+	}
+
+	return utils.SuccessResponse(c, nil, "If the email belongs to an account that can sign in with a link, a link has been sent")
+}
+
+// Consume handles signing in with a link's token
+func (h *MagicLinkHandler) Consume(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req ConsumeMagicLinkRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	var binding string
+	if cookie, err := c.Cookie(magicLinkBindingCookie); err == nil {
+		binding = cookie.Value
+	}
+
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	token, err := h.MagicLinkService.Consume(ctx, req.Token, binding, client)
+	var secondFactorErr *services.SecondFactorRequiredError
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.Is(err, services.ErrMagicLinkInvalid), errors.Is(err, services.ErrMagicLinkWrongBrowser):
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	case errors.As(err, &secondFactorErr):
+		if binding != "" {
+			h.setBindingCookie(c, "", -1)
+		}
+		return secondFactorResponse(c, secondFactorErr)
+	case errors.As(err, &statusErr):
+		log.WithError(err).Warn("Login rejected by account status")
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	case err != nil:
+		log.WithError(err).Error("Failed to sign in with magic link")
+		return utils.InternalServerErrorResponse(c, "Failed to sign in with magic link")
+	}
+
+	if binding != "" {
+		h.setBindingCookie(c, "", -1)
+	}
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Login successful")
+}
+
+// setBindingCookie sets or, with a negative maxAge, clears the browser binding cookie
+func (h *MagicLinkHandler) setBindingCookie(c echo.Context, binding string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     magicLinkBindingCookie,
+		Value:    binding,
+		Path:     "/api/login/magic-link",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RegisterRoutes registers the magic link routes
+func (h *MagicLinkHandler) RegisterRoutes(e *echo.Echo) {
+	e.POST("/api/login/magic-link", h.Request)
+	e.POST("/api/login/magic-link/verify", h.Consume)
+}
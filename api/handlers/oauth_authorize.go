@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// Authorize shows the login or consent page for an authorization request,
+// or redirects straight back to the client if the user is signed in and has
+// already allowed the requested scopes
+func (h *OAuthHandler) Authorize(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	req := authorizationRequest(c)
+	grant, err := h.OAuthService.ValidateAuthorizationRequest(ctx, req)
+	if err != nil {
+		return h.authorizationError(c, log, grant, err)
+	}
+
+	user, claims := h.sessionUser(ctx, c)
+	if user == nil {
+		// Clients checking for an existing session silently must not get a login page
+		if req.Prompt == "none" {
+			return redirectWithError(c, grant, services.OAuthErrorLoginRequired, "")
+		}
+		return h.renderAuthorizePage(c, http.StatusOK, "login", grant, req, "", "")
+	}
+	return h.completeAuthorization(ctx, c, user, claims.AuthTime.Time, grant, req)
+}
+
+// SubmitAuthorize handles the login, passkey and consent forms of the authorization page
+func (h *OAuthHandler) SubmitAuthorize(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	if !validCSRFToken(c) {
+		log.Warn("Authorization form submitted without a valid CSRF token")
+		return h.renderErrorPage(c, http.StatusForbidden, "Your session has expired. Go back to the application and try again.")
+	}
+
+	req := authorizationRequest(c)
+	grant, err := h.OAuthService.ValidateAuthorizationRequest(ctx, req)
+	if err != nil {
+		return h.authorizationError(c, log, grant, err)
+	}
+
+	if action := c.FormValue("action"); action == "login" || action == "second-factor" {
+		email := c.FormValue("email")
+		token, err := h.signIn(ctx, c)
+		var secondFactorErr *services.SecondFactorRequiredError
+		if errors.As(err, &secondFactorErr) {
+			data := h.authorizePageData(c, grant, req, email, "")
+			data.WebAuthn = secondFactorErr.Challenge
+			return renderOAuthTemplate(c, http.StatusOK, "second-factor", data)
+		}
+		if err != nil {
+			log.WithError(err).Warn("Login on authorization page failed")
+			return h.renderAuthorizePage(c, http.StatusUnauthorized, "login", grant, req, email, loginErrorMessage(err))
+		}
+
+		h.setSessionCookie(c, token)
+
+		user, claims, err := h.tokenUser(ctx, token)
+		if err != nil {
+			log.WithError(err).Error("Failed to load signed in user")
+			return h.renderErrorPage(c, http.StatusInternalServerError, "Sign in failed. Please try again.")
+		}
+		return h.completeAuthorization(ctx, c, user, claims.AuthTime.Time, grant, req)
+	}
+
+	user, claims := h.sessionUser(ctx, c)
+	if user == nil {
+		return h.renderAuthorizePage(c, http.StatusOK, "login", grant, req, "", "")
+	}
+
+	switch c.FormValue("action") {
+	case "approve":
+		if err := h.OAuthService.GrantConsent(ctx, user.ID, grant); err != nil {
+			log.WithError(err).Error("Failed to record consent")
+			return redirectWithError(c, grant, services.OAuthErrorServerError, "")
+		}
+		return h.issueCode(ctx, c, user, claims.AuthTime.Time, grant)
+	case "deny":
+		log.WithField("user_id", user.ID).WithField("client_id", grant.Client.PublicID).Info("User denied authorization")
+		return redirectWithError(c, grant, services.OAuthErrorAccessDenied, "The user denied the request")
+	default:
+		return h.renderErrorPage(c, http.StatusBadRequest, "Unknown action.")
+	}
+}
+
+// completeAuthorization issues a code if the user already allowed the
+// requested scopes, and otherwise asks for consent
+func (h *OAuthHandler) completeAuthorization(ctx context.Context, c echo.Context, user *models.User, authTime time.Time, grant *services.AuthorizationGrant, req services.AuthorizationRequest) error {
+	log := h.Logger.WithContext(ctx)
+
+	consented, err := h.OAuthService.HasConsent(ctx, user.ID, grant)
+	if err != nil {
+		log.WithError(err).Error("Failed to look up consent")
+		return redirectWithError(c, grant, services.OAuthErrorServerError, "")
+	}
+	if !consented {
+		if req.Prompt == "none" {
+			return redirectWithError(c, grant, services.OAuthErrorConsentRequired, "")
+		}
+		return h.renderAuthorizePage(c, http.StatusOK, "consent", grant, req, "", "")
+	}
+	return h.issueCode(ctx, c, user, authTime, grant)
+}
+
+// issueCode redirects back to the client with a new authorization code
+func (h *OAuthHandler) issueCode(ctx context.Context, c echo.Context, user *models.User, authTime time.Time, grant *services.AuthorizationGrant) error {
+	code, err := h.OAuthService.IssueAuthorizationCode(ctx, user, grant, authTime)
+	if err != nil {
+		h.Logger.WithContext(ctx).WithError(err).Error("Failed to issue authorization code")
+		return redirectWithError(c, grant, services.OAuthErrorServerError, "")
+	}
+	return redirectToClient(c, grant, url.Values{"code": {code}})
+}
+
+// signIn checks the login form of the authorization pages, or the passkey
+// that completes it, and returns the user's login token. Users with a passkey
+// get a SecondFactorRequiredError for their password.
+func (h *OAuthHandler) signIn(ctx context.Context, c echo.Context) (string, error) {
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+	if c.FormValue("action") != "second-factor" {
+		return h.UserService.Login(ctx, c.FormValue("email"), c.FormValue("password"), client)
+	}
+
+	var assertion services.WebAuthnAssertion
+	if err := json.Unmarshal([]byte(c.FormValue("credential")), &assertion); err != nil {
+		return "", fmt.Errorf("%w: malformed credential", services.ErrWebAuthnVerification)
+	}
+	return h.WebAuthnService.FinishLogin(ctx, c.FormValue("ceremony_id"), assertion, client)
+}
+
+// setSessionCookie signs the user in to the authorization pages with their login token
+func (h *OAuthHandler) setSessionCookie(c echo.Context, token string) {
+	c.SetCookie(&http.Cookie{
+		Name:     oauthSessionCookie,
+		Value:    token,
+		Path:     "/oauth",
+		MaxAge:   int((time.Duration(h.OAuthService.Config.JWT.Expiry) * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionUser returns the user signed in to the authorization pages and the
+// claims of their login token, whose auth time is when they signed in
+func (h *OAuthHandler) sessionUser(ctx context.Context, c echo.Context) (*models.User, *utils.JWTClaims) {
+	cookie, err := c.Cookie(oauthSessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	user, claims, err := h.tokenUser(ctx, cookie.Value)
+	if err != nil {
+		h.Logger.WithContext(ctx).WithError(err).Info("Authorization page session is no longer valid")
+		return nil, nil
+	}
+	return user, claims
+}
+
+// tokenUser resolves the user of an unrestricted login token that records
+// when the user authenticated. Impersonation tokens are refused, so admins
+// cannot grant clients access for a user.
+func (h *OAuthHandler) tokenUser(ctx context.Context, token string) (*models.User, *utils.JWTClaims, error) {
+	claims, err := utils.ValidateToken(token, h.OAuthService.Config.JWT.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Scope != "" || claims.ClientID != "" || claims.IsImpersonation() || claims.AuthTime == nil {
+		return nil, nil, errors.New("not a login token")
+	}
+
+	user, err := h.UserService.AuthenticateToken(ctx, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, claims, nil
+}
+
+// authorizationError reports an invalid authorization request. Errors about
+// the client or redirect URI are shown to the user, since redirecting to an
+// unverified URI would make the server an open redirector; all other errors
+// are sent back to the client.
+func (h *OAuthHandler) authorizationError(c echo.Context, log *logrus.Entry, grant *services.AuthorizationGrant, err error) error {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.WithError(err).Error("Failed to validate authorization request")
+		if grant == nil {
+			return h.renderErrorPage(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		}
+		return redirectWithError(c, grant, services.OAuthErrorServerError, "")
+	}
+
+	log.WithError(err).Warn("Invalid authorization request")
+	if grant == nil {
+		return h.renderErrorPage(c, http.StatusBadRequest, oauthErr.Description)
+	}
+	return redirectWithError(c, grant, oauthErr.Code, oauthErr.Description)
+}
+
+// renderAuthorizePage renders the login or consent page, carrying the
+// authorization request through in hidden fields
+func (h *OAuthHandler) renderAuthorizePage(c echo.Context, status int, page string, grant *services.AuthorizationGrant, req services.AuthorizationRequest, email, message string) error {
+	return renderOAuthTemplate(c, status, page, h.authorizePageData(c, grant, req, email, message))
+}
+
+// authorizePageData returns the data of an authorization page
+func (h *OAuthHandler) authorizePageData(c echo.Context, grant *services.AuthorizationGrant, req services.AuthorizationRequest, email, message string) authorizePageData {
+	data := authorizePageData{
+		ClientName: grant.Client.Name,
+		FormAction: "/oauth/authorize",
+		Params: map[string]string{
+			"response_type":         req.ResponseType,
+			"client_id":             req.ClientID,
+			"redirect_uri":          grant.RedirectURI,
+			"scope":                 req.Scope,
+			"state":                 req.State,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+			"nonce":                 req.Nonce,
+		},
+		CSRFToken: csrfToken(c),
+		Email:     email,
+		Error:     message,
+	}
+	for _, scope := range grant.Scopes {
+		data.Scopes = append(data.Scopes, scopeDescription{Name: scope, Description: scopeDescriptions[scope]})
+	}
+	return data
+}
+
+// renderErrorPage renders an error the user cannot be redirected back with
+func (h *OAuthHandler) renderErrorPage(c echo.Context, status int, message string) error {
+	return renderOAuthTemplate(c, status, "error", authorizePageData{Error: message})
+}
+
+// renderOAuthTemplate renders an authorization page template. The pages may
+// not be framed, so they cannot be overlaid to trick users into consenting.
+func renderOAuthTemplate(c echo.Context, status int, name string, data authorizePageData) error {
+	var buf bytes.Buffer
+	if err := oauthTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "frame-ancestors 'none'")
+	return c.HTMLBlob(status, buf.Bytes())
+}
+
+// csrfToken returns the CSRF token of the authorization page, setting a new
+// cookie if there is none. Forms echo it back as the csrf_token field.
+func csrfToken(c echo.Context) string {
+	if cookie, err := c.Cookie(oauthCSRFCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	token, err := utils.GenerateOpaqueToken("csrf")
+	if err != nil {
+		return ""
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oauthCSRFCookie,
+		Value:    token,
+		Path:     "/oauth",
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// validCSRFToken checks the submitted CSRF token against the cookie
+func validCSRFToken(c echo.Context) bool {
+	cookie, err := c.Cookie(oauthCSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(c.FormValue("csrf_token"))) == 1
+}
+
+// authorizationRequest reads the authorization request parameters from the query or form
+func authorizationRequest(c echo.Context) services.AuthorizationRequest {
+	return services.AuthorizationRequest{
+		ResponseType:        c.FormValue("response_type"),
+		ClientID:            c.FormValue("client_id"),
+		RedirectURI:         c.FormValue("redirect_uri"),
+		Scope:               c.FormValue("scope"),
+		State:               c.FormValue("state"),
+		CodeChallenge:       c.FormValue("code_challenge"),
+		CodeChallengeMethod: c.FormValue("code_challenge_method"),
+		Nonce:               c.FormValue("nonce"),
+		Prompt:              c.FormValue("prompt"),
+	}
+}
+
+// redirectWithError redirects back to the client with an OAuth error
+func redirectWithError(c echo.Context, grant *services.AuthorizationGrant, code, description string) error {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	return redirectToClient(c, grant, params)
+}
+
+// redirectToClient redirects to the grant's redirect URI with params and the state added to its query
+func redirectToClient(c echo.Context, grant *services.AuthorizationGrant, params url.Values) error {
+	target, err := url.Parse(grant.RedirectURI)
+	if err != nil {
+		return err
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if grant.State != "" {
+		query.Set("state", grant.State)
+	}
+	target.RawQuery = query.Encode()
+
+	return c.Redirect(http.StatusFound, target.String())
+}
+
+// loginErrorMessage returns the message shown for a failed login on the authorization page
+func loginErrorMessage(err error) string {
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.As(err, &statusErr):
+		return "Your account is " + statusErr.Status + "."
+	case errors.Is(err, services.ErrPasswordExpired):
+		return "Your password has expired. Change it before signing in to other applications."
+	case errors.Is(err, services.ErrWebAuthnVerification):
+		return "Your passkey could not be verified. Sign in again."
+	default:
+		return "Invalid email or password."
+	}
+}
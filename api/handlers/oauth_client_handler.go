@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// OAuthClientHandler handles HTTP requests for OAuth client administration
+// and for the clients a user has authorized
+type OAuthClientHandler struct {
+	OAuthService *services.OAuthService
+	Logger       *utils.Logger
+}
+
+// NewOAuthClientHandler creates a new OAuth client handler
+func NewOAuthClientHandler(oauthService *services.OAuthService, logger *utils.Logger) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		OAuthService: oauthService,
+		Logger:       logger,
+	}
+}
+
+// CreateOAuthClientRequest represents an OAuth client registration request
+type CreateOAuthClientRequest struct {
+	Name                   string   `json:"name" validate:"required"`
+	RedirectURIs           []string `json:"redirect_uris" validate:"required"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+	Scopes                 []string `json:"scopes"`
+	Public                 bool     `json:"public"`
+}
+
+// UpdateOAuthClientRequest represents an OAuth client update request
+type UpdateOAuthClientRequest struct {
+	Name                   *string  `json:"name"`
+	RedirectURIs           []string `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+	Scopes                 []string `json:"scopes"`
+}
+
+// registeredOAuthClient is the registration and rotation response, the only one that includes the secret
+type registeredOAuthClient struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// CreateClient handles registering an OAuth client
+func (h *OAuthClientHandler) CreateClient(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req CreateOAuthClientRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	client, secret, err := h.OAuthService.RegisterClient(ctx, services.OAuthClientInput{
+		Name:                   req.Name,
+		RedirectURIs:           req.RedirectURIs,
+		PostLogoutRedirectURIs: req.PostLogoutRedirectURIs,
+		Scopes:                 req.Scopes,
+		Public:                 req.Public,
+	})
+	if err != nil {
+		return oauthClientErrorResponse(c, "Failed to register OAuth client", err)
+	}
+
+	return utils.SuccessResponse(c, registeredOAuthClient{OAuthClient: client, ClientSecret: secret}, "OAuth client registered successfully")
+}
+
+// ListClients handles listing OAuth clients
+func (h *OAuthClientHandler) ListClients(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clients, err := h.OAuthService.ListClients(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to list OAuth clients")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list OAuth clients", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, clients, "OAuth clients retrieved successfully")
+}
+
+// GetClient handles getting an OAuth client
+func (h *OAuthClientHandler) GetClient(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	client, err := h.OAuthService.GetClient(ctx, clientID.String())
+	if err != nil {
+		return oauthClientErrorResponse(c, "Failed to get OAuth client", err)
+	}
+
+	return utils.SuccessResponse(c, client, "OAuth client retrieved successfully")
+}
+
+// UpdateClient handles updating an OAuth client
+func (h *OAuthClientHandler) UpdateClient(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	var req UpdateOAuthClientRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	client, err := h.OAuthService.UpdateClient(ctx, clientID.String(), services.OAuthClientUpdate{
+		Name:                   req.Name,
+		RedirectURIs:           req.RedirectURIs,
+		PostLogoutRedirectURIs: req.PostLogoutRedirectURIs,
+		Scopes:                 req.Scopes,
+	})
+	if err != nil {
+		return oauthClientErrorResponse(c, "Failed to update OAuth client", err)
+	}
+
+	return utils.SuccessResponse(c, client, "OAuth client updated successfully")
+}
+
+// DeleteClient handles deleting an OAuth client
+func (h *OAuthClientHandler) DeleteClient(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	if err := h.OAuthService.DeleteClient(ctx, clientID.String()); err != nil {
+		return oauthClientErrorResponse(c, "Failed to delete OAuth client", err)
+	}
+
+	return utils.SuccessResponse(c, nil, "OAuth client deleted successfully")
+}
+
+// RotateSecret handles replacing a confidential client's secret
+func (h *OAuthClientHandler) RotateSecret(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	client, secret, err := h.OAuthService.RotateClientSecret(ctx, clientID.String())
+	if err != nil {
+		return oauthClientErrorResponse(c, "Failed to rotate client secret", err)
+	}
+
+	return utils.SuccessResponse(c, registeredOAuthClient{OAuthClient: client, ClientSecret: secret}, "Client secret rotated successfully")
+}
+
+// ListAuthorizations handles listing the clients the current user has authorized
+func (h *OAuthClientHandler) ListAuthorizations(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	authorizations, err := h.OAuthService.ListAuthorizations(ctx, userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to list authorizations")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list authorizations", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, authorizations, "Authorizations retrieved successfully")
+}
+
+// RevokeAuthorization handles revoking the current user's authorization of a client
+func (h *OAuthClientHandler) RevokeAuthorization(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	clientID, err := uuid.Parse(c.Param("client_id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	err = h.OAuthService.RevokeAuthorization(ctx, userID, clientID.String())
+	if errors.Is(err, repositories.ErrConsentNotFound) {
+		return utils.NotFoundErrorResponse(c, "Authorization not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to revoke authorization")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke authorization", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, nil, "Authorization revoked successfully")
+}
+
+// oauthClientErrorResponse maps OAuth client errors to responses
+func oauthClientErrorResponse(c echo.Context, message string, err error) error {
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return utils.NotFoundErrorResponse(c, "OAuth client not found")
+	}
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return utils.ValidationErrorResponse(c, message, validationErr.Violations)
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, message, []string{err.Error()})
+}
+
+// RegisterRoutes registers the OAuth client administration and user authorization routes
+func (h *OAuthClientHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	adminGroup := e.Group("/api/admin/oauth-clients")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.POST("", h.CreateClient)
+	adminGroup.GET("", h.ListClients)
+	adminGroup.GET("/:id", h.GetClient)
+	adminGroup.PATCH("/:id", h.UpdateClient)
+	adminGroup.DELETE("/:id", h.DeleteClient)
+	adminGroup.POST("/:id/secret", h.RotateSecret)
+
+	userGroup := e.Group("/api/users/me/authorizations")
+	userGroup.Use(jwtMiddleware)
+
+	userGroup.GET("", h.ListAuthorizations)
+	userGroup.DELETE("/:client_id", h.RevokeAuthorization)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// DeviceAuthorizationResponse is an RFC 8628 device authorization response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceAuthorization handles the RFC 8628 device authorization endpoint
+func (h *OAuthHandler) DeviceAuthorization(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	clientID, clientSecret, err := clientCredentials(c)
+	if err != nil {
+		log.WithError(err).Warn("Malformed client credentials")
+		return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, err.Error())
+	}
+
+	authorization, err := h.OAuthService.StartDeviceAuthorization(ctx, clientID, clientSecret, c.FormValue("scope"))
+	if err != nil {
+		return tokenErrorResponse(c, log, err)
+	}
+
+	return c.JSON(http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.UserCode,
+		VerificationURI:         authorization.VerificationURI,
+		VerificationURIComplete: authorization.VerificationURIComplete,
+		ExpiresIn:               int(authorization.ExpiresIn.Seconds()),
+		Interval:                int(authorization.Interval.Seconds()),
+	})
+}
+
+// Device shows the device verification page: the login form, the form to
+// enter a user code, or the consent page for the code in the user_code parameter
+func (h *OAuthHandler) Device(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+
+	userCode := c.FormValue("user_code")
+	if user, _ := h.sessionUser(ctx, c); user == nil {
+		return h.renderDevicePage(c, http.StatusOK, "login", nil, userCode, "", "")
+	}
+	if userCode == "" {
+		return h.renderDevicePage(c, http.StatusOK, "device", nil, "", "", "")
+	}
+	return h.showDeviceConsent(ctx, c, userCode)
+}
+
+// SubmitDevice handles the login, passkey, user code and consent forms of the
+// device verification page
+func (h *OAuthHandler) SubmitDevice(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	if !validCSRFToken(c) {
+		log.Warn("Device form submitted without a valid CSRF token")
+		return h.renderErrorPage(c, http.StatusForbidden, "Your session has expired. Reload the page and try again.")
+	}
+
+	userCode := c.FormValue("user_code")
+	if action := c.FormValue("action"); action == "login" || action == "second-factor" {
+		email := c.FormValue("email")
+		token, err := h.signIn(ctx, c)
+		var secondFactorErr *services.SecondFactorRequiredError
+		if errors.As(err, &secondFactorErr) {
+			data := h.devicePageData(c, nil, userCode, email, "")
+			data.WebAuthn = secondFactorErr.Challenge
+			return renderOAuthTemplate(c, http.StatusOK, "second-factor", data)
+		}
+		if err != nil {
+			log.WithError(err).Warn("Login on device page failed")
+			return h.renderDevicePage(c, http.StatusUnauthorized, "login", nil, userCode, email, loginErrorMessage(err))
+		}
+
+		h.setSessionCookie(c, token)
+		if userCode == "" {
+			return h.renderDevicePage(c, http.StatusOK, "device", nil, "", "", "")
+		}
+		return h.showDeviceConsent(ctx, c, userCode)
+	}
+
+	user, claims := h.sessionUser(ctx, c)
+	if user == nil {
+		return h.renderDevicePage(c, http.StatusOK, "login", nil, userCode, "", "")
+	}
+
+	action := c.FormValue("action")
+	if action == "verify" {
+		return h.showDeviceConsent(ctx, c, userCode)
+	}
+	if action != "approve" && action != "deny" {
+		return h.renderErrorPage(c, http.StatusBadRequest, "Unknown action.")
+	}
+
+	grant, err := h.OAuthService.LookupDeviceCode(ctx, userCode)
+	if err != nil {
+		return h.deviceCodeError(ctx, c, userCode, err)
+	}
+
+	page := "device-approved"
+	if action == "deny" {
+		page = "device-denied"
+		err = h.OAuthService.DenyDeviceCode(ctx, user, grant)
+	} else {
+		err = h.OAuthService.ApproveDeviceCode(ctx, user, grant, claims.AuthTime.Time)
+	}
+	if err != nil {
+		return h.deviceCodeError(ctx, c, userCode, err)
+	}
+
+	return renderOAuthTemplate(c, http.StatusOK, page, authorizePageData{ClientName: grant.Client.Name})
+}
+
+// showDeviceConsent asks the signed-in user to approve the device authorization of a user code
+func (h *OAuthHandler) showDeviceConsent(ctx context.Context, c echo.Context, userCode string) error {
+	grant, err := h.OAuthService.LookupDeviceCode(ctx, userCode)
+	if err != nil {
+		return h.deviceCodeError(ctx, c, userCode, err)
+	}
+	return h.renderDevicePage(c, http.StatusOK, "consent", grant, grant.UserCode, "", "")
+}
+
+// deviceCodeError asks for the user code again if it was not accepted
+func (h *OAuthHandler) deviceCodeError(ctx context.Context, c echo.Context, userCode string, err error) error {
+	if errors.Is(err, services.ErrInvalidUserCode) {
+		return h.renderDevicePage(c, http.StatusBadRequest, "device", nil, userCode, "", "That code is invalid or has expired. Check the code on your device and try again.")
+	}
+	h.Logger.WithContext(ctx).WithError(err).Error("Failed to process device authorization")
+	return h.renderErrorPage(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+}
+
+// renderDevicePage renders a page of the device verification flow, carrying the user code through
+func (h *OAuthHandler) renderDevicePage(c echo.Context, status int, page string, grant *services.DeviceGrant, userCode, email, message string) error {
+	return renderOAuthTemplate(c, status, page, h.devicePageData(c, grant, userCode, email, message))
+}
+
+// devicePageData returns the data of a device verification page
+func (h *OAuthHandler) devicePageData(c echo.Context, grant *services.DeviceGrant, userCode, email, message string) authorizePageData {
+	data := authorizePageData{
+		FormAction: "/oauth/device",
+		Params:     map[string]string{"user_code": userCode},
+		CSRFToken:  csrfToken(c),
+		Email:      email,
+		Error:      message,
+	}
+	if grant != nil {
+		data.ClientName = grant.Client.Name
+		for _, scope := range grant.Code.Scopes {
+			data.Scopes = append(data.Scopes, scopeDescription{Name: scope, Description: scopeDescriptions[scope]})
+		}
+	}
+	return data
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// Cookies used by the authorization page
+const (
+	oauthSessionCookie = "oauth_session"
+	oauthCSRFCookie    = "oauth_csrf"
+)
+
+// deviceCodeGrantType is the RFC 8628 device authorization grant
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// OAuthHandler handles the OAuth2 endpoints
+type OAuthHandler struct {
+	ServiceAccountService *services.ServiceAccountService
+	OAuthService          *services.OAuthService
+	UserService           *services.UserService
+	WebAuthnService       *services.WebAuthnService
+	IntrospectionService  *services.TokenIntrospectionService
+	Logger                *utils.Logger
+}
+
+// NewOAuthHandler creates a new OAuth handler
+func NewOAuthHandler(serviceAccountService *services.ServiceAccountService, oauthService *services.OAuthService, userService *services.UserService, webAuthnService *services.WebAuthnService, introspectionService *services.TokenIntrospectionService, logger *utils.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		ServiceAccountService: serviceAccountService,
+		OAuthService:          oauthService,
+		UserService:           userService,
+		WebAuthnService:       webAuthnService,
+		IntrospectionService:  introspectionService,
+		Logger:                logger,
+	}
+}
+
+// TokenResponse is a successful OAuth2 token response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthErrorResponse is an OAuth2 error response
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Token handles the OAuth2 token endpoint
+func (h *OAuthHandler) Token(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	// Token responses must never be cached
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	grantType := c.FormValue("grant_type")
+	switch grantType {
+	case "client_credentials":
+		clientID, clientSecret, err := clientCredentials(c)
+		if err != nil {
+			log.WithError(err).Warn("Malformed client credentials")
+			return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, err.Error())
+		}
+
+		token, scopes, ttl, err := h.ServiceAccountService.IssueClientCredentialsToken(ctx, clientID, clientSecret, c.FormValue("scope"))
+		if errors.Is(err, services.ErrInvalidClient) {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+			return oauthError(c, http.StatusUnauthorized, services.OAuthErrorInvalidClient, "Client authentication failed")
+		}
+		if errors.Is(err, services.ErrInvalidScope) {
+			return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidScope, err.Error())
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to issue client credentials token")
+			return oauthError(c, http.StatusInternalServerError, services.OAuthErrorServerError, "")
+		}
+
+		return c.JSON(http.StatusOK, TokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(ttl.Seconds()),
+			Scope:       strings.Join(scopes, " "),
+		})
+	case "authorization_code", "refresh_token", deviceCodeGrantType:
+		clientID, clientSecret, err := clientCredentials(c)
+		if err != nil {
+			log.WithError(err).Warn("Malformed client credentials")
+			return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, err.Error())
+		}
+
+		var tokens *services.TokenSet
+		switch grantType {
+		case "authorization_code":
+			tokens, err = h.OAuthService.ExchangeAuthorizationCode(ctx, clientID, clientSecret, c.FormValue("code"), c.FormValue("redirect_uri"), c.FormValue("code_verifier"))
+		case deviceCodeGrantType:
+			tokens, err = h.OAuthService.ExchangeDeviceCode(ctx, clientID, clientSecret, c.FormValue("device_code"))
+		default:
+			tokens, err = h.OAuthService.RefreshAccessToken(ctx, clientID, clientSecret, c.FormValue("refresh_token"), c.FormValue("scope"))
+		}
+		if err != nil {
+			return tokenErrorResponse(c, log, err)
+		}
+
+		return c.JSON(http.StatusOK, TokenResponse{
+			AccessToken:  tokens.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+			RefreshToken: tokens.RefreshToken,
+			IDToken:      tokens.IDToken,
+			Scope:        strings.Join(tokens.Scopes, " "),
+		})
+	case "":
+		return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, "grant_type is required")
+	default:
+		log.WithField("grant_type", grantType).Warn("Unsupported grant type")
+		return oauthError(c, http.StatusBadRequest, services.OAuthErrorUnsupportedGrantType, "")
+	}
+}
+
+// tokenErrorResponse maps OAuth service errors to token endpoint error responses
+func tokenErrorResponse(c echo.Context, log *logrus.Entry, err error) error {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.WithError(err).Error("Failed to issue token")
+		return oauthError(c, http.StatusInternalServerError, services.OAuthErrorServerError, "")
+	}
+
+	log.WithError(err).Warn("Token request rejected")
+	if oauthErr.Code == services.OAuthErrorInvalidClient {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		return oauthError(c, http.StatusUnauthorized, oauthErr.Code, oauthErr.Description)
+	}
+	return oauthError(c, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic
+// authentication or, failing that, from the form body
+func clientCredentials(c echo.Context) (string, string, error) {
+	if username, password, ok := c.Request().BasicAuth(); ok {
+		if c.FormValue("client_secret") != "" {
+			return "", "", errors.New("only one client authentication method may be used")
+		}
+
+		// Basic credentials are form-encoded before being base64-encoded
+		clientID, err := url.QueryUnescape(username)
+		if err != nil {
+			return "", "", errors.New("invalid client_id encoding")
+		}
+		clientSecret, err := url.QueryUnescape(password)
+		if err != nil {
+			return "", "", errors.New("invalid client_secret encoding")
+		}
+		return clientID, clientSecret, nil
+	}
+
+	return c.FormValue("client_id"), c.FormValue("client_secret"), nil
+}
+
+// oauthError writes an OAuth2 error response
+func oauthError(c echo.Context, status int, code, description string) error {
+	return c.JSON(status, OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// RegisterRoutes registers the OAuth and OpenID Connect routes
+func (h *OAuthHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+	e.GET("/.well-known/openid-configuration", h.Discovery)
+	e.GET("/oauth/jwks", h.JWKS)
+	e.GET("/oauth/authorize", h.Authorize)
+	e.POST("/oauth/authorize", h.SubmitAuthorize)
+	e.POST("/oauth/token", h.Token)
+	e.POST("/oauth/device_authorization", h.DeviceAuthorization)
+	e.GET("/oauth/device", h.Device)
+	e.POST("/oauth/device", h.SubmitDevice)
+	e.POST("/oauth/introspect", h.Introspect)
+	e.POST("/oauth/revoke", h.Revoke)
+	e.GET("/oauth/userinfo", h.UserInfo, jwtMiddleware)
+	e.POST("/oauth/userinfo", h.UserInfo, jwtMiddleware)
+	e.GET("/oauth/logout", h.Logout)
+	e.POST("/oauth/logout", h.Logout)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// IntrospectionResponse is an RFC 7662 token introspection response
+type IntrospectionResponse struct {
+	Active    bool         `json:"active"`
+	Scope     string       `json:"scope,omitempty"`
+	ClientID  string       `json:"client_id,omitempty"`
+	Username  string       `json:"username,omitempty"`
+	TokenType string       `json:"token_type,omitempty"`
+	ExpiresAt int64        `json:"exp,omitempty"`
+	IssuedAt  int64        `json:"iat,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Actor     *utils.Actor `json:"act,omitempty"`
+}
+
+// Introspect handles RFC 7662 token introspection. The token_type_hint
+// parameter is ignored, since every token type is recognisable by its format.
+func (h *OAuthHandler) Introspect(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	caller, err := h.tokenCaller(ctx, c)
+	if err != nil {
+		return tokenErrorResponse(c, log, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, "token is required")
+	}
+
+	result, err := h.IntrospectionService.Introspect(ctx, caller, token)
+	if err != nil {
+		return tokenErrorResponse(c, log, err)
+	}
+
+	response := IntrospectionResponse{
+		Active:    result.Active,
+		Scope:     strings.Join(result.Scopes, " "),
+		ClientID:  result.ClientID,
+		Username:  result.Username,
+		TokenType: result.TokenType,
+		Subject:   result.Subject,
+		Actor:     result.Actor,
+	}
+	if result.ExpiresAt != nil {
+		response.ExpiresAt = result.ExpiresAt.Unix()
+	}
+	if result.IssuedAt != nil {
+		response.IssuedAt = result.IssuedAt.Unix()
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// Revoke handles RFC 7009 token revocation of access and refresh tokens
+func (h *OAuthHandler) Revoke(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	caller, err := h.tokenCaller(ctx, c)
+	if err != nil {
+		return tokenErrorResponse(c, log, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, http.StatusBadRequest, services.OAuthErrorInvalidRequest, "token is required")
+	}
+
+	if err := h.IntrospectionService.Revoke(ctx, caller, token); err != nil {
+		return tokenErrorResponse(c, log, err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// tokenCaller authenticates the client calling the introspection or revocation endpoint
+func (h *OAuthHandler) tokenCaller(ctx context.Context, c echo.Context) (*services.TokenCaller, error) {
+	clientID, clientSecret, err := clientCredentials(c)
+	if err != nil {
+		return nil, &services.OAuthError{Code: services.OAuthErrorInvalidRequest, Description: err.Error()}
+	}
+	return h.IntrospectionService.AuthenticateCaller(ctx, clientID, clientSecret)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"html/template"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+)
+
+// scopeDescriptions explains each scope on the consent page
+var scopeDescriptions = map[string]string{
+	models.ScopeProfileRead:  "View your profile",
+	models.ScopeProfileWrite: "Update your profile",
+	models.ScopeUsersRead:    "View other users",
+	models.ScopeUsersExport:  "Export the user directory",
+	models.ScopeAdminUsers:   "Suspend and reactivate users",
+	models.ScopeOpenID:       "Sign you in with your account",
+	models.ScopeProfile:      "View your name",
+	models.ScopeEmail:        "View your email address",
+}
+
+// authorizePageData is rendered by the authorization page templates.
+// FormAction is the endpoint the login and consent forms post to, and
+// WebAuthn the passkey ceremony that completes a password login.
+type authorizePageData struct {
+	ClientName string
+	FormAction string
+	Params     map[string]string
+	CSRFToken  string
+	Email      string
+	Error      string
+	Scopes     []scopeDescription
+	WebAuthn   *services.WebAuthnCeremony
+}
+
+// scopeDescription is a scope listed on the consent page
+type scopeDescription struct {
+	Name        string
+	Description string
+}
+
+var oauthTemplates = template.Must(template.New("oauth").Parse(`
+{{define "layout-start"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; background: #f4f5f7; margin: 0; }
+main { max-width: 360px; margin: 64px auto; background: #fff; padding: 32px; border-radius: 8px; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 4px 0 16px; padding: 8px; }
+button { padding: 10px; margin-top: 8px; cursor: pointer; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<main>{{end}}
+
+{{define "layout-end"}}</main>
+</body>
+</html>{{end}}
+
+{{define "hidden-params"}}{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">{{end}}
+
+{{define "login"}}{{template "layout-start"}}
+<h1>Sign in</h1>
+{{if .ClientName}}<p>Sign in to continue to <strong>{{.ClientName}}</strong>.</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="{{.FormAction}}">
+{{template "hidden-params" .}}
+<input type="hidden" name="action" value="login">
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form>
+{{template "layout-end"}}{{end}}
+
+{{define "second-factor"}}{{template "layout-start"}}
+<h1>Confirm it's you</h1>
+<p>Use your passkey to finish signing in{{if .ClientName}} to <strong>{{.ClientName}}</strong>{{end}}.</p>
+<p class="error" id="passkey-error" hidden>Your passkey could not be used. Try again.</p>
+<form id="second-factor" method="post" action="{{.FormAction}}">
+{{template "hidden-params" .}}
+<input type="hidden" name="action" value="second-factor">
+<input type="hidden" name="email" value="{{.Email}}">
+<input type="hidden" name="ceremony_id" value="{{.WebAuthn.CeremonyID}}">
+<input type="hidden" name="credential">
+<button type="submit">Use passkey</button>
+</form>
+<script>
+(function () {
+  var form = document.getElementById("second-factor");
+  var options = {{.WebAuthn.PublicKey}};
+  var decode = function (value) {
+    return Uint8Array.from(atob(value.replace(/-/g, "+").replace(/_/g, "/")), function (c) { return c.charCodeAt(0); });
+  };
+  var encode = function (buffer) {
+    return btoa(String.fromCharCode.apply(null, new Uint8Array(buffer))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  };
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var publicKey = Object.assign({}, options, {
+      challenge: decode(options.challenge),
+      allowCredentials: options.allowCredentials.map(function (credential) {
+        return Object.assign({}, credential, {id: decode(credential.id)});
+      })
+    });
+    navigator.credentials.get({publicKey: publicKey}).then(function (credential) {
+      var response = credential.response;
+      form.elements.credential.value = JSON.stringify({
+        id: credential.id,
+        rawId: encode(credential.rawId),
+        type: credential.type,
+        response: {
+          clientDataJSON: encode(response.clientDataJSON),
+          authenticatorData: encode(response.authenticatorData),
+          signature: encode(response.signature),
+          userHandle: response.userHandle ? encode(response.userHandle) : undefined
+        }
+      });
+      form.submit();
+    }, function () {
+      document.getElementById("passkey-error").hidden = false;
+    });
+  });
+})();
+</script>
+{{template "layout-end"}}{{end}}
+
+{{define "consent"}}{{template "layout-start"}}
+<h1>Authorize {{.ClientName}}</h1>
+<p><strong>{{.ClientName}}</strong> is requesting permission to:</p>
+<ul>
+{{range .Scopes}}<li>{{.Description}} <small>({{.Name}})</small></li>
+{{end}}</ul>
+<form method="post" action="{{.FormAction}}">
+{{template "hidden-params" .}}
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{template "layout-end"}}{{end}}
+
+{{define "logout"}}{{template "layout-start"}}
+<h1>Sign out</h1>
+{{if .ClientName}}<p><strong>{{.ClientName}}</strong> asked to sign you out.</p>{{end}}
+<p>Do you want to sign out of your account?</p>
+<form method="post" action="/oauth/logout">
+{{template "hidden-params" .}}
+<button type="submit" name="action" value="logout">Sign out</button>
+</form>
+{{template "layout-end"}}{{end}}
+
+{{define "signed-out"}}{{template "layout-start"}}
+<h1>Signed out</h1>
+<p>You have been signed out. You can close this window.</p>
+{{template "layout-end"}}{{end}}
+
+{{define "device"}}{{template "layout-start"}}
+<h1>Connect a device</h1>
+<p>Enter the code shown on your device.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/device">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="action" value="verify">
+<label for="user_code">Code</label>
+<input id="user_code" name="user_code" value="{{index .Params "user_code"}}" autocomplete="off" autocapitalize="characters" required autofocus>
+<button type="submit">Continue</button>
+</form>
+{{template "layout-end"}}{{end}}
+
+{{define "device-approved"}}{{template "layout-start"}}
+<h1>Device connected</h1>
+<p><strong>{{.ClientName}}</strong> is now signed in. You can return to your device.</p>
+{{template "layout-end"}}{{end}}
+
+{{define "device-denied"}}{{template "layout-start"}}
+<h1>Request denied</h1>
+<p><strong>{{.ClientName}}</strong> was not given access to your account.</p>
+{{template "layout-end"}}{{end}}
+
+{{define "error"}}{{template "layout-start"}}
+<h1>Authorization failed</h1>
+<p class="error">{{.Error}}</p>
+{{template "layout-end"}}{{end}}
+`))
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery serves the OpenID Connect discovery document
+func (h *OAuthHandler) Discovery(c echo.Context) error {
+	issuer := h.OAuthService.Config.OIDC.Issuer
+	return c.JSON(http.StatusOK, OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/oauth/jwks",
+		EndSessionEndpoint:                issuer + "/oauth/logout",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   append([]string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail}, models.PersonalAccessTokenScopes...),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{utils.PKCEMethodS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "name", "updated_at", "email", "email_verified"},
+	})
+}
+
+// JWKS serves the public keys ID tokens are signed with
+func (h *OAuthHandler) JWKS(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string][]utils.JWK{
+		"keys": {h.OAuthService.SigningKey.JWK()},
+	})
+}
+
+// UserInfo returns claims about the user an access token was issued for.
+// OAuth access tokens only see the claims their scopes allow.
+func (h *OAuthHandler) UserInfo(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	scopes := strings.Fields(middleware.GetTokenScope(c))
+	if len(scopes) == 0 {
+		// Login tokens belong to the user themselves
+		scopes = []string{models.ScopeProfile, models.ScopeEmail}
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, h.OAuthService.UserInfo(user, scopes))
+}
+
+// Logout handles RP-initiated logout. Requests carrying an ID token for the
+// signed-in user end the session immediately; others must be confirmed, so a
+// third-party page cannot sign the user out.
+func (h *OAuthHandler) Logout(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	idTokenHint := c.FormValue("id_token_hint")
+	logout, err := h.OAuthService.ValidateLogoutRequest(ctx, idTokenHint, c.FormValue("client_id"), c.FormValue("post_logout_redirect_uri"))
+	if err != nil {
+		return h.authorizationError(c, log, nil, err)
+	}
+
+	user, claims := h.sessionUser(ctx, c)
+	confirmed := c.Request().Method == http.MethodPost && c.FormValue("action") == "logout" && validCSRFToken(c)
+	if user != nil && !confirmed && (idTokenHint == "" || logout.Subject != user.PublicID) {
+		data := authorizePageData{
+			Params: map[string]string{
+				"id_token_hint":            idTokenHint,
+				"client_id":                c.FormValue("client_id"),
+				"post_logout_redirect_uri": logout.RedirectURI,
+				"state":                    c.FormValue("state"),
+			},
+			CSRFToken: csrfToken(c),
+		}
+		if logout.Client != nil {
+			data.ClientName = logout.Client.Name
+		}
+		return renderOAuthTemplate(c, http.StatusOK, "logout", data)
+	}
+
+	if user != nil {
+		if claims.SessionID != "" {
+			if err := h.UserService.SessionService.RevokeSession(ctx, user.ID, claims.SessionID); err != nil {
+				log.WithError(err).Warn("Failed to revoke session on logout")
+			}
+		}
+		log.WithField("user_id", user.ID).Info("User signed out")
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oauthSessionCookie,
+		Value:    "",
+		Path:     "/oauth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if logout.RedirectURI == "" {
+		return renderOAuthTemplate(c, http.StatusOK, "signed-out", authorizePageData{})
+	}
+
+	target, err := url.Parse(logout.RedirectURI)
+	if err != nil {
+		return err
+	}
+	if state := c.FormValue("state"); state != "" {
+		query := target.Query()
+		query.Set("state", state)
+		target.RawQuery = query.Encode()
+	}
+	return c.Redirect(http.StatusFound, target.String())
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// PasswordResetHandler handles HTTP requests for resetting a forgotten password
+type PasswordResetHandler struct {
+	PasswordResetService *services.PasswordResetService
+	Logger               *utils.Logger
+}
+
+// NewPasswordResetHandler creates a new password reset handler
+func NewPasswordResetHandler(passwordResetService *services.PasswordResetService, logger *utils.Logger) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		PasswordResetService: passwordResetService,
+		Logger:               logger,
+	}
+}
+
+// PasswordResetRequest represents a request for a password reset link
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// ConfirmPasswordResetRequest represents setting a new password with a link's token
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Request handles emailing a password reset link
+func (h *PasswordResetHandler) Request(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req PasswordResetRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+	if req.Email == "" {
+		return utils.ValidationErrorResponse(c, "Email is required", nil)
+	}
+
+	if err := h.PasswordResetService.Request(ctx, req.Email); err != nil {
+		log.WithError(err).Error("Failed to request password reset")
+		return utils.InternalServerErrorResponse(c, "Failed to request password reset")
+	}
+
+	return utils.SuccessResponse(c, nil, "If the email belongs to an account with a password, a reset link has been sent")
+}
+
+// Confirm handles setting a new password with a link's token
+func (h *PasswordResetHandler) Confirm(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req ConfirmPasswordResetRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+	if req.Token == "" || req.Password == "" {
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{"token and password are required"})
+	}
+
+	err := h.PasswordResetService.Reset(ctx, req.Token, req.Password)
+	var policyErr *services.PasswordPolicyError
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.Is(err, services.ErrPasswordResetInvalid):
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	case errors.As(err, &policyErr):
+		return utils.ValidationErrorResponse(c, "Password does not meet the password policy", errorDetails(err))
+	case errors.As(err, &statusErr):
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	case err != nil:
+		log.WithError(err).Error("Failed to reset password")
+		return utils.InternalServerErrorResponse(c, "Failed to reset password")
+	}
+
+	return utils.SuccessResponse(c, nil, "Password reset, sign in with the new password")
+}
+
+// RegisterRoutes registers the password reset routes
+func (h *PasswordResetHandler) RegisterRoutes(e *echo.Echo) {
+	e.POST("/api/password/reset", h.Request)
+	e.POST("/api/password/reset/confirm", h.Confirm)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// PersonalAccessTokenHandler handles HTTP requests for the current user's personal access tokens
+type PersonalAccessTokenHandler struct {
+	TokenService *services.PersonalAccessTokenService
+	Logger       *utils.Logger
+}
+
+// NewPersonalAccessTokenHandler creates a new personal access token handler
+func NewPersonalAccessTokenHandler(tokenService *services.PersonalAccessTokenService, logger *utils.Logger) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{
+		TokenService: tokenService,
+		Logger:       logger,
+	}
+}
+
+// CreateAccessTokenRequest represents a personal access token creation request
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UpdateAccessTokenRequest represents a personal access token update request
+type UpdateAccessTokenRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// createdAccessToken is the creation response, the only one that includes the token itself
+type createdAccessToken struct {
+	*models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// CreateToken handles creating a personal access token
+func (h *PersonalAccessTokenHandler) CreateToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req CreateAccessTokenRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	token, plaintext, err := h.TokenService.CreateToken(ctx, userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		log.WithError(err).Warn("Failed to create access token")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to create access token", errorDetails(err))
+	}
+
+	// The plaintext token is only ever returned here
+	return utils.SuccessResponse(c, createdAccessToken{PersonalAccessToken: token, Token: plaintext}, "Access token created successfully")
+}
+
+// ListTokens handles listing the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) ListTokens(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	tokens, err := h.TokenService.ListTokens(ctx, userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to list access tokens")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list access tokens", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, tokens, "Access tokens retrieved successfully")
+}
+
+// GetToken handles getting one of the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) GetToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid access token ID")
+		return utils.ValidationErrorResponse(c, "Invalid access token ID", []string{err.Error()})
+	}
+
+	token, err := h.TokenService.GetToken(ctx, userID, tokenID.String())
+	if err != nil {
+		return accessTokenErrorResponse(c, "Failed to get access token", err)
+	}
+
+	return utils.SuccessResponse(c, token, "Access token retrieved successfully")
+}
+
+// UpdateToken handles renaming one of the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) UpdateToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid access token ID")
+		return utils.ValidationErrorResponse(c, "Invalid access token ID", []string{err.Error()})
+	}
+
+	var req UpdateAccessTokenRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	token, err := h.TokenService.RenameToken(ctx, userID, tokenID.String(), req.Name)
+	if err != nil {
+		return accessTokenErrorResponse(c, "Failed to update access token", err)
+	}
+
+	return utils.SuccessResponse(c, token, "Access token updated successfully")
+}
+
+// DeleteToken handles revoking one of the current user's personal access tokens
+func (h *PersonalAccessTokenHandler) DeleteToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid access token ID")
+		return utils.ValidationErrorResponse(c, "Invalid access token ID", []string{err.Error()})
+	}
+
+	if err := h.TokenService.DeleteToken(ctx, userID, tokenID.String()); err != nil {
+		return accessTokenErrorResponse(c, "Failed to delete access token", err)
+	}
+
+	return utils.SuccessResponse(c, nil, "Access token deleted successfully")
+}
+
+// accessTokenErrorResponse maps personal access token errors to responses
+func accessTokenErrorResponse(c echo.Context, message string, err error) error {
+	if errors.Is(err, repositories.ErrAccessTokenNotFound) {
+		return utils.NotFoundErrorResponse(c, "Access token not found")
+	}
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return utils.ValidationErrorResponse(c, message, validationErr.Violations)
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, message, []string{err.Error()})
+}
+
+// RegisterRoutes registers the personal access token routes
+func (h *PersonalAccessTokenHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+	tokenGroup := e.Group("/api/users/me/tokens")
+	tokenGroup.Use(jwtMiddleware)
+
+	tokenGroup.POST("", h.CreateToken)
+	tokenGroup.GET("", h.ListTokens)
+	tokenGroup.GET("/:id", h.GetToken)
+	tokenGroup.PATCH("/:id", h.UpdateToken)
+	tokenGroup.DELETE("/:id", h.DeleteToken)
+}
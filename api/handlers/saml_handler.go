@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// SAMLHandler handles single sign-on through tenants' SAML identity providers
+type SAMLHandler struct {
+	SAMLService *services.SAMLService
+	Logger      *utils.Logger
+}
+
+// NewSAMLHandler creates a new SAML handler
+func NewSAMLHandler(samlService *services.SAMLService, logger *utils.Logger) *SAMLHandler {
+	return &SAMLHandler{
+		SAMLService: samlService,
+		Logger:      logger,
+	}
+}
+
+// Metadata handles serving the service provider metadata of a connection
+func (h *SAMLHandler) Metadata(c echo.Context) error {
+	metadata, err := h.SAMLService.Metadata(c.Param("connection"))
+	if errors.Is(err, services.ErrUnknownSAMLConnection) {
+		return utils.NotFoundErrorResponse(c, "SAML connection not found")
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to build metadata", []string{err.Error()})
+	}
+
+	return c.Blob(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login handles starting single sign-on by redirecting to the identity provider
+func (h *SAMLHandler) Login(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	target, err := h.SAMLService.BeginLogin(ctx, c.Param("connection"))
+	if errors.Is(err, services.ErrUnknownSAMLConnection) {
+		return utils.NotFoundErrorResponse(c, "SAML connection not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to start SAML login")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start sign-in", []string{err.Error()})
+	}
+
+	return c.Redirect(http.StatusFound, target)
+}
+
+// ACS handles the assertion consumer service, where the identity provider posts its response
+func (h *SAMLHandler) ACS(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx).WithField("connection", c.Param("connection"))
+
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	login, err := h.SAMLService.ConsumeResponse(ctx, c.Param("connection"), c.FormValue("SAMLResponse"), client)
+	if errors.Is(err, services.ErrUnknownSAMLConnection) {
+		return utils.NotFoundErrorResponse(c, "SAML connection not found")
+	}
+	if errors.Is(err, services.ErrInvalidSAMLResponse) {
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	}
+	return federatedLoginResponse(c, log, login, err)
+}
+
+// RegisterRoutes registers the SAML routes
+func (h *SAMLHandler) RegisterRoutes(e *echo.Echo) {
+	samlGroup := e.Group("/api/auth/saml/:connection")
+
+	samlGroup.GET("/metadata", h.Metadata)
+	samlGroup.GET("/login", h.Login)
+	samlGroup.POST("/acs", h.ACS)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/services"
+)
+
+// SCIM discovery schema URNs
+const (
+	scimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	scimResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// SCIMFeature describes whether an optional SCIM feature is supported
+type SCIMFeature struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  *int `json:"maxOperations,omitempty"`
+	MaxPayloadSize *int `json:"maxPayloadSize,omitempty"`
+	MaxResults     *int `json:"maxResults,omitempty"`
+}
+
+// SCIMAuthenticationScheme describes how SCIM clients authenticate
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SCIMDiscoveryMeta is the metadata of a discovery resource
+type SCIMDiscoveryMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// SCIMServiceProviderConfig describes the SCIM features the service supports
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 SCIMFeature                `json:"patch"`
+	Bulk                  SCIMFeature                `json:"bulk"`
+	Filter                SCIMFeature                `json:"filter"`
+	ChangePassword        SCIMFeature                `json:"changePassword"`
+	Sort                  SCIMFeature                `json:"sort"`
+	ETag                  SCIMFeature                `json:"etag"`
+	AuthenticationSchemes []SCIMAuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  SCIMDiscoveryMeta          `json:"meta"`
+}
+
+// SCIMSchemaAttribute describes an attribute of a SCIM schema
+type SCIMSchemaAttribute struct {
+	Name           string                `json:"name"`
+	Type           string                `json:"type"`
+	MultiValued    bool                  `json:"multiValued"`
+	Required       bool                  `json:"required"`
+	CaseExact      bool                  `json:"caseExact"`
+	Mutability     string                `json:"mutability"`
+	Returned       string                `json:"returned"`
+	Uniqueness     string                `json:"uniqueness"`
+	ReferenceTypes []string              `json:"referenceTypes,omitempty"`
+	SubAttributes  []SCIMSchemaAttribute `json:"subAttributes,omitempty"`
+}
+
+// SCIMSchema describes a SCIM resource schema
+type SCIMSchema struct {
+	Schemas     []string              `json:"schemas"`
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Attributes  []SCIMSchemaAttribute `json:"attributes"`
+	Meta        SCIMDiscoveryMeta     `json:"meta"`
+}
+
+// SCIMResourceType describes a SCIM resource type
+type SCIMResourceType struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Endpoint    string            `json:"endpoint"`
+	Description string            `json:"description"`
+	Schema      string            `json:"schema"`
+	Meta        SCIMDiscoveryMeta `json:"meta"`
+}
+
+// scimAttribute describes a single-valued, optional, case-insensitive attribute
+func scimAttribute(name, attributeType, mutability string, subAttributes ...SCIMSchemaAttribute) SCIMSchemaAttribute {
+	return SCIMSchemaAttribute{
+		Name:          name,
+		Type:          attributeType,
+		Mutability:    mutability,
+		Returned:      "default",
+		Uniqueness:    "none",
+		SubAttributes: subAttributes,
+	}
+}
+
+// ServiceProviderConfig serves the SCIM service provider configuration
+func (h *SCIMHandler) ServiceProviderConfig(c echo.Context) error {
+	maxResults, none := services.SCIMMaxPageSize, 0
+	return scimResponse(c, http.StatusOK, SCIMServiceProviderConfig{
+		Schemas:        []string{scimServiceProviderConfigSchema},
+		Patch:          SCIMFeature{Supported: true},
+		Bulk:           SCIMFeature{MaxOperations: &none, MaxPayloadSize: &none},
+		Filter:         SCIMFeature{Supported: true, MaxResults: &maxResults},
+		ChangePassword: SCIMFeature{},
+		Sort:           SCIMFeature{},
+		ETag:           SCIMFeature{Supported: true},
+		AuthenticationSchemes: []SCIMAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer Token",
+			Description: "A SCIM token an administrator issued to the tenant",
+		}},
+		Meta: SCIMDiscoveryMeta{ResourceType: "ServiceProviderConfig", Location: h.SCIMService.BaseURL() + "/ServiceProviderConfig"},
+	}, "")
+}
+
+// Schemas serves the schemas of the supported resources
+func (h *SCIMHandler) Schemas(c echo.Context) error {
+	schemas := h.schemas()
+	return scimResponse(c, http.StatusOK, services.SCIMListResponse{
+		Schemas:      []string{services.SCIMListResponseSchema},
+		TotalResults: int64(len(schemas)),
+		StartIndex:   1,
+		ItemsPerPage: len(schemas),
+		Resources:    schemas,
+	}, "")
+}
+
+// Schema serves one schema by its URN
+func (h *SCIMHandler) Schema(c echo.Context) error {
+	for _, schema := range h.schemas() {
+		if schema.ID == c.Param("id") {
+			return scimResponse(c, http.StatusOK, schema, "")
+		}
+	}
+	return middleware.SCIMErrorResponse(c, &services.SCIMError{Status: http.StatusNotFound, Detail: "unknown schema"})
+}
+
+// ResourceTypes serves the supported resource types
+func (h *SCIMHandler) ResourceTypes(c echo.Context) error {
+	resourceTypes := h.resourceTypes()
+	return scimResponse(c, http.StatusOK, services.SCIMListResponse{
+		Schemas:      []string{services.SCIMListResponseSchema},
+		TotalResults: int64(len(resourceTypes)),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	}, "")
+}
+
+// ResourceType serves one resource type by name
+func (h *SCIMHandler) ResourceType(c echo.Context) error {
+	for _, resourceType := range h.resourceTypes() {
+		if resourceType.ID == c.Param("id") {
+			return scimResponse(c, http.StatusOK, resourceType, "")
+		}
+	}
+	return middleware.SCIMErrorResponse(c, &services.SCIMError{Status: http.StatusNotFound, Detail: "unknown resource type"})
+}
+
+// schemas describes the attributes of users and groups the service stores
+func (h *SCIMHandler) schemas() []SCIMSchema {
+	userName := scimAttribute("userName", "string", "readWrite")
+	userName.Required = true
+	userName.Uniqueness = "server"
+
+	emails := scimAttribute("emails", "complex", "readOnly",
+		scimAttribute("value", "string", "readOnly"),
+		scimAttribute("type", "string", "readOnly"),
+		scimAttribute("primary", "boolean", "readOnly"),
+	)
+	emails.MultiValued = true
+
+	displayName := scimAttribute("displayName", "string", "readWrite")
+	displayName.Required = true
+	displayName.Uniqueness = "server"
+
+	members := scimAttribute("members", "complex", "readWrite",
+		scimAttribute("value", "string", "immutable"),
+		scimAttribute("display", "string", "readOnly"),
+		scimAttribute("$ref", "reference", "immutable"),
+	)
+	members.MultiValued = true
+	members.SubAttributes[2].ReferenceTypes = []string{"User"}
+
+	return []SCIMSchema{
+		{
+			Schemas:     []string{scimSchemaSchema},
+			ID:          services.SCIMUserSchema,
+			Name:        "User",
+			Description: "User account; userName is the user's email address",
+			Attributes: []SCIMSchemaAttribute{
+				userName,
+				scimAttribute("name", "complex", "readWrite",
+					scimAttribute("formatted", "string", "readWrite"),
+					scimAttribute("givenName", "string", "writeOnly"),
+					scimAttribute("familyName", "string", "writeOnly"),
+				),
+				scimAttribute("displayName", "string", "readWrite"),
+				emails,
+				scimAttribute("active", "boolean", "readWrite"),
+			},
+			Meta: SCIMDiscoveryMeta{ResourceType: "Schema", Location: h.SCIMService.BaseURL() + "/Schemas/" + services.SCIMUserSchema},
+		},
+		{
+			Schemas:     []string{scimSchemaSchema},
+			ID:          services.SCIMGroupSchema,
+			Name:        "Group",
+			Description: "Group of users",
+			Attributes:  []SCIMSchemaAttribute{displayName, members},
+			Meta:        SCIMDiscoveryMeta{ResourceType: "Schema", Location: h.SCIMService.BaseURL() + "/Schemas/" + services.SCIMGroupSchema},
+		},
+	}
+}
+
+// resourceTypes describes the user and group resource types
+func (h *SCIMHandler) resourceTypes() []SCIMResourceType {
+	return []SCIMResourceType{
+		{
+			Schemas:     []string{scimResourceTypeSchema},
+			ID:          "User",
+			Name:        "User",
+			Endpoint:    "/Users",
+			Description: "User account",
+			Schema:      services.SCIMUserSchema,
+			Meta:        SCIMDiscoveryMeta{ResourceType: "ResourceType", Location: h.SCIMService.BaseURL() + "/ResourceTypes/User"},
+		},
+		{
+			Schemas:     []string{scimResourceTypeSchema},
+			ID:          "Group",
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: "Group of users",
+			Schema:      services.SCIMGroupSchema,
+			Meta:        SCIMDiscoveryMeta{ResourceType: "ResourceType", Location: h.SCIMService.BaseURL() + "/ResourceTypes/Group"},
+		},
+	}
+}
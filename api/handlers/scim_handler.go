@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// SCIMHandler handles the SCIM 2.0 provisioning endpoints tenants' identity providers call
+type SCIMHandler struct {
+	SCIMService *services.SCIMService
+	Logger      *utils.Logger
+}
+
+// NewSCIMHandler creates a new SCIM handler
+func NewSCIMHandler(scimService *services.SCIMService, logger *utils.Logger) *SCIMHandler {
+	return &SCIMHandler{
+		SCIMService: scimService,
+		Logger:      logger,
+	}
+}
+
+// ListUsers handles listing the tenant's users
+func (h *SCIMHandler) ListUsers(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	startIndex, count, err := scimPagination(c)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	list, err := h.SCIMService.ListUsers(ctx, middleware.GetSCIMTenant(c), c.QueryParam("filter"), startIndex, count)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, list, "")
+}
+
+// GetUser handles getting one of the tenant's users
+func (h *SCIMHandler) GetUser(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := h.SCIMService.GetUser(ctx, middleware.GetSCIMTenant(c), c.Param("id"))
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResourceResponse(c, http.StatusOK, user, user.Meta.Version)
+}
+
+// CreateUser handles provisioning a user
+func (h *SCIMHandler) CreateUser(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMUser
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	user, err := h.SCIMService.CreateUser(ctx, middleware.GetSCIMTenant(c), &req)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, user.Meta.Location)
+	return scimResponse(c, http.StatusCreated, user, user.Meta.Version)
+}
+
+// ReplaceUser handles replacing one of the tenant's users
+func (h *SCIMHandler) ReplaceUser(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMUser
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	user, err := h.SCIMService.ReplaceUser(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match"), &req)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, user, user.Meta.Version)
+}
+
+// PatchUser handles modifying one of the tenant's users
+func (h *SCIMHandler) PatchUser(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMPatchRequest
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	user, err := h.SCIMService.PatchUser(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match"), req.Operations)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, user, user.Meta.Version)
+}
+
+// DeleteUser handles deleting one of the tenant's users
+func (h *SCIMHandler) DeleteUser(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	if err := h.SCIMService.DeleteUser(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match")); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListGroups handles listing the tenant's groups
+func (h *SCIMHandler) ListGroups(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	startIndex, count, err := scimPagination(c)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	list, err := h.SCIMService.ListGroups(ctx, middleware.GetSCIMTenant(c), c.QueryParam("filter"), startIndex, count, includesMembers(c))
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, list, "")
+}
+
+// GetGroup handles getting one of the tenant's groups
+func (h *SCIMHandler) GetGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	group, err := h.SCIMService.GetGroup(ctx, middleware.GetSCIMTenant(c), c.Param("id"), includesMembers(c))
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResourceResponse(c, http.StatusOK, group, group.Meta.Version)
+}
+
+// CreateGroup handles creating a group
+func (h *SCIMHandler) CreateGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMGroup
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	group, err := h.SCIMService.CreateGroup(ctx, middleware.GetSCIMTenant(c), &req)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, group.Meta.Location)
+	return scimResponse(c, http.StatusCreated, group, group.Meta.Version)
+}
+
+// ReplaceGroup handles replacing one of the tenant's groups
+func (h *SCIMHandler) ReplaceGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMGroup
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	group, err := h.SCIMService.ReplaceGroup(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match"), &req)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, group, group.Meta.Version)
+}
+
+// PatchGroup handles modifying one of the tenant's groups
+func (h *SCIMHandler) PatchGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req services.SCIMPatchRequest
+	if err := decodeSCIM(c, &req); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+
+	group, err := h.SCIMService.PatchGroup(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match"), req.Operations)
+	if err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return scimResponse(c, http.StatusOK, group, group.Meta.Version)
+}
+
+// DeleteGroup handles deleting one of the tenant's groups
+func (h *SCIMHandler) DeleteGroup(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	if err := h.SCIMService.DeleteGroup(ctx, middleware.GetSCIMTenant(c), c.Param("id"), c.Request().Header.Get("If-Match")); err != nil {
+		return h.errorResponse(c, log, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// errorResponse writes a SCIM error, hiding the details of internal errors
+func (h *SCIMHandler) errorResponse(c echo.Context, log *logrus.Entry, err error) error {
+	var scimErr *services.SCIMError
+	if errors.As(err, &scimErr) {
+		log.WithError(err).WithField("tenant", middleware.GetSCIMTenant(c)).Warn("SCIM request rejected")
+		return middleware.SCIMErrorResponse(c, scimErr)
+	}
+
+	log.WithError(err).WithField("tenant", middleware.GetSCIMTenant(c)).Error("SCIM request failed")
+	return middleware.SCIMErrorResponse(c, &services.SCIMError{Status: http.StatusInternalServerError, Detail: "internal error"})
+}
+
+// scimResponse writes a SCIM resource with its ETag
+func scimResponse(c echo.Context, status int, body interface{}, version string) error {
+	if version != "" {
+		c.Response().Header().Set("ETag", version)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, middleware.SCIMContentType, data)
+}
+
+// scimResourceResponse writes a resource, or Not Modified if the client's copy is current
+func scimResourceResponse(c echo.Context, status int, body interface{}, version string) error {
+	for _, match := range strings.Split(c.Request().Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(match) == version {
+			c.Response().Header().Set("ETag", version)
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+	return scimResponse(c, status, body, version)
+}
+
+// decodeSCIM decodes a request body. SCIM clients send application/scim+json,
+// which echo's Bind does not accept.
+func decodeSCIM(c echo.Context, v interface{}) error {
+	if err := json.NewDecoder(c.Request().Body).Decode(v); err != nil {
+		return &services.SCIMError{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: "invalid JSON body: " + err.Error()}
+	}
+	return nil
+}
+
+// scimPagination reads the startIndex and count query parameters
+func scimPagination(c echo.Context) (int, int, error) {
+	startIndex, count := 1, services.SCIMDefaultPageSize
+	for name, target := range map[string]*int{"startIndex": &startIndex, "count": &count} {
+		value := c.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, &services.SCIMError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: name + " must be an integer"}
+		}
+		*target = n
+	}
+	return startIndex, count, nil
+}
+
+// includesMembers reports whether the request did not exclude group members
+func includesMembers(c echo.Context) bool {
+	for _, attribute := range strings.Split(c.QueryParam("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterRoutes registers the SCIM routes. The discovery endpoints are public.
+func (h *SCIMHandler) RegisterRoutes(e *echo.Echo, scimMiddleware echo.MiddlewareFunc) {
+	e.GET("/scim/v2/ServiceProviderConfig", h.ServiceProviderConfig)
+	e.GET("/scim/v2/Schemas", h.Schemas)
+	e.GET("/scim/v2/Schemas/:id", h.Schema)
+	e.GET("/scim/v2/ResourceTypes", h.ResourceTypes)
+	e.GET("/scim/v2/ResourceTypes/:id", h.ResourceType)
+
+	scimGroup := e.Group("/scim/v2")
+	scimGroup.Use(scimMiddleware)
+
+	scimGroup.GET("/Users", h.ListUsers)
+	scimGroup.POST("/Users", h.CreateUser)
+	scimGroup.GET("/Users/:id", h.GetUser)
+	scimGroup.PUT("/Users/:id", h.ReplaceUser)
+	scimGroup.PATCH("/Users/:id", h.PatchUser)
+	scimGroup.DELETE("/Users/:id", h.DeleteUser)
+
+	scimGroup.GET("/Groups", h.ListGroups)
+	scimGroup.POST("/Groups", h.CreateGroup)
+	scimGroup.GET("/Groups/:id", h.GetGroup)
+	scimGroup.PUT("/Groups/:id", h.ReplaceGroup)
+	scimGroup.PATCH("/Groups/:id", h.PatchGroup)
+	scimGroup.DELETE("/Groups/:id", h.DeleteGroup)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// SCIMTokenHandler handles HTTP requests for administering tenants' SCIM tokens
+type SCIMTokenHandler struct {
+	TokenService *services.SCIMTokenService
+	Logger       *utils.Logger
+}
+
+// NewSCIMTokenHandler creates a new SCIM token handler
+func NewSCIMTokenHandler(tokenService *services.SCIMTokenService, logger *utils.Logger) *SCIMTokenHandler {
+	return &SCIMTokenHandler{
+		TokenService: tokenService,
+		Logger:       logger,
+	}
+}
+
+// CreateSCIMTokenRequest represents a SCIM token creation request
+type CreateSCIMTokenRequest struct {
+	Tenant string `json:"tenant" validate:"required"`
+	Name   string `json:"name" validate:"required"`
+}
+
+// createdSCIMToken is the creation response, the only one that includes the token itself
+type createdSCIMToken struct {
+	*models.SCIMToken
+	Token string `json:"token"`
+}
+
+// CreateToken handles issuing a SCIM token to a tenant
+func (h *SCIMTokenHandler) CreateToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req CreateSCIMTokenRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	token, plaintext, err := h.TokenService.CreateToken(ctx, req.Tenant, req.Name)
+	if err != nil {
+		log.WithError(err).Warn("Failed to create SCIM token")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to create SCIM token", errorDetails(err))
+	}
+
+	// The plaintext token is only ever returned here
+	return utils.SuccessResponse(c, createdSCIMToken{SCIMToken: token, Token: plaintext}, "SCIM token created successfully")
+}
+
+// ListTokens handles listing SCIM tokens, optionally of one tenant
+func (h *SCIMTokenHandler) ListTokens(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	tokens, err := h.TokenService.ListTokens(ctx, c.QueryParam("tenant"))
+	if err != nil {
+		log.WithError(err).Error("Failed to list SCIM tokens")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list SCIM tokens", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, tokens, "SCIM tokens retrieved successfully")
+}
+
+// DeleteToken handles revoking a SCIM token
+func (h *SCIMTokenHandler) DeleteToken(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid SCIM token ID")
+		return utils.ValidationErrorResponse(c, "Invalid SCIM token ID", []string{err.Error()})
+	}
+
+	err = h.TokenService.DeleteToken(ctx, tokenID.String())
+	if errors.Is(err, repositories.ErrSCIMTokenNotFound) {
+		return utils.NotFoundErrorResponse(c, "SCIM token not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to delete SCIM token")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete SCIM token", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, nil, "SCIM token deleted successfully")
+}
+
+// RegisterRoutes registers the SCIM token administration routes
+func (h *SCIMTokenHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	adminGroup := e.Group("/api/admin/scim-tokens")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.POST("", h.CreateToken)
+	adminGroup.GET("", h.ListTokens)
+	adminGroup.DELETE("/:id", h.DeleteToken)
+}
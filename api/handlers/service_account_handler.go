@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// ServiceAccountHandler handles HTTP requests for service account administration
+type ServiceAccountHandler struct {
+	ServiceAccountService *services.ServiceAccountService
+	Logger                *utils.Logger
+}
+
+// NewServiceAccountHandler creates a new service account handler
+func NewServiceAccountHandler(serviceAccountService *services.ServiceAccountService, logger *utils.Logger) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		ServiceAccountService: serviceAccountService,
+		Logger:                logger,
+	}
+}
+
+// CreateServiceAccountRequest represents a service account creation request
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+}
+
+// UpdateServiceAccountRequest represents a service account update request
+type UpdateServiceAccountRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Scopes      []string `json:"scopes"`
+	Disabled    *bool    `json:"disabled"`
+}
+
+// RotateSecretRequest represents a client secret rotation request
+type RotateSecretRequest struct {
+	GracePeriodMinutes int `json:"grace_period_minutes"`
+}
+
+// createdServiceAccount is the creation response, the only one that includes the first secret
+type createdServiceAccount struct {
+	*models.ServiceAccount
+	ClientSecret string `json:"client_secret"`
+}
+
+// rotatedSecret is the rotation response, the only one that includes the new secret
+type rotatedSecret struct {
+	*models.ServiceAccountSecret
+	ClientSecret string `json:"client_secret"`
+}
+
+// CreateAccount handles creating a service account
+func (h *ServiceAccountHandler) CreateAccount(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req CreateServiceAccountRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	account, secret, err := h.ServiceAccountService.CreateAccount(ctx, req.Name, req.Description, req.Scopes)
+	if err != nil {
+		return serviceAccountErrorResponse(c, "Failed to create service account", err)
+	}
+
+	// The plaintext secret is only ever returned here and on rotation
+	return utils.SuccessResponse(c, createdServiceAccount{ServiceAccount: account, ClientSecret: secret}, "Service account created successfully")
+}
+
+// ListAccounts handles listing service accounts
+func (h *ServiceAccountHandler) ListAccounts(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	accounts, err := h.ServiceAccountService.ListAccounts(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to list service accounts")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list service accounts", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, accounts, "Service accounts retrieved successfully")
+}
+
+// GetAccount handles getting a service account
+func (h *ServiceAccountHandler) GetAccount(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	account, err := h.ServiceAccountService.GetAccount(ctx, clientID.String())
+	if err != nil {
+		return serviceAccountErrorResponse(c, "Failed to get service account", err)
+	}
+
+	return utils.SuccessResponse(c, account, "Service account retrieved successfully")
+}
+
+// UpdateAccount handles updating a service account
+func (h *ServiceAccountHandler) UpdateAccount(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	var req UpdateServiceAccountRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	account, err := h.ServiceAccountService.UpdateAccount(ctx, clientID.String(), services.ServiceAccountUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		Scopes:      req.Scopes,
+		Disabled:    req.Disabled,
+	})
+	if err != nil {
+		return serviceAccountErrorResponse(c, "Failed to update service account", err)
+	}
+
+	return utils.SuccessResponse(c, account, "Service account updated successfully")
+}
+
+// DeleteAccount handles deleting a service account
+func (h *ServiceAccountHandler) DeleteAccount(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	if err := h.ServiceAccountService.DeleteAccount(ctx, clientID.String()); err != nil {
+		return serviceAccountErrorResponse(c, "Failed to delete service account", err)
+	}
+
+	return utils.SuccessResponse(c, nil, "Service account deleted successfully")
+}
+
+// ListSecrets handles listing a service account's client secrets
+func (h *ServiceAccountHandler) ListSecrets(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	secrets, err := h.ServiceAccountService.ListSecrets(ctx, clientID.String())
+	if err != nil {
+		return serviceAccountErrorResponse(c, "Failed to list client secrets", err)
+	}
+
+	return utils.SuccessResponse(c, secrets, "Client secrets retrieved successfully")
+}
+
+// RotateSecret handles issuing a new client secret
+func (h *ServiceAccountHandler) RotateSecret(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid client ID")
+		return utils.ValidationErrorResponse(c, "Invalid client ID", []string{err.Error()})
+	}
+
+	var req RotateSecretRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	grace := time.Duration(req.GracePeriodMinutes) * time.Minute
+	secret, plaintext, err := h.ServiceAccountService.RotateSecret(ctx, clientID.String(), grace)
+	if err != nil {
+		return serviceAccountErrorResponse(c, "Failed to rotate client secret", err)
+	}
+
+	return utils.SuccessResponse(c, rotatedSecret{ServiceAccountSecret: secret, ClientSecret: plaintext}, "Client secret rotated successfully")
+}
+
+// serviceAccountErrorResponse maps service account errors to responses
+func serviceAccountErrorResponse(c echo.Context, message string, err error) error {
+	if errors.Is(err, repositories.ErrServiceAccountNotFound) {
+		return utils.NotFoundErrorResponse(c, "Service account not found")
+	}
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return utils.ValidationErrorResponse(c, message, validationErr.Violations)
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, message, []string{err.Error()})
+}
+
+// RegisterRoutes registers the service account administration routes
+func (h *ServiceAccountHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	adminGroup := e.Group("/api/admin/service-accounts")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.POST("", h.CreateAccount)
+	adminGroup.GET("", h.ListAccounts)
+	adminGroup.GET("/:id", h.GetAccount)
+	adminGroup.PATCH("/:id", h.UpdateAccount)
+	adminGroup.DELETE("/:id", h.DeleteAccount)
+	adminGroup.GET("/:id/secrets", h.ListSecrets)
+	adminGroup.POST("/:id/secrets", h.RotateSecret)
+}
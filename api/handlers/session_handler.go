@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// SessionHandler handles HTTP requests for the current user's sessions
+type SessionHandler struct {
+	SessionService *services.SessionService
+	Logger         *utils.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *services.SessionService, logger *utils.Logger) *SessionHandler {
+	return &SessionHandler{
+		SessionService: sessionService,
+		Logger:         logger,
+	}
+}
+
+// ListSessions handles listing the current user's active sessions
+func (h *SessionHandler) ListSessions(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	sessions, err := h.SessionService.ListSessions(ctx, userID, middleware.GetSessionID(c))
+	if err != nil {
+		log.WithError(err).Error("Failed to list sessions")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list sessions", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, sessions, "Sessions retrieved successfully")
+}
+
+// RevokeSession handles revoking one of the current user's sessions
+func (h *SessionHandler) RevokeSession(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid session ID")
+		return utils.ValidationErrorResponse(c, "Invalid session ID", []string{err.Error()})
+	}
+
+	if err := h.SessionService.RevokeSession(ctx, userID, sessionID.String()); err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			return utils.NotFoundErrorResponse(c, "Session not found")
+		}
+		log.WithError(err).Error("Failed to revoke session")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke session", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, nil, "Session revoked successfully")
+}
+
+// RegisterRoutes registers the session routes
+func (h *SessionHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+	sessionGroup := e.Group("/api/users/me/sessions")
+	sessionGroup.Use(jwtMiddleware)
+
+	sessionGroup.GET("", h.ListSessions)
+	sessionGroup.DELETE("/:id", h.RevokeSession)
+}
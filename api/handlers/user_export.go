@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// exportFlushInterval is the number of rows written between response flushes
+const exportFlushInterval = 100
+
+// exportColumns maps exportable column names to their value accessors.
+// The password hash is intentionally never exportable.
+var exportColumns = map[string]func(*models.User) interface{}{
+	"id":         func(u *models.User) interface{} { return u.PublicID },
+	"name":       func(u *models.User) interface{} { return u.Name },
+	"email":      func(u *models.User) interface{} { return u.Email },
+	"role":       func(u *models.User) interface{} { return u.Role },
+	"status":     func(u *models.User) interface{} { return u.Status },
+	"created_at": func(u *models.User) interface{} { return u.CreatedAt },
+	"updated_at": func(u *models.User) interface{} { return u.UpdatedAt },
+	"attributes": func(u *models.User) interface{} { return u.Attributes },
+}
+
+// defaultExportColumns is the column order used when none are requested
+var defaultExportColumns = []string{"id", "name", "email", "role", "status", "created_at", "updated_at"}
+
+// userExportWriter encodes a stream of users in a specific format
+type userExportWriter interface {
+	Begin() error
+	Write(user *models.User) error
+	End() error
+}
+
+// ExportUsers streams all users matching the list filters as CSV, NDJSON or JSON
+func (h *UserHandler) ExportUsers(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid export filter")
+		return utils.ValidationErrorResponse(c, "Invalid filter", []string{err.Error()})
+	}
+
+	// Exports are admin-only, so private attributes may be filtered and exported
+	if err := h.UserService.ValidateAttributeFilter(filter, true); err != nil {
+		log.WithError(err).Warn("Invalid attribute filter")
+		return utils.ValidationErrorResponse(c, "Invalid filter", errorDetails(err))
+	}
+
+	columns, err := parseExportColumns(c.QueryParam("columns"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid export columns")
+		return utils.ValidationErrorResponse(c, "Invalid columns", []string{err.Error()})
+	}
+
+	format := strings.ToLower(c.QueryParam("format"))
+	if format == "" {
+		format = "csv"
+	}
+
+	res := c.Response()
+	var writer userExportWriter
+	switch format {
+	case "csv":
+		writer = &csvExportWriter{w: csv.NewWriter(res), columns: columns}
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	case "ndjson":
+		writer = &jsonExportWriter{w: res, columns: columns, newlineDelimited: true}
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	case "json":
+		writer = &jsonExportWriter{w: res, columns: columns}
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	default:
+		log.WithField("format", format).Warn("Unsupported export format")
+		return utils.ValidationErrorResponse(c, "Unsupported export format", []string{"format must be one of csv, ndjson, json"})
+	}
+
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	res.WriteHeader(http.StatusOK)
+
+	if err := writer.Begin(); err != nil {
+		log.WithError(err).Error("Failed to start user export")
+		return nil
+	}
+
+	var rows int
+	err = h.UserService.ExportUsers(ctx, filter, func(user *models.User) error {
+		if err := writer.Write(user); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushInterval == 0 {
+			res.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent, so the truncated body is all we can signal
+		log.WithError(err).WithField("rows", rows).Error("User export aborted")
+		return nil
+	}
+
+	if err := writer.End(); err != nil {
+		log.WithError(err).Error("Failed to finish user export")
+		return nil
+	}
+	res.Flush()
+
+	log.WithField("rows", rows).Info("User export completed")
+	return nil
+}
+
+// parseExportColumns validates a comma-separated column list
+func parseExportColumns(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return defaultExportColumns, nil
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, col := range strings.Split(param, ",") {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if col == "" || seen[col] {
+			continue
+		}
+		if _, ok := exportColumns[col]; !ok {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		seen[col] = true
+		columns = append(columns, col)
+	}
+
+	if len(columns) == 0 {
+		return defaultExportColumns, nil
+	}
+	return columns, nil
+}
+
+// csvExportWriter writes users as CSV rows with a header line
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (cw *csvExportWriter) Begin() error {
+	return cw.w.Write(cw.columns)
+}
+
+func (cw *csvExportWriter) Write(user *models.User) error {
+	record := make([]string, len(cw.columns))
+	for i, col := range cw.columns {
+		record[i] = formatCSVValue(exportColumns[col](user))
+	}
+	if err := cw.w.Write(record); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvExportWriter) End() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// formatCSVValue converts a column value to its CSV representation. Text
+// that spreadsheets would evaluate as a formula is prefixed with a quote.
+func formatCSVValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if val != "" && strings.ContainsRune("=+-@\t\r", rune(val[0])) {
+			return "'" + val
+		}
+		return val
+	case uint:
+		return strconv.FormatUint(uint64(val), 10)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case models.Attributes:
+		b, _ := json.Marshal(val)
+		return string(b)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// jsonExportWriter writes users either as a JSON array or as newline-delimited JSON
+type jsonExportWriter struct {
+	w                io.Writer
+	columns          []string
+	newlineDelimited bool
+	count            int
+}
+
+func (jw *jsonExportWriter) Begin() error {
+	if jw.newlineDelimited {
+		return nil
+	}
+	_, err := io.WriteString(jw.w, "[")
+	return err
+}
+
+func (jw *jsonExportWriter) Write(user *models.User) error {
+	obj, err := jw.encode(user)
+	if err != nil {
+		return err
+	}
+
+	if jw.newlineDelimited {
+		obj = append(obj, '\n')
+	} else if jw.count > 0 {
+		obj = append([]byte{','}, obj...)
+	}
+	jw.count++
+
+	_, err = jw.w.Write(obj)
+	return err
+}
+
+func (jw *jsonExportWriter) End() error {
+	if jw.newlineDelimited {
+		return nil
+	}
+	_, err := io.WriteString(jw.w, "]\n")
+	return err
+}
+
+// encode builds a JSON object that preserves the requested column order
+func (jw *jsonExportWriter) encode(user *models.User) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, col := range jw.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		val, err := json.Marshal(exportColumns[col](user))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
 	"github.com/user/user-management-service/internal/services"
 	"github.com/user/user-management-service/utils"
 )
@@ -26,9 +33,10 @@ func NewUserHandler(userService *services.UserService, logger *utils.Logger) *Us
 
 // RegisterRequest represents a user registration request
 type RegisterRequest struct {
-	Name     string `json:"name" validate:"required"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Name       string            `json:"name" validate:"required"`
+	Email      string            `json:"email" validate:"required,email"`
+	Password   string            `json:"password" validate:"required,min=6"`
+	Attributes models.Attributes `json:"attributes"`
 }
 
 // LoginRequest represents a user login request
@@ -39,9 +47,27 @@ type LoginRequest struct {
 
 // UpdateUserRequest represents a user update request
 type UpdateUserRequest struct {
-	Name     string `json:"name"`
-	Email    string `json:"email" validate:"omitempty,email"`
-	Password string `json:"password" validate:"omitempty,min=6"`
+	Name       string            `json:"name"`
+	Email      string            `json:"email" validate:"omitempty,email"`
+	Attributes models.Attributes `json:"attributes"`
+}
+
+// ProfileResponse is the current user's profile. Impersonation is set while an
+// admin acts as the user, so clients can show that they are.
+type ProfileResponse struct {
+	*models.User
+	Impersonation *models.Impersonation `json:"impersonation,omitempty"`
+}
+
+// ReauthenticateRequest represents a signed-in user confirming their password
+type ReauthenticateRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// ChangePasswordRequest represents a password change request
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
 }
 
 // Register handles user registration
@@ -55,13 +81,13 @@ func (h *UserHandler) Register(c echo.Context) error {
 		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
 	}
 
-	user, err := h.UserService.RegisterUser(ctx, req.Name, req.Email, req.Password)
+	user, err := h.UserService.RegisterUser(ctx, req.Name, req.Email, req.Password, req.Attributes)
 	if err != nil {
 		log.WithError(err).Error("Failed to register user")
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to register user", []string{err.Error()})
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to register user", errorDetails(err))
 	}
 
-	return utils.SuccessResponse(c, user, "User registered successfully")
+	return utils.SuccessResponse(c, h.presentUser(user, true), "User registered successfully")
 }
 
 // Login handles user login
@@ -75,7 +101,25 @@ func (h *UserHandler) Login(c echo.Context) error {
 		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
 	}
 
-	token, err := h.UserService.Login(ctx, req.Email, req.Password)
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	token, err := h.UserService.Login(ctx, req.Email, req.Password, client)
+	if errors.Is(err, services.ErrPasswordExpired) {
+		log.Warn("Login with expired password")
+		return passwordExpiredResponse(c, token)
+	}
+	var secondFactorErr *services.SecondFactorRequiredError
+	if errors.As(err, &secondFactorErr) {
+		return secondFactorResponse(c, secondFactorErr)
+	}
+	var statusErr *services.AccountStatusError
+	if errors.As(err, &statusErr) {
+		log.WithError(err).Warn("Login rejected by account status")
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	}
 	if err != nil {
 		log.WithError(err).Warn("Login failed")
 		return utils.UnauthorizedErrorResponse(c, "Invalid credentials")
@@ -84,6 +128,34 @@ func (h *UserHandler) Login(c echo.Context) error {
 	return utils.SuccessResponse(c, map[string]string{"token": token}, "Login successful")
 }
 
+// secondFactorResponse answers a verified password with the second factor
+// challenge the user must still answer
+func secondFactorResponse(c echo.Context, err *services.SecondFactorRequiredError) error {
+	return c.JSON(http.StatusUnauthorized, utils.Response{
+		Status:    "error",
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		Message:   "Second factor required",
+		Data: map[string]interface{}{
+			"second_factor_required": true,
+			"webauthn":               err.Challenge,
+		},
+	})
+}
+
+// passwordExpiredResponse answers a login with an expired password with the
+// token that only allows changing it
+func passwordExpiredResponse(c echo.Context, token string) error {
+	return c.JSON(http.StatusForbidden, utils.Response{
+		Status:    "error",
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		Message:   "Password change required",
+		Data: map[string]interface{}{
+			"token":                    token,
+			"password_change_required": true,
+		},
+	})
+}
+
 // GetProfile handles get user profile
 func (h *UserHandler) GetProfile(c echo.Context) error {
 	ctx := utils.NewRequestContext()
@@ -102,7 +174,8 @@ func (h *UserHandler) GetProfile(c echo.Context) error {
 		return utils.NotFoundErrorResponse(c, "User not found")
 	}
 
-	return utils.SuccessResponse(c, user, "User profile retrieved successfully")
+	profile := ProfileResponse{User: h.presentUser(user, true), Impersonation: middleware.GetImpersonation(c)}
+	return utils.SuccessResponse(c, profile, "User profile retrieved successfully")
 }
 
 // GetUserByID handles get user by ID
@@ -110,21 +183,24 @@ func (h *UserHandler) GetUserByID(c echo.Context) error {
 	ctx := utils.NewRequestContext()
 	log := h.Logger.WithContext(ctx)
 
-	// Parse user ID from path parameter
-	idParam := c.Param("id")
-	id, err := strconv.ParseUint(idParam, 10, 32)
+	// Parse public user ID from path parameter
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		log.WithError(err).Warn("Invalid user ID")
 		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
 	}
 
-	user, err := h.UserService.GetUserByID(ctx, uint(id))
+	user, err := h.UserService.GetUserByPublicID(ctx, id.String())
 	if err != nil {
 		log.WithError(err).Error("Failed to get user")
 		return utils.NotFoundErrorResponse(c, "User not found")
 	}
 
-	return utils.SuccessResponse(c, user, "User retrieved successfully")
+	// Private attributes are only shown to the user themselves and admins
+	requesterID, _ := middleware.GetUserID(c)
+	includePrivate := requesterID == user.ID || middleware.IsAdmin(c)
+
+	return utils.SuccessResponse(c, h.presentUser(user, includePrivate), "User retrieved successfully")
 }
 
 // UpdateUser handles update user
@@ -132,6 +208,41 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 	ctx := utils.NewRequestContext()
 	log := h.Logger.WithContext(ctx)
 
+	// Get user from context (set by JWT middleware)
+	current, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req UpdateUserRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	// The email is where sign-in links and password resets go, so changing it
+	// requires a recent authentication
+	maxAge := time.Duration(h.UserService.Config.StepUp.MaxAge) * time.Minute
+	if email := strings.TrimSpace(req.Email); email != "" && email != current.Email && !middleware.HasRecentAuthentication(c, maxAge) {
+		log.WithField("user_id", current.ID).Warn("Email change without recent authentication")
+		return middleware.ReauthenticationRequiredResponse(c)
+	}
+
+	user, err := h.UserService.UpdateUser(ctx, current.ID, req.Name, req.Email, req.Attributes)
+	if err != nil {
+		log.WithError(err).Error("Failed to update user")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to update user", errorDetails(err))
+	}
+
+	return utils.SuccessResponse(c, h.presentUser(user, true), "User updated successfully")
+}
+
+// ChangePassword handles changing the current user's password
+func (h *UserHandler) ChangePassword(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
 	// Get user ID from context (set by JWT middleware)
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
@@ -139,19 +250,62 @@ func (h *UserHandler) UpdateUser(c echo.Context) error {
 		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
 	}
 
-	var req UpdateUserRequest
+	var req ChangePasswordRequest
 	if err := c.Bind(&req); err != nil {
 		log.WithError(err).Warn("Invalid request payload")
 		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
 	}
 
-	user, err := h.UserService.UpdateUser(ctx, userID, req.Name, req.Email, req.Password)
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{"current_password and new_password are required"})
+	}
+
+	token, err := h.UserService.ChangePassword(ctx, userID, middleware.GetSessionID(c), req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, services.ErrInvalidCurrentPassword) {
+		return utils.UnauthorizedErrorResponse(c, "Current password is incorrect")
+	}
 	if err != nil {
-		log.WithError(err).Error("Failed to update user")
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to update user", []string{err.Error()})
+		log.WithError(err).Error("Failed to change password")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to change password", errorDetails(err))
+	}
+
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Password changed successfully")
+}
+
+// Reauthenticate handles a signed-in user confirming their password before a
+// sensitive operation
+func (h *UserHandler) Reauthenticate(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
 	}
 
-	return utils.SuccessResponse(c, user, "User updated successfully")
+	var req ReauthenticateRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+	if req.Password == "" {
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{"password is required"})
+	}
+
+	token, err := h.UserService.Reauthenticate(ctx, user, middleware.GetSessionID(c), req.Password)
+	var secondFactorErr *services.SecondFactorRequiredError
+	switch {
+	case errors.As(err, &secondFactorErr):
+		return secondFactorResponse(c, secondFactorErr)
+	case errors.Is(err, services.ErrInvalidCurrentPassword):
+		return utils.UnauthorizedErrorResponse(c, "Password is incorrect")
+	case err != nil:
+		log.WithError(err).Error("Failed to re-authenticate user")
+		return utils.InternalServerErrorResponse(c, "Failed to re-authenticate")
+	}
+
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Re-authentication successful")
 }
 
 // DeleteUser handles delete user
@@ -191,7 +345,19 @@ func (h *UserHandler) ListUsers(c echo.Context) error {
 		perPage = 10
 	}
 
-	users, total, err := h.UserService.ListUsers(ctx, page, perPage)
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		log.WithError(err).Warn("Invalid list filter")
+		return utils.ValidationErrorResponse(c, "Invalid filter", []string{err.Error()})
+	}
+
+	isAdmin := middleware.IsAdmin(c)
+	if err := h.UserService.ValidateAttributeFilter(filter, isAdmin); err != nil {
+		log.WithError(err).Warn("Invalid attribute filter")
+		return utils.ValidationErrorResponse(c, "Invalid filter", errorDetails(err))
+	}
+
+	users, total, err := h.UserService.ListUsers(ctx, filter, page, perPage)
 	if err != nil {
 		log.WithError(err).Error("Failed to list users")
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list users", []string{err.Error()})
@@ -213,7 +379,7 @@ func (h *UserHandler) ListUsers(c echo.Context) error {
 		Status:     "success",
 		RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
 		Message:    "Users retrieved successfully",
-		Data:       users,
+		Data:       h.presentUsers(users, isAdmin),
 		PageInfo:   pageInfo,
 		TotalCount: total,
 	}
@@ -221,19 +387,106 @@ func (h *UserHandler) ListUsers(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// RegisterRoutes registers the user routes
-func (h *UserHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+// presentUser filters the user's attributes by visibility before it is returned
+func (h *UserHandler) presentUser(user *models.User, includePrivate bool) *models.User {
+	user.Attributes = h.UserService.AttributeSchema.Visible(user.Attributes, includePrivate)
+	return user
+}
+
+// presentUsers filters attributes by visibility for each user in a list
+func (h *UserHandler) presentUsers(users []models.User, includePrivate bool) []models.User {
+	for i := range users {
+		h.presentUser(&users[i], includePrivate)
+	}
+	return users
+}
+
+// errorDetails expands an error into the Errors array of a response,
+// listing each validation or password policy violation separately
+func errorDetails(err error) []string {
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Violations
+	}
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Violations
+	}
+	return []string{err.Error()}
+}
+
+// parseUserFilter builds a user filter from the list query parameters
+func parseUserFilter(c echo.Context) (repositories.UserFilter, error) {
+	filter := repositories.UserFilter{
+		Search: c.QueryParam("search"),
+		Role:   c.QueryParam("role"),
+		Status: c.QueryParam("status"),
+	}
+
+	if filter.Role != "" && filter.Role != models.RoleUser && filter.Role != models.RoleAdmin {
+		return filter, fmt.Errorf("invalid role %q", filter.Role)
+	}
+
+	if filter.Status != "" && !models.IsValidStatus(filter.Status) {
+		return filter, fmt.Errorf("invalid status %q", filter.Status)
+	}
+
+	if v := c.QueryParam("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid created_after: %w", err)
+		}
+		filter.CreatedAfter = &t
+	}
+
+	if v := c.QueryParam("created_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid created_before: %w", err)
+		}
+		filter.CreatedBefore = &t
+	}
+
+	// Members of the group's subgroups are included
+	if v := c.QueryParam("group"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid group: %w", err)
+		}
+		filter.Group = id.String()
+	}
+
+	// Custom attributes are filtered with attr.<name>=<value>
+	for key, values := range c.QueryParams() {
+		if name := strings.TrimPrefix(key, "attr."); name != key && name != "" && len(values) > 0 {
+			if filter.Attributes == nil {
+				filter.Attributes = make(map[string]string)
+			}
+			filter.Attributes[name] = values[0]
+		}
+	}
+
+	return filter, nil
+}
+
+// RegisterRoutes registers the user routes. Deleting the account and
+// changing its email require a recent authentication.
+func (h *UserHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware, stepUpMiddleware echo.MiddlewareFunc) {
 	// Public routes
 	e.POST("/api/register", h.Register)
 	e.POST("/api/login", h.Login)
 
+	e.POST("/api/reauthenticate", h.Reauthenticate, jwtMiddleware)
+
 	// Protected routes
 	userGroup := e.Group("/api/users")
 	userGroup.Use(jwtMiddleware)
 
 	userGroup.GET("", h.ListUsers)
 	userGroup.GET("/profile", h.GetProfile)
+	userGroup.GET("/export", h.ExportUsers, adminMiddleware)
 	userGroup.GET("/:id", h.GetUserByID)
 	userGroup.PUT("", h.UpdateUser)
-	userGroup.DELETE("", h.DeleteUser)
+	userGroup.POST("/me/password", h.ChangePassword)
+	userGroup.DELETE("", h.DeleteUser, stepUpMiddleware)
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// UserStatusHandler handles HTTP requests for account status administration
+type UserStatusHandler struct {
+	StatusService *services.UserStatusService
+	Logger        *utils.Logger
+}
+
+// NewUserStatusHandler creates a new user status handler
+func NewUserStatusHandler(statusService *services.UserStatusService, logger *utils.Logger) *UserStatusHandler {
+	return &UserStatusHandler{
+		StatusService: statusService,
+		Logger:        logger,
+	}
+}
+
+// SuspendRequest represents a user suspension request
+type SuspendRequest struct {
+	Reason string     `json:"reason" validate:"required"`
+	Until  *time.Time `json:"until"`
+}
+
+// ReactivateRequest represents a user reactivation request
+type ReactivateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Suspend handles suspending a user
+func (h *UserStatusHandler) Suspend(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid user ID")
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	var req SuspendRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	if req.Reason == "" {
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{"reason is required"})
+	}
+
+	user, err := h.StatusService.Suspend(ctx, actor, targetID.String(), req.Reason, req.Until)
+	if err != nil {
+		log.WithError(err).Error("Failed to suspend user")
+		return statusChangeErrorResponse(c, "Failed to suspend user", err)
+	}
+
+	return utils.SuccessResponse(c, user, "User suspended successfully")
+}
+
+// Reactivate handles reactivating a user
+func (h *UserStatusHandler) Reactivate(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	actor, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid user ID")
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	var req ReactivateRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	user, err := h.StatusService.Reactivate(ctx, actor, targetID.String(), req.Reason)
+	if err != nil {
+		log.WithError(err).Error("Failed to reactivate user")
+		return statusChangeErrorResponse(c, "Failed to reactivate user", err)
+	}
+
+	return utils.SuccessResponse(c, user, "User reactivated successfully")
+}
+
+// History handles listing a user's status transitions
+func (h *UserStatusHandler) History(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid user ID")
+		return utils.ValidationErrorResponse(c, "Invalid user ID", []string{err.Error()})
+	}
+
+	transitions, err := h.StatusService.History(ctx, targetID.String())
+	if err != nil {
+		log.WithError(err).Error("Failed to get status history")
+		return utils.NotFoundErrorResponse(c, "User not found")
+	}
+
+	return utils.SuccessResponse(c, transitions, "Status history retrieved successfully")
+}
+
+// statusChangeErrorResponse maps status change errors to responses
+func statusChangeErrorResponse(c echo.Context, message string, err error) error {
+	if errors.Is(err, services.ErrInvalidStatusTransition) {
+		return utils.ErrorResponse(c, http.StatusConflict, message, []string{err.Error()})
+	}
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return utils.NotFoundErrorResponse(c, "User not found")
+	}
+	return utils.ErrorResponse(c, http.StatusBadRequest, message, []string{err.Error()})
+}
+
+// RegisterRoutes registers the user status routes
+func (h *UserStatusHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	adminGroup := e.Group("/api/admin/users")
+	adminGroup.Use(jwtMiddleware, adminMiddleware)
+
+	adminGroup.POST("/:id/suspend", h.Suspend)
+	adminGroup.POST("/:id/reactivate", h.Reactivate)
+	adminGroup.GET("/:id/status-history", h.History)
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/middleware"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// WebAuthnHandler handles HTTP requests for passkeys
+type WebAuthnHandler struct {
+	WebAuthnService *services.WebAuthnService
+	Logger          *utils.Logger
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler
+func NewWebAuthnHandler(webAuthnService *services.WebAuthnService, logger *utils.Logger) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		WebAuthnService: webAuthnService,
+		Logger:          logger,
+	}
+}
+
+// FinishRegistrationRequest represents the response to a registration ceremony
+type FinishRegistrationRequest struct {
+	CeremonyID string                        `json:"ceremony_id"`
+	Name       string                        `json:"name"`
+	Credential services.WebAuthnRegistration `json:"credential"`
+}
+
+// FinishPasskeyLoginRequest represents the response to a sign-in ceremony
+type FinishPasskeyLoginRequest struct {
+	CeremonyID string                     `json:"ceremony_id"`
+	Credential services.WebAuthnAssertion `json:"credential"`
+}
+
+// RenamePasskeyRequest represents a request to rename a passkey
+type RenamePasskeyRequest struct {
+	Name string `json:"name"`
+}
+
+// BeginRegistration handles starting the registration of a passkey
+func (h *WebAuthnHandler) BeginRegistration(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	ceremony, err := h.WebAuthnService.BeginRegistration(ctx, user)
+	if err != nil {
+		log.WithError(err).Error("Failed to begin passkey registration")
+		return utils.InternalServerErrorResponse(c, "Failed to begin passkey registration")
+	}
+
+	return utils.SuccessResponse(c, ceremony, "Passkey registration started")
+}
+
+// FinishRegistration handles verifying and storing a new passkey
+func (h *WebAuthnHandler) FinishRegistration(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req FinishRegistrationRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	credential, err := h.WebAuthnService.FinishRegistration(ctx, user, req.CeremonyID, req.Name, req.Credential)
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return utils.ValidationErrorResponse(c, validationErr.Message, validationErr.Violations)
+	case errors.Is(err, services.ErrWebAuthnVerification):
+		log.WithError(err).Warn("Passkey registration rejected")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Failed to register passkey", []string{err.Error()})
+	case errors.Is(err, services.ErrWebAuthnCredentialExists):
+		return utils.ErrorResponse(c, http.StatusConflict, "Failed to register passkey", []string{err.Error()})
+	case err != nil:
+		log.WithError(err).Error("Failed to register passkey")
+		return utils.InternalServerErrorResponse(c, "Failed to register passkey")
+	}
+
+	return utils.SuccessResponse(c, credential, "Passkey registered successfully")
+}
+
+// ListPasskeys handles listing the current user's passkeys
+func (h *WebAuthnHandler) ListPasskeys(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	credentials, err := h.WebAuthnService.ListCredentials(ctx, userID)
+	if err != nil {
+		log.WithError(err).Error("Failed to list passkeys")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list passkeys", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, credentials, "Passkeys retrieved successfully")
+}
+
+// RenamePasskey handles renaming one of the current user's passkeys
+func (h *WebAuthnHandler) RenamePasskey(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid passkey ID")
+		return utils.ValidationErrorResponse(c, "Invalid passkey ID", []string{err.Error()})
+	}
+
+	var req RenamePasskeyRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	credential, err := h.WebAuthnService.RenameCredential(ctx, userID, credentialID.String(), req.Name)
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return utils.ValidationErrorResponse(c, validationErr.Message, validationErr.Violations)
+	case errors.Is(err, repositories.ErrWebAuthnCredentialNotFound):
+		return utils.NotFoundErrorResponse(c, "Passkey not found")
+	case err != nil:
+		log.WithError(err).Error("Failed to rename passkey")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to rename passkey", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, credential, "Passkey renamed successfully")
+}
+
+// DeletePasskey handles deleting one of the current user's passkeys
+func (h *WebAuthnHandler) DeletePasskey(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user ID from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithError(err).Warn("Invalid passkey ID")
+		return utils.ValidationErrorResponse(c, "Invalid passkey ID", []string{err.Error()})
+	}
+
+	err = h.WebAuthnService.DeleteCredential(ctx, userID, credentialID.String())
+	if errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		return utils.NotFoundErrorResponse(c, "Passkey not found")
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to delete passkey")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete passkey", []string{err.Error()})
+	}
+
+	return utils.SuccessResponse(c, nil, "Passkey deleted successfully")
+}
+
+// BeginLogin handles starting a passwordless sign-in with a passkey
+func (h *WebAuthnHandler) BeginLogin(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	ceremony, err := h.WebAuthnService.BeginLogin(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to begin passkey sign-in")
+		return utils.InternalServerErrorResponse(c, "Failed to begin passkey sign-in")
+	}
+
+	return utils.SuccessResponse(c, ceremony, "Passkey sign-in started")
+}
+
+// FinishLogin handles signing in with a passkey, either without a password
+// or as the second factor of a password login
+func (h *WebAuthnHandler) FinishLogin(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	var req FinishPasskeyLoginRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	client := services.ClientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+
+	token, err := h.WebAuthnService.FinishLogin(ctx, req.CeremonyID, req.Credential, client)
+	if errors.Is(err, services.ErrPasswordExpired) {
+		log.Warn("Login with expired password")
+		return passwordExpiredResponse(c, token)
+	}
+	var statusErr *services.AccountStatusError
+	switch {
+	case errors.As(err, &statusErr):
+		log.WithError(err).Warn("Login rejected by account status")
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	case errors.Is(err, services.ErrWebAuthnVerification):
+		log.WithError(err).Warn("Passkey sign-in rejected")
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	case err != nil:
+		log.WithError(err).Error("Failed to sign in with passkey")
+		return utils.InternalServerErrorResponse(c, "Failed to sign in with passkey")
+	}
+
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Login successful")
+}
+
+// BeginReauthentication handles starting a signed-in user's re-authentication with a passkey
+func (h *WebAuthnHandler) BeginReauthentication(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	ceremony, err := h.WebAuthnService.BeginReauthentication(ctx, user)
+	if errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		return utils.ValidationErrorResponse(c, "No passkeys registered", []string{"register a passkey or re-authenticate with your password"})
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to begin passkey re-authentication")
+		return utils.InternalServerErrorResponse(c, "Failed to begin passkey re-authentication")
+	}
+
+	return utils.SuccessResponse(c, ceremony, "Passkey re-authentication started")
+}
+
+// FinishReauthentication handles a signed-in user's re-authentication with a
+// passkey, either alone or after their password
+func (h *WebAuthnHandler) FinishReauthentication(c echo.Context) error {
+	ctx := utils.NewRequestContext()
+	log := h.Logger.WithContext(ctx)
+
+	user, err := middleware.GetUser(c)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get user from context")
+		return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+	}
+
+	var req FinishPasskeyLoginRequest
+	if err := c.Bind(&req); err != nil {
+		log.WithError(err).Warn("Invalid request payload")
+		return utils.ValidationErrorResponse(c, "Invalid request payload", []string{err.Error()})
+	}
+
+	token, err := h.WebAuthnService.FinishReauthentication(ctx, user, middleware.GetSessionID(c), req.CeremonyID, req.Credential)
+	if errors.Is(err, services.ErrWebAuthnVerification) {
+		log.WithError(err).Warn("Passkey re-authentication rejected")
+		return utils.UnauthorizedErrorResponse(c, err.Error())
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to re-authenticate with passkey")
+		return utils.InternalServerErrorResponse(c, "Failed to re-authenticate")
+	}
+
+	return utils.SuccessResponse(c, map[string]string{"token": token}, "Re-authentication successful")
+}
+
+// RegisterRoutes registers the passkey routes
+func (h *WebAuthnHandler) RegisterRoutes(e *echo.Echo, jwtMiddleware echo.MiddlewareFunc) {
+	e.POST("/api/login/passkey/begin", h.BeginLogin)
+	e.POST("/api/login/passkey/finish", h.FinishLogin)
+	e.POST("/api/reauthenticate/passkey/begin", h.BeginReauthentication, jwtMiddleware)
+	e.POST("/api/reauthenticate/passkey/finish", h.FinishReauthentication, jwtMiddleware)
+
+	passkeyGroup := e.Group("/api/users/me/passkeys")
+	passkeyGroup.Use(jwtMiddleware)
+
+	passkeyGroup.GET("", h.ListPasskeys)
+	passkeyGroup.POST("/register/begin", h.BeginRegistration)
+	passkeyGroup.POST("/register/finish", h.FinishRegistration)
+	passkeyGroup.PATCH("/:id", h.RenamePasskey)
+	passkeyGroup.DELETE("/:id", h.DeletePasskey)
+}
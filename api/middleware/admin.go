@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// AdminMiddleware creates a middleware that only allows users with the admin role.
+// Service accounts are let through, since JWTMiddleware already limited them
+// to the routes their scopes grant. It must be registered after JWTMiddleware.
+func AdminMiddleware(userService *services.UserService, logger *utils.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := utils.NewRequestContext()
+
+			if GetServiceAccount(c) != nil {
+				return next(c)
+			}
+
+			userID, err := GetUserID(c)
+			if err != nil {
+				logger.WithField("path", c.Request().URL.Path).Warn("Missing user ID for admin route")
+				return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+			}
+
+			// Look up the user so role changes take effect immediately
+			user, err := userService.GetUserByID(ctx, userID)
+			if err != nil {
+				logger.WithContext(ctx).WithError(err).Warn("Failed to load user for admin check")
+				return utils.UnauthorizedErrorResponse(c, "Unauthorized")
+			}
+
+			if !user.IsAdmin() {
+				logger.WithContext(ctx).WithField("user_id", userID).Warn("Admin access denied")
+				return utils.ForbiddenErrorResponse(c, "Admin access required")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// ImpersonatedByHeader names the admin acting as the user in responses to impersonated requests
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+// impersonationBlockedRoutes are the routes an impersonation token may not
+// use: those that manage the user's credentials, sessions or authorized
+// applications, or delete the account
+var impersonationBlockedRoutes = map[string]bool{
+	http.MethodPost + " /api/users/me/password":                    true,
+	http.MethodDelete + " /api/users":                              true,
+	http.MethodPost + " /api/reauthenticate":                       true,
+	http.MethodPost + " /api/reauthenticate/passkey/begin":         true,
+	http.MethodPost + " /api/reauthenticate/passkey/finish":        true,
+	http.MethodPost + " /api/users/me/passkeys/register/begin":     true,
+	http.MethodPost + " /api/users/me/passkeys/register/finish":    true,
+	http.MethodPatch + " /api/users/me/passkeys/:id":               true,
+	http.MethodDelete + " /api/users/me/passkeys/:id":              true,
+	http.MethodPost + " /api/users/me/tokens":                      true,
+	http.MethodPatch + " /api/users/me/tokens/:id":                 true,
+	http.MethodDelete + " /api/users/me/tokens/:id":                true,
+	http.MethodPost + " /api/users/me/identities":                  true,
+	http.MethodDelete + " /api/users/me/identities/:id":            true,
+	http.MethodDelete + " /api/users/me/sessions/:id":              true,
+	http.MethodDelete + " /api/users/me/authorizations/:client_id": true,
+}
+
+// authenticateImpersonation authenticates a request an admin makes as another
+// user, and records it in the impersonation's audit trail whatever its outcome
+func authenticateImpersonation(c echo.Context, next echo.HandlerFunc, impersonationService *services.ImpersonationService, claims *utils.JWTClaims, user *models.User, logger *utils.Logger) error {
+	ctx := utils.NewRequestContext()
+	log := logger.WithContext(ctx).WithField("path", c.Request().URL.Path).WithField("actor_id", claims.Act.Subject)
+
+	impersonation, err := impersonationService.Authenticate(ctx, claims, user)
+	if err != nil {
+		log.WithError(err).Warn("Rejected impersonation token")
+		return utils.UnauthorizedErrorResponse(c, "Invalid token")
+	}
+
+	c.Response().Header().Set(ImpersonatedByHeader, impersonation.ActorID)
+	defer func() {
+		impersonationService.RecordEvent(ctx, impersonation, &models.ImpersonationEvent{
+			Method:    c.Request().Method,
+			Path:      c.Request().URL.Path,
+			Status:    responseStatus(c, err),
+			RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+			IPAddress: c.RealIP(),
+		})
+	}()
+
+	if impersonationBlockedRoutes[c.Request().Method+" "+c.Path()] {
+		log.Warn("Impersonation token used on a blocked route")
+		err = utils.ForbiddenErrorResponse(c, "This action is not allowed while impersonating a user")
+		return err
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("impersonation", impersonation)
+	err = next(c)
+	return err
+}
+
+// responseStatus returns the status a request was answered with, including
+// errors left for Echo's error handler to write
+func responseStatus(c echo.Context, err error) int {
+	var httpErr *echo.HTTPError
+	switch {
+	case c.Response().Committed || err == nil:
+		return c.Response().Status
+	case errors.As(err, &httpErr):
+		return httpErr.Code
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetImpersonation gets the impersonation the request was made in, nil unless an admin is acting as the user
+func GetImpersonation(c echo.Context) *models.Impersonation {
+	impersonation, _ := c.Get("impersonation").(*models.Impersonation)
+	return impersonation
+}
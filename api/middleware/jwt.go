@@ -1,16 +1,46 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
 	"github.com/user/user-management-service/utils"
 )
 
-// JWTMiddleware creates a middleware that validates JWT tokens
-func JWTMiddleware(config *config.Config, logger *utils.Logger) echo.MiddlewareFunc {
+// passwordChangeRoutes are the only routes a password-change scoped token may access
+var passwordChangeRoutes = map[string]bool{
+	http.MethodGet + " /api/users/profile":      true,
+	http.MethodPost + " /api/users/me/password": true,
+}
+
+// accessTokenRouteScopes maps the routes personal access tokens and OAuth access tokens may use
+// to the scope each requires. Routes that are not listed, such as token and session management,
+// require a login token.
+var accessTokenRouteScopes = map[string]string{
+	http.MethodGet + " /api/users/profile":                  models.ScopeProfileRead,
+	http.MethodPut + " /api/users":                          models.ScopeProfileWrite,
+	http.MethodGet + " /api/users":                          models.ScopeUsersRead,
+	http.MethodGet + " /api/users/:id":                      models.ScopeUsersRead,
+	http.MethodGet + " /api/users/export":                   models.ScopeUsersExport,
+	http.MethodPost + " /api/admin/users/:id/suspend":       models.ScopeAdminUsers,
+	http.MethodPost + " /api/admin/users/:id/reactivate":    models.ScopeAdminUsers,
+	http.MethodGet + " /api/admin/users/:id/status-history": models.ScopeAdminUsers,
+	http.MethodGet + " /oauth/userinfo":                     models.ScopeOpenID,
+	http.MethodPost + " /oauth/userinfo":                    models.ScopeOpenID,
+}
+
+// JWTMiddleware creates a middleware that authenticates requests with either
+// a JWT or a personal access token in the Authorization header. JWTs are
+// user login tokens, client credentials tokens of service accounts, or
+// access tokens OAuth clients hold on a user's behalf, or impersonation tokens
+// with which an admin acts as a user.
+// Session activity is recorded in memory and flushed by the session service.
+func JWTMiddleware(config *config.Config, userService *services.UserService, sessionService *services.SessionService, tokenService *services.PersonalAccessTokenService, serviceAccountService *services.ServiceAccountService, revocationService *services.TokenRevocationService, impersonationService *services.ImpersonationService, logger *utils.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Get the Authorization header
@@ -29,6 +59,10 @@ func JWTMiddleware(config *config.Config, logger *utils.Logger) echo.MiddlewareF
 
 			tokenString := tokenParts[1]
 
+			if services.IsPersonalAccessToken(tokenString) {
+				return authenticateAccessToken(c, next, tokenService, tokenString, logger)
+			}
+
 			// Validate the token
 			claims, err := utils.ValidateToken(tokenString, config.JWT.Secret)
 			if err != nil {
@@ -36,13 +70,135 @@ func JWTMiddleware(config *config.Config, logger *utils.Logger) echo.MiddlewareF
 				return utils.UnauthorizedErrorResponse(c, "Invalid token")
 			}
 
-			// Set the user ID in context
-			c.Set("user_id", claims.UserID)
+			// Client tokens may have been revoked individually before they expire
+			revoked, err := revocationService.IsRevoked(utils.NewRequestContext(), claims)
+			if err != nil {
+				logger.WithError(err).Error("Failed to check token revocation")
+				return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to authenticate token", []string{err.Error()})
+			}
+			if revoked {
+				logger.WithField("jti", claims.ID).Warn("Rejected revoked token")
+				return utils.UnauthorizedErrorResponse(c, "Invalid token")
+			}
+
+			if claims.IsClientToken() {
+				return authenticateServiceAccount(c, next, serviceAccountService, claims, logger)
+			}
+
+			// Resolve the token subject, rejecting revoked tokens and deleted users
+			ctx := utils.NewRequestContext()
+			user, err := userService.AuthenticateToken(ctx, claims)
+			var statusErr *services.AccountStatusError
+			if errors.As(err, &statusErr) {
+				logger.WithContext(ctx).WithField("sub", claims.Subject).WithError(err).Warn("Rejected token for inactive account")
+				return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+			}
+			if err != nil {
+				logger.WithContext(ctx).WithField("sub", claims.Subject).WithError(err).Warn("Rejected JWT token")
+				return utils.UnauthorizedErrorResponse(c, "Invalid token")
+			}
+
+			if claims.IsImpersonation() {
+				return authenticateImpersonation(c, next, impersonationService, claims, user, logger)
+			}
+
+			// OAuth access tokens are limited to the scopes the user granted the client
+			if claims.IsDelegatedToken() {
+				scope, allowed := accessTokenRouteScopes[c.Request().Method+" "+c.Path()]
+				if !allowed || !containsScope(claims.Scopes(), scope) {
+					logger.WithContext(ctx).WithField("client_id", claims.ClientID).WithField("scope", scope).Warn("OAuth access token lacks required scope")
+					return utils.ForbiddenErrorResponse(c, "Token lacks required scope "+scope)
+				}
+			}
+
+			// Restricted tokens may only be used to change an expired password
+			if claims.Scope == utils.ScopePasswordChange && !passwordChangeRoutes[c.Request().Method+" "+c.Path()] {
+				logger.WithField("path", c.Request().URL.Path).Warn("Password change token used outside allowed routes")
+				return utils.ForbiddenErrorResponse(c, "Password change required")
+			}
+
+			sessionService.Touch(claims.SessionID)
+
+			// Set the internal user ID, session, token scope and authentication in context
+			c.Set("user", user)
+			c.Set("user_id", user.ID)
+			c.Set("user_role", user.Role)
+			c.Set("session_id", claims.SessionID)
+			c.Set("token_scope", claims.Scope)
+			if !claims.IsDelegatedToken() {
+				c.Set("authentication", claims.Authentication())
+			}
 			return next(c)
 		}
 	}
 }
 
+// authenticateAccessToken authenticates a request made with a personal access
+// token and checks that the token's scopes cover the route
+func authenticateAccessToken(c echo.Context, next echo.HandlerFunc, tokenService *services.PersonalAccessTokenService, credential string, logger *utils.Logger) error {
+	ctx := utils.NewRequestContext()
+	log := logger.WithContext(ctx).WithField("path", c.Request().URL.Path)
+
+	token, user, err := tokenService.Authenticate(ctx, credential)
+	var statusErr *services.AccountStatusError
+	if errors.As(err, &statusErr) {
+		log.WithError(err).Warn("Rejected access token for inactive account")
+		return utils.ErrorResponseWithCode(c, http.StatusForbidden, statusErr.Code(), "Account is "+statusErr.Status)
+	}
+	if err != nil {
+		log.WithError(err).Warn("Rejected access token")
+		return utils.UnauthorizedErrorResponse(c, "Invalid token")
+	}
+
+	scope, allowed := accessTokenRouteScopes[c.Request().Method+" "+c.Path()]
+	if !allowed {
+		log.WithField("prefix", token.Prefix).Warn("Access token used on a route that requires a login token")
+		return utils.ForbiddenErrorResponse(c, "This endpoint cannot be used with a personal access token")
+	}
+	if !token.HasScope(scope) {
+		log.WithField("prefix", token.Prefix).WithField("scope", scope).Warn("Access token lacks required scope")
+		return utils.ForbiddenErrorResponse(c, "Token lacks required scope "+scope)
+	}
+
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("access_token", token)
+	return next(c)
+}
+
+// authenticateServiceAccount authenticates a request made with a client
+// credentials token and checks that the token's scopes cover the route
+func authenticateServiceAccount(c echo.Context, next echo.HandlerFunc, serviceAccountService *services.ServiceAccountService, claims *utils.JWTClaims, logger *utils.Logger) error {
+	ctx := utils.NewRequestContext()
+	log := logger.WithContext(ctx).WithField("path", c.Request().URL.Path).WithField("client_id", claims.Subject)
+
+	account, scopes, err := serviceAccountService.AuthenticateToken(ctx, claims)
+	if err != nil {
+		log.WithError(err).Warn("Rejected client token")
+		return utils.UnauthorizedErrorResponse(c, "Invalid token")
+	}
+
+	scope, allowed := accessTokenRouteScopes[c.Request().Method+" "+c.Path()]
+	if !allowed || !containsScope(scopes, scope) {
+		log.WithField("scope", scope).Warn("Client token lacks required scope")
+		return utils.ForbiddenErrorResponse(c, "Token lacks required scope "+scope)
+	}
+
+	c.Set("service_account", account)
+	return next(c)
+}
+
+// containsScope reports whether scopes includes scope
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUserID gets the user ID from context
 func GetUserID(c echo.Context) (uint, error) {
 	userID, ok := c.Get("user_id").(uint)
@@ -51,3 +207,49 @@ func GetUserID(c echo.Context) (uint, error) {
 	}
 	return userID, nil
 }
+
+// GetUser gets the authenticated user from context
+func GetUser(c echo.Context) (*models.User, error) {
+	user, ok := c.Get("user").(*models.User)
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+	}
+	return user, nil
+}
+
+// GetSessionID gets the session public ID from context, empty for tokens issued without a session
+func GetSessionID(c echo.Context) string {
+	sessionID, _ := c.Get("session_id").(string)
+	return sessionID
+}
+
+// GetAuthentication gets when and how the user authenticated, with a zero
+// time for tokens that do not record it or were not issued to the user
+func GetAuthentication(c echo.Context) utils.Authentication {
+	auth, _ := c.Get("authentication").(utils.Authentication)
+	return auth
+}
+
+// GetAccessToken gets the personal access token the request was made with, if any
+func GetAccessToken(c echo.Context) *models.PersonalAccessToken {
+	token, _ := c.Get("access_token").(*models.PersonalAccessToken)
+	return token
+}
+
+// GetServiceAccount gets the service account the request was made by, nil for user requests
+func GetServiceAccount(c echo.Context) *models.ServiceAccount {
+	account, _ := c.Get("service_account").(*models.ServiceAccount)
+	return account
+}
+
+// GetTokenScope gets the token scope from context, empty for unrestricted tokens
+func GetTokenScope(c echo.Context) string {
+	scope, _ := c.Get("token_scope").(string)
+	return scope
+}
+
+// IsAdmin reports whether the authenticated user has the admin role
+func IsAdmin(c echo.Context) bool {
+	role, _ := c.Get("user_role").(string)
+	return role == models.RoleAdmin
+}
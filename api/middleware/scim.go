@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// SCIMContentType is the media type of SCIM requests and responses
+const SCIMContentType = "application/scim+json"
+
+// SCIMAuthMiddleware creates a middleware that authenticates a tenant's
+// identity provider by its SCIM bearer token. Failures are reported as SCIM errors.
+func SCIMAuthMiddleware(tokenService *services.SCIMTokenService, logger *utils.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := utils.NewRequestContext()
+			log := logger.WithContext(ctx).WithField("path", c.Request().URL.Path)
+
+			credential, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if !ok || credential == "" {
+				log.Warn("Missing SCIM bearer token")
+				return SCIMErrorResponse(c, &services.SCIMError{Status: http.StatusUnauthorized, Detail: "missing bearer token"})
+			}
+
+			token, err := tokenService.Authenticate(ctx, credential)
+			if err != nil {
+				log.WithError(err).Warn("Rejected SCIM token")
+				return SCIMErrorResponse(c, &services.SCIMError{Status: http.StatusUnauthorized, Detail: "invalid bearer token"})
+			}
+
+			c.Set("scim_tenant", token.Tenant)
+			return next(c)
+		}
+	}
+}
+
+// GetSCIMTenant gets the tenant a SCIM request was made by
+func GetSCIMTenant(c echo.Context) string {
+	tenant, _ := c.Get("scim_tenant").(string)
+	return tenant
+}
+
+// SCIMErrorResponse writes a SCIM error
+func SCIMErrorResponse(c echo.Context, err *services.SCIMError) error {
+	body, marshalErr := json.Marshal(err.Response())
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return c.Blob(err.Status, SCIMContentType, body)
+}
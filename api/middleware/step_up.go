@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/utils"
+)
+
+// ReauthenticationRequiredCode is the error code of requests that need a fresh authentication
+const ReauthenticationRequiredCode = "reauthentication_required"
+
+// StepUpMiddleware creates a middleware for sensitive routes that requires the
+// user to have authenticated with their password or a second factor within
+// maxAge. Users re-authenticate at POST /api/reauthenticate to get a token
+// that does. Personal access tokens and OAuth access tokens never qualify.
+// It must be registered after JWTMiddleware.
+func StepUpMiddleware(maxAge time.Duration, logger *utils.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !HasRecentAuthentication(c, maxAge) {
+				logger.WithField("path", c.Request().URL.Path).WithField("amr", GetAuthentication(c).Methods).Warn("Sensitive operation without recent authentication")
+				return ReauthenticationRequiredResponse(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// HasRecentAuthentication reports whether the request's token records an
+// authentication with a password or a second factor within maxAge, for
+// handlers that only need a step-up for some changes
+func HasRecentAuthentication(c echo.Context, maxAge time.Duration) bool {
+	auth := GetAuthentication(c)
+	return !auth.Time.IsZero() && time.Since(auth.Time) <= maxAge && auth.UsedAny(utils.AMRPassword, utils.AMRMultiFactor)
+}
+
+// ReauthenticationRequiredResponse answers a sensitive request that needs a fresh authentication
+func ReauthenticationRequiredResponse(c echo.Context) error {
+	return utils.ErrorResponseWithCode(c, http.StatusForbidden, ReauthenticationRequiredCode, "Recent authentication required")
+}
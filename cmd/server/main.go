@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
@@ -42,20 +45,253 @@ func main() {
 	db.LogMode(cfg.Log.Level == "debug")
 	db.SingularTable(true)
 
+	// Set up password hashing
+	passwordHasher, err := utils.NewPasswordHasher(cfg.Password.Algorithm, cfg.Password.BcryptCost, utils.Argon2Params{
+		Memory:      cfg.Password.Argon2Memory,
+		Iterations:  cfg.Password.Argon2Iterations,
+		Parallelism: cfg.Password.Argon2Parallelism,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Invalid password hashing configuration")
+	}
+	models.SetPasswordHasher(passwordHasher)
+
+	// Load the OpenID Connect signing key
+	var signingKey *utils.SigningKey
+	if cfg.OIDC.SigningKeyFile != "" {
+		signingKey, err = utils.LoadSigningKey(cfg.OIDC.SigningKeyFile)
+	} else {
+		log.Warn("OIDC_SIGNING_KEY_FILE is not set, ID tokens are signed with a temporary key")
+		signingKey, err = utils.GenerateSigningKey()
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load OIDC signing key")
+	}
+
 	// Migrate database
 	log.Info("Running database migrations...")
 	if err := models.SetupUserTable(db); err != nil {
 		log.WithError(err).Fatal("Failed to set up database tables")
 	}
+	if err := models.SetupPasswordHistoryTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupUserStatusTransitionTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupSessionTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupPersonalAccessTokenTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupServiceAccountTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupOAuthTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupRevokedTokenTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupIdentityTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupSAMLTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupGroupTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupSCIMTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupLDAPTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupMagicLinkTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupPasswordResetTable(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupWebAuthnTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.SetupImpersonationTables(db); err != nil {
+		log.WithError(err).Fatal("Failed to set up database tables")
+	}
+	if err := models.MigratePublicIDs(db); err != nil {
+		log.WithError(err).Fatal("Failed to backfill user public IDs")
+	}
+	collisions, err := models.MigrateNormalizedEmails(db, cfg.Email.FoldLocalPart)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to normalize user emails")
+	}
+	for _, collision := range collisions {
+		log.WithFields(map[string]interface{}{
+			"email_normalized": collision.EmailNormalized,
+			"user_ids":         collision.UserIDs,
+		}).Warn("Accounts share a normalized email, resolve manually to enable the unique index")
+	}
 
 	// Initialize repositories
-	userRepo := repositories.NewUserRepository(db, logger)
+	userRepo := repositories.NewUserRepository(db, cfg.Email.FoldLocalPart, logger)
+	passwordHistoryRepo := repositories.NewPasswordHistoryRepository(db, logger)
+	userStatusRepo := repositories.NewUserStatusRepository(db, logger)
+	sessionRepo := repositories.NewSessionRepository(db, logger)
+	accessTokenRepo := repositories.NewPersonalAccessTokenRepository(db, logger)
+	serviceAccountRepo := repositories.NewServiceAccountRepository(db, logger)
+	oauthClientRepo := repositories.NewOAuthClientRepository(db, logger)
+	oauthGrantRepo := repositories.NewOAuthGrantRepository(db, logger)
+	revokedTokenRepo := repositories.NewRevokedTokenRepository(db, logger)
+	identityRepo := repositories.NewIdentityRepository(db, logger)
+	samlRequestRepo := repositories.NewSAMLRequestRepository(db, logger)
+	groupRepo := repositories.NewGroupRepository(db, logger)
+	scimTokenRepo := repositories.NewSCIMTokenRepository(db, logger)
+	ldapSyncRunRepo := repositories.NewLDAPSyncRunRepository(db, logger)
+	magicLinkRepo := repositories.NewMagicLinkRepository(db, logger)
+	passwordResetRepo := repositories.NewPasswordResetRepository(db, logger)
+	webAuthnRepo := repositories.NewWebAuthnRepository(db, logger)
+	impersonationRepo := repositories.NewImpersonationRepository(db, logger)
 
 	// Initialize services
-	userService := services.NewUserService(userRepo, cfg, logger)
+	sessionService := services.NewSessionService(sessionRepo, cfg, logger)
+	// Login tokens list the groups users are in
+	groupService := services.NewGroupService(groupRepo, userRepo, cfg, logger)
+	userService := services.NewUserService(userRepo, passwordHistoryRepo, sessionService, groupService, cfg, logger)
+	if cfg.PasswordPolicy.BreachedListFile != "" {
+		breached, err := services.LoadBreachedPasswordList(cfg.PasswordPolicy.BreachedListFile, cfg.PasswordPolicy.BreachedListMax)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load breached password list")
+		}
+		userService.PasswordPolicy.BreachedPasswords = breached
+		log.WithField("hashes", breached.Size()).Info("Breached password list loaded")
+	}
+	if cfg.Attributes.SchemaFile != "" {
+		schema, err := services.LoadAttributeSchema(cfg.Attributes.SchemaFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load user attribute schema")
+		}
+		userService.AttributeSchema = schema
+		log.WithField("attributes", len(schema.Attributes)).Info("User attribute schema loaded")
+	}
+	if cfg.Admin.BootstrapEmail != "" {
+		admin, err := userService.BootstrapAdmin(context.Background(), cfg.Admin.BootstrapEmail)
+		switch {
+		case errors.Is(err, repositories.ErrUserNotFound):
+			log.Warn("ADMIN_BOOTSTRAP_EMAIL is not registered yet, restart once it is to make it an admin")
+		case err != nil:
+			log.WithError(err).Fatal("Failed to bootstrap admin")
+		case admin != nil:
+			log.WithField("user_id", admin.PublicID).Info("Admin bootstrapped")
+		}
+	}
+
+	// Password logins of users with passkeys need one as a second factor
+	webAuthnService := services.NewWebAuthnService(webAuthnRepo, userRepo, userService, cfg, logger)
+	userService.SecondFactor = webAuthnService
+
+	userStatusService := services.NewUserStatusService(userRepo, userStatusRepo, logger)
+	impersonationService := services.NewImpersonationService(impersonationRepo, userRepo, cfg, logger)
+	accessTokenService := services.NewPersonalAccessTokenService(accessTokenRepo, userRepo, logger)
+	serviceAccountService := services.NewServiceAccountService(serviceAccountRepo, cfg, logger)
+	oauthService := services.NewOAuthService(oauthClientRepo, oauthGrantRepo, userRepo, signingKey, cfg, logger)
+	revocationService := services.NewTokenRevocationService(revokedTokenRepo, logger)
+	introspectionService := services.NewTokenIntrospectionService(userService, accessTokenService, serviceAccountService, oauthService, revocationService, impersonationService, cfg, logger)
+
+	var federationProviders []*services.FederationProvider
+	if cfg.Federation.ProvidersFile != "" {
+		federationProviders, err = services.LoadFederationProviders(cfg.Federation.ProvidersFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load federation providers")
+		}
+		log.WithField("providers", len(federationProviders)).Info("Federation providers loaded")
+	}
+	federationService := services.NewFederationService(identityRepo, userRepo, userService, webAuthnService, federationProviders, cfg, logger)
+
+	var samlConnections []*services.SAMLConnection
+	if cfg.SAML.ConnectionsFile != "" {
+		samlConnections, err = services.LoadSAMLConnections(cfg.SAML.ConnectionsFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load SAML connections")
+		}
+		log.WithField("connections", len(samlConnections)).Info("SAML connections loaded")
+	}
+	samlService := services.NewSAMLService(samlRequestRepo, federationService, samlConnections, cfg, logger)
+	scimService := services.NewSCIMService(userRepo, groupRepo, identityRepo, userService, userStatusService, cfg, logger)
+	scimTokenService := services.NewSCIMTokenService(scimTokenRepo, logger)
+
+	var ldapDirectories []*services.LDAPDirectory
+	if cfg.LDAP.DirectoriesFile != "" {
+		ldapDirectories, err = services.LoadLDAPDirectories(cfg.LDAP.DirectoriesFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load LDAP directories")
+		}
+		log.WithField("directories", len(ldapDirectories)).Info("LDAP directories loaded")
+	}
+	ldapSyncService := services.NewLDAPSyncService(ldapSyncRunRepo, userRepo, identityRepo, userService, userStatusService, ldapDirectories, cfg, logger)
+
+	var mailer utils.Mailer
+	switch cfg.Mail.Driver {
+	case "smtp":
+		mailer = utils.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	case "log":
+		log.Warn("MAIL_DRIVER is log, emails are written to the log instead of sent")
+		mailer = utils.NewLogMailer(logger)
+	}
+	magicLinkService := services.NewMagicLinkService(magicLinkRepo, userRepo, identityRepo, userService, mailer, samlConnections, cfg, logger)
+	if magicLinkService.Enabled() && (mailer == nil || cfg.MagicLink.URL == "") {
+		log.Fatal("Magic links need MAIL_DRIVER and MAGIC_LINK_URL to be set")
+	}
+	passwordResetService := services.NewPasswordResetService(passwordResetRepo, userRepo, userService, mailer, cfg, logger)
+	if passwordResetService.Enabled() && mailer == nil {
+		log.Fatal("Password resets need MAIL_DRIVER to be set")
+	}
+
+	// Reactivate lapsed suspensions in the background
+	go userStatusService.RunReactivationSweeper(context.Background(), time.Minute)
+
+	// Write buffered session and access token activity in batches
+	go sessionService.RunLastSeenFlusher(context.Background(), time.Minute)
+	go accessTokenService.RunLastUsedFlusher(context.Background(), time.Minute)
+
+	// Forget revoked tokens once they have expired
+	go revocationService.RunPurger(context.Background(), time.Minute)
+
+	// Forget SAML requests that were never answered
+	go samlService.RunPurger(context.Background(), time.Minute)
+
+	// Forget magic links once they no longer count towards rate limits
+	go magicLinkService.RunPurger(context.Background(), time.Minute)
+
+	// Forget password reset links once they no longer count towards rate limits
+	go passwordResetService.RunPurger(context.Background(), time.Minute)
+
+	// Forget passkey ceremonies that were never completed
+	go webAuthnService.RunPurger(context.Background(), time.Minute)
+
+	// Sync LDAP directories on their schedules
+	go ldapSyncService.RunScheduler(context.Background(), time.Minute)
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(userService, logger)
+	userStatusHandler := handlers.NewUserStatusHandler(userStatusService, logger)
+	sessionHandler := handlers.NewSessionHandler(sessionService, logger)
+	accessTokenHandler := handlers.NewPersonalAccessTokenHandler(accessTokenService, logger)
+	serviceAccountHandler := handlers.NewServiceAccountHandler(serviceAccountService, logger)
+	oauthHandler := handlers.NewOAuthHandler(serviceAccountService, oauthService, userService, webAuthnService, introspectionService, logger)
+	oauthClientHandler := handlers.NewOAuthClientHandler(oauthService, logger)
+	federationHandler := handlers.NewFederationHandler(federationService, logger)
+	samlHandler := handlers.NewSAMLHandler(samlService, logger)
+	scimHandler := handlers.NewSCIMHandler(scimService, logger)
+	scimTokenHandler := handlers.NewSCIMTokenHandler(scimTokenService, logger)
+	ldapSyncHandler := handlers.NewLDAPSyncHandler(ldapSyncService, logger)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService, logger)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService, logger)
+	webAuthnHandler := handlers.NewWebAuthnHandler(webAuthnService, logger)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService, logger)
+	groupHandler := handlers.NewGroupHandler(groupService, logger)
 
 	// Initialize echo
 	e := echo.New()
@@ -66,11 +302,30 @@ func main() {
 	e.Use(echoMiddleware.Recover())
 	e.Use(echoMiddleware.CORS())
 
-	// Create JWT middleware
-	jwtMiddleware := middleware.JWTMiddleware(cfg, logger)
+	// Create auth middlewares
+	jwtMiddleware := middleware.JWTMiddleware(cfg, userService, sessionService, accessTokenService, serviceAccountService, revocationService, impersonationService, logger)
+	adminMiddleware := middleware.AdminMiddleware(userService, logger)
+	stepUpMiddleware := middleware.StepUpMiddleware(time.Duration(cfg.StepUp.MaxAge)*time.Minute, logger)
+	scimMiddleware := middleware.SCIMAuthMiddleware(scimTokenService, logger)
 
 	// Register routes
-	userHandler.RegisterRoutes(e, jwtMiddleware)
+	userHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware, stepUpMiddleware)
+	userStatusHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
+	sessionHandler.RegisterRoutes(e, jwtMiddleware)
+	accessTokenHandler.RegisterRoutes(e, jwtMiddleware)
+	serviceAccountHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
+	oauthHandler.RegisterRoutes(e, jwtMiddleware)
+	oauthClientHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
+	federationHandler.RegisterRoutes(e, jwtMiddleware)
+	samlHandler.RegisterRoutes(e)
+	scimHandler.RegisterRoutes(e, scimMiddleware)
+	scimTokenHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
+	ldapSyncHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
+	magicLinkHandler.RegisterRoutes(e)
+	passwordResetHandler.RegisterRoutes(e)
+	webAuthnHandler.RegisterRoutes(e, jwtMiddleware)
+	impersonationHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware, stepUpMiddleware)
+	groupHandler.RegisterRoutes(e, jwtMiddleware, adminMiddleware)
 
 	// Add health check endpoint
 	e.GET("/health", func(c echo.Context) error {
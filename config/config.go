@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -29,6 +31,87 @@ type Config struct {
 	Log struct {
 		Level string
 	}
+	Admin struct {
+		BootstrapEmail string // registered user made an admin at startup while there is none
+	}
+	Email struct {
+		FoldLocalPart bool // treat the part before @ as case-insensitive
+	}
+	Attributes struct {
+		SchemaFile string // JSON file describing custom profile attributes
+	}
+	Password struct {
+		Algorithm         string // bcrypt or argon2id
+		BcryptCost        int
+		Argon2Memory      uint32 // in KiB
+		Argon2Iterations  uint32
+		Argon2Parallelism uint8
+	}
+	PasswordPolicy struct {
+		MinLength        int
+		MaxLength        int
+		RequireUpper     bool
+		RequireLower     bool
+		RequireDigit     bool
+		RequireSymbol    bool
+		DisallowUserInfo bool
+		MinStrength      int // 0-4
+		BreachedListFile string
+		BreachedListMax  int // most hashes the breached list may hold
+		HistorySize      int // number of previous passwords that cannot be reused
+		MaxAgeDays       int // 0 disables expiry
+	}
+	OAuth struct {
+		AccessTokenTTL  int // in minutes
+		RefreshTokenTTL int // in days
+	}
+	OIDC struct {
+		Issuer         string // public base URL, also the iss claim of ID tokens
+		SigningKeyFile string // PEM RSA key; a temporary key is generated when empty
+	}
+	Federation struct {
+		ProvidersFile string // JSON file describing upstream OpenID Connect providers
+	}
+	SAML struct {
+		ConnectionsFile string // JSON file describing tenants' SAML identity providers
+	}
+	LDAP struct {
+		DirectoriesFile string // JSON file describing the LDAP directories users are synchronized with
+	}
+	Mail struct {
+		Driver       string // smtp, or log to only log emails; empty disables email
+		From         string
+		SMTPHost     string
+		SMTPPort     int
+		SMTPUsername string
+		SMTPPassword string
+	}
+	MagicLink struct {
+		Enabled   bool   // default for users whose tenant does not configure magic links
+		URL       string // page the emailed link opens, which submits the token
+		TTL       int    // in minutes
+		RateLimit int    // links per email per hour
+	}
+	PasswordReset struct {
+		URL       string // page the emailed link opens, which submits the token and new password; empty disables resets
+		TTL       int    // in minutes
+		RateLimit int    // links per email per hour
+	}
+	WebAuthn struct {
+		RPID    string   // relying party ID, the domain passkeys are registered for
+		RPName  string   // name authenticators show for the service
+		Origins []string // origins WebAuthn responses may come from
+	}
+	StepUp struct {
+		MaxAge   int // in minutes, how recently sensitive operations require authentication
+		TokenTTL int // in minutes, lifetime of tokens issued by re-authentication
+	}
+	Impersonation struct {
+		TTL int // in minutes
+	}
+	Groups struct {
+		ClaimLimit int // most groups listed in a token before it only flags the overflow
+	}
 }
 
 // Load loads the configuration from environment variables
@@ -70,6 +153,211 @@ func Load() (*Config, error) {
 	// Log config
 	config.Log.Level = getEnv("LOG_LEVEL", "info")
 
+	// Admin bootstrap config
+	config.Admin.BootstrapEmail = strings.TrimSpace(getEnv("ADMIN_BOOTSTRAP_EMAIL", ""))
+
+	// Email config
+	if config.Email.FoldLocalPart, err = getEnvBool("EMAIL_FOLD_LOCAL_PART", true); err != nil {
+		return nil, err
+	}
+
+	// Custom attribute config
+	config.Attributes.SchemaFile = getEnv("USER_ATTRIBUTE_SCHEMA_FILE", "")
+
+	// Password hashing config
+	config.Password.Algorithm = getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	if cost, err := strconv.Atoi(getEnv("BCRYPT_COST", "10")); err == nil {
+		config.Password.BcryptCost = cost
+	} else {
+		return nil, fmt.Errorf("invalid bcrypt cost: %w", err)
+	}
+	if memory, err := strconv.ParseUint(getEnv("ARGON2_MEMORY", "65536"), 10, 32); err == nil && memory > 0 {
+		config.Password.Argon2Memory = uint32(memory)
+	} else {
+		return nil, fmt.Errorf("invalid argon2 memory: must be a positive number of KiB")
+	}
+	if iterations, err := strconv.ParseUint(getEnv("ARGON2_ITERATIONS", "3"), 10, 32); err == nil && iterations > 0 {
+		config.Password.Argon2Iterations = uint32(iterations)
+	} else {
+		return nil, fmt.Errorf("invalid argon2 iterations: must be a positive number")
+	}
+	if parallelism, err := strconv.ParseUint(getEnv("ARGON2_PARALLELISM", "2"), 10, 8); err == nil && parallelism > 0 {
+		config.Password.Argon2Parallelism = uint8(parallelism)
+	} else {
+		return nil, fmt.Errorf("invalid argon2 parallelism: must be between 1 and 255")
+	}
+
+	// Password policy config
+	if minLength, err := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "6")); err == nil {
+		config.PasswordPolicy.MinLength = minLength
+	} else {
+		return nil, fmt.Errorf("invalid password min length: %w", err)
+	}
+	if maxLength, err := strconv.Atoi(getEnv("PASSWORD_MAX_LENGTH", "128")); err == nil {
+		config.PasswordPolicy.MaxLength = maxLength
+	} else {
+		return nil, fmt.Errorf("invalid password max length: %w", err)
+	}
+	if config.PasswordPolicy.RequireUpper, err = getEnvBool("PASSWORD_REQUIRE_UPPER", false); err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy.RequireLower, err = getEnvBool("PASSWORD_REQUIRE_LOWER", false); err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy.RequireDigit, err = getEnvBool("PASSWORD_REQUIRE_DIGIT", false); err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy.RequireSymbol, err = getEnvBool("PASSWORD_REQUIRE_SYMBOL", false); err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy.DisallowUserInfo, err = getEnvBool("PASSWORD_DISALLOW_USER_INFO", true); err != nil {
+		return nil, err
+	}
+	if strength, err := strconv.Atoi(getEnv("PASSWORD_MIN_STRENGTH", "0")); err == nil && strength >= 0 && strength <= 4 {
+		config.PasswordPolicy.MinStrength = strength
+	} else {
+		return nil, fmt.Errorf("invalid password min strength: must be between 0 and 4")
+	}
+	config.PasswordPolicy.BreachedListFile = getEnv("PASSWORD_BREACHED_LIST_FILE", "")
+	if limit, err := strconv.Atoi(getEnv("PASSWORD_BREACHED_LIST_MAX", "1000000")); err == nil && limit > 0 {
+		config.PasswordPolicy.BreachedListMax = limit
+	} else {
+		return nil, fmt.Errorf("invalid breached password list size: must be a positive number of hashes")
+	}
+	if historySize, err := strconv.Atoi(getEnv("PASSWORD_HISTORY_SIZE", "0")); err == nil {
+		config.PasswordPolicy.HistorySize = historySize
+	} else {
+		return nil, fmt.Errorf("invalid password history size: %w", err)
+	}
+	if maxAge, err := strconv.Atoi(getEnv("PASSWORD_MAX_AGE_DAYS", "0")); err == nil {
+		config.PasswordPolicy.MaxAgeDays = maxAge
+	} else {
+		return nil, fmt.Errorf("invalid password max age: %w", err)
+	}
+
+	// OAuth config
+	if ttl, err := strconv.Atoi(getEnv("OAUTH_ACCESS_TOKEN_TTL_MINUTES", "60")); err == nil && ttl > 0 {
+		config.OAuth.AccessTokenTTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid OAuth access token TTL: must be a positive number of minutes")
+	}
+	if ttl, err := strconv.Atoi(getEnv("OAUTH_REFRESH_TOKEN_TTL_DAYS", "30")); err == nil && ttl > 0 {
+		config.OAuth.RefreshTokenTTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid OAuth refresh token TTL: must be a positive number of days")
+	}
+
+	// OpenID Connect config
+	config.OIDC.Issuer = strings.TrimSuffix(getEnv("OIDC_ISSUER", fmt.Sprintf("http://localhost:%d", config.Server.Port)), "/")
+	config.OIDC.SigningKeyFile = getEnv("OIDC_SIGNING_KEY_FILE", "")
+
+	// Federated login config
+	config.Federation.ProvidersFile = getEnv("FEDERATION_PROVIDERS_FILE", "")
+
+	// SAML single sign-on config
+	config.SAML.ConnectionsFile = getEnv("SAML_CONNECTIONS_FILE", "")
+
+	// LDAP directory sync config
+	config.LDAP.DirectoriesFile = getEnv("LDAP_DIRECTORIES_FILE", "")
+
+	// Mail config
+	config.Mail.Driver = getEnv("MAIL_DRIVER", "")
+	if config.Mail.Driver != "" && config.Mail.Driver != "smtp" && config.Mail.Driver != "log" {
+		return nil, fmt.Errorf("invalid mail driver: must be smtp or log")
+	}
+	config.Mail.From = getEnv("MAIL_FROM", "")
+	config.Mail.SMTPHost = getEnv("SMTP_HOST", "localhost")
+	if port, err := strconv.Atoi(getEnv("SMTP_PORT", "587")); err == nil {
+		config.Mail.SMTPPort = port
+	} else {
+		return nil, fmt.Errorf("invalid SMTP port: %w", err)
+	}
+	config.Mail.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	config.Mail.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	if config.Mail.Driver == "smtp" && config.Mail.From == "" {
+		return nil, fmt.Errorf("MAIL_FROM is required to send email over SMTP")
+	}
+
+	// Magic link config
+	if config.MagicLink.Enabled, err = getEnvBool("MAGIC_LINK_ENABLED", false); err != nil {
+		return nil, err
+	}
+	config.MagicLink.URL = getEnv("MAGIC_LINK_URL", "")
+	if config.MagicLink.URL != "" {
+		link, err := url.Parse(config.MagicLink.URL)
+		if err != nil || (link.Scheme != "https" && link.Scheme != "http") || link.Host == "" {
+			return nil, fmt.Errorf("invalid MAGIC_LINK_URL: must be an absolute http(s) URL")
+		}
+	}
+	if ttl, err := strconv.Atoi(getEnv("MAGIC_LINK_TTL_MINUTES", "15")); err == nil && ttl > 0 && ttl <= 60 {
+		config.MagicLink.TTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid magic link TTL: must be between 1 and 60 minutes")
+	}
+	if limit, err := strconv.Atoi(getEnv("MAGIC_LINK_RATE_LIMIT", "5")); err == nil && limit > 0 {
+		config.MagicLink.RateLimit = limit
+	} else {
+		return nil, fmt.Errorf("invalid magic link rate limit: must be a positive number of links per hour")
+	}
+
+	// Password reset config
+	config.PasswordReset.URL = getEnv("PASSWORD_RESET_URL", "")
+	if config.PasswordReset.URL != "" {
+		link, err := url.Parse(config.PasswordReset.URL)
+		if err != nil || (link.Scheme != "https" && link.Scheme != "http") || link.Host == "" {
+			return nil, fmt.Errorf("invalid PASSWORD_RESET_URL: must be an absolute http(s) URL")
+		}
+	}
+	if ttl, err := strconv.Atoi(getEnv("PASSWORD_RESET_TTL_MINUTES", "30")); err == nil && ttl > 0 && ttl <= 60 {
+		config.PasswordReset.TTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid password reset TTL: must be between 1 and 60 minutes")
+	}
+	if limit, err := strconv.Atoi(getEnv("PASSWORD_RESET_RATE_LIMIT", "3")); err == nil && limit > 0 {
+		config.PasswordReset.RateLimit = limit
+	} else {
+		return nil, fmt.Errorf("invalid password reset rate limit: must be a positive number of links per hour")
+	}
+
+	// WebAuthn config, by default for the host the issuer URL names
+	issuer, err := url.Parse(config.OIDC.Issuer)
+	if err != nil || issuer.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC issuer: must be an absolute URL")
+	}
+	config.WebAuthn.RPID = getEnv("WEBAUTHN_RP_ID", issuer.Hostname())
+	config.WebAuthn.RPName = getEnv("WEBAUTHN_RP_NAME", "User Management Service")
+	for _, origin := range strings.Split(getEnv("WEBAUTHN_ORIGINS", issuer.Scheme+"://"+issuer.Host), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			config.WebAuthn.Origins = append(config.WebAuthn.Origins, origin)
+		}
+	}
+
+	// Step-up authentication config
+	if maxAge, err := strconv.Atoi(getEnv("STEP_UP_MAX_AGE_MINUTES", "10")); err == nil && maxAge > 0 {
+		config.StepUp.MaxAge = maxAge
+	} else {
+		return nil, fmt.Errorf("invalid step-up max age: must be a positive number of minutes")
+	}
+	if ttl, err := strconv.Atoi(getEnv("STEP_UP_TOKEN_TTL_MINUTES", "10")); err == nil && ttl > 0 && ttl <= 60 {
+		config.StepUp.TokenTTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid step-up token TTL: must be between 1 and 60 minutes")
+	}
+
+	// Impersonation config
+	if ttl, err := strconv.Atoi(getEnv("IMPERSONATION_TTL_MINUTES", "15")); err == nil && ttl > 0 && ttl <= 60 {
+		config.Impersonation.TTL = ttl
+	} else {
+		return nil, fmt.Errorf("invalid impersonation TTL: must be between 1 and 60 minutes")
+	}
+
+	// Groups config
+	if limit, err := strconv.Atoi(getEnv("GROUP_CLAIM_LIMIT", "50")); err == nil && limit > 0 && limit <= 500 {
+		config.Groups.ClaimLimit = limit
+	} else {
+		return nil, fmt.Errorf("invalid group claim limit: must be between 1 and 500")
+	}
+
 	return config, nil
 }
 
@@ -87,3 +375,17 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// Helper function to get a boolean environment variable with fallback
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Group roles
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+)
+
+// IsValidGroupRole reports whether role is a known group role
+func IsValidGroupRole(role string) bool {
+	return role == GroupRoleOwner || role == GroupRoleMember
+}
+
+// Group is a named set of users. Groups pushed by a tenant's directory over
+// SCIM record the tenant's identity provider in Provider and are only managed
+// through it; names are unique per provider. Local groups can be nested in
+// another local group, whose members then include the subgroup's.
+type Group struct {
+	ID             uint      `gorm:"primary_key" json:"-"`
+	PublicID       string    `gorm:"size:36;unique_index" json:"id"`
+	Name           string    `gorm:"size:255;not null;unique_index:uix_groups_provider_name" json:"name"`
+	Description    string    `gorm:"size:500" json:"description,omitempty"`
+	Provider       string    `gorm:"size:50;not null;default:'';unique_index:uix_groups_provider_name" json:"provider,omitempty"`
+	ExternalID     string    `gorm:"size:255" json:"-"`
+	ParentID       *uint     `gorm:"index" json:"-"`
+	ParentPublicID string    `gorm:"-" json:"parent_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// IsLocal reports whether the group is managed here rather than by a directory
+func (g *Group) IsLocal() bool {
+	return g.Provider == ""
+}
+
+// BeforeCreate assigns a public ID to new groups
+func (g *Group) BeforeCreate() error {
+	if g.PublicID == "" {
+		g.PublicID = NewPublicID()
+	}
+	return nil
+}
+
+// TableName specifies the table name
+func (Group) TableName() string {
+	return "groups"
+}
+
+// GroupMember is a user's membership of a group. Owners manage the group's
+// details and members.
+type GroupMember struct {
+	GroupID   uint   `gorm:"primary_key;auto_increment:false"`
+	UserID    uint   `gorm:"primary_key;auto_increment:false;index"`
+	Role      string `gorm:"size:20;not null;default:'member'"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name
+func (GroupMember) TableName() string {
+	return "group_members"
+}
+
+// GroupMembership is a member of a group as listed to clients
+type GroupMembership struct {
+	UserID   string    `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// SetupGroupTables sets up the group and group membership tables
+func SetupGroupTables(db *gorm.DB) error {
+	return db.AutoMigrate(&Group{}, &GroupMember{}).Error
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FederatedLinkTokenKind is the prefix of the tokens that confirm linking an external identity
+const FederatedLinkTokenKind = "fl"
+
+// Identity links a user to their account at an external OpenID Connect
+// provider, identified by the provider's subject. A user can have several.
+type Identity struct {
+	ID          uint       `gorm:"primary_key" json:"-"`
+	PublicID    string     `gorm:"size:36;unique_index" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"-"`
+	Provider    string     `gorm:"size:50;not null;unique_index:uix_identities_provider_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;unique_index:uix_identities_provider_subject" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (Identity) TableName() string {
+	return "identities"
+}
+
+// FederatedLinkRequest is an external identity waiting to be linked to the
+// existing account with the same email, once the user confirms they own the account
+type FederatedLinkRequest struct {
+	ID        uint   `gorm:"primary_key"`
+	TokenHash string `gorm:"size:64;not null;unique_index"`
+	UserID    uint   `gorm:"not null;index"`
+	Provider  string `gorm:"size:50;not null"`
+	Subject   string `gorm:"size:255;not null"`
+	Email     string `gorm:"size:255"`
+	// CeremonyID is the passkey ceremony that must complete the link once
+	// the user's password is verified, empty until then
+	CeremonyID string    `gorm:"size:36"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	CreatedAt  time.Time
+}
+
+// TableName specifies the table name
+func (FederatedLinkRequest) TableName() string {
+	return "federated_link_requests"
+}
+
+// SetupIdentityTables sets up the identity and link request tables
+func SetupIdentityTables(db *gorm.DB) error {
+	return db.AutoMigrate(&Identity{}, &FederatedLinkRequest{}).Error
+}
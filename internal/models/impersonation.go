@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Impersonation is a period in which an admin acts as another user. Its
+// public ID is also the ID of the token issued for it.
+type Impersonation struct {
+	ID        uint       `gorm:"primary_key" json:"-"`
+	PublicID  string     `gorm:"size:36;unique_index" json:"id"`
+	ActorID   string     `gorm:"size:36;not null;index" json:"actor_id"` // public ID of the admin
+	UserID    uint       `gorm:"not null;index" json:"-"`
+	Reason    string     `gorm:"size:500;not null" json:"reason"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (Impersonation) TableName() string {
+	return "impersonations"
+}
+
+// IsActive reports whether the impersonation has neither ended nor expired
+func (i *Impersonation) IsActive(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// ImpersonationEvent records a request made while an admin impersonated a user
+type ImpersonationEvent struct {
+	ID              uint      `gorm:"primary_key" json:"-"`
+	ImpersonationID uint      `gorm:"not null;index" json:"-"`
+	ActorID         string    `gorm:"size:36;not null" json:"actor_id"`
+	UserID          uint      `gorm:"not null" json:"-"`
+	Method          string    `gorm:"size:10;not null" json:"method"`
+	Path            string    `gorm:"size:2048;not null" json:"path"`
+	Status          int       `gorm:"not null" json:"status"`
+	RequestID       string    `gorm:"size:36" json:"request_id,omitempty"`
+	IPAddress       string    `gorm:"size:45" json:"ip_address,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (ImpersonationEvent) TableName() string {
+	return "impersonation_events"
+}
+
+// SetupImpersonationTables sets up the impersonation tables
+func SetupImpersonationTables(db *gorm.DB) error {
+	return db.AutoMigrate(&Impersonation{}, &ImpersonationEvent{}).Error
+}
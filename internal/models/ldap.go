@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LDAP sync run statuses
+const (
+	LDAPSyncRunning   = "running"
+	LDAPSyncSucceeded = "succeeded"
+	LDAPSyncFailed    = "failed"
+)
+
+// LDAP sync change actions
+const (
+	LDAPSyncCreate     = "create"
+	LDAPSyncUpdate     = "update"
+	LDAPSyncDeactivate = "deactivate"
+	LDAPSyncReactivate = "reactivate"
+	LDAPSyncConflict   = "conflict" // the email belongs to an account the directory does not manage
+	LDAPSyncSkip       = "skip"     // the entry lacks an ID or a valid email
+)
+
+// LDAPSyncFieldChange is the old and new value of a changed user field
+type LDAPSyncFieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// LDAPSyncChange is one change a sync run made, or would make in a dry run
+type LDAPSyncChange struct {
+	Action string                         `json:"action"`
+	DN     string                         `json:"dn,omitempty"`
+	UserID string                         `json:"user_id,omitempty"` // public ID
+	Email  string                         `json:"email,omitempty"`
+	Fields map[string]LDAPSyncFieldChange `json:"fields,omitempty"`
+	Reason string                         `json:"reason,omitempty"`
+	Error  string                         `json:"error,omitempty"` // why applying the change failed
+}
+
+// LDAPSyncChanges holds the changes of a sync run stored as a JSONB document
+type LDAPSyncChanges []LDAPSyncChange
+
+// Value implements driver.Valuer
+func (c LDAPSyncChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (c *LDAPSyncChanges) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for LDAP sync changes")
+	}
+
+	var changes LDAPSyncChanges
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return err
+	}
+	*c = changes
+	return nil
+}
+
+// LDAPSyncRun records a synchronization of users with an LDAP directory.
+// A dry run computes the same changes without applying them.
+type LDAPSyncRun struct {
+	ID          uint            `gorm:"primary_key" json:"-"`
+	PublicID    string          `gorm:"size:36;unique_index" json:"id"`
+	Directory   string          `gorm:"size:40;not null;index" json:"directory"`
+	DryRun      bool            `gorm:"not null" json:"dry_run"`
+	Status      string          `gorm:"size:20;not null" json:"status"`
+	ActorID     string          `gorm:"size:36" json:"actor_id,omitempty"` // public ID of the admin, empty for scheduled runs
+	Entries     int             `json:"entries"`
+	Created     int             `json:"created"`
+	Updated     int             `json:"updated"`
+	Deactivated int             `json:"deactivated"`
+	Reactivated int             `json:"reactivated"`
+	Conflicts   int             `json:"conflicts"`
+	Skipped     int             `json:"skipped"`
+	Failed      int             `json:"failed"`
+	Error       string          `gorm:"size:1000" json:"error,omitempty"`
+	Changes     LDAPSyncChanges `gorm:"type:jsonb;not null;default:'[]'" json:"changes,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// TableName specifies the table name
+func (LDAPSyncRun) TableName() string {
+	return "ldap_sync_runs"
+}
+
+// SetupLDAPTables sets up the LDAP sync run table
+func SetupLDAPTables(db *gorm.DB) error {
+	return db.AutoMigrate(&LDAPSyncRun{}).Error
+}
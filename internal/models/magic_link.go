@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MagicLinkTokenKind is the prefix of the tokens emailed in magic links
+const MagicLinkTokenKind = "ml"
+
+// MagicLink is a single-use sign-in link emailed to a user. Used and expired
+// links are kept for a while, since they count towards the email's rate limit.
+type MagicLink struct {
+	ID        uint   `gorm:"primary_key"`
+	TokenHash string `gorm:"size:64;not null;unique_index"`
+	UserID    uint   `gorm:"not null;index"`
+	// BindingHash is the hash of the nonce the requesting browser must present, empty when unbound
+	BindingHash string    `gorm:"size:64"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	UsedAt      *time.Time
+	CreatedAt   time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name
+func (MagicLink) TableName() string {
+	return "magic_links"
+}
+
+// SetupMagicLinkTable sets up the magic link table
+func SetupMagicLinkTable(db *gorm.DB) error {
+	return db.AutoMigrate(&MagicLink{}).Error
+}
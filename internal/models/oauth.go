@@ -0,0 +1,196 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// OAuth credential prefixes
+const (
+	OAuthClientSecretKind = "oauthsecret"
+	OAuthCodeKind         = "code"
+	OAuthRefreshTokenKind = "rt"
+	OAuthDeviceCodeKind   = "dc"
+)
+
+// OpenID Connect scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// IsValidOAuthScope reports whether scope may be requested by an OAuth client
+func IsValidOAuthScope(scope string) bool {
+	switch scope {
+	case ScopeOpenID, ScopeProfile, ScopeEmail:
+		return true
+	}
+	return IsValidTokenScope(scope)
+}
+
+// OAuthClient is an application that signs users in through the authorization
+// server. Public clients (browser and mobile apps) have no secret and rely on PKCE.
+type OAuthClient struct {
+	ID                     uint           `gorm:"primary_key" json:"-"`
+	PublicID               string         `gorm:"size:36;unique_index" json:"client_id"`
+	Name                   string         `gorm:"size:100;not null" json:"name"`
+	RedirectURIs           pq.StringArray `gorm:"type:text[];not null" json:"redirect_uris"`
+	PostLogoutRedirectURIs pq.StringArray `gorm:"type:text[]" json:"post_logout_redirect_uris"`
+	Scopes                 pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	Public                 bool           `gorm:"not null;default:false" json:"public"`
+	SecretPrefix           string         `gorm:"size:30" json:"secret_prefix,omitempty"`
+	SecretHash             string         `gorm:"size:64" json:"-"`
+	CreatedAt              time.Time      `json:"created_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	DeletedAt              *time.Time     `sql:"index" json:"-"`
+}
+
+// HasRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPostLogoutRedirectURI reports whether uri exactly matches a registered post-logout redirect URI
+func (c *OAuthClient) HasPostLogoutRedirectURI(uri string) bool {
+	for _, registered := range c.PostLogoutRedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the client may request scope
+func (c *OAuthClient) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TableName specifies the table name
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthAuthorizationCode is a single-use authorization code bound to a PKCE
+// challenge. Nonce and AuthTime are copied into the ID token it is exchanged for.
+type OAuthAuthorizationCode struct {
+	ID            uint           `gorm:"primary_key"`
+	PublicID      string         `gorm:"size:36;unique_index"`
+	CodeHash      string         `gorm:"size:64;not null;unique_index"`
+	ClientID      uint           `gorm:"not null;index"`
+	UserID        uint           `gorm:"not null;index"`
+	RedirectURI   string         `gorm:"size:2000;not null"`
+	Scopes        pq.StringArray `gorm:"type:text[];not null"`
+	CodeChallenge string         `gorm:"size:128;not null"`
+	Nonce         string         `gorm:"size:500"`
+	AuthTime      time.Time
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
+
+// TableName specifies the table name
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// OAuthRefreshToken is a refresh token issued to a client for a user. Tokens
+// are rotated on every use; every token descended from one authorization
+// code shares a FamilyID so that a replayed token can revoke the whole chain.
+type OAuthRefreshToken struct {
+	ID        uint           `gorm:"primary_key"`
+	TokenHash string         `gorm:"size:64;not null;unique_index"`
+	FamilyID  string         `gorm:"size:36;not null;index"`
+	ClientID  uint           `gorm:"not null;index"`
+	UserID    uint           `gorm:"not null;index"`
+	Scopes    pq.StringArray `gorm:"type:text[];not null"`
+	ExpiresAt time.Time      `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name
+func (OAuthRefreshToken) TableName() string {
+	return "oauth_refresh_tokens"
+}
+
+// Device authorization statuses
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeUsed     = "used"
+)
+
+// OAuthDeviceCode is an RFC 8628 device authorization. The device polls the
+// token endpoint with the device code while the user approves the request on
+// another device by entering the short user code. Tokens issued from it share
+// PublicID as their refresh token family.
+type OAuthDeviceCode struct {
+	ID             uint           `gorm:"primary_key"`
+	PublicID       string         `gorm:"size:36;unique_index"`
+	DeviceCodeHash string         `gorm:"size:64;not null;unique_index"`
+	UserCode       string         `gorm:"size:8;not null;index"`
+	ClientID       uint           `gorm:"not null;index"`
+	Scopes         pq.StringArray `gorm:"type:text[];not null"`
+	Status         string         `gorm:"size:20;not null"`
+	UserID         *uint
+	AuthTime       *time.Time
+	PollInterval   int `gorm:"not null"` // in seconds
+	LastPolledAt   *time.Time
+	ExpiresAt      time.Time `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// TableName specifies the table name
+func (OAuthDeviceCode) TableName() string {
+	return "oauth_device_codes"
+}
+
+// OAuthConsent records the scopes a user has allowed a client to access
+type OAuthConsent struct {
+	ID        uint           `gorm:"primary_key" json:"-"`
+	UserID    uint           `gorm:"not null;unique_index:uix_oauth_consents_user_client" json:"-"`
+	ClientID  uint           `gorm:"not null;unique_index:uix_oauth_consents_user_client" json:"-"`
+	Scopes    pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+
+	Client *OAuthClient `gorm:"-" json:"client,omitempty"`
+}
+
+// Covers reports whether the consent includes every scope in scopes
+func (c *OAuthConsent) Covers(scopes []string) bool {
+	granted := make(map[string]bool, len(c.Scopes))
+	for _, s := range c.Scopes {
+		granted[s] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// TableName specifies the table name
+func (OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
+
+// SetupOAuthTables sets up the OAuth client, code, device code, refresh token and consent tables
+func SetupOAuthTables(db *gorm.DB) error {
+	return db.AutoMigrate(&OAuthClient{}, &OAuthAuthorizationCode{}, &OAuthDeviceCode{}, &OAuthRefreshToken{}, &OAuthConsent{}).Error
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PasswordHistory records a password hash previously set by a user
+type PasswordHistory struct {
+	ID           uint      `gorm:"primary_key" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	PasswordHash string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Matches reports whether the password matches this history entry
+func (h *PasswordHistory) Matches(password string) bool {
+	ok, err := passwordHasher.Verify(h.PasswordHash, password)
+	return err == nil && ok
+}
+
+// TableName specifies the table name
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// SetupPasswordHistoryTable sets up the password history table
+func SetupPasswordHistoryTable(db *gorm.DB) error {
+	return db.AutoMigrate(&PasswordHistory{}).Error
+}
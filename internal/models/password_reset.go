@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PasswordResetTokenKind is the prefix of the tokens emailed in password reset links
+const PasswordResetTokenKind = "pr"
+
+// PasswordReset is a single-use link emailed to a user who forgot their
+// password. Used and expired links are kept for a while, since they count
+// towards the email's rate limit.
+type PasswordReset struct {
+	ID        uint      `gorm:"primary_key"`
+	TokenHash string    `gorm:"size:64;not null;unique_index"`
+	UserID    uint      `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name
+func (PasswordReset) TableName() string {
+	return "password_resets"
+}
+
+// SetupPasswordResetTable sets up the password reset table
+func SetupPasswordResetTable(db *gorm.DB) error {
+	return db.AutoMigrate(&PasswordReset{}).Error
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// PersonalAccessTokenKind is the prefix of every personal access token
+const PersonalAccessTokenKind = "pat"
+
+// Personal access token scopes
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeUsersRead    = "users:read"
+	ScopeUsersExport  = "users:export"
+	ScopeAdminUsers   = "admin:users"
+)
+
+// PersonalAccessTokenScopes lists every scope a personal access token may hold
+var PersonalAccessTokenScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeUsersRead,
+	ScopeUsersExport,
+	ScopeAdminUsers,
+}
+
+// IsValidTokenScope reports whether scope is a known personal access token scope
+func IsValidTokenScope(scope string) bool {
+	for _, s := range PersonalAccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken is a long-lived, scoped credential a user creates for automation.
+// Only the SHA-256 hash of the token is stored; Prefix identifies it to the user.
+type PersonalAccessToken struct {
+	ID         uint           `gorm:"primary_key" json:"-"`
+	PublicID   string         `gorm:"size:36;unique_index" json:"id"`
+	UserID     uint           `gorm:"not null;index" json:"-"`
+	Name       string         `gorm:"size:100;not null" json:"name"`
+	Prefix     string         `gorm:"size:20;not null" json:"prefix"`
+	TokenHash  string         `gorm:"size:64;not null;unique_index" json:"-"`
+	Scopes     pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	ExpiresAt  *time.Time     `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// Expired reports whether the token has passed its expiry time
+func (t *PersonalAccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// HasScope reports whether the token grants scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TableName specifies the table name
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// SetupPersonalAccessTokenTable sets up the personal access token table
+func SetupPersonalAccessTokenTable(db *gorm.DB) error {
+	return db.AutoMigrate(&PersonalAccessToken{}).Error
+}
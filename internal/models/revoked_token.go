@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RevokedToken records a JWT revoked before its expiry, identified by its
+// jti claim. Rows can be purged once the token would have expired anyway.
+type RevokedToken struct {
+	ID        uint      `gorm:"primary_key"`
+	TokenID   string    `gorm:"size:36;not null;unique_index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// SetupRevokedTokenTable sets up the revoked token table
+func SetupRevokedTokenTable(db *gorm.DB) error {
+	return db.AutoMigrate(&RevokedToken{}).Error
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SAMLRequest records an authentication request sent to a SAML identity
+// provider. The response must answer a stored request, which is consumed by
+// it, so each response is accepted once.
+type SAMLRequest struct {
+	ID         uint      `gorm:"primary_key"`
+	RequestID  string    `gorm:"size:64;not null;unique_index"`
+	Connection string    `gorm:"size:50;not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time
+}
+
+// TableName specifies the table name
+func (SAMLRequest) TableName() string {
+	return "saml_requests"
+}
+
+// SetupSAMLTables sets up the SAML request table
+func SetupSAMLTables(db *gorm.DB) error {
+	return db.AutoMigrate(&SAMLRequest{}).Error
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SCIMTokenKind is the prefix of every SCIM bearer token
+const SCIMTokenKind = "scim"
+
+// SCIMToken is the bearer credential a tenant's identity provider uses to
+// provision users and groups over SCIM. Only the SHA-256 hash of the token is
+// stored; Prefix identifies it to administrators.
+type SCIMToken struct {
+	ID        uint      `gorm:"primary_key" json:"-"`
+	PublicID  string    `gorm:"size:36;unique_index" json:"id"`
+	Tenant    string    `gorm:"size:40;not null;index" json:"tenant"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Prefix    string    `gorm:"size:20;not null" json:"prefix"`
+	TokenHash string    `gorm:"size:64;not null;unique_index" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (SCIMToken) TableName() string {
+	return "scim_tokens"
+}
+
+// SetupSCIMTables sets up the SCIM token table
+func SetupSCIMTables(db *gorm.DB) error {
+	return db.AutoMigrate(&SCIMToken{}).Error
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// ServiceAccountSecretKind is the prefix of every service account client secret
+const ServiceAccountSecretKind = "svcsecret"
+
+// ServiceAccountScopes lists the scopes a service account may be granted.
+// Service accounts have no profile, so only directory scopes apply.
+var ServiceAccountScopes = []string{
+	ScopeUsersRead,
+	ScopeUsersExport,
+}
+
+// IsValidServiceAccountScope reports whether scope may be granted to a service account
+func IsValidServiceAccountScope(scope string) bool {
+	for _, s := range ServiceAccountScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceAccount is a non-human identity used by backend services.
+// Its public ID doubles as the OAuth2 client ID.
+type ServiceAccount struct {
+	ID          uint           `gorm:"primary_key" json:"-"`
+	PublicID    string         `gorm:"size:36;unique_index" json:"client_id"`
+	Name        string         `gorm:"size:100;not null" json:"name"`
+	Description string         `gorm:"size:500" json:"description"`
+	Scopes      pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	Disabled    bool           `gorm:"not null;default:false" json:"disabled"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   *time.Time     `sql:"index" json:"-"`
+}
+
+// HasScope reports whether the service account is granted scope
+func (a *ServiceAccount) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TableName specifies the table name
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// ServiceAccountSecret is a client secret of a service account. Only its
+// SHA-256 hash is stored. Rotated secrets stay valid until ExpiresAt.
+type ServiceAccountSecret struct {
+	ID               uint       `gorm:"primary_key" json:"-"`
+	PublicID         string     `gorm:"size:36;unique_index" json:"id"`
+	ServiceAccountID uint       `gorm:"not null;index" json:"-"`
+	Prefix           string     `gorm:"size:30;not null" json:"prefix"`
+	SecretHash       string     `gorm:"size:64;not null;unique_index" json:"-"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Expired reports whether the secret can no longer be used
+func (s *ServiceAccountSecret) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// TableName specifies the table name
+func (ServiceAccountSecret) TableName() string {
+	return "service_account_secrets"
+}
+
+// SetupServiceAccountTables sets up the service account and secret tables
+func SetupServiceAccountTables(db *gorm.DB) error {
+	return db.AutoMigrate(&ServiceAccount{}, &ServiceAccountSecret{}).Error
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Session represents a logged-in device or client of a user
+type Session struct {
+	ID         uint       `gorm:"primary_key" json:"-"`
+	PublicID   string     `gorm:"size:36;unique_index" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	UserAgent  string     `gorm:"size:500" json:"user_agent"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+
+	// Current marks the session the request was made with
+	Current bool `gorm:"-" json:"current"`
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// TableName specifies the table name
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// SetupSessionTable sets up the session table
+func SetupSessionTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Session{}).Error
+}
@@ -2,41 +2,145 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// User represents a user in the system
+// passwordHasher is used by the User hooks to hash and verify passwords
+var passwordHasher utils.PasswordHasher = utils.NewBcryptHasher(bcrypt.DefaultCost)
+
+// SetPasswordHasher sets the hasher used for user passwords
+func SetPasswordHasher(hasher utils.PasswordHasher) {
+	passwordHasher = hasher
+}
+
+// NormalizeEmail returns the canonical form of an email used for lookups,
+// lowercasing the local part when foldLocalPart is set. Addresses that cannot
+// be parsed fall back to their trimmed lowercase form.
+func NormalizeEmail(email string, foldLocalPart bool) string {
+	normalized, err := utils.NormalizeEmail(email, foldLocalPart)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+	return normalized
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User represents a user in the system.
+// ID is the internal primary key; PublicID is the identifier exposed in the
+// API and tokens, and EmailNormalized is the canonical email used for lookups.
 type User struct {
-	ID        uint       `gorm:"primary_key" json:"id"`
-	Name      string     `gorm:"size:100;not null" json:"name"`
-	Email     string     `gorm:"size:100;not null;unique" json:"email"`
-	Password  string     `gorm:"size:100;not null" json:"-"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `sql:"index" json:"-"`
+	ID              uint       `gorm:"primary_key" json:"-"`
+	PublicID        string     `gorm:"size:36" json:"id"`
+	Name            string     `gorm:"size:100;not null" json:"name"`
+	Email           string     `gorm:"size:100;not null;unique" json:"email"`
+	EmailNormalized string     `gorm:"size:255;index" json:"-"`
+	Password        string     `gorm:"size:255;not null" json:"-"`
+	Role            string     `gorm:"size:20;not null;default:'user'" json:"role"`
+	Attributes      Attributes `gorm:"type:jsonb;not null;default:'{}'" json:"attributes,omitempty"`
+	Status          string     `gorm:"size:20;not null;default:'active';index" json:"status"`
+	StatusUntil     *time.Time `json:"status_until,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `sql:"index" json:"-"`
+
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	TokensRevokedAt   *time.Time `json:"-"`
+
+	// Passwordless users were created at sign-in through an external identity
+	// provider and hold a random password nobody knows
+	Passwordless bool `gorm:"not null;default:false" json:"-"`
 }
 
-// BeforeSave hashes the password before saving
+// NewPublicID generates a new time-ordered public user identifier
+func NewPublicID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// BeforeCreate assigns a public ID to new users
+func (u *User) BeforeCreate() error {
+	if u.PublicID == "" {
+		u.PublicID = NewPublicID()
+	}
+	return nil
+}
+
+// BeforeSave checks the password before saving. Passwords are only hashed
+// by SetPassword, so a password that is not a hash is refused rather than
+// stored as it was given.
 func (u *User) BeforeSave() error {
 	if len(u.Password) == 0 {
 		return errors.New("password cannot be empty")
 	}
+	if !utils.IsPasswordHash(u.Password) {
+		return errors.New("password must be set with SetPassword")
+	}
+	return nil
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+// SetPassword hashes the password with the current hasher and stores it
+func (u *User) SetPassword(password string) error {
+	hashedPassword, err := passwordHasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
 
 // ValidatePassword validates the user's password
 func (u *User) ValidatePassword(password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+	ok, err := passwordHasher.Verify(u.Password, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("password mismatch")
+	}
+	return nil
+}
+
+// PasswordExpired reports whether the password is older than maxAge.
+// Passwords set before change dates were recorded never expire until their
+// age starts being tracked at the next login.
+func (u *User) PasswordExpired(maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 || u.PasswordChangedAt == nil {
+		return false
+	}
+	return now.Sub(*u.PasswordChangedAt) > maxAge
+}
+
+// PasswordNeedsRehash reports whether the stored hash uses an outdated algorithm or parameters
+func (u *User) PasswordNeedsRehash() bool {
+	return passwordHasher.NeedsRehash(u.Password)
+}
+
+// EffectiveStatus returns the user's status, treating a suspension or lock
+// whose automatic reactivation time has passed as active
+func (u *User) EffectiveStatus(now time.Time) string {
+	if (u.Status == StatusSuspended || u.Status == StatusLocked) && u.StatusUntil != nil && !now.Before(*u.StatusUntil) {
+		return StatusActive
+	}
+	if u.Status == "" {
+		return StatusActive
+	}
+	return u.Status
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // TableName specifies the table name
@@ -46,5 +150,117 @@ func (User) TableName() string {
 
 // SetupUserTable sets up the user table
 func SetupUserTable(db *gorm.DB) error {
-	return db.AutoMigrate(&User{}).Error
+	if err := db.AutoMigrate(&User{}).Error; err != nil {
+		return err
+	}
+
+	// Widen the password column for PHC-format hashes on existing databases
+	if err := db.Model(&User{}).ModifyColumn("password", "varchar(255)").Error; err != nil {
+		return err
+	}
+
+	// Index custom attributes for filtering and uniqueness checks
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_users_attributes ON users USING GIN (attributes)").Error
+}
+
+// MigratePublicIDs assigns a public ID to every user that lacks one and adds
+// a unique index on the column
+func MigratePublicIDs(db *gorm.DB) error {
+	var ids []uint
+	if err := db.Unscoped().Model(&User{}).Where("public_id IS NULL OR public_id = ''").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := db.Unscoped().Model(&User{}).Where("id = ?", id).UpdateColumn("public_id", NewPublicID()).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&User{}).AddUniqueIndex("uix_users_public_id", "public_id").Error
+}
+
+// EmailCollision describes existing accounts whose emails normalize to the same identity
+type EmailCollision struct {
+	EmailNormalized string
+	UserIDs         []uint
+}
+
+// MigrateNormalizedEmails backfills EmailNormalized for every user (including
+// soft-deleted ones), folding local parts when foldLocalPart is set, and adds
+// a unique index on it. If existing accounts collide
+// the unique index is not created and the collisions are returned for review.
+func MigrateNormalizedEmails(db *gorm.DB, foldLocalPart bool) ([]EmailCollision, error) {
+	rows, err := db.Unscoped().Model(&User{}).Select("id, email, email_normalized").Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		id         uint
+		normalized string
+	}
+	var updates []pending
+	for rows.Next() {
+		var id uint
+		var email string
+		var current *string
+		if err := rows.Scan(&id, &email, &current); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if normalized := NormalizeEmail(email, foldLocalPart); current == nil || *current != normalized {
+			updates = append(updates, pending{id: id, normalized: normalized})
+		}
+	}
+	rows.Close()
+
+	for _, u := range updates {
+		if err := db.Unscoped().Model(&User{}).Where("id = ?", u.id).UpdateColumn("email_normalized", u.normalized).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	collisions, err := findEmailCollisions(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(collisions) > 0 {
+		return collisions, nil
+	}
+
+	return nil, db.Model(&User{}).AddUniqueIndex("uix_users_email_normalized", "email_normalized").Error
+}
+
+// findEmailCollisions lists normalized emails shared by more than one user
+func findEmailCollisions(db *gorm.DB) ([]EmailCollision, error) {
+	rows, err := db.Unscoped().Model(&User{}).
+		Select("email_normalized, id").
+		Where("email_normalized IN ?", db.Unscoped().Model(&User{}).
+			Select("email_normalized").
+			Group("email_normalized").
+			Having("COUNT(*) > 1").
+			SubQuery()).
+		Order("email_normalized, id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collisions []EmailCollision
+	for rows.Next() {
+		var normalized string
+		var id uint
+		if err := rows.Scan(&normalized, &id); err != nil {
+			return nil, err
+		}
+		if n := len(collisions); n > 0 && collisions[n-1].EmailNormalized == normalized {
+			collisions[n-1].UserIDs = append(collisions[n-1].UserIDs, id)
+			continue
+		}
+		collisions = append(collisions, EmailCollision{EmailNormalized: normalized, UserIDs: []uint{id}})
+	}
+
+	return collisions, rows.Err()
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// User account statuses
+const (
+	StatusPending     = "pending"
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"
+	StatusLocked      = "locked"
+	StatusDeactivated = "deactivated"
+)
+
+// statusTransitions lists the statuses each status may move to
+var statusTransitions = map[string][]string{
+	StatusPending:     {StatusActive, StatusDeactivated},
+	StatusActive:      {StatusSuspended, StatusLocked, StatusDeactivated},
+	StatusSuspended:   {StatusActive, StatusDeactivated},
+	StatusLocked:      {StatusActive, StatusDeactivated},
+	StatusDeactivated: {StatusActive},
+}
+
+// IsValidStatus reports whether the status is known
+func IsValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether a user may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UserStatusTransition records a change to a user's account status
+type UserStatusTransition struct {
+	ID         uint       `gorm:"primary_key" json:"-"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	FromStatus string     `gorm:"size:20;not null" json:"from_status"`
+	ToStatus   string     `gorm:"size:20;not null" json:"to_status"`
+	Reason     string     `gorm:"size:500" json:"reason,omitempty"`
+	ActorID    string     `gorm:"size:36" json:"actor_id,omitempty"` // public ID of the admin, empty for system changes
+	Until      *time.Time `json:"until,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name
+func (UserStatusTransition) TableName() string {
+	return "user_status_transitions"
+}
+
+// SetupUserStatusTransitionTable sets up the user status transition table
+func SetupUserStatusTransitionTable(db *gorm.DB) error {
+	return db.AutoMigrate(&UserStatusTransition{}).Error
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// Purposes of WebAuthn ceremonies
+const (
+	WebAuthnRegistration     = "registration"
+	WebAuthnLogin            = "login"              // passwordless sign-in with a discoverable credential
+	WebAuthnSecondFactor     = "second_factor"      // completes a password login
+	WebAuthnLinkSecondFactor = "link_second_factor" // completes a magic link sign-in
+	WebAuthnReauthentication = "reauthentication"   // confirms a signed-in user's identity
+)
+
+// WebAuthnCredential is a passkey or security key registered to a user
+type WebAuthnCredential struct {
+	ID       uint   `gorm:"primary_key" json:"-"`
+	PublicID string `gorm:"size:36;unique_index" json:"id"`
+	UserID   uint   `gorm:"not null;index" json:"-"`
+	Name     string `gorm:"size:100;not null" json:"name"`
+	// CredentialID is the base64url credential ID the authenticator chose
+	CredentialID string `gorm:"size:1400;not null;unique_index" json:"credential_id"`
+	// PublicKey is the credential's COSE_Key
+	PublicKey         []byte         `gorm:"not null" json:"-"`
+	SignCount         int64          `gorm:"not null;default:0" json:"sign_count"`
+	AAGUID            string         `gorm:"size:36" json:"aaguid"`
+	Transports        pq.StringArray `gorm:"type:text[]" json:"transports"`
+	AttestationFormat string         `gorm:"size:20;not null" json:"attestation_format"`
+	AttestationType   string         `gorm:"size:20;not null" json:"attestation_type"`
+	BackupEligible    bool           `gorm:"not null;default:false" json:"backup_eligible"`
+	BackedUp          bool           `gorm:"not null;default:false" json:"backed_up"`
+	LastUsedAt        *time.Time     `json:"last_used_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// TableName specifies the table name
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnChallenge is an outstanding WebAuthn ceremony. Completing the
+// ceremony consumes it, so each challenge is answered once.
+type WebAuthnChallenge struct {
+	ID       uint   `gorm:"primary_key"`
+	PublicID string `gorm:"size:36;not null;unique_index"`
+	Purpose  string `gorm:"size:20;not null"`
+	// UserID is the user the ceremony is for, 0 for passwordless sign-in where the credential names the user
+	UserID                   uint      `gorm:"not null;default:0"`
+	Challenge                string    `gorm:"size:64;not null"`
+	UserVerificationRequired bool      `gorm:"not null;default:false"`
+	ExpiresAt                time.Time `gorm:"not null;index"`
+	CreatedAt                time.Time
+}
+
+// TableName specifies the table name
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
+
+// SetupWebAuthnTables sets up the WebAuthn credential and challenge tables
+func SetupWebAuthnTables(db *gorm.DB) error {
+	return db.AutoMigrate(&WebAuthnCredential{}, &WebAuthnChallenge{}).Error
+}
@@ -0,0 +1,332 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrGroupNotFound is returned when no group matches a lookup
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrGroupMemberNotFound is returned when a user is not a member of a group
+var ErrGroupMemberNotFound = errors.New("group member not found")
+
+// GroupRepository defines the interface for group repository
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	FindByID(ctx context.Context, id uint) (*models.Group, error)
+	FindByPublicID(ctx context.Context, publicID string) (*models.Group, error)
+	List(ctx context.Context, filter GroupFilter, offset, limit int) ([]models.Group, int64, error)
+	Update(ctx context.Context, group *models.Group) error
+	Delete(ctx context.Context, id uint) error
+	CountChildren(ctx context.Context, id uint) (int64, error)
+	DescendantIDs(ctx context.Context, id uint) ([]uint, error)
+	ListMembers(ctx context.Context, groupID uint) ([]models.User, error)
+	ListMemberships(ctx context.Context, groupID uint) ([]models.GroupMembership, error)
+	FindMember(ctx context.Context, groupID, userID uint) (*models.GroupMember, error)
+	SetMember(ctx context.Context, groupID, userID uint, role string) error
+	AddMembers(ctx context.Context, groupID uint, userIDs []uint) error
+	RemoveMembers(ctx context.Context, groupID uint, userIDs []uint) error
+	ListUserGroups(ctx context.Context, userID uint) ([]models.Group, error)
+}
+
+// GroupFilter holds optional criteria used when listing groups
+type GroupFilter struct {
+	Provider   string // exact match; groups of every provider are listed when empty
+	Name       string
+	ExternalID string
+	Local      bool // only groups managed here, overriding Provider
+}
+
+// apply narrows the query according to the filter
+func (f GroupFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Local {
+		db = db.Where("provider = ''")
+	} else if f.Provider != "" {
+		db = db.Where("provider = ?", f.Provider)
+	}
+	if f.Name != "" {
+		db = db.Where("name = ?", f.Name)
+	}
+	if f.ExternalID != "" {
+		db = db.Where("external_id = ?", f.ExternalID)
+	}
+	return db
+}
+
+// GroupRepositoryImpl handles database interactions for groups
+type GroupRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewGroupRepository creates a new group repository
+func NewGroupRepository(db *gorm.DB, logger *utils.Logger) *GroupRepositoryImpl {
+	return &GroupRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a new group
+func (r *GroupRepositoryImpl) Create(ctx context.Context, group *models.Group) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(group).Error; err != nil {
+		log.WithError(err).Error("Failed to create group")
+		return err
+	}
+
+	log.WithField("group_id", group.ID).Info("Group created successfully")
+	return nil
+}
+
+// FindByID finds a group by ID
+func (r *GroupRepositoryImpl) FindByID(ctx context.Context, id uint) (*models.Group, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var group models.Group
+	if err := r.DB.First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		log.WithError(err).Error("Failed to find group")
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// FindByPublicID finds a group by public ID
+func (r *GroupRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.Group, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var group models.Group
+	if err := r.DB.Where("public_id = ?", publicID).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		log.WithError(err).Error("Failed to find group")
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// List returns a page of groups matching the filter
+func (r *GroupRepositoryImpl) List(ctx context.Context, filter GroupFilter, offset, limit int) ([]models.Group, int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var groups []models.Group
+	var count int64
+
+	query := filter.apply(r.DB.Model(&models.Group{}))
+
+	if err := query.Count(&count).Error; err != nil {
+		log.WithError(err).Error("Failed to count groups")
+		return nil, 0, err
+	}
+
+	if err := query.Order("id").Offset(offset).Limit(limit).Find(&groups).Error; err != nil {
+		log.WithError(err).Error("Failed to list groups")
+		return nil, 0, err
+	}
+
+	return groups, count, nil
+}
+
+// Update updates a group
+func (r *GroupRepositoryImpl) Update(ctx context.Context, group *models.Group) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(group).Error; err != nil {
+		log.WithError(err).WithField("group_id", group.ID).Error("Failed to update group")
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes a group and its memberships
+func (r *GroupRepositoryImpl) Delete(ctx context.Context, id uint) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin group transaction")
+		return tx.Error
+	}
+
+	if err := tx.Where("group_id = ?", id).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to delete group members")
+		return err
+	}
+
+	if err := tx.Delete(&models.Group{}, id).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to delete group")
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	log.WithField("group_id", id).Info("Group deleted successfully")
+	return nil
+}
+
+// CountChildren counts the groups nested directly in a group
+func (r *GroupRepositoryImpl) CountChildren(ctx context.Context, id uint) (int64, error) {
+	var count int64
+	if err := r.DB.Model(&models.Group{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		r.Logger.WithContext(ctx).WithError(err).WithField("group_id", id).Error("Failed to count subgroups")
+		return 0, err
+	}
+	return count, nil
+}
+
+// descendantsQuery returns a query selecting the IDs of the group matching
+// condition and of every group nested in it
+func descendantsQuery(condition string) string {
+	return `WITH RECURSIVE tree AS (
+	SELECT id FROM groups WHERE ` + condition + `
+	UNION
+	SELECT groups.id FROM groups JOIN tree ON groups.parent_id = tree.id
+) SELECT id FROM tree`
+}
+
+// DescendantIDs returns the IDs of a group and of every group nested in it
+func (r *GroupRepositoryImpl) DescendantIDs(ctx context.Context, id uint) ([]uint, error) {
+	var rows []struct{ ID uint }
+	if err := r.DB.Raw(descendantsQuery("id = ?"), id).Scan(&rows).Error; err != nil {
+		r.Logger.WithContext(ctx).WithError(err).WithField("group_id", id).Error("Failed to list subgroups")
+		return nil, err
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ids, nil
+}
+
+// ListMembers lists the users in a group
+func (r *GroupRepositoryImpl) ListMembers(ctx context.Context, groupID uint) ([]models.User, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var users []models.User
+	if err := r.DB.Joins("JOIN group_members ON group_members.user_id = users.id").
+		Where("group_members.group_id = ?", groupID).
+		Order("users.id").
+		Find(&users).Error; err != nil {
+		log.WithError(err).WithField("group_id", groupID).Error("Failed to list group members")
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ListMemberships lists the members of a group with their roles
+func (r *GroupRepositoryImpl) ListMemberships(ctx context.Context, groupID uint) ([]models.GroupMembership, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var memberships []models.GroupMembership
+	if err := r.DB.Table("group_members").
+		Select("users.public_id AS user_id, users.name, users.email, group_members.role, group_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+		Where("group_members.group_id = ?", groupID).
+		Order("users.id").
+		Scan(&memberships).Error; err != nil {
+		log.WithError(err).WithField("group_id", groupID).Error("Failed to list group memberships")
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// FindMember finds a user's membership of a group
+func (r *GroupRepositoryImpl) FindMember(ctx context.Context, groupID, userID uint) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := r.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupMemberNotFound
+		}
+		r.Logger.WithContext(ctx).WithError(err).WithField("group_id", groupID).Error("Failed to find group member")
+		return nil, err
+	}
+	return &member, nil
+}
+
+// SetMember adds a user to a group with a role, or changes the role of a member
+func (r *GroupRepositoryImpl) SetMember(ctx context.Context, groupID, userID uint, role string) error {
+	if err := r.DB.Exec("INSERT INTO group_members (group_id, user_id, role, created_at) VALUES (?, ?, ?, ?) "+
+		"ON CONFLICT (group_id, user_id) DO UPDATE SET role = EXCLUDED.role", groupID, userID, role, time.Now()).Error; err != nil {
+		r.Logger.WithContext(ctx).WithError(err).WithField("group_id", groupID).Error("Failed to set group member")
+		return err
+	}
+	return nil
+}
+
+// AddMembers adds users to a group, ignoring those who are already members
+func (r *GroupRepositoryImpl) AddMembers(ctx context.Context, groupID uint, userIDs []uint) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin group transaction")
+		return tx.Error
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		if err := tx.Exec("INSERT INTO group_members (group_id, user_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+			groupID, userID, now).Error; err != nil {
+			tx.Rollback()
+			log.WithError(err).WithField("group_id", groupID).Error("Failed to add group members")
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// RemoveMembers removes users from a group
+func (r *GroupRepositoryImpl) RemoveMembers(ctx context.Context, groupID uint, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Where("group_id = ? AND user_id IN (?)", groupID, userIDs).Delete(&models.GroupMember{}).Error; err != nil {
+		log.WithError(err).WithField("group_id", groupID).Error("Failed to remove group members")
+		return err
+	}
+
+	return nil
+}
+
+// ListUserGroups lists the groups a user is a member of, directly or through
+// a nested group
+func (r *GroupRepositoryImpl) ListUserGroups(ctx context.Context, userID uint) ([]models.Group, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var groups []models.Group
+	if err := r.DB.Raw(`WITH RECURSIVE effective AS (
+		SELECT groups.* FROM groups JOIN group_members ON group_members.group_id = groups.id WHERE group_members.user_id = ?
+		UNION
+		SELECT groups.* FROM groups JOIN effective ON groups.id = effective.parent_id
+	) SELECT * FROM effective ORDER BY id`, userID).Scan(&groups).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list user groups")
+		return nil, err
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrIdentityNotFound is returned when no linked identity matches a lookup
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// ErrLinkRequestNotFound is returned when no unexpired link request matches a token
+var ErrLinkRequestNotFound = errors.New("link request not found")
+
+// IdentityRepository defines the interface for linked external identities
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *models.Identity) error
+	FindBySubject(ctx context.Context, provider, subject string) (*models.Identity, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.Identity, error)
+	ListByProvider(ctx context.Context, provider string) ([]models.Identity, error)
+	Update(ctx context.Context, identity *models.Identity) error
+	Delete(ctx context.Context, userID uint, publicID string) error
+	UpdateLastLogin(ctx context.Context, id uint, now time.Time) error
+	CreateLinkRequest(ctx context.Context, request *models.FederatedLinkRequest) error
+	ConsumeLinkRequest(ctx context.Context, hash string, now time.Time) (*models.FederatedLinkRequest, error)
+}
+
+// IdentityRepositoryImpl handles database interactions for linked identities
+type IdentityRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewIdentityRepository creates a new identity repository
+func NewIdentityRepository(db *gorm.DB, logger *utils.Logger) *IdentityRepositoryImpl {
+	return &IdentityRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create links a new identity
+func (r *IdentityRepositoryImpl) Create(ctx context.Context, identity *models.Identity) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(identity).Error; err != nil {
+		log.WithError(err).WithField("user_id", identity.UserID).Error("Failed to create identity")
+		return err
+	}
+
+	return nil
+}
+
+// FindBySubject finds the identity a provider knows by subject
+func (r *IdentityRepositoryImpl) FindBySubject(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var identity models.Identity
+	if err := r.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentityNotFound
+		}
+		log.WithError(err).Error("Failed to find identity")
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// ListByUser lists the identities linked to a user
+func (r *IdentityRepositoryImpl) ListByUser(ctx context.Context, userID uint) ([]models.Identity, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var identities []models.Identity
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list identities")
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// ListByProvider lists every identity of a provider
+func (r *IdentityRepositoryImpl) ListByProvider(ctx context.Context, provider string) ([]models.Identity, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var identities []models.Identity
+	if err := r.DB.Where("provider = ?", provider).Order("id").Find(&identities).Error; err != nil {
+		log.WithError(err).WithField("provider", provider).Error("Failed to list identities")
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Update updates an identity
+func (r *IdentityRepositoryImpl) Update(ctx context.Context, identity *models.Identity) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(identity).Error; err != nil {
+		log.WithError(err).WithField("user_id", identity.UserID).Error("Failed to update identity")
+		return err
+	}
+
+	return nil
+}
+
+// Delete unlinks one of a user's identities
+func (r *IdentityRepositoryImpl) Delete(ctx context.Context, userID uint, publicID string) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("user_id = ? AND public_id = ?", userID, publicID).Delete(&models.Identity{})
+	if result.Error != nil {
+		log.WithError(result.Error).WithField("user_id", userID).Error("Failed to delete identity")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+
+	return nil
+}
+
+// UpdateLastLogin records a login through an identity
+func (r *IdentityRepositoryImpl) UpdateLastLogin(ctx context.Context, id uint, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Model(&models.Identity{}).Where("id = ?", id).UpdateColumn("last_login_at", now).Error; err != nil {
+		log.WithError(err).Error("Failed to update identity last login")
+		return err
+	}
+
+	return nil
+}
+
+// CreateLinkRequest stores a pending identity link
+func (r *IdentityRepositoryImpl) CreateLinkRequest(ctx context.Context, request *models.FederatedLinkRequest) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(request).Error; err != nil {
+		log.WithError(err).WithField("user_id", request.UserID).Error("Failed to create link request")
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeLinkRequest deletes and returns the unexpired link request with a token hash,
+// so each request can be confirmed only once
+func (r *IdentityRepositoryImpl) ConsumeLinkRequest(ctx context.Context, hash string, now time.Time) (*models.FederatedLinkRequest, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var request models.FederatedLinkRequest
+	if err := r.DB.Where("token_hash = ? AND expires_at > ?", hash, now).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLinkRequestNotFound
+		}
+		log.WithError(err).Error("Failed to find link request")
+		return nil, err
+	}
+
+	// The conditional delete makes concurrent confirmations of one request exclusive
+	result := r.DB.Where("id = ?", request.ID).Delete(&models.FederatedLinkRequest{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to consume link request")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLinkRequestNotFound
+	}
+
+	return &request, nil
+}
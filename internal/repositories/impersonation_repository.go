@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrImpersonationNotFound is returned when no impersonation matches a lookup
+var ErrImpersonationNotFound = errors.New("impersonation not found")
+
+// ImpersonationRepository defines the interface for impersonations and their audit trail
+type ImpersonationRepository interface {
+	Create(ctx context.Context, impersonation *models.Impersonation) error
+	FindByPublicID(ctx context.Context, publicID string) (*models.Impersonation, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.Impersonation, error)
+	End(ctx context.Context, id uint, now time.Time) error
+	CreateEvent(ctx context.Context, event *models.ImpersonationEvent) error
+	ListEvents(ctx context.Context, impersonationID uint) ([]models.ImpersonationEvent, error)
+}
+
+// ImpersonationRepositoryImpl handles database interactions for impersonations
+type ImpersonationRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewImpersonationRepository creates a new impersonation repository
+func NewImpersonationRepository(db *gorm.DB, logger *utils.Logger) *ImpersonationRepositoryImpl {
+	return &ImpersonationRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create stores a new impersonation
+func (r *ImpersonationRepositoryImpl) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(impersonation).Error; err != nil {
+		log.WithError(err).WithField("user_id", impersonation.UserID).Error("Failed to create impersonation")
+		return err
+	}
+
+	return nil
+}
+
+// FindByPublicID finds an impersonation by its public ID
+func (r *ImpersonationRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.Impersonation, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var impersonation models.Impersonation
+	if err := r.DB.Where("public_id = ?", publicID).First(&impersonation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationNotFound
+		}
+		log.WithError(err).Error("Failed to find impersonation")
+		return nil, err
+	}
+
+	return &impersonation, nil
+}
+
+// ListByUser lists the impersonations of a user, newest first
+func (r *ImpersonationRepositoryImpl) ListByUser(ctx context.Context, userID uint) ([]models.Impersonation, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var impersonations []models.Impersonation
+	if err := r.DB.Where("user_id = ?", userID).Order("id DESC").Find(&impersonations).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list impersonations")
+		return nil, err
+	}
+
+	return impersonations, nil
+}
+
+// End marks an impersonation as ended, unless it already was
+func (r *ImpersonationRepositoryImpl) End(ctx context.Context, id uint, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.Impersonation{}).Where("id = ? AND ended_at IS NULL", id).UpdateColumn("ended_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to end impersonation")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrImpersonationNotFound
+	}
+
+	return nil
+}
+
+// CreateEvent stores a request made during an impersonation
+func (r *ImpersonationRepositoryImpl) CreateEvent(ctx context.Context, event *models.ImpersonationEvent) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(event).Error; err != nil {
+		log.WithError(err).WithField("impersonation_id", event.ImpersonationID).Error("Failed to create impersonation event")
+		return err
+	}
+
+	return nil
+}
+
+// ListEvents lists the requests made during an impersonation, oldest first
+func (r *ImpersonationRepositoryImpl) ListEvents(ctx context.Context, impersonationID uint) ([]models.ImpersonationEvent, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var events []models.ImpersonationEvent
+	if err := r.DB.Where("impersonation_id = ?", impersonationID).Order("id").Find(&events).Error; err != nil {
+		log.WithError(err).WithField("impersonation_id", impersonationID).Error("Failed to list impersonation events")
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrLDAPSyncRunNotFound is returned when no LDAP sync run matches a lookup
+var ErrLDAPSyncRunNotFound = errors.New("LDAP sync run not found")
+
+// LDAPSyncRunRepository defines the interface for LDAP sync run repository
+type LDAPSyncRunRepository interface {
+	Create(ctx context.Context, run *models.LDAPSyncRun) error
+	Update(ctx context.Context, run *models.LDAPSyncRun) error
+	FindByPublicID(ctx context.Context, publicID string) (*models.LDAPSyncRun, error)
+	List(ctx context.Context, directory string, limit int) ([]models.LDAPSyncRun, error)
+}
+
+// LDAPSyncRunRepositoryImpl handles database interactions for LDAP sync runs
+type LDAPSyncRunRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewLDAPSyncRunRepository creates a new LDAP sync run repository
+func NewLDAPSyncRunRepository(db *gorm.DB, logger *utils.Logger) *LDAPSyncRunRepositoryImpl {
+	return &LDAPSyncRunRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create records a new sync run
+func (r *LDAPSyncRunRepositoryImpl) Create(ctx context.Context, run *models.LDAPSyncRun) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(run).Error; err != nil {
+		log.WithError(err).WithField("directory", run.Directory).Error("Failed to create LDAP sync run")
+		return err
+	}
+
+	return nil
+}
+
+// Update updates a sync run
+func (r *LDAPSyncRunRepositoryImpl) Update(ctx context.Context, run *models.LDAPSyncRun) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(run).Error; err != nil {
+		log.WithError(err).WithField("directory", run.Directory).Error("Failed to update LDAP sync run")
+		return err
+	}
+
+	return nil
+}
+
+// FindByPublicID finds a sync run by its public ID
+func (r *LDAPSyncRunRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.LDAPSyncRun, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var run models.LDAPSyncRun
+	if err := r.DB.Where("public_id = ?", publicID).First(&run).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLDAPSyncRunNotFound
+		}
+		log.WithError(err).Error("Failed to find LDAP sync run")
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// List lists the most recent sync runs without their changes, optionally
+// only those of one directory
+func (r *LDAPSyncRunRepositoryImpl) List(ctx context.Context, directory string, limit int) ([]models.LDAPSyncRun, error) {
+	log := r.Logger.WithContext(ctx)
+
+	query := r.DB.Select("id, public_id, directory, dry_run, status, actor_id, entries, created, updated, " +
+		"deactivated, reactivated, conflicts, skipped, failed, error, started_at, finished_at").
+		Order("id desc").Limit(limit)
+	if directory != "" {
+		query = query.Where("directory = ?", directory)
+	}
+
+	var runs []models.LDAPSyncRun
+	if err := query.Find(&runs).Error; err != nil {
+		log.WithError(err).Error("Failed to list LDAP sync runs")
+		return nil, err
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrMagicLinkNotFound is returned when no unused magic link matches a token
+var ErrMagicLinkNotFound = errors.New("magic link not found")
+
+// MagicLinkRepository defines the interface for magic link data access
+type MagicLinkRepository interface {
+	Create(ctx context.Context, link *models.MagicLink) error
+	FindByTokenHash(ctx context.Context, hash string) (*models.MagicLink, error)
+	MarkUsed(ctx context.Context, id uint, now time.Time) error
+	CountSince(ctx context.Context, userID uint, since time.Time) (int, error)
+	DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// MagicLinkRepositoryImpl handles database interactions for magic links
+type MagicLinkRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewMagicLinkRepository creates a new magic link repository
+func NewMagicLinkRepository(db *gorm.DB, logger *utils.Logger) *MagicLinkRepositoryImpl {
+	return &MagicLinkRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create stores a magic link
+func (r *MagicLinkRepositoryImpl) Create(ctx context.Context, link *models.MagicLink) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(link).Error; err != nil {
+		log.WithError(err).WithField("user_id", link.UserID).Error("Failed to create magic link")
+		return err
+	}
+
+	return nil
+}
+
+// FindByTokenHash finds a magic link by the hash of its token
+func (r *MagicLinkRepositoryImpl) FindByTokenHash(ctx context.Context, hash string) (*models.MagicLink, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var link models.MagicLink
+	if err := r.DB.Where("token_hash = ?", hash).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMagicLinkNotFound
+		}
+		log.WithError(err).Error("Failed to find magic link")
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// MarkUsed marks an unused magic link as used. The conditional update makes
+// concurrent uses of one link exclusive.
+func (r *MagicLinkRepositoryImpl) MarkUsed(ctx context.Context, id uint, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.MagicLink{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to mark magic link used")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMagicLinkNotFound
+	}
+
+	return nil
+}
+
+// CountSince counts the magic links created for a user since a time
+func (r *MagicLinkRepositoryImpl) CountSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var count int
+	if err := r.DB.Model(&models.MagicLink{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error; err != nil {
+		log.WithError(err).Error("Failed to count magic links")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DeleteCreatedBefore deletes the magic links created before a time
+func (r *MagicLinkRepositoryImpl) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("created_at < ?", before).Delete(&models.MagicLink{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to delete old magic links")
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
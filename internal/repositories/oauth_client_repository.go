@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrOAuthClientNotFound is returned when no OAuth client matches a lookup
+var ErrOAuthClientNotFound = errors.New("oauth client not found")
+
+// OAuthClientRepository defines the interface for OAuth client repository
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *models.OAuthClient) error
+	FindByID(ctx context.Context, id uint) (*models.OAuthClient, error)
+	FindByPublicID(ctx context.Context, publicID string) (*models.OAuthClient, error)
+	List(ctx context.Context) ([]models.OAuthClient, error)
+	Update(ctx context.Context, client *models.OAuthClient) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// OAuthClientRepositoryImpl handles database interactions for OAuth clients
+type OAuthClientRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewOAuthClientRepository creates a new OAuth client repository
+func NewOAuthClientRepository(db *gorm.DB, logger *utils.Logger) *OAuthClientRepositoryImpl {
+	return &OAuthClientRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a new OAuth client
+func (r *OAuthClientRepositoryImpl) Create(ctx context.Context, client *models.OAuthClient) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(client).Error; err != nil {
+		log.WithError(err).Error("Failed to create OAuth client")
+		return err
+	}
+
+	log.WithField("client_id", client.PublicID).Info("OAuth client created")
+	return nil
+}
+
+// FindByID finds an OAuth client by internal ID
+func (r *OAuthClientRepositoryImpl) FindByID(ctx context.Context, id uint) (*models.OAuthClient, error) {
+	return r.find(ctx, "id = ?", id)
+}
+
+// FindByPublicID finds an OAuth client by client ID
+func (r *OAuthClientRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.OAuthClient, error) {
+	return r.find(ctx, "public_id = ?", publicID)
+}
+
+// find finds a single OAuth client matching the condition
+func (r *OAuthClientRepositoryImpl) find(ctx context.Context, query string, arg interface{}) (*models.OAuthClient, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var client models.OAuthClient
+	if err := r.DB.Where(query, arg).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthClientNotFound
+		}
+		log.WithError(err).Error("Failed to find OAuth client")
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// List lists all OAuth clients
+func (r *OAuthClientRepositoryImpl) List(ctx context.Context) ([]models.OAuthClient, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var clients []models.OAuthClient
+	if err := r.DB.Order("id").Find(&clients).Error; err != nil {
+		log.WithError(err).Error("Failed to list OAuth clients")
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// Update updates an OAuth client
+func (r *OAuthClientRepositoryImpl) Update(ctx context.Context, client *models.OAuthClient) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(client).Error; err != nil {
+		log.WithError(err).WithField("client_id", client.PublicID).Error("Failed to update OAuth client")
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes an OAuth client
+func (r *OAuthClientRepositoryImpl) Delete(ctx context.Context, id uint) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Delete(&models.OAuthClient{}, id).Error; err != nil {
+		log.WithError(err).Error("Failed to delete OAuth client")
+		return err
+	}
+
+	return nil
+}
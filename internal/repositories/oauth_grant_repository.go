@@ -0,0 +1,309 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrAuthorizationCodeNotFound is returned when no authorization code matches a lookup
+var ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+
+// ErrAuthorizationCodeUsed is returned, together with the code, when a code is presented twice
+var ErrAuthorizationCodeUsed = errors.New("authorization code already used")
+
+// ErrDeviceCodeNotFound is returned when no device authorization matches a lookup
+var ErrDeviceCodeNotFound = errors.New("device code not found")
+
+// ErrRefreshTokenNotFound is returned when no refresh token matches a lookup
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// ErrConsentNotFound is returned when a user has not authorized a client
+var ErrConsentNotFound = errors.New("consent not found")
+
+// OAuthGrantRepository defines the interface for authorization codes, device codes, refresh tokens and consents
+type OAuthGrantRepository interface {
+	CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, hash string, clientID uint, now time.Time) (*models.OAuthAuthorizationCode, error)
+	CreateDeviceCode(ctx context.Context, code *models.OAuthDeviceCode) error
+	FindDeviceCode(ctx context.Context, hash string) (*models.OAuthDeviceCode, error)
+	FindPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (*models.OAuthDeviceCode, error)
+	RecordDevicePoll(ctx context.Context, id uint, now time.Time, interval int) error
+	UpdateDeviceCodeStatus(ctx context.Context, code *models.OAuthDeviceCode, from string) (bool, error)
+	CreateRefreshToken(ctx context.Context, token *models.OAuthRefreshToken) error
+	FindRefreshToken(ctx context.Context, hash string) (*models.OAuthRefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id uint, now time.Time) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error
+	RevokeRefreshTokens(ctx context.Context, userID, clientID uint, now time.Time) error
+	FindConsent(ctx context.Context, userID, clientID uint) (*models.OAuthConsent, error)
+	SaveConsent(ctx context.Context, consent *models.OAuthConsent) error
+	ListConsents(ctx context.Context, userID uint) ([]models.OAuthConsent, error)
+	DeleteConsent(ctx context.Context, userID, clientID uint) error
+}
+
+// OAuthGrantRepositoryImpl handles database interactions for OAuth grants
+type OAuthGrantRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewOAuthGrantRepository creates a new OAuth grant repository
+func NewOAuthGrantRepository(db *gorm.DB, logger *utils.Logger) *OAuthGrantRepositoryImpl {
+	return &OAuthGrantRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// CreateAuthorizationCode stores a new authorization code
+func (r *OAuthGrantRepositoryImpl) CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(code).Error; err != nil {
+		log.WithError(err).Error("Failed to create authorization code")
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode marks a client's code as used and returns it. A
+// code that was already used is returned together with
+// ErrAuthorizationCodeUsed; codes issued to other clients are left untouched.
+func (r *OAuthGrantRepositoryImpl) ConsumeAuthorizationCode(ctx context.Context, hash string, clientID uint, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var code models.OAuthAuthorizationCode
+	if err := r.DB.Where("code_hash = ? AND client_id = ?", hash, clientID).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthorizationCodeNotFound
+		}
+		log.WithError(err).Error("Failed to find authorization code")
+		return nil, err
+	}
+
+	// The conditional update makes concurrent redemptions of one code exclusive
+	result := r.DB.Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", code.ID).
+		UpdateColumn("used_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to consume authorization code")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &code, ErrAuthorizationCodeUsed
+	}
+
+	code.UsedAt = &now
+	return &code, nil
+}
+
+// CreateDeviceCode stores a new device authorization
+func (r *OAuthGrantRepositoryImpl) CreateDeviceCode(ctx context.Context, code *models.OAuthDeviceCode) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(code).Error; err != nil {
+		log.WithError(err).Error("Failed to create device code")
+		return err
+	}
+
+	return nil
+}
+
+// FindDeviceCode finds a device authorization by the hash of its device code
+func (r *OAuthGrantRepositoryImpl) FindDeviceCode(ctx context.Context, hash string) (*models.OAuthDeviceCode, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var code models.OAuthDeviceCode
+	if err := r.DB.Where("device_code_hash = ?", hash).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceCodeNotFound
+		}
+		log.WithError(err).Error("Failed to find device code")
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// FindPendingDeviceCode finds the unexpired device authorization awaiting
+// approval with a user code. User codes are only unique among pending codes.
+func (r *OAuthGrantRepositoryImpl) FindPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (*models.OAuthDeviceCode, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var code models.OAuthDeviceCode
+	if err := r.DB.Where("user_code = ? AND status = ? AND expires_at > ?", userCode, models.DeviceCodePending, now).
+		First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeviceCodeNotFound
+		}
+		log.WithError(err).Error("Failed to find device code")
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// RecordDevicePoll records when a device last polled and the interval it must now respect
+func (r *OAuthGrantRepositoryImpl) RecordDevicePoll(ctx context.Context, id uint, now time.Time, interval int) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Model(&models.OAuthDeviceCode{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_polled_at": now, "poll_interval": interval}).Error; err != nil {
+		log.WithError(err).Error("Failed to record device poll")
+		return err
+	}
+
+	return nil
+}
+
+// UpdateDeviceCodeStatus saves the status, user and auth time of a device
+// authorization if it still has the status from. It reports false if
+// another request changed the status first.
+func (r *OAuthGrantRepositoryImpl) UpdateDeviceCodeStatus(ctx context.Context, code *models.OAuthDeviceCode, from string) (bool, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.OAuthDeviceCode{}).
+		Where("id = ? AND status = ?", code.ID, from).
+		UpdateColumns(map[string]interface{}{"status": code.Status, "user_id": code.UserID, "auth_time": code.AuthTime})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to update device code")
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *OAuthGrantRepositoryImpl) CreateRefreshToken(ctx context.Context, token *models.OAuthRefreshToken) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(token).Error; err != nil {
+		log.WithError(err).Error("Failed to create refresh token")
+		return err
+	}
+
+	return nil
+}
+
+// FindRefreshToken finds a refresh token by the hash of its value
+func (r *OAuthGrantRepositoryImpl) FindRefreshToken(ctx context.Context, hash string) (*models.OAuthRefreshToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var token models.OAuthRefreshToken
+	if err := r.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		log.WithError(err).Error("Failed to find refresh token")
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed revokes a refresh token that is being rotated. It
+// reports false if the token had already been revoked.
+func (r *OAuthGrantRepositoryImpl) MarkRefreshTokenUsed(ctx context.Context, id uint, now time.Time) (bool, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.OAuthRefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		UpdateColumn("revoked_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to mark refresh token used")
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token descended from one authorization
+func (r *OAuthGrantRepositoryImpl) RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Model(&models.OAuthRefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		UpdateColumn("revoked_at", now).Error; err != nil {
+		log.WithError(err).Error("Failed to revoke refresh token family")
+		return err
+	}
+
+	log.WithField("family_id", familyID).Warn("Refresh token family revoked")
+	return nil
+}
+
+// RevokeRefreshTokens revokes every refresh token a client holds for a user
+func (r *OAuthGrantRepositoryImpl) RevokeRefreshTokens(ctx context.Context, userID, clientID uint, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Model(&models.OAuthRefreshToken{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		UpdateColumn("revoked_at", now).Error; err != nil {
+		log.WithError(err).Error("Failed to revoke refresh tokens")
+		return err
+	}
+
+	return nil
+}
+
+// FindConsent finds the consent a user gave a client
+func (r *OAuthGrantRepositoryImpl) FindConsent(ctx context.Context, userID, clientID uint) (*models.OAuthConsent, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var consent models.OAuthConsent
+	if err := r.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConsentNotFound
+		}
+		log.WithError(err).Error("Failed to find consent")
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// SaveConsent creates or updates a consent
+func (r *OAuthGrantRepositoryImpl) SaveConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(consent).Error; err != nil {
+		log.WithError(err).WithField("user_id", consent.UserID).Error("Failed to save consent")
+		return err
+	}
+
+	return nil
+}
+
+// ListConsents lists every consent the user has given
+func (r *OAuthGrantRepositoryImpl) ListConsents(ctx context.Context, userID uint) ([]models.OAuthConsent, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var consents []models.OAuthConsent
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&consents).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list consents")
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// DeleteConsent deletes the consent a user gave a client
+func (r *OAuthGrantRepositoryImpl) DeleteConsent(ctx context.Context, userID, clientID uint) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.OAuthConsent{})
+	if result.Error != nil {
+		log.WithError(result.Error).WithField("user_id", userID).Error("Failed to delete consent")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConsentNotFound
+	}
+
+	return nil
+}
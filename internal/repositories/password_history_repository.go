@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// PasswordHistoryRepository defines the interface for password history repository
+type PasswordHistoryRepository interface {
+	Create(ctx context.Context, entry *models.PasswordHistory) error
+	ListRecent(ctx context.Context, userID uint, limit int) ([]models.PasswordHistory, error)
+	Prune(ctx context.Context, userID uint, keep int) error
+}
+
+// PasswordHistoryRepositoryImpl handles database interactions for password history
+type PasswordHistoryRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewPasswordHistoryRepository creates a new password history repository
+func NewPasswordHistoryRepository(db *gorm.DB, logger *utils.Logger) *PasswordHistoryRepositoryImpl {
+	return &PasswordHistoryRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create records a new password history entry
+func (r *PasswordHistoryRepositoryImpl) Create(ctx context.Context, entry *models.PasswordHistory) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(entry).Error; err != nil {
+		log.WithError(err).WithField("user_id", entry.UserID).Error("Failed to record password history")
+		return err
+	}
+
+	log.WithField("user_id", entry.UserID).Debug("Password history recorded")
+	return nil
+}
+
+// ListRecent returns the most recent password history entries for a user, newest first
+func (r *PasswordHistoryRepositoryImpl) ListRecent(ctx context.Context, userID uint, limit int) ([]models.PasswordHistory, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var entries []models.PasswordHistory
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at desc, id desc").Limit(limit).Find(&entries).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list password history")
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Prune deletes all but the newest keep entries for a user
+func (r *PasswordHistoryRepositoryImpl) Prune(ctx context.Context, userID uint, keep int) error {
+	log := r.Logger.WithContext(ctx)
+
+	keepIDs := r.DB.Model(&models.PasswordHistory{}).
+		Select("id").
+		Where("user_id = ?", userID).
+		Order("created_at desc, id desc").
+		Limit(keep).
+		SubQuery()
+
+	if err := r.DB.Where("user_id = ? AND id NOT IN ?", userID, keepIDs).Delete(&models.PasswordHistory{}).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to prune password history")
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"user_id": userID,
+		"keep":    keep,
+	}).Debug("Password history pruned")
+	return nil
+}
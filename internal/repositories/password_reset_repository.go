@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrPasswordResetNotFound is returned when no unused password reset link matches a token
+var ErrPasswordResetNotFound = errors.New("password reset link not found")
+
+// PasswordResetRepository defines the interface for password reset link data access
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	FindByTokenHash(ctx context.Context, hash string) (*models.PasswordReset, error)
+	MarkUsed(ctx context.Context, id uint, now time.Time) error
+	CountSince(ctx context.Context, userID uint, since time.Time) (int, error)
+	DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PasswordResetRepositoryImpl handles database interactions for password reset links
+type PasswordResetRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewPasswordResetRepository creates a new password reset link repository
+func NewPasswordResetRepository(db *gorm.DB, logger *utils.Logger) *PasswordResetRepositoryImpl {
+	return &PasswordResetRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create stores a password reset link
+func (r *PasswordResetRepositoryImpl) Create(ctx context.Context, reset *models.PasswordReset) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(reset).Error; err != nil {
+		log.WithError(err).WithField("user_id", reset.UserID).Error("Failed to create password reset")
+		return err
+	}
+
+	return nil
+}
+
+// FindByTokenHash finds a password reset link by the hash of its token
+func (r *PasswordResetRepositoryImpl) FindByTokenHash(ctx context.Context, hash string) (*models.PasswordReset, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var reset models.PasswordReset
+	if err := r.DB.Where("token_hash = ?", hash).First(&reset).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPasswordResetNotFound
+		}
+		log.WithError(err).Error("Failed to find password reset")
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// MarkUsed marks an unused password reset link as used. The conditional
+// update makes concurrent uses of one link exclusive.
+func (r *PasswordResetRepositoryImpl) MarkUsed(ctx context.Context, id uint, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.PasswordReset{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to mark password reset used")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPasswordResetNotFound
+	}
+
+	return nil
+}
+
+// CountSince counts the password reset links created for a user since a time
+func (r *PasswordResetRepositoryImpl) CountSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var count int
+	if err := r.DB.Model(&models.PasswordReset{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error; err != nil {
+		log.WithError(err).Error("Failed to count password resets")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DeleteCreatedBefore deletes the password reset links created before a time
+func (r *PasswordResetRepositoryImpl) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("created_at < ?", before).Delete(&models.PasswordReset{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to delete old password resets")
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrAccessTokenNotFound is returned when no personal access token matches a lookup
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// PersonalAccessTokenRepository defines the interface for personal access token repository
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error)
+	FindByPublicID(ctx context.Context, userID uint, publicID string) (*models.PersonalAccessToken, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	Update(ctx context.Context, token *models.PersonalAccessToken) error
+	Delete(ctx context.Context, userID uint, publicID string) error
+	UpdateLastUsed(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+// PersonalAccessTokenRepositoryImpl handles database interactions for personal access tokens
+type PersonalAccessTokenRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewPersonalAccessTokenRepository creates a new personal access token repository
+func NewPersonalAccessTokenRepository(db *gorm.DB, logger *utils.Logger) *PersonalAccessTokenRepositoryImpl {
+	return &PersonalAccessTokenRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a new personal access token
+func (r *PersonalAccessTokenRepositoryImpl) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(token).Error; err != nil {
+		log.WithError(err).WithField("user_id", token.UserID).Error("Failed to create access token")
+		return err
+	}
+
+	log.WithField("user_id", token.UserID).Debug("Access token created")
+	return nil
+}
+
+// FindByHash finds a personal access token by the hash of its value
+func (r *PersonalAccessTokenRepositoryImpl) FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var token models.PersonalAccessToken
+	if err := r.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAccessTokenNotFound
+		}
+		log.WithError(err).Error("Failed to find access token")
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// FindByPublicID finds one of the user's personal access tokens by public ID
+func (r *PersonalAccessTokenRepositoryImpl) FindByPublicID(ctx context.Context, userID uint, publicID string) (*models.PersonalAccessToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var token models.PersonalAccessToken
+	if err := r.DB.Where("user_id = ? AND public_id = ?", userID, publicID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAccessTokenNotFound
+		}
+		log.WithError(err).WithField("user_id", userID).Error("Failed to find access token")
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ListByUser lists the user's personal access tokens, newest first
+func (r *PersonalAccessTokenRepositoryImpl) ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var tokens []models.PersonalAccessToken
+	if err := r.DB.Where("user_id = ?", userID).Order("id desc").Find(&tokens).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list access tokens")
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Update updates a personal access token
+func (r *PersonalAccessTokenRepositoryImpl) Update(ctx context.Context, token *models.PersonalAccessToken) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(token).Error; err != nil {
+		log.WithError(err).WithField("user_id", token.UserID).Error("Failed to update access token")
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes one of the user's personal access tokens
+func (r *PersonalAccessTokenRepositoryImpl) Delete(ctx context.Context, userID uint, publicID string) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("user_id = ? AND public_id = ?", userID, publicID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		log.WithError(result.Error).WithField("user_id", userID).Error("Failed to delete access token")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+
+	log.WithField("user_id", userID).Info("Access token deleted")
+	return nil
+}
+
+// UpdateLastUsed sets last_used_at for many tokens in a single statement
+func (r *PersonalAccessTokenRepositoryImpl) UpdateLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	if len(lastUsed) == 0 {
+		return nil
+	}
+
+	log := r.Logger.WithContext(ctx)
+
+	values := make([]string, 0, len(lastUsed))
+	args := make([]interface{}, 0, len(lastUsed)*2)
+	for publicID, usedAt := range lastUsed {
+		values = append(values, "(?, ?::timestamptz)")
+		args = append(args, publicID, usedAt)
+	}
+
+	query := "UPDATE personal_access_tokens SET last_used_at = v.used_at FROM (VALUES " + strings.Join(values, ", ") +
+		") AS v(public_id, used_at) WHERE personal_access_tokens.public_id = v.public_id" +
+		" AND (personal_access_tokens.last_used_at IS NULL OR personal_access_tokens.last_used_at < v.used_at)"
+	if err := r.DB.Exec(query, args...).Error; err != nil {
+		log.WithError(err).Error("Failed to update access token last used")
+		return err
+	}
+
+	log.WithField("count", len(lastUsed)).Debug("Access token last used updated")
+	return nil
+}
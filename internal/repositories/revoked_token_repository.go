@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// RevokedTokenRepository defines the interface for the store of revoked JWTs
+type RevokedTokenRepository interface {
+	Create(ctx context.Context, token *models.RevokedToken) error
+	Exists(ctx context.Context, tokenID string) (bool, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// RevokedTokenRepositoryImpl handles database interactions for revoked tokens
+type RevokedTokenRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewRevokedTokenRepository creates a new revoked token repository
+func NewRevokedTokenRepository(db *gorm.DB, logger *utils.Logger) *RevokedTokenRepositoryImpl {
+	return &RevokedTokenRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create records a revoked token. Revoking a token twice is not an error.
+func (r *RevokedTokenRepositoryImpl) Create(ctx context.Context, token *models.RevokedToken) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Where(models.RevokedToken{TokenID: token.TokenID}).FirstOrCreate(token).Error; err != nil {
+		log.WithError(err).WithField("jti", token.TokenID).Error("Failed to record revoked token")
+		return err
+	}
+
+	return nil
+}
+
+// Exists reports whether the token with the given jti has been revoked
+func (r *RevokedTokenRepositoryImpl) Exists(ctx context.Context, tokenID string) (bool, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var count int64
+	if err := r.DB.Model(&models.RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error; err != nil {
+		log.WithError(err).WithField("jti", tokenID).Error("Failed to look up revoked token")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpired deletes revoked tokens that have expired and returns how many were deleted
+func (r *RevokedTokenRepositoryImpl) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to purge revoked tokens")
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
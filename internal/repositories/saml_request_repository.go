@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrSAMLRequestNotFound is returned when no unexpired request matches a SAML response
+var ErrSAMLRequestNotFound = errors.New("SAML request not found")
+
+// SAMLRequestRepository defines the interface for outstanding SAML authentication requests
+type SAMLRequestRepository interface {
+	Create(ctx context.Context, request *models.SAMLRequest) error
+	Consume(ctx context.Context, requestID, connection string, now time.Time) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// SAMLRequestRepositoryImpl handles database interactions for SAML requests
+type SAMLRequestRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewSAMLRequestRepository creates a new SAML request repository
+func NewSAMLRequestRepository(db *gorm.DB, logger *utils.Logger) *SAMLRequestRepositoryImpl {
+	return &SAMLRequestRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create stores an outstanding request
+func (r *SAMLRequestRepositoryImpl) Create(ctx context.Context, request *models.SAMLRequest) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(request).Error; err != nil {
+		log.WithError(err).WithField("connection", request.Connection).Error("Failed to create SAML request")
+		return err
+	}
+
+	return nil
+}
+
+// Consume deletes the unexpired request of a connection with an ID. The
+// conditional delete makes concurrent responses to one request exclusive.
+func (r *SAMLRequestRepositoryImpl) Consume(ctx context.Context, requestID, connection string, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("request_id = ? AND connection = ? AND expires_at > ?", requestID, connection, now).Delete(&models.SAMLRequest{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to consume SAML request")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSAMLRequestNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes requests that were never answered
+func (r *SAMLRequestRepositoryImpl) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("expires_at <= ?", now).Delete(&models.SAMLRequest{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to delete expired SAML requests")
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
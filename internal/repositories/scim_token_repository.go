@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrSCIMTokenNotFound is returned when no SCIM token matches a lookup
+var ErrSCIMTokenNotFound = errors.New("SCIM token not found")
+
+// SCIMTokenRepository defines the interface for SCIM token repository
+type SCIMTokenRepository interface {
+	Create(ctx context.Context, token *models.SCIMToken) error
+	FindByHash(ctx context.Context, hash string) (*models.SCIMToken, error)
+	List(ctx context.Context, tenant string) ([]models.SCIMToken, error)
+	Delete(ctx context.Context, publicID string) error
+}
+
+// SCIMTokenRepositoryImpl handles database interactions for SCIM tokens
+type SCIMTokenRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewSCIMTokenRepository creates a new SCIM token repository
+func NewSCIMTokenRepository(db *gorm.DB, logger *utils.Logger) *SCIMTokenRepositoryImpl {
+	return &SCIMTokenRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a new SCIM token
+func (r *SCIMTokenRepositoryImpl) Create(ctx context.Context, token *models.SCIMToken) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(token).Error; err != nil {
+		log.WithError(err).WithField("tenant", token.Tenant).Error("Failed to create SCIM token")
+		return err
+	}
+
+	log.WithField("tenant", token.Tenant).Debug("SCIM token created")
+	return nil
+}
+
+// FindByHash finds a SCIM token by the hash of its value
+func (r *SCIMTokenRepositoryImpl) FindByHash(ctx context.Context, hash string) (*models.SCIMToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var token models.SCIMToken
+	if err := r.DB.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSCIMTokenNotFound
+		}
+		log.WithError(err).Error("Failed to find SCIM token")
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// List lists SCIM tokens, newest first, optionally only those of one tenant
+func (r *SCIMTokenRepositoryImpl) List(ctx context.Context, tenant string) ([]models.SCIMToken, error) {
+	log := r.Logger.WithContext(ctx)
+
+	query := r.DB.Order("id desc")
+	if tenant != "" {
+		query = query.Where("tenant = ?", tenant)
+	}
+
+	var tokens []models.SCIMToken
+	if err := query.Find(&tokens).Error; err != nil {
+		log.WithError(err).Error("Failed to list SCIM tokens")
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete deletes a SCIM token
+func (r *SCIMTokenRepositoryImpl) Delete(ctx context.Context, publicID string) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("public_id = ?", publicID).Delete(&models.SCIMToken{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to delete SCIM token")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSCIMTokenNotFound
+	}
+
+	log.WithField("public_id", publicID).Info("SCIM token deleted")
+	return nil
+}
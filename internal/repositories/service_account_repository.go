@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrServiceAccountNotFound is returned when no service account matches a lookup
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+// ServiceAccountRepository defines the interface for service account repository
+type ServiceAccountRepository interface {
+	Create(ctx context.Context, account *models.ServiceAccount, secret *models.ServiceAccountSecret) error
+	FindByPublicID(ctx context.Context, publicID string) (*models.ServiceAccount, error)
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+	Update(ctx context.Context, account *models.ServiceAccount) error
+	Delete(ctx context.Context, id uint) error
+	ListSecrets(ctx context.Context, accountID uint) ([]models.ServiceAccountSecret, error)
+	RotateSecret(ctx context.Context, secret *models.ServiceAccountSecret, expireOthersAt time.Time) error
+}
+
+// ServiceAccountRepositoryImpl handles database interactions for service accounts
+type ServiceAccountRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewServiceAccountRepository creates a new service account repository
+func NewServiceAccountRepository(db *gorm.DB, logger *utils.Logger) *ServiceAccountRepositoryImpl {
+	return &ServiceAccountRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a service account together with its first secret
+func (r *ServiceAccountRepositoryImpl) Create(ctx context.Context, account *models.ServiceAccount, secret *models.ServiceAccountSecret) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin service account transaction")
+		return tx.Error
+	}
+
+	if err := tx.Create(account).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to create service account")
+		return err
+	}
+
+	secret.ServiceAccountID = account.ID
+	if err := tx.Create(secret).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to create service account secret")
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Error("Failed to commit service account")
+		return err
+	}
+
+	log.WithField("client_id", account.PublicID).Info("Service account created")
+	return nil
+}
+
+// FindByPublicID finds a service account by public ID
+func (r *ServiceAccountRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.ServiceAccount, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var account models.ServiceAccount
+	if err := r.DB.Where("public_id = ?", publicID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceAccountNotFound
+		}
+		log.WithError(err).WithField("client_id", publicID).Error("Failed to find service account")
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// List lists all service accounts
+func (r *ServiceAccountRepositoryImpl) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var accounts []models.ServiceAccount
+	if err := r.DB.Order("id").Find(&accounts).Error; err != nil {
+		log.WithError(err).Error("Failed to list service accounts")
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// Update updates a service account
+func (r *ServiceAccountRepositoryImpl) Update(ctx context.Context, account *models.ServiceAccount) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(account).Error; err != nil {
+		log.WithError(err).WithField("client_id", account.PublicID).Error("Failed to update service account")
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes a service account and its secrets
+func (r *ServiceAccountRepositoryImpl) Delete(ctx context.Context, id uint) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin service account transaction")
+		return tx.Error
+	}
+
+	if err := tx.Where("service_account_id = ?", id).Delete(&models.ServiceAccountSecret{}).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to delete service account secrets")
+		return err
+	}
+
+	if err := tx.Delete(&models.ServiceAccount{}, id).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to delete service account")
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ListSecrets lists a service account's secrets, newest first
+func (r *ServiceAccountRepositoryImpl) ListSecrets(ctx context.Context, accountID uint) ([]models.ServiceAccountSecret, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var secrets []models.ServiceAccountSecret
+	if err := r.DB.Where("service_account_id = ?", accountID).Order("id desc").Find(&secrets).Error; err != nil {
+		log.WithError(err).Error("Failed to list service account secrets")
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// RotateSecret stores a new secret and sets every other unexpired secret of
+// the account to expire at expireOthersAt, in one transaction
+func (r *ServiceAccountRepositoryImpl) RotateSecret(ctx context.Context, secret *models.ServiceAccountSecret, expireOthersAt time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin secret rotation transaction")
+		return tx.Error
+	}
+
+	if err := tx.Model(&models.ServiceAccountSecret{}).
+		Where("service_account_id = ? AND (expires_at IS NULL OR expires_at > ?)", secret.ServiceAccountID, expireOthersAt).
+		UpdateColumn("expires_at", expireOthersAt).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to expire previous secrets")
+		return err
+	}
+
+	if err := tx.Create(secret).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to create service account secret")
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Error("Failed to commit secret rotation")
+		return err
+	}
+
+	log.WithField("service_account_id", secret.ServiceAccountID).Info("Service account secret rotated")
+	return nil
+}
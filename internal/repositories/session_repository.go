@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrSessionNotFound is returned when no session matches a lookup
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository defines the interface for session repository
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindByPublicID(ctx context.Context, publicID string) (*models.Session, error)
+	ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error)
+	Revoke(ctx context.Context, userID uint, publicID string, now time.Time) error
+	RevokeAllExcept(ctx context.Context, userID uint, keepPublicID string, now time.Time) error
+	UpdateLastSeen(ctx context.Context, lastSeen map[string]time.Time) error
+}
+
+// SessionRepositoryImpl handles database interactions for sessions
+type SessionRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *gorm.DB, logger *utils.Logger) *SessionRepositoryImpl {
+	return &SessionRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// Create creates a new session
+func (r *SessionRepositoryImpl) Create(ctx context.Context, session *models.Session) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(session).Error; err != nil {
+		log.WithError(err).WithField("user_id", session.UserID).Error("Failed to create session")
+		return err
+	}
+
+	log.WithField("user_id", session.UserID).Debug("Session created")
+	return nil
+}
+
+// FindByPublicID finds a session by public ID
+func (r *SessionRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.Session, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var session models.Session
+	if err := r.DB.Where("public_id = ?", publicID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		log.WithError(err).Error("Failed to find session")
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// ListActive returns a user's unrevoked, unexpired sessions, most recently used first
+func (r *SessionRepositoryImpl) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var sessions []models.Session
+	if err := r.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at desc").
+		Find(&sessions).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list sessions")
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke revokes one of the user's sessions
+func (r *SessionRepositoryImpl) Revoke(ctx context.Context, userID uint, publicID string, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.Session{}).
+		Where("user_id = ? AND public_id = ? AND revoked_at IS NULL", userID, publicID).
+		UpdateColumn("revoked_at", now)
+	if result.Error != nil {
+		log.WithError(result.Error).WithField("user_id", userID).Error("Failed to revoke session")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	log.WithField("user_id", userID).Info("Session revoked")
+	return nil
+}
+
+// RevokeAllExcept revokes every active session of the user other than keepPublicID
+func (r *SessionRepositoryImpl) RevokeAllExcept(ctx context.Context, userID uint, keepPublicID string, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Model(&models.Session{}).
+		Where("user_id = ? AND public_id <> ? AND revoked_at IS NULL", userID, keepPublicID).
+		UpdateColumn("revoked_at", now).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to revoke sessions")
+		return err
+	}
+
+	log.WithField("user_id", userID).Info("Other sessions revoked")
+	return nil
+}
+
+// UpdateLastSeen sets last_seen_at for many sessions in a single statement
+func (r *SessionRepositoryImpl) UpdateLastSeen(ctx context.Context, lastSeen map[string]time.Time) error {
+	if len(lastSeen) == 0 {
+		return nil
+	}
+
+	log := r.Logger.WithContext(ctx)
+
+	values := make([]string, 0, len(lastSeen))
+	args := make([]interface{}, 0, len(lastSeen)*2)
+	for publicID, seenAt := range lastSeen {
+		values = append(values, "(?, ?::timestamptz)")
+		args = append(args, publicID, seenAt)
+	}
+
+	query := "UPDATE sessions SET last_seen_at = v.seen_at FROM (VALUES " + strings.Join(values, ", ") +
+		") AS v(public_id, seen_at) WHERE sessions.public_id = v.public_id AND sessions.last_seen_at < v.seen_at"
+	if err := r.DB.Exec(query, args...).Error; err != nil {
+		log.WithError(err).Error("Failed to update session last seen")
+		return err
+	}
+
+	log.WithField("count", len(lastSeen)).Debug("Session last seen updated")
+	return nil
+}
@@ -2,7 +2,10 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
@@ -10,34 +13,114 @@ import (
 	"github.com/user/user-management-service/utils"
 )
 
+// ErrUserNotFound is returned when no user matches a lookup
+var ErrUserNotFound = errors.New("user not found")
+
 // UserRepository defines the interface for user repository
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
+	CreateWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) error
 	FindByID(ctx context.Context, id uint) (*models.User, error)
+	FindByPublicID(ctx context.Context, publicID string) (*models.User, error)
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	ExistsWithAttribute(ctx context.Context, name string, value interface{}, excludeID uint) (bool, error)
 	Update(ctx context.Context, user *models.User) error
 	Delete(ctx context.Context, id uint) error
-	List(ctx context.Context, offset, limit int) ([]models.User, int64, error)
+	List(ctx context.Context, filter UserFilter, offset, limit int) ([]models.User, int64, error)
+	Stream(ctx context.Context, filter UserFilter, fn func(*models.User) error) error
+}
+
+// UserFilter holds optional criteria used when listing or exporting users
+type UserFilter struct {
+	Search        string
+	Role          string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Attributes    map[string]string // exact match on custom attribute values
+	Email         string            // matched on its normalized form
+
+	// IdentityProvider limits the users to those with a linked identity at
+	// the provider, and IdentitySubject to the one it knows by that subject
+	IdentityProvider string
+	IdentitySubject  string
+
+	// Group limits the users to members of the group with this public ID,
+	// including members of the groups nested in it
+	Group string
+}
+
+// likeEscaper escapes the LIKE wildcards in search terms so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// apply narrows the query according to the filter, normalizing the email
+// filter the way the repository does
+func (f UserFilter) apply(db *gorm.DB, foldEmailLocalPart bool) *gorm.DB {
+	if f.Search != "" {
+		pattern := "%" + likeEscaper.Replace(f.Search) + "%"
+		db = db.Where(`name ILIKE ? ESCAPE '\' OR email ILIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	if f.Role != "" {
+		db = db.Where("role = ?", f.Role)
+	}
+	if f.Status != "" {
+		db = db.Where("status = ?", f.Status)
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *f.CreatedBefore)
+	}
+	for name, value := range f.Attributes {
+		db = db.Where("attributes ->> ? = ?", name, value)
+	}
+	if f.Email != "" {
+		db = db.Where("email_normalized = ?", models.NormalizeEmail(f.Email, foldEmailLocalPart))
+	}
+	if f.IdentityProvider != "" {
+		identities := "SELECT user_id FROM identities WHERE provider = ?"
+		args := []interface{}{f.IdentityProvider}
+		if f.IdentitySubject != "" {
+			identities += " AND subject = ?"
+			args = append(args, f.IdentitySubject)
+		}
+		db = db.Where("id IN ("+identities+")", args...)
+	}
+	if f.Group != "" {
+		db = db.Where("id IN (SELECT user_id FROM group_members WHERE group_id IN ("+descendantsQuery("public_id = ?")+"))", f.Group)
+	}
+	return db
 }
 
 // UserRepositoryImpl handles database interactions for users
 type UserRepositoryImpl struct {
 	DB     *gorm.DB
 	Logger *utils.Logger
+
+	// FoldEmailLocalPart treats the part of emails before @ as case-insensitive
+	FoldEmailLocalPart bool
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *gorm.DB, logger *utils.Logger) *UserRepositoryImpl {
+func NewUserRepository(db *gorm.DB, foldEmailLocalPart bool, logger *utils.Logger) *UserRepositoryImpl {
 	return &UserRepositoryImpl{
-		DB:     db,
-		Logger: logger,
+		DB:                 db,
+		Logger:             logger,
+		FoldEmailLocalPart: foldEmailLocalPart,
 	}
 }
 
+// normalizeEmail returns the canonical form of an email used for lookups
+func (r *UserRepositoryImpl) normalizeEmail(email string) string {
+	return models.NormalizeEmail(email, r.FoldEmailLocalPart)
+}
+
 // Create creates a new user
 func (r *UserRepositoryImpl) Create(ctx context.Context, user *models.User) error {
 	log := r.Logger.WithContext(ctx)
 
+	user.EmailNormalized = r.normalizeEmail(user.Email)
 	if err := r.DB.Create(user).Error; err != nil {
 		log.WithError(err).Error("Failed to create user")
 		return err
@@ -47,6 +130,40 @@ func (r *UserRepositoryImpl) Create(ctx context.Context, user *models.User) erro
 	return nil
 }
 
+// CreateWithIdentity creates a user together with the identity linking it to
+// an external provider, so that neither exists without the other
+func (r *UserRepositoryImpl) CreateWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin user transaction")
+		return tx.Error
+	}
+
+	user.EmailNormalized = r.normalizeEmail(user.Email)
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).Error("Failed to create user")
+		return err
+	}
+
+	identity.UserID = user.ID
+	if err := tx.Create(identity).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).WithField("provider", identity.Provider).Error("Failed to create identity")
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).Error("Failed to commit user")
+		return err
+	}
+
+	log.WithField("user_id", user.ID).WithField("provider", identity.Provider).Info("User created with identity")
+	return nil
+}
+
 // FindByID finds a user by ID
 func (r *UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*models.User, error) {
 	log := r.Logger.WithContext(ctx)
@@ -55,7 +172,7 @@ func (r *UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*models.Use
 	if err := r.DB.First(&user, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.WithField("user_id", id).Warn("User not found")
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		log.WithError(err).Error("Failed to find user by ID")
 		return nil, err
@@ -65,15 +182,33 @@ func (r *UserRepositoryImpl) FindByID(ctx context.Context, id uint) (*models.Use
 	return &user, nil
 }
 
-// FindByEmail finds a user by email
+// FindByPublicID finds a user by public ID
+func (r *UserRepositoryImpl) FindByPublicID(ctx context.Context, publicID string) (*models.User, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var user models.User
+	if err := r.DB.Where("public_id = ?", publicID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.WithField("public_id", publicID).Warn("User not found by public ID")
+			return nil, ErrUserNotFound
+		}
+		log.WithError(err).Error("Failed to find user by public ID")
+		return nil, err
+	}
+
+	log.WithField("public_id", publicID).Debug("User found by public ID")
+	return &user, nil
+}
+
+// FindByEmail finds a user by the normalized form of their email
 func (r *UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	log := r.Logger.WithContext(ctx)
 
 	var user models.User
-	if err := r.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := r.DB.Where("email_normalized = ?", r.normalizeEmail(email)).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.WithField("email", email).Warn("User not found by email")
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		log.WithError(err).Error("Failed to find user by email")
 		return nil, err
@@ -83,10 +218,31 @@ func (r *UserRepositoryImpl) FindByEmail(ctx context.Context, email string) (*mo
 	return &user, nil
 }
 
+// ExistsWithAttribute reports whether another user has the given attribute value
+func (r *UserRepositoryImpl) ExistsWithAttribute(ctx context.Context, name string, value interface{}, excludeID uint) (bool, error) {
+	log := r.Logger.WithContext(ctx)
+
+	doc, err := json.Marshal(map[string]interface{}{name: value})
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	if err := r.DB.Model(&models.User{}).
+		Where("attributes @> ?::jsonb AND id <> ?", string(doc), excludeID).
+		Count(&count).Error; err != nil {
+		log.WithError(err).WithField("attribute", name).Error("Failed to check attribute uniqueness")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // Update updates a user
 func (r *UserRepositoryImpl) Update(ctx context.Context, user *models.User) error {
 	log := r.Logger.WithContext(ctx)
 
+	user.EmailNormalized = r.normalizeEmail(user.Email)
 	if err := r.DB.Save(user).Error; err != nil {
 		log.WithError(err).Error("Failed to update user")
 		return err
@@ -110,18 +266,20 @@ func (r *UserRepositoryImpl) Delete(ctx context.Context, id uint) error {
 }
 
 // List returns a list of users
-func (r *UserRepositoryImpl) List(ctx context.Context, offset, limit int) ([]models.User, int64, error) {
+func (r *UserRepositoryImpl) List(ctx context.Context, filter UserFilter, offset, limit int) ([]models.User, int64, error) {
 	log := r.Logger.WithContext(ctx)
 
 	var users []models.User
 	var count int64
 
-	if err := r.DB.Model(&models.User{}).Count(&count).Error; err != nil {
+	query := filter.apply(r.DB.Model(&models.User{}), r.FoldEmailLocalPart)
+
+	if err := query.Count(&count).Error; err != nil {
 		log.WithError(err).Error("Failed to count users")
 		return nil, 0, err
 	}
 
-	if err := r.DB.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	if err := query.Order("id").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
 		log.WithError(err).Error("Failed to list users")
 		return nil, 0, err
 	}
@@ -134,3 +292,43 @@ func (r *UserRepositoryImpl) List(ctx context.Context, offset, limit int) ([]mod
 
 	return users, count, nil
 }
+
+// Stream iterates over all users matching the filter using a database cursor,
+// calling fn for each row without loading the full result set into memory
+func (r *UserRepositoryImpl) Stream(ctx context.Context, filter UserFilter, fn func(*models.User) error) error {
+	log := r.Logger.WithContext(ctx)
+
+	query := filter.apply(r.DB.Model(&models.User{}), r.FoldEmailLocalPart).Order("id")
+	rows, err := query.Rows()
+	if err != nil {
+		log.WithError(err).Error("Failed to open user cursor")
+		return err
+	}
+	defer rows.Close()
+
+	var streamed int
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := r.DB.ScanRows(rows, &user); err != nil {
+			log.WithError(err).Error("Failed to scan user row")
+			return err
+		}
+
+		if err := fn(&user); err != nil {
+			return err
+		}
+		streamed++
+	}
+
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("Failed to iterate user cursor")
+		return err
+	}
+
+	log.WithField("count", streamed).Debug("Users streamed successfully")
+	return nil
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// UserStatusRepository defines the interface for user status repository
+type UserStatusRepository interface {
+	ApplyTransition(ctx context.Context, user *models.User, transition *models.UserStatusTransition) error
+	ListTransitions(ctx context.Context, userID uint) ([]models.UserStatusTransition, error)
+	FindDueReactivations(ctx context.Context, now time.Time) ([]models.User, error)
+}
+
+// UserStatusRepositoryImpl handles database interactions for user statuses
+type UserStatusRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewUserStatusRepository creates a new user status repository
+func NewUserStatusRepository(db *gorm.DB, logger *utils.Logger) *UserStatusRepositoryImpl {
+	return &UserStatusRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// ApplyTransition updates the user's status and records the transition in one transaction
+func (r *UserStatusRepositoryImpl) ApplyTransition(ctx context.Context, user *models.User, transition *models.UserStatusTransition) error {
+	log := r.Logger.WithContext(ctx)
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		log.WithError(tx.Error).Error("Failed to begin status transaction")
+		return tx.Error
+	}
+
+	if err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"status":       transition.ToStatus,
+		"status_until": transition.Until,
+		"updated_at":   time.Now(),
+	}).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to update user status")
+		return err
+	}
+
+	transition.UserID = user.ID
+	if err := tx.Create(transition).Error; err != nil {
+		tx.Rollback()
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to record status transition")
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to commit status transition")
+		return err
+	}
+
+	user.Status = transition.ToStatus
+	user.StatusUntil = transition.Until
+
+	log.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"from":    transition.FromStatus,
+		"to":      transition.ToStatus,
+	}).Info("User status changed")
+	return nil
+}
+
+// ListTransitions returns a user's status history, newest first
+func (r *UserStatusRepositoryImpl) ListTransitions(ctx context.Context, userID uint) ([]models.UserStatusTransition, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var transitions []models.UserStatusTransition
+	if err := r.DB.Where("user_id = ?", userID).Order("created_at desc, id desc").Find(&transitions).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list status transitions")
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+// FindDueReactivations returns suspended or locked users whose reactivation time has passed
+func (r *UserStatusRepositoryImpl) FindDueReactivations(ctx context.Context, now time.Time) ([]models.User, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var users []models.User
+	if err := r.DB.Where("status IN (?) AND status_until IS NOT NULL AND status_until <= ?",
+		[]string{models.StatusSuspended, models.StatusLocked}, now).Find(&users).Error; err != nil {
+		log.WithError(err).Error("Failed to find users due for reactivation")
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrWebAuthnCredentialNotFound is returned when no registered credential matches a lookup
+var ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+
+// ErrWebAuthnChallengeNotFound is returned when no unexpired ceremony matches a response
+var ErrWebAuthnChallengeNotFound = errors.New("WebAuthn challenge not found")
+
+// WebAuthnRepository defines the interface for WebAuthn credentials and ceremonies
+type WebAuthnRepository interface {
+	CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	FindCredential(ctx context.Context, userID uint, publicID string) (*models.WebAuthnCredential, error)
+	FindCredentialByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error)
+	ListCredentials(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error)
+	UpdateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	RecordCredentialUse(ctx context.Context, id uint, previousCount, signCount int64, backedUp bool, now time.Time) error
+	DeleteCredential(ctx context.Context, userID uint, publicID string) error
+	CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+	ConsumeChallenge(ctx context.Context, publicID string, now time.Time) (*models.WebAuthnChallenge, error)
+	DeleteExpiredChallenges(ctx context.Context, now time.Time) (int64, error)
+}
+
+// WebAuthnRepositoryImpl handles database interactions for WebAuthn
+type WebAuthnRepositoryImpl struct {
+	DB     *gorm.DB
+	Logger *utils.Logger
+}
+
+// NewWebAuthnRepository creates a new WebAuthn repository
+func NewWebAuthnRepository(db *gorm.DB, logger *utils.Logger) *WebAuthnRepositoryImpl {
+	return &WebAuthnRepositoryImpl{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// CreateCredential registers a credential
+func (r *WebAuthnRepositoryImpl) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(credential).Error; err != nil {
+		log.WithError(err).WithField("user_id", credential.UserID).Error("Failed to create WebAuthn credential")
+		return err
+	}
+
+	return nil
+}
+
+// FindCredential finds one of a user's credentials by its public ID
+func (r *WebAuthnRepositoryImpl) FindCredential(ctx context.Context, userID uint, publicID string) (*models.WebAuthnCredential, error) {
+	return r.findCredential(ctx, "user_id = ? AND public_id = ?", userID, publicID)
+}
+
+// FindCredentialByCredentialID finds a credential by the ID its authenticator chose
+func (r *WebAuthnRepositoryImpl) FindCredentialByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	return r.findCredential(ctx, "credential_id = ?", credentialID)
+}
+
+func (r *WebAuthnRepositoryImpl) findCredential(ctx context.Context, query string, args ...interface{}) (*models.WebAuthnCredential, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var credential models.WebAuthnCredential
+	if err := r.DB.Where(query, args...).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		log.WithError(err).Error("Failed to find WebAuthn credential")
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// ListCredentials lists a user's credentials
+func (r *WebAuthnRepositoryImpl) ListCredentials(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var credentials []models.WebAuthnCredential
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&credentials).Error; err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list WebAuthn credentials")
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// UpdateCredential updates a credential
+func (r *WebAuthnRepositoryImpl) UpdateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Save(credential).Error; err != nil {
+		log.WithError(err).WithField("user_id", credential.UserID).Error("Failed to update WebAuthn credential")
+		return err
+	}
+
+	return nil
+}
+
+// RecordCredentialUse stores a credential's new sign count after a sign-in.
+// The update only applies while the count is still previousCount, so two
+// sign-ins that report the same count cannot both succeed.
+func (r *WebAuthnRepositoryImpl) RecordCredentialUse(ctx context.Context, id uint, previousCount, signCount int64, backedUp bool, now time.Time) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Model(&models.WebAuthnCredential{}).Where("id = ? AND sign_count = ?", id, previousCount).UpdateColumns(map[string]interface{}{
+		"sign_count":   signCount,
+		"backed_up":    backedUp,
+		"last_used_at": now,
+	})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to record WebAuthn credential use")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// DeleteCredential deletes one of a user's credentials
+func (r *WebAuthnRepositoryImpl) DeleteCredential(ctx context.Context, userID uint, publicID string) error {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("user_id = ? AND public_id = ?", userID, publicID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		log.WithError(result.Error).WithField("user_id", userID).Error("Failed to delete WebAuthn credential")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// CreateChallenge stores an outstanding ceremony
+func (r *WebAuthnRepositoryImpl) CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	log := r.Logger.WithContext(ctx)
+
+	if err := r.DB.Create(challenge).Error; err != nil {
+		log.WithError(err).WithField("purpose", challenge.Purpose).Error("Failed to create WebAuthn challenge")
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeChallenge deletes and returns the unexpired ceremony with a public
+// ID, so each challenge can be answered only once
+func (r *WebAuthnRepositoryImpl) ConsumeChallenge(ctx context.Context, publicID string, now time.Time) (*models.WebAuthnChallenge, error) {
+	log := r.Logger.WithContext(ctx)
+
+	var challenge models.WebAuthnChallenge
+	if err := r.DB.Where("public_id = ? AND expires_at > ?", publicID, now).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnChallengeNotFound
+		}
+		log.WithError(err).Error("Failed to find WebAuthn challenge")
+		return nil, err
+	}
+
+	// The conditional delete makes concurrent answers to one challenge exclusive
+	result := r.DB.Where("id = ?", challenge.ID).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to consume WebAuthn challenge")
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrWebAuthnChallengeNotFound
+	}
+
+	return &challenge, nil
+}
+
+// DeleteExpiredChallenges deletes ceremonies that were never completed
+func (r *WebAuthnRepositoryImpl) DeleteExpiredChallenges(ctx context.Context, now time.Time) (int64, error) {
+	log := r.Logger.WithContext(ctx)
+
+	result := r.DB.Where("expires_at <= ?", now).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to delete expired WebAuthn challenges")
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// activityBuffer collects the latest activity time per ID in memory so it
+// can be written in batches instead of on every request
+type activityBuffer struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+func newActivityBuffer() *activityBuffer {
+	return &activityBuffer{pending: make(map[string]time.Time)}
+}
+
+// touch records activity for id at the current time
+func (b *activityBuffer) touch(id string) {
+	if id == "" {
+		return
+	}
+
+	b.mu.Lock()
+	b.pending[id] = time.Now()
+	b.mu.Unlock()
+}
+
+// latest returns the buffered activity time for id, if any
+func (b *activityBuffer) latest(id string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seenAt, ok := b.pending[id]
+	return seenAt, ok
+}
+
+// flush hands the buffered activity to write. If write fails the activity is
+// kept for the next flush unless newer activity was recorded meanwhile.
+func (b *activityBuffer) flush(ctx context.Context, write func(context.Context, map[string]time.Time) error) error {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make(map[string]time.Time)
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := write(ctx, batch); err != nil {
+		b.mu.Lock()
+		for id, seenAt := range batch {
+			if current, ok := b.pending[id]; !ok || current.Before(seenAt) {
+				b.pending[id] = seenAt
+			}
+		}
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
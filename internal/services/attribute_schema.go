@@ -0,0 +1,184 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/user/user-management-service/internal/models"
+)
+
+// Attribute types
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+)
+
+// Attribute visibility levels
+const (
+	// VisibilityPublic attributes are visible to every authenticated user
+	VisibilityPublic = "public"
+	// VisibilityPrivate attributes are visible only to the user and admins
+	VisibilityPrivate = "private"
+)
+
+// AttributeDefinition describes a custom profile attribute
+type AttributeDefinition struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Required   bool   `json:"required"`
+	Pattern    string `json:"pattern,omitempty"`
+	Unique     bool   `json:"unique"`
+	Visibility string `json:"visibility"`
+
+	pattern *regexp.Regexp
+}
+
+// AttributeSchema is the set of custom attributes users may have
+type AttributeSchema struct {
+	Attributes []AttributeDefinition `json:"attributes"`
+
+	byName map[string]*AttributeDefinition
+}
+
+// NewAttributeSchema validates the definitions and builds a schema
+func NewAttributeSchema(definitions []AttributeDefinition) (*AttributeSchema, error) {
+	schema := &AttributeSchema{
+		Attributes: definitions,
+		byName:     make(map[string]*AttributeDefinition),
+	}
+
+	for i := range schema.Attributes {
+		def := &schema.Attributes[i]
+		if def.Name == "" {
+			return nil, fmt.Errorf("attribute %d has no name", i)
+		}
+		if _, exists := schema.byName[def.Name]; exists {
+			return nil, fmt.Errorf("attribute %q is defined twice", def.Name)
+		}
+
+		switch def.Type {
+		case AttributeTypeString, AttributeTypeNumber, AttributeTypeBoolean:
+		default:
+			return nil, fmt.Errorf("attribute %q has unsupported type %q", def.Name, def.Type)
+		}
+
+		if def.Visibility == "" {
+			def.Visibility = VisibilityPrivate
+		}
+		if def.Visibility != VisibilityPublic && def.Visibility != VisibilityPrivate {
+			return nil, fmt.Errorf("attribute %q has unsupported visibility %q", def.Name, def.Visibility)
+		}
+
+		if def.Pattern != "" {
+			if def.Type != AttributeTypeString {
+				return nil, fmt.Errorf("attribute %q: pattern is only supported for strings", def.Name)
+			}
+			re, err := regexp.Compile(def.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q has invalid pattern: %w", def.Name, err)
+			}
+			def.pattern = re
+		}
+
+		schema.byName[def.Name] = def
+	}
+
+	return schema, nil
+}
+
+// LoadAttributeSchema loads an attribute schema from a JSON file
+func LoadAttributeSchema(path string) (*AttributeSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file AttributeSchema
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid attribute schema: %w", err)
+	}
+
+	return NewAttributeSchema(file.Attributes)
+}
+
+// Definition returns the definition for an attribute name
+func (s *AttributeSchema) Definition(name string) (*AttributeDefinition, bool) {
+	def, ok := s.byName[name]
+	return def, ok
+}
+
+// Validate checks a complete attribute set and returns every violation
+func (s *AttributeSchema) Validate(attrs models.Attributes) []string {
+	var violations []string
+
+	// Iterate in a stable order so error messages are deterministic
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def, ok := s.byName[name]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("unknown attribute %q", name))
+			continue
+		}
+		if err := def.check(attrs[name]); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	for _, def := range s.Attributes {
+		if _, ok := attrs[def.Name]; def.Required && !ok {
+			violations = append(violations, fmt.Sprintf("attribute %q is required", def.Name))
+		}
+	}
+
+	return violations
+}
+
+// check validates a single value against the definition
+func (d *AttributeDefinition) check(value interface{}) error {
+	switch d.Type {
+	case AttributeTypeString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("attribute %q must be a string", d.Name)
+		}
+		if d.pattern != nil && !d.pattern.MatchString(str) {
+			return fmt.Errorf("attribute %q does not match the required format", d.Name)
+		}
+	case AttributeTypeNumber:
+		switch value.(type) {
+		case float64, float32, int, int64, int32, uint, uint64, uint32:
+		default:
+			return fmt.Errorf("attribute %q must be a number", d.Name)
+		}
+	case AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("attribute %q must be a boolean", d.Name)
+		}
+	}
+	return nil
+}
+
+// Visible returns the attributes the viewer may see. Users always see their
+// own attributes and admins see everything; others only see public ones.
+func (s *AttributeSchema) Visible(attrs models.Attributes, includePrivate bool) models.Attributes {
+	visible := models.Attributes{}
+	for name, value := range attrs {
+		def, ok := s.byName[name]
+		if !ok {
+			continue
+		}
+		if includePrivate || def.Visibility == VisibilityPublic {
+			visible[name] = value
+		}
+	}
+	return visible
+}
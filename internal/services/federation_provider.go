@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// jwksRefreshInterval limits how often an unknown key ID makes a provider's keys be fetched again
+const jwksRefreshInterval = time.Minute
+
+// FederationProviderConfig configures an upstream OpenID Connect provider
+type FederationProviderConfig struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Issuer          string   `json:"issuer"`
+	ClientID        string   `json:"client_id"`
+	ClientSecret    string   `json:"client_secret"`
+	ClientSecretEnv string   `json:"client_secret_env"`
+	Scopes          []string `json:"scopes"`
+	// TrustEmail treats the provider's email claim as verified, for providers
+	// such as corporate directories that do not send email_verified
+	TrustEmail bool `json:"trust_email"`
+}
+
+// FederationProvider is an upstream OpenID Connect provider users can sign in
+// with. Its discovery document and signing keys are fetched on first use.
+type FederationProvider struct {
+	FederationProviderConfig
+	HTTPClient *http.Client
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// providerMetadata holds the fields of a provider's discovery document that are used
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// LoadFederationProviders loads the upstream providers from a JSON file
+func LoadFederationProviders(path string) ([]*FederationProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Providers []FederationProviderConfig `json:"providers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid federation providers file: %w", err)
+	}
+
+	providers := make([]*FederationProvider, 0, len(file.Providers))
+	seen := make(map[string]bool)
+	for _, cfg := range file.Providers {
+		if cfg.ClientSecretEnv != "" {
+			cfg.ClientSecret = os.Getenv(cfg.ClientSecretEnv)
+		}
+		if err := validateFederationProvider(cfg); err != nil {
+			return nil, err
+		}
+		if seen[cfg.ID] {
+			return nil, fmt.Errorf("provider %q: duplicate id", cfg.ID)
+		}
+		seen[cfg.ID] = true
+		providers = append(providers, NewFederationProvider(cfg))
+	}
+	return providers, nil
+}
+
+// NewFederationProvider creates a provider from its configuration
+func NewFederationProvider(cfg FederationProviderConfig) *FederationProvider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile}
+	}
+	return &FederationProvider{
+		FederationProviderConfig: cfg,
+		HTTPClient:               &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthorizationURL returns the URL the user is sent to at the provider to sign in
+func (p *FederationProvider) AuthorizationURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", utils.PKCEMethodS256)
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider and returns the verified ID token claims
+func (p *FederationProvider) Exchange(ctx context.Context, code, redirectURI, codeVerifier, nonce string) (*utils.IDTokenClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request rejected: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, metadata.Issuer, body.IDToken, nonce)
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience, expiry and nonce
+func (p *FederationProvider) verifyIDToken(ctx context.Context, issuer, idToken, nonce string) (*utils.IDTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(idToken, &utils.IDTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*utils.IDTokenClaims)
+	if !ok || claims.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// signingKey returns the provider's public key with a key ID, fetching the
+// provider's keys again if the ID is unknown, since providers rotate keys
+func (p *FederationProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	metadata, err := p.discoverLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []utils.JWK `json:"keys"`
+	}
+	if err := p.getJSON(ctx, metadata.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key. Tokens without a key ID can only be verified
+// if the provider publishes a single key.
+func (p *FederationProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// discover returns the provider's discovery document, fetching it on first use
+func (p *FederationProvider) discover(ctx context.Context) (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discoverLocked(ctx)
+}
+
+// discoverLocked is discover for callers holding the lock
+func (p *FederationProvider) discoverLocked(ctx context.Context) (*providerMetadata, error) {
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata providerMetadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("provider discovery failed: issuer %q does not match %q", metadata.Issuer, p.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider discovery failed: endpoints missing")
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (p *FederationProvider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// validateFederationProvider validates a provider configuration
+func validateFederationProvider(cfg FederationProviderConfig) error {
+	switch {
+	case cfg.ID == "" || strings.ContainsAny(cfg.ID, "/?# ") || len(cfg.ID) > 50:
+		return fmt.Errorf("provider %q: id must be 1-50 characters without spaces or URL delimiters", cfg.ID)
+	case cfg.Name == "":
+		return fmt.Errorf("provider %q: name is required", cfg.ID)
+	case cfg.ClientID == "" || cfg.ClientSecret == "":
+		return fmt.Errorf("provider %q: client_id and client_secret are required", cfg.ID)
+	}
+
+	issuer, err := url.Parse(cfg.Issuer)
+	if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && issuer.Hostname() != "localhost" && issuer.Hostname() != "127.0.0.1") {
+		return fmt.Errorf("provider %q: issuer must be an https URL", cfg.ID)
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// linkRequestTTL is how long a user has to confirm linking an identity to their account
+const linkRequestTTL = 15 * time.Minute
+
+// Federated login errors
+var (
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrFederatedLoginFailed = errors.New("sign-in with the identity provider failed")
+	ErrEmailNotVerified     = errors.New("the identity provider has not verified the email address")
+	ErrInvalidLinkRequest   = errors.New("invalid or expired link request")
+	ErrLastIdentity         = errors.New("the only identity of an account without a password cannot be unlinked")
+	ErrManagedIdentity      = errors.New("identities provisioned by a directory cannot be unlinked")
+)
+
+// FederatedLogin is the outcome of signing in through an identity provider.
+// Token is set when the user is signed in. When the provider's email belongs
+// to an account the identity is not linked to yet, LinkToken is set instead
+// and the user must confirm the link.
+type FederatedLogin struct {
+	Token       string
+	LinkToken   string
+	Email       string
+	Provisioned bool
+}
+
+// ExternalIdentity is a user authenticated by an external identity provider.
+// Provider names the provider and Subject is the user's stable ID there.
+type ExternalIdentity struct {
+	Provider   string
+	Subject    string
+	Email      string
+	Name       string
+	Attributes models.Attributes
+	// TrustedProvider, if set, vouches for the owner of an existing account
+	// with the same email: if the account has an identity at this provider,
+	// the new identity is linked to it without confirmation
+	TrustedProvider string
+}
+
+// FederationService signs users in through upstream OpenID Connect
+// providers, provisioning accounts on first sign-in and linking identities to
+// existing accounts
+type FederationService struct {
+	IdentityRepo    repositories.IdentityRepository
+	UserRepo        repositories.UserRepository
+	UserService     *UserService
+	WebAuthnService *WebAuthnService
+	Providers       []*FederationProvider
+	Config          *config.Config
+	Logger          *utils.Logger
+}
+
+// NewFederationService creates a new federation service. Links confirmed with
+// a password are completed with webAuthnService when the user has a passkey.
+func NewFederationService(identityRepo repositories.IdentityRepository, userRepo repositories.UserRepository, userService *UserService, webAuthnService *WebAuthnService, providers []*FederationProvider, config *config.Config, logger *utils.Logger) *FederationService {
+	return &FederationService{
+		IdentityRepo:    identityRepo,
+		UserRepo:        userRepo,
+		UserService:     userService,
+		WebAuthnService: webAuthnService,
+		Providers:       providers,
+		Config:          config,
+		Logger:          logger,
+	}
+}
+
+// Provider returns the configured provider with an ID
+func (s *FederationService) Provider(providerID string) (*FederationProvider, error) {
+	for _, provider := range s.Providers {
+		if provider.ID == providerID {
+			return provider, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// BeginLogin returns the provider URL to send the user to and the state the
+// callback must present. The nonce and PKCE verifier are derived from the
+// state, so nothing has to be stored until the user returns.
+func (s *FederationService) BeginLogin(ctx context.Context, providerID string) (string, string, error) {
+	log := s.Logger.WithContext(ctx).WithField("provider", providerID)
+
+	provider, err := s.Provider(providerID)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := utils.GenerateOpaqueToken("state")
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthorizationURL(ctx, s.redirectURI(providerID), state, s.derive("nonce", providerID, state), utils.PKCEChallenge(s.derive("pkce", providerID, state)))
+	if err != nil {
+		log.WithError(err).Error("Failed to build provider authorization URL")
+		return "", "", ErrFederatedLoginFailed
+	}
+	return authURL, state, nil
+}
+
+// CompleteLogin exchanges the code the provider returned for a verified ID
+// token and signs in the user the identity belongs to. Unknown identities
+// get a new account, or a link request if their email is already registered.
+// The caller must have checked that state is the one BeginLogin returned.
+func (s *FederationService) CompleteLogin(ctx context.Context, providerID, state, code string, client ClientInfo) (*FederatedLogin, error) {
+	log := s.Logger.WithContext(ctx).WithField("provider", providerID)
+
+	provider, err := s.Provider(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, s.redirectURI(providerID), s.derive("pkce", providerID, state), s.derive("nonce", providerID, state))
+	if err != nil {
+		log.WithError(err).Warn("Provider sign-in failed")
+		return nil, ErrFederatedLoginFailed
+	}
+
+	// Unverified emails are dropped, so they can neither create nor link an account
+	email := claims.Email
+	if !provider.TrustEmail && (claims.EmailVerified == nil || !*claims.EmailVerified) {
+		email = ""
+	}
+
+	return s.SignIn(ctx, ExternalIdentity{
+		Provider: providerID,
+		Subject:  claims.Subject,
+		Email:    email,
+		Name:     claims.Name,
+	}, client)
+}
+
+// SignIn signs in the user an external identity is linked to. Unknown
+// identities get a new account, or a link request if their email is already
+// registered. The caller must have verified the identity and its email.
+func (s *FederationService) SignIn(ctx context.Context, external ExternalIdentity, client ClientInfo) (*FederatedLogin, error) {
+	log := s.Logger.WithContext(ctx).WithField("provider", external.Provider)
+
+	identity, err := s.IdentityRepo.FindBySubject(ctx, external.Provider, external.Subject)
+	if err == nil {
+		return s.loginIdentity(ctx, identity, client)
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(external.Email)
+	if email == "" {
+		log.WithField("subject", external.Subject).Warn("Provider sent no verified email for a new identity")
+		return nil, ErrEmailNotVerified
+	}
+
+	user, err := s.UserRepo.FindByEmail(ctx, email)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return s.provisionUser(ctx, external, client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if external.TrustedProvider != "" {
+		identities, err := s.IdentityRepo.ListByUser(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, trusted := range identities {
+			if trusted.Provider != external.TrustedProvider {
+				continue
+			}
+			identity, err := s.linkIdentity(ctx, &models.FederatedLinkRequest{
+				UserID:   user.ID,
+				Provider: external.Provider,
+				Subject:  external.Subject,
+				Email:    email,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return s.loginIdentity(ctx, identity, client)
+		}
+	}
+
+	linkToken, err := utils.GenerateOpaqueToken(models.FederatedLinkTokenKind)
+	if err != nil {
+		return nil, err
+	}
+	request := &models.FederatedLinkRequest{
+		TokenHash: utils.HashOpaqueToken(linkToken),
+		UserID:    user.ID,
+		Provider:  external.Provider,
+		Subject:   external.Subject,
+		Email:     email,
+		ExpiresAt: time.Now().Add(linkRequestTTL),
+	}
+	if err := s.IdentityRepo.CreateLinkRequest(ctx, request); err != nil {
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Info("Identity matches an existing account, link confirmation required")
+	return &FederatedLogin{LinkToken: linkToken, Email: email}, nil
+}
+
+// ConfirmLinkWithPassword signs the user of a link request in with the
+// account password, exactly like a password login, and links the identity
+// once they are. Users with a passkey get a SecondFactorRequiredError instead,
+// and the link waits for ConfirmLinkWithPasskey to answer its challenge. An
+// expired password gets a password-change token with ErrPasswordExpired and
+// no link. Each link request can be tried once.
+func (s *FederationService) ConfirmLinkWithPassword(ctx context.Context, linkToken, password string, client ClientInfo) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	request, err := s.consumeLinkRequest(ctx, linkToken)
+	if err != nil {
+		return "", err
+	}
+	if request.CeremonyID != "" {
+		log.WithField("user_id", request.UserID).Warn("Password sent for an identity link waiting for a passkey")
+		return "", ErrInvalidLinkRequest
+	}
+
+	user, err := s.UserRepo.FindByID(ctx, request.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user.Passwordless {
+		log.WithField("user_id", user.ID).Warn("Password sent for an identity link to an account without one")
+		return "", ErrInvalidLinkRequest
+	}
+
+	token, err := s.UserService.LoginUser(ctx, user, password, client)
+	var secondFactorErr *SecondFactorRequiredError
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		log.WithField("user_id", user.ID).Warn("Invalid password confirming identity link")
+		return "", ErrInvalidLinkRequest
+	case errors.As(err, &secondFactorErr):
+		// Keep the link pending on the passkey ceremony, under the same token
+		request.ID = 0
+		request.CeremonyID = secondFactorErr.Challenge.CeremonyID
+		if err := s.IdentityRepo.CreateLinkRequest(ctx, request); err != nil {
+			return "", err
+		}
+		return "", err
+	case err != nil:
+		return token, err
+	}
+
+	if _, err := s.linkIdentity(ctx, request); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConfirmLinkWithPasskey completes a link confirmed with the account
+// password by answering the passkey challenge ConfirmLinkWithPassword
+// returned, signs the user in and links the identity
+func (s *FederationService) ConfirmLinkWithPasskey(ctx context.Context, linkToken, ceremonyID string, assertion WebAuthnAssertion, client ClientInfo) (string, error) {
+	request, err := s.consumeLinkRequest(ctx, linkToken)
+	if err != nil {
+		return "", err
+	}
+	if request.CeremonyID == "" || request.CeremonyID != ceremonyID {
+		s.Logger.WithContext(ctx).WithField("user_id", request.UserID).Warn("Identity link answered with another ceremony")
+		return "", ErrInvalidLinkRequest
+	}
+
+	token, err := s.WebAuthnService.FinishLogin(ctx, ceremonyID, assertion, client)
+	if err != nil {
+		return token, err
+	}
+
+	if _, err := s.linkIdentity(ctx, request); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConfirmLink links the identity of a link request to the signed-in user it was created for
+func (s *FederationService) ConfirmLink(ctx context.Context, userID uint, linkToken string) (*models.Identity, error) {
+	request, err := s.consumeLinkRequest(ctx, linkToken)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID != userID {
+		s.Logger.WithContext(ctx).WithField("user_id", userID).Warn("Identity link confirmed by another user")
+		return nil, ErrInvalidLinkRequest
+	}
+	return s.linkIdentity(ctx, request)
+}
+
+// ListIdentities lists the identities linked to a user
+func (s *FederationService) ListIdentities(ctx context.Context, userID uint) ([]models.Identity, error) {
+	return s.IdentityRepo.ListByUser(ctx, userID)
+}
+
+// UnlinkIdentity unlinks one of a user's identities. Users without a
+// password must keep at least one identity to sign in with, and identities
+// that mark users a SCIM tenant or LDAP directory provisioned cannot be unlinked.
+func (s *FederationService) UnlinkIdentity(ctx context.Context, userID uint, identityID string) error {
+	user, err := s.UserRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	identities, err := s.IdentityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Directory identities only mark who provisioned the account; users
+	// without a password sign in through the others
+	signInIdentities := 0
+	for _, identity := range identities {
+		if identity.PublicID == identityID && isDirectoryIdentity(identity.Provider) {
+			return ErrManagedIdentity
+		}
+		if !isDirectoryIdentity(identity.Provider) {
+			signInIdentities++
+		}
+	}
+	if user.Passwordless && signInIdentities == 1 {
+		for _, identity := range identities {
+			if identity.PublicID == identityID {
+				return ErrLastIdentity
+			}
+		}
+	}
+
+	if err := s.IdentityRepo.Delete(ctx, userID, identityID); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("user_id", userID).WithField("identity_id", identityID).Info("Identity unlinked")
+	return nil
+}
+
+// isDirectoryIdentity reports whether an identity records that a SCIM tenant
+// or an LDAP directory provisioned the account
+func isDirectoryIdentity(provider string) bool {
+	return strings.HasPrefix(provider, scimProviderPrefix) || strings.HasPrefix(provider, ldapProviderPrefix)
+}
+
+// loginIdentity signs in the user a linked identity belongs to
+func (s *FederationService) loginIdentity(ctx context.Context, identity *models.Identity, client ClientInfo) (*FederatedLogin, error) {
+	user, err := s.UserRepo.FindByID(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.UserService.StartSession(ctx, user, client, utils.NewAuthentication(utils.AMRFederated))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.IdentityRepo.UpdateLastLogin(ctx, identity.ID, time.Now()); err != nil {
+		s.Logger.WithContext(ctx).WithError(err).Warn("Failed to record identity login")
+	}
+	return &FederatedLogin{Token: token, Email: user.Email}, nil
+}
+
+// provisionUser creates an account for a new identity and signs it in
+func (s *FederationService) provisionUser(ctx context.Context, external ExternalIdentity, client ClientInfo) (*FederatedLogin, error) {
+	identity := &models.Identity{
+		PublicID: models.NewPublicID(),
+		Provider: external.Provider,
+		Subject:  external.Subject,
+	}
+	user, err := s.UserService.ProvisionUserWithIdentity(ctx, external.Name, external.Email, external.Attributes, identity, models.StatusActive)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Logger.WithContext(ctx).WithField("provider", external.Provider).WithField("user_id", user.ID).Info("User provisioned from identity provider")
+	login, err := s.loginIdentity(ctx, identity, client)
+	if err != nil {
+		return nil, err
+	}
+	login.Provisioned = true
+	return login, nil
+}
+
+// consumeLinkRequest redeems a link token
+func (s *FederationService) consumeLinkRequest(ctx context.Context, linkToken string) (*models.FederatedLinkRequest, error) {
+	request, err := s.IdentityRepo.ConsumeLinkRequest(ctx, utils.HashOpaqueToken(linkToken), time.Now())
+	if errors.Is(err, repositories.ErrLinkRequestNotFound) {
+		return nil, ErrInvalidLinkRequest
+	}
+	return request, err
+}
+
+// linkIdentity creates the identity a link request describes
+func (s *FederationService) linkIdentity(ctx context.Context, request *models.FederatedLinkRequest) (*models.Identity, error) {
+	identity := &models.Identity{
+		PublicID: models.NewPublicID(),
+		UserID:   request.UserID,
+		Provider: request.Provider,
+		Subject:  request.Subject,
+		Email:    request.Email,
+	}
+	if err := s.IdentityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	s.Logger.WithContext(ctx).WithField("user_id", request.UserID).WithField("provider", request.Provider).Info("Identity linked")
+	return identity, nil
+}
+
+// redirectURI is where a provider sends the user back to
+func (s *FederationService) redirectURI(providerID string) string {
+	return s.Config.OIDC.Issuer + "/api/auth/federated/" + providerID + "/callback"
+}
+
+// derive derives a per-login secret from the state, keyed with the JWT secret
+func (s *FederationService) derive(purpose, providerID, state string) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.JWT.Secret))
+	mac.Write([]byte(purpose + "\x00" + providerID + "\x00" + state))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrGroupManagedExternally is returned when changing a group a tenant's
+// directory manages over SCIM
+var ErrGroupManagedExternally = errors.New("group is managed by its directory")
+
+// ErrGroupNameTaken is returned when another local group has the name
+var ErrGroupNameTaken = errors.New("group name is already taken")
+
+// ErrGroupHasSubgroups is returned when deleting a group other groups are nested in
+var ErrGroupHasSubgroups = errors.New("group has subgroups")
+
+// ErrGroupCycle is returned when nesting a group in itself or one of its subgroups
+var ErrGroupCycle = errors.New("group cannot be nested in itself or its subgroups")
+
+// ErrGroupForbidden is returned when a user who is neither an admin nor an
+// owner of a group tries to manage it
+var ErrGroupForbidden = errors.New("only admins and group owners can manage the group")
+
+// GroupService handles business logic for local groups and their members.
+// Groups pushed over SCIM can be read but are only changed by the SCIM service.
+type GroupService struct {
+	Repo     repositories.GroupRepository
+	UserRepo repositories.UserRepository
+	Config   *config.Config
+	Logger   *utils.Logger
+}
+
+// NewGroupService creates a new group service
+func NewGroupService(repo repositories.GroupRepository, userRepo repositories.UserRepository, cfg *config.Config, logger *utils.Logger) *GroupService {
+	return &GroupService{
+		Repo:     repo,
+		UserRepo: userRepo,
+		Config:   cfg,
+		Logger:   logger,
+	}
+}
+
+// GroupUpdate holds the group details to change; nil fields are left as they
+// are. An empty ParentID moves the group to the top level.
+type GroupUpdate struct {
+	Name        *string
+	Description *string
+	ParentID    *string
+}
+
+// Create creates a local group, nested in the group with parentID unless it is empty
+func (s *GroupService) Create(ctx context.Context, name, description, parentID string) (*models.Group, error) {
+	log := s.Logger.WithContext(ctx)
+
+	group := &models.Group{Name: strings.TrimSpace(name), Description: strings.TrimSpace(description)}
+	if err := s.validate(ctx, group, 0); err != nil {
+		return nil, err
+	}
+	if parentID != "" {
+		parent, err := s.findLocal(ctx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		group.ParentID = &parent.ID
+	}
+
+	if err := s.Repo.Create(ctx, group); err != nil {
+		log.WithError(err).Error("Failed to create group")
+		return nil, err
+	}
+
+	group.ParentPublicID = parentID
+	log.WithField("group_id", group.PublicID).Info("Group created")
+	return group, nil
+}
+
+// Get returns a group by public ID
+func (s *GroupService) Get(ctx context.Context, publicID string) (*models.Group, error) {
+	group, err := s.Repo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.present(ctx, []*models.Group{group}); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// List lists groups with pagination
+func (s *GroupService) List(ctx context.Context, page, perPage int) ([]models.Group, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 10
+	}
+
+	groups, total, err := s.Repo.List(ctx, repositories.GroupFilter{}, (page-1)*perPage, perPage)
+	if err != nil {
+		s.Logger.WithContext(ctx).WithError(err).Error("Failed to list groups")
+		return nil, 0, err
+	}
+	if err := s.present(ctx, groupPointers(groups)); err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+// Update changes a local group's details. Admins and the group's owners may
+// rename and describe it, while only admins may move it to another parent.
+func (s *GroupService) Update(ctx context.Context, actor *models.User, publicID string, update GroupUpdate) (*models.Group, error) {
+	log := s.Logger.WithContext(ctx)
+
+	group, err := s.findLocal(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, actor, group); err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		group.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Description != nil {
+		group.Description = strings.TrimSpace(*update.Description)
+	}
+	if err := s.validate(ctx, group, group.ID); err != nil {
+		return nil, err
+	}
+
+	if update.ParentID != nil {
+		if !actor.IsAdmin() {
+			return nil, ErrGroupForbidden
+		}
+		if err := s.setParent(ctx, group, *update.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Repo.Update(ctx, group); err != nil {
+		log.WithError(err).WithField("group_id", group.PublicID).Error("Failed to update group")
+		return nil, err
+	}
+	if err := s.present(ctx, []*models.Group{group}); err != nil {
+		return nil, err
+	}
+
+	log.WithField("group_id", group.PublicID).WithField("actor_id", actor.PublicID).Info("Group updated")
+	return group, nil
+}
+
+// Delete deletes a local group and its memberships. Groups with subgroups
+// must have them moved or deleted first.
+func (s *GroupService) Delete(ctx context.Context, publicID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	group, err := s.findLocal(ctx, publicID)
+	if err != nil {
+		return err
+	}
+
+	children, err := s.Repo.CountChildren(ctx, group.ID)
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrGroupHasSubgroups
+	}
+
+	if err := s.Repo.Delete(ctx, group.ID); err != nil {
+		return err
+	}
+
+	log.WithField("group_id", group.PublicID).Info("Group deleted")
+	return nil
+}
+
+// ListMembers lists the direct members of a group with their roles
+func (s *GroupService) ListMembers(ctx context.Context, publicID string) ([]models.GroupMembership, error) {
+	group, err := s.Repo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.ListMemberships(ctx, group.ID)
+}
+
+// SetMember adds a user to a local group with a role, or changes the role of
+// a member. Admins and the group's owners manage members.
+func (s *GroupService) SetMember(ctx context.Context, actor *models.User, publicID, userPublicID, role string) error {
+	log := s.Logger.WithContext(ctx)
+
+	if role == "" {
+		role = models.GroupRoleMember
+	}
+	if !models.IsValidGroupRole(role) {
+		return &ValidationError{Message: "invalid membership", Violations: []string{"role must be owner or member"}}
+	}
+
+	group, err := s.findLocal(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, actor, group); err != nil {
+		return err
+	}
+
+	user, err := s.UserRepo.FindByPublicID(ctx, userPublicID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Repo.SetMember(ctx, group.ID, user.ID, role); err != nil {
+		return err
+	}
+
+	log.WithField("group_id", group.PublicID).WithField("user_id", user.ID).WithField("role", role).
+		WithField("actor_id", actor.PublicID).Info("Group member set")
+	return nil
+}
+
+// RemoveMember removes a user from a local group. Admins and the group's
+// owners manage members.
+func (s *GroupService) RemoveMember(ctx context.Context, actor *models.User, publicID, userPublicID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	group, err := s.findLocal(ctx, publicID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, actor, group); err != nil {
+		return err
+	}
+
+	user, err := s.UserRepo.FindByPublicID(ctx, userPublicID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Repo.FindMember(ctx, group.ID, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.Repo.RemoveMembers(ctx, group.ID, []uint{user.ID}); err != nil {
+		return err
+	}
+
+	log.WithField("group_id", group.PublicID).WithField("user_id", user.ID).WithField("actor_id", actor.PublicID).Info("Group member removed")
+	return nil
+}
+
+// UserGroups lists the groups a user is a member of, directly or through a
+// group nested in them
+func (s *GroupService) UserGroups(ctx context.Context, user *models.User) ([]models.Group, error) {
+	groups, err := s.Repo.ListUserGroups(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.present(ctx, groupPointers(groups)); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Claims returns the groups to list in a user's tokens, flagging the overflow
+// instead when there are more than the configured limit
+func (s *GroupService) Claims(ctx context.Context, user *models.User) (utils.GroupClaims, error) {
+	groups, err := s.Repo.ListUserGroups(ctx, user.ID)
+	if err != nil {
+		s.Logger.WithContext(ctx).WithError(err).WithField("user_id", user.ID).Error("Failed to list groups for token")
+		return utils.GroupClaims{}, err
+	}
+
+	ids := make([]string, len(groups))
+	for i, group := range groups {
+		ids[i] = group.PublicID
+	}
+	return utils.NewGroupClaims(ids, s.Config.Groups.ClaimLimit), nil
+}
+
+// findLocal finds a group by public ID that is managed here
+func (s *GroupService) findLocal(ctx context.Context, publicID string) (*models.Group, error) {
+	group, err := s.Repo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.IsLocal() {
+		return nil, ErrGroupManagedExternally
+	}
+	return group, nil
+}
+
+// authorize allows admins and the group's owners to manage the group
+func (s *GroupService) authorize(ctx context.Context, actor *models.User, group *models.Group) error {
+	if actor.IsAdmin() {
+		return nil
+	}
+
+	member, err := s.Repo.FindMember(ctx, group.ID, actor.ID)
+	if errors.Is(err, repositories.ErrGroupMemberNotFound) {
+		return ErrGroupForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if member.Role != models.GroupRoleOwner {
+		return ErrGroupForbidden
+	}
+	return nil
+}
+
+// validate checks a local group's details, and that no other local group
+// than the one with id has its name
+func (s *GroupService) validate(ctx context.Context, group *models.Group, id uint) error {
+	var violations []string
+	if group.Name == "" || len(group.Name) > 255 {
+		violations = append(violations, "name must be 1-255 characters")
+	}
+	if len(group.Description) > 500 {
+		violations = append(violations, "description must be at most 500 characters")
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid group", Violations: violations}
+	}
+
+	existing, _, err := s.Repo.List(ctx, repositories.GroupFilter{Local: true, Name: group.Name}, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && existing[0].ID != id {
+		return ErrGroupNameTaken
+	}
+	return nil
+}
+
+// setParent nests a group in the local group with parentID, or moves it to
+// the top level when parentID is empty. A group cannot be nested in itself or
+// in one of its subgroups.
+func (s *GroupService) setParent(ctx context.Context, group *models.Group, parentID string) error {
+	if parentID == "" {
+		group.ParentID = nil
+		return nil
+	}
+
+	parent, err := s.findLocal(ctx, parentID)
+	if err != nil {
+		return err
+	}
+
+	descendants, err := s.Repo.DescendantIDs(ctx, group.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == parent.ID {
+			return ErrGroupCycle
+		}
+	}
+
+	group.ParentID = &parent.ID
+	return nil
+}
+
+// present fills in the public IDs of the groups' parents
+func (s *GroupService) present(ctx context.Context, groups []*models.Group) error {
+	parents := make(map[uint]string)
+	for _, group := range groups {
+		group.ParentPublicID = ""
+		if group.ParentID == nil {
+			continue
+		}
+
+		publicID, ok := parents[*group.ParentID]
+		if !ok {
+			parent, err := s.Repo.FindByID(ctx, *group.ParentID)
+			if err != nil {
+				return err
+			}
+			publicID = parent.PublicID
+			parents[*group.ParentID] = publicID
+		}
+		group.ParentPublicID = publicID
+	}
+	return nil
+}
+
+// groupPointers returns pointers to the elements of groups
+func groupPointers(groups []models.Group) []*models.Group {
+	pointers := make([]*models.Group, len(groups))
+	for i := range groups {
+		pointers[i] = &groups[i]
+	}
+	return pointers
+}
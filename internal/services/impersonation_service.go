@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrImpersonationNotAllowed is returned when an admin may not impersonate a user
+var ErrImpersonationNotAllowed = errors.New("user cannot be impersonated")
+
+// ErrImpersonationInactive is returned for impersonation tokens whose
+// impersonation has ended or expired, or whose admin lost their role
+var ErrImpersonationInactive = errors.New("impersonation is no longer active")
+
+// ImpersonationService lets admins act as other users, keeping an audit trail
+// of every request they make
+type ImpersonationService struct {
+	Repo     repositories.ImpersonationRepository
+	UserRepo repositories.UserRepository
+	Config   *config.Config
+	Logger   *utils.Logger
+}
+
+// NewImpersonationService creates a new impersonation service
+func NewImpersonationService(repo repositories.ImpersonationRepository, userRepo repositories.UserRepository, cfg *config.Config, logger *utils.Logger) *ImpersonationService {
+	return &ImpersonationService{
+		Repo:     repo,
+		UserRepo: userRepo,
+		Config:   cfg,
+		Logger:   logger,
+	}
+}
+
+// Start begins an admin's impersonation of a user and returns a token that
+// acts as the user until it expires. Admins cannot be impersonated, so an
+// impersonation never grants admin access.
+func (s *ImpersonationService) Start(ctx context.Context, actor *models.User, targetPublicID, reason string) (string, *models.Impersonation, error) {
+	log := s.Logger.WithContext(ctx)
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 500 {
+		return "", nil, &ValidationError{Message: "invalid impersonation", Violations: []string{"reason must be 1-500 characters"}}
+	}
+
+	user, err := s.UserRepo.FindByPublicID(ctx, targetPublicID)
+	if err != nil {
+		log.WithError(err).WithField("public_id", targetPublicID).Warn("Failed to find user to impersonate")
+		return "", nil, err
+	}
+	if user.ID == actor.ID || user.IsAdmin() {
+		log.WithField("actor_id", actor.PublicID).WithField("user_id", user.ID).Warn("Impersonation not allowed")
+		return "", nil, ErrImpersonationNotAllowed
+	}
+	if err := checkAccountStatus(user); err != nil {
+		return "", nil, err
+	}
+
+	ttl := time.Duration(s.Config.Impersonation.TTL) * time.Minute
+	impersonation := &models.Impersonation{
+		PublicID:  models.NewPublicID(),
+		ActorID:   actor.PublicID,
+		UserID:    user.ID,
+		Reason:    reason,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.Repo.Create(ctx, impersonation); err != nil {
+		return "", nil, err
+	}
+
+	token, err := utils.GenerateImpersonationToken(user.PublicID, actor.PublicID, impersonation.PublicID, s.Config.JWT.Secret, ttl)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate impersonation token")
+		return "", nil, err
+	}
+
+	log.WithField("actor_id", actor.PublicID).WithField("user_id", user.ID).WithField("impersonation_id", impersonation.PublicID).
+		WithField("reason", reason).Warn("Admin started impersonating user")
+	return token, impersonation, nil
+}
+
+// Authenticate returns the active impersonation an impersonation token was
+// issued for. The admin must still be an active admin.
+func (s *ImpersonationService) Authenticate(ctx context.Context, claims *utils.JWTClaims, user *models.User) (*models.Impersonation, error) {
+	impersonation, err := s.Repo.FindByPublicID(ctx, claims.ID)
+	if errors.Is(err, repositories.ErrImpersonationNotFound) {
+		return nil, ErrImpersonationInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if impersonation.UserID != user.ID || impersonation.ActorID != claims.Act.Subject || !impersonation.IsActive(time.Now()) {
+		return nil, ErrImpersonationInactive
+	}
+
+	actor, err := s.UserRepo.FindByPublicID(ctx, impersonation.ActorID)
+	if err != nil || !actor.IsAdmin() || checkAccountStatus(actor) != nil {
+		return nil, ErrImpersonationInactive
+	}
+
+	return impersonation, nil
+}
+
+// RecordEvent adds a request made during an impersonation to its audit trail
+func (s *ImpersonationService) RecordEvent(ctx context.Context, impersonation *models.Impersonation, event *models.ImpersonationEvent) {
+	event.ImpersonationID = impersonation.ID
+	event.ActorID = impersonation.ActorID
+	event.UserID = impersonation.UserID
+
+	log := s.Logger.WithContext(ctx).WithField("actor_id", event.ActorID).WithField("user_id", event.UserID).WithField("impersonation_id", impersonation.PublicID)
+	log.WithField("method", event.Method).WithField("path", event.Path).WithField("status", event.Status).Info("Impersonated request")
+	if err := s.Repo.CreateEvent(ctx, event); err != nil {
+		log.WithError(err).Error("Failed to record impersonated request")
+	}
+}
+
+// End ends an impersonation before it expires
+func (s *ImpersonationService) End(ctx context.Context, impersonation *models.Impersonation) error {
+	if err := s.Repo.End(ctx, impersonation.ID, time.Now()); err != nil {
+		return err
+	}
+	s.Logger.WithContext(ctx).WithField("actor_id", impersonation.ActorID).WithField("impersonation_id", impersonation.PublicID).Info("Admin stopped impersonating user")
+	return nil
+}
+
+// ListForUser lists the impersonations of a user, newest first
+func (s *ImpersonationService) ListForUser(ctx context.Context, targetPublicID string) ([]models.Impersonation, error) {
+	user, err := s.UserRepo.FindByPublicID(ctx, targetPublicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.ListByUser(ctx, user.ID)
+}
+
+// ListEvents lists the requests made during an impersonation
+func (s *ImpersonationService) ListEvents(ctx context.Context, publicID string) ([]models.ImpersonationEvent, error) {
+	impersonation, err := s.Repo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.ListEvents(ctx, impersonation.ID)
+}
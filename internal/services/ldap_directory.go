@@ -0,0 +1,250 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// Defaults of an LDAP directory's configuration
+const (
+	ldapDefaultFilter      = "(objectClass=person)"
+	ldapDefaultIDAttribute = "entryUUID"
+	ldapDefaultPageSize    = 500
+	ldapMaxPageSize        = 5000
+)
+
+// Fields of models.User an LDAP attribute can be mapped to. Custom profile
+// attributes are mapped as "attributes.<name>".
+const (
+	ldapFieldEmail      = "email"
+	ldapFieldName       = "name"
+	ldapAttributePrefix = "attributes."
+)
+
+// ldapProviderPrefix prefixes the identity provider name of the identities
+// that mark the users a directory manages
+const ldapProviderPrefix = "ldap:"
+
+// LDAPDirectoryConfig configures the synchronization of users with an LDAP directory
+type LDAPDirectoryConfig struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	URL             string `json:"url"` // ldap:// or ldaps://
+	BindDN          string `json:"bind_dn"`
+	BindPassword    string `json:"bind_password"`
+	BindPasswordEnv string `json:"bind_password_env"`
+	// CACertificate is a PEM certificate to trust instead of the system roots for ldaps://
+	CACertificate string `json:"ca_certificate"`
+	BaseDN        string `json:"base_dn"`
+	Filter        string `json:"filter"`
+	PageSize      int    `json:"page_size"`
+	// IDAttribute holds the stable identifier of an entry, such as entryUUID or objectGUID
+	IDAttribute string `json:"id_attribute"`
+	// AttributeMapping maps user fields to the names of the LDAP attributes that carry them
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	// SyncInterval is the number of minutes between scheduled syncs, 0 to only sync on demand
+	SyncInterval int `json:"sync_interval_minutes"`
+}
+
+// LDAPDirectory is an LDAP directory users are synchronized with
+type LDAPDirectory struct {
+	LDAPDirectoryConfig
+	TLSConfig *tls.Config
+}
+
+// LoadLDAPDirectories loads the LDAP directories from a JSON file
+func LoadLDAPDirectories(path string) ([]*LDAPDirectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Directories []LDAPDirectoryConfig `json:"directories"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid LDAP directories file: %w", err)
+	}
+
+	directories := make([]*LDAPDirectory, 0, len(file.Directories))
+	seen := make(map[string]bool)
+	for _, cfg := range file.Directories {
+		if cfg.BindPasswordEnv != "" {
+			cfg.BindPassword = os.Getenv(cfg.BindPasswordEnv)
+		}
+		if seen[cfg.ID] {
+			return nil, fmt.Errorf("directory %q: duplicate id", cfg.ID)
+		}
+		seen[cfg.ID] = true
+
+		directory, err := NewLDAPDirectory(cfg)
+		if err != nil {
+			return nil, err
+		}
+		directories = append(directories, directory)
+	}
+	return directories, nil
+}
+
+// NewLDAPDirectory validates a directory's configuration and fills in defaults
+func NewLDAPDirectory(cfg LDAPDirectoryConfig) (*LDAPDirectory, error) {
+	if !isValidTenantID(cfg.ID) {
+		return nil, fmt.Errorf("directory %q: id must be 1-40 characters without spaces or URL delimiters", cfg.ID)
+	}
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("directory %q: name is required", cfg.ID)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("directory %q: url must be an ldap:// or ldaps:// URL", cfg.ID)
+	}
+	if cfg.BaseDN == "" {
+		return nil, fmt.Errorf("directory %q: base_dn is required", cfg.ID)
+	}
+
+	if cfg.Filter == "" {
+		cfg.Filter = ldapDefaultFilter
+	}
+	if _, err := utils.CompileLDAPFilter(cfg.Filter); err != nil {
+		return nil, fmt.Errorf("directory %q: %w", cfg.ID, err)
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = ldapDefaultPageSize
+	}
+	cfg.PageSize = min(cfg.PageSize, ldapMaxPageSize)
+	if cfg.IDAttribute == "" {
+		cfg.IDAttribute = ldapDefaultIDAttribute
+	}
+	if cfg.SyncInterval < 0 {
+		return nil, fmt.Errorf("directory %q: sync_interval_minutes cannot be negative", cfg.ID)
+	}
+
+	mapping := map[string]string{ldapFieldEmail: "mail", ldapFieldName: "cn"}
+	for field, attribute := range cfg.AttributeMapping {
+		if field != ldapFieldEmail && field != ldapFieldName && !strings.HasPrefix(field, ldapAttributePrefix) {
+			return nil, fmt.Errorf("directory %q: cannot map to unknown field %q", cfg.ID, field)
+		}
+		mapping[field] = attribute
+	}
+	cfg.AttributeMapping = mapping
+
+	directory := &LDAPDirectory{LDAPDirectoryConfig: cfg}
+	if cfg.CACertificate != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(cfg.CACertificate)) {
+			return nil, fmt.Errorf("directory %q: ca_certificate is not a PEM certificate", cfg.ID)
+		}
+		directory.TLSConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return directory, nil
+}
+
+// ldapProvider is the identity provider name of a directory's identities
+func ldapProvider(directoryID string) string {
+	return ldapProviderPrefix + directoryID
+}
+
+// ldapUser is the user a directory entry describes
+type ldapUser struct {
+	DN         string
+	Subject    string
+	Email      string
+	Name       string
+	Attributes models.Attributes
+}
+
+// searchAttributes lists the attributes a search must return
+func (d *LDAPDirectory) searchAttributes() []string {
+	attributes := []string{d.IDAttribute}
+	for _, attribute := range d.AttributeMapping {
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+// customAttributes lists the custom profile attributes the directory manages
+func (d *LDAPDirectory) customAttributes() []string {
+	var attributes []string
+	for field := range d.AttributeMapping {
+		if attribute, ok := strings.CutPrefix(field, ldapAttributePrefix); ok {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// user maps a directory entry to a user. It returns a reason instead when
+// the entry cannot be synchronized.
+func (d *LDAPDirectory) user(entry *utils.LDAPEntry, foldLocalPart bool) (*ldapUser, string) {
+	user := &ldapUser{
+		DN:         entry.DN,
+		Subject:    ldapSubject(d.IDAttribute, entry.Values(d.IDAttribute)),
+		Email:      strings.TrimSpace(entry.Value(d.AttributeMapping[ldapFieldEmail])),
+		Name:       strings.TrimSpace(entry.Value(d.AttributeMapping[ldapFieldName])),
+		Attributes: models.Attributes{},
+	}
+	if user.Subject == "" {
+		return nil, "entry has no " + d.IDAttribute
+	}
+	if len(user.Subject) > 255 {
+		return nil, "entry's " + d.IDAttribute + " is too long"
+	}
+	if user.Email == "" {
+		return nil, "entry has no email"
+	}
+	if _, err := utils.NormalizeEmail(user.Email, foldLocalPart); err != nil {
+		return nil, "entry has an invalid email"
+	}
+	if len(user.Name) > 100 {
+		user.Name = user.Name[:100]
+	}
+
+	for field, name := range d.AttributeMapping {
+		attribute, ok := strings.CutPrefix(field, ldapAttributePrefix)
+		values := entry.Values(name)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if len(values) == 1 {
+			user.Attributes[attribute] = string(values[0])
+			continue
+		}
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = string(value)
+		}
+		user.Attributes[attribute] = list
+	}
+	return user, ""
+}
+
+// ldapSubject formats an entry's identifier. Active Directory's binary
+// objectGUID is formatted the way AD displays it, other binary values as hex.
+func ldapSubject(attribute string, values [][]byte) string {
+	if len(values) == 0 {
+		return ""
+	}
+	value := values[0]
+	if strings.EqualFold(attribute, "objectGUID") && len(value) == 16 {
+		// The first three fields are little-endian
+		return fmt.Sprintf("%x-%x-%x-%x-%x",
+			[]byte{value[3], value[2], value[1], value[0]},
+			[]byte{value[5], value[4]},
+			[]byte{value[7], value[6]},
+			value[8:10], value[10:])
+	}
+	if !utf8.Valid(value) {
+		return hex.EncodeToString(value)
+	}
+	return strings.TrimSpace(string(value))
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ldapTimeout bounds connecting to a directory and each request to it
+const ldapTimeout = 30 * time.Second
+
+// Errors returned by LDAPSyncService
+var (
+	ErrLDAPDirectoryNotFound = errors.New("LDAP directory not found")
+	ErrLDAPSyncInProgress    = errors.New("a sync of this directory is already running")
+)
+
+// LDAPSyncService synchronizes users with LDAP directories. Each directory
+// manages the users it created: they are updated to match their entries and
+// deactivated once their entries are gone. Accounts the directory did not
+// create are never taken over.
+type LDAPSyncService struct {
+	SyncRunRepo   repositories.LDAPSyncRunRepository
+	UserRepo      repositories.UserRepository
+	IdentityRepo  repositories.IdentityRepository
+	UserService   *UserService
+	StatusService *UserStatusService
+	Directories   []*LDAPDirectory
+	Config        *config.Config
+	Logger        *utils.Logger
+
+	mu       sync.Mutex
+	running  map[string]bool
+	lastSync map[string]time.Time
+}
+
+// NewLDAPSyncService creates a new LDAP sync service
+func NewLDAPSyncService(syncRunRepo repositories.LDAPSyncRunRepository, userRepo repositories.UserRepository, identityRepo repositories.IdentityRepository, userService *UserService, statusService *UserStatusService, directories []*LDAPDirectory, config *config.Config, logger *utils.Logger) *LDAPSyncService {
+	return &LDAPSyncService{
+		SyncRunRepo:   syncRunRepo,
+		UserRepo:      userRepo,
+		IdentityRepo:  identityRepo,
+		UserService:   userService,
+		StatusService: statusService,
+		Directories:   directories,
+		Config:        config,
+		Logger:        logger,
+		running:       make(map[string]bool),
+		lastSync:      make(map[string]time.Time),
+	}
+}
+
+// Directory finds a configured directory
+func (s *LDAPSyncService) Directory(id string) (*LDAPDirectory, error) {
+	for _, directory := range s.Directories {
+		if directory.ID == id {
+			return directory, nil
+		}
+	}
+	return nil, ErrLDAPDirectoryNotFound
+}
+
+// Sync synchronizes the users of a directory and records the run. A dry run
+// only reports the changes. actor is the admin who started the run, nil for
+// scheduled runs. A run that fails, for example because the directory is
+// unreachable, is recorded and returned with the failed status.
+func (s *LDAPSyncService) Sync(ctx context.Context, directoryID string, dryRun bool, actor *models.User) (*models.LDAPSyncRun, error) {
+	log := s.Logger.WithContext(ctx).WithField("directory", directoryID)
+
+	directory, err := s.Directory(directoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.running[directoryID] {
+		s.mu.Unlock()
+		return nil, ErrLDAPSyncInProgress
+	}
+	s.running[directoryID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, directoryID)
+		s.mu.Unlock()
+	}()
+
+	run := &models.LDAPSyncRun{
+		PublicID:  models.NewPublicID(),
+		Directory: directoryID,
+		DryRun:    dryRun,
+		Status:    models.LDAPSyncRunning,
+		StartedAt: time.Now(),
+	}
+	if actor != nil {
+		run.ActorID = actor.PublicID
+	}
+	if err := s.SyncRunRepo.Create(ctx, run); err != nil {
+		return nil, err
+	}
+
+	run.Status = models.LDAPSyncSucceeded
+	if err := s.sync(ctx, directory, run); err != nil {
+		log.WithError(err).Error("LDAP sync failed")
+		run.Status = models.LDAPSyncFailed
+		run.Error = err.Error()
+		if len(run.Error) > 1000 {
+			run.Error = run.Error[:1000]
+		}
+	}
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if err := s.SyncRunRepo.Update(ctx, run); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"run_id":      run.PublicID,
+		"dry_run":     dryRun,
+		"status":      run.Status,
+		"entries":     run.Entries,
+		"created":     run.Created,
+		"updated":     run.Updated,
+		"deactivated": run.Deactivated,
+		"reactivated": run.Reactivated,
+		"conflicts":   run.Conflicts,
+		"skipped":     run.Skipped,
+		"failed":      run.Failed,
+	}).Info("LDAP sync finished")
+	return run, nil
+}
+
+// GetRun gets a sync run with its changes
+func (s *LDAPSyncService) GetRun(ctx context.Context, publicID string) (*models.LDAPSyncRun, error) {
+	return s.SyncRunRepo.FindByPublicID(ctx, publicID)
+}
+
+// ListRuns lists the most recent sync runs, optionally of one directory
+func (s *LDAPSyncService) ListRuns(ctx context.Context, directoryID string, limit int) ([]models.LDAPSyncRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.SyncRunRepo.List(ctx, directoryID, limit)
+}
+
+// RunScheduler syncs each directory with a sync interval once it is due,
+// checking every interval until ctx is cancelled. Directories are first
+// synced on the first check after startup.
+func (s *LDAPSyncService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, directory := range s.Directories {
+				if directory.SyncInterval == 0 || now.Sub(s.lastSync[directory.ID]) < time.Duration(directory.SyncInterval)*time.Minute {
+					continue
+				}
+				s.lastSync[directory.ID] = now
+
+				_, err := s.Sync(utils.NewRequestContext(), directory.ID, false, nil)
+				if err != nil && !errors.Is(err, ErrLDAPSyncInProgress) {
+					s.Logger.WithError(err).WithField("directory", directory.ID).Warn("Scheduled LDAP sync failed")
+				}
+			}
+		}
+	}
+}
+
+// sync compares the directory's entries with the users it manages and
+// applies the differences, unless the run is a dry run
+func (s *LDAPSyncService) sync(ctx context.Context, directory *LDAPDirectory, run *models.LDAPSyncRun) error {
+	entries, err := s.search(directory, run)
+	if err != nil {
+		return err
+	}
+
+	identities, err := s.IdentityRepo.ListByProvider(ctx, ldapProvider(directory.ID))
+	if err != nil {
+		return err
+	}
+	users := make(map[uint]*models.User)
+	err = s.UserRepo.Stream(ctx, repositories.UserFilter{IdentityProvider: ldapProvider(directory.ID)}, func(user *models.User) error {
+		users[user.ID] = user
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// An empty result is far more likely a wrong filter or base DN than an
+	// empty directory, and would deactivate every user
+	if len(entries) == 0 && len(users) > 0 {
+		return errors.New("the directory returned no users, refusing to deactivate every user it manages")
+	}
+
+	managed := make(map[string]*models.Identity, len(identities))
+	for i := range identities {
+		managed[identities[i].Subject] = &identities[i]
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if seen[entry.Subject] {
+			s.record(run, &models.LDAPSyncChange{Action: models.LDAPSyncSkip, DN: entry.DN, Reason: "another entry has the same " + directory.IDAttribute}, nil)
+			continue
+		}
+		seen[entry.Subject] = true
+
+		identity, ok := managed[entry.Subject]
+		if !ok {
+			s.create(ctx, directory, run, entry)
+			continue
+		}
+
+		user := users[identity.UserID]
+		if user == nil {
+			s.record(run, &models.LDAPSyncChange{Action: models.LDAPSyncSkip, DN: entry.DN, Email: entry.Email, Reason: "the user's account was deleted"}, nil)
+			continue
+		}
+		s.update(ctx, directory, run, entry, user, identity)
+	}
+
+	for _, identity := range identities {
+		user := users[identity.UserID]
+		if seen[identity.Subject] || user == nil || user.Status == models.StatusDeactivated {
+			continue
+		}
+
+		change := &models.LDAPSyncChange{Action: models.LDAPSyncDeactivate, UserID: user.PublicID, Email: user.Email, Reason: "no longer in the directory"}
+		var err error
+		if !run.DryRun {
+			_, err = s.StatusService.ChangeStatus(ctx, nil, user.PublicID, models.StatusDeactivated, ldapDeactivationReason(directory.ID), nil)
+		}
+		s.record(run, change, err)
+	}
+	return nil
+}
+
+// search reads the directory's entries, recording those that cannot be synchronized
+func (s *LDAPSyncService) search(directory *LDAPDirectory, run *models.LDAPSyncRun) ([]*ldapUser, error) {
+	conn, err := utils.DialLDAP(directory.URL, directory.TLSConfig, ldapTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the directory: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(directory.BindDN, directory.BindPassword); err != nil {
+		return nil, fmt.Errorf("binding to the directory: %w", err)
+	}
+
+	var entries []*ldapUser
+	search := utils.LDAPSearch{
+		BaseDN:     directory.BaseDN,
+		Scope:      utils.LDAPScopeWholeSubtree,
+		Filter:     directory.Filter,
+		Attributes: directory.searchAttributes(),
+	}
+	err = conn.SearchPaged(search, directory.PageSize, func(entry *utils.LDAPEntry) error {
+		run.Entries++
+		user, reason := directory.user(entry, s.Config.Email.FoldLocalPart)
+		if user == nil {
+			s.record(run, &models.LDAPSyncChange{Action: models.LDAPSyncSkip, DN: entry.DN, Reason: reason}, nil)
+			return nil
+		}
+		entries = append(entries, user)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching the directory: %w", err)
+	}
+	return entries, nil
+}
+
+// create provisions the user of a new entry, unless its email belongs to an
+// account the directory does not manage
+func (s *LDAPSyncService) create(ctx context.Context, directory *LDAPDirectory, run *models.LDAPSyncRun, entry *ldapUser) {
+	existing, err := s.UserRepo.FindByEmail(ctx, entry.Email)
+	if err == nil {
+		s.record(run, &models.LDAPSyncChange{Action: models.LDAPSyncConflict, DN: entry.DN, UserID: existing.PublicID, Email: entry.Email, Reason: "the email belongs to an account the directory does not manage"}, nil)
+		return
+	}
+
+	change := &models.LDAPSyncChange{Action: models.LDAPSyncCreate, DN: entry.DN, Email: entry.Email, Fields: map[string]models.LDAPSyncFieldChange{}}
+	if !errors.Is(err, repositories.ErrUserNotFound) {
+		s.record(run, change, err)
+		return
+	}
+	if entry.Name != "" {
+		change.Fields[ldapFieldName] = models.LDAPSyncFieldChange{To: entry.Name}
+	}
+	for attribute, value := range entry.Attributes {
+		change.Fields[ldapAttributePrefix+attribute] = models.LDAPSyncFieldChange{To: value}
+	}
+	if run.DryRun {
+		s.record(run, change, nil)
+		return
+	}
+
+	user, err := s.UserService.ProvisionUserWithIdentity(ctx, entry.Name, entry.Email, entry.Attributes, &models.Identity{
+		PublicID: models.NewPublicID(),
+		Provider: ldapProvider(directory.ID),
+		Subject:  entry.Subject,
+	}, models.StatusActive)
+	if err == nil {
+		change.UserID = user.PublicID
+	}
+	s.record(run, change, err)
+}
+
+// update brings a managed user in line with its entry, reactivating the
+// user if the sync deactivated it. Users an admin deactivated stay deactivated.
+func (s *LDAPSyncService) update(ctx context.Context, directory *LDAPDirectory, run *models.LDAPSyncRun, entry *ldapUser, user *models.User, identity *models.Identity) {
+	fields := map[string]models.LDAPSyncFieldChange{}
+	name, email, attributes := "", "", models.Attributes{}
+	if entry.Name != "" && entry.Name != user.Name {
+		name = entry.Name
+		fields[ldapFieldName] = models.LDAPSyncFieldChange{From: user.Name, To: entry.Name}
+	}
+	if entry.Email != user.Email {
+		email = entry.Email
+		fields[ldapFieldEmail] = models.LDAPSyncFieldChange{From: user.Email, To: entry.Email}
+	}
+	for _, attribute := range directory.customAttributes() {
+		current, has := user.Attributes[attribute]
+		value, ok := entry.Attributes[attribute]
+		if (!has && !ok) || (has && ok && reflect.DeepEqual(current, value)) {
+			continue
+		}
+		// A nil value removes the attribute
+		attributes[attribute] = value
+		fields[ldapAttributePrefix+attribute] = models.LDAPSyncFieldChange{From: current, To: value}
+	}
+
+	if len(fields) > 0 {
+		change := &models.LDAPSyncChange{Action: models.LDAPSyncUpdate, DN: entry.DN, UserID: user.PublicID, Email: entry.Email, Fields: fields}
+		var err error
+		if !run.DryRun {
+			if _, err = s.UserService.UpdateUser(ctx, user.ID, name, email, attributes); err == nil && email != "" {
+				identity.Email = email
+				err = s.IdentityRepo.Update(ctx, identity)
+			}
+		}
+		s.record(run, change, err)
+	}
+
+	if user.Status == models.StatusDeactivated {
+		deactivatedBySync, err := s.deactivatedBySync(ctx, directory, user)
+		if err != nil || !deactivatedBySync {
+			s.record(run, &models.LDAPSyncChange{Action: models.LDAPSyncSkip, DN: entry.DN, UserID: user.PublicID, Email: entry.Email, Reason: "the user was deactivated outside the directory sync"}, err)
+			return
+		}
+
+		change := &models.LDAPSyncChange{Action: models.LDAPSyncReactivate, DN: entry.DN, UserID: user.PublicID, Email: entry.Email, Reason: "back in the directory"}
+		if !run.DryRun {
+			_, err = s.StatusService.ChangeStatus(ctx, nil, user.PublicID, models.StatusActive, "restored to LDAP directory "+directory.ID, nil)
+		}
+		s.record(run, change, err)
+	}
+}
+
+// deactivatedBySync reports whether a deactivated user was last deactivated
+// by a sync of the directory rather than by an admin
+func (s *LDAPSyncService) deactivatedBySync(ctx context.Context, directory *LDAPDirectory, user *models.User) (bool, error) {
+	transitions, err := s.StatusService.StatusRepo.ListTransitions(ctx, user.ID)
+	if err != nil || len(transitions) == 0 {
+		return false, err
+	}
+	last := transitions[0]
+	return last.ToStatus == models.StatusDeactivated && last.ActorID == "" && last.Reason == ldapDeactivationReason(directory.ID), nil
+}
+
+// ldapDeactivationReason is the status change reason of users a sync of the
+// directory deactivated
+func ldapDeactivationReason(directoryID string) string {
+	return "removed from LDAP directory " + directoryID
+}
+
+// record adds a change to a run and counts it, or counts it as failed if
+// applying it returned an error
+func (s *LDAPSyncService) record(run *models.LDAPSyncRun, change *models.LDAPSyncChange, err error) {
+	if err != nil {
+		change.Error = err.Error()
+		run.Failed++
+		run.Changes = append(run.Changes, *change)
+		return
+	}
+
+	switch change.Action {
+	case models.LDAPSyncCreate:
+		run.Created++
+	case models.LDAPSyncUpdate:
+		run.Updated++
+	case models.LDAPSyncDeactivate:
+		run.Deactivated++
+	case models.LDAPSyncReactivate:
+		run.Reactivated++
+	case models.LDAPSyncConflict:
+		run.Conflicts++
+	case models.LDAPSyncSkip:
+		run.Skipped++
+	}
+	run.Changes = append(run.Changes, *change)
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// magicLinkRateWindow is the period the per-email rate limit applies to. Links
+// are kept that long, so MAGIC_LINK_TTL_MINUTES cannot exceed it.
+const magicLinkRateWindow = time.Hour
+
+// ErrMagicLinkInvalid is returned for unknown, used or expired magic links
+var ErrMagicLinkInvalid = errors.New("magic link is invalid or has expired")
+
+// ErrMagicLinkWrongBrowser is returned when a link bound to the browser that
+// requested it is opened in another one. The link stays usable.
+var ErrMagicLinkWrongBrowser = errors.New("magic link must be opened in the browser that requested it")
+
+// MagicLinkService handles passwordless sign-in through links sent by email
+type MagicLinkService struct {
+	LinkRepo     repositories.MagicLinkRepository
+	UserRepo     repositories.UserRepository
+	IdentityRepo repositories.IdentityRepository
+	UserService  *UserService
+	Mailer       utils.Mailer
+	Connections  []*SAMLConnection
+	Config       *config.Config
+	Logger       *utils.Logger
+}
+
+// NewMagicLinkService creates a new magic link service. The SAML connections
+// are the tenants that may enable or disable magic links for their users.
+func NewMagicLinkService(linkRepo repositories.MagicLinkRepository, userRepo repositories.UserRepository, identityRepo repositories.IdentityRepository, userService *UserService, mailer utils.Mailer, connections []*SAMLConnection, config *config.Config, logger *utils.Logger) *MagicLinkService {
+	return &MagicLinkService{
+		LinkRepo:     linkRepo,
+		UserRepo:     userRepo,
+		IdentityRepo: identityRepo,
+		UserService:  userService,
+		Mailer:       mailer,
+		Connections:  connections,
+		Config:       config,
+		Logger:       logger,
+	}
+}
+
+// Enabled reports whether any user may sign in with magic links
+func (s *MagicLinkService) Enabled() bool {
+	if s.Config.MagicLink.Enabled {
+		return true
+	}
+	for _, connection := range s.Connections {
+		if connection.MagicLink != nil && *connection.MagicLink {
+			return true
+		}
+	}
+	return false
+}
+
+// Request emails a sign-in link to the account with an email. To not reveal
+// which emails have accounts, it succeeds whether or not a link is sent.
+// With sameBrowser, it returns a nonce the requesting browser must present
+// together with the link.
+func (s *MagicLinkService) Request(ctx context.Context, email string, sameBrowser bool) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	// The nonce is generated for every request, so the response does not differ either
+	var binding string
+	if sameBrowser {
+		var err error
+		if binding, err = utils.GenerateOpaqueToken("mlb"); err != nil {
+			return "", err
+		}
+	}
+
+	user, err := s.UserRepo.FindByEmail(ctx, email)
+	if err != nil {
+		log.WithField("email", email).Info("Magic link requested for unknown email")
+		return binding, nil
+	}
+	log = log.WithField("user_id", user.ID)
+
+	if err := checkAccountStatus(user); err != nil {
+		log.WithError(err).Warn("Magic link not sent to inactive account")
+		return binding, nil
+	}
+	allowed, err := s.allowed(ctx, user)
+	if err != nil {
+		return binding, nil
+	}
+	if !allowed {
+		log.Info("Magic link not sent, disabled for the user's tenant")
+		return binding, nil
+	}
+
+	now := time.Now()
+	count, err := s.LinkRepo.CountSince(ctx, user.ID, now.Add(-magicLinkRateWindow))
+	if err != nil {
+		return binding, nil
+	}
+	if count >= s.Config.MagicLink.RateLimit {
+		log.Warn("Magic link not sent, rate limit reached")
+		return binding, nil
+	}
+
+	token, err := utils.GenerateOpaqueToken(models.MagicLinkTokenKind)
+	if err != nil {
+		return "", err
+	}
+	body, err := s.mailBody(user, token)
+	if err != nil {
+		log.WithError(err).Error("Magic link not sent, invalid link URL")
+		return binding, nil
+	}
+	link := &models.MagicLink{
+		TokenHash: utils.HashOpaqueToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(time.Duration(s.Config.MagicLink.TTL) * time.Minute),
+	}
+	if binding != "" {
+		link.BindingHash = utils.HashOpaqueToken(binding)
+	}
+	if err := s.LinkRepo.Create(ctx, link); err != nil {
+		return binding, nil
+	}
+
+	// Sending in the background keeps the response time from revealing the account
+	msg := utils.MailMessage{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body:    body,
+	}
+	go func() {
+		if err := s.Mailer.Send(ctx, msg); err != nil {
+			log.WithError(err).Error("Failed to send magic link")
+		}
+	}()
+
+	log.Info("Magic link sent")
+	return binding, nil
+}
+
+// Consume signs in the user a magic link was sent to and returns a JWT
+// token. Each link can be used once; a link bound to a browser also needs
+// the nonce that browser was given. Users with a passkey get a
+// SecondFactorRequiredError instead, and finish signing in with it.
+func (s *MagicLinkService) Consume(ctx context.Context, token, binding string, client ClientInfo) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	link, err := s.LinkRepo.FindByTokenHash(ctx, utils.HashOpaqueToken(token))
+	if errors.Is(err, repositories.ErrMagicLinkNotFound) {
+		return "", ErrMagicLinkInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if link.UsedAt != nil || !now.Before(link.ExpiresAt) {
+		return "", ErrMagicLinkInvalid
+	}
+	if link.BindingHash != "" && subtle.ConstantTimeCompare([]byte(utils.HashOpaqueToken(binding)), []byte(link.BindingHash)) != 1 {
+		log.WithField("user_id", link.UserID).Warn("Magic link opened in another browser")
+		return "", ErrMagicLinkWrongBrowser
+	}
+
+	if err := s.LinkRepo.MarkUsed(ctx, link.ID, now); err != nil {
+		if errors.Is(err, repositories.ErrMagicLinkNotFound) {
+			return "", ErrMagicLinkInvalid
+		}
+		return "", err
+	}
+
+	user, err := s.UserRepo.FindByID(ctx, link.UserID)
+	if err != nil {
+		return "", ErrMagicLinkInvalid
+	}
+	// The tenant may have disabled magic links since the link was sent
+	allowed, err := s.allowed(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		log.WithField("user_id", user.ID).Warn("Magic link rejected, disabled for the user's tenant")
+		return "", ErrMagicLinkInvalid
+	}
+
+	// A link replaces the password, not the passkey users set up after it
+	if s.UserService.SecondFactor != nil {
+		if err := checkAccountStatus(user); err != nil {
+			return "", err
+		}
+		challenge, err := s.UserService.SecondFactor.BeginLinkSecondFactor(ctx, user)
+		if err != nil {
+			return "", err
+		}
+		if challenge != nil {
+			log.WithField("user_id", user.ID).Info("Magic link verified, second factor required")
+			return "", &SecondFactorRequiredError{Challenge: challenge}
+		}
+	}
+
+	return s.UserService.StartSession(ctx, user, client, utils.NewAuthentication(utils.AMROneTimeCode))
+}
+
+// PurgeExpired deletes links that no longer count towards the rate limit
+func (s *MagicLinkService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.LinkRepo.DeleteCreatedBefore(ctx, time.Now().Add(-magicLinkRateWindow))
+}
+
+// RunPurger purges old links every interval until ctx is cancelled
+func (s *MagicLinkService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Magic link purge failed")
+			}
+		}
+	}
+}
+
+// allowed reports whether a user may sign in with magic links. A user
+// belongs to the tenants that signed them in or provisioned them and to those
+// whose email domains include theirs. Tenants that configure magic links
+// override the global setting, and disabling wins over enabling.
+func (s *MagicLinkService) allowed(ctx context.Context, user *models.User) (bool, error) {
+	identities, err := s.IdentityRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	providers := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		providers[identity.Provider] = true
+	}
+
+	enabled := s.Config.MagicLink.Enabled
+	for _, connection := range s.Connections {
+		if connection.MagicLink == nil {
+			continue
+		}
+		member := providers["saml:"+connection.ID] || providers[scimProvider(connection.ID)] ||
+			(len(connection.EmailDomains) > 0 && connection.allowsEmail(user.Email))
+		if !member {
+			continue
+		}
+		if !*connection.MagicLink {
+			return false, nil
+		}
+		enabled = true
+	}
+	return enabled, nil
+}
+
+// mailBody writes the email that carries a link
+func (s *MagicLinkService) mailBody(user *models.User, token string) (string, error) {
+	link, err := url.Parse(s.Config.MagicLink.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return fmt.Sprintf("Hi %s,\n\nUse this link to sign in. It works once and expires in %d minutes.\n\n%s\n\nIf you did not ask to sign in, you can ignore this email.\n",
+		user.Name, s.Config.MagicLink.TTL, link), nil
+}
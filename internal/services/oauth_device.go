@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// Device authorization settings from RFC 8628
+const (
+	deviceCodeTTL          = 10 * time.Minute
+	devicePollInterval     = 5 // seconds
+	deviceSlowDownInterval = 5 // seconds added each time a device polls too fast
+)
+
+// userCodeAlphabet has no vowels, so user codes cannot spell words, and no
+// characters that are easily confused with each other
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength gives 20^8 combinations, enough for codes that expire in minutes
+const userCodeLength = 8
+
+// ErrInvalidUserCode is returned when a user code is unknown, expired or already used
+var ErrInvalidUserCode = errors.New("invalid or expired code")
+
+// DeviceAuthorization is the response to a device authorization request
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// DeviceGrant is a pending device authorization looked up by its user code
+type DeviceGrant struct {
+	Code     *models.OAuthDeviceCode
+	Client   *models.OAuthClient
+	UserCode string
+}
+
+// StartDeviceAuthorization authenticates a client and creates a device
+// authorization for the requested scopes, or the client's scopes if none are requested
+func (s *OAuthService) StartDeviceAuthorization(ctx context.Context, clientID, clientSecret, scope string) (*DeviceAuthorization, error) {
+	log := s.Logger.WithContext(ctx).WithField("client_id", clientID)
+
+	client, err := s.AuthenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := resolveScopes(client, scope, client.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := utils.GenerateOpaqueToken(models.OAuthDeviceCodeKind)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate device code")
+		return nil, err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		log.WithError(err).Error("Failed to generate user code")
+		return nil, err
+	}
+
+	code := &models.OAuthDeviceCode{
+		PublicID:       models.NewPublicID(),
+		DeviceCodeHash: utils.HashOpaqueToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ID,
+		Scopes:         scopes,
+		Status:         models.DeviceCodePending,
+		PollInterval:   devicePollInterval,
+		ExpiresAt:      time.Now().Add(deviceCodeTTL),
+	}
+	if err := s.GrantRepo.CreateDeviceCode(ctx, code); err != nil {
+		return nil, err
+	}
+
+	verificationURI := s.Config.OIDC.Issuer + "/oauth/device"
+	log.Info("Device authorization started")
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               deviceCodeTTL,
+		Interval:                devicePollInterval * time.Second,
+	}, nil
+}
+
+// LookupDeviceCode finds the pending device authorization a user code
+// belongs to. Codes are matched ignoring case, spaces and dashes.
+func (s *OAuthService) LookupDeviceCode(ctx context.Context, userCode string) (*DeviceGrant, error) {
+	normalized := normalizeUserCode(userCode)
+	if len(normalized) != userCodeLength {
+		return nil, ErrInvalidUserCode
+	}
+
+	code, err := s.GrantRepo.FindPendingDeviceCode(ctx, normalized, time.Now())
+	if errors.Is(err, repositories.ErrDeviceCodeNotFound) {
+		s.Logger.WithContext(ctx).Warn("Unknown or expired user code entered")
+		return nil, ErrInvalidUserCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.ClientRepo.FindByID(ctx, code.ClientID)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return nil, ErrInvalidUserCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeviceGrant{Code: code, Client: client, UserCode: formatUserCode(normalized)}, nil
+}
+
+// ApproveDeviceCode approves a device authorization for the user and
+// records their consent. authTime is when the user last entered their credentials.
+func (s *OAuthService) ApproveDeviceCode(ctx context.Context, user *models.User, grant *DeviceGrant, authTime time.Time) error {
+	code := *grant.Code
+	code.Status = models.DeviceCodeApproved
+	code.UserID = &user.ID
+	code.AuthTime = &authTime
+
+	if err := s.resolveDeviceCode(ctx, &code); err != nil {
+		return err
+	}
+	if err := s.GrantConsent(ctx, user.ID, &AuthorizationGrant{Client: grant.Client, Scopes: code.Scopes}); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("user_id", user.ID).WithField("client_id", grant.Client.PublicID).Info("Device authorization approved")
+	return nil
+}
+
+// DenyDeviceCode denies a device authorization, so the device stops polling
+func (s *OAuthService) DenyDeviceCode(ctx context.Context, user *models.User, grant *DeviceGrant) error {
+	code := *grant.Code
+	code.Status = models.DeviceCodeDenied
+	code.UserID = &user.ID
+
+	if err := s.resolveDeviceCode(ctx, &code); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("user_id", user.ID).WithField("client_id", grant.Client.PublicID).Info("Device authorization denied")
+	return nil
+}
+
+// ExchangeDeviceCode redeems an approved device code for tokens. Until the
+// user acts it returns authorization_pending, or slow_down if the device polls
+// faster than its interval, which then grows. Presenting a device code again
+// after tokens were issued revokes them.
+func (s *OAuthService) ExchangeDeviceCode(ctx context.Context, clientID, clientSecret, deviceCode string) (*TokenSet, error) {
+	log := s.Logger.WithContext(ctx).WithField("client_id", clientID)
+
+	client, err := s.AuthenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.GrantRepo.FindDeviceCode(ctx, utils.HashOpaqueToken(deviceCode))
+	if errors.Is(err, repositories.ErrDeviceCodeNotFound) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid device code"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ID {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid device code"}
+	}
+
+	now := time.Now()
+	if !now.Before(code.ExpiresAt) && code.Status != models.DeviceCodeUsed {
+		return nil, &OAuthError{Code: OAuthErrorExpiredToken, Description: "the device code has expired"}
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		interval := code.PollInterval
+		tooFast := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < time.Duration(interval)*time.Second
+		if tooFast {
+			interval += deviceSlowDownInterval
+		}
+		if err := s.GrantRepo.RecordDevicePoll(ctx, code.ID, now, interval); err != nil {
+			return nil, err
+		}
+		if tooFast {
+			return nil, &OAuthError{Code: OAuthErrorSlowDown, Description: "poll less often"}
+		}
+		return nil, &OAuthError{Code: OAuthErrorAuthorizationPending}
+	case models.DeviceCodeDenied:
+		return nil, &OAuthError{Code: OAuthErrorAccessDenied, Description: "the user denied the request"}
+	case models.DeviceCodeUsed:
+		log.Warn("Device code replayed, revoking tokens issued from it")
+		if err := s.GrantRepo.RevokeRefreshTokenFamily(ctx, code.PublicID, now); err != nil {
+			return nil, err
+		}
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "device code already used"}
+	}
+
+	// The conditional update makes concurrent redemptions of one code exclusive
+	used := *code
+	used.Status = models.DeviceCodeUsed
+	consumed, err := s.GrantRepo.UpdateDeviceCodeStatus(ctx, &used, models.DeviceCodeApproved)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "device code already used"}
+	}
+
+	user, err := s.activeUser(ctx, *code.UserID, *code.AuthTime)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, client, user, code.Scopes, code.PublicID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.issueIDToken(tokens, client, user, code.Scopes, "", *code.AuthTime); err != nil {
+		log.WithError(err).Error("Failed to sign ID token")
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Info("Device code exchanged")
+	return tokens, nil
+}
+
+// resolveDeviceCode moves a pending device authorization to its new status
+func (s *OAuthService) resolveDeviceCode(ctx context.Context, code *models.OAuthDeviceCode) error {
+	updated, err := s.GrantRepo.UpdateDeviceCodeStatus(ctx, code, models.DeviceCodePending)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrInvalidUserCode
+	}
+	return nil
+}
+
+// newUserCode generates a random user code
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	base := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode removes the formatting users may type along with a user code
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// formatUserCode splits a user code in two halves for display
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
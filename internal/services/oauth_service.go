@@ -0,0 +1,876 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// authorizationCodeTTL is how long an authorization code can be redeemed
+const authorizationCodeTTL = 5 * time.Minute
+
+// maxNonceLength bounds the OpenID Connect nonce stored with an authorization code
+const maxNonceLength = 500
+
+// OAuth2 error codes from RFC 6749, OpenID Connect and RFC 8628
+const (
+	OAuthErrorInvalidRequest          = "invalid_request"
+	OAuthErrorInvalidClient           = "invalid_client"
+	OAuthErrorInvalidGrant            = "invalid_grant"
+	OAuthErrorUnauthorizedClient      = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrorUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrorInvalidScope            = "invalid_scope"
+	OAuthErrorAccessDenied            = "access_denied"
+	OAuthErrorLoginRequired           = "login_required"
+	OAuthErrorConsentRequired         = "consent_required"
+	OAuthErrorAuthorizationPending    = "authorization_pending"
+	OAuthErrorSlowDown                = "slow_down"
+	OAuthErrorExpiredToken            = "expired_token"
+	OAuthErrorServerError             = "server_error"
+)
+
+// OAuthError is an error reported to OAuth clients with an RFC 6749 error code
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// AuthorizationRequest holds the parameters of an authorization request
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Prompt              string
+}
+
+// AuthorizationGrant is a validated authorization request
+type AuthorizationGrant struct {
+	Client        *models.OAuthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Nonce         string
+}
+
+// TokenSet is the result of a successful token request. IDToken is only set
+// when an authorization or device code with the openid scope is exchanged.
+type TokenSet struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    time.Duration
+	Scopes       []string
+}
+
+// LogoutRequest is a validated RP-initiated logout request
+type LogoutRequest struct {
+	Client      *models.OAuthClient
+	Subject     string
+	RedirectURI string
+}
+
+// OAuthClientInput holds the fields of a new OAuth client
+type OAuthClientInput struct {
+	Name                   string
+	RedirectURIs           []string
+	PostLogoutRedirectURIs []string
+	Scopes                 []string
+	Public                 bool
+}
+
+// OAuthClientUpdate holds the OAuth client fields to change; nil fields are left as they are
+type OAuthClientUpdate struct {
+	Name                   *string
+	RedirectURIs           []string
+	PostLogoutRedirectURIs []string
+	Scopes                 []string
+}
+
+// OAuthService implements the OAuth 2.1 authorization code flow and the
+// OpenID Connect layer on top of it
+type OAuthService struct {
+	ClientRepo repositories.OAuthClientRepository
+	GrantRepo  repositories.OAuthGrantRepository
+	UserRepo   repositories.UserRepository
+	SigningKey *utils.SigningKey
+	Config     *config.Config
+	Logger     *utils.Logger
+}
+
+// NewOAuthService creates a new OAuth service
+func NewOAuthService(clientRepo repositories.OAuthClientRepository, grantRepo repositories.OAuthGrantRepository, userRepo repositories.UserRepository, signingKey *utils.SigningKey, config *config.Config, logger *utils.Logger) *OAuthService {
+	return &OAuthService{
+		ClientRepo: clientRepo,
+		GrantRepo:  grantRepo,
+		UserRepo:   userRepo,
+		SigningKey: signingKey,
+		Config:     config,
+		Logger:     logger,
+	}
+}
+
+// RegisterClient registers an OAuth client. Confidential clients get a
+// secret, which is returned only here.
+func (s *OAuthService) RegisterClient(ctx context.Context, input OAuthClientInput) (*models.OAuthClient, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := validateOAuthClient(input.Name, input.RedirectURIs, input.PostLogoutRedirectURIs, input.Scopes); err != nil {
+		log.WithError(err).Warn("OAuth client validation failed")
+		return nil, "", err
+	}
+
+	client := &models.OAuthClient{
+		PublicID:               models.NewPublicID(),
+		Name:                   strings.TrimSpace(input.Name),
+		RedirectURIs:           input.RedirectURIs,
+		PostLogoutRedirectURIs: input.PostLogoutRedirectURIs,
+		Scopes:                 dedupeScopes(input.Scopes),
+		Public:                 input.Public,
+	}
+
+	var secret string
+	if !client.Public {
+		var err error
+		if secret, err = utils.GenerateOpaqueToken(models.OAuthClientSecretKind); err != nil {
+			log.WithError(err).Error("Failed to generate client secret")
+			return nil, "", err
+		}
+		client.SecretPrefix = utils.OpaqueTokenPrefix(secret)
+		client.SecretHash = utils.HashOpaqueToken(secret)
+	}
+
+	if err := s.ClientRepo.Create(ctx, client); err != nil {
+		log.WithError(err).Error("Failed to register OAuth client")
+		return nil, "", err
+	}
+
+	log.WithField("client_id", client.PublicID).Info("OAuth client registered successfully")
+	return client, secret, nil
+}
+
+// ListClients lists all OAuth clients
+func (s *OAuthService) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	return s.ClientRepo.List(ctx)
+}
+
+// GetClient gets an OAuth client by client ID
+func (s *OAuthService) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	return s.ClientRepo.FindByPublicID(ctx, clientID)
+}
+
+// UpdateClient updates an OAuth client
+func (s *OAuthService) UpdateClient(ctx context.Context, clientID string, update OAuthClientUpdate) (*models.OAuthClient, error) {
+	log := s.Logger.WithContext(ctx)
+
+	client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := client.Name
+	if update.Name != nil {
+		name = *update.Name
+	}
+	redirectURIs := []string(client.RedirectURIs)
+	if update.RedirectURIs != nil {
+		redirectURIs = update.RedirectURIs
+	}
+	postLogoutRedirectURIs := []string(client.PostLogoutRedirectURIs)
+	if update.PostLogoutRedirectURIs != nil {
+		postLogoutRedirectURIs = update.PostLogoutRedirectURIs
+	}
+	scopes := []string(client.Scopes)
+	if update.Scopes != nil {
+		scopes = update.Scopes
+	}
+	if err := validateOAuthClient(name, redirectURIs, postLogoutRedirectURIs, scopes); err != nil {
+		log.WithError(err).Warn("OAuth client validation failed")
+		return nil, err
+	}
+
+	client.Name = strings.TrimSpace(name)
+	client.RedirectURIs = redirectURIs
+	client.PostLogoutRedirectURIs = postLogoutRedirectURIs
+	client.Scopes = dedupeScopes(scopes)
+
+	if err := s.ClientRepo.Update(ctx, client); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to update OAuth client")
+		return nil, err
+	}
+
+	log.WithField("client_id", clientID).Info("OAuth client updated successfully")
+	return client, nil
+}
+
+// RotateClientSecret replaces a confidential client's secret. The old secret stops working immediately.
+func (s *OAuthService) RotateClientSecret(ctx context.Context, clientID string) (*models.OAuthClient, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		return nil, "", err
+	}
+	if client.Public {
+		return nil, "", &ValidationError{Message: "invalid client", Violations: []string{"public clients have no secret"}}
+	}
+
+	secret, err := utils.GenerateOpaqueToken(models.OAuthClientSecretKind)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate client secret")
+		return nil, "", err
+	}
+	client.SecretPrefix = utils.OpaqueTokenPrefix(secret)
+	client.SecretHash = utils.HashOpaqueToken(secret)
+
+	if err := s.ClientRepo.Update(ctx, client); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to rotate client secret")
+		return nil, "", err
+	}
+
+	log.WithField("client_id", clientID).Info("OAuth client secret rotated successfully")
+	return client, secret, nil
+}
+
+// DeleteClient deletes an OAuth client. Its refresh tokens stop working
+// because the client can no longer authenticate.
+func (s *OAuthService) DeleteClient(ctx context.Context, clientID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ClientRepo.Delete(ctx, client.ID); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to delete OAuth client")
+		return err
+	}
+
+	log.WithField("client_id", clientID).Info("OAuth client deleted successfully")
+	return nil
+}
+
+// ValidateAuthorizationRequest validates an authorization request. If the
+// client or redirect URI is invalid no grant is returned and the user must
+// not be redirected; for any other error the grant is returned so the error
+// can be sent to the client's redirect URI.
+func (s *OAuthService) ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) (*AuthorizationGrant, error) {
+	client, err := s.ClientRepo.FindByPublicID(ctx, req.ClientID)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidClient, Description: "unknown client"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "redirect_uri is not registered for this client"}
+	}
+
+	grant := &AuthorizationGrant{
+		Client:        client,
+		RedirectURI:   redirectURI,
+		State:         req.State,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+	}
+
+	if req.ResponseType != "code" {
+		return grant, &OAuthError{Code: OAuthErrorUnsupportedResponseType, Description: "only the code response type is supported"}
+	}
+
+	// PKCE is mandatory for every client, and only S256 is accepted
+	if req.CodeChallengeMethod != utils.PKCEMethodS256 {
+		return grant, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "code_challenge_method must be S256"}
+	}
+	if !utils.ValidPKCEValue(req.CodeChallenge) {
+		return grant, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "code_challenge is missing or malformed"}
+	}
+
+	if len(req.Nonce) > maxNonceLength {
+		return grant, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "nonce is too long"}
+	}
+
+	scopes, err := resolveScopes(client, req.Scope, client.Scopes)
+	if err != nil {
+		return grant, err
+	}
+	grant.Scopes = scopes
+
+	return grant, nil
+}
+
+// HasConsent reports whether the user already allowed every scope of the grant
+func (s *OAuthService) HasConsent(ctx context.Context, userID uint, grant *AuthorizationGrant) (bool, error) {
+	consent, err := s.GrantRepo.FindConsent(ctx, userID, grant.Client.ID)
+	if errors.Is(err, repositories.ErrConsentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return consent.Covers(grant.Scopes), nil
+}
+
+// GrantConsent records that the user allowed the grant's scopes, adding them
+// to any scopes allowed before
+func (s *OAuthService) GrantConsent(ctx context.Context, userID uint, grant *AuthorizationGrant) error {
+	log := s.Logger.WithContext(ctx)
+
+	consent, err := s.GrantRepo.FindConsent(ctx, userID, grant.Client.ID)
+	if errors.Is(err, repositories.ErrConsentNotFound) {
+		consent = &models.OAuthConsent{UserID: userID, ClientID: grant.Client.ID}
+	} else if err != nil {
+		return err
+	}
+
+	consent.Scopes = dedupeScopes(append([]string(consent.Scopes), grant.Scopes...))
+	if err := s.GrantRepo.SaveConsent(ctx, consent); err != nil {
+		return err
+	}
+
+	log.WithField("user_id", userID).WithField("client_id", grant.Client.PublicID).Info("OAuth consent granted")
+	return nil
+}
+
+// IssueAuthorizationCode creates a single-use authorization code for the
+// grant. authTime is when the user last entered their credentials.
+func (s *OAuthService) IssueAuthorizationCode(ctx context.Context, user *models.User, grant *AuthorizationGrant, authTime time.Time) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	plaintext, err := utils.GenerateOpaqueToken(models.OAuthCodeKind)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate authorization code")
+		return "", err
+	}
+
+	code := &models.OAuthAuthorizationCode{
+		PublicID:      models.NewPublicID(),
+		CodeHash:      utils.HashOpaqueToken(plaintext),
+		ClientID:      grant.Client.ID,
+		UserID:        user.ID,
+		RedirectURI:   grant.RedirectURI,
+		Scopes:        grant.Scopes,
+		CodeChallenge: grant.CodeChallenge,
+		Nonce:         grant.Nonce,
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	}
+
+	if err := s.GrantRepo.CreateAuthorizationCode(ctx, code); err != nil {
+		return "", err
+	}
+
+	log.WithField("user_id", user.ID).WithField("client_id", grant.Client.PublicID).Info("Authorization code issued")
+	return plaintext, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for an access
+// token and a refresh token. Presenting a code twice revokes every token
+// issued from it.
+func (s *OAuthService) ExchangeAuthorizationCode(ctx context.Context, clientID, clientSecret, code, redirectURI, codeVerifier string) (*TokenSet, error) {
+	log := s.Logger.WithContext(ctx).WithField("client_id", clientID)
+
+	client, err := s.AuthenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// Codes of other clients are not found, so presenting one cannot burn it
+	authCode, err := s.GrantRepo.ConsumeAuthorizationCode(ctx, utils.HashOpaqueToken(code), client.ID, now)
+	if errors.Is(err, repositories.ErrAuthorizationCodeUsed) {
+		log.Warn("Authorization code replayed, revoking tokens issued from it")
+		if err := s.GrantRepo.RevokeRefreshTokenFamily(ctx, authCode.PublicID, now); err != nil {
+			return nil, err
+		}
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "authorization code already used"}
+	}
+	if errors.Is(err, repositories.ErrAuthorizationCodeNotFound) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid authorization code"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !now.Before(authCode.ExpiresAt) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid authorization code"}
+	}
+	// OAuth 2.1 lets PKCE clients omit the redirect URI, but if sent it must match
+	if redirectURI != "" && authCode.RedirectURI != redirectURI {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "redirect_uri does not match the authorization request"}
+	}
+	if !utils.VerifyPKCE(codeVerifier, authCode.CodeChallenge) {
+		log.Warn("PKCE verification failed")
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "code_verifier does not match the code challenge"}
+	}
+
+	user, err := s.activeUser(ctx, authCode.UserID, authCode.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, client, user, authCode.Scopes, authCode.PublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.issueIDToken(tokens, client, user, authCode.Scopes, authCode.Nonce, authCode.AuthTime); err != nil {
+		log.WithError(err).Error("Failed to sign ID token")
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Info("Authorization code exchanged")
+	return tokens, nil
+}
+
+// RefreshAccessToken rotates a refresh token, issuing a new access token and
+// refresh token. The scope may be narrowed but not widened. Presenting a
+// refresh token that was already rotated revokes its whole family.
+func (s *OAuthService) RefreshAccessToken(ctx context.Context, clientID, clientSecret, refreshToken, scope string) (*TokenSet, error) {
+	log := s.Logger.WithContext(ctx).WithField("client_id", clientID)
+
+	client, err := s.AuthenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.GrantRepo.FindRefreshToken(ctx, utils.HashOpaqueToken(refreshToken))
+	if errors.Is(err, repositories.ErrRefreshTokenNotFound) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid refresh token"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.ClientID != client.ID {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid refresh token"}
+	}
+
+	now := time.Now()
+	if !now.Before(token.ExpiresAt) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "refresh token expired"}
+	}
+
+	if token.RevokedAt != nil {
+		return nil, s.revokeReplayedFamily(ctx, token, now)
+	}
+
+	// Check the scope before rotating, so an invalid request keeps the grant
+	scopes := []string(token.Scopes)
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !containsString(token.Scopes, s) {
+				return nil, &OAuthError{Code: OAuthErrorInvalidScope, Description: fmt.Sprintf("scope %q was not granted", s)}
+			}
+		}
+		scopes = dedupeScopes(requested)
+	}
+
+	rotated, err := s.GrantRepo.MarkRefreshTokenUsed(ctx, token.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, s.revokeReplayedFamily(ctx, token, now)
+	}
+
+	user, err := s.activeUser(ctx, token.UserID, token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, client, user, scopes, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Info("Refresh token rotated")
+	return tokens, nil
+}
+
+// revokeReplayedFamily revokes the family of a refresh token presented after
+// it was rotated or revoked, and returns the error answering the replay
+func (s *OAuthService) revokeReplayedFamily(ctx context.Context, token *models.OAuthRefreshToken, now time.Time) error {
+	s.Logger.WithContext(ctx).WithField("family_id", token.FamilyID).Warn("Refresh token replayed, revoking its family")
+	if err := s.GrantRepo.RevokeRefreshTokenFamily(ctx, token.FamilyID, now); err != nil {
+		return err
+	}
+	return &OAuthError{Code: OAuthErrorInvalidGrant, Description: "refresh token has been revoked"}
+}
+
+// UserInfo returns the claims about the user that the granted scopes allow
+func (s *OAuthService) UserInfo(user *models.User, scopes []string) utils.IDTokenClaims {
+	claims := userClaims(user, scopes)
+	claims.Subject = user.PublicID
+	return claims
+}
+
+// ValidateLogoutRequest validates an RP-initiated logout request. The
+// post-logout redirect URI is only honored if it is registered for the client
+// identified by the ID token hint or client ID.
+func (s *OAuthService) ValidateLogoutRequest(ctx context.Context, idTokenHint, clientID, redirectURI string) (*LogoutRequest, error) {
+	req := &LogoutRequest{}
+
+	if idTokenHint != "" {
+		claims, err := utils.ParseIDTokenHint(idTokenHint, s.Config.OIDC.Issuer, s.SigningKey)
+		if err != nil {
+			return nil, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "id_token_hint is not a valid ID token"}
+		}
+		if clientID != "" && !containsString(claims.Audience, clientID) {
+			return nil, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "client_id does not match id_token_hint"}
+		}
+		req.Subject = claims.Subject
+		clientID = claims.Audience[0]
+	}
+
+	if clientID != "" {
+		client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+		if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+			return nil, &OAuthError{Code: OAuthErrorInvalidClient, Description: "unknown client"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.Client = client
+	}
+
+	if redirectURI != "" {
+		if req.Client == nil || !req.Client.HasPostLogoutRedirectURI(redirectURI) {
+			return nil, &OAuthError{Code: OAuthErrorInvalidRequest, Description: "post_logout_redirect_uri is not registered for this client"}
+		}
+		req.RedirectURI = redirectURI
+	}
+
+	return req, nil
+}
+
+// ListAuthorizations lists the clients the user has authorized
+func (s *OAuthService) ListAuthorizations(ctx context.Context, userID uint) ([]models.OAuthConsent, error) {
+	consents, err := s.GrantRepo.ListConsents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizations := consents[:0]
+	for _, consent := range consents {
+		client, err := s.ClientRepo.FindByID(ctx, consent.ClientID)
+		if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		consent.Client = client
+		authorizations = append(authorizations, consent)
+	}
+	return authorizations, nil
+}
+
+// RevokeAuthorization withdraws the user's consent for a client and revokes its refresh tokens
+func (s *OAuthService) RevokeAuthorization(ctx context.Context, userID uint, clientID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return repositories.ErrConsentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.GrantRepo.DeleteConsent(ctx, userID, client.ID); err != nil {
+		return err
+	}
+	if err := s.GrantRepo.RevokeRefreshTokens(ctx, userID, client.ID, time.Now()); err != nil {
+		return err
+	}
+
+	log.WithField("user_id", userID).WithField("client_id", clientID).Info("OAuth authorization revoked")
+	return nil
+}
+
+// LookupRefreshToken resolves an active refresh token to its record, client
+// and user. It fails for unknown, revoked or expired tokens, deleted clients,
+// and users whose grants are no longer valid.
+func (s *OAuthService) LookupRefreshToken(ctx context.Context, refreshToken string) (*models.OAuthRefreshToken, *models.OAuthClient, *models.User, error) {
+	invalid := &OAuthError{Code: OAuthErrorInvalidGrant, Description: "invalid refresh token"}
+
+	token, err := s.GrantRepo.FindRefreshToken(ctx, utils.HashOpaqueToken(refreshToken))
+	if errors.Is(err, repositories.ErrRefreshTokenNotFound) {
+		return nil, nil, nil, invalid
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if token.RevokedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return nil, nil, nil, invalid
+	}
+
+	client, err := s.ClientRepo.FindByID(ctx, token.ClientID)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return nil, nil, nil, invalid
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	user, err := s.activeUser(ctx, token.UserID, token.CreatedAt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return token, client, user, nil
+}
+
+// RevokeRefreshToken revokes a refresh token, and every token rotated from
+// the same authorization, on behalf of the client it was issued to
+func (s *OAuthService) RevokeRefreshToken(ctx context.Context, client *models.OAuthClient, refreshToken string) error {
+	token, err := s.GrantRepo.FindRefreshToken(ctx, utils.HashOpaqueToken(refreshToken))
+	if errors.Is(err, repositories.ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if token.ClientID != client.ID {
+		return &OAuthError{Code: OAuthErrorUnauthorizedClient, Description: "token was not issued to this client"}
+	}
+
+	if err := s.GrantRepo.RevokeRefreshTokenFamily(ctx, token.FamilyID, time.Now()); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("client_id", client.PublicID).WithField("family_id", token.FamilyID).Info("Refresh token revoked")
+	return nil
+}
+
+// AuthenticateClient authenticates a client at the token endpoint.
+// Confidential clients must present their secret; public clients must not.
+func (s *OAuthService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	invalid := &OAuthError{Code: OAuthErrorInvalidClient, Description: "client authentication failed"}
+	if clientID == "" {
+		return nil, invalid
+	}
+
+	client, err := s.ClientRepo.FindByPublicID(ctx, clientID)
+	if errors.Is(err, repositories.ErrOAuthClientNotFound) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, invalid
+		}
+		return client, nil
+	}
+
+	hash := utils.HashOpaqueToken(clientSecret)
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hash)) != 1 {
+		return nil, invalid
+	}
+	return client, nil
+}
+
+// activeUser loads the user a grant was issued to, rejecting users who are
+// gone, inactive, or who revoked their tokens after the grant was issued
+func (s *OAuthService) activeUser(ctx context.Context, userID uint, grantedAt time.Time) (*models.User, error) {
+	user, err := s.UserRepo.FindByID(ctx, userID)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "user no longer exists"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TokensRevokedAt != nil && grantedAt.Before(*user.TokensRevokedAt) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: "grant has been revoked"}
+	}
+	if err := checkAccountStatus(user); err != nil {
+		return nil, &OAuthError{Code: OAuthErrorInvalidGrant, Description: err.Error()}
+	}
+	return user, nil
+}
+
+// issueTokens issues an access token and a new refresh token in the given family
+func (s *OAuthService) issueTokens(ctx context.Context, client *models.OAuthClient, user *models.User, scopes []string, familyID string) (*TokenSet, error) {
+	ttl := time.Duration(s.Config.OAuth.AccessTokenTTL) * time.Minute
+	accessToken, err := utils.GenerateDelegatedToken(user.PublicID, client.PublicID, scopes, s.Config.JWT.Secret, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken(models.OAuthRefreshTokenKind)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.OAuthRefreshToken{
+		TokenHash: utils.HashOpaqueToken(refreshToken),
+		FamilyID:  familyID,
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(time.Duration(s.Config.OAuth.RefreshTokenTTL) * 24 * time.Hour),
+	}
+	if err := s.GrantRepo.CreateRefreshToken(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return &TokenSet{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    ttl,
+		Scopes:       scopes,
+	}, nil
+}
+
+// issueIDToken adds an ID token to tokens if the openid scope was granted
+func (s *OAuthService) issueIDToken(tokens *TokenSet, client *models.OAuthClient, user *models.User, scopes []string, nonce string, authTime time.Time) error {
+	if !containsString(scopes, models.ScopeOpenID) {
+		return nil
+	}
+
+	claims := userClaims(user, scopes)
+	claims.Nonce = nonce
+	claims.AuthTime = jwt.NewNumericDate(authTime)
+
+	idToken, err := utils.GenerateIDToken(claims, s.Config.OIDC.Issuer, user.PublicID, client.PublicID, s.SigningKey, tokens.ExpiresIn)
+	if err != nil {
+		return err
+	}
+	tokens.IDToken = idToken
+	return nil
+}
+
+// userClaims returns the standard OpenID Connect claims about the user allowed by scopes
+func userClaims(user *models.User, scopes []string) utils.IDTokenClaims {
+	var claims utils.IDTokenClaims
+	if containsString(scopes, models.ScopeProfile) {
+		claims.Name = user.Name
+		claims.UpdatedAt = user.UpdatedAt.Unix()
+	}
+	if containsString(scopes, models.ScopeEmail) {
+		// Email ownership is not verified at registration
+		verified := false
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	return claims
+}
+
+// resolveScopes parses a space-separated scope request against the client's
+// allowed scopes, using defaults when none are requested
+func resolveScopes(client *models.OAuthClient, requested string, defaults []string) ([]string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return dedupeScopes(defaults), nil
+	}
+
+	for _, scope := range scopes {
+		if !client.HasScope(scope) {
+			return nil, &OAuthError{Code: OAuthErrorInvalidScope, Description: fmt.Sprintf("scope %q is not allowed for this client", scope)}
+		}
+	}
+	return dedupeScopes(scopes), nil
+}
+
+// validateOAuthClient validates OAuth client input
+func validateOAuthClient(name string, redirectURIs, postLogoutRedirectURIs, scopes []string) error {
+	var violations []string
+
+	if strings.TrimSpace(name) == "" {
+		violations = append(violations, "name is required")
+	}
+
+	if len(redirectURIs) == 0 {
+		violations = append(violations, "at least one redirect URI is required")
+	}
+	for _, uri := range append(append([]string{}, redirectURIs...), postLogoutRedirectURIs...) {
+		if err := validateRedirectURI(uri); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	for _, scope := range scopes {
+		if !models.IsValidOAuthScope(scope) {
+			violations = append(violations, fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid OAuth client", Violations: violations}
+	}
+	return nil
+}
+
+// validateRedirectURI checks that a redirect URI is absolute, has no
+// fragment, and only uses plain HTTP for loopback addresses. Besides http(s),
+// only reverse domain name private-use schemes such as com.example.app:/callback
+// are allowed for mobile apps (RFC 8252), which rules out javascript:, data:
+// and file: URIs.
+func validateRedirectURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" {
+		return fmt.Errorf("redirect URI %q must be an absolute URI", uri)
+	}
+	if parsed.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("redirect URI %q must not contain a fragment", uri)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("redirect URI %q has no host", uri)
+		}
+	case "http":
+		host := parsed.Hostname()
+		if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+			return fmt.Errorf("redirect URI %q must use https unless it is a loopback address", uri)
+		}
+	default:
+		if !strings.Contains(parsed.Scheme, ".") {
+			return fmt.Errorf("redirect URI %q must use https or a reverse domain name private-use scheme", uri)
+		}
+	}
+	return nil
+}
+
+// containsString reports whether values includes value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/user/user-management-service/config"
+)
+
+// minUserInfoLength is the shortest name or email fragment checked against passwords
+const minUserInfoLength = 3
+
+// PasswordPolicyError holds every policy violation found for a password
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+// BreachedPasswordChecker reports whether a password appears in a breach corpus
+type BreachedPasswordChecker interface {
+	IsBreached(password string) bool
+}
+
+// BreachedPasswordList is an in-memory breached password list. Hashes are kept
+// sorted in binary form, 20 bytes each, and looked up by binary search.
+type BreachedPasswordList struct {
+	hashes [][sha1.Size]byte
+}
+
+// LoadBreachedPasswordList loads a file of upper- or lower-case SHA-1 hex hashes,
+// one per line, optionally followed by ":count" as in the HIBP downloads.
+// Files with more than maxHashes hashes are refused, bounding the memory the
+// list takes.
+func LoadBreachedPasswordList(path string, maxHashes int) (*BreachedPasswordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedPasswordList{}
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var hash [sha1.Size]byte
+		hexHash := strings.SplitN(line, ":", 2)[0]
+		if len(hexHash) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d", lineNo)
+		}
+		if _, err := hex.Decode(hash[:], []byte(hexHash)); err != nil {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d", lineNo)
+		}
+
+		if len(list.hashes) >= maxHashes {
+			return nil, fmt.Errorf("breached password list has more than %d hashes", maxHashes)
+		}
+		list.hashes = append(list.hashes, hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.hashes, func(i, j int) bool {
+		return bytes.Compare(list.hashes[i][:], list.hashes[j][:]) < 0
+	})
+	list.hashes = slices.Compact(list.hashes)
+	return list, nil
+}
+
+// Size returns the number of distinct hashes in the list
+func (l *BreachedPasswordList) Size() int {
+	return len(l.hashes)
+}
+
+// IsBreached reports whether the password's SHA-1 hash is in the list
+func (l *BreachedPasswordList) IsBreached(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return bytes.Compare(l.hashes[i][:], hash[:]) >= 0
+	})
+	return i < len(l.hashes) && l.hashes[i] == hash
+}
+
+// PasswordPolicy validates passwords against the deployment's rules
+type PasswordPolicy struct {
+	MinLength         int
+	MaxLength         int
+	RequireUpper      bool
+	RequireLower      bool
+	RequireDigit      bool
+	RequireSymbol     bool
+	DisallowUserInfo  bool
+	MinStrength       int // 0-4
+	BreachedPasswords BreachedPasswordChecker
+}
+
+// NewPasswordPolicy creates a password policy from configuration.
+// The breached password list is loaded separately.
+func NewPasswordPolicy(cfg *config.Config) *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:        cfg.PasswordPolicy.MinLength,
+		MaxLength:        cfg.PasswordPolicy.MaxLength,
+		RequireUpper:     cfg.PasswordPolicy.RequireUpper,
+		RequireLower:     cfg.PasswordPolicy.RequireLower,
+		RequireDigit:     cfg.PasswordPolicy.RequireDigit,
+		RequireSymbol:    cfg.PasswordPolicy.RequireSymbol,
+		DisallowUserInfo: cfg.PasswordPolicy.DisallowUserInfo,
+		MinStrength:      cfg.PasswordPolicy.MinStrength,
+	}
+
+	if policy.MinLength <= 0 {
+		policy.MinLength = 6
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = 128
+	}
+
+	return policy
+}
+
+// Validate checks the password and returns a *PasswordPolicyError listing
+// every violation, or nil if the password is acceptable
+func (p *PasswordPolicy) Validate(password, name, email string) error {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+	if length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("password must be at most %d characters", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "password must contain a symbol")
+	}
+
+	if p.DisallowUserInfo && containsUserInfo(password, name, email) {
+		violations = append(violations, "password must not contain your name or email")
+	}
+
+	if p.MinStrength > 0 {
+		if score := PasswordStrength(password); score < p.MinStrength {
+			violations = append(violations, fmt.Sprintf("password is too weak (strength %d of 4, minimum %d)", score, p.MinStrength))
+		}
+	}
+
+	if p.BreachedPasswords != nil && p.BreachedPasswords.IsBreached(password) {
+		violations = append(violations, "password has appeared in a data breach")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsUserInfo reports whether the password contains the user's name,
+// a word of their name, or the local part of their email
+func containsUserInfo(password, name, email string) bool {
+	lower := strings.ToLower(password)
+
+	fragments := strings.Fields(strings.ToLower(name))
+	if local := strings.SplitN(strings.ToLower(email), "@", 2)[0]; local != "" {
+		fragments = append(fragments, local)
+	}
+
+	for _, fragment := range fragments {
+		if utf8.RuneCountInString(fragment) >= minUserInfoLength && strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// commonPasswordFragments are penalised heavily by PasswordStrength
+var commonPasswordFragments = []string{
+	"password", "passw0rd", "qwerty", "letmein", "welcome", "admin", "login",
+	"iloveyou", "monkey", "dragon", "football", "baseball", "abc123", "123456",
+}
+
+// PasswordStrength estimates password strength on a 0-4 scale in the spirit
+// of zxcvbn: it estimates entropy from the character pool and length, then
+// discounts repeated characters, sequences and common password fragments
+func PasswordStrength(password string) int {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	pool := 0
+	var hasUpper, hasLower, hasDigit, hasSymbol, hasOther bool
+	for _, r := range runes {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r < utf8.RuneSelf:
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasLower {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+	if hasOther {
+		pool += 100
+	}
+
+	// Count characters that add little entropy: repeats and +/-1 sequences
+	effective := float64(len(runes))
+	for i := 1; i < len(runes); i++ {
+		diff := runes[i] - runes[i-1]
+		if diff == 0 || diff == 1 || diff == -1 {
+			effective -= 0.75
+		}
+	}
+
+	bits := effective * math.Log2(float64(pool))
+
+	lower := strings.ToLower(password)
+	for _, fragment := range commonPasswordFragments {
+		if strings.Contains(lower, fragment) {
+			bits -= float64(len(fragment)) * math.Log2(float64(pool))
+			bits += 10 // a dictionary guess is still a guess
+		}
+	}
+
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 80:
+		return 3
+	default:
+		return 4
+	}
+}
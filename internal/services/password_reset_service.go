@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// passwordResetRateWindow is the period the per-email rate limit applies to.
+// Links are kept that long, so PASSWORD_RESET_TTL_MINUTES cannot exceed it.
+const passwordResetRateWindow = time.Hour
+
+// ErrPasswordResetInvalid is returned for unknown, used or expired password reset links
+var ErrPasswordResetInvalid = errors.New("password reset link is invalid or has expired")
+
+// PasswordResetService lets users who forgot their password set a new one
+// through a link sent by email
+type PasswordResetService struct {
+	ResetRepo   repositories.PasswordResetRepository
+	UserRepo    repositories.UserRepository
+	UserService *UserService
+	Mailer      utils.Mailer
+	Config      *config.Config
+	Logger      *utils.Logger
+}
+
+// NewPasswordResetService creates a new password reset service
+func NewPasswordResetService(resetRepo repositories.PasswordResetRepository, userRepo repositories.UserRepository, userService *UserService, mailer utils.Mailer, config *config.Config, logger *utils.Logger) *PasswordResetService {
+	return &PasswordResetService{
+		ResetRepo:   resetRepo,
+		UserRepo:    userRepo,
+		UserService: userService,
+		Mailer:      mailer,
+		Config:      config,
+		Logger:      logger,
+	}
+}
+
+// Enabled reports whether users may reset their password
+func (s *PasswordResetService) Enabled() bool {
+	return s.Config.PasswordReset.URL != ""
+}
+
+// Request emails a password reset link to the account with an email. To not
+// reveal which emails have accounts, it succeeds whether or not a link is
+// sent. Users created through an external identity have no password to reset.
+func (s *PasswordResetService) Request(ctx context.Context, email string) error {
+	log := s.Logger.WithContext(ctx)
+
+	if !s.Enabled() {
+		return nil
+	}
+
+	user, err := s.UserRepo.FindByEmail(ctx, email)
+	if err != nil {
+		log.WithField("email", email).Info("Password reset requested for unknown email")
+		return nil
+	}
+	log = log.WithField("user_id", user.ID)
+
+	if err := checkAccountStatus(user); err != nil {
+		log.WithError(err).Warn("Password reset not sent to inactive account")
+		return nil
+	}
+	if user.Passwordless {
+		log.Info("Password reset not sent, the user signs in through an external identity")
+		return nil
+	}
+
+	now := time.Now()
+	count, err := s.ResetRepo.CountSince(ctx, user.ID, now.Add(-passwordResetRateWindow))
+	if err != nil {
+		return nil
+	}
+	if count >= s.Config.PasswordReset.RateLimit {
+		log.Warn("Password reset not sent, rate limit reached")
+		return nil
+	}
+
+	token, err := utils.GenerateOpaqueToken(models.PasswordResetTokenKind)
+	if err != nil {
+		return err
+	}
+	body, err := s.mailBody(user, token)
+	if err != nil {
+		log.WithError(err).Error("Password reset not sent, invalid link URL")
+		return nil
+	}
+	if err := s.ResetRepo.Create(ctx, &models.PasswordReset{
+		TokenHash: utils.HashOpaqueToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(time.Duration(s.Config.PasswordReset.TTL) * time.Minute),
+	}); err != nil {
+		return nil
+	}
+
+	// Sending in the background keeps the response time from revealing the account
+	msg := utils.MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	}
+	go func() {
+		if err := s.Mailer.Send(ctx, msg); err != nil {
+			log.WithError(err).Error("Failed to send password reset")
+		}
+	}()
+
+	log.Info("Password reset sent")
+	return nil
+}
+
+// Reset sets a new password for the user a reset link was sent to. The
+// password must satisfy the password policy and must not be one of the
+// user's recent passwords, like any other new password; a rejected password
+// leaves the link usable. Setting it restarts the password's age, so it also
+// recovers an expired password. Every token and session of the user is
+// revoked, and the user signs in again with the new password.
+func (s *PasswordResetService) Reset(ctx context.Context, token, password string) error {
+	log := s.Logger.WithContext(ctx)
+
+	reset, err := s.ResetRepo.FindByTokenHash(ctx, utils.HashOpaqueToken(token))
+	if errors.Is(err, repositories.ErrPasswordResetNotFound) {
+		return ErrPasswordResetInvalid
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		return ErrPasswordResetInvalid
+	}
+	log = log.WithField("user_id", reset.UserID)
+
+	user, err := s.UserRepo.FindByID(ctx, reset.UserID)
+	if err != nil {
+		return ErrPasswordResetInvalid
+	}
+	if err := checkAccountStatus(user); err != nil {
+		log.WithError(err).Warn("Password reset rejected by account status")
+		return err
+	}
+
+	if err := s.UserService.changePassword(ctx, user, password); err != nil {
+		log.WithError(err).Warn("New password rejected")
+		return err
+	}
+
+	if err := s.ResetRepo.MarkUsed(ctx, reset.ID, now); err != nil {
+		if errors.Is(err, repositories.ErrPasswordResetNotFound) {
+			return ErrPasswordResetInvalid
+		}
+		return err
+	}
+
+	if err := s.UserService.savePasswordReset(ctx, user); err != nil {
+		return err
+	}
+
+	log.Info("Password reset")
+	return nil
+}
+
+// PurgeExpired deletes links that no longer count towards the rate limit
+func (s *PasswordResetService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.ResetRepo.DeleteCreatedBefore(ctx, time.Now().Add(-passwordResetRateWindow))
+}
+
+// RunPurger purges old links every interval until ctx is cancelled
+func (s *PasswordResetService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Password reset purge failed")
+			}
+		}
+	}
+}
+
+// mailBody writes the email that carries a link
+func (s *PasswordResetService) mailBody(user *models.User, token string) (string, error) {
+	link, err := url.Parse(s.Config.PasswordReset.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password. It works once and expires in %d minutes.\n\n%s\n\nIf you did not ask to reset your password, you can ignore this email.\n",
+		user.Name, s.Config.PasswordReset.TTL, link), nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrInvalidAccessToken is returned for unknown or expired personal access tokens
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+// PersonalAccessTokenService manages users' personal access tokens.
+// Token use is buffered in memory by Authenticate and written by FlushLastUsed.
+type PersonalAccessTokenService struct {
+	TokenRepo repositories.PersonalAccessTokenRepository
+	UserRepo  repositories.UserRepository
+	Logger    *utils.Logger
+
+	lastUsed *activityBuffer
+}
+
+// NewPersonalAccessTokenService creates a new personal access token service
+func NewPersonalAccessTokenService(tokenRepo repositories.PersonalAccessTokenRepository, userRepo repositories.UserRepository, logger *utils.Logger) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		TokenRepo: tokenRepo,
+		UserRepo:  userRepo,
+		Logger:    logger,
+		lastUsed:  newActivityBuffer(),
+	}
+}
+
+// IsPersonalAccessToken reports whether a bearer credential is a personal access token rather than a JWT
+func IsPersonalAccessToken(credential string) bool {
+	return strings.HasPrefix(credential, models.PersonalAccessTokenKind+"_")
+}
+
+// CreateToken creates a personal access token for the user. The plaintext
+// token is returned only here; afterwards only its prefix is available.
+func (s *PersonalAccessTokenService) CreateToken(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := validateAccessToken(name, scopes, expiresAt); err != nil {
+		log.WithError(err).WithField("user_id", userID).Warn("Access token validation failed")
+		return nil, "", err
+	}
+
+	plaintext, err := utils.GenerateOpaqueToken(models.PersonalAccessTokenKind)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate access token")
+		return nil, "", err
+	}
+
+	token := &models.PersonalAccessToken{
+		PublicID:  models.NewPublicID(),
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    utils.OpaqueTokenPrefix(plaintext),
+		TokenHash: utils.HashOpaqueToken(plaintext),
+		Scopes:    dedupeScopes(scopes),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.TokenRepo.Create(ctx, token); err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to create access token")
+		return nil, "", err
+	}
+
+	log.WithField("user_id", userID).WithField("prefix", token.Prefix).Info("Access token created successfully")
+	return token, plaintext, nil
+}
+
+// ListTokens lists the user's personal access tokens
+func (s *PersonalAccessTokenService) ListTokens(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	log := s.Logger.WithContext(ctx)
+
+	tokens, err := s.TokenRepo.ListByUser(ctx, userID)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list access tokens")
+		return nil, err
+	}
+
+	for i := range tokens {
+		s.applyLastUsed(&tokens[i])
+	}
+	return tokens, nil
+}
+
+// GetToken gets one of the user's personal access tokens
+func (s *PersonalAccessTokenService) GetToken(ctx context.Context, userID uint, publicID string) (*models.PersonalAccessToken, error) {
+	token, err := s.TokenRepo.FindByPublicID(ctx, userID, publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.applyLastUsed(token)
+	return token, nil
+}
+
+// RenameToken changes the name of one of the user's personal access tokens.
+// Scopes and expiry are fixed at creation; create a new token to change them.
+func (s *PersonalAccessTokenService) RenameToken(ctx context.Context, userID uint, publicID, name string) (*models.PersonalAccessToken, error) {
+	log := s.Logger.WithContext(ctx)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, &ValidationError{Message: "invalid access token", Violations: []string{"name is required"}}
+	}
+
+	token, err := s.TokenRepo.FindByPublicID(ctx, userID, publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Name = name
+	if err := s.TokenRepo.Update(ctx, token); err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to rename access token")
+		return nil, err
+	}
+
+	s.applyLastUsed(token)
+	return token, nil
+}
+
+// DeleteToken revokes one of the user's personal access tokens
+func (s *PersonalAccessTokenService) DeleteToken(ctx context.Context, userID uint, publicID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	if err := s.TokenRepo.Delete(ctx, userID, publicID); err != nil {
+		log.WithError(err).WithField("user_id", userID).Warn("Failed to delete access token")
+		return err
+	}
+
+	log.WithField("user_id", userID).Info("Access token deleted successfully")
+	return nil
+}
+
+// Authenticate resolves a personal access token to its token record and user
+// and records the use. It fails for unknown or expired tokens and for users
+// who are not active.
+func (s *PersonalAccessTokenService) Authenticate(ctx context.Context, credential string) (*models.PersonalAccessToken, *models.User, error) {
+	token, user, err := s.Lookup(ctx, credential)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.lastUsed.touch(token.PublicID)
+	return token, user, nil
+}
+
+// Lookup resolves a personal access token like Authenticate without recording a use
+func (s *PersonalAccessTokenService) Lookup(ctx context.Context, credential string) (*models.PersonalAccessToken, *models.User, error) {
+	token, err := s.TokenRepo.FindByHash(ctx, utils.HashOpaqueToken(credential))
+	if errors.Is(err, repositories.ErrAccessTokenNotFound) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if token.Expired(time.Now()) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	user, err := s.UserRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		return nil, nil, err
+	}
+
+	return token, user, nil
+}
+
+// FlushLastUsed writes buffered token use in a single batch
+func (s *PersonalAccessTokenService) FlushLastUsed(ctx context.Context) error {
+	return s.lastUsed.flush(ctx, s.TokenRepo.UpdateLastUsed)
+}
+
+// RunLastUsedFlusher calls FlushLastUsed every interval until ctx is cancelled,
+// flushing once more before returning
+func (s *PersonalAccessTokenService) RunLastUsedFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.FlushLastUsed(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Access token last used flush failed")
+			}
+			return
+		case <-ticker.C:
+			if err := s.FlushLastUsed(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Access token last used flush failed")
+			}
+		}
+	}
+}
+
+// applyLastUsed shows token use that has not been flushed yet
+func (s *PersonalAccessTokenService) applyLastUsed(token *models.PersonalAccessToken) {
+	if usedAt, ok := s.lastUsed.latest(token.PublicID); ok && (token.LastUsedAt == nil || usedAt.After(*token.LastUsedAt)) {
+		token.LastUsedAt = &usedAt
+	}
+}
+
+// validateAccessToken validates personal access token input
+func validateAccessToken(name string, scopes []string, expiresAt *time.Time) error {
+	var violations []string
+
+	if strings.TrimSpace(name) == "" {
+		violations = append(violations, "name is required")
+	}
+
+	if len(scopes) == 0 {
+		violations = append(violations, "at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !models.IsValidTokenScope(scope) {
+			violations = append(violations, fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		violations = append(violations, "expiry must be in the future")
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid access token", Violations: violations}
+	}
+	return nil
+}
+
+// dedupeScopes removes repeated scopes, keeping their first occurrence
+func dedupeScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	var result []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/user-management-service/utils"
+)
+
+// SAML namespaces and bindings
+const (
+	samlMetadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlRedirectBinding    = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlPostBinding        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// Fields of models.User a SAML attribute can be mapped to. Custom profile
+// attributes are mapped as "attributes.<name>".
+const (
+	samlFieldEmail      = "email"
+	samlFieldName       = "name"
+	samlAttributePrefix = "attributes."
+)
+
+// SAMLConnectionConfig configures single sign-on for a tenant through its SAML identity provider
+type SAMLConnectionConfig struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	IdPMetadata     string `json:"idp_metadata"`
+	IdPMetadataFile string `json:"idp_metadata_file"`
+	// Certificate is a PEM certificate that replaces the signing certificates in the metadata
+	Certificate string `json:"certificate"`
+	// AttributeMapping maps user fields to the names of the SAML attributes that carry them
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	// EmailDomains, if set, are the only email domains the tenant may sign in users of
+	EmailDomains []string `json:"email_domains"`
+	// MagicLink, if set, overrides MAGIC_LINK_ENABLED for the tenant's users
+	MagicLink *bool `json:"magic_link"`
+}
+
+// SAMLConnection is a tenant's SAML identity provider
+type SAMLConnection struct {
+	SAMLConnectionConfig
+	IdPEntityID  string
+	SSOURL       string
+	Certificates []*x509.Certificate
+}
+
+// LoadSAMLConnections loads the tenants' SAML connections from a JSON file.
+// Relative metadata file paths are resolved from the file's directory.
+func LoadSAMLConnections(path string) ([]*SAMLConnection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Connections []SAMLConnectionConfig `json:"connections"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid SAML connections file: %w", err)
+	}
+
+	connections := make([]*SAMLConnection, 0, len(file.Connections))
+	seen := make(map[string]bool)
+	for _, cfg := range file.Connections {
+		if cfg.IdPMetadataFile != "" {
+			metadataPath := cfg.IdPMetadataFile
+			if !filepath.IsAbs(metadataPath) {
+				metadataPath = filepath.Join(filepath.Dir(path), metadataPath)
+			}
+			metadata, err := os.ReadFile(metadataPath)
+			if err != nil {
+				return nil, fmt.Errorf("connection %q: %w", cfg.ID, err)
+			}
+			cfg.IdPMetadata = string(metadata)
+		}
+		if seen[cfg.ID] {
+			return nil, fmt.Errorf("connection %q: duplicate id", cfg.ID)
+		}
+		seen[cfg.ID] = true
+
+		connection, err := NewSAMLConnection(cfg)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// NewSAMLConnection creates a connection, reading the identity provider's
+// entity ID, sign-on URL and certificates from its metadata
+func NewSAMLConnection(cfg SAMLConnectionConfig) (*SAMLConnection, error) {
+	if !isValidTenantID(cfg.ID) {
+		return nil, fmt.Errorf("connection %q: id must be 1-40 characters without spaces or URL delimiters", cfg.ID)
+	}
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("connection %q: name is required", cfg.ID)
+	}
+
+	mapping := map[string]string{samlFieldEmail: "email", samlFieldName: "name"}
+	for field, attribute := range cfg.AttributeMapping {
+		if field != samlFieldEmail && field != samlFieldName && !strings.HasPrefix(field, samlAttributePrefix) {
+			return nil, fmt.Errorf("connection %q: cannot map to unknown field %q", cfg.ID, field)
+		}
+		mapping[field] = attribute
+	}
+	cfg.AttributeMapping = mapping
+
+	for i, domain := range cfg.EmailDomains {
+		cfg.EmailDomains[i] = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	}
+
+	connection := &SAMLConnection{SAMLConnectionConfig: cfg}
+	if err := connection.parseMetadata(); err != nil {
+		return nil, fmt.Errorf("connection %q: %w", cfg.ID, err)
+	}
+
+	if cfg.Certificate != "" {
+		block, _ := pem.Decode([]byte(cfg.Certificate))
+		if block == nil {
+			return nil, fmt.Errorf("connection %q: certificate is not PEM", cfg.ID)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("connection %q: %w", cfg.ID, err)
+		}
+		connection.Certificates = []*x509.Certificate{cert}
+	}
+	if len(connection.Certificates) == 0 {
+		return nil, fmt.Errorf("connection %q: no signing certificate", cfg.ID)
+	}
+	return connection, nil
+}
+
+// parseMetadata reads the identity provider's EntityDescriptor
+func (c *SAMLConnection) parseMetadata() error {
+	root, err := utils.ParseXML([]byte(c.IdPMetadata))
+	if err != nil {
+		return fmt.Errorf("invalid IdP metadata: %w", err)
+	}
+	if root.Space != samlMetadataNamespace || root.Local != "EntityDescriptor" {
+		return errors.New("invalid IdP metadata: expected an EntityDescriptor")
+	}
+
+	c.IdPEntityID = root.Attr("entityID")
+	descriptor := root.Child(samlMetadataNamespace, "IDPSSODescriptor")
+	if c.IdPEntityID == "" || descriptor == nil {
+		return errors.New("invalid IdP metadata: no entityID or IDPSSODescriptor")
+	}
+
+	for _, service := range descriptor.ChildElements(samlMetadataNamespace, "SingleSignOnService") {
+		if service.Attr("Binding") == samlRedirectBinding {
+			c.SSOURL = service.Attr("Location")
+		}
+	}
+	if c.SSOURL == "" {
+		return errors.New("invalid IdP metadata: no HTTP-Redirect SingleSignOnService")
+	}
+
+	for _, key := range descriptor.ChildElements(samlMetadataNamespace, "KeyDescriptor") {
+		if use := key.Attr("use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := key.Child(utils.XMLDSigNamespace, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range keyInfo.ChildElements(utils.XMLDSigNamespace, "X509Data") {
+			for _, certificate := range data.ChildElements(utils.XMLDSigNamespace, "X509Certificate") {
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certificate.Text()), ""))
+				if err != nil {
+					return fmt.Errorf("invalid IdP metadata certificate: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return fmt.Errorf("invalid IdP metadata certificate: %w", err)
+				}
+				c.Certificates = append(c.Certificates, cert)
+			}
+		}
+	}
+	return nil
+}
+
+// allowsEmail reports whether the tenant may sign in a user with an email
+func (c *SAMLConnection) allowsEmail(email string) bool {
+	if len(c.EmailDomains) == 0 {
+		return true
+	}
+	_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, allowed := range c.EmailDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
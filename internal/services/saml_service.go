@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+const (
+	// samlRequestTTL is how long the user has to sign in at the identity provider
+	samlRequestTTL = 10 * time.Minute
+	// samlClockSkew is tolerated between our clock and the identity provider's
+	samlClockSkew = 2 * time.Minute
+)
+
+const (
+	samlStatusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearerMethod      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlEmailNameIDFormat = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// SAML login errors
+var (
+	ErrUnknownSAMLConnection = errors.New("unknown SAML connection")
+	ErrInvalidSAMLResponse   = errors.New("invalid SAML response")
+	ErrEmailDomainNotAllowed = errors.New("the email domain is not allowed for this connection")
+)
+
+// SAMLService lets tenants' users sign in through their SAML 2.0 identity
+// providers, with this service acting as the service provider
+type SAMLService struct {
+	RequestRepo       repositories.SAMLRequestRepository
+	FederationService *FederationService
+	Connections       []*SAMLConnection
+	Config            *config.Config
+	Logger            *utils.Logger
+}
+
+// NewSAMLService creates a new SAML service
+func NewSAMLService(requestRepo repositories.SAMLRequestRepository, federationService *FederationService, connections []*SAMLConnection, config *config.Config, logger *utils.Logger) *SAMLService {
+	return &SAMLService{
+		RequestRepo:       requestRepo,
+		FederationService: federationService,
+		Connections:       connections,
+		Config:            config,
+		Logger:            logger,
+	}
+}
+
+// Connection returns the configured connection with an ID
+func (s *SAMLService) Connection(connectionID string) (*SAMLConnection, error) {
+	for _, connection := range s.Connections {
+		if connection.ID == connectionID {
+			return connection, nil
+		}
+	}
+	return nil, ErrUnknownSAMLConnection
+}
+
+// EntityID is the service provider entity ID of a connection, which is also the URL of its metadata
+func (s *SAMLService) EntityID(connectionID string) string {
+	return s.Config.OIDC.Issuer + "/api/auth/saml/" + connectionID + "/metadata"
+}
+
+// ACSURL is the assertion consumer service URL of a connection
+func (s *SAMLService) ACSURL(connectionID string) string {
+	return s.Config.OIDC.Issuer + "/api/auth/saml/" + connectionID + "/acs"
+}
+
+// Metadata returns the service provider metadata to register at a connection's identity provider
+func (s *SAMLService) Metadata(connectionID string) ([]byte, error) {
+	if _, err := s.Connection(connectionID); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<md:EntityDescriptor xmlns:md="%s" entityID="%s">`, samlMetadataNamespace, xmlEscape(s.EntityID(connectionID)))
+	fmt.Fprintf(&buf, `<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`, samlProtocolNamespace)
+	fmt.Fprintf(&buf, `<md:NameIDFormat>%s</md:NameIDFormat>`, "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent")
+	fmt.Fprintf(&buf, `<md:NameIDFormat>%s</md:NameIDFormat>`, samlEmailNameIDFormat)
+	fmt.Fprintf(&buf, `<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`, samlPostBinding, xmlEscape(s.ACSURL(connectionID)))
+	buf.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return buf.Bytes(), nil
+}
+
+// BeginLogin records an authentication request and returns the identity
+// provider URL that carries it, using the HTTP-Redirect binding
+func (s *SAMLService) BeginLogin(ctx context.Context, connectionID string) (string, error) {
+	log := s.Logger.WithContext(ctx).WithField("connection", connectionID)
+
+	connection, err := s.Connection(connectionID)
+	if err != nil {
+		return "", err
+	}
+
+	requestID, err := utils.GenerateOpaqueToken("id")
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := s.RequestRepo.Create(ctx, &models.SAMLRequest{
+		RequestID:  requestID,
+		Connection: connectionID,
+		ExpiresAt:  now.Add(samlRequestTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+		`<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+		samlProtocolNamespace, samlAssertionNamespace, requestID, now.UTC().Format(time.RFC3339),
+		xmlEscape(connection.SSOURL), xmlEscape(s.ACSURL(connectionID)), samlPostBinding, xmlEscape(s.EntityID(connectionID)))
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	writer.Write([]byte(request))
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(connection.SSOURL)
+	if err != nil {
+		log.WithError(err).Error("Invalid identity provider sign-on URL")
+		return "", err
+	}
+	query := target.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	target.RawQuery = query.Encode()
+
+	log.Info("SAML authentication request sent")
+	return target.String(), nil
+}
+
+// ConsumeResponse checks a SAML response posted to the assertion consumer
+// service and signs in the user it asserts. The response must answer an
+// outstanding request and carry a signed assertion meant for this service.
+func (s *SAMLService) ConsumeResponse(ctx context.Context, connectionID, encoded string, client ClientInfo) (*FederatedLogin, error) {
+	log := s.Logger.WithContext(ctx).WithField("connection", connectionID)
+
+	connection, err := s.Connection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	assertion, requestID, err := s.verifyResponse(connection, encoded, now)
+	if err != nil {
+		log.WithError(err).Warn("SAML response rejected")
+		return nil, ErrInvalidSAMLResponse
+	}
+
+	if err := s.RequestRepo.Consume(ctx, requestID, connectionID, now); err != nil {
+		if errors.Is(err, repositories.ErrSAMLRequestNotFound) {
+			log.Warn("SAML response to an unknown, expired or already answered request")
+			return nil, ErrInvalidSAMLResponse
+		}
+		return nil, err
+	}
+
+	external := connection.externalIdentity(assertion)
+	if external.Email != "" && !connection.allowsEmail(external.Email) {
+		log.WithField("subject", external.Subject).Warn("SAML assertion for an email outside the connection's domains")
+		return nil, ErrEmailDomainNotAllowed
+	}
+	return s.FederationService.SignIn(ctx, external, client)
+}
+
+// PurgeExpired deletes authentication requests that were never answered
+func (s *SAMLService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.RequestRepo.DeleteExpired(ctx, time.Now())
+}
+
+// RunPurger purges unanswered authentication requests every interval until ctx is cancelled
+func (s *SAMLService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("SAML request purge failed")
+			}
+		}
+	}
+}
+
+// verifyResponse checks a response's signature, status and conditions and
+// returns its assertion and the ID of the request it answers
+func (s *SAMLService) verifyResponse(connection *SAMLConnection, encoded string, now time.Time) (*utils.XMLElement, string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, "", errors.New("response is not base64")
+	}
+	response, err := utils.ParseXML(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if response.Space != samlProtocolNamespace || response.Local != "Response" || response.Attr("Version") != "2.0" {
+		return nil, "", errors.New("not a SAML 2.0 response")
+	}
+
+	acsURL := s.ACSURL(connection.ID)
+	if destination := response.Attr("Destination"); destination != "" && destination != acsURL {
+		return nil, "", fmt.Errorf("response destination %q is not this service", destination)
+	}
+	if issuer := response.Child(samlAssertionNamespace, "Issuer"); issuer != nil && strings.TrimSpace(issuer.Text()) != connection.IdPEntityID {
+		return nil, "", errors.New("response issuer does not match the identity provider")
+	}
+	if status := response.Child(samlProtocolNamespace, "Status"); status == nil || status.Child(samlProtocolNamespace, "StatusCode") == nil ||
+		status.Child(samlProtocolNamespace, "StatusCode").Attr("Value") != samlStatusSuccess {
+		return nil, "", errors.New("identity provider did not report success")
+	}
+
+	if len(response.ChildElements(samlAssertionNamespace, "EncryptedAssertion")) > 0 {
+		return nil, "", errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.ChildElements(samlAssertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, "", errors.New("response must contain exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// The assertion, the response around it, or both must be signed. The
+	// assertion is read from what the signatures cover, never from the
+	// document as received.
+	signed := false
+	verifiedResponse, err := utils.VerifyXMLSignature(response, connection.Certificates, now)
+	switch {
+	case err == nil:
+		assertions = verifiedResponse.ChildElements(samlAssertionNamespace, "Assertion")
+		if len(assertions) != 1 {
+			return nil, "", errors.New("signed response must contain exactly one assertion")
+		}
+		assertion = assertions[0]
+		signed = true
+	case !errors.Is(err, utils.ErrXMLSignatureMissing):
+		return nil, "", fmt.Errorf("%s signature: %w", response.Local, err)
+	}
+	verifiedAssertion, err := utils.VerifyXMLSignature(assertion, connection.Certificates, now)
+	switch {
+	case err == nil:
+		assertion = verifiedAssertion
+		signed = true
+	case !errors.Is(err, utils.ErrXMLSignatureMissing):
+		return nil, "", fmt.Errorf("%s signature: %w", assertion.Local, err)
+	}
+	if !signed {
+		return nil, "", errors.New("neither the response nor the assertion is signed")
+	}
+
+	requestID := response.Attr("InResponseTo")
+	if requestID == "" {
+		return nil, "", errors.New("unsolicited responses are not accepted")
+	}
+	if err := s.checkAssertion(connection, assertion, requestID, now); err != nil {
+		return nil, "", err
+	}
+	return assertion, requestID, nil
+}
+
+// checkAssertion checks an assertion's issuer, subject confirmation and conditions
+func (s *SAMLService) checkAssertion(connection *SAMLConnection, assertion *utils.XMLElement, requestID string, now time.Time) error {
+	if assertion.Attr("Version") != "2.0" {
+		return errors.New("not a SAML 2.0 assertion")
+	}
+	issuer := assertion.Child(samlAssertionNamespace, "Issuer")
+	if issuer == nil || strings.TrimSpace(issuer.Text()) != connection.IdPEntityID {
+		return errors.New("assertion issuer does not match the identity provider")
+	}
+
+	subject := assertion.Child(samlAssertionNamespace, "Subject")
+	if subject == nil {
+		return errors.New("assertion has no subject")
+	}
+	nameID := subject.Child(samlAssertionNamespace, "NameID")
+	if nameID == nil || strings.TrimSpace(nameID.Text()) == "" || len(strings.TrimSpace(nameID.Text())) > 255 {
+		return errors.New("assertion has no valid NameID")
+	}
+
+	confirmed := false
+	for _, confirmation := range subject.ChildElements(samlAssertionNamespace, "SubjectConfirmation") {
+		data := confirmation.Child(samlAssertionNamespace, "SubjectConfirmationData")
+		if confirmation.Attr("Method") != samlBearerMethod || data == nil {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.Attr("NotOnOrAfter"))
+		if err != nil || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			continue
+		}
+		if data.Attr("Recipient") == s.ACSURL(connection.ID) && data.Attr("InResponseTo") == requestID {
+			confirmed = true
+		}
+	}
+	if !confirmed {
+		return errors.New("assertion has no valid bearer subject confirmation")
+	}
+
+	conditions := assertion.Child(samlAssertionNamespace, "Conditions")
+	if conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+	if notBefore := conditions.Attr("NotBefore"); notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil || now.Add(samlClockSkew).Before(t) {
+			return errors.New("assertion is not valid yet")
+		}
+	}
+	if notOnOrAfter := conditions.Attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil || !now.Before(t.Add(samlClockSkew)) {
+			return errors.New("assertion has expired")
+		}
+	}
+
+	// Every audience restriction must name this service
+	restrictions := conditions.ChildElements(samlAssertionNamespace, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		allowed := false
+		for _, audience := range restriction.ChildElements(samlAssertionNamespace, "Audience") {
+			if strings.TrimSpace(audience.Text()) == s.EntityID(connection.ID) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return errors.New("assertion is meant for another audience")
+		}
+	}
+	return nil
+}
+
+// externalIdentity maps a verified assertion to the user it describes
+func (c *SAMLConnection) externalIdentity(assertion *utils.XMLElement) ExternalIdentity {
+	nameID := assertion.Child(samlAssertionNamespace, "Subject").Child(samlAssertionNamespace, "NameID")
+
+	values := make(map[string][]string)
+	for _, statement := range assertion.ChildElements(samlAssertionNamespace, "AttributeStatement") {
+		for _, attribute := range statement.ChildElements(samlAssertionNamespace, "Attribute") {
+			for _, value := range attribute.ChildElements(samlAssertionNamespace, "AttributeValue") {
+				values[attribute.Attr("Name")] = append(values[attribute.Attr("Name")], strings.TrimSpace(value.Text()))
+				if friendly := attribute.Attr("FriendlyName"); friendly != "" && friendly != attribute.Attr("Name") {
+					values[friendly] = append(values[friendly], strings.TrimSpace(value.Text()))
+				}
+			}
+		}
+	}
+	first := func(field string) string {
+		if v := values[c.AttributeMapping[field]]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	external := ExternalIdentity{
+		Provider:   "saml:" + c.ID,
+		Subject:    strings.TrimSpace(nameID.Text()),
+		Email:      first(samlFieldEmail),
+		Name:       first(samlFieldName),
+		Attributes: models.Attributes{},
+		// Users the tenant provisioned over SCIM sign in without confirming the link
+		TrustedProvider: scimProvider(c.ID),
+	}
+	if external.Email == "" && nameID.Attr("Format") == samlEmailNameIDFormat {
+		external.Email = external.Subject
+	}
+
+	for field, name := range c.AttributeMapping {
+		attribute, ok := strings.CutPrefix(field, samlAttributePrefix)
+		if !ok || len(values[name]) == 0 {
+			continue
+		}
+		if len(values[name]) == 1 {
+			external.Attributes[attribute] = values[name][0]
+			continue
+		}
+		list := make([]interface{}, len(values[name]))
+		for i, value := range values[name] {
+			list[i] = value
+		}
+		external.Attributes[attribute] = list
+	}
+	return external
+}
+
+// xmlEscape escapes text for use in XML content and attribute values
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
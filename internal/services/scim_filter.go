@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SCIM filter comparison operators (RFC 7644 section 3.4.2.2)
+var scimFilterOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// SCIMComparison is one attribute comparison of a SCIM filter. Attribute and
+// Operator are lowercase, since SCIM attribute names are case-insensitive.
+// Value is a string, bool, float64 or nil, and is unset for "pr".
+type SCIMComparison struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+// SCIMFilter is a parsed SCIM filter: comparisons that must all match.
+// Grouping, "or", "not" and value paths are not supported.
+type SCIMFilter []SCIMComparison
+
+// ParseSCIMFilter parses a filter expression such as `userName eq "jane@example.com"`
+func ParseSCIMFilter(expression string) (SCIMFilter, error) {
+	tokens, err := tokenizeSCIMFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, invalidSCIMFilter("filter is empty")
+	}
+
+	var filter SCIMFilter
+	for len(tokens) > 0 {
+		if len(filter) > 0 {
+			if !strings.EqualFold(tokens[0], "and") {
+				return nil, invalidSCIMFilter(fmt.Sprintf("unsupported logical operator %q", tokens[0]))
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, invalidSCIMFilter("incomplete comparison")
+		}
+
+		comparison := SCIMComparison{
+			Attribute: scimAttributeName(tokens[0]),
+			Operator:  strings.ToLower(tokens[1]),
+		}
+		if !scimFilterOperators[comparison.Operator] {
+			return nil, invalidSCIMFilter(fmt.Sprintf("unknown operator %q", tokens[1]))
+		}
+		if strings.ContainsAny(comparison.Attribute, "()[]\"") || comparison.Attribute == "" {
+			return nil, invalidSCIMFilter(fmt.Sprintf("unsupported attribute path %q", tokens[0]))
+		}
+		tokens = tokens[2:]
+
+		if comparison.Operator != "pr" {
+			if len(tokens) == 0 {
+				return nil, invalidSCIMFilter("comparison has no value")
+			}
+			if err := json.Unmarshal([]byte(tokens[0]), &comparison.Value); err != nil {
+				return nil, invalidSCIMFilter(fmt.Sprintf("invalid value %s", tokens[0]))
+			}
+			if _, ok := comparison.Value.([]interface{}); ok {
+				return nil, invalidSCIMFilter(fmt.Sprintf("invalid value %s", tokens[0]))
+			}
+			if _, ok := comparison.Value.(map[string]interface{}); ok {
+				return nil, invalidSCIMFilter(fmt.Sprintf("invalid value %s", tokens[0]))
+			}
+			tokens = tokens[1:]
+		}
+		filter = append(filter, comparison)
+	}
+	return filter, nil
+}
+
+// tokenizeSCIMFilter splits a filter into words and quoted strings, keeping
+// the quotes. Parentheses and brackets are rejected as unsupported.
+func tokenizeSCIMFilter(expression string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expression) && expression[end] != '"' {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, invalidSCIMFilter("unterminated string")
+			}
+			tokens = append(tokens, expression[i:end+1])
+			i = end + 1
+		case c == '(' || c == ')':
+			return nil, invalidSCIMFilter("grouping is not supported")
+		default:
+			end := i
+			for end < len(expression) && !strings.ContainsRune(" \t\"()", rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// scimAttributeName lowercases an attribute path and strips a core schema URN prefix
+func scimAttributeName(path string) string {
+	path = strings.ToLower(path)
+	for _, schema := range []string{SCIMUserSchema, SCIMGroupSchema} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(path, prefix) {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+	return path
+}
+
+// invalidSCIMFilter is the error for a filter that cannot be parsed or evaluated
+func invalidSCIMFilter(detail string) error {
+	return &SCIMError{Status: http.StatusBadRequest, Type: "invalidFilter", Detail: detail}
+}
@@ -0,0 +1,1041 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// SCIM schema and message URNs
+const (
+	SCIMUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIM list page sizes
+const (
+	SCIMDefaultPageSize = 100
+	SCIMMaxPageSize     = 200
+)
+
+// scimProviderPrefix prefixes the identity provider name of the identities
+// that mark the users a tenant provisioned over SCIM
+const scimProviderPrefix = "scim:"
+
+// scimMemberFilter matches the value path identity providers use to remove one group member
+var scimMemberFilter = regexp.MustCompile(`^members\[value eq "([^"]+)"\]$`)
+
+// SCIMError is a SCIM protocol error, reported with its HTTP status and, for
+// bad requests, a SCIM error type such as "invalidFilter" or "uniqueness"
+type SCIMError struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+// SCIMErrorResponse is the body of a SCIM error response
+type SCIMErrorResponse struct {
+	Schemas []string `json:"schemas"`
+	Status  string   `json:"status"`
+	Type    string   `json:"scimType,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+}
+
+// Response returns the body of the error's response
+func (e *SCIMError) Response() SCIMErrorResponse {
+	return SCIMErrorResponse{
+		Schemas: []string{SCIMErrorSchema},
+		Status:  fmt.Sprint(e.Status),
+		Type:    e.Type,
+		Detail:  e.Detail,
+	}
+}
+
+// SCIMMeta is the metadata of a SCIM resource. Version is its ETag.
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version"`
+}
+
+// SCIMName is the name of a SCIM user
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMEmail is an email address of a SCIM user
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMUser is a user resource. userName is the user's email; emails is
+// derived from it and ignored on input.
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *SCIMName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+// SCIMMember is a member of a SCIM group; Value is the user's ID
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMGroup is a group resource
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMListResponse is a page of resources
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMPatchOperation is one operation of a SCIM PATCH request
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// SCIMPatchRequest is the body of a SCIM PATCH request
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMService provisions users and groups pushed by tenants' identity
+// providers over SCIM 2.0. A tenant only sees the users and groups it
+// provisioned: its users carry an identity of provider "scim:<tenant>" whose
+// subject is the user's externalId, or the user's ID when there is none.
+// Provisioned users have no password and sign in through the tenant's SAML
+// connection.
+type SCIMService struct {
+	UserRepo      repositories.UserRepository
+	GroupRepo     repositories.GroupRepository
+	IdentityRepo  repositories.IdentityRepository
+	UserService   *UserService
+	StatusService *UserStatusService
+	Config        *config.Config
+	Logger        *utils.Logger
+}
+
+// NewSCIMService creates a new SCIM service
+func NewSCIMService(userRepo repositories.UserRepository, groupRepo repositories.GroupRepository, identityRepo repositories.IdentityRepository, userService *UserService, statusService *UserStatusService, config *config.Config, logger *utils.Logger) *SCIMService {
+	return &SCIMService{
+		UserRepo:      userRepo,
+		GroupRepo:     groupRepo,
+		IdentityRepo:  identityRepo,
+		UserService:   userService,
+		StatusService: statusService,
+		Config:        config,
+		Logger:        logger,
+	}
+}
+
+// scimProvider is the identity provider name of a tenant's SCIM identities
+func scimProvider(tenant string) string {
+	return scimProviderPrefix + tenant
+}
+
+// BaseURL is the base URL of the SCIM endpoints
+func (s *SCIMService) BaseURL() string {
+	return s.Config.OIDC.Issuer + "/scim/v2"
+}
+
+// GetUser gets one of the tenant's users
+func (s *SCIMService) GetUser(ctx context.Context, tenant, id string) (*SCIMUser, error) {
+	user, identity, err := s.findUser(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(user, identity), nil
+}
+
+// ListUsers lists a page of the tenant's users matching a filter. Filters may
+// compare userName and externalId with "eq". startIndex is 1-based.
+func (s *SCIMService) ListUsers(ctx context.Context, tenant, filter string, startIndex, count int) (*SCIMListResponse, error) {
+	userFilter := repositories.UserFilter{IdentityProvider: scimProvider(tenant)}
+	if filter != "" {
+		parsed, err := ParseSCIMFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, comparison := range parsed {
+			value, ok := comparison.Value.(string)
+			if comparison.Operator != "eq" || !ok {
+				return nil, invalidSCIMFilter(fmt.Sprintf("unsupported comparison %s %s", comparison.Attribute, comparison.Operator))
+			}
+			switch {
+			case comparison.Attribute == "username" && userFilter.Email == "":
+				userFilter.Email = value
+			case comparison.Attribute == "externalid" && userFilter.IdentitySubject == "":
+				userFilter.IdentitySubject = value
+			default:
+				return nil, invalidSCIMFilter(fmt.Sprintf("cannot filter users by %s", comparison.Attribute))
+			}
+		}
+	}
+
+	startIndex, count = scimPage(startIndex, count)
+	users, total, err := s.UserRepo.List(ctx, userFilter, startIndex-1, max(count, 1))
+	if err != nil {
+		s.Logger.WithContext(ctx).WithError(err).WithField("tenant", tenant).Error("Failed to list SCIM users")
+		return nil, err
+	}
+	if count == 0 {
+		users = nil
+	}
+
+	resources := make([]*SCIMUser, 0, len(users))
+	for i := range users {
+		identity, err := s.tenantIdentity(ctx, tenant, users[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, s.userResource(&users[i], identity))
+	}
+	return scimList(total, startIndex, len(resources), resources), nil
+}
+
+// CreateUser provisions a user for the tenant. Emails already in use,
+// including by accounts the tenant does not manage, are rejected.
+func (s *SCIMService) CreateUser(ctx context.Context, tenant string, input *SCIMUser) (*SCIMUser, error) {
+	log := s.Logger.WithContext(ctx).WithField("tenant", tenant)
+
+	email, name, err := s.userFields(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUserUniqueness(ctx, tenant, email, input.ExternalID, 0); err != nil {
+		return nil, err
+	}
+
+	status := models.StatusActive
+	if input.Active != nil && !*input.Active {
+		status = models.StatusDeactivated
+	}
+	identity := &models.Identity{
+		PublicID: models.NewPublicID(),
+		Provider: scimProvider(tenant),
+		Subject:  input.ExternalID,
+	}
+	user, err := s.UserService.ProvisionUserWithIdentity(ctx, name, email, nil, identity, status)
+	if err != nil {
+		return nil, scimServiceError(err)
+	}
+
+	log.WithField("user_id", user.ID).Info("User provisioned over SCIM")
+	return s.userResource(user, identity), nil
+}
+
+// ReplaceUser replaces one of the tenant's users. version, if set, is the
+// ETag the user must still have.
+func (s *SCIMService) ReplaceUser(ctx context.Context, tenant, id, version string, input *SCIMUser) (*SCIMUser, error) {
+	user, identity, err := s.findUser(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSCIMVersion(version, user.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s.replaceUser(ctx, tenant, user, identity, input)
+}
+
+// PatchUser applies PATCH operations to one of the tenant's users. Attributes
+// the service does not store are ignored, as they are on create and replace.
+func (s *SCIMService) PatchUser(ctx context.Context, tenant, id, version string, operations []SCIMPatchOperation) (*SCIMUser, error) {
+	user, identity, err := s.findUser(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSCIMVersion(version, user.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	resource := s.userResource(user, identity)
+	patch := &scimUserPatch{user: resource}
+	for _, operation := range operations {
+		if err := patch.apply(operation); err != nil {
+			return nil, err
+		}
+	}
+	patch.finish()
+	return s.replaceUser(ctx, tenant, user, identity, resource)
+}
+
+// DeleteUser deletes one of the tenant's users
+func (s *SCIMService) DeleteUser(ctx context.Context, tenant, id, version string) error {
+	log := s.Logger.WithContext(ctx).WithField("tenant", tenant)
+
+	user, identity, err := s.findUser(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+	if err := checkSCIMVersion(version, user.UpdatedAt); err != nil {
+		return err
+	}
+
+	if err := s.UserService.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	// Free the externalId for reuse
+	if err := s.IdentityRepo.Delete(ctx, user.ID, identity.PublicID); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Warn("Failed to delete SCIM identity")
+	}
+
+	log.WithField("user_id", user.ID).Info("User deleted over SCIM")
+	return nil
+}
+
+// GetGroup gets one of the tenant's groups, with its members unless excluded
+func (s *SCIMService) GetGroup(ctx context.Context, tenant, id string, includeMembers bool) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.groupResource(ctx, group, includeMembers)
+}
+
+// ListGroups lists a page of the tenant's groups matching a filter. Filters
+// may compare displayName and externalId with "eq". startIndex is 1-based.
+func (s *SCIMService) ListGroups(ctx context.Context, tenant, filter string, startIndex, count int, includeMembers bool) (*SCIMListResponse, error) {
+	groupFilter := repositories.GroupFilter{Provider: scimProvider(tenant)}
+	if filter != "" {
+		parsed, err := ParseSCIMFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, comparison := range parsed {
+			value, ok := comparison.Value.(string)
+			if comparison.Operator != "eq" || !ok {
+				return nil, invalidSCIMFilter(fmt.Sprintf("unsupported comparison %s %s", comparison.Attribute, comparison.Operator))
+			}
+			switch {
+			case comparison.Attribute == "displayname" && groupFilter.Name == "":
+				groupFilter.Name = value
+			case comparison.Attribute == "externalid" && groupFilter.ExternalID == "":
+				groupFilter.ExternalID = value
+			default:
+				return nil, invalidSCIMFilter(fmt.Sprintf("cannot filter groups by %s", comparison.Attribute))
+			}
+		}
+	}
+
+	startIndex, count = scimPage(startIndex, count)
+	groups, total, err := s.GroupRepo.List(ctx, groupFilter, startIndex-1, max(count, 1))
+	if err != nil {
+		s.Logger.WithContext(ctx).WithError(err).WithField("tenant", tenant).Error("Failed to list SCIM groups")
+		return nil, err
+	}
+	if count == 0 {
+		groups = nil
+	}
+
+	resources := make([]*SCIMGroup, 0, len(groups))
+	for i := range groups {
+		resource, err := s.groupResource(ctx, &groups[i], includeMembers)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return scimList(total, startIndex, len(resources), resources), nil
+}
+
+// CreateGroup creates a group for the tenant. Members must be the tenant's users.
+func (s *SCIMService) CreateGroup(ctx context.Context, tenant string, input *SCIMGroup) (*SCIMGroup, error) {
+	log := s.Logger.WithContext(ctx).WithField("tenant", tenant)
+
+	name, err := groupName(input.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGroupName(ctx, tenant, name, 0); err != nil {
+		return nil, err
+	}
+	memberIDs, err := s.memberIDs(ctx, tenant, input.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.Group{
+		PublicID:   models.NewPublicID(),
+		Name:       name,
+		Provider:   scimProvider(tenant),
+		ExternalID: input.ExternalID,
+	}
+	if err := s.GroupRepo.Create(ctx, group); err != nil {
+		return nil, err
+	}
+	if err := s.GroupRepo.AddMembers(ctx, group.ID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	log.WithField("group_id", group.ID).Info("Group provisioned over SCIM")
+	return s.groupResource(ctx, group, true)
+}
+
+// ReplaceGroup replaces one of the tenant's groups, including its members
+func (s *SCIMService) ReplaceGroup(ctx context.Context, tenant, id, version string, input *SCIMGroup) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSCIMVersion(version, group.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	memberIDs, err := s.memberIDs(ctx, tenant, input.Members)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[uint]bool, len(memberIDs))
+	for _, memberID := range memberIDs {
+		members[memberID] = true
+	}
+	return s.updateGroup(ctx, tenant, group, input.DisplayName, input.ExternalID, members)
+}
+
+// PatchGroup applies PATCH operations to one of the tenant's groups. Members
+// are added or removed by value, or removed with a members[value eq "..."] path.
+func (s *SCIMService) PatchGroup(ctx context.Context, tenant, id, version string, operations []SCIMPatchOperation) (*SCIMGroup, error) {
+	group, err := s.findGroup(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSCIMVersion(version, group.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	current, err := s.GroupRepo.ListMembers(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[uint]bool, len(current))
+	for _, user := range current {
+		members[user.ID] = true
+	}
+
+	name, externalID := group.Name, group.ExternalID
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		path := scimAttributeName(operation.Path)
+
+		if path == "" && op != "remove" {
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return nil, invalidSCIMValue("operation without a path needs an object value")
+			}
+			for attribute, value := range attributes {
+				if err := s.patchGroupAttribute(ctx, tenant, op, scimAttributeName(attribute), value, &name, &externalID, members); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if match := scimMemberFilter.FindStringSubmatch(path); match != nil && op == "remove" {
+			if user, _, err := s.findUser(ctx, tenant, match[1]); err == nil {
+				delete(members, user.ID)
+			}
+			continue
+		}
+
+		if err := s.patchGroupAttribute(ctx, tenant, op, path, operation.Value, &name, &externalID, members); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.updateGroup(ctx, tenant, group, name, externalID, members)
+}
+
+// DeleteGroup deletes one of the tenant's groups
+func (s *SCIMService) DeleteGroup(ctx context.Context, tenant, id, version string) error {
+	group, err := s.findGroup(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+	if err := checkSCIMVersion(version, group.UpdatedAt); err != nil {
+		return err
+	}
+
+	if err := s.GroupRepo.Delete(ctx, group.ID); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("tenant", tenant).WithField("group_id", group.ID).Info("Group deleted over SCIM")
+	return nil
+}
+
+// findUser finds one of the tenant's users and the identity that marks them as such
+func (s *SCIMService) findUser(ctx context.Context, tenant, id string) (*models.User, *models.Identity, error) {
+	user, err := s.UserRepo.FindByPublicID(ctx, id)
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		return nil, nil, scimNotFound("User", id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity, err := s.tenantIdentity(ctx, tenant, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if identity == nil {
+		return nil, nil, scimNotFound("User", id)
+	}
+	return user, identity, nil
+}
+
+// tenantIdentity returns the identity that marks a user as provisioned by the tenant, or nil
+func (s *SCIMService) tenantIdentity(ctx context.Context, tenant string, userID uint) (*models.Identity, error) {
+	identities, err := s.IdentityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range identities {
+		if identities[i].Provider == scimProvider(tenant) {
+			return &identities[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// replaceUser updates a user to match a resource
+func (s *SCIMService) replaceUser(ctx context.Context, tenant string, user *models.User, identity *models.Identity, input *SCIMUser) (*SCIMUser, error) {
+	log := s.Logger.WithContext(ctx).WithField("tenant", tenant).WithField("user_id", user.ID)
+
+	email, name, err := s.userFields(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUserUniqueness(ctx, tenant, email, input.ExternalID, user.ID); err != nil {
+		return nil, err
+	}
+
+	user, err = s.UserService.UpdateUser(ctx, user.ID, name, email, nil)
+	if err != nil {
+		return nil, scimServiceError(err)
+	}
+
+	subject := input.ExternalID
+	if subject == "" {
+		subject = user.PublicID
+	}
+	if identity.Subject != subject || identity.Email != user.Email {
+		identity.Subject = subject
+		identity.Email = user.Email
+		if err := s.IdentityRepo.Update(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Active != nil {
+		if user, err = s.setActive(ctx, tenant, user, *input.Active); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("User updated over SCIM")
+	return s.userResource(user, identity), nil
+}
+
+// setActive deactivates a user or reactivates a deactivated one. Other
+// statuses, such as an administrator's suspension, are left alone.
+func (s *SCIMService) setActive(ctx context.Context, tenant string, user *models.User, active bool) (*models.User, error) {
+	deactivated := user.Status == models.StatusDeactivated
+	if active == !deactivated {
+		return user, nil
+	}
+
+	status, reason := models.StatusDeactivated, "deprovisioned by SCIM tenant "+tenant
+	if active {
+		status, reason = models.StatusActive, "reprovisioned by SCIM tenant "+tenant
+	}
+	if _, err := s.StatusService.ChangeStatus(ctx, nil, user.PublicID, status, reason, nil); err != nil {
+		return nil, err
+	}
+
+	// Reload for the new modification time
+	return s.UserRepo.FindByID(ctx, user.ID)
+}
+
+// userFields reads the email and name of a user resource. The name falls
+// back from displayName to name.formatted to the given and family names.
+func (s *SCIMService) userFields(input *SCIMUser) (string, string, error) {
+	email := strings.TrimSpace(input.UserName)
+	if email == "" {
+		return "", "", invalidSCIMValue("userName is required")
+	}
+	if _, err := utils.NormalizeEmail(email, s.Config.Email.FoldLocalPart); err != nil {
+		return "", "", invalidSCIMValue("userName must be an email address")
+	}
+
+	name := strings.TrimSpace(input.DisplayName)
+	if name == "" && input.Name != nil {
+		name = strings.TrimSpace(input.Name.Formatted)
+		if name == "" {
+			name = strings.TrimSpace(input.Name.GivenName + " " + input.Name.FamilyName)
+		}
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return email, name, nil
+}
+
+// checkUserUniqueness checks that an email and externalId are not used by
+// another user than the one with userID
+func (s *SCIMService) checkUserUniqueness(ctx context.Context, tenant, email, externalID string, userID uint) error {
+	existing, err := s.UserRepo.FindByEmail(ctx, email)
+	if err == nil && existing.ID != userID {
+		return &SCIMError{Status: http.StatusConflict, Type: "uniqueness", Detail: "userName is already in use"}
+	}
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		return err
+	}
+
+	if externalID != "" {
+		identity, err := s.IdentityRepo.FindBySubject(ctx, scimProvider(tenant), externalID)
+		if err == nil && identity.UserID != userID {
+			return &SCIMError{Status: http.StatusConflict, Type: "uniqueness", Detail: "externalId is already in use"}
+		}
+		if err != nil && !errors.Is(err, repositories.ErrIdentityNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// userResource builds the SCIM resource of a user
+func (s *SCIMService) userResource(user *models.User, identity *models.Identity) *SCIMUser {
+	active := user.Status != models.StatusDeactivated
+	resource := &SCIMUser{
+		Schemas:     []string{SCIMUserSchema},
+		ID:          user.PublicID,
+		UserName:    user.Email,
+		Name:        &SCIMName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta:        s.meta("User", user.PublicID, user.CreatedAt, user.UpdatedAt),
+	}
+	if identity.Subject != user.PublicID {
+		resource.ExternalID = identity.Subject
+	}
+	return resource
+}
+
+// findGroup finds one of the tenant's groups
+func (s *SCIMService) findGroup(ctx context.Context, tenant, id string) (*models.Group, error) {
+	group, err := s.GroupRepo.FindByPublicID(ctx, id)
+	if errors.Is(err, repositories.ErrGroupNotFound) || (err == nil && group.Provider != scimProvider(tenant)) {
+		return nil, scimNotFound("Group", id)
+	}
+	return group, err
+}
+
+// patchGroupAttribute applies one PATCH operation to a group attribute
+func (s *SCIMService) patchGroupAttribute(ctx context.Context, tenant, op, path string, value json.RawMessage, name, externalID *string, members map[uint]bool) error {
+	switch path {
+	case "displayname":
+		if op == "remove" {
+			return invalidSCIMValue("displayName is required")
+		}
+		return json.Unmarshal(value, name)
+	case "externalid":
+		if op == "remove" {
+			*externalID = ""
+			return nil
+		}
+		return json.Unmarshal(value, externalID)
+	case "members":
+		var patched []SCIMMember
+		if len(value) > 0 {
+			if err := json.Unmarshal(value, &patched); err != nil {
+				return invalidSCIMValue("members must be a list")
+			}
+		}
+		if op == "replace" || (op == "remove" && len(patched) == 0) {
+			for id := range members {
+				delete(members, id)
+			}
+		}
+		if op == "remove" {
+			for _, member := range patched {
+				if user, _, err := s.findUser(ctx, tenant, member.Value); err == nil {
+					delete(members, user.ID)
+				}
+			}
+			return nil
+		}
+		ids, err := s.memberIDs(ctx, tenant, patched)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			members[id] = true
+		}
+		return nil
+	case "id", "schemas", "meta":
+		return nil
+	}
+	return &SCIMError{Status: http.StatusBadRequest, Type: "invalidPath", Detail: fmt.Sprintf("unknown group attribute %q", path)}
+}
+
+// updateGroup saves a group's name and externalId and sets its members
+func (s *SCIMService) updateGroup(ctx context.Context, tenant string, group *models.Group, displayName, externalID string, members map[uint]bool) (*SCIMGroup, error) {
+	name, err := groupName(displayName)
+	if err != nil {
+		return nil, err
+	}
+	if name != group.Name {
+		if err := s.checkGroupName(ctx, tenant, name, group.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := s.GroupRepo.ListMembers(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	var removed []uint
+	for _, user := range current {
+		if !members[user.ID] {
+			removed = append(removed, user.ID)
+		}
+		delete(members, user.ID)
+	}
+	added := make([]uint, 0, len(members))
+	for id := range members {
+		added = append(added, id)
+	}
+	if err := s.GroupRepo.RemoveMembers(ctx, group.ID, removed); err != nil {
+		return nil, err
+	}
+	if err := s.GroupRepo.AddMembers(ctx, group.ID, added); err != nil {
+		return nil, err
+	}
+
+	// Saving the group also moves its modification time for membership changes
+	group.Name = name
+	group.ExternalID = externalID
+	if err := s.GroupRepo.Update(ctx, group); err != nil {
+		return nil, err
+	}
+
+	s.Logger.WithContext(ctx).WithField("tenant", tenant).WithField("group_id", group.ID).Info("Group updated over SCIM")
+	return s.groupResource(ctx, group, true)
+}
+
+// checkGroupName checks that no other group of the tenant has a name
+func (s *SCIMService) checkGroupName(ctx context.Context, tenant, name string, groupID uint) error {
+	groups, _, err := s.GroupRepo.List(ctx, repositories.GroupFilter{Provider: scimProvider(tenant), Name: name}, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 && groups[0].ID != groupID {
+		return &SCIMError{Status: http.StatusConflict, Type: "uniqueness", Detail: "displayName is already in use"}
+	}
+	return nil
+}
+
+// memberIDs resolves group members to the IDs of the tenant's users
+func (s *SCIMService) memberIDs(ctx context.Context, tenant string, members []SCIMMember) ([]uint, error) {
+	ids := make([]uint, 0, len(members))
+	for _, member := range members {
+		user, _, err := s.findUser(ctx, tenant, member.Value)
+		var scimErr *SCIMError
+		if errors.As(err, &scimErr) {
+			return nil, invalidSCIMValue(fmt.Sprintf("member %q is not a user of this tenant", member.Value))
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+// groupResource builds the SCIM resource of a group
+func (s *SCIMService) groupResource(ctx context.Context, group *models.Group, includeMembers bool) (*SCIMGroup, error) {
+	resource := &SCIMGroup{
+		Schemas:     []string{SCIMGroupSchema},
+		ID:          group.PublicID,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.Name,
+		Meta:        s.meta("Group", group.PublicID, group.CreatedAt, group.UpdatedAt),
+	}
+	if !includeMembers {
+		return resource, nil
+	}
+
+	members, err := s.GroupRepo.ListMembers(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range members {
+		resource.Members = append(resource.Members, SCIMMember{
+			Value:   user.PublicID,
+			Display: user.Name,
+			Ref:     s.BaseURL() + "/Users/" + user.PublicID,
+		})
+	}
+	return resource, nil
+}
+
+// meta builds the metadata of a resource
+func (s *SCIMService) meta(resourceType, id string, created, modified time.Time) *SCIMMeta {
+	return &SCIMMeta{
+		ResourceType: resourceType,
+		Created:      created,
+		LastModified: modified,
+		Location:     s.BaseURL() + "/" + resourceType + "s/" + id,
+		Version:      SCIMVersion(modified),
+	}
+}
+
+// SCIMVersion is the ETag of a resource last modified at a time. The time is
+// rounded to microseconds, as the database stores it.
+func SCIMVersion(modified time.Time) string {
+	return fmt.Sprintf(`W/"%d"`, modified.Round(time.Microsecond).UnixMicro())
+}
+
+// checkSCIMVersion checks an If-Match header against a resource's current version
+func checkSCIMVersion(expected string, modified time.Time) error {
+	if expected == "" || expected == "*" {
+		return nil
+	}
+	current := SCIMVersion(modified)
+	for _, version := range strings.Split(expected, ",") {
+		if strings.TrimSpace(version) == current {
+			return nil
+		}
+	}
+	return &SCIMError{Status: http.StatusPreconditionFailed, Detail: "resource has been modified"}
+}
+
+// scimPage normalizes the startIndex and count of a list request
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIMMaxPageSize {
+		count = SCIMMaxPageSize
+	}
+	return startIndex, count
+}
+
+// scimList builds a list response
+func scimList(total int64, startIndex, itemsPerPage int, resources interface{}) *SCIMListResponse {
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+// groupName validates a group's displayName
+func groupName(displayName string) (string, error) {
+	name := strings.TrimSpace(displayName)
+	if name == "" {
+		return "", invalidSCIMValue("displayName is required")
+	}
+	if len(name) > 255 {
+		return "", invalidSCIMValue("displayName must be at most 255 characters")
+	}
+	return name, nil
+}
+
+// scimNotFound is the error for a resource the tenant cannot see
+func scimNotFound(resourceType, id string) error {
+	return &SCIMError{Status: http.StatusNotFound, Detail: fmt.Sprintf("%s %s not found", resourceType, id)}
+}
+
+// invalidSCIMValue is the error for a request with an invalid attribute value
+func invalidSCIMValue(detail string) error {
+	return &SCIMError{Status: http.StatusBadRequest, Type: "invalidValue", Detail: detail}
+}
+
+// scimServiceError reports validation errors of the user service as invalid values
+func scimServiceError(err error) error {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return invalidSCIMValue(strings.Join(append([]string{validationErr.Message}, validationErr.Violations...), "; "))
+	}
+	return err
+}
+
+// scimUserPatch applies PATCH operations to a user resource
+type scimUserPatch struct {
+	user *SCIMUser
+	// nameParts is set when the given or family name changed without the
+	// display name, which is then rebuilt from them
+	nameParts   bool
+	displayName bool
+}
+
+// apply applies one operation
+func (p *scimUserPatch) apply(operation SCIMPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return invalidSCIMValue(fmt.Sprintf("unknown operation %q", operation.Op))
+	}
+
+	path := scimAttributeName(operation.Path)
+	if path != "" {
+		return p.applyAttribute(op, path, operation.Value)
+	}
+	if op == "remove" {
+		return &SCIMError{Status: http.StatusBadRequest, Type: "noTarget", Detail: "remove operations need a path"}
+	}
+
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return invalidSCIMValue("operation without a path needs an object value")
+	}
+	for attribute, value := range attributes {
+		if err := p.applyAttribute(op, scimAttributeName(attribute), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAttribute applies an operation to one attribute
+func (p *scimUserPatch) applyAttribute(op, path string, value json.RawMessage) error {
+	if p.user.Name == nil {
+		p.user.Name = &SCIMName{}
+	}
+
+	var target *string
+	switch path {
+	case "username":
+		if op == "remove" {
+			return invalidSCIMValue("userName is required")
+		}
+		target = &p.user.UserName
+	case "displayname":
+		target = &p.user.DisplayName
+		p.displayName = true
+	case "externalid":
+		target = &p.user.ExternalID
+	case "name.formatted":
+		target = &p.user.Name.Formatted
+		p.displayName = true
+	case "name.givenname":
+		target = &p.user.Name.GivenName
+		p.nameParts = true
+	case "name.familyname":
+		target = &p.user.Name.FamilyName
+		p.nameParts = true
+	case "name":
+		if op == "remove" {
+			return nil
+		}
+		var name map[string]json.RawMessage
+		if err := json.Unmarshal(value, &name); err != nil {
+			return invalidSCIMValue("name must be an object")
+		}
+		for attribute, value := range name {
+			if err := p.applyAttribute(op, "name."+strings.ToLower(attribute), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "active":
+		if op == "remove" {
+			return nil
+		}
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		p.user.Active = &active
+		return nil
+	default:
+		// Attributes that are not stored, such as emails, which follow userName
+		return nil
+	}
+
+	if op == "remove" {
+		*target = ""
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return invalidSCIMValue(fmt.Sprintf("%s must be a string", path))
+	}
+	return nil
+}
+
+// finish rebuilds the display name from changed name parts
+func (p *scimUserPatch) finish() {
+	if p.nameParts && !p.displayName {
+		p.user.DisplayName = ""
+		p.user.Name.Formatted = ""
+	}
+}
+
+// scimBool reads a boolean, which some identity providers send as a string
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, invalidSCIMValue("active must be a boolean")
+}
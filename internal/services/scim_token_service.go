@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrInvalidSCIMToken is returned for unknown SCIM bearer tokens
+var ErrInvalidSCIMToken = errors.New("invalid SCIM token")
+
+// SCIMTokenService manages the bearer tokens tenants provision users with over SCIM
+type SCIMTokenService struct {
+	TokenRepo repositories.SCIMTokenRepository
+	Logger    *utils.Logger
+}
+
+// NewSCIMTokenService creates a new SCIM token service
+func NewSCIMTokenService(tokenRepo repositories.SCIMTokenRepository, logger *utils.Logger) *SCIMTokenService {
+	return &SCIMTokenService{
+		TokenRepo: tokenRepo,
+		Logger:    logger,
+	}
+}
+
+// CreateToken creates a SCIM token for a tenant. The plaintext token is
+// returned only here; afterwards only its prefix is available.
+func (s *SCIMTokenService) CreateToken(ctx context.Context, tenant, name string) (*models.SCIMToken, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	var violations []string
+	if !isValidTenantID(tenant) {
+		violations = append(violations, "tenant must be 1-40 characters without spaces or URL delimiters")
+	}
+	if strings.TrimSpace(name) == "" {
+		violations = append(violations, "name is required")
+	}
+	if len(violations) > 0 {
+		return nil, "", &ValidationError{Message: "invalid SCIM token", Violations: violations}
+	}
+
+	plaintext, err := utils.GenerateOpaqueToken(models.SCIMTokenKind)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate SCIM token")
+		return nil, "", err
+	}
+
+	token := &models.SCIMToken{
+		PublicID:  models.NewPublicID(),
+		Tenant:    tenant,
+		Name:      strings.TrimSpace(name),
+		Prefix:    utils.OpaqueTokenPrefix(plaintext),
+		TokenHash: utils.HashOpaqueToken(plaintext),
+	}
+	if err := s.TokenRepo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+
+	log.WithField("tenant", tenant).WithField("prefix", token.Prefix).Info("SCIM token created successfully")
+	return token, plaintext, nil
+}
+
+// ListTokens lists SCIM tokens, optionally only those of one tenant
+func (s *SCIMTokenService) ListTokens(ctx context.Context, tenant string) ([]models.SCIMToken, error) {
+	return s.TokenRepo.List(ctx, tenant)
+}
+
+// DeleteToken revokes a SCIM token
+func (s *SCIMTokenService) DeleteToken(ctx context.Context, publicID string) error {
+	if err := s.TokenRepo.Delete(ctx, publicID); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("public_id", publicID).Info("SCIM token deleted successfully")
+	return nil
+}
+
+// Authenticate resolves a SCIM bearer token to its token record, which names the tenant
+func (s *SCIMTokenService) Authenticate(ctx context.Context, credential string) (*models.SCIMToken, error) {
+	token, err := s.TokenRepo.FindByHash(ctx, utils.HashOpaqueToken(credential))
+	if errors.Is(err, repositories.ErrSCIMTokenNotFound) {
+		return nil, ErrInvalidSCIMToken
+	}
+	return token, err
+}
+
+// isValidTenantID reports whether a tenant ID can be used in URLs and identity provider names
+func isValidTenantID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, "/?#: ") && len(id) <= 40
+}
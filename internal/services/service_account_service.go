@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrInvalidClient is returned when client authentication fails
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// ErrInvalidScope is returned when a client requests scopes it was not granted
+var ErrInvalidScope = errors.New("requested scope is not allowed")
+
+// ServiceAccountService manages service accounts and issues their access tokens
+type ServiceAccountService struct {
+	AccountRepo repositories.ServiceAccountRepository
+	Config      *config.Config
+	Logger      *utils.Logger
+}
+
+// NewServiceAccountService creates a new service account service
+func NewServiceAccountService(accountRepo repositories.ServiceAccountRepository, config *config.Config, logger *utils.Logger) *ServiceAccountService {
+	return &ServiceAccountService{
+		AccountRepo: accountRepo,
+		Config:      config,
+		Logger:      logger,
+	}
+}
+
+// ServiceAccountUpdate holds the service account fields to change; nil fields are left as they are
+type ServiceAccountUpdate struct {
+	Name        *string
+	Description *string
+	Scopes      []string
+	Disabled    *bool
+}
+
+// CreateAccount creates a service account and returns it with its first
+// client secret. The plaintext secret is returned only here.
+func (s *ServiceAccountService) CreateAccount(ctx context.Context, name, description string, scopes []string) (*models.ServiceAccount, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := validateServiceAccount(name, scopes); err != nil {
+		log.WithError(err).Warn("Service account validation failed")
+		return nil, "", err
+	}
+
+	secret, plaintext, err := newServiceAccountSecret()
+	if err != nil {
+		log.WithError(err).Error("Failed to generate client secret")
+		return nil, "", err
+	}
+
+	account := &models.ServiceAccount{
+		PublicID:    models.NewPublicID(),
+		Name:        strings.TrimSpace(name),
+		Description: description,
+		Scopes:      dedupeScopes(scopes),
+	}
+
+	if err := s.AccountRepo.Create(ctx, account, secret); err != nil {
+		log.WithError(err).Error("Failed to create service account")
+		return nil, "", err
+	}
+
+	log.WithField("client_id", account.PublicID).Info("Service account created successfully")
+	return account, plaintext, nil
+}
+
+// ListAccounts lists all service accounts
+func (s *ServiceAccountService) ListAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	return s.AccountRepo.List(ctx)
+}
+
+// GetAccount gets a service account by client ID
+func (s *ServiceAccountService) GetAccount(ctx context.Context, clientID string) (*models.ServiceAccount, error) {
+	return s.AccountRepo.FindByPublicID(ctx, clientID)
+}
+
+// UpdateAccount updates a service account. Scope and status changes apply
+// to previously issued tokens immediately.
+func (s *ServiceAccountService) UpdateAccount(ctx context.Context, clientID string, update ServiceAccountUpdate) (*models.ServiceAccount, error) {
+	log := s.Logger.WithContext(ctx)
+
+	account, err := s.AccountRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		log.WithError(err).WithField("client_id", clientID).Warn("Failed to find service account for update")
+		return nil, err
+	}
+
+	name := account.Name
+	if update.Name != nil {
+		name = *update.Name
+	}
+	scopes := []string(account.Scopes)
+	if update.Scopes != nil {
+		scopes = update.Scopes
+	}
+	if err := validateServiceAccount(name, scopes); err != nil {
+		log.WithError(err).Warn("Service account validation failed")
+		return nil, err
+	}
+
+	account.Name = strings.TrimSpace(name)
+	account.Scopes = dedupeScopes(scopes)
+	if update.Description != nil {
+		account.Description = *update.Description
+	}
+	if update.Disabled != nil {
+		account.Disabled = *update.Disabled
+	}
+
+	if err := s.AccountRepo.Update(ctx, account); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to update service account")
+		return nil, err
+	}
+
+	log.WithField("client_id", clientID).Info("Service account updated successfully")
+	return account, nil
+}
+
+// DeleteAccount deletes a service account and its secrets
+func (s *ServiceAccountService) DeleteAccount(ctx context.Context, clientID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	account, err := s.AccountRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		log.WithError(err).WithField("client_id", clientID).Warn("Failed to find service account for deletion")
+		return err
+	}
+
+	if err := s.AccountRepo.Delete(ctx, account.ID); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to delete service account")
+		return err
+	}
+
+	log.WithField("client_id", clientID).Info("Service account deleted successfully")
+	return nil
+}
+
+// ListSecrets lists a service account's client secrets without their values
+func (s *ServiceAccountService) ListSecrets(ctx context.Context, clientID string) ([]models.ServiceAccountSecret, error) {
+	account, err := s.AccountRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return s.AccountRepo.ListSecrets(ctx, account.ID)
+}
+
+// RotateSecret issues a new client secret. Existing secrets keep working for
+// the grace period so deployments can switch over, then expire.
+func (s *ServiceAccountService) RotateSecret(ctx context.Context, clientID string, grace time.Duration) (*models.ServiceAccountSecret, string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if grace < 0 {
+		return nil, "", &ValidationError{Message: "invalid rotation", Violations: []string{"grace period cannot be negative"}}
+	}
+
+	account, err := s.AccountRepo.FindByPublicID(ctx, clientID)
+	if err != nil {
+		log.WithError(err).WithField("client_id", clientID).Warn("Failed to find service account for secret rotation")
+		return nil, "", err
+	}
+
+	secret, plaintext, err := newServiceAccountSecret()
+	if err != nil {
+		log.WithError(err).Error("Failed to generate client secret")
+		return nil, "", err
+	}
+	secret.ServiceAccountID = account.ID
+
+	if err := s.AccountRepo.RotateSecret(ctx, secret, time.Now().Add(grace)); err != nil {
+		log.WithError(err).WithField("client_id", clientID).Error("Failed to rotate client secret")
+		return nil, "", err
+	}
+
+	log.WithField("client_id", clientID).WithField("grace", grace.String()).Info("Client secret rotated successfully")
+	return secret, plaintext, nil
+}
+
+// IssueClientCredentialsToken authenticates a client with its secret and
+// issues an access token for the requested space-separated scopes, or for
+// every granted scope if none are requested
+func (s *ServiceAccountService) IssueClientCredentialsToken(ctx context.Context, clientID, clientSecret, requestedScope string) (string, []string, time.Duration, error) {
+	log := s.Logger.WithContext(ctx).WithField("client_id", clientID)
+
+	account, err := s.AuthenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		log.WithError(err).Warn("Client authentication failed")
+		return "", nil, 0, err
+	}
+
+	scopes := []string(account.Scopes)
+	if requested := strings.Fields(requestedScope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !account.HasScope(scope) {
+				log.WithField("scope", scope).Warn("Client requested a scope it was not granted")
+				return "", nil, 0, ErrInvalidScope
+			}
+		}
+		scopes = dedupeScopes(requested)
+	}
+
+	ttl := time.Duration(s.Config.OAuth.AccessTokenTTL) * time.Minute
+	token, err := utils.GenerateClientToken(account.PublicID, scopes, s.Config.JWT.Secret, ttl)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate client access token")
+		return "", nil, 0, err
+	}
+
+	log.Info("Client credentials token issued")
+	return token, scopes, ttl, nil
+}
+
+// AuthenticateToken resolves the service account a validated client token was
+// issued to and returns the token scopes the account still holds
+func (s *ServiceAccountService) AuthenticateToken(ctx context.Context, claims *utils.JWTClaims) (*models.ServiceAccount, []string, error) {
+	account, err := s.AccountRepo.FindByPublicID(ctx, claims.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if account.Disabled {
+		return nil, nil, ErrInvalidClient
+	}
+
+	// Scopes removed from the account stop working for tokens already issued
+	var scopes []string
+	for _, scope := range claims.Scopes() {
+		if account.HasScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return account, scopes, nil
+}
+
+// AuthenticateClient verifies a client ID and secret against the account's unexpired secrets
+func (s *ServiceAccountService) AuthenticateClient(ctx context.Context, clientID, clientSecret string) (*models.ServiceAccount, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	account, err := s.AccountRepo.FindByPublicID(ctx, clientID)
+	if errors.Is(err, repositories.ErrServiceAccountNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if account.Disabled {
+		return nil, ErrInvalidClient
+	}
+
+	secrets, err := s.AccountRepo.ListSecrets(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := utils.HashOpaqueToken(clientSecret)
+	now := time.Now()
+	for i := range secrets {
+		if !secrets[i].Expired(now) && subtle.ConstantTimeCompare([]byte(secrets[i].SecretHash), []byte(hash)) == 1 {
+			return account, nil
+		}
+	}
+	return nil, ErrInvalidClient
+}
+
+// newServiceAccountSecret generates a client secret and its stored record
+func newServiceAccountSecret() (*models.ServiceAccountSecret, string, error) {
+	plaintext, err := utils.GenerateOpaqueToken(models.ServiceAccountSecretKind)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &models.ServiceAccountSecret{
+		PublicID:   models.NewPublicID(),
+		Prefix:     utils.OpaqueTokenPrefix(plaintext),
+		SecretHash: utils.HashOpaqueToken(plaintext),
+	}, plaintext, nil
+}
+
+// validateServiceAccount validates service account input
+func validateServiceAccount(name string, scopes []string) error {
+	var violations []string
+
+	if strings.TrimSpace(name) == "" {
+		violations = append(violations, "name is required")
+	}
+	for _, scope := range scopes {
+		if !models.IsValidServiceAccountScope(scope) {
+			violations = append(violations, fmt.Sprintf("scope %q cannot be granted to a service account", scope))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid service account", Violations: violations}
+	}
+	return nil
+}
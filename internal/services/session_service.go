@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// maxUserAgentLength is the longest user agent stored on a session
+const maxUserAgentLength = 500
+
+// ClientInfo describes the device a login was made from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionService manages login sessions. Session activity is buffered in
+// memory by Touch and written in batches by FlushLastSeen.
+type SessionService struct {
+	SessionRepo repositories.SessionRepository
+	Config      *config.Config
+	Logger      *utils.Logger
+
+	lastSeen *activityBuffer
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(sessionRepo repositories.SessionRepository, config *config.Config, logger *utils.Logger) *SessionService {
+	return &SessionService{
+		SessionRepo: sessionRepo,
+		Config:      config,
+		Logger:      logger,
+		lastSeen:    newActivityBuffer(),
+	}
+}
+
+// CreateSession records a new session for the user, lasting as long as a login token
+func (s *SessionService) CreateSession(ctx context.Context, user *models.User, client ClientInfo) (*models.Session, error) {
+	log := s.Logger.WithContext(ctx)
+
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		PublicID:   models.NewPublicID(),
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IPAddress:  client.IPAddress,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Hour * time.Duration(s.Config.JWT.Expiry)),
+	}
+
+	if err := s.SessionRepo.Create(ctx, session); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to create session")
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ValidateSession checks that the session belongs to the user and is still active
+func (s *SessionService) ValidateSession(ctx context.Context, userID uint, publicID string) (*models.Session, error) {
+	session, err := s.SessionRepo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != userID || !session.IsActive(time.Now()) {
+		return nil, ErrTokenRevoked
+	}
+	return session, nil
+}
+
+// ListSessions lists the user's active sessions, marking the current one
+func (s *SessionService) ListSessions(ctx context.Context, userID uint, currentID string) ([]models.Session, error) {
+	log := s.Logger.WithContext(ctx)
+
+	sessions, err := s.SessionRepo.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list sessions")
+		return nil, err
+	}
+
+	for i := range sessions {
+		// Show activity that has not been flushed yet
+		if seenAt, ok := s.lastSeen.latest(sessions[i].PublicID); ok && seenAt.After(sessions[i].LastSeenAt) {
+			sessions[i].LastSeenAt = seenAt
+		}
+		sessions[i].Current = sessions[i].PublicID == currentID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's sessions
+func (s *SessionService) RevokeSession(ctx context.Context, userID uint, publicID string) error {
+	log := s.Logger.WithContext(ctx)
+
+	if err := s.SessionRepo.Revoke(ctx, userID, publicID, time.Now()); err != nil {
+		log.WithError(err).WithField("user_id", userID).Warn("Failed to revoke session")
+		return err
+	}
+
+	log.WithField("user_id", userID).Info("Session revoked successfully")
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID uint, keepID string) error {
+	return s.SessionRepo.RevokeAllExcept(ctx, userID, keepID, time.Now())
+}
+
+// Touch records activity on a session. It is written by the next FlushLastSeen.
+func (s *SessionService) Touch(publicID string) {
+	s.lastSeen.touch(publicID)
+}
+
+// FlushLastSeen writes buffered session activity in a single batch
+func (s *SessionService) FlushLastSeen(ctx context.Context) error {
+	return s.lastSeen.flush(ctx, s.SessionRepo.UpdateLastSeen)
+}
+
+// RunLastSeenFlusher calls FlushLastSeen every interval until ctx is cancelled,
+// flushing once more before returning
+func (s *SessionService) RunLastSeenFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.FlushLastSeen(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Session last seen flush failed")
+			}
+			return
+		case <-ticker.C:
+			if err := s.FlushLastSeen(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Session last seen flush failed")
+			}
+		}
+	}
+}
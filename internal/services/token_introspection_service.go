@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/utils"
+)
+
+// Token types reported by introspection
+const (
+	TokenTypeAccess        = "access_token"
+	TokenTypeRefresh       = "refresh_token"
+	TokenTypePersonalToken = "personal_access_token"
+)
+
+// TokenCaller is a client authenticated at the introspection or revocation
+// endpoint, either an OAuth client or a service account
+type TokenCaller struct {
+	ClientID    string
+	OAuthClient *models.OAuthClient
+}
+
+// TokenIntrospection describes a token. Inactive tokens carry no other details.
+type TokenIntrospection struct {
+	Active    bool
+	Subject   string
+	Username  string
+	ClientID  string
+	Scopes    []string
+	TokenType string
+	ExpiresAt *time.Time
+	IssuedAt  *time.Time
+	Actor     *utils.Actor // the admin acting as the subject of an impersonation token
+}
+
+// TokenIntrospectionService answers introspection and revocation requests
+// for every kind of token the service issues: login, client and delegated
+// JWTs, personal access tokens and OAuth refresh tokens. Impersonation tokens
+// are only reported active while ImpersonationService finds their
+// impersonation active.
+type TokenIntrospectionService struct {
+	UserService           *UserService
+	AccessTokenService    *PersonalAccessTokenService
+	ServiceAccountService *ServiceAccountService
+	OAuthService          *OAuthService
+	RevocationService     *TokenRevocationService
+	ImpersonationService  *ImpersonationService
+	Config                *config.Config
+	Logger                *utils.Logger
+}
+
+// NewTokenIntrospectionService creates a new token introspection service
+func NewTokenIntrospectionService(userService *UserService, accessTokenService *PersonalAccessTokenService, serviceAccountService *ServiceAccountService, oauthService *OAuthService, revocationService *TokenRevocationService, impersonationService *ImpersonationService, config *config.Config, logger *utils.Logger) *TokenIntrospectionService {
+	return &TokenIntrospectionService{
+		UserService:           userService,
+		AccessTokenService:    accessTokenService,
+		ServiceAccountService: serviceAccountService,
+		OAuthService:          oauthService,
+		RevocationService:     revocationService,
+		ImpersonationService:  impersonationService,
+		Config:                config,
+		Logger:                logger,
+	}
+}
+
+// AuthenticateCaller authenticates the client calling the introspection or
+// revocation endpoint, trying OAuth clients before service accounts
+func (s *TokenIntrospectionService) AuthenticateCaller(ctx context.Context, clientID, clientSecret string) (*TokenCaller, error) {
+	client, err := s.OAuthService.AuthenticateClient(ctx, clientID, clientSecret)
+	if err == nil {
+		return &TokenCaller{ClientID: client.PublicID, OAuthClient: client}, nil
+	}
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return nil, err
+	}
+
+	account, err := s.ServiceAccountService.AuthenticateClient(ctx, clientID, clientSecret)
+	if errors.Is(err, ErrInvalidClient) {
+		return nil, &OAuthError{Code: OAuthErrorInvalidClient, Description: "client authentication failed"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TokenCaller{ClientID: account.PublicID}, nil
+}
+
+// Introspect describes a token to a confidential client. Tokens that are
+// malformed, unknown, expired, revoked or whose owner is no longer active are
+// reported inactive. Refresh tokens are only described to the client holding them.
+func (s *TokenIntrospectionService) Introspect(ctx context.Context, caller *TokenCaller, token string) (*TokenIntrospection, error) {
+	if caller.OAuthClient != nil && caller.OAuthClient.Public {
+		return nil, &OAuthError{Code: OAuthErrorUnauthorizedClient, Description: "public clients cannot introspect tokens"}
+	}
+
+	switch {
+	case strings.HasPrefix(token, models.PersonalAccessTokenKind+"_"):
+		return s.introspectPersonalAccessToken(ctx, token)
+	case strings.HasPrefix(token, models.OAuthRefreshTokenKind+"_"):
+		return s.introspectRefreshToken(ctx, caller, token)
+	default:
+		return s.introspectJWT(ctx, token)
+	}
+}
+
+// Revoke revokes an access or refresh token on behalf of the client it was
+// issued to. Invalid and unknown tokens are ignored, as RFC 7009 requires,
+// since the client's goal of the token no longer being usable is met.
+func (s *TokenIntrospectionService) Revoke(ctx context.Context, caller *TokenCaller, token string) error {
+	if strings.HasPrefix(token, models.OAuthRefreshTokenKind+"_") {
+		if caller.OAuthClient == nil {
+			return &OAuthError{Code: OAuthErrorUnauthorizedClient, Description: "token was not issued to this client"}
+		}
+		return s.OAuthService.RevokeRefreshToken(ctx, caller.OAuthClient, token)
+	}
+
+	claims, err := utils.ValidateToken(token, s.Config.JWT.Secret)
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != caller.ClientID {
+		return &OAuthError{Code: OAuthErrorUnauthorizedClient, Description: "token was not issued to this client"}
+	}
+	return s.RevocationService.Revoke(ctx, claims)
+}
+
+// introspectJWT describes a login, client or delegated access token
+func (s *TokenIntrospectionService) introspectJWT(ctx context.Context, token string) (*TokenIntrospection, error) {
+	claims, err := utils.ValidateToken(token, s.Config.JWT.Secret)
+	if err != nil {
+		return &TokenIntrospection{}, nil
+	}
+
+	revoked, err := s.RevocationService.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &TokenIntrospection{}, nil
+	}
+
+	result := &TokenIntrospection{
+		Active:    true,
+		Subject:   claims.Subject,
+		ClientID:  claims.ClientID,
+		TokenType: TokenTypeAccess,
+		ExpiresAt: &claims.ExpiresAt.Time,
+		IssuedAt:  &claims.IssuedAt.Time,
+	}
+
+	if claims.IsClientToken() {
+		account, scopes, err := s.ServiceAccountService.AuthenticateToken(ctx, claims)
+		if err != nil {
+			return &TokenIntrospection{}, nil
+		}
+		result.Username = account.Name
+		result.Scopes = scopes
+		return result, nil
+	}
+
+	user, err := s.UserService.AuthenticateToken(ctx, claims)
+	if err != nil {
+		return &TokenIntrospection{}, nil
+	}
+	if claims.IsImpersonation() {
+		if s.ImpersonationService == nil {
+			return &TokenIntrospection{}, nil
+		}
+		if _, err := s.ImpersonationService.Authenticate(ctx, claims, user); err != nil {
+			return &TokenIntrospection{}, nil
+		}
+		result.Actor = claims.Act
+	}
+	result.Username = user.Email
+	result.Scopes = claims.Scopes()
+	return result, nil
+}
+
+// introspectPersonalAccessToken describes a personal access token
+func (s *TokenIntrospectionService) introspectPersonalAccessToken(ctx context.Context, token string) (*TokenIntrospection, error) {
+	record, user, err := s.AccessTokenService.Lookup(ctx, token)
+	if err != nil {
+		return &TokenIntrospection{}, nil
+	}
+
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   user.PublicID,
+		Username:  user.Email,
+		Scopes:    record.Scopes,
+		TokenType: TokenTypePersonalToken,
+		ExpiresAt: record.ExpiresAt,
+		IssuedAt:  &record.CreatedAt,
+	}, nil
+}
+
+// introspectRefreshToken describes a refresh token held by the caller
+func (s *TokenIntrospectionService) introspectRefreshToken(ctx context.Context, caller *TokenCaller, token string) (*TokenIntrospection, error) {
+	record, client, user, err := s.OAuthService.LookupRefreshToken(ctx, token)
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return &TokenIntrospection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if client.PublicID != caller.ClientID {
+		return &TokenIntrospection{}, nil
+	}
+
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   user.PublicID,
+		Username:  user.Email,
+		ClientID:  client.PublicID,
+		Scopes:    record.Scopes,
+		TokenType: TokenTypeRefresh,
+		ExpiresAt: &record.ExpiresAt,
+		IssuedAt:  &record.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// TokenRevocationService keeps the store of access tokens revoked before
+// their expiry. Only tokens issued to clients can be revoked one at a time;
+// user tokens are revoked through their session or all at once.
+type TokenRevocationService struct {
+	RevokedTokenRepo repositories.RevokedTokenRepository
+	Logger           *utils.Logger
+}
+
+// NewTokenRevocationService creates a new token revocation service
+func NewTokenRevocationService(revokedTokenRepo repositories.RevokedTokenRepository, logger *utils.Logger) *TokenRevocationService {
+	return &TokenRevocationService{
+		RevokedTokenRepo: revokedTokenRepo,
+		Logger:           logger,
+	}
+}
+
+// Revoke revokes a client access token until it expires
+func (s *TokenRevocationService) Revoke(ctx context.Context, claims *utils.JWTClaims) error {
+	if !revocable(claims) || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	if err := s.RevokedTokenRepo.Create(ctx, &models.RevokedToken{TokenID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}); err != nil {
+		return err
+	}
+
+	s.Logger.WithContext(ctx).WithField("jti", claims.ID).WithField("client_id", claims.ClientID).Info("Access token revoked")
+	return nil
+}
+
+// IsRevoked reports whether a validated token has been revoked
+func (s *TokenRevocationService) IsRevoked(ctx context.Context, claims *utils.JWTClaims) (bool, error) {
+	if !revocable(claims) {
+		return false, nil
+	}
+	return s.RevokedTokenRepo.Exists(ctx, claims.ID)
+}
+
+// PurgeExpired deletes revocation records of tokens that have expired anyway
+func (s *TokenRevocationService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.RevokedTokenRepo.DeleteExpired(ctx, time.Now())
+}
+
+// RunPurger purges expired revocation records every interval until ctx is cancelled
+func (s *TokenRevocationService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Revoked token purge failed")
+			}
+		}
+	}
+}
+
+// revocable reports whether a token can be revoked individually. Tokens
+// issued before token IDs were introduced have no jti.
+func revocable(claims *utils.JWTClaims) bool {
+	return claims.ID != "" && claims.ClientID != ""
+}
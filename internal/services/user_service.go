@@ -3,7 +3,10 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/user/user-management-service/config"
 	"github.com/user/user-management-service/internal/models"
@@ -11,27 +14,116 @@ import (
 	"github.com/user/user-management-service/utils"
 )
 
+// passwordChangeTokenTTL is the lifetime of the restricted token issued for expired passwords
+const passwordChangeTokenTTL = 15 * time.Minute
+
+// ErrInvalidCredentials is returned by Login for an unknown email or a wrong password
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrPasswordExpired is returned by Login together with a restricted token
+// that only allows the user to change their password
+var ErrPasswordExpired = errors.New("password expired, change required")
+
+// ErrInvalidCurrentPassword is returned when a password change supplies the wrong current password
+var ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+
+// ErrTokenRevoked is returned for tokens issued before the user revoked their sessions
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// AccountStatusError is returned when a user's account status prevents access
+type AccountStatusError struct {
+	Status string
+}
+
+func (e *AccountStatusError) Error() string {
+	return "account is " + e.Status
+}
+
+// Code returns a machine-readable error code for the status
+func (e *AccountStatusError) Code() string {
+	return "account_" + e.Status
+}
+
+// checkAccountStatus returns an AccountStatusError unless the account is active
+func checkAccountStatus(user *models.User) error {
+	if status := user.EffectiveStatus(time.Now()); status != models.StatusActive {
+		return &AccountStatusError{Status: status}
+	}
+	return nil
+}
+
+// SecondFactor challenges users who set up a second factor after their password
+type SecondFactor interface {
+	// BeginSecondFactor returns the challenge a user must answer to complete a
+	// password login, or nil if they have no second factor
+	BeginSecondFactor(ctx context.Context, user *models.User) (*WebAuthnCeremony, error)
+	// BeginLinkSecondFactor returns the challenge a user must answer to
+	// complete a magic link sign-in, or nil if they have no second factor
+	BeginLinkSecondFactor(ctx context.Context, user *models.User) (*WebAuthnCeremony, error)
+	// BeginStepUp returns the challenge a signed-in user must answer to
+	// complete a password re-authentication, or nil if they have no second factor
+	BeginStepUp(ctx context.Context, user *models.User) (*WebAuthnCeremony, error)
+}
+
+// SecondFactorRequiredError is returned by Login once the password is
+// verified, when the user must still answer a second factor challenge.
+// Reauthenticate and magic link sign-ins return it the same way.
+type SecondFactorRequiredError struct {
+	Challenge *WebAuthnCeremony
+}
+
+func (e *SecondFactorRequiredError) Error() string {
+	return "second factor required"
+}
+
+// ValidationError holds every validation problem found in a request
+type ValidationError struct {
+	Message    string
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message + ": " + strings.Join(e.Violations, "; ")
+}
+
 // UserService handles business logic for users
 type UserService struct {
-	UserRepo repositories.UserRepository
-	Config   *config.Config
-	Logger   *utils.Logger
+	UserRepo            repositories.UserRepository
+	PasswordHistoryRepo repositories.PasswordHistoryRepository
+	SessionService      *SessionService
+	Config              *config.Config
+	Logger              *utils.Logger
+	PasswordPolicy      *PasswordPolicy
+	AttributeSchema     *AttributeSchema
+	SecondFactor        SecondFactor
+	GroupService        *GroupService
 }
 
-// NewUserService creates a new user service
-func NewUserService(userRepo repositories.UserRepository, config *config.Config, logger *utils.Logger) *UserService {
+// NewUserService creates a new user service. Tokens only list groups when
+// groupService is not nil.
+// The attribute schema starts empty and is loaded separately, and logins only
+// require a second factor once one is set.
+func NewUserService(userRepo repositories.UserRepository, passwordHistoryRepo repositories.PasswordHistoryRepository, sessionService *SessionService, groupService *GroupService, config *config.Config, logger *utils.Logger) *UserService {
+	emptySchema, _ := NewAttributeSchema(nil)
+
 	return &UserService{
-		UserRepo: userRepo,
-		Config:   config,
-		Logger:   logger,
+		UserRepo:            userRepo,
+		PasswordHistoryRepo: passwordHistoryRepo,
+		SessionService:      sessionService,
+		GroupService:        groupService,
+		Config:              config,
+		Logger:              logger,
+		PasswordPolicy:      NewPasswordPolicy(config),
+		AttributeSchema:     emptySchema,
 	}
 }
 
 // RegisterUser registers a new user
-func (s *UserService) RegisterUser(ctx context.Context, name, email, password string) (*models.User, error) {
+func (s *UserService) RegisterUser(ctx context.Context, name, email, password string, attributes models.Attributes) (*models.User, error) {
 	log := s.Logger.WithContext(ctx)
 
 	// Validate input
+	email = strings.TrimSpace(email)
 	if err := s.validateRegistration(name, email, password); err != nil {
 		log.WithError(err).Warn("Registration validation failed")
 		return nil, err
@@ -44,11 +136,29 @@ func (s *UserService) RegisterUser(ctx context.Context, name, email, password st
 		return nil, errors.New("email already registered")
 	}
 
+	if attributes == nil {
+		attributes = models.Attributes{}
+	}
+	if err := s.validateAttributes(ctx, attributes, 0); err != nil {
+		log.WithError(err).Warn("Attribute validation failed")
+		return nil, err
+	}
+
 	// Create user
+	now := time.Now()
 	user := &models.User{
-		Name:     name,
-		Email:    email,
-		Password: password,
+		PublicID:          models.NewPublicID(),
+		Name:              name,
+		Email:             email,
+		Role:              models.RoleUser,
+		Status:            models.StatusActive,
+		Attributes:        attributes,
+		PasswordChangedAt: &now,
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		log.WithError(err).Error("Failed to hash password")
+		return nil, err
 	}
 
 	if err := s.UserRepo.Create(ctx, user); err != nil {
@@ -56,27 +166,122 @@ func (s *UserService) RegisterUser(ctx context.Context, name, email, password st
 		return nil, err
 	}
 
+	s.recordPasswordHistory(ctx, user)
+
 	log.WithField("user_id", user.ID).Info("User registered successfully")
 	return user, nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *UserService) Login(ctx context.Context, email, password string) (string, error) {
-	log := s.Logger.WithContext(ctx)
-
+// Login authenticates a user, starts a session for the client and returns a
+// JWT token for it. If the password has expired, a restricted password-change
+// token is returned together with ErrPasswordExpired. Users with a second
+// factor get a SecondFactorRequiredError instead, and complete the login with
+// CompletePasswordLogin once they answer its challenge.
+func (s *UserService) Login(ctx context.Context, email, password string, client ClientInfo) (string, error) {
 	user, err := s.UserRepo.FindByEmail(ctx, email)
 	if err != nil {
-		log.WithField("email", email).Warn("User not found during login")
-		return "", errors.New("invalid email or password")
+		s.Logger.WithContext(ctx).WithField("email", email).Warn("User not found during login")
+		return "", ErrInvalidCredentials
 	}
+	return s.LoginUser(ctx, user, password, client)
+}
+
+// LoginUser signs in a known user with their password exactly like Login
+func (s *UserService) LoginUser(ctx context.Context, user *models.User, password string, client ClientInfo) (string, error) {
+	log := s.Logger.WithContext(ctx)
 
 	if err := user.ValidatePassword(password); err != nil {
 		log.WithField("user_id", user.ID).Warn("Invalid password during login")
-		return "", errors.New("invalid email or password")
+		return "", ErrInvalidCredentials
+	}
+
+	// Only reveal the account status once the credentials are verified
+	if err := checkAccountStatus(user); err != nil {
+		log.WithField("user_id", user.ID).WithError(err).Warn("Login rejected by account status")
+		return "", err
+	}
+
+	// Upgrade the stored hash if it was made with outdated parameters
+	if user.PasswordNeedsRehash() {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	// Start tracking the age of passwords set before it was recorded
+	if user.PasswordChangedAt == nil {
+		s.startPasswordAge(ctx, user)
+	}
+
+	if s.SecondFactor != nil {
+		challenge, err := s.SecondFactor.BeginSecondFactor(ctx, user)
+		if err != nil {
+			return "", errors.New("authentication failed")
+		}
+		if challenge != nil {
+			log.WithField("user_id", user.ID).Info("Password verified, second factor required")
+			return "", &SecondFactorRequiredError{Challenge: challenge}
+		}
+	}
+
+	return s.CompletePasswordLogin(ctx, user, client, utils.NewAuthentication(utils.AMRPassword))
+}
+
+// CompletePasswordLogin starts a session for a user whose password has been
+// verified, and returns a JWT token for it, or a password-change token
+// together with ErrPasswordExpired
+func (s *UserService) CompletePasswordLogin(ctx context.Context, user *models.User, client ClientInfo, auth utils.Authentication) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := checkAccountStatus(user); err != nil {
+		log.WithField("user_id", user.ID).WithError(err).Warn("Login rejected by account status")
+		return "", err
+	}
+
+	session, err := s.SessionService.CreateSession(ctx, user, client)
+	if err != nil {
+		return "", errors.New("authentication failed")
+	}
+
+	// Expired passwords only get a token that allows changing the password
+	maxAge := time.Duration(s.Config.PasswordPolicy.MaxAgeDays) * 24 * time.Hour
+	if user.PasswordExpired(maxAge, time.Now()) {
+		token, err := utils.GenerateScopedToken(user.PublicID, session.PublicID, utils.ScopePasswordChange, s.Config.JWT.Secret, passwordChangeTokenTTL)
+		if err != nil {
+			log.WithError(err).Error("Failed to generate password change token")
+			return "", errors.New("authentication failed")
+		}
+
+		log.WithField("user_id", user.ID).Warn("Password expired, issued password change token")
+		return token, ErrPasswordExpired
 	}
 
 	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, s.Config.JWT.Secret, s.Config.JWT.Expiry)
+	token, err := s.generateToken(ctx, user, session.PublicID, auth, s.tokenTTL())
+	if err != nil {
+		log.WithError(err).Error("Failed to generate JWT token")
+		return "", errors.New("authentication failed")
+	}
+
+	log.WithField("user_id", user.ID).Info("User logged in successfully")
+	return token, nil
+}
+
+// StartSession starts a session for a user authenticated by other means than
+// their password, such as an external identity provider, and returns a JWT
+// token for it
+func (s *UserService) StartSession(ctx context.Context, user *models.User, client ClientInfo, auth utils.Authentication) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := checkAccountStatus(user); err != nil {
+		log.WithField("user_id", user.ID).WithError(err).Warn("Login rejected by account status")
+		return "", err
+	}
+
+	session, err := s.SessionService.CreateSession(ctx, user, client)
+	if err != nil {
+		return "", errors.New("authentication failed")
+	}
+
+	token, err := s.generateToken(ctx, user, session.PublicID, auth, s.tokenTTL())
 	if err != nil {
 		log.WithError(err).Error("Failed to generate JWT token")
 		return "", errors.New("authentication failed")
@@ -86,6 +291,170 @@ func (s *UserService) Login(ctx context.Context, email, password string) (string
 	return token, nil
 }
 
+// Reauthenticate confirms a signed-in user's identity with their password
+// before a sensitive operation, and returns a short-lived token for their
+// session that records the fresh authentication. Users with a second factor
+// get a SecondFactorRequiredError instead, and are issued the token once they
+// answer its challenge.
+func (s *UserService) Reauthenticate(ctx context.Context, user *models.User, sessionID, password string) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := user.ValidatePassword(password); err != nil {
+		log.WithField("user_id", user.ID).Warn("Invalid password during re-authentication")
+		return "", ErrInvalidCurrentPassword
+	}
+
+	if s.SecondFactor != nil {
+		challenge, err := s.SecondFactor.BeginStepUp(ctx, user)
+		if err != nil {
+			return "", err
+		}
+		if challenge != nil {
+			log.WithField("user_id", user.ID).Info("Password re-verified, second factor required")
+			return "", &SecondFactorRequiredError{Challenge: challenge}
+		}
+	}
+
+	return s.IssueStepUpToken(ctx, user, sessionID, utils.NewAuthentication(utils.AMRPassword))
+}
+
+// IssueStepUpToken returns a short-lived token for a session whose user has
+// just re-authenticated
+func (s *UserService) IssueStepUpToken(ctx context.Context, user *models.User, sessionID string, auth utils.Authentication) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := checkAccountStatus(user); err != nil {
+		return "", err
+	}
+
+	ttl := time.Duration(s.Config.StepUp.TokenTTL) * time.Minute
+	token, err := s.generateToken(ctx, user, sessionID, auth, ttl)
+	if err != nil {
+		log.WithError(err).Error("Failed to generate step-up token")
+		return "", err
+	}
+
+	log.WithField("user_id", user.ID).WithField("amr", auth.Methods).Info("User re-authenticated")
+	return token, nil
+}
+
+// generateToken generates a JWT token for a user's session that lists the
+// groups they are in
+func (s *UserService) generateToken(ctx context.Context, user *models.User, sessionID string, auth utils.Authentication, ttl time.Duration) (string, error) {
+	var groups utils.GroupClaims
+	if s.GroupService != nil {
+		var err error
+		if groups, err = s.GroupService.Claims(ctx, user); err != nil {
+			return "", err
+		}
+	}
+	return utils.GenerateToken(user.PublicID, sessionID, auth, groups, s.Config.JWT.Secret, ttl)
+}
+
+// tokenTTL returns the lifetime of login tokens
+func (s *UserService) tokenTTL() time.Duration {
+	return time.Duration(s.Config.JWT.Expiry) * time.Hour
+}
+
+// ProvisionUser creates an active account for a user signing in through an
+// external identity provider. The account gets a random password nobody
+// knows, so it can only be signed in to through a linked identity.
+func (s *UserService) ProvisionUser(ctx context.Context, name, email string, attributes models.Attributes) (*models.User, error) {
+	return s.provisionUser(ctx, name, email, attributes, nil, models.StatusActive)
+}
+
+// ProvisionUserWithIdentity provisions a user like ProvisionUser, with an
+// initial status, and links identity to the account in the same transaction.
+// An identity without a subject is keyed by the user's public ID.
+func (s *UserService) ProvisionUserWithIdentity(ctx context.Context, name, email string, attributes models.Attributes, identity *models.Identity, status string) (*models.User, error) {
+	return s.provisionUser(ctx, name, email, attributes, identity, status)
+}
+
+// provisionUser creates a provisioned account with a status, together with
+// identity unless it is nil
+func (s *UserService) provisionUser(ctx context.Context, name, email string, attributes models.Attributes, identity *models.Identity, status string) (*models.User, error) {
+	log := s.Logger.WithContext(ctx)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+
+	if attributes == nil {
+		attributes = models.Attributes{}
+	}
+	if err := s.validateAttributes(ctx, attributes, 0); err != nil {
+		log.WithError(err).Warn("Attribute validation failed")
+		return nil, err
+	}
+
+	password, err := utils.GenerateOpaqueToken("pw")
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		PublicID:     models.NewPublicID(),
+		Name:         name,
+		Email:        strings.TrimSpace(email),
+		Role:         models.RoleUser,
+		Status:       status,
+		Attributes:   attributes,
+		Passwordless: true,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	if identity == nil {
+		err = s.UserRepo.Create(ctx, user)
+	} else {
+		identity.Email = user.Email
+		if identity.Subject == "" {
+			identity.Subject = user.PublicID
+		}
+		err = s.UserRepo.CreateWithIdentity(ctx, user, identity)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to provision user")
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Info("User provisioned")
+	return user, nil
+}
+
+// rehashPassword re-hashes a verified password with the current hasher.
+// Failures are logged but do not fail the login.
+func (s *UserService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	log := s.Logger.WithContext(ctx)
+
+	if err := user.SetPassword(password); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Warn("Failed to rehash password")
+		return
+	}
+
+	if err := s.UserRepo.Update(ctx, user); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Warn("Failed to rehash password")
+		return
+	}
+
+	log.WithField("user_id", user.ID).Info("Password rehashed with current parameters")
+}
+
+// startPasswordAge records now as the password change date of a user whose
+// password predates change dates, so the password expires a full maximum age
+// from now rather than at once
+func (s *UserService) startPasswordAge(ctx context.Context, user *models.User) {
+	now := time.Now()
+	user.PasswordChangedAt = &now
+
+	if err := s.UserRepo.Update(ctx, user); err != nil {
+		s.Logger.WithContext(ctx).WithError(err).WithField("user_id", user.ID).Warn("Failed to record password age")
+	}
+}
+
 // GetUserByID gets a user by ID
 func (s *UserService) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
 	log := s.Logger.WithContext(ctx)
@@ -100,8 +469,23 @@ func (s *UserService) GetUserByID(ctx context.Context, id uint) (*models.User, e
 	return user, nil
 }
 
-// UpdateUser updates a user
-func (s *UserService) UpdateUser(ctx context.Context, id uint, name, email, password string) (*models.User, error) {
+// GetUserByPublicID gets a user by public ID
+func (s *UserService) GetUserByPublicID(ctx context.Context, publicID string) (*models.User, error) {
+	log := s.Logger.WithContext(ctx)
+
+	user, err := s.UserRepo.FindByPublicID(ctx, publicID)
+	if err != nil {
+		log.WithError(err).WithField("public_id", publicID).Warn("Failed to get user by public ID")
+		return nil, err
+	}
+
+	log.WithField("public_id", publicID).Debug("User retrieved successfully")
+	return user, nil
+}
+
+// UpdateUser updates a user's profile. Passwords are changed through ChangePassword.
+// Provided attributes are merged into the existing ones; a nil value removes an attribute.
+func (s *UserService) UpdateUser(ctx context.Context, id uint, name, email string, attributes models.Attributes) (*models.User, error) {
 	log := s.Logger.WithContext(ctx)
 
 	user, err := s.UserRepo.FindByID(ctx, id)
@@ -115,7 +499,13 @@ func (s *UserService) UpdateUser(ctx context.Context, id uint, name, email, pass
 		user.Name = name
 	}
 
+	email = strings.TrimSpace(email)
 	if email != "" && email != user.Email {
+		if _, err := utils.NormalizeEmail(email, s.Config.Email.FoldLocalPart); err != nil {
+			log.WithField("email", email).Warn("Invalid email format for update")
+			return nil, err
+		}
+
 		// Check if new email already exists
 		existingUser, err := s.UserRepo.FindByEmail(ctx, email)
 		if err == nil && existingUser != nil && existingUser.ID != id {
@@ -126,8 +516,24 @@ func (s *UserService) UpdateUser(ctx context.Context, id uint, name, email, pass
 		user.Email = email
 	}
 
-	if password != "" {
-		user.Password = password
+	if len(attributes) > 0 {
+		merged := models.Attributes{}
+		for k, v := range user.Attributes {
+			merged[k] = v
+		}
+		for k, v := range attributes {
+			if v == nil {
+				delete(merged, k)
+				continue
+			}
+			merged[k] = v
+		}
+
+		if err := s.validateAttributes(ctx, merged, id); err != nil {
+			log.WithError(err).WithField("user_id", id).Warn("Attribute validation failed")
+			return nil, err
+		}
+		user.Attributes = merged
 	}
 
 	if err := s.UserRepo.Update(ctx, user); err != nil {
@@ -139,6 +545,87 @@ func (s *UserService) UpdateUser(ctx context.Context, id uint, name, email, pass
 	return user, nil
 }
 
+// ChangePassword changes a user's password after verifying the current one.
+// All previously issued tokens and every other session are revoked, and a
+// fresh token for the current session is returned.
+func (s *UserService) ChangePassword(ctx context.Context, id uint, sessionID, currentPassword, newPassword string) (string, error) {
+	log := s.Logger.WithContext(ctx)
+
+	user, err := s.UserRepo.FindByID(ctx, id)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Warn("Failed to find user for password change")
+		return "", err
+	}
+
+	if err := user.ValidatePassword(currentPassword); err != nil {
+		log.WithField("user_id", id).Warn("Invalid current password during password change")
+		return "", ErrInvalidCurrentPassword
+	}
+
+	if newPassword == currentPassword {
+		log.WithField("user_id", id).Warn("New password matches current password")
+		return "", &PasswordPolicyError{Violations: []string{"new password must be different from the current password"}}
+	}
+
+	if err := s.changePassword(ctx, user, newPassword); err != nil {
+		log.WithError(err).WithField("user_id", id).Warn("New password rejected")
+		return "", err
+	}
+
+	// Revoke every token issued before this change
+	revokedAt := time.Now()
+	user.TokensRevokedAt = &revokedAt
+
+	if err := s.UserRepo.Update(ctx, user); err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to save new password")
+		return "", err
+	}
+
+	s.recordPasswordHistory(ctx, user)
+
+	if err := s.SessionService.RevokeOtherSessions(ctx, user.ID, sessionID); err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to revoke other sessions")
+		return "", err
+	}
+
+	// The current password was just verified
+	token, err := s.generateToken(ctx, user, sessionID, utils.NewAuthentication(utils.AMRPassword), s.tokenTTL())
+	if err != nil {
+		log.WithError(err).Error("Failed to generate JWT token")
+		return "", err
+	}
+
+	log.WithField("user_id", id).Info("Password changed successfully")
+	return token, nil
+}
+
+// AuthenticateToken resolves the user a validated token was issued to.
+// It fails if the user no longer exists, revoked their tokens after the token
+// was issued, is not active, or if the token's session has ended. Tokens
+// issued before sessions were introduced carry no session ID.
+func (s *UserService) AuthenticateToken(ctx context.Context, claims *utils.JWTClaims) (*models.User, error) {
+	user, err := s.UserRepo.FindByPublicID(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// JWT timestamps have second precision
+	if user.TokensRevokedAt != nil && claims.IssuedAt.Time.Before(user.TokensRevokedAt.Truncate(time.Second)) {
+		return nil, ErrTokenRevoked
+	}
+
+	if claims.SessionID != "" {
+		if _, err := s.SessionService.ValidateSession(ctx, user.ID, claims.SessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // DeleteUser deletes a user
 func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
 	log := s.Logger.WithContext(ctx)
@@ -159,8 +646,8 @@ func (s *UserService) DeleteUser(ctx context.Context, id uint) error {
 	return nil
 }
 
-// ListUsers lists users with pagination
-func (s *UserService) ListUsers(ctx context.Context, page, perPage int) ([]models.User, int64, error) {
+// ListUsers lists users matching the filter with pagination
+func (s *UserService) ListUsers(ctx context.Context, filter repositories.UserFilter, page, perPage int) ([]models.User, int64, error) {
 	log := s.Logger.WithContext(ctx)
 
 	if page < 1 {
@@ -173,7 +660,7 @@ func (s *UserService) ListUsers(ctx context.Context, page, perPage int) ([]model
 
 	offset := (page - 1) * perPage
 
-	users, total, err := s.UserRepo.List(ctx, offset, perPage)
+	users, total, err := s.UserRepo.List(ctx, filter, offset, perPage)
 	if err != nil {
 		log.WithError(err).Error("Failed to list users")
 		return nil, 0, err
@@ -183,6 +670,195 @@ func (s *UserService) ListUsers(ctx context.Context, page, perPage int) ([]model
 	return users, total, nil
 }
 
+// BootstrapAdmin makes the registered user with an email an admin, unless
+// there already is an admin. It returns the promoted user, or nil if an admin
+// already exists.
+func (s *UserService) BootstrapAdmin(ctx context.Context, email string) (*models.User, error) {
+	log := s.Logger.WithContext(ctx)
+
+	_, admins, err := s.UserRepo.List(ctx, repositories.UserFilter{Role: models.RoleAdmin}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if admins > 0 {
+		return nil, nil
+	}
+
+	user, err := s.UserRepo.FindByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		log.WithField("email", email).Warn("Admin bootstrap user not found")
+		return nil, err
+	}
+
+	user.Role = models.RoleAdmin
+	if err := s.UserRepo.Update(ctx, user); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to make user an admin")
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).Warn("User made an admin by bootstrap")
+	return user, nil
+}
+
+// ValidateAttributeFilter checks that filtered attributes exist in the schema
+// and, unless includePrivate is set, that they are publicly visible
+func (s *UserService) ValidateAttributeFilter(filter repositories.UserFilter, includePrivate bool) error {
+	var violations []string
+	for name := range filter.Attributes {
+		def, ok := s.AttributeSchema.Definition(name)
+		if !ok {
+			violations = append(violations, fmt.Sprintf("unknown attribute %q", name))
+			continue
+		}
+		if !includePrivate && def.Visibility != VisibilityPublic {
+			violations = append(violations, fmt.Sprintf("attribute %q cannot be filtered", name))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid attribute filter", Violations: violations}
+	}
+	return nil
+}
+
+// ExportUsers streams every user matching the filter to fn
+func (s *UserService) ExportUsers(ctx context.Context, filter repositories.UserFilter, fn func(*models.User) error) error {
+	log := s.Logger.WithContext(ctx)
+
+	if err := s.UserRepo.Stream(ctx, filter, fn); err != nil {
+		log.WithError(err).Error("Failed to export users")
+		return err
+	}
+
+	log.Info("Users exported successfully")
+	return nil
+}
+
+// changePassword validates a new password against the policy and the user's
+// password history, then hashes it onto the user. The caller persists the user.
+func (s *UserService) changePassword(ctx context.Context, user *models.User, password string) error {
+	if err := s.PasswordPolicy.Validate(password, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	reused, err := s.isPasswordReused(ctx, user, password)
+	if err != nil {
+		return err
+	}
+	if reused {
+		return &PasswordPolicyError{Violations: []string{
+			"password must not match any of your last " + strconv.Itoa(s.Config.PasswordPolicy.HistorySize) + " passwords",
+		}}
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+// savePasswordReset saves a password set through a reset link, which
+// changePassword validated onto the user. All tokens and sessions are revoked,
+// since the reset may take the account back from whoever knew the old password.
+func (s *UserService) savePasswordReset(ctx context.Context, user *models.User) error {
+	log := s.Logger.WithContext(ctx).WithField("user_id", user.ID)
+
+	revokedAt := time.Now()
+	user.TokensRevokedAt = &revokedAt
+	if err := s.UserRepo.Update(ctx, user); err != nil {
+		log.WithError(err).Error("Failed to save reset password")
+		return err
+	}
+
+	s.recordPasswordHistory(ctx, user)
+
+	if err := s.SessionService.RevokeOtherSessions(ctx, user.ID, ""); err != nil {
+		log.WithError(err).Error("Failed to revoke sessions")
+		return err
+	}
+	return nil
+}
+
+// isPasswordReused reports whether the password matches the current password
+// or one of the last N passwords in the user's history
+func (s *UserService) isPasswordReused(ctx context.Context, user *models.User, password string) (bool, error) {
+	historySize := s.Config.PasswordPolicy.HistorySize
+	if historySize <= 0 {
+		return false, nil
+	}
+
+	if user.ValidatePassword(password) == nil {
+		return true, nil
+	}
+
+	entries, err := s.PasswordHistoryRepo.ListRecent(ctx, user.ID, historySize)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range entries {
+		if entries[i].Matches(password) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPasswordHistory stores the user's current password hash and prunes
+// entries beyond the configured history size. Failures are logged only.
+func (s *UserService) recordPasswordHistory(ctx context.Context, user *models.User) {
+	historySize := s.Config.PasswordPolicy.HistorySize
+	if historySize <= 0 {
+		return
+	}
+
+	log := s.Logger.WithContext(ctx).WithField("user_id", user.ID)
+
+	entry := &models.PasswordHistory{
+		UserID:       user.ID,
+		PasswordHash: user.Password,
+	}
+	if err := s.PasswordHistoryRepo.Create(ctx, entry); err != nil {
+		log.WithError(err).Warn("Failed to record password history")
+		return
+	}
+
+	if err := s.PasswordHistoryRepo.Prune(ctx, user.ID, historySize); err != nil {
+		log.WithError(err).Warn("Failed to prune password history")
+	}
+}
+
+// validateAttributes checks attributes against the schema, including
+// uniqueness across other users
+func (s *UserService) validateAttributes(ctx context.Context, attrs models.Attributes, userID uint) error {
+	violations := s.AttributeSchema.Validate(attrs)
+
+	if len(violations) == 0 {
+		for _, def := range s.AttributeSchema.Attributes {
+			value, ok := attrs[def.Name]
+			if !def.Unique || !ok {
+				continue
+			}
+
+			exists, err := s.UserRepo.ExistsWithAttribute(ctx, def.Name, value, userID)
+			if err != nil {
+				return err
+			}
+			if exists {
+				violations = append(violations, fmt.Sprintf("attribute %q is already in use", def.Name))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Message: "invalid attributes", Violations: violations}
+	}
+	return nil
+}
+
 // validateRegistration validates registration input
 func (s *UserService) validateRegistration(name, email, password string) error {
 	if name == "" {
@@ -193,17 +869,13 @@ func (s *UserService) validateRegistration(name, email, password string) error {
 		return errors.New("email is required")
 	}
 
-	if !strings.Contains(email, "@") {
-		return errors.New("invalid email format")
+	if _, err := utils.NormalizeEmail(email, s.Config.Email.FoldLocalPart); err != nil {
+		return err
 	}
 
 	if password == "" {
 		return errors.New("password is required")
 	}
 
-	if len(password) < 6 {
-		return errors.New("password must be at least 6 characters")
-	}
-
-	return nil
+	return s.PasswordPolicy.Validate(password, name, email)
 }
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// ErrInvalidStatusTransition is returned when a status change is not allowed
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+// UserStatusService handles account status changes
+type UserStatusService struct {
+	UserRepo   repositories.UserRepository
+	StatusRepo repositories.UserStatusRepository
+	Logger     *utils.Logger
+}
+
+// NewUserStatusService creates a new user status service
+func NewUserStatusService(userRepo repositories.UserRepository, statusRepo repositories.UserStatusRepository, logger *utils.Logger) *UserStatusService {
+	return &UserStatusService{
+		UserRepo:   userRepo,
+		StatusRepo: statusRepo,
+		Logger:     logger,
+	}
+}
+
+// ChangeStatus moves a user to a new status, recording the reason and actor.
+// until sets an automatic reactivation time for suspended or locked accounts.
+func (s *UserStatusService) ChangeStatus(ctx context.Context, actor *models.User, targetPublicID, status, reason string, until *time.Time) (*models.User, error) {
+	log := s.Logger.WithContext(ctx)
+
+	user, err := s.UserRepo.FindByPublicID(ctx, targetPublicID)
+	if err != nil {
+		log.WithError(err).WithField("public_id", targetPublicID).Warn("Failed to find user for status change")
+		return nil, err
+	}
+
+	if actor != nil && actor.ID == user.ID {
+		log.WithField("user_id", user.ID).Warn("Admin attempted to change own status")
+		return nil, errors.New("cannot change your own account status")
+	}
+
+	if until != nil {
+		if status != models.StatusSuspended && status != models.StatusLocked {
+			return nil, errors.New("automatic reactivation is only supported for suspended or locked accounts")
+		}
+		if !until.After(time.Now()) {
+			return nil, errors.New("reactivation time must be in the future")
+		}
+	}
+
+	// A lapsed suspension is treated as active even if the sweeper has not run yet
+	from := user.EffectiveStatus(time.Now())
+	if !models.CanTransition(from, status) {
+		log.WithField("user_id", user.ID).WithField("from", from).WithField("to", status).Warn("Invalid status transition")
+		return nil, fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, from, status)
+	}
+
+	transition := &models.UserStatusTransition{
+		FromStatus: from,
+		ToStatus:   status,
+		Reason:     reason,
+		Until:      until,
+	}
+	if actor != nil {
+		transition.ActorID = actor.PublicID
+	}
+
+	if err := s.StatusRepo.ApplyTransition(ctx, user, transition); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to change user status")
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).WithField("status", status).Info("User status changed successfully")
+	return user, nil
+}
+
+// Suspend suspends a user, optionally until a reactivation time
+func (s *UserStatusService) Suspend(ctx context.Context, actor *models.User, targetPublicID, reason string, until *time.Time) (*models.User, error) {
+	return s.ChangeStatus(ctx, actor, targetPublicID, models.StatusSuspended, reason, until)
+}
+
+// Reactivate makes a user active again
+func (s *UserStatusService) Reactivate(ctx context.Context, actor *models.User, targetPublicID, reason string) (*models.User, error) {
+	return s.ChangeStatus(ctx, actor, targetPublicID, models.StatusActive, reason, nil)
+}
+
+// History returns a user's status transitions, newest first
+func (s *UserStatusService) History(ctx context.Context, targetPublicID string) ([]models.UserStatusTransition, error) {
+	log := s.Logger.WithContext(ctx)
+
+	user, err := s.UserRepo.FindByPublicID(ctx, targetPublicID)
+	if err != nil {
+		log.WithError(err).WithField("public_id", targetPublicID).Warn("Failed to find user for status history")
+		return nil, err
+	}
+
+	return s.StatusRepo.ListTransitions(ctx, user.ID)
+}
+
+// ReactivateDue reactivates every user whose suspension or lock has lapsed
+func (s *UserStatusService) ReactivateDue(ctx context.Context) (int, error) {
+	log := s.Logger.WithContext(ctx)
+
+	users, err := s.StatusRepo.FindDueReactivations(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	reactivated := 0
+	for i := range users {
+		user := &users[i]
+		transition := &models.UserStatusTransition{
+			FromStatus: user.Status,
+			ToStatus:   models.StatusActive,
+			Reason:     "automatic reactivation",
+		}
+		if err := s.StatusRepo.ApplyTransition(ctx, user, transition); err != nil {
+			log.WithError(err).WithField("user_id", user.ID).Warn("Failed to reactivate user")
+			continue
+		}
+		reactivated++
+	}
+
+	if reactivated > 0 {
+		log.WithField("count", reactivated).Info("Lapsed suspensions reactivated")
+	}
+	return reactivated, nil
+}
+
+// RunReactivationSweeper calls ReactivateDue every interval until ctx is cancelled
+func (s *UserStatusService) RunReactivationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ReactivateDue(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("Reactivation sweep failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/utils"
+)
+
+// webAuthnTimeout is how long a ceremony can take
+const webAuthnTimeout = 5 * time.Minute
+
+// webAuthnMaxCredentialIDLength is the longest credential ID WebAuthn allows
+const webAuthnMaxCredentialIDLength = 1023
+
+// webAuthnDefaultName names credentials registered without a name
+const webAuthnDefaultName = "Passkey"
+
+// webAuthnAlgorithms lists the credential algorithms accepted, in order of preference
+var webAuthnAlgorithms = []int64{utils.COSEAlgES256, utils.COSEAlgEdDSA, utils.COSEAlgRS256}
+
+// ErrWebAuthnVerification is wrapped by the errors of responses that fail verification
+var ErrWebAuthnVerification = errors.New("WebAuthn verification failed")
+
+// ErrWebAuthnCredentialExists is returned when registering a credential that is already registered
+var ErrWebAuthnCredentialExists = errors.New("credential is already registered")
+
+// WebAuthnCeremony is a challenge for the client to pass to
+// navigator.credentials.create or get. The response is sent back with the ceremony ID.
+type WebAuthnCeremony struct {
+	CeremonyID string      `json:"ceremony_id"`
+	PublicKey  interface{} `json:"publicKey"` // *WebAuthnCreationOptions or *WebAuthnRequestOptions
+}
+
+// WebAuthnCreationOptions are the PublicKeyCredentialCreationOptions of a registration
+type WebAuthnCreationOptions struct {
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	Challenge              utils.Base64URL                `json:"challenge"`
+	PubKeyCredParams       []WebAuthnCredentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions are the PublicKeyCredentialRequestOptions of a sign-in
+type WebAuthnRequestOptions struct {
+	Challenge        utils.Base64URL                `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnRelyingParty describes this service to authenticators
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity describes the user a credential is created for
+type WebAuthnUserEntity struct {
+	ID          utils.Base64URL `json:"id"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"displayName"`
+}
+
+// WebAuthnCredentialParam is an accepted credential algorithm
+type WebAuthnCredentialParam struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// WebAuthnCredentialDescriptor identifies a registered credential
+type WebAuthnCredentialDescriptor struct {
+	Type       string          `json:"type"`
+	ID         utils.Base64URL `json:"id"`
+	Transports []string        `json:"transports,omitempty"`
+}
+
+// WebAuthnAuthenticatorSelection states the authenticator features a registration asks for
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnRegistration is the credential a client returns from a registration
+type WebAuthnRegistration struct {
+	ID       string                      `json:"id"`
+	RawID    utils.Base64URL             `json:"rawId"`
+	Type     string                      `json:"type"`
+	Response WebAuthnAttestationResponse `json:"response"`
+}
+
+// WebAuthnAttestationResponse is the authenticator's response to a registration
+type WebAuthnAttestationResponse struct {
+	ClientDataJSON    utils.Base64URL `json:"clientDataJSON"`
+	AttestationObject utils.Base64URL `json:"attestationObject"`
+	Transports        []string        `json:"transports"`
+}
+
+// WebAuthnAssertion is the credential a client returns from a sign-in
+type WebAuthnAssertion struct {
+	ID       string                    `json:"id"`
+	RawID    utils.Base64URL           `json:"rawId"`
+	Type     string                    `json:"type"`
+	Response WebAuthnAssertionResponse `json:"response"`
+}
+
+// WebAuthnAssertionResponse is the authenticator's response to a sign-in
+type WebAuthnAssertionResponse struct {
+	ClientDataJSON    utils.Base64URL `json:"clientDataJSON"`
+	AuthenticatorData utils.Base64URL `json:"authenticatorData"`
+	Signature         utils.Base64URL `json:"signature"`
+	UserHandle        utils.Base64URL `json:"userHandle"`
+}
+
+// WebAuthnService handles passkey registration and sign-in
+type WebAuthnService struct {
+	Repo        repositories.WebAuthnRepository
+	UserRepo    repositories.UserRepository
+	UserService *UserService
+	Config      *config.Config
+	Logger      *utils.Logger
+}
+
+// NewWebAuthnService creates a new WebAuthn service
+func NewWebAuthnService(repo repositories.WebAuthnRepository, userRepo repositories.UserRepository, userService *UserService, config *config.Config, logger *utils.Logger) *WebAuthnService {
+	return &WebAuthnService{
+		Repo:        repo,
+		UserRepo:    userRepo,
+		UserService: userService,
+		Config:      config,
+		Logger:      logger,
+	}
+}
+
+// BeginRegistration starts registering a new credential for a user
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, user *models.User) (*WebAuthnCeremony, error) {
+	credentials, err := s.Repo.ListCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, ceremonyID, err := s.newChallenge(ctx, models.WebAuthnRegistration, user.ID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]WebAuthnCredentialParam, len(webAuthnAlgorithms))
+	for i, alg := range webAuthnAlgorithms {
+		params[i] = WebAuthnCredentialParam{Type: "public-key", Alg: alg}
+	}
+	return &WebAuthnCeremony{
+		CeremonyID: ceremonyID,
+		PublicKey: &WebAuthnCreationOptions{
+			RP: WebAuthnRelyingParty{ID: s.Config.WebAuthn.RPID, Name: s.Config.WebAuthn.RPName},
+			User: WebAuthnUserEntity{
+				ID:          utils.Base64URL(user.PublicID),
+				Name:        user.Email,
+				DisplayName: user.Name,
+			},
+			Challenge:          challenge,
+			PubKeyCredParams:   params,
+			Timeout:            webAuthnTimeout.Milliseconds(),
+			ExcludeCredentials: descriptors(credentials),
+			AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+				ResidentKey:      "preferred",
+				UserVerification: "preferred",
+			},
+			Attestation: "direct",
+		},
+	}, nil
+}
+
+// FinishRegistration verifies a registration response and stores the new credential
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, user *models.User, ceremonyID, name string, registration WebAuthnRegistration) (*models.WebAuthnCredential, error) {
+	log := s.Logger.WithContext(ctx).WithField("user_id", user.ID)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = webAuthnDefaultName
+	}
+	if len(name) > 100 {
+		return nil, &ValidationError{Message: "invalid passkey", Violations: []string{"name must be at most 100 characters"}}
+	}
+
+	challenge, err := s.consumeChallenge(ctx, ceremonyID, models.WebAuthnRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := registration.Response
+	clientDataHash, err := s.verifyClientData(response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+	attestation, err := utils.ParseAttestationObject(response.AttestationObject)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+	authData := attestation.AuthData
+	if err := s.verifyAuthenticatorData(authData, challenge.UserVerificationRequired); err != nil {
+		return nil, err
+	}
+	if len(authData.CredentialID) == 0 || len(authData.CredentialID) > webAuthnMaxCredentialIDLength {
+		return nil, verificationError("invalid credential ID")
+	}
+	if registration.RawID != nil && !bytes.Equal(registration.RawID, authData.CredentialID) {
+		return nil, verificationError("credential ID does not match the authenticator data")
+	}
+
+	key, err := utils.ParseCOSEKey(authData.CredentialPublicKey)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+	attestationType, err := attestation.Verify(clientDataHash, key)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	if _, err := s.Repo.FindCredentialByCredentialID(ctx, credentialID); err == nil {
+		return nil, ErrWebAuthnCredentialExists
+	} else if !errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		return nil, err
+	}
+
+	credential := &models.WebAuthnCredential{
+		PublicID:          models.NewPublicID(),
+		UserID:            user.ID,
+		Name:              name,
+		CredentialID:      credentialID,
+		PublicKey:         authData.CredentialPublicKey,
+		SignCount:         int64(authData.SignCount),
+		AAGUID:            formatAAGUID(authData.AAGUID),
+		Transports:        response.Transports,
+		AttestationFormat: attestation.Format,
+		AttestationType:   attestationType,
+		BackupEligible:    authData.Has(utils.WebAuthnFlagBackupEligible),
+		BackedUp:          authData.Has(utils.WebAuthnFlagBackedUp),
+	}
+	if err := s.Repo.CreateCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	log.WithField("credential_id", credential.PublicID).WithField("attestation", attestation.Format+"/"+attestationType).Info("WebAuthn credential registered")
+	return credential, nil
+}
+
+// BeginLogin starts a passwordless sign-in with a discoverable credential,
+// which tells who is signing in
+func (s *WebAuthnService) BeginLogin(ctx context.Context) (*WebAuthnCeremony, error) {
+	challenge, ceremonyID, err := s.newChallenge(ctx, models.WebAuthnLogin, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCeremony{
+		CeremonyID: ceremonyID,
+		PublicKey: &WebAuthnRequestOptions{
+			Challenge:        challenge,
+			Timeout:          webAuthnTimeout.Milliseconds(),
+			RPID:             s.Config.WebAuthn.RPID,
+			AllowCredentials: []WebAuthnCredentialDescriptor{},
+			UserVerification: "required",
+		},
+	}, nil
+}
+
+// BeginSecondFactor starts the ceremony that completes a user's password
+// login, or returns nil if the user has no credentials
+func (s *WebAuthnService) BeginSecondFactor(ctx context.Context, user *models.User) (*WebAuthnCeremony, error) {
+	return s.beginUserAssertion(ctx, user, models.WebAuthnSecondFactor, false)
+}
+
+// BeginLinkSecondFactor starts the ceremony that completes a user's magic
+// link sign-in, or returns nil if the user has no credentials
+func (s *WebAuthnService) BeginLinkSecondFactor(ctx context.Context, user *models.User) (*WebAuthnCeremony, error) {
+	return s.beginUserAssertion(ctx, user, models.WebAuthnLinkSecondFactor, false)
+}
+
+// BeginStepUp starts the ceremony that completes a signed-in user's password
+// re-authentication, or returns nil if the user has no credentials
+func (s *WebAuthnService) BeginStepUp(ctx context.Context, user *models.User) (*WebAuthnCeremony, error) {
+	return s.beginUserAssertion(ctx, user, models.WebAuthnReauthentication, false)
+}
+
+// BeginReauthentication starts a ceremony in which a signed-in user
+// re-authenticates with a passkey alone, which requires user verification
+func (s *WebAuthnService) BeginReauthentication(ctx context.Context, user *models.User) (*WebAuthnCeremony, error) {
+	ceremony, err := s.beginUserAssertion(ctx, user, models.WebAuthnReauthentication, true)
+	if err == nil && ceremony == nil {
+		return nil, repositories.ErrWebAuthnCredentialNotFound
+	}
+	return ceremony, err
+}
+
+// beginUserAssertion starts a ceremony answered with one of a known user's
+// credentials, or returns nil if the user has none
+func (s *WebAuthnService) beginUserAssertion(ctx context.Context, user *models.User, purpose string, userVerification bool) (*WebAuthnCeremony, error) {
+	credentials, err := s.Repo.ListCredentials(ctx, user.ID)
+	if err != nil || len(credentials) == 0 {
+		return nil, err
+	}
+	challenge, ceremonyID, err := s.newChallenge(ctx, purpose, user.ID, userVerification)
+	if err != nil {
+		return nil, err
+	}
+	verification := "preferred"
+	if userVerification {
+		verification = "required"
+	}
+	return &WebAuthnCeremony{
+		CeremonyID: ceremonyID,
+		PublicKey: &WebAuthnRequestOptions{
+			Challenge:        challenge,
+			Timeout:          webAuthnTimeout.Milliseconds(),
+			RPID:             s.Config.WebAuthn.RPID,
+			AllowCredentials: descriptors(credentials),
+			UserVerification: verification,
+		},
+	}, nil
+}
+
+// FinishLogin verifies a sign-in response and returns a JWT token. A
+// passwordless sign-in starts a session like other non-password logins; a
+// second factor completes the password or magic link sign-in it was started by.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, ceremonyID string, assertion WebAuthnAssertion, client ClientInfo) (string, error) {
+	challenge, err := s.Repo.ConsumeChallenge(ctx, ceremonyID, time.Now())
+	if errors.Is(err, repositories.ErrWebAuthnChallengeNotFound) {
+		return "", verificationError("unknown or expired ceremony")
+	}
+	if err != nil {
+		return "", err
+	}
+	if challenge.Purpose != models.WebAuthnLogin && challenge.Purpose != models.WebAuthnSecondFactor && challenge.Purpose != models.WebAuthnLinkSecondFactor {
+		return "", verificationError("ceremony is not a sign-in")
+	}
+
+	user, err := s.verifyAssertion(ctx, challenge, assertion)
+	if err != nil {
+		return "", err
+	}
+
+	switch challenge.Purpose {
+	case models.WebAuthnSecondFactor:
+		return s.UserService.CompletePasswordLogin(ctx, user, client, utils.NewAuthentication(utils.AMRPassword, utils.AMRHardwareKey, utils.AMRMultiFactor))
+	case models.WebAuthnLinkSecondFactor:
+		return s.UserService.StartSession(ctx, user, client, utils.NewAuthentication(utils.AMROneTimeCode, utils.AMRHardwareKey, utils.AMRMultiFactor))
+	}
+	return s.UserService.StartSession(ctx, user, client, utils.NewAuthentication(utils.AMRHardwareKey, utils.AMRMultiFactor))
+}
+
+// FinishReauthentication verifies a signed-in user's re-authentication
+// response and returns a short-lived token for their session. The ceremony
+// either completes a password re-authentication or, with user verification,
+// stands on its own.
+func (s *WebAuthnService) FinishReauthentication(ctx context.Context, user *models.User, sessionID, ceremonyID string, assertion WebAuthnAssertion) (string, error) {
+	challenge, err := s.consumeChallenge(ctx, ceremonyID, models.WebAuthnReauthentication, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.verifyAssertion(ctx, challenge, assertion); err != nil {
+		return "", err
+	}
+
+	auth := utils.NewAuthentication(utils.AMRPassword, utils.AMRHardwareKey, utils.AMRMultiFactor)
+	if challenge.UserVerificationRequired {
+		auth = utils.NewAuthentication(utils.AMRHardwareKey, utils.AMRMultiFactor)
+	}
+	return s.UserService.IssueStepUpToken(ctx, user, sessionID, auth)
+}
+
+// verifyAssertion verifies a response to a sign-in ceremony, records the
+// credential's use and returns the user it belongs to
+func (s *WebAuthnService) verifyAssertion(ctx context.Context, challenge *models.WebAuthnChallenge, assertion WebAuthnAssertion) (*models.User, error) {
+	log := s.Logger.WithContext(ctx)
+
+	credential, err := s.Repo.FindCredentialByCredentialID(ctx, base64.RawURLEncoding.EncodeToString(assertion.RawID))
+	if errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		return nil, verificationError("unknown credential")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID != 0 && credential.UserID != challenge.UserID {
+		return nil, verificationError("credential belongs to another user")
+	}
+
+	user, err := s.UserRepo.FindByID(ctx, credential.UserID)
+	if err != nil {
+		return nil, verificationError("unknown credential")
+	}
+	// A discoverable credential names its user, which must be the credential's owner
+	userHandle := assertion.Response.UserHandle
+	if (challenge.UserID == 0 || userHandle != nil) && string(userHandle) != user.PublicID {
+		return nil, verificationError("user handle does not match the credential")
+	}
+
+	response := assertion.Response
+	clientDataHash, err := s.verifyClientData(response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := utils.ParseAuthenticatorData(response.AuthenticatorData)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+	if err := s.verifyAuthenticatorData(authData, challenge.UserVerificationRequired); err != nil {
+		return nil, err
+	}
+
+	key, err := utils.ParseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Verify(append(append([]byte(nil), authData.Raw...), clientDataHash...), response.Signature); err != nil {
+		return nil, verificationError("invalid signature")
+	}
+
+	// A counter that does not increase suggests the credential was cloned
+	signCount := int64(authData.SignCount)
+	if (signCount != 0 || credential.SignCount != 0) && signCount <= credential.SignCount {
+		log.WithField("user_id", user.ID).WithField("credential_id", credential.PublicID).Warn("WebAuthn sign count did not increase, credential may be cloned")
+		return nil, verificationError("sign count did not increase")
+	}
+	if err := s.Repo.RecordCredentialUse(ctx, credential.ID, credential.SignCount, signCount, authData.Has(utils.WebAuthnFlagBackedUp), time.Now()); err != nil {
+		if errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+			return nil, verificationError("credential was used concurrently")
+		}
+		return nil, err
+	}
+
+	log.WithField("user_id", user.ID).WithField("purpose", challenge.Purpose).Info("WebAuthn assertion verified")
+	return user, nil
+}
+
+// ListCredentials lists a user's credentials
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	return s.Repo.ListCredentials(ctx, userID)
+}
+
+// RenameCredential changes the name of one of a user's credentials
+func (s *WebAuthnService) RenameCredential(ctx context.Context, userID uint, publicID, name string) (*models.WebAuthnCredential, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, &ValidationError{Message: "invalid passkey", Violations: []string{"name must be 1-100 characters"}}
+	}
+
+	credential, err := s.Repo.FindCredential(ctx, userID, publicID)
+	if err != nil {
+		return nil, err
+	}
+	credential.Name = name
+	if err := s.Repo.UpdateCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// DeleteCredential deletes one of a user's credentials
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID uint, publicID string) error {
+	if err := s.Repo.DeleteCredential(ctx, userID, publicID); err != nil {
+		return err
+	}
+	s.Logger.WithContext(ctx).WithField("user_id", userID).WithField("credential_id", publicID).Info("WebAuthn credential deleted")
+	return nil
+}
+
+// PurgeExpired deletes ceremonies that were never completed
+func (s *WebAuthnService) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.Repo.DeleteExpiredChallenges(ctx, time.Now())
+}
+
+// RunPurger purges uncompleted ceremonies every interval until ctx is cancelled
+func (s *WebAuthnService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(utils.NewRequestContext()); err != nil {
+				s.Logger.WithError(err).Warn("WebAuthn challenge purge failed")
+			}
+		}
+	}
+}
+
+// newChallenge stores a new ceremony and returns its random challenge and ID
+func (s *WebAuthnService) newChallenge(ctx context.Context, purpose string, userID uint, userVerification bool) ([]byte, string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, "", err
+	}
+
+	record := &models.WebAuthnChallenge{
+		PublicID:                 models.NewPublicID(),
+		Purpose:                  purpose,
+		UserID:                   userID,
+		Challenge:                base64.RawURLEncoding.EncodeToString(challenge),
+		UserVerificationRequired: userVerification,
+		ExpiresAt:                time.Now().Add(webAuthnTimeout),
+	}
+	if err := s.Repo.CreateChallenge(ctx, record); err != nil {
+		return nil, "", err
+	}
+	return challenge, record.PublicID, nil
+}
+
+// consumeChallenge consumes a user's ceremony of a purpose
+func (s *WebAuthnService) consumeChallenge(ctx context.Context, ceremonyID, purpose string, userID uint) (*models.WebAuthnChallenge, error) {
+	if _, err := uuid.Parse(ceremonyID); err != nil {
+		return nil, verificationError("unknown or expired ceremony")
+	}
+	challenge, err := s.Repo.ConsumeChallenge(ctx, ceremonyID, time.Now())
+	if errors.Is(err, repositories.ErrWebAuthnChallengeNotFound) {
+		return nil, verificationError("unknown or expired ceremony")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Purpose != purpose || challenge.UserID != userID {
+		return nil, verificationError("ceremony does not belong to this request")
+	}
+	return challenge, nil
+}
+
+// verifyClientData checks the client data of a response to a challenge and returns its hash
+func (s *WebAuthnService) verifyClientData(data []byte, ceremonyType string, challenge *models.WebAuthnChallenge) ([]byte, error) {
+	clientData, err := utils.ParseClientData(data)
+	if err != nil {
+		return nil, verificationError(err.Error())
+	}
+	if clientData.Type != ceremonyType {
+		return nil, verificationError("unexpected client data type " + clientData.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge.Challenge)) != 1 {
+		return nil, verificationError("challenge does not match")
+	}
+	if !s.allowsOrigin(clientData.Origin) {
+		return nil, verificationError("origin " + clientData.Origin + " is not allowed")
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// verifyAuthenticatorData checks the relying party and the user's presence and verification
+func (s *WebAuthnService) verifyAuthenticatorData(authData *utils.AuthenticatorData, userVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(s.Config.WebAuthn.RPID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return verificationError("relying party ID does not match")
+	}
+	if !authData.Has(utils.WebAuthnFlagUserPresent) {
+		return verificationError("user was not present")
+	}
+	if userVerification && !authData.Has(utils.WebAuthnFlagUserVerified) {
+		return verificationError("user was not verified")
+	}
+	return nil
+}
+
+// allowsOrigin reports whether responses may come from an origin
+func (s *WebAuthnService) allowsOrigin(origin string) bool {
+	for _, allowed := range s.Config.WebAuthn.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptors lists credentials for allowCredentials and excludeCredentials
+func descriptors(credentials []models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	list := make([]WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(credential.CredentialID)
+		if err != nil {
+			continue
+		}
+		list = append(list, WebAuthnCredentialDescriptor{Type: "public-key", ID: id, Transports: credential.Transports})
+	}
+	return list
+}
+
+// formatAAGUID formats an authenticator's AAGUID as a UUID
+func formatAAGUID(aaguid []byte) string {
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// verificationError reports why a response failed verification
+func verificationError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrWebAuthnVerification, reason)
+}
@@ -0,0 +1,424 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockIdentityRepo is a mock implementation of the IdentityRepository interface
+type MockIdentityRepo struct {
+	identities   map[uint]*models.Identity
+	linkRequests map[string]*models.FederatedLinkRequest
+	nextID       uint
+}
+
+func NewMockIdentityRepo() *MockIdentityRepo {
+	return &MockIdentityRepo{
+		identities:   make(map[uint]*models.Identity),
+		linkRequests: make(map[string]*models.FederatedLinkRequest),
+		nextID:       1,
+	}
+}
+
+func (m *MockIdentityRepo) Create(ctx context.Context, identity *models.Identity) error {
+	if _, err := m.FindBySubject(ctx, identity.Provider, identity.Subject); err == nil {
+		return errors.New("identity already exists")
+	}
+	identity.ID = m.nextID
+	m.nextID++
+	m.identities[identity.ID] = identity
+	return nil
+}
+
+func (m *MockIdentityRepo) FindBySubject(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, repositories.ErrIdentityNotFound
+}
+
+func (m *MockIdentityRepo) ListByUser(ctx context.Context, userID uint) ([]models.Identity, error) {
+	var identities []models.Identity
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, *identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *MockIdentityRepo) ListByProvider(ctx context.Context, provider string) ([]models.Identity, error) {
+	var identities []models.Identity
+	for id := uint(1); id < m.nextID; id++ {
+		if identity, exists := m.identities[id]; exists && identity.Provider == provider {
+			identities = append(identities, *identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *MockIdentityRepo) Update(ctx context.Context, identity *models.Identity) error {
+	stored := *identity
+	m.identities[identity.ID] = &stored
+	return nil
+}
+
+func (m *MockIdentityRepo) Delete(ctx context.Context, userID uint, publicID string) error {
+	for id, identity := range m.identities {
+		if identity.UserID == userID && identity.PublicID == publicID {
+			delete(m.identities, id)
+			return nil
+		}
+	}
+	return repositories.ErrIdentityNotFound
+}
+
+func (m *MockIdentityRepo) UpdateLastLogin(ctx context.Context, id uint, now time.Time) error {
+	if identity, exists := m.identities[id]; exists {
+		identity.LastLoginAt = &now
+	}
+	return nil
+}
+
+func (m *MockIdentityRepo) CreateLinkRequest(ctx context.Context, request *models.FederatedLinkRequest) error {
+	m.linkRequests[request.TokenHash] = request
+	return nil
+}
+
+func (m *MockIdentityRepo) ConsumeLinkRequest(ctx context.Context, hash string, now time.Time) (*models.FederatedLinkRequest, error) {
+	request, exists := m.linkRequests[hash]
+	if !exists || !now.Before(request.ExpiresAt) {
+		return nil, repositories.ErrLinkRequestNotFound
+	}
+	delete(m.linkRequests, hash)
+	return request, nil
+}
+
+// mockIdP is a minimal OpenID Connect provider. Each code it issues carries
+// the claims of the user who signed in and the nonce and PKCE challenge of
+// the authorization request.
+type mockIdP struct {
+	server *httptest.Server
+	key    *utils.SigningKey
+	mu     sync.Mutex
+	codes  map[string]mockIdPCode
+}
+
+type mockIdPCode struct {
+	subject   string
+	claims    utils.IDTokenClaims
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := utils.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	idp := &mockIdP{key: key, codes: make(map[string]mockIdPCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []utils.JWK{key.JWK()}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "upstream-client" || clientSecret != "upstream-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		idp.mu.Lock()
+		code, exists := idp.codes[r.FormValue("code")]
+		delete(idp.codes, r.FormValue("code"))
+		idp.mu.Unlock()
+		if !exists || utils.PKCEChallenge(r.FormValue("code_verifier")) != code.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		idToken, err := utils.GenerateIDToken(code.claims, idp.server.URL, code.subject, clientID, key, time.Minute)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "upstream", "token_type": "Bearer", "id_token": idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// signIn runs a federated login in which the user signs in at the IdP as subject
+func (idp *mockIdP) signIn(t *testing.T, service *services.FederationService, subject string, claims utils.IDTokenClaims) (*services.FederatedLogin, error) {
+	ctx := context.Background()
+
+	authURL, state, err := service.BeginLogin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("state") != state || query.Get("code_challenge_method") != utils.PKCEMethodS256 {
+		t.Fatalf("Unexpected authorization URL: %s", authURL)
+	}
+
+	code := "code-" + subject + "-" + state
+	claims.Nonce = query.Get("nonce")
+	idp.mu.Lock()
+	idp.codes[code] = mockIdPCode{subject: subject, claims: claims, challenge: query.Get("code_challenge")}
+	idp.mu.Unlock()
+
+	return service.CompleteLogin(ctx, "mock", state, code, services.ClientInfo{UserAgent: "test"})
+}
+
+func newTestFederationService(t *testing.T) (*services.FederationService, *mockIdP, *MockUserRepo, *MockIdentityRepo) {
+	idp := newMockIdP(t)
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.OIDC.Issuer = "https://id.example.com"
+	cfg.WebAuthn.RPID = testRPID
+	cfg.WebAuthn.Origins = []string{testOrigin}
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	identityRepo := NewMockIdentityRepo()
+	userRepo.identities = identityRepo
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	webAuthnService := services.NewWebAuthnService(NewMockWebAuthnRepo(), userRepo, userService, cfg, logger)
+	userService.SecondFactor = webAuthnService
+	provider := services.NewFederationProvider(services.FederationProviderConfig{
+		ID:           "mock",
+		Name:         "Mock IdP",
+		Issuer:       idp.server.URL,
+		ClientID:     "upstream-client",
+		ClientSecret: "upstream-secret",
+	})
+
+	service := services.NewFederationService(identityRepo, userRepo, userService, webAuthnService, []*services.FederationProvider{provider}, cfg, logger)
+	return service, idp, userRepo, identityRepo
+}
+
+func verifiedEmail(email string) utils.IDTokenClaims {
+	verified := true
+	return utils.IDTokenClaims{Name: "Jane Doe", Email: email, EmailVerified: &verified}
+}
+
+func TestFederationService_ProvisionsUserOnFirstLogin(t *testing.T) {
+	service, idp, userRepo, _ := newTestFederationService(t)
+	ctx := context.Background()
+
+	login, err := idp.signIn(t, service, "sub-1", verifiedEmail("jane@example.com"))
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+	if login.Token == "" || !login.Provisioned {
+		t.Fatalf("Expected a provisioned user with a token, got %+v", login)
+	}
+
+	user, err := userRepo.FindByEmail(ctx, "jane@example.com")
+	if err != nil {
+		t.Fatalf("Expected user to be provisioned: %v", err)
+	}
+	if !user.Passwordless || user.Name != "Jane Doe" || user.Status != models.StatusActive {
+		t.Errorf("Unexpected provisioned user: %+v", user)
+	}
+
+	// Signing in again uses the linked identity
+	login, err = idp.signIn(t, service, "sub-1", verifiedEmail("jane@example.com"))
+	if err != nil {
+		t.Fatalf("Expected second login to succeed, got %v", err)
+	}
+	if login.Token == "" || login.Provisioned {
+		t.Errorf("Expected an existing user to be signed in, got %+v", login)
+	}
+
+	identities, _ := service.ListIdentities(ctx, user.ID)
+	if len(identities) != 1 || identities[0].LastLoginAt == nil {
+		t.Fatalf("Expected one identity with a recorded login, got %+v", identities)
+	}
+	if err := service.UnlinkIdentity(ctx, user.ID, identities[0].PublicID); !errors.Is(err, services.ErrLastIdentity) {
+		t.Errorf("Expected ErrLastIdentity, got %v", err)
+	}
+}
+
+func TestFederationService_LinksExistingAccountByEmail(t *testing.T) {
+	service, idp, userRepo, _ := newTestFederationService(t)
+	ctx := context.Background()
+
+	user := &models.User{PublicID: models.NewPublicID(), Name: "Jane", Email: "jane@example.com", Status: models.StatusActive}
+	if err := user.SetPassword("correct-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := userRepo.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	login, err := idp.signIn(t, service, "sub-2", verifiedEmail("jane@example.com"))
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+	if login.Token != "" || login.LinkToken == "" {
+		t.Fatalf("Expected a link request instead of a session, got %+v", login)
+	}
+
+	// A wrong password uses up the link request
+	if _, err := service.ConfirmLinkWithPassword(ctx, login.LinkToken, "wrong-password", services.ClientInfo{}); !errors.Is(err, services.ErrInvalidLinkRequest) {
+		t.Fatalf("Expected ErrInvalidLinkRequest, got %v", err)
+	}
+	if _, err := service.ConfirmLinkWithPassword(ctx, login.LinkToken, "correct-password", services.ClientInfo{}); !errors.Is(err, services.ErrInvalidLinkRequest) {
+		t.Fatalf("Expected a used link request to be rejected, got %v", err)
+	}
+
+	login, err = idp.signIn(t, service, "sub-2", verifiedEmail("jane@example.com"))
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+	token, err := service.ConfirmLinkWithPassword(ctx, login.LinkToken, "correct-password", services.ClientInfo{})
+	if err != nil || token == "" {
+		t.Fatalf("Expected link to be confirmed, got %v", err)
+	}
+
+	login, err = idp.signIn(t, service, "sub-2", verifiedEmail("jane@example.com"))
+	if err != nil || login.Token == "" {
+		t.Fatalf("Expected linked identity to sign in, got %+v, %v", login, err)
+	}
+
+	identities, _ := service.ListIdentities(ctx, user.ID)
+	if len(identities) != 1 {
+		t.Fatalf("Expected one linked identity, got %d", len(identities))
+	}
+	if err := service.UnlinkIdentity(ctx, user.ID, identities[0].PublicID); err != nil {
+		t.Errorf("Expected a user with a password to unlink their identity, got %v", err)
+	}
+}
+
+func TestFederationService_LinkRequiresSecondFactor(t *testing.T) {
+	service, idp, userRepo, _ := newTestFederationService(t)
+	ctx := context.Background()
+
+	user, err := service.UserService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, service.WebAuthnService, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	// The password alone neither signs the user in nor links the identity
+	login, _ := idp.signIn(t, service, "sub-5", verifiedEmail("jane@example.com"))
+	_, err = service.ConfirmLinkWithPassword(ctx, login.LinkToken, "password123", services.ClientInfo{})
+	var secondFactorErr *services.SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+	if identities, _ := service.ListIdentities(ctx, user.ID); len(identities) != 0 {
+		t.Fatalf("Expected no identity before the passkey, got %+v", identities)
+	}
+
+	// Another ceremony of the user does not complete the link
+	other, _ := service.WebAuthnService.BeginSecondFactor(ctx, user)
+	if _, err := service.ConfirmLinkWithPasskey(ctx, login.LinkToken, other.CeremonyID, authenticator.assert(t, other), services.ClientInfo{}); !errors.Is(err, services.ErrInvalidLinkRequest) {
+		t.Fatalf("Expected another ceremony to be rejected, got %v", err)
+	}
+
+	login, _ = idp.signIn(t, service, "sub-5", verifiedEmail("jane@example.com"))
+	_, err = service.ConfirmLinkWithPassword(ctx, login.LinkToken, "password123", services.ClientInfo{})
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected a second factor to be required, got %v", err)
+	}
+	challenge := secondFactorErr.Challenge
+	token, err := service.ConfirmLinkWithPasskey(ctx, login.LinkToken, challenge.CeremonyID, authenticator.assert(t, challenge), services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected the passkey to confirm the link, got %v", err)
+	}
+	claims, _ := utils.ValidateToken(token, "test-secret")
+	if claims == nil || !claims.Authentication().UsedAny(utils.AMRHardwareKey) {
+		t.Errorf("Expected a passkey session, got %+v", claims)
+	}
+	if identities, _ := service.ListIdentities(ctx, user.ID); len(identities) != 1 {
+		t.Errorf("Expected the identity to be linked, got %+v", identities)
+	}
+
+	// Expired passwords get a password-change token and no link
+	expired, _ := service.UserService.RegisterUser(ctx, "John Doe", "john@example.com", "password123", nil)
+	changedAt := time.Now().AddDate(0, 0, -100)
+	expired.PasswordChangedAt = &changedAt
+	userRepo.Update(ctx, expired)
+	service.Config.PasswordPolicy.MaxAgeDays = 90
+	login, _ = idp.signIn(t, service, "sub-6", verifiedEmail("john@example.com"))
+	if token, err := service.ConfirmLinkWithPassword(ctx, login.LinkToken, "password123", services.ClientInfo{}); !errors.Is(err, services.ErrPasswordExpired) || token == "" {
+		t.Fatalf("Expected ErrPasswordExpired with a change token, got %v", err)
+	}
+	if identities, _ := service.ListIdentities(ctx, expired.ID); len(identities) != 0 {
+		t.Errorf("Expected no identity for an expired password, got %+v", identities)
+	}
+}
+
+func TestFederationService_RejectsUnverifiedEmail(t *testing.T) {
+	service, idp, userRepo, _ := newTestFederationService(t)
+
+	_, err := idp.signIn(t, service, "sub-3", utils.IDTokenClaims{Email: "eve@example.com"})
+	if !errors.Is(err, services.ErrEmailNotVerified) {
+		t.Fatalf("Expected ErrEmailNotVerified, got %v", err)
+	}
+	if _, err := userRepo.FindByEmail(context.Background(), "eve@example.com"); !errors.Is(err, repositories.ErrUserNotFound) {
+		t.Errorf("Expected no user to be provisioned, got %v", err)
+	}
+}
+
+func TestFederationService_RejectsTamperedLogin(t *testing.T) {
+	service, idp, _, _ := newTestFederationService(t)
+	ctx := context.Background()
+
+	// A code issued for one login cannot complete another, whose PKCE verifier and nonce differ
+	authURL, _, err := service.BeginLogin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	idp.codes["stolen"] = mockIdPCode{subject: "sub-4", claims: verifiedEmail("mallory@example.com"), challenge: parsed.Query().Get("code_challenge")}
+
+	_, otherState, err := service.BeginLogin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	if _, err := service.CompleteLogin(ctx, "mock", otherState, "stolen", services.ClientInfo{}); !errors.Is(err, services.ErrFederatedLoginFailed) {
+		t.Errorf("Expected ErrFederatedLoginFailed, got %v", err)
+	}
+
+	if _, _, err := service.BeginLogin(ctx, "unknown"); !errors.Is(err, services.ErrUnknownProvider) {
+		t.Errorf("Expected ErrUnknownProvider, got %v", err)
+	}
+}
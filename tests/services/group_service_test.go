@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+func newTestGroupService(t *testing.T) (*services.GroupService, *MockGroupRepo, *services.UserService) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.Groups.ClaimLimit = 2
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	groupRepo := NewMockGroupRepo(userRepo)
+	userRepo.groups = groupRepo
+	groupService := services.NewGroupService(groupRepo, userRepo, cfg, logger)
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), groupService, cfg, logger)
+	return groupService, groupRepo, userService
+}
+
+func TestGroupService_Nesting(t *testing.T) {
+	service, repo, _ := newTestGroupService(t)
+	ctx := context.Background()
+	admin := &models.User{Role: models.RoleAdmin}
+
+	engineering, err := service.Create(ctx, "Engineering", "", "")
+	if err != nil {
+		t.Fatalf("Expected the group to be created, got %v", err)
+	}
+	backend, err := service.Create(ctx, "Backend", "API and storage", engineering.PublicID)
+	if err != nil {
+		t.Fatalf("Expected the subgroup to be created, got %v", err)
+	}
+	if backend.ParentPublicID != engineering.PublicID {
+		t.Errorf("Expected the subgroup to name its parent, got %q", backend.ParentPublicID)
+	}
+	storage, _ := service.Create(ctx, "Storage", "", backend.PublicID)
+
+	if _, err := service.Create(ctx, "Backend", "", ""); !errors.Is(err, services.ErrGroupNameTaken) {
+		t.Errorf("Expected names to be unique, got %v", err)
+	}
+
+	// Groups cannot be nested in themselves or their subgroups
+	for _, parent := range []*models.Group{engineering, storage} {
+		parentID := parent.PublicID
+		if _, err := service.Update(ctx, admin, engineering.PublicID, services.GroupUpdate{ParentID: &parentID}); !errors.Is(err, services.ErrGroupCycle) {
+			t.Errorf("Expected nesting in %s to be rejected, got %v", parent.Name, err)
+		}
+	}
+
+	if err := service.Delete(ctx, backend.PublicID); !errors.Is(err, services.ErrGroupHasSubgroups) {
+		t.Errorf("Expected a group with subgroups not to be deleted, got %v", err)
+	}
+	topLevel := ""
+	if _, err := service.Update(ctx, admin, storage.PublicID, services.GroupUpdate{ParentID: &topLevel}); err != nil {
+		t.Fatalf("Expected the subgroup to move to the top level, got %v", err)
+	}
+	if err := service.Delete(ctx, backend.PublicID); err != nil {
+		t.Errorf("Expected the group to be deleted, got %v", err)
+	}
+
+	// Groups pushed over SCIM are only managed by their directory
+	scimGroup := &models.Group{PublicID: models.NewPublicID(), Name: "Directory", Provider: "okta"}
+	repo.Create(ctx, scimGroup)
+	if _, err := service.Create(ctx, "Nested", "", scimGroup.PublicID); !errors.Is(err, services.ErrGroupManagedExternally) {
+		t.Errorf("Expected groups not to be nested in SCIM groups, got %v", err)
+	}
+	if err := service.Delete(ctx, scimGroup.PublicID); !errors.Is(err, services.ErrGroupManagedExternally) {
+		t.Errorf("Expected SCIM groups not to be deleted, got %v", err)
+	}
+}
+
+func TestGroupService_Members(t *testing.T) {
+	service, _, userService := newTestGroupService(t)
+	ctx := context.Background()
+
+	admin := &models.User{Role: models.RoleAdmin}
+	owner, _ := userService.ProvisionUser(ctx, "Owner", "owner@example.com", nil)
+	member, _ := userService.ProvisionUser(ctx, "Member", "member@example.com", nil)
+	other, _ := userService.ProvisionUser(ctx, "Other", "other@example.com", nil)
+
+	group, _ := service.Create(ctx, "Support", "", "")
+	if err := service.SetMember(ctx, admin, group.PublicID, owner.PublicID, models.GroupRoleOwner); err != nil {
+		t.Fatalf("Expected admins to add owners, got %v", err)
+	}
+
+	// Owners manage members, plain members cannot
+	if err := service.SetMember(ctx, owner, group.PublicID, member.PublicID, ""); err != nil {
+		t.Fatalf("Expected owners to add members, got %v", err)
+	}
+	if err := service.SetMember(ctx, member, group.PublicID, other.PublicID, ""); !errors.Is(err, services.ErrGroupForbidden) {
+		t.Errorf("Expected members not to add members, got %v", err)
+	}
+	name := "Customer Support"
+	if _, err := service.Update(ctx, member, group.PublicID, services.GroupUpdate{Name: &name}); !errors.Is(err, services.ErrGroupForbidden) {
+		t.Errorf("Expected members not to rename the group, got %v", err)
+	}
+	if _, err := service.Update(ctx, owner, group.PublicID, services.GroupUpdate{Name: &name}); err != nil {
+		t.Errorf("Expected owners to rename the group, got %v", err)
+	}
+
+	var validationErr *services.ValidationError
+	if err := service.SetMember(ctx, owner, group.PublicID, other.PublicID, "admin"); !errors.As(err, &validationErr) {
+		t.Errorf("Expected unknown roles to be rejected, got %v", err)
+	}
+
+	members, _ := service.ListMembers(ctx, group.PublicID)
+	if len(members) != 2 || members[0].Role != models.GroupRoleOwner || members[1].Role != models.GroupRoleMember {
+		t.Errorf("Expected an owner and a member, got %+v", members)
+	}
+
+	if err := service.RemoveMember(ctx, owner, group.PublicID, other.PublicID); !errors.Is(err, repositories.ErrGroupMemberNotFound) {
+		t.Errorf("Expected removing a non-member to fail, got %v", err)
+	}
+	if err := service.RemoveMember(ctx, owner, group.PublicID, member.PublicID); err != nil {
+		t.Errorf("Expected owners to remove members, got %v", err)
+	}
+}
+
+func TestGroupService_ClaimsAndFilter(t *testing.T) {
+	service, _, userService := newTestGroupService(t)
+	ctx := context.Background()
+	admin := &models.User{Role: models.RoleAdmin}
+
+	user, _ := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	userService.RegisterUser(ctx, "John Doe", "john@example.com", "password123", nil)
+
+	engineering, _ := service.Create(ctx, "Engineering", "", "")
+	backend, _ := service.Create(ctx, "Backend", "", engineering.PublicID)
+	service.SetMember(ctx, admin, backend.PublicID, user.PublicID, "")
+
+	// Members of a subgroup are members of the groups it is nested in
+	token, err := userService.Login(ctx, "jane@example.com", "password123", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected login to succeed, got %v", err)
+	}
+	claims, _ := utils.ValidateToken(token, "test-secret")
+	if len(claims.Groups) != 2 || claims.Groups[0] != engineering.PublicID || claims.Groups[1] != backend.PublicID || claims.GroupsOverflow {
+		t.Errorf("Expected both groups in the token, got %v", claims.Groups)
+	}
+
+	users, total, _ := userService.ListUsers(ctx, repositories.UserFilter{Group: engineering.PublicID}, 1, 10)
+	if total != 1 || users[0].ID != user.ID {
+		t.Errorf("Expected the subgroup's member to be listed, got %+v", users)
+	}
+
+	// Tokens only flag groups beyond the limit
+	support, _ := service.Create(ctx, "Support", "", "")
+	service.SetMember(ctx, admin, support.PublicID, user.PublicID, "")
+	token, _ = userService.Login(ctx, "jane@example.com", "password123", services.ClientInfo{})
+	claims, _ = utils.ValidateToken(token, "test-secret")
+	if len(claims.Groups) != 0 || !claims.GroupsOverflow {
+		t.Errorf("Expected the groups to overflow, got %v", claims.Groups)
+	}
+
+	groups, _ := service.UserGroups(ctx, user)
+	if len(groups) != 3 || groups[1].ParentPublicID != engineering.PublicID {
+		t.Errorf("Expected every group of the user, got %+v", groups)
+	}
+}
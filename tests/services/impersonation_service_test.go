@@ -0,0 +1,195 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockImpersonationRepo is a mock implementation of the ImpersonationRepository interface
+type MockImpersonationRepo struct {
+	impersonations map[uint]*models.Impersonation
+	events         []models.ImpersonationEvent
+	nextID         uint
+}
+
+func NewMockImpersonationRepo() *MockImpersonationRepo {
+	return &MockImpersonationRepo{
+		impersonations: make(map[uint]*models.Impersonation),
+		nextID:         1,
+	}
+}
+
+func (m *MockImpersonationRepo) Create(ctx context.Context, impersonation *models.Impersonation) error {
+	impersonation.ID = m.nextID
+	m.nextID++
+	impersonation.CreatedAt = time.Now()
+	m.impersonations[impersonation.ID] = impersonation
+	return nil
+}
+
+func (m *MockImpersonationRepo) FindByPublicID(ctx context.Context, publicID string) (*models.Impersonation, error) {
+	for _, impersonation := range m.impersonations {
+		if impersonation.PublicID == publicID {
+			found := *impersonation
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrImpersonationNotFound
+}
+
+func (m *MockImpersonationRepo) ListByUser(ctx context.Context, userID uint) ([]models.Impersonation, error) {
+	var impersonations []models.Impersonation
+	for id := m.nextID - 1; id > 0; id-- {
+		if impersonation, ok := m.impersonations[id]; ok && impersonation.UserID == userID {
+			impersonations = append(impersonations, *impersonation)
+		}
+	}
+	return impersonations, nil
+}
+
+func (m *MockImpersonationRepo) End(ctx context.Context, id uint, now time.Time) error {
+	impersonation, ok := m.impersonations[id]
+	if !ok || impersonation.EndedAt != nil {
+		return repositories.ErrImpersonationNotFound
+	}
+	impersonation.EndedAt = &now
+	return nil
+}
+
+func (m *MockImpersonationRepo) CreateEvent(ctx context.Context, event *models.ImpersonationEvent) error {
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *MockImpersonationRepo) ListEvents(ctx context.Context, impersonationID uint) ([]models.ImpersonationEvent, error) {
+	var events []models.ImpersonationEvent
+	for _, event := range m.events {
+		if event.ImpersonationID == impersonationID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func newTestImpersonationService(t *testing.T) (*services.ImpersonationService, *MockImpersonationRepo, *services.UserService) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.Impersonation.TTL = 15
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	repo := NewMockImpersonationRepo()
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	return services.NewImpersonationService(repo, userRepo, cfg, logger), repo, userService
+}
+
+func TestImpersonationService_Start(t *testing.T) {
+	service, _, userService := newTestImpersonationService(t)
+	ctx := context.Background()
+
+	admin, _ := userService.ProvisionUser(ctx, "Admin", "admin@example.com", nil)
+	admin.Role = models.RoleAdmin
+	otherAdmin, _ := userService.ProvisionUser(ctx, "Other Admin", "other-admin@example.com", nil)
+	otherAdmin.Role = models.RoleAdmin
+	user, _ := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+
+	var validationErr *services.ValidationError
+	if _, _, err := service.Start(ctx, admin, user.PublicID, " "); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a ValidationError without a reason, got %v", err)
+	}
+	if _, _, err := service.Start(ctx, admin, otherAdmin.PublicID, "debugging"); !errors.Is(err, services.ErrImpersonationNotAllowed) {
+		t.Errorf("Expected admins not to be impersonated, got %v", err)
+	}
+	if _, _, err := service.Start(ctx, admin, admin.PublicID, "debugging"); !errors.Is(err, services.ErrImpersonationNotAllowed) {
+		t.Errorf("Expected admins not to impersonate themselves, got %v", err)
+	}
+
+	token, impersonation, err := service.Start(ctx, admin, user.PublicID, "Ticket 1234: profile does not load")
+	if err != nil {
+		t.Fatalf("Expected impersonation to start, got %v", err)
+	}
+	if impersonation.ActorID != admin.PublicID || impersonation.UserID != user.ID {
+		t.Errorf("Unexpected impersonation %+v", impersonation)
+	}
+
+	claims, err := utils.ValidateToken(token, "test-secret")
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if claims.Subject != user.PublicID || !claims.IsImpersonation() || claims.Act.Subject != admin.PublicID || claims.ID != impersonation.PublicID {
+		t.Errorf("Expected a token acting as the user, got %+v", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != 15*time.Minute {
+		t.Errorf("Expected a 15 minute token, got %v", ttl)
+	}
+	if !claims.Authentication().Time.IsZero() {
+		t.Error("Expected the token not to record an authentication of the user")
+	}
+}
+
+func TestImpersonationService_Authenticate(t *testing.T) {
+	service, repo, userService := newTestImpersonationService(t)
+	ctx := context.Background()
+
+	admin, _ := userService.ProvisionUser(ctx, "Admin", "admin@example.com", nil)
+	admin.Role = models.RoleAdmin
+	user, _ := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	other, _ := userService.ProvisionUser(ctx, "John Doe", "john@example.com", nil)
+
+	token, _, err := service.Start(ctx, admin, user.PublicID, "debugging")
+	if err != nil {
+		t.Fatalf("Expected impersonation to start, got %v", err)
+	}
+	claims, _ := utils.ValidateToken(token, "test-secret")
+
+	impersonation, err := service.Authenticate(ctx, claims, user)
+	if err != nil {
+		t.Fatalf("Expected an active impersonation, got %v", err)
+	}
+	if _, err := service.Authenticate(ctx, claims, other); !errors.Is(err, services.ErrImpersonationInactive) {
+		t.Errorf("Expected the token to only act as its user, got %v", err)
+	}
+
+	// Every request is recorded with the admin who made it
+	service.RecordEvent(ctx, impersonation, &models.ImpersonationEvent{Method: "GET", Path: "/api/users/profile", Status: 200})
+	events, _ := service.ListEvents(ctx, impersonation.PublicID)
+	if len(events) != 1 || events[0].ActorID != admin.PublicID || events[0].UserID != user.ID {
+		t.Errorf("Expected the request to be recorded with its actor, got %+v", events)
+	}
+
+	// Admins who lose their role can no longer act as users
+	admin.Role = models.RoleUser
+	if _, err := service.Authenticate(ctx, claims, user); !errors.Is(err, services.ErrImpersonationInactive) {
+		t.Errorf("Expected the impersonation to stop with the admin role, got %v", err)
+	}
+	admin.Role = models.RoleAdmin
+
+	if err := service.End(ctx, impersonation); err != nil {
+		t.Fatalf("Expected the impersonation to end, got %v", err)
+	}
+	if _, err := service.Authenticate(ctx, claims, user); !errors.Is(err, services.ErrImpersonationInactive) {
+		t.Errorf("Expected an ended impersonation to be inactive, got %v", err)
+	}
+
+	// Impersonations expire on their own
+	token, expiring, _ := service.Start(ctx, admin, user.PublicID, "debugging")
+	claims, _ = utils.ValidateToken(token, "test-secret")
+	repo.impersonations[expiring.ID].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := service.Authenticate(ctx, claims, user); !errors.Is(err, services.ErrImpersonationInactive) {
+		t.Errorf("Expected an expired impersonation to be inactive, got %v", err)
+	}
+
+	impersonations, _ := service.ListForUser(ctx, user.PublicID)
+	if len(impersonations) != 2 || impersonations[0].PublicID != expiring.PublicID || impersonations[1].EndedAt == nil {
+		t.Errorf("Expected both impersonations, newest first, got %+v", impersonations)
+	}
+}
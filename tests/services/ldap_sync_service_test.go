@@ -0,0 +1,529 @@
+package services_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+const (
+	testLDAPBindDN   = "cn=sync,dc=corp,dc=example"
+	testLDAPPassword = "sync-secret"
+	testLDAPBaseDN   = "ou=people,dc=corp,dc=example"
+)
+
+// testLDAPServer is a minimal in-process LDAP server. It supports simple
+// binds and subtree searches with the paged results control, evaluating
+// and, or, not, equality, presence and substring filters.
+type testLDAPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	entries  []*utils.LDAPEntry
+	searches int
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &testLDAPServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// setEntries replaces the directory's entries
+func (s *testLDAPServer) setEntries(entries ...*utils.LDAPEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+}
+
+// testLDAPPerson builds an entry under the base DN
+func testLDAPPerson(uid, cn, mail string, extra ...string) *utils.LDAPEntry {
+	entry := &utils.LDAPEntry{
+		DN: "uid=" + uid + "," + testLDAPBaseDN,
+		Attributes: map[string][][]byte{
+			"objectClass": {[]byte("person")},
+			"entryUUID":   {[]byte("uuid-" + uid)},
+			"uid":         {[]byte(uid)},
+			"cn":          {[]byte(cn)},
+		},
+	}
+	if mail != "" {
+		entry.Attributes["mail"] = [][]byte{[]byte(mail)}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		entry.Attributes[extra[i]] = append(entry.Attributes[extra[i]], []byte(extra[i+1]))
+	}
+	return entry
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	bound := false
+
+	for {
+		message, err := utils.ReadBERElement(reader)
+		if err != nil {
+			return
+		}
+		id, _ := message.Child(0).Int()
+		operation := message.Child(1)
+
+		var responses []*utils.BERElement
+		switch operation.Tag {
+		case utils.LDAPBindRequest:
+			code := int64(49)
+			if operation.Child(1).String() == testLDAPBindDN && operation.Child(2).String() == testLDAPPassword {
+				code, bound = 0, true
+			}
+			responses = append(responses, testLDAPMessage(id, testLDAPResult(utils.LDAPBindResponse, code)))
+		case utils.LDAPUnbindRequest:
+			return
+		case utils.LDAPSearchRequest:
+			if !bound {
+				responses = append(responses, testLDAPMessage(id, testLDAPResult(utils.LDAPSearchResultDone, 50)))
+				break
+			}
+			responses = s.search(id, operation, message.Child(2))
+		default:
+			return
+		}
+
+		for _, response := range responses {
+			if _, err := conn.Write(response.Encode()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// search answers one page of a search
+func (s *testLDAPServer) search(id int64, request, controls *utils.BERElement) []*utils.BERElement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches++
+
+	baseDN, filter := strings.ToLower(request.Child(0).String()), request.Child(6)
+	var requested []string
+	for _, attribute := range request.Child(7).Children {
+		requested = append(requested, attribute.String())
+	}
+
+	pageSize, offset := len(s.entries), 0
+	for _, control := range controls.Children {
+		if control.Child(0).String() != utils.LDAPPagedResultsOID {
+			continue
+		}
+		value, _ := utils.DecodeBER(control.Child(2).Value)
+		size, _ := value.Child(0).Int()
+		pageSize = int(size)
+		offset, _ = strconv.Atoi(value.Child(1).String())
+	}
+
+	var matches []*utils.LDAPEntry
+	for _, entry := range s.entries {
+		if strings.HasSuffix(strings.ToLower(entry.DN), baseDN) && testLDAPMatch(filter, entry) {
+			matches = append(matches, entry)
+		}
+	}
+
+	var responses []*utils.BERElement
+	end := min(offset+pageSize, len(matches))
+	for _, entry := range matches[offset:end] {
+		attributes := utils.NewBERConstructed(utils.BERTagSequence)
+		for _, name := range requested {
+			values := utils.NewBERConstructed(utils.BERTagSet)
+			for _, value := range entry.Values(name) {
+				values.Append(utils.NewBERPrimitive(utils.BERTagOctetString, value))
+			}
+			if len(values.Children) > 0 {
+				attributes.Append(utils.NewBERConstructed(utils.BERTagSequence, utils.NewBERString(utils.BERTagOctetString, name), values))
+			}
+		}
+		responses = append(responses, testLDAPMessage(id, utils.NewBERConstructed(utils.LDAPSearchResultEntry,
+			utils.NewBERString(utils.BERTagOctetString, entry.DN), attributes)))
+	}
+
+	cookie := ""
+	if end < len(matches) {
+		cookie = strconv.Itoa(end)
+	}
+	paged := utils.NewBERConstructed(utils.BERTagSequence,
+		utils.NewBERInteger(utils.BERTagInteger, int64(len(matches))),
+		utils.NewBERString(utils.BERTagOctetString, cookie),
+	)
+	done := testLDAPMessage(id, testLDAPResult(utils.LDAPSearchResultDone, 0))
+	done.Append(utils.NewBERConstructed(utils.BERClassContext|0, utils.NewBERConstructed(utils.BERTagSequence,
+		utils.NewBERString(utils.BERTagOctetString, utils.LDAPPagedResultsOID),
+		utils.NewBERPrimitive(utils.BERTagOctetString, paged.Encode()),
+	)))
+	return append(responses, done)
+}
+
+func testLDAPMessage(id int64, operation *utils.BERElement) *utils.BERElement {
+	return utils.NewBERConstructed(utils.BERTagSequence, utils.NewBERInteger(utils.BERTagInteger, id), operation)
+}
+
+func testLDAPResult(tag byte, code int64) *utils.BERElement {
+	return utils.NewBERConstructed(tag,
+		utils.NewBERInteger(utils.BERTagEnumerated, code),
+		utils.NewBERString(utils.BERTagOctetString, ""),
+		utils.NewBERString(utils.BERTagOctetString, ""),
+	)
+}
+
+// testLDAPMatch evaluates an encoded filter against an entry
+func testLDAPMatch(filter *utils.BERElement, entry *utils.LDAPEntry) bool {
+	switch filter.Tag {
+	case utils.LDAPFilterAnd:
+		for _, child := range filter.Children {
+			if !testLDAPMatch(child, entry) {
+				return false
+			}
+		}
+		return true
+	case utils.LDAPFilterOr:
+		for _, child := range filter.Children {
+			if testLDAPMatch(child, entry) {
+				return true
+			}
+		}
+		return false
+	case utils.LDAPFilterNot:
+		return !testLDAPMatch(filter.Child(0), entry)
+	case utils.LDAPFilterPresent:
+		return len(entry.Values(filter.String())) > 0
+	case utils.LDAPFilterEqualityMatch:
+		for _, value := range entry.Values(filter.Child(0).String()) {
+			if bytes.EqualFold(value, filter.Child(1).Value) {
+				return true
+			}
+		}
+		return false
+	case utils.LDAPFilterSubstrings:
+		for _, value := range entry.Values(filter.Child(0).String()) {
+			rest := strings.ToLower(string(value))
+			matched := true
+			for _, part := range filter.Child(1).Children {
+				substring := strings.ToLower(string(part.Value))
+				switch part.Tag {
+				case utils.BERClassContext | 0:
+					matched = matched && strings.HasPrefix(rest, substring)
+					rest = strings.TrimPrefix(rest, substring)
+				case utils.BERClassContext | 1:
+					i := strings.Index(rest, substring)
+					if i < 0 {
+						matched = false
+						break
+					}
+					rest = rest[i+len(substring):]
+				case utils.BERClassContext | 2:
+					matched = matched && strings.HasSuffix(rest, substring)
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func newTestLDAPSyncService(t *testing.T, server *testLDAPServer) (*services.LDAPSyncService, *MockUserRepo) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	directory, err := services.NewLDAPDirectory(services.LDAPDirectoryConfig{
+		ID:               "corp",
+		Name:             "Corp directory",
+		URL:              server.URL(),
+		BindDN:           testLDAPBindDN,
+		BindPassword:     testLDAPPassword,
+		BaseDN:           testLDAPBaseDN,
+		Filter:           "(&(objectClass=person)(!(uid=svc-*)))",
+		PageSize:         2,
+		AttributeMapping: map[string]string{"attributes.department": "departmentNumber"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	userRepo := NewMockUserRepo()
+	identityRepo := NewMockIdentityRepo()
+	userRepo.identities = identityRepo
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	userService.AttributeSchema, _ = services.NewAttributeSchema([]services.AttributeDefinition{{Name: "department", Type: services.AttributeTypeString}})
+	statusService := services.NewUserStatusService(userRepo, &MockUserStatusRepo{users: userRepo}, logger)
+	return services.NewLDAPSyncService(NewMockLDAPSyncRunRepo(), userRepo, identityRepo, userService, statusService, []*services.LDAPDirectory{directory}, cfg, logger), userRepo
+}
+
+// MockLDAPSyncRunRepo is a mock implementation of the LDAPSyncRunRepository interface
+type MockLDAPSyncRunRepo struct {
+	runs   []*models.LDAPSyncRun
+	nextID uint
+}
+
+func NewMockLDAPSyncRunRepo() *MockLDAPSyncRunRepo {
+	return &MockLDAPSyncRunRepo{nextID: 1}
+}
+
+func (m *MockLDAPSyncRunRepo) Create(ctx context.Context, run *models.LDAPSyncRun) error {
+	run.ID = m.nextID
+	m.nextID++
+	stored := *run
+	m.runs = append(m.runs, &stored)
+	return nil
+}
+
+func (m *MockLDAPSyncRunRepo) Update(ctx context.Context, run *models.LDAPSyncRun) error {
+	stored := *run
+	m.runs[run.ID-1] = &stored
+	return nil
+}
+
+func (m *MockLDAPSyncRunRepo) FindByPublicID(ctx context.Context, publicID string) (*models.LDAPSyncRun, error) {
+	for _, run := range m.runs {
+		if run.PublicID == publicID {
+			return run, nil
+		}
+	}
+	return nil, errors.New("LDAP sync run not found")
+}
+
+func (m *MockLDAPSyncRunRepo) List(ctx context.Context, directory string, limit int) ([]models.LDAPSyncRun, error) {
+	var runs []models.LDAPSyncRun
+	for i := len(m.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if directory == "" || m.runs[i].Directory == directory {
+			runs = append(runs, *m.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+func TestLDAPConn_BindAndSearchPaged(t *testing.T) {
+	server := newTestLDAPServer(t)
+	server.setEntries(
+		testLDAPPerson("alice", "Alice Smith", "alice@corp.example"),
+		testLDAPPerson("bob", "Bob Jones", "bob@corp.example"),
+		testLDAPPerson("carol", "Carol White", "carol@corp.example"),
+		testLDAPPerson("svc-backup", "Backup", "backup@corp.example"),
+		testLDAPPerson("dave", "Dave Brown", "dave@other.example"),
+	)
+
+	conn, err := utils.DialLDAP(server.URL(), nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	var ldapErr *utils.LDAPError
+	if err := conn.Bind(testLDAPBindDN, "wrong"); !errors.As(err, &ldapErr) || ldapErr.Code != 49 {
+		t.Fatalf("Expected invalid credentials, got %v", err)
+	}
+	if err := conn.Bind(testLDAPBindDN, testLDAPPassword); err != nil {
+		t.Fatalf("Expected bind to succeed, got %v", err)
+	}
+
+	var names []string
+	search := utils.LDAPSearch{
+		BaseDN:     testLDAPBaseDN,
+		Scope:      utils.LDAPScopeWholeSubtree,
+		Filter:     "(&(objectClass=person)(mail=*@corp.example)(!(uid=svc-*)))",
+		Attributes: []string{"cn", "mail"},
+	}
+	err = conn.SearchPaged(search, 1, func(entry *utils.LDAPEntry) error {
+		if entry.Value("uid") != "" {
+			t.Errorf("Expected only requested attributes, got %v", entry.Attributes)
+		}
+		names = append(names, entry.Value("CN"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected search to succeed, got %v", err)
+	}
+	if strings.Join(names, ",") != "Alice Smith,Bob Jones,Carol White" {
+		t.Errorf("Unexpected entries %v", names)
+	}
+	if server.searches != 3 {
+		t.Errorf("Expected one search request per page, got %d", server.searches)
+	}
+}
+
+func TestLDAPSyncService_Sync(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service, userRepo := newTestLDAPSyncService(t, server)
+	ctx := context.Background()
+
+	// An account the directory does not manage is never taken over
+	userRepo.Create(ctx, &models.User{PublicID: models.NewPublicID(), Name: "Carol", Email: "carol@corp.example", Password: "Password123!", Status: models.StatusActive})
+
+	server.setEntries(
+		testLDAPPerson("alice", "Alice Smith", "alice@corp.example", "departmentNumber", "Engineering"),
+		testLDAPPerson("bob", "Bob Jones", "bob@corp.example"),
+		testLDAPPerson("carol", "Carol White", "carol@corp.example"),
+		testLDAPPerson("erin", "Erin Black", ""),
+		testLDAPPerson("svc-backup", "Backup", "backup@corp.example"),
+	)
+
+	// A dry run reports the changes without making them
+	run, err := service.Sync(ctx, "corp", true, nil)
+	if err != nil || run.Status != models.LDAPSyncSucceeded {
+		t.Fatalf("Expected dry run to succeed, got %+v, %v", run, err)
+	}
+	if run.Entries != 4 || run.Created != 2 || run.Conflicts != 1 || run.Skipped != 1 || run.FinishedAt == nil {
+		t.Errorf("Unexpected dry run counts %+v", run)
+	}
+	if _, err := userRepo.FindByEmail(ctx, "alice@corp.example"); err == nil {
+		t.Error("Expected dry run to create no users")
+	}
+
+	run, err = service.Sync(ctx, "corp", false, nil)
+	if err != nil || run.Status != models.LDAPSyncSucceeded || run.Created != 2 || run.Failed != 0 {
+		t.Fatalf("Expected sync to create two users, got %+v, %v", run, err)
+	}
+	alice, err := userRepo.FindByEmail(ctx, "alice@corp.example")
+	if err != nil || alice.Name != "Alice Smith" || alice.Attributes["department"] != "Engineering" || !alice.Passwordless {
+		t.Fatalf("Unexpected synced user %+v, %v", alice, err)
+	}
+
+	// Unchanged entries make no changes
+	run, _ = service.Sync(ctx, "corp", false, nil)
+	if run.Created != 0 || run.Updated != 0 || run.Deactivated != 0 {
+		t.Errorf("Expected no changes, got %+v", run)
+	}
+
+	// Changed entries update their users, and removed ones are deactivated
+	server.setEntries(
+		testLDAPPerson("bob", "Robert Jones", "bob@corp.example", "departmentNumber", "Sales"),
+		testLDAPPerson("carol", "Carol White", "carol@corp.example"),
+	)
+	run, _ = service.Sync(ctx, "corp", false, nil)
+	if run.Updated != 1 || run.Deactivated != 1 || run.Conflicts != 1 {
+		t.Fatalf("Expected one update and one deactivation, got %+v", run)
+	}
+	bob, _ := userRepo.FindByEmail(ctx, "bob@corp.example")
+	if bob.Name != "Robert Jones" || bob.Attributes["department"] != "Sales" {
+		t.Errorf("Expected bob to be updated, got %+v", bob)
+	}
+	if alice.Status != models.StatusDeactivated {
+		t.Errorf("Expected alice to be deactivated, got %s", alice.Status)
+	}
+	for _, change := range run.Changes {
+		if change.Action == models.LDAPSyncUpdate && (change.Fields["name"].From != "Bob Jones" || change.Fields["attributes.department"].To != "Sales") {
+			t.Errorf("Unexpected update diff %+v", change.Fields)
+		}
+	}
+
+	// Entries that return are reactivated
+	server.setEntries(
+		testLDAPPerson("alice", "Alice Smith", "alice@corp.example"),
+		testLDAPPerson("bob", "Robert Jones", "bob@corp.example", "departmentNumber", "Sales"),
+	)
+	run, _ = service.Sync(ctx, "corp", false, nil)
+	if run.Reactivated != 1 || run.Updated != 1 || alice.Status != models.StatusActive {
+		t.Errorf("Expected alice to be reactivated without her department, got %+v", run)
+	}
+	if _, ok := alice.Attributes["department"]; ok {
+		t.Error("Expected the department the directory no longer has to be removed")
+	}
+
+	// An empty result does not deactivate everyone
+	server.setEntries()
+	run, err = service.Sync(ctx, "corp", false, nil)
+	if err != nil || run.Status != models.LDAPSyncFailed || run.Deactivated != 0 || alice.Status != models.StatusActive {
+		t.Errorf("Expected an empty directory to fail the run, got %+v, %v", run, err)
+	}
+
+	runs, _ := service.ListRuns(ctx, "corp", 0)
+	if len(runs) != 6 || !runs[len(runs)-1].DryRun {
+		t.Errorf("Expected every run to be recorded, got %d", len(runs))
+	}
+}
+
+func TestLDAPSyncService_KeepsManuallyDeactivatedUsers(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service, userRepo := newTestLDAPSyncService(t, server)
+	ctx := context.Background()
+
+	server.setEntries(
+		testLDAPPerson("alice", "Alice Smith", "alice@corp.example"),
+		testLDAPPerson("bob", "Bob Jones", "bob@corp.example"),
+	)
+	if run, err := service.Sync(ctx, "corp", false, nil); err != nil || run.Created != 2 {
+		t.Fatalf("Expected sync to create two users, got %+v, %v", run, err)
+	}
+
+	// A user an admin deactivated is not reactivated while still in the directory
+	admin := &models.User{ID: 1000, PublicID: models.NewPublicID(), Role: models.RoleAdmin}
+	bob, _ := userRepo.FindByEmail(ctx, "bob@corp.example")
+	if _, err := service.StatusService.ChangeStatus(ctx, admin, bob.PublicID, models.StatusDeactivated, "left the company", nil); err != nil {
+		t.Fatalf("Expected the admin to deactivate bob, got %v", err)
+	}
+	run, _ := service.Sync(ctx, "corp", false, nil)
+	if run.Reactivated != 0 || run.Skipped != 1 || bob.Status != models.StatusDeactivated {
+		t.Errorf("Expected bob to stay deactivated, got %+v", run)
+	}
+
+	// Users are only provisioned together with their identity
+	identities, _ := userRepo.identities.ListByUser(ctx, bob.ID)
+	_, err := service.UserService.ProvisionUserWithIdentity(ctx, "Mallory", "mallory@corp.example", nil, &models.Identity{
+		PublicID: models.NewPublicID(),
+		Provider: identities[0].Provider,
+		Subject:  identities[0].Subject,
+	}, models.StatusActive)
+	if err == nil {
+		t.Fatal("Expected a duplicate identity to fail provisioning")
+	}
+	if _, err := userRepo.FindByEmail(ctx, "mallory@corp.example"); !errors.Is(err, repositories.ErrUserNotFound) {
+		t.Errorf("Expected no user without an identity, got %v", err)
+	}
+}
+
+func TestLDAPSyncService_RecordsUnreachableDirectory(t *testing.T) {
+	server := newTestLDAPServer(t)
+	service, _ := newTestLDAPSyncService(t, server)
+	service.Directories[0].BindPassword = "wrong"
+
+	run, err := service.Sync(context.Background(), "corp", false, nil)
+	if err != nil || run.Status != models.LDAPSyncFailed || !strings.Contains(run.Error, "binding to the directory") {
+		t.Errorf("Expected a failed run, got %+v, %v", run, err)
+	}
+
+	if _, err := service.Sync(context.Background(), "unknown", false, nil); !errors.Is(err, services.ErrLDAPDirectoryNotFound) {
+		t.Errorf("Expected unknown directory error, got %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockMagicLinkRepo is a mock implementation of the MagicLinkRepository interface
+type MockMagicLinkRepo struct {
+	mu     sync.Mutex
+	links  map[uint]*models.MagicLink
+	nextID uint
+}
+
+func NewMockMagicLinkRepo() *MockMagicLinkRepo {
+	return &MockMagicLinkRepo{links: make(map[uint]*models.MagicLink), nextID: 1}
+}
+
+func (m *MockMagicLinkRepo) Create(ctx context.Context, link *models.MagicLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link.ID = m.nextID
+	m.nextID++
+	link.CreatedAt = time.Now()
+	m.links[link.ID] = link
+	return nil
+}
+
+func (m *MockMagicLinkRepo) FindByTokenHash(ctx context.Context, hash string) (*models.MagicLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, link := range m.links {
+		if link.TokenHash == hash {
+			found := *link
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrMagicLinkNotFound
+}
+
+func (m *MockMagicLinkRepo) MarkUsed(ctx context.Context, id uint, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	link, ok := m.links[id]
+	if !ok || link.UsedAt != nil {
+		return repositories.ErrMagicLinkNotFound
+	}
+	link.UsedAt = &now
+	return nil
+}
+
+func (m *MockMagicLinkRepo) CountSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, link := range m.links {
+		if link.UserID == userID && link.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockMagicLinkRepo) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for id, link := range m.links {
+		if link.CreatedAt.Before(before) {
+			delete(m.links, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// MockMailer passes sent messages to a channel
+type MockMailer struct {
+	sent chan utils.MailMessage
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg utils.MailMessage) error {
+	m.sent <- msg
+	return nil
+}
+
+var mailedToken = regexp.MustCompile(`token=([a-z]+_[A-Za-z0-9_-]+)`)
+
+// receive waits for a sent link and returns its token
+func (m *MockMailer) receive(t *testing.T, to string) string {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		if msg.To != to {
+			t.Fatalf("Expected a link to %s, got one to %s", to, msg.To)
+		}
+		match := mailedToken.FindStringSubmatch(msg.Body)
+		if match == nil {
+			t.Fatalf("Expected a link in %q", msg.Body)
+		}
+		return match[1]
+	case <-time.After(time.Second):
+		t.Fatal("Expected a link to be sent")
+		return ""
+	}
+}
+
+// expectNone checks that no message is sent
+func (m *MockMailer) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		t.Fatalf("Expected no email, got one to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newTestMagicLinkService(t *testing.T, connections ...*services.SAMLConnection) (*services.MagicLinkService, *MockMagicLinkRepo, *MockMailer, *services.UserService) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.MagicLink.Enabled = true
+	cfg.MagicLink.URL = "https://app.example.com/magic-link?lang=en"
+	cfg.MagicLink.TTL = 15
+	cfg.MagicLink.RateLimit = 3
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	linkRepo := NewMockMagicLinkRepo()
+	mailer := &MockMailer{sent: make(chan utils.MailMessage, 10)}
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+
+	service := services.NewMagicLinkService(linkRepo, userRepo, NewMockIdentityRepo(), userService, mailer, connections, cfg, logger)
+	return service, linkRepo, mailer, userService
+}
+
+func TestMagicLinkService_SignIn(t *testing.T) {
+	service, _, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+
+	if _, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	binding, err := service.Request(ctx, "Jane@Example.com", false)
+	if err != nil || binding != "" {
+		t.Fatalf("Expected an unbound request to succeed, got %q, %v", binding, err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	jwt, err := service.Consume(ctx, token, "", services.ClientInfo{UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("Expected sign-in to succeed, got %v", err)
+	}
+	if _, err := utils.ValidateToken(jwt, "test-secret"); err != nil {
+		t.Errorf("Expected a valid session token, got %v", err)
+	}
+
+	// Links are single-use
+	if _, err := service.Consume(ctx, token, "", services.ClientInfo{}); !errors.Is(err, services.ErrMagicLinkInvalid) {
+		t.Errorf("Expected a used link to be rejected, got %v", err)
+	}
+	if _, err := service.Consume(ctx, "ml_forged", "", services.ClientInfo{}); !errors.Is(err, services.ErrMagicLinkInvalid) {
+		t.Errorf("Expected an unknown link to be rejected, got %v", err)
+	}
+
+	// Unknown emails get the same answer, but no email
+	if _, err := service.Request(ctx, "nobody@example.com", false); err != nil {
+		t.Errorf("Expected unknown email to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+}
+
+func TestMagicLinkService_ExpiredLink(t *testing.T) {
+	service, linkRepo, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+
+	if _, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := service.Request(ctx, "jane@example.com", false); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	for _, link := range linkRepo.links {
+		link.ExpiresAt = time.Now().Add(-time.Second)
+	}
+	if _, err := service.Consume(ctx, token, "", services.ClientInfo{}); !errors.Is(err, services.ErrMagicLinkInvalid) {
+		t.Errorf("Expected an expired link to be rejected, got %v", err)
+	}
+}
+
+func TestMagicLinkService_BrowserBinding(t *testing.T) {
+	service, _, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+
+	if _, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	binding, err := service.Request(ctx, "jane@example.com", true)
+	if err != nil || binding == "" {
+		t.Fatalf("Expected a binding nonce, got %q, %v", binding, err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	// A forwarded link does not burn the link
+	for _, other := range []string{"", "mlb_other"} {
+		if _, err := service.Consume(ctx, token, other, services.ClientInfo{}); !errors.Is(err, services.ErrMagicLinkWrongBrowser) {
+			t.Errorf("Expected ErrMagicLinkWrongBrowser for binding %q, got %v", other, err)
+		}
+	}
+	if _, err := service.Consume(ctx, token, binding, services.ClientInfo{}); err != nil {
+		t.Errorf("Expected the requesting browser to sign in, got %v", err)
+	}
+
+	// Unknown emails are given a nonce too
+	if binding, err := service.Request(ctx, "nobody@example.com", true); err != nil || binding == "" {
+		t.Errorf("Expected a binding nonce for an unknown email, got %q, %v", binding, err)
+	}
+}
+
+func TestMagicLinkService_RateLimit(t *testing.T) {
+	service, linkRepo, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+
+	if _, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := service.Request(ctx, "jane@example.com", false); err != nil {
+			t.Fatalf("Expected request %d to succeed, got %v", i, err)
+		}
+		mailer.receive(t, "jane@example.com")
+	}
+
+	if _, err := service.Request(ctx, "jane@example.com", false); err != nil {
+		t.Fatalf("Expected a rate limited request to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+
+	// Links stop counting once the window has passed
+	for _, link := range linkRepo.links {
+		link.CreatedAt = time.Now().Add(-2 * time.Hour)
+	}
+	if purged, err := service.PurgeExpired(ctx); err != nil || purged != 3 {
+		t.Fatalf("Expected 3 links to be purged, got %d, %v", purged, err)
+	}
+	if _, err := service.Request(ctx, "jane@example.com", false); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	mailer.receive(t, "jane@example.com")
+}
+
+func TestMagicLinkService_SecondFactor(t *testing.T) {
+	service, _, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+	cfg := service.Config
+	cfg.WebAuthn.RPID = testRPID
+	cfg.WebAuthn.RPName = "Test"
+	cfg.WebAuthn.Origins = []string{testOrigin}
+	webAuthnService := services.NewWebAuthnService(NewMockWebAuthnRepo(), userService.UserRepo, userService, cfg, service.Logger)
+	userService.SecondFactor = webAuthnService
+
+	user, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, webAuthnService, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	// The link does not start a session on its own for users with a passkey
+	service.Request(ctx, "jane@example.com", false)
+	_, err = service.Consume(ctx, mailer.receive(t, "jane@example.com"), "", services.ClientInfo{})
+	var secondFactorErr *services.SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+
+	jwt, err := webAuthnService.FinishLogin(ctx, secondFactorErr.Challenge.CeremonyID, authenticator.assert(t, secondFactorErr.Challenge), services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected the passkey to complete the sign-in, got %v", err)
+	}
+	claims, err := utils.ValidateToken(jwt, "test-secret")
+	if err != nil || claims.Subject != user.PublicID {
+		t.Fatalf("Expected a token for the user, got %+v, %v", claims, err)
+	}
+	if auth := claims.Authentication(); !auth.UsedAny(utils.AMROneTimeCode) || !auth.UsedAny(utils.AMRHardwareKey) || auth.UsedAny(utils.AMRPassword) {
+		t.Errorf("Expected the token to record the link and passkey, got %v", claims.AMR)
+	}
+}
+
+func TestMagicLinkService_InvalidLinkURL(t *testing.T) {
+	service, linkRepo, mailer, userService := newTestMagicLinkService(t)
+	ctx := context.Background()
+	service.Config.MagicLink.URL = "https://app.example.com/%zz"
+
+	if _, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := service.Request(ctx, "jane@example.com", false); err != nil {
+		t.Fatalf("Expected the request to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+	if len(linkRepo.links) != 0 {
+		t.Errorf("Expected no link to be created, got %d", len(linkRepo.links))
+	}
+}
+
+func TestMagicLinkService_TenantToggle(t *testing.T) {
+	disabled, enabled := false, true
+	acme := &services.SAMLConnection{SAMLConnectionConfig: services.SAMLConnectionConfig{
+		ID:           "acme",
+		EmailDomains: []string{"acme.com"},
+		MagicLink:    &disabled,
+	}}
+	globex := &services.SAMLConnection{SAMLConnectionConfig: services.SAMLConnectionConfig{
+		ID:           "globex",
+		EmailDomains: []string{"globex.com"},
+		MagicLink:    &enabled,
+	}}
+	service, _, mailer, userService := newTestMagicLinkService(t, acme, globex)
+	service.Config.MagicLink.Enabled = false
+	ctx := context.Background()
+
+	for _, email := range []string{"jane@acme.com", "john@globex.com", "joe@example.com"} {
+		if _, err := userService.ProvisionUser(ctx, "User", email, nil); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	if !service.Enabled() {
+		t.Fatal("Expected a tenant enabling magic links to enable the service")
+	}
+
+	// Only the tenant that enables magic links gets them
+	for _, email := range []string{"jane@acme.com", "joe@example.com"} {
+		if _, err := service.Request(ctx, email, false); err != nil {
+			t.Fatalf("Expected request to succeed silently, got %v", err)
+		}
+		mailer.expectNone(t)
+	}
+	if _, err := service.Request(ctx, "john@globex.com", false); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "john@globex.com")
+
+	// Disabling the tenant invalidates links already sent
+	enabled = false
+	if _, err := service.Consume(ctx, token, "", services.ClientInfo{}); !errors.Is(err, services.ErrMagicLinkInvalid) {
+		t.Errorf("Expected a link of a disabled tenant to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// expectOAuthError fails the test unless err is an OAuth error with the given code
+func expectOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != code {
+		t.Fatalf("Expected %s, got %v", code, err)
+	}
+}
+
+func TestOAuthService_DeviceAuthorizationFlow(t *testing.T) {
+	service, grantRepo, user, cfg := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, _, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Deploy CLI",
+		RedirectURIs: []string{"http://127.0.0.1/callback"},
+		Scopes:       []string{models.ScopeOpenID, models.ScopeProfileRead},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	authorization, err := service.StartDeviceAuthorization(ctx, client.PublicID, "", models.ScopeOpenID)
+	if err != nil {
+		t.Fatalf("Failed to start device authorization: %v", err)
+	}
+	if !strings.HasPrefix(authorization.VerificationURIComplete, "https://id.example.com/oauth/device?user_code=") {
+		t.Errorf("Unexpected verification URI %q", authorization.VerificationURIComplete)
+	}
+
+	_, err = service.ExchangeDeviceCode(ctx, client.PublicID, "", authorization.DeviceCode)
+	expectOAuthError(t, err, services.OAuthErrorAuthorizationPending)
+
+	// Polling again straight away is too fast
+	_, err = service.ExchangeDeviceCode(ctx, client.PublicID, "", authorization.DeviceCode)
+	expectOAuthError(t, err, services.OAuthErrorSlowDown)
+
+	// User codes are accepted in lower case and without the dash
+	if _, err := service.LookupDeviceCode(ctx, "BCDF-GHJK"); !errors.Is(err, services.ErrInvalidUserCode) {
+		t.Errorf("Expected an unknown user code to be rejected, got %v", err)
+	}
+	grant, err := service.LookupDeviceCode(ctx, strings.ToLower(strings.ReplaceAll(authorization.UserCode, "-", "")))
+	if err != nil {
+		t.Fatalf("Failed to look up user code: %v", err)
+	}
+	if grant.Client.PublicID != client.PublicID {
+		t.Errorf("Expected the code to belong to %s, got %s", client.PublicID, grant.Client.PublicID)
+	}
+
+	if err := service.ApproveDeviceCode(ctx, user, grant, time.Now()); err != nil {
+		t.Fatalf("Failed to approve device code: %v", err)
+	}
+	if _, err := service.LookupDeviceCode(ctx, authorization.UserCode); !errors.Is(err, services.ErrInvalidUserCode) {
+		t.Errorf("Expected an approved user code to be rejected, got %v", err)
+	}
+
+	tokens, err := service.ExchangeDeviceCode(ctx, client.PublicID, "", authorization.DeviceCode)
+	if err != nil {
+		t.Fatalf("Failed to exchange device code: %v", err)
+	}
+	claims, err := utils.ValidateToken(tokens.AccessToken, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	if claims.Subject != user.PublicID || claims.ClientID != client.PublicID {
+		t.Errorf("Expected a token for the approving user, got sub %q client %q", claims.Subject, claims.ClientID)
+	}
+	if tokens.IDToken == "" {
+		t.Error("Expected an ID token for the openid scope")
+	}
+
+	// Replaying the device code revokes the tokens issued from it
+	_, err = service.ExchangeDeviceCode(ctx, client.PublicID, "", authorization.DeviceCode)
+	expectOAuthError(t, err, services.OAuthErrorInvalidGrant)
+	for _, token := range grantRepo.refreshTokens {
+		if token.RevokedAt == nil {
+			t.Error("Expected refresh tokens to be revoked after the device code was replayed")
+		}
+	}
+}
+
+func TestOAuthService_DeviceAuthorizationDenied(t *testing.T) {
+	service, _, user, _ := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, _, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "TV app",
+		RedirectURIs: []string{"http://127.0.0.1/callback"},
+		Scopes:       []string{models.ScopeProfileRead},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	authorization, err := service.StartDeviceAuthorization(ctx, client.PublicID, "", "")
+	if err != nil {
+		t.Fatalf("Failed to start device authorization: %v", err)
+	}
+	if _, err := service.StartDeviceAuthorization(ctx, client.PublicID, "", models.ScopeAdminUsers); err == nil {
+		t.Error("Expected a scope the client was not granted to be rejected")
+	}
+
+	grant, err := service.LookupDeviceCode(ctx, authorization.UserCode)
+	if err != nil {
+		t.Fatalf("Failed to look up user code: %v", err)
+	}
+	if err := service.DenyDeviceCode(ctx, user, grant); err != nil {
+		t.Fatalf("Failed to deny device code: %v", err)
+	}
+
+	_, err = service.ExchangeDeviceCode(ctx, client.PublicID, "", authorization.DeviceCode)
+	expectOAuthError(t, err, services.OAuthErrorAccessDenied)
+}
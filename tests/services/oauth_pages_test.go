@@ -0,0 +1,226 @@
+package services_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/handlers"
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+var (
+	pageCeremonyID = regexp.MustCompile(`name="ceremony_id" value="([^"]+)"`)
+	pageChallenge  = regexp.MustCompile(`"challenge":"([A-Za-z0-9_-]+)"`)
+)
+
+func newTestOAuthPages(t *testing.T) (*handlers.OAuthHandler, *services.WebAuthnService, *services.UserService, *models.OAuthClient) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.OAuth.AccessTokenTTL = 60
+	cfg.OAuth.RefreshTokenTTL = 30
+	cfg.OIDC.Issuer = "https://id.example.com"
+	cfg.WebAuthn.RPID = testRPID
+	cfg.WebAuthn.RPName = "Test"
+	cfg.WebAuthn.Origins = []string{testOrigin}
+	logger := utils.NewLogger("info")
+
+	signingKey, err := utils.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	userRepo := NewMockUserRepo()
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	webAuthnService := services.NewWebAuthnService(NewMockWebAuthnRepo(), userRepo, userService, cfg, logger)
+	userService.SecondFactor = webAuthnService
+	oauthService := services.NewOAuthService(NewMockOAuthClientRepo(), NewMockOAuthGrantRepo(), userRepo, signingKey, cfg, logger)
+
+	client, _, err := oauthService.RegisterClient(context.Background(), services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		Scopes:       []string{models.ScopeOpenID},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	handler := handlers.NewOAuthHandler(nil, oauthService, userService, webAuthnService, nil, logger)
+	return handler, webAuthnService, userService, client
+}
+
+// submitPage posts a form to an authorization page handler with a valid CSRF token
+func submitPage(t *testing.T, handler echo.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("csrf_token", "csrf_test")
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(&http.Cookie{Name: "oauth_csrf", Value: "csrf_test"})
+	rec := httptest.NewRecorder()
+
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("Expected the page to render, got %v", err)
+	}
+	return rec
+}
+
+// answerPasskeyPage answers the passkey ceremony of a second factor page with an authenticator
+func answerPasskeyPage(t *testing.T, body string, authenticator *softAuthenticator) url.Values {
+	ceremonyID := pageCeremonyID.FindStringSubmatch(body)
+	challenge := pageChallenge.FindStringSubmatch(body)
+	if ceremonyID == nil || challenge == nil {
+		t.Fatalf("Expected a passkey ceremony on the page, got %s", body)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge[1])
+	if err != nil {
+		t.Fatalf("Expected a base64url challenge, got %v", err)
+	}
+
+	assertion := authenticator.assert(t, &services.WebAuthnCeremony{
+		CeremonyID: ceremonyID[1],
+		PublicKey:  &services.WebAuthnRequestOptions{Challenge: decoded},
+	})
+	credential, _ := json.Marshal(assertion)
+	return url.Values{"action": {"second-factor"}, "ceremony_id": {ceremonyID[1]}, "credential": {string(credential)}}
+}
+
+// sessionCookie returns the authorization page session a response set
+func sessionCookie(rec *httptest.ResponseRecorder) string {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "oauth_session" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestOAuthPages_PasskeySecondFactor(t *testing.T) {
+	handler, webAuthnService, userService, client := newTestOAuthPages(t)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, webAuthnService, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.PublicID},
+		"redirect_uri":          {client.RedirectURIs[0]},
+		"scope":                 {models.ScopeOpenID},
+		"state":                 {"xyz"},
+		"code_challenge":        {utils.PKCEChallenge(testCodeVerifier)},
+		"code_challenge_method": {utils.PKCEMethodS256},
+	}
+	login := url.Values{"action": {"login"}, "email": {"jane@example.com"}, "password": {"password123"}}
+	for name, values := range params {
+		login[name] = values
+	}
+
+	// The password alone does not sign the user in
+	rec := submitPage(t, handler.SubmitAuthorize, "/oauth/authorize", login)
+	if rec.Code != http.StatusOK || sessionCookie(rec) != "" || !strings.Contains(rec.Body.String(), `value="second-factor"`) {
+		t.Fatalf("Expected the passkey page, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A response for another ceremony is rejected
+	forged := answerPasskeyPage(t, rec.Body.String(), authenticator)
+	forged.Set("ceremony_id", models.NewPublicID())
+	for name, values := range params {
+		forged[name] = values
+	}
+	if rec := submitPage(t, handler.SubmitAuthorize, "/oauth/authorize", forged); rec.Code != http.StatusUnauthorized || sessionCookie(rec) != "" {
+		t.Errorf("Expected an unknown ceremony to be rejected, got %d", rec.Code)
+	}
+
+	// The passkey completes the login and continues to the consent page
+	rec = submitPage(t, handler.SubmitAuthorize, "/oauth/authorize", login)
+	answer := answerPasskeyPage(t, rec.Body.String(), authenticator)
+	for name, values := range params {
+		answer[name] = values
+	}
+	rec = submitPage(t, handler.SubmitAuthorize, "/oauth/authorize", answer)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="approve"`) {
+		t.Fatalf("Expected the consent page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	claims, err := utils.ValidateToken(sessionCookie(rec), "test-secret")
+	if err != nil || claims.Subject != user.PublicID || !claims.Authentication().UsedAny(utils.AMRHardwareKey) {
+		t.Errorf("Expected a passkey session for the user, got %+v, %v", claims, err)
+	}
+
+	// The device page asks for the passkey the same way
+	rec = submitPage(t, handler.SubmitDevice, "/oauth/device", url.Values{"action": {"login"}, "email": {"jane@example.com"}, "password": {"password123"}})
+	if rec.Code != http.StatusOK || sessionCookie(rec) != "" || !strings.Contains(rec.Body.String(), `action="/oauth/device"`) {
+		t.Fatalf("Expected the device passkey page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = submitPage(t, handler.SubmitDevice, "/oauth/device", answerPasskeyPage(t, rec.Body.String(), authenticator))
+	if rec.Code != http.StatusOK || sessionCookie(rec) == "" || !strings.Contains(rec.Body.String(), "Connect a device") {
+		t.Errorf("Expected the user code page, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOAuthPages_AuthTimeFromLoginToken(t *testing.T) {
+	handler, _, userService, client := newTestOAuthPages(t)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	session, err := userService.SessionService.CreateSession(ctx, user, services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// A token issued now for a sign-in an hour ago, as re-issued tokens are
+	signedIn := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token, _ := utils.GenerateToken(user.PublicID, session.PublicID, utils.Authentication{Time: signedIn, Methods: []string{utils.AMRPassword}}, utils.GroupClaims{}, "test-secret", time.Hour)
+
+	form := url.Values{
+		"action":                {"approve"},
+		"csrf_token":            {"csrf_test"},
+		"response_type":         {"code"},
+		"client_id":             {client.PublicID},
+		"redirect_uri":          {client.RedirectURIs[0]},
+		"scope":                 {models.ScopeOpenID},
+		"code_challenge":        {utils.PKCEChallenge(testCodeVerifier)},
+		"code_challenge_method": {utils.PKCEMethodS256},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(&http.Cookie{Name: "oauth_csrf", Value: "csrf_test"})
+	req.AddCookie(&http.Cookie{Name: "oauth_session", Value: token})
+	rec := httptest.NewRecorder()
+	if err := handler.SubmitAuthorize(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("Expected the page to respond, got %v", err)
+	}
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if rec.Code != http.StatusFound || err != nil || location.Query().Get("code") == "" {
+		t.Fatalf("Expected a redirect with a code, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tokens, err := handler.OAuthService.ExchangeAuthorizationCode(ctx, client.PublicID, "", location.Query().Get("code"), client.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	claims, err := utils.ParseIDTokenHint(tokens.IDToken, "https://id.example.com", handler.OAuthService.SigningKey)
+	if err != nil || claims.AuthTime == nil || !claims.AuthTime.Time.Equal(signedIn) {
+		t.Errorf("Expected auth_time to be when the user signed in, got %+v, %v", claims, err)
+	}
+}
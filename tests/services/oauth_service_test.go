@@ -0,0 +1,540 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockOAuthClientRepo is a mock implementation of the OAuthClientRepository interface
+type MockOAuthClientRepo struct {
+	clients map[string]*models.OAuthClient
+	nextID  uint
+}
+
+func NewMockOAuthClientRepo() *MockOAuthClientRepo {
+	return &MockOAuthClientRepo{
+		clients: make(map[string]*models.OAuthClient),
+		nextID:  1,
+	}
+}
+
+func (m *MockOAuthClientRepo) Create(ctx context.Context, client *models.OAuthClient) error {
+	client.ID = m.nextID
+	m.nextID++
+	m.clients[client.PublicID] = client
+	return nil
+}
+
+func (m *MockOAuthClientRepo) FindByID(ctx context.Context, id uint) (*models.OAuthClient, error) {
+	for _, client := range m.clients {
+		if client.ID == id {
+			return client, nil
+		}
+	}
+	return nil, repositories.ErrOAuthClientNotFound
+}
+
+func (m *MockOAuthClientRepo) FindByPublicID(ctx context.Context, publicID string) (*models.OAuthClient, error) {
+	client, ok := m.clients[publicID]
+	if !ok {
+		return nil, repositories.ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+func (m *MockOAuthClientRepo) List(ctx context.Context) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	for _, client := range m.clients {
+		clients = append(clients, *client)
+	}
+	return clients, nil
+}
+
+func (m *MockOAuthClientRepo) Update(ctx context.Context, client *models.OAuthClient) error {
+	m.clients[client.PublicID] = client
+	return nil
+}
+
+func (m *MockOAuthClientRepo) Delete(ctx context.Context, id uint) error {
+	for publicID, client := range m.clients {
+		if client.ID == id {
+			delete(m.clients, publicID)
+		}
+	}
+	return nil
+}
+
+// MockOAuthGrantRepo is a mock implementation of the OAuthGrantRepository interface
+type MockOAuthGrantRepo struct {
+	codes         map[string]*models.OAuthAuthorizationCode
+	deviceCodes   map[string]*models.OAuthDeviceCode
+	refreshTokens map[string]*models.OAuthRefreshToken
+	consents      []*models.OAuthConsent
+	nextID        uint
+}
+
+func NewMockOAuthGrantRepo() *MockOAuthGrantRepo {
+	return &MockOAuthGrantRepo{
+		codes:         make(map[string]*models.OAuthAuthorizationCode),
+		deviceCodes:   make(map[string]*models.OAuthDeviceCode),
+		refreshTokens: make(map[string]*models.OAuthRefreshToken),
+		nextID:        1,
+	}
+}
+
+func (m *MockOAuthGrantRepo) CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	code.ID = m.nextID
+	m.nextID++
+	code.CreatedAt = time.Now()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) ConsumeAuthorizationCode(ctx context.Context, hash string, clientID uint, now time.Time) (*models.OAuthAuthorizationCode, error) {
+	code, ok := m.codes[hash]
+	if !ok || code.ClientID != clientID {
+		return nil, repositories.ErrAuthorizationCodeNotFound
+	}
+	if code.UsedAt != nil {
+		return code, repositories.ErrAuthorizationCodeUsed
+	}
+	code.UsedAt = &now
+	return code, nil
+}
+
+func (m *MockOAuthGrantRepo) CreateDeviceCode(ctx context.Context, code *models.OAuthDeviceCode) error {
+	code.ID = m.nextID
+	m.nextID++
+	code.CreatedAt = time.Now()
+	m.deviceCodes[code.DeviceCodeHash] = code
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) FindDeviceCode(ctx context.Context, hash string) (*models.OAuthDeviceCode, error) {
+	code, ok := m.deviceCodes[hash]
+	if !ok {
+		return nil, repositories.ErrDeviceCodeNotFound
+	}
+	copied := *code
+	return &copied, nil
+}
+
+func (m *MockOAuthGrantRepo) FindPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (*models.OAuthDeviceCode, error) {
+	for _, code := range m.deviceCodes {
+		if code.UserCode == userCode && code.Status == models.DeviceCodePending && code.ExpiresAt.After(now) {
+			copied := *code
+			return &copied, nil
+		}
+	}
+	return nil, repositories.ErrDeviceCodeNotFound
+}
+
+func (m *MockOAuthGrantRepo) RecordDevicePoll(ctx context.Context, id uint, now time.Time, interval int) error {
+	for _, code := range m.deviceCodes {
+		if code.ID == id {
+			code.LastPolledAt = &now
+			code.PollInterval = interval
+		}
+	}
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) UpdateDeviceCodeStatus(ctx context.Context, update *models.OAuthDeviceCode, from string) (bool, error) {
+	for _, code := range m.deviceCodes {
+		if code.ID == update.ID && code.Status == from {
+			code.Status = update.Status
+			code.UserID = update.UserID
+			code.AuthTime = update.AuthTime
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockOAuthGrantRepo) CreateRefreshToken(ctx context.Context, token *models.OAuthRefreshToken) error {
+	token.ID = m.nextID
+	m.nextID++
+	token.CreatedAt = time.Now()
+	m.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) FindRefreshToken(ctx context.Context, hash string) (*models.OAuthRefreshToken, error) {
+	token, ok := m.refreshTokens[hash]
+	if !ok {
+		return nil, repositories.ErrRefreshTokenNotFound
+	}
+	return token, nil
+}
+
+func (m *MockOAuthGrantRepo) MarkRefreshTokenUsed(ctx context.Context, id uint, now time.Time) (bool, error) {
+	for _, token := range m.refreshTokens {
+		if token.ID == id && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockOAuthGrantRepo) RevokeRefreshTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	for _, token := range m.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) RevokeRefreshTokens(ctx context.Context, userID, clientID uint, now time.Time) error {
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID && token.ClientID == clientID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) FindConsent(ctx context.Context, userID, clientID uint) (*models.OAuthConsent, error) {
+	for _, consent := range m.consents {
+		if consent.UserID == userID && consent.ClientID == clientID {
+			return consent, nil
+		}
+	}
+	return nil, repositories.ErrConsentNotFound
+}
+
+func (m *MockOAuthGrantRepo) SaveConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	if consent.ID == 0 {
+		consent.ID = m.nextID
+		m.nextID++
+		m.consents = append(m.consents, consent)
+	}
+	return nil
+}
+
+func (m *MockOAuthGrantRepo) ListConsents(ctx context.Context, userID uint) ([]models.OAuthConsent, error) {
+	var consents []models.OAuthConsent
+	for _, consent := range m.consents {
+		if consent.UserID == userID {
+			consents = append(consents, *consent)
+		}
+	}
+	return consents, nil
+}
+
+func (m *MockOAuthGrantRepo) DeleteConsent(ctx context.Context, userID, clientID uint) error {
+	for i, consent := range m.consents {
+		if consent.UserID == userID && consent.ClientID == clientID {
+			m.consents = append(m.consents[:i], m.consents[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrConsentNotFound
+}
+
+const testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func newTestOAuthService(t *testing.T) (*services.OAuthService, *MockOAuthGrantRepo, *models.User, *config.Config) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.OAuth.AccessTokenTTL = 60
+	cfg.OAuth.RefreshTokenTTL = 30
+	cfg.OIDC.Issuer = "https://id.example.com"
+
+	userRepo := NewMockUserRepo()
+	user := &models.User{PublicID: models.NewPublicID(), Name: "Test User", Email: "test@example.com", Status: models.StatusActive}
+	if err := userRepo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	signingKey, err := utils.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	grantRepo := NewMockOAuthGrantRepo()
+	service := services.NewOAuthService(NewMockOAuthClientRepo(), grantRepo, userRepo, signingKey, cfg, utils.NewLogger("info"))
+	return service, grantRepo, user, cfg
+}
+
+// authorize runs an authorization request for a public client through to an authorization code
+func authorize(t *testing.T, service *services.OAuthService, user *models.User, client *models.OAuthClient, scope string) string {
+	ctx := context.Background()
+
+	grant, err := service.ValidateAuthorizationRequest(ctx, services.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            client.PublicID,
+		RedirectURI:         client.RedirectURIs[0],
+		Scope:               scope,
+		State:               "xyz",
+		CodeChallenge:       utils.PKCEChallenge(testCodeVerifier),
+		CodeChallengeMethod: utils.PKCEMethodS256,
+		Nonce:               "n-0S6_WzA2Mj",
+	})
+	if err != nil {
+		t.Fatalf("Failed to validate authorization request: %v", err)
+	}
+	if err := service.GrantConsent(ctx, user.ID, grant); err != nil {
+		t.Fatalf("Failed to grant consent: %v", err)
+	}
+
+	code, err := service.IssueAuthorizationCode(ctx, user, grant, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to issue authorization code: %v", err)
+	}
+	return code
+}
+
+func TestOAuthService_AuthorizationCodeFlow(t *testing.T) {
+	service, _, user, cfg := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, secret, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Mobile app",
+		RedirectURIs: []string{"com.example.app:/callback"},
+		Scopes:       []string{models.ScopeProfileRead, models.ScopeProfileWrite},
+		Public:       true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+	if secret != "" {
+		t.Error("Expected public clients to have no secret")
+	}
+
+	code := authorize(t, service, user, client, models.ScopeProfileRead)
+
+	if _, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, "", code, client.RedirectURIs[0], "wrong-verifier-wrong-verifier-wrong-verifier"); err == nil {
+		t.Fatal("Expected a wrong code verifier to be rejected")
+	}
+
+	// A failed attempt still consumes the code
+	if _, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, "", code, client.RedirectURIs[0], testCodeVerifier); err == nil {
+		t.Fatal("Expected a used code to be rejected")
+	}
+
+	// Another client presenting the code does not use it up
+	code = authorize(t, service, user, client, models.ScopeProfileRead)
+	other, _, _ := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Other app",
+		RedirectURIs: []string{"com.example.other:/callback"},
+		Scopes:       []string{models.ScopeProfileRead},
+		Public:       true,
+	})
+	if _, err := service.ExchangeAuthorizationCode(ctx, other.PublicID, "", code, client.RedirectURIs[0], testCodeVerifier); err == nil {
+		t.Fatal("Expected another client's code to be rejected")
+	}
+	tokens, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, "", code, client.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	if !claims.IsDelegatedToken() || claims.Subject != user.PublicID || claims.ClientID != client.PublicID {
+		t.Errorf("Expected a delegated token for the user, got sub %q client %q", claims.Subject, claims.ClientID)
+	}
+	if claims.Scope != models.ScopeProfileRead {
+		t.Errorf("Expected scope %q, got %q", models.ScopeProfileRead, claims.Scope)
+	}
+
+	// Refreshing may narrow but not widen the scope
+	var oauthErr *services.OAuthError
+	if _, err := service.RefreshAccessToken(ctx, client.PublicID, "", tokens.RefreshToken, models.ScopeProfileWrite); !errors.As(err, &oauthErr) || oauthErr.Code != services.OAuthErrorInvalidScope {
+		t.Errorf("Expected a wider scope to be rejected, got %v", err)
+	}
+
+	// The rejected request leaves the refresh token usable
+	if _, err := service.RefreshAccessToken(ctx, client.PublicID, "", tokens.RefreshToken, ""); err != nil {
+		t.Errorf("Expected the refresh token to survive an invalid scope, got %v", err)
+	}
+}
+
+func TestOAuthService_RefreshTokenReuseRevokesFamily(t *testing.T) {
+	service, _, user, _ := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, secret, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		Scopes:       []string{models.ScopeProfileRead},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	code := authorize(t, service, user, client, "")
+	if _, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, "", code, client.RedirectURIs[0], testCodeVerifier); err == nil {
+		t.Fatal("Expected confidential clients to require their secret")
+	}
+
+	code = authorize(t, service, user, client, "")
+	first, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, secret, code, client.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+
+	second, err := service.RefreshAccessToken(ctx, client.PublicID, secret, first.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	// Replaying the rotated token revokes the token that replaced it
+	_, err = service.RefreshAccessToken(ctx, client.PublicID, secret, first.RefreshToken, "")
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != services.OAuthErrorInvalidGrant {
+		t.Fatalf("Expected invalid_grant for a replayed refresh token, got %v", err)
+	}
+	if _, err := service.RefreshAccessToken(ctx, client.PublicID, secret, second.RefreshToken, ""); err == nil {
+		t.Error("Expected the whole refresh token family to be revoked")
+	}
+}
+
+func TestOAuthService_ValidateAuthorizationRequest(t *testing.T) {
+	service, _, _, _ := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, _, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		Scopes:       []string{models.ScopeProfileRead},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	valid := services.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            client.PublicID,
+		RedirectURI:         "https://dashboard.example.com/callback",
+		CodeChallenge:       utils.PKCEChallenge(testCodeVerifier),
+		CodeChallengeMethod: utils.PKCEMethodS256,
+	}
+
+	tests := []struct {
+		name         string
+		modify       func(*services.AuthorizationRequest)
+		code         string
+		redirectable bool
+	}{
+		{"unregistered redirect URI", func(r *services.AuthorizationRequest) { r.RedirectURI = "https://dashboard.example.com/callback/" }, services.OAuthErrorInvalidRequest, false},
+		{"unknown client", func(r *services.AuthorizationRequest) { r.ClientID = models.NewPublicID() }, services.OAuthErrorInvalidClient, false},
+		{"missing PKCE", func(r *services.AuthorizationRequest) { r.CodeChallenge = "" }, services.OAuthErrorInvalidRequest, true},
+		{"plain PKCE", func(r *services.AuthorizationRequest) { r.CodeChallengeMethod = "plain" }, services.OAuthErrorInvalidRequest, true},
+		{"unknown scope", func(r *services.AuthorizationRequest) { r.Scope = models.ScopeAdminUsers }, services.OAuthErrorInvalidScope, true},
+		{"token response type", func(r *services.AuthorizationRequest) { r.ResponseType = "token" }, services.OAuthErrorUnsupportedResponseType, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			grant, err := service.ValidateAuthorizationRequest(ctx, req)
+			var oauthErr *services.OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != tt.code {
+				t.Fatalf("Expected %s, got %v", tt.code, err)
+			}
+			if (grant != nil) != tt.redirectable {
+				t.Errorf("Expected redirectable=%v, got grant %v", tt.redirectable, grant)
+			}
+		})
+	}
+
+	if _, err := service.ValidateAuthorizationRequest(ctx, valid); err != nil {
+		t.Errorf("Expected valid request to pass, got %v", err)
+	}
+}
+
+func TestOAuthService_RegisterClientValidatesRedirectURIs(t *testing.T) {
+	service, _, _, _ := newTestOAuthService(t)
+
+	_, _, err := service.RegisterClient(context.Background(), services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"http://dashboard.example.com/callback", "https://dashboard.example.com/#fragment", "/relative"},
+	})
+	var validationErr *services.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 3 {
+		t.Errorf("Expected three redirect URI violations, got %v", err)
+	}
+
+	// Only reverse domain name schemes are allowed besides http(s)
+	_, _, err = service.RegisterClient(context.Background(), services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"javascript:alert(1)", "data:text/html,<script>alert(1)</script>", "file:///etc/passwd"},
+	})
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 3 {
+		t.Errorf("Expected three redirect URI violations, got %v", err)
+	}
+	if _, _, err := service.RegisterClient(context.Background(), services.OAuthClientInput{
+		Name:         "Mobile",
+		RedirectURIs: []string{"com.example.app:/callback"},
+		Public:       true,
+	}); err != nil {
+		t.Errorf("Expected a private-use scheme to be allowed, got %v", err)
+	}
+}
+
+func TestOAuthService_IDToken(t *testing.T) {
+	service, _, user, cfg := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, _, err := service.RegisterClient(ctx, services.OAuthClientInput{
+		Name:                   "Wiki",
+		RedirectURIs:           []string{"https://wiki.example.com/callback"},
+		PostLogoutRedirectURIs: []string{"https://wiki.example.com/"},
+		Scopes:                 []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile},
+		Public:                 true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+
+	code := authorize(t, service, user, client, "openid email")
+	tokens, err := service.ExchangeAuthorizationCode(ctx, client.PublicID, "", code, client.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	if tokens.IDToken == "" {
+		t.Fatal("Expected an ID token for the openid scope")
+	}
+
+	claims, err := utils.ParseIDTokenHint(tokens.IDToken, cfg.OIDC.Issuer, service.SigningKey)
+	if err != nil {
+		t.Fatalf("Failed to verify ID token: %v", err)
+	}
+	if claims.Subject != user.PublicID || claims.Audience[0] != client.PublicID {
+		t.Errorf("Expected sub %q and aud %q, got %q and %v", user.PublicID, client.PublicID, claims.Subject, claims.Audience)
+	}
+	if claims.Nonce != "n-0S6_WzA2Mj" || claims.AuthTime == nil {
+		t.Errorf("Expected nonce and auth_time to be set, got %q and %v", claims.Nonce, claims.AuthTime)
+	}
+	if claims.Email != user.Email || claims.EmailVerified == nil {
+		t.Errorf("Expected email claims for the email scope, got %q", claims.Email)
+	}
+	if claims.Name != "" {
+		t.Errorf("Expected no profile claims without the profile scope, got name %q", claims.Name)
+	}
+
+	logout, err := service.ValidateLogoutRequest(ctx, tokens.IDToken, "", "https://wiki.example.com/")
+	if err != nil {
+		t.Fatalf("Failed to validate logout request: %v", err)
+	}
+	if logout.Subject != user.PublicID || logout.Client.PublicID != client.PublicID {
+		t.Errorf("Expected logout for the token's user and client, got %q and %q", logout.Subject, logout.Client.PublicID)
+	}
+	if _, err := service.ValidateLogoutRequest(ctx, tokens.IDToken, "", "https://evil.example.com/"); err == nil {
+		t.Error("Expected an unregistered post-logout redirect URI to be rejected")
+	}
+}
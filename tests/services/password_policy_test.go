@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/services"
+)
+
+func TestPasswordPolicy_ReportsAllViolations(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.PasswordPolicy.MinLength = 10
+	cfg.PasswordPolicy.RequireUpper = true
+	cfg.PasswordPolicy.RequireDigit = true
+	cfg.PasswordPolicy.DisallowUserInfo = true
+	policy := services.NewPasswordPolicy(cfg)
+
+	err := policy.Validate("johnny", "Johnny Smith", "jsmith@example.com")
+
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Expected PasswordPolicyError, got %v", err)
+	}
+
+	// length, uppercase, digit and name violations
+	if len(policyErr.Violations) != 4 {
+		t.Errorf("Expected 4 violations, got %v", policyErr.Violations)
+	}
+
+	if err := policy.Validate("Correct-Horse-42", "Johnny Smith", "jsmith@example.com"); err != nil {
+		t.Errorf("Expected valid password, got %v", err)
+	}
+}
+
+func TestPasswordPolicy_MinStrength(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.PasswordPolicy.MinStrength = 3
+	policy := services.NewPasswordPolicy(cfg)
+
+	if err := policy.Validate("password123", "", ""); err == nil {
+		t.Error("Expected weak password to be rejected, got nil")
+	}
+
+	if err := policy.Validate("tR7#vq!Lm2zX@p", "", ""); err != nil {
+		t.Errorf("Expected strong password to be accepted, got %v", err)
+	}
+
+	if services.PasswordStrength("aaaaaaaaaaaa") > 1 {
+		t.Error("Expected repeated characters to score low")
+	}
+}
+
+func TestPasswordPolicy_BreachedPasswordList(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2hunter2"))
+	content := "# breached hashes\n" + strings.ToUpper(hex.EncodeToString(sum[:])) + ":1234\n"
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	list, err := services.LoadBreachedPasswordList(path, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := services.LoadBreachedPasswordList(path, 0); err == nil {
+		t.Error("Expected a list over the size limit to be refused")
+	}
+
+	if !list.IsBreached("hunter2hunter2") {
+		t.Error("Expected password to be reported as breached")
+	}
+	if list.IsBreached("not-in-the-list") {
+		t.Error("Expected password not to be reported as breached")
+	}
+
+	policy := services.NewPasswordPolicy(&config.Config{})
+	policy.BreachedPasswords = list
+	if err := policy.Validate("hunter2hunter2", "", ""); err == nil {
+		t.Error("Expected breached password to be rejected, got nil")
+	}
+}
@@ -0,0 +1,290 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockPasswordResetRepo is a mock implementation of the PasswordResetRepository interface
+type MockPasswordResetRepo struct {
+	mu     sync.Mutex
+	resets map[uint]*models.PasswordReset
+	nextID uint
+}
+
+func NewMockPasswordResetRepo() *MockPasswordResetRepo {
+	return &MockPasswordResetRepo{resets: make(map[uint]*models.PasswordReset), nextID: 1}
+}
+
+func (m *MockPasswordResetRepo) Create(ctx context.Context, reset *models.PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset.ID = m.nextID
+	m.nextID++
+	reset.CreatedAt = time.Now()
+	m.resets[reset.ID] = reset
+	return nil
+}
+
+func (m *MockPasswordResetRepo) FindByTokenHash(ctx context.Context, hash string) (*models.PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, reset := range m.resets {
+		if reset.TokenHash == hash {
+			found := *reset
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrPasswordResetNotFound
+}
+
+func (m *MockPasswordResetRepo) MarkUsed(ctx context.Context, id uint, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset, ok := m.resets[id]
+	if !ok || reset.UsedAt != nil {
+		return repositories.ErrPasswordResetNotFound
+	}
+	reset.UsedAt = &now
+	return nil
+}
+
+func (m *MockPasswordResetRepo) CountSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, reset := range m.resets {
+		if reset.UserID == userID && reset.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockPasswordResetRepo) DeleteCreatedBefore(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for id, reset := range m.resets {
+		if reset.CreatedAt.Before(before) {
+			delete(m.resets, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func newTestPasswordResetService(t *testing.T) (*services.PasswordResetService, *MockPasswordResetRepo, *MockUserRepo, *MockMailer, *services.UserService) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.PasswordReset.URL = "https://app.example.com/reset-password"
+	cfg.PasswordReset.TTL = 30
+	cfg.PasswordReset.RateLimit = 3
+	cfg.PasswordPolicy.MinLength = 10
+	cfg.PasswordPolicy.RequireDigit = true
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	resetRepo := NewMockPasswordResetRepo()
+	mailer := &MockMailer{sent: make(chan utils.MailMessage, 10)}
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+
+	service := services.NewPasswordResetService(resetRepo, userRepo, userService, mailer, cfg, logger)
+	return service, resetRepo, userRepo, mailer, userService
+}
+
+func TestPasswordResetService_Reset(t *testing.T) {
+	service, _, _, mailer, userService := newTestPasswordResetService(t)
+	ctx := context.Background()
+
+	if _, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "first-pass1", nil); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	session, err := userService.Login(ctx, "jane@example.com", "first-pass1", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+	if err := service.Request(ctx, "Jane@Example.com"); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	// The new password must satisfy the policy, and a rejected one leaves the link usable
+	var policyErr *services.PasswordPolicyError
+	if err := service.Reset(ctx, token, "too-short"); !errors.As(err, &policyErr) {
+		t.Fatalf("Expected a policy violation, got %v", err)
+	}
+	if err := service.Reset(ctx, token, "second-pass2"); err != nil {
+		t.Fatalf("Expected reset to succeed, got %v", err)
+	}
+
+	if _, err := userService.Login(ctx, "jane@example.com", "first-pass1", services.ClientInfo{}); !errors.Is(err, services.ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to be rejected, got %v", err)
+	}
+	if _, err := userService.Login(ctx, "jane@example.com", "second-pass2", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected the new password to log in, got %v", err)
+	}
+
+	// Sessions from before the reset are ended
+	claims, err := utils.ValidateToken(session, "test-secret")
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if _, err := userService.AuthenticateToken(ctx, claims); err == nil {
+		t.Error("Expected a session from before the reset to be revoked")
+	}
+
+	// Links are single-use
+	if err := service.Reset(ctx, token, "third-pass3"); !errors.Is(err, services.ErrPasswordResetInvalid) {
+		t.Errorf("Expected a used link to be rejected, got %v", err)
+	}
+	if err := service.Reset(ctx, "pr_forged", "third-pass3"); !errors.Is(err, services.ErrPasswordResetInvalid) {
+		t.Errorf("Expected an unknown link to be rejected, got %v", err)
+	}
+
+	// Unknown emails get the same answer, but no email
+	if err := service.Request(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("Expected unknown email to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+}
+
+func TestPasswordResetService_ExpiredLink(t *testing.T) {
+	service, resetRepo, _, mailer, userService := newTestPasswordResetService(t)
+	ctx := context.Background()
+
+	if _, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "first-pass1", nil); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	for _, reset := range resetRepo.resets {
+		reset.ExpiresAt = time.Now().Add(-time.Second)
+	}
+	if err := service.Reset(ctx, token, "second-pass2"); !errors.Is(err, services.ErrPasswordResetInvalid) {
+		t.Errorf("Expected an expired link to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordResetService_NotSent(t *testing.T) {
+	service, _, userRepo, mailer, userService := newTestPasswordResetService(t)
+	ctx := context.Background()
+
+	// Users created through an external identity have no password to reset
+	if _, err := userService.ProvisionUser(ctx, "Sam Roe", "sam@example.com", nil); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := service.Request(ctx, "sam@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "first-pass1", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Suspended accounts cannot take themselves back
+	userRepo.users[user.ID].Status = models.StatusSuspended
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+
+	userRepo.users[user.ID].Status = models.StatusActive
+	for i := 0; i < 3; i++ {
+		if err := service.Request(ctx, "jane@example.com"); err != nil {
+			t.Fatalf("Expected request to succeed, got %v", err)
+		}
+		mailer.receive(t, "jane@example.com")
+	}
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected a rate limited request to succeed silently, got %v", err)
+	}
+	mailer.expectNone(t)
+}
+
+func TestPasswordResetService_PasswordHistory(t *testing.T) {
+	service, _, _, mailer, userService := newTestPasswordResetService(t)
+	service.Config.PasswordPolicy.HistorySize = 2
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "first-pass1", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+
+	var policyErr *services.PasswordPolicyError
+	if err := service.Reset(ctx, token, "first-pass1"); !errors.As(err, &policyErr) {
+		t.Fatalf("Expected the current password to be rejected, got %v", err)
+	}
+	if err := service.Reset(ctx, token, "second-pass2"); err != nil {
+		t.Fatalf("Expected reset to succeed, got %v", err)
+	}
+
+	// The replaced password is still within the last 2 passwords
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token = mailer.receive(t, "jane@example.com")
+	if err := service.Reset(ctx, token, "first-pass1"); !errors.As(err, &policyErr) {
+		t.Fatalf("Expected a recent password to be rejected, got %v", err)
+	}
+	if err := service.Reset(ctx, token, "third-pass3"); err != nil {
+		t.Fatalf("Expected reset to succeed, got %v", err)
+	}
+
+	// Passwords set by reset count towards the history too
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "third-pass3", "second-pass2"); !errors.As(err, &policyErr) {
+		t.Errorf("Expected a password from an earlier reset to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordResetService_ExpiredPassword(t *testing.T) {
+	service, _, userRepo, mailer, userService := newTestPasswordResetService(t)
+	service.Config.PasswordPolicy.MaxAgeDays = 90
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "first-pass1", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	changedAt := time.Now().Add(-91 * 24 * time.Hour)
+	userRepo.users[user.ID].PasswordChangedAt = &changedAt
+	if _, err := userService.Login(ctx, "jane@example.com", "first-pass1", services.ClientInfo{}); !errors.Is(err, services.ErrPasswordExpired) {
+		t.Fatalf("Expected ErrPasswordExpired, got %v", err)
+	}
+
+	// Resetting an expired password restarts its age
+	if err := service.Request(ctx, "jane@example.com"); err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+	token := mailer.receive(t, "jane@example.com")
+	if err := service.Reset(ctx, token, "second-pass2"); err != nil {
+		t.Fatalf("Expected reset to succeed, got %v", err)
+	}
+	if changedAt := userRepo.users[user.ID].PasswordChangedAt; changedAt == nil || time.Since(*changedAt) > time.Minute {
+		t.Errorf("Expected the password age to restart, got %v", changedAt)
+	}
+	if _, err := userService.Login(ctx, "jane@example.com", "second-pass2", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected the new password to log in, got %v", err)
+	}
+}
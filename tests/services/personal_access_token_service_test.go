@@ -0,0 +1,215 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockAccessTokenRepo is a mock implementation of the PersonalAccessTokenRepository interface
+type MockAccessTokenRepo struct {
+	tokens       map[string]*models.PersonalAccessToken
+	nextID       uint
+	lastUsedCall int
+}
+
+func NewMockAccessTokenRepo() *MockAccessTokenRepo {
+	return &MockAccessTokenRepo{
+		tokens: make(map[string]*models.PersonalAccessToken),
+		nextID: 1,
+	}
+}
+
+func (m *MockAccessTokenRepo) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	token.ID = m.nextID
+	m.nextID++
+	m.tokens[token.PublicID] = token
+	return nil
+}
+
+func (m *MockAccessTokenRepo) FindByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return nil, repositories.ErrAccessTokenNotFound
+}
+
+func (m *MockAccessTokenRepo) FindByPublicID(ctx context.Context, userID uint, publicID string) (*models.PersonalAccessToken, error) {
+	token, ok := m.tokens[publicID]
+	if !ok || token.UserID != userID {
+		return nil, repositories.ErrAccessTokenNotFound
+	}
+	return token, nil
+}
+
+func (m *MockAccessTokenRepo) ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	for _, token := range m.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MockAccessTokenRepo) Update(ctx context.Context, token *models.PersonalAccessToken) error {
+	m.tokens[token.PublicID] = token
+	return nil
+}
+
+func (m *MockAccessTokenRepo) Delete(ctx context.Context, userID uint, publicID string) error {
+	token, ok := m.tokens[publicID]
+	if !ok || token.UserID != userID {
+		return repositories.ErrAccessTokenNotFound
+	}
+	delete(m.tokens, publicID)
+	return nil
+}
+
+func (m *MockAccessTokenRepo) UpdateLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	m.lastUsedCall++
+	for publicID, usedAt := range lastUsed {
+		if token, ok := m.tokens[publicID]; ok {
+			usedAt := usedAt
+			token.LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func TestPersonalAccessTokenService_CreateAndAuthenticate(t *testing.T) {
+	// Setup
+	userRepo := NewMockUserRepo()
+	tokenRepo := NewMockAccessTokenRepo()
+	logger := utils.NewLogger("info")
+	cfg := &config.Config{}
+	cfg.JWT.Expiry = 24
+
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	tokenService := services.NewPersonalAccessTokenService(tokenRepo, userRepo, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	token, plaintext, err := tokenService.CreateToken(ctx, user.ID, "ci", []string{models.ScopeUsersRead, models.ScopeUsersRead}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	if !services.IsPersonalAccessToken(plaintext) {
+		t.Errorf("Expected token %q to be recognised as a personal access token", plaintext)
+	}
+	if !strings.HasPrefix(plaintext, token.Prefix) {
+		t.Errorf("Expected token to start with prefix %q", token.Prefix)
+	}
+	if token.TokenHash == plaintext || strings.Contains(token.TokenHash, plaintext) {
+		t.Error("Expected only a hash of the token to be stored")
+	}
+	if len(token.Scopes) != 1 {
+		t.Errorf("Expected duplicate scopes to be removed, got %v", token.Scopes)
+	}
+
+	found, authUser, err := tokenService.Authenticate(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("Failed to authenticate token: %v", err)
+	}
+	if authUser.ID != user.ID || found.PublicID != token.PublicID {
+		t.Error("Expected token to resolve to its owner")
+	}
+	if !found.HasScope(models.ScopeUsersRead) || found.HasScope(models.ScopeProfileWrite) {
+		t.Errorf("Unexpected scopes %v", found.Scopes)
+	}
+
+	// Last use is only written when flushed
+	if tokenRepo.lastUsedCall != 0 {
+		t.Error("Expected authentication not to write last used")
+	}
+	if err := tokenService.FlushLastUsed(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if tokenRepo.tokens[token.PublicID].LastUsedAt == nil {
+		t.Error("Expected last used to be recorded")
+	}
+
+	if _, _, err := tokenService.Authenticate(ctx, plaintext+"x"); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("Expected ErrInvalidAccessToken for an unknown token, got %v", err)
+	}
+
+	if err := tokenService.DeleteToken(ctx, user.ID, token.PublicID); err != nil {
+		t.Fatalf("Failed to delete token: %v", err)
+	}
+	if _, _, err := tokenService.Authenticate(ctx, plaintext); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("Expected ErrInvalidAccessToken for a deleted token, got %v", err)
+	}
+}
+
+func TestPersonalAccessTokenService_Validation(t *testing.T) {
+	// Setup
+	tokenRepo := NewMockAccessTokenRepo()
+	tokenService := services.NewPersonalAccessTokenService(tokenRepo, NewMockUserRepo(), utils.NewLogger("info"))
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		{"missing name", "", []string{models.ScopeUsersRead}, nil},
+		{"no scopes", "ci", nil, nil},
+		{"unknown scope", "ci", []string{"users:delete"}, nil},
+		{"expiry in the past", "ci", []string{models.ScopeUsersRead}, &past},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tokenService.CreateToken(ctx, 1, tt.tokenName, tt.scopes, tt.expiresAt)
+			var validationErr *services.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("Expected ValidationError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessTokenService_ExpiredToken(t *testing.T) {
+	// Setup
+	userRepo := NewMockUserRepo()
+	tokenRepo := NewMockAccessTokenRepo()
+	tokenService := services.NewPersonalAccessTokenService(tokenRepo, userRepo, utils.NewLogger("info"))
+	ctx := context.Background()
+
+	user := &models.User{Name: "Test User", Email: "test@example.com", Status: models.StatusActive}
+	if err := userRepo.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	token, plaintext, err := tokenService.CreateToken(ctx, user.ID, "ci", []string{models.ScopeProfileRead}, &expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if _, _, err := tokenService.Authenticate(ctx, plaintext); err != nil {
+		t.Fatalf("Expected unexpired token to authenticate, got %v", err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	tokenRepo.tokens[token.PublicID].ExpiresAt = &expired
+	if _, _, err := tokenService.Authenticate(ctx, plaintext); !errors.Is(err, services.ErrInvalidAccessToken) {
+		t.Errorf("Expected ErrInvalidAccessToken for an expired token, got %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package services_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockSAMLRequestRepo is a mock implementation of the SAMLRequestRepository interface
+type MockSAMLRequestRepo struct {
+	requests map[string]*models.SAMLRequest
+}
+
+func NewMockSAMLRequestRepo() *MockSAMLRequestRepo {
+	return &MockSAMLRequestRepo{requests: make(map[string]*models.SAMLRequest)}
+}
+
+func (m *MockSAMLRequestRepo) Create(ctx context.Context, request *models.SAMLRequest) error {
+	m.requests[request.RequestID] = request
+	return nil
+}
+
+func (m *MockSAMLRequestRepo) Consume(ctx context.Context, requestID, connection string, now time.Time) error {
+	request, exists := m.requests[requestID]
+	if !exists || request.Connection != connection || !now.Before(request.ExpiresAt) {
+		return repositories.ErrSAMLRequestNotFound
+	}
+	delete(m.requests, requestID)
+	return nil
+}
+
+func (m *MockSAMLRequestRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+	for id, request := range m.requests {
+		if !now.Before(request.ExpiresAt) {
+			delete(m.requests, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const (
+	testIdPEntityID = "https://idp.acme.example/saml"
+	testSAMLIssuer  = "https://id.example.com"
+	testSPEntityID  = testSAMLIssuer + "/api/auth/saml/acme/metadata"
+	testACSURL      = testSAMLIssuer + "/api/auth/saml/acme/acs"
+)
+
+// testIdP holds the key and certificate a test identity provider signs with
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.acme.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testIdP{key: key, cert: cert}
+}
+
+func (idp *testIdP) metadata() string {
+	return `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testIdPEntityID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data>
+      <ds:X509Certificate>` + base64.StdEncoding.EncodeToString(idp.cert.Raw) + `</ds:X509Certificate>
+    </ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.acme.example/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+}
+
+// samlAssertion describes the response a test identity provider sends
+type samlAssertion struct {
+	RequestID string
+	NameID    string
+	Email     string
+	Audience  string
+	Recipient string
+}
+
+// response builds a base64 SAML response with a signed assertion
+func (idp *testIdP) response(t *testing.T, a samlAssertion) string {
+	now := time.Now().UTC()
+	document := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response" Version="2.0" IssueInstant="%[1]s" Destination="%[2]s" InResponseTo="%[3]s">
+  <saml:Issuer>%[4]s</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  <saml:Assertion ID="_assertion" Version="2.0" IssueInstant="%[1]s">
+    <saml:Issuer>%[4]s</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">%[5]s</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="%[3]s" Recipient="%[6]s" NotOnOrAfter="%[7]s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="%[1]s" NotOnOrAfter="%[7]s">
+      <saml:AudienceRestriction><saml:Audience>%[8]s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="mail"><saml:AttributeValue>%[9]s</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="displayName"><saml:AttributeValue>Wile E. Coyote</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`, now.Format(time.RFC3339), testACSURL, a.RequestID, testIdPEntityID, a.NameID, a.Recipient, now.Add(5*time.Minute).Format(time.RFC3339), a.Audience, a.Email)
+
+	signed, err := utils.SignXML([]byte(document), "_assertion", idp.key, idp.cert)
+	if err != nil {
+		t.Fatalf("Failed to sign assertion: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(signed)
+}
+
+// wrapAssertion decodes a response and rewrites it given its signed assertion
+// and a forged copy of it for another user
+func wrapAssertion(t *testing.T, response string, wrap func(document, signed, forged string) string) string {
+	data, _ := base64.StdEncoding.DecodeString(response)
+	document := string(data)
+	start := strings.Index(document, "<saml:Assertion ")
+	end := strings.Index(document, "</saml:Assertion>")
+	if start < 0 || end < 0 {
+		t.Fatal("No assertion in the response")
+	}
+	signed := document[start : end+len("</saml:Assertion>")]
+	forged := strings.ReplaceAll(signed, "road@acme.example", "boss@acme.example")
+	return base64.StdEncoding.EncodeToString([]byte(wrap(document, signed, forged)))
+}
+
+func newTestSAMLService(t *testing.T, idp *testIdP) (*services.SAMLService, *MockUserRepo) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.OIDC.Issuer = testSAMLIssuer
+	logger := utils.NewLogger("info")
+
+	connection, err := services.NewSAMLConnection(services.SAMLConnectionConfig{
+		ID:               "acme",
+		Name:             "Acme Corp",
+		IdPMetadata:      idp.metadata(),
+		AttributeMapping: map[string]string{"email": "mail", "name": "displayName"},
+		EmailDomains:     []string{"acme.example"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err)
+	}
+
+	userRepo := NewMockUserRepo()
+	identityRepo := NewMockIdentityRepo()
+	userRepo.identities = identityRepo
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	federationService := services.NewFederationService(identityRepo, userRepo, userService, nil, nil, cfg, logger)
+	return services.NewSAMLService(NewMockSAMLRequestRepo(), federationService, []*services.SAMLConnection{connection}, cfg, logger), userRepo
+}
+
+// beginSAMLLogin starts a login and returns the ID of the request sent to the identity provider
+func beginSAMLLogin(t *testing.T, service *services.SAMLService) string {
+	target, err := service.BeginLogin(context.Background(), "acme")
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	parsed, _ := url.Parse(target)
+	if parsed.Host != "idp.acme.example" {
+		t.Fatalf("Expected redirect to the identity provider, got %s", target)
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("Invalid SAMLRequest: %v", err)
+	}
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("Invalid SAMLRequest: %v", err)
+	}
+	match := regexp.MustCompile(` ID="([^"]+)"`).FindSubmatch(request)
+	if match == nil {
+		t.Fatalf("AuthnRequest has no ID: %s", request)
+	}
+	return string(match[1])
+}
+
+func TestSAMLService_SignsInWithSignedAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	service, userRepo := newTestSAMLService(t, idp)
+	ctx := context.Background()
+
+	requestID := beginSAMLLogin(t, service)
+	response := idp.response(t, samlAssertion{RequestID: requestID, NameID: "u-1001", Email: "wile@acme.example", Audience: testSPEntityID, Recipient: testACSURL})
+
+	login, err := service.ConsumeResponse(ctx, "acme", response, services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected response to be accepted, got %v", err)
+	}
+	if login.Token == "" || !login.Provisioned {
+		t.Fatalf("Expected a provisioned user with a token, got %+v", login)
+	}
+
+	user, err := userRepo.FindByEmail(ctx, "wile@acme.example")
+	if err != nil || user.Name != "Wile E. Coyote" || !user.Passwordless {
+		t.Fatalf("Unexpected provisioned user: %+v, %v", user, err)
+	}
+
+	// Each response answers one request
+	if _, err := service.ConsumeResponse(ctx, "acme", response, services.ClientInfo{}); !errors.Is(err, services.ErrInvalidSAMLResponse) {
+		t.Errorf("Expected replayed response to be rejected, got %v", err)
+	}
+
+	// Later logins use the linked identity
+	requestID = beginSAMLLogin(t, service)
+	response = idp.response(t, samlAssertion{RequestID: requestID, NameID: "u-1001", Email: "wile@acme.example", Audience: testSPEntityID, Recipient: testACSURL})
+	login, err = service.ConsumeResponse(ctx, "acme", response, services.ClientInfo{})
+	if err != nil || login.Token == "" || login.Provisioned {
+		t.Errorf("Expected existing user to be signed in, got %+v, %v", login, err)
+	}
+}
+
+func TestSAMLService_RejectsInvalidResponses(t *testing.T) {
+	idp := newTestIdP(t)
+	service, _ := newTestSAMLService(t, idp)
+	ctx := context.Background()
+
+	valid := func(requestID string) samlAssertion {
+		return samlAssertion{RequestID: requestID, NameID: "u-1002", Email: "road@acme.example", Audience: testSPEntityID, Recipient: testACSURL}
+	}
+
+	tests := []struct {
+		name   string
+		build  func(requestID string) string
+		expect error
+	}{
+		{"wrong audience", func(id string) string {
+			a := valid(id)
+			a.Audience = "https://other.example.com"
+			return idp.response(t, a)
+		}, services.ErrInvalidSAMLResponse},
+		{"wrong recipient", func(id string) string {
+			a := valid(id)
+			a.Recipient = "https://other.example.com/acs"
+			return idp.response(t, a)
+		}, services.ErrInvalidSAMLResponse},
+		{"unknown request", func(id string) string {
+			return idp.response(t, valid("id_unknown"))
+		}, services.ErrInvalidSAMLResponse},
+		{"signed by another key", func(id string) string {
+			return newTestIdP(t).response(t, valid(id))
+		}, services.ErrInvalidSAMLResponse},
+		{"tampered assertion", func(id string) string {
+			data, _ := base64.StdEncoding.DecodeString(idp.response(t, valid(id)))
+			return base64.StdEncoding.EncodeToString(bytes.Replace(data, []byte("road@acme.example"), []byte("boss@acme.example"), 1))
+		}, services.ErrInvalidSAMLResponse},
+		{"signed assertion hidden in the response extensions", func(id string) string {
+			return wrapAssertion(t, idp.response(t, valid(id)), func(document, signed, forged string) string {
+				document = strings.Replace(document, signed, forged, 1)
+				return strings.Replace(document, "<samlp:Status>", "<samlp:Extensions>"+signed+"</samlp:Extensions><samlp:Status>", 1)
+			})
+		}, services.ErrInvalidSAMLResponse},
+		{"signed assertion hidden in the copied signature", func(id string) string {
+			return wrapAssertion(t, idp.response(t, valid(id)), func(document, signed, forged string) string {
+				forged = strings.Replace(forged, "</ds:Signature>", "<ds:Object>"+signed+"</ds:Object></ds:Signature>", 1)
+				return strings.Replace(document, signed, forged, 1)
+			})
+		}, services.ErrInvalidSAMLResponse},
+		{"signed assertion inside an unsigned one", func(id string) string {
+			return wrapAssertion(t, idp.response(t, valid(id)), func(document, signed, forged string) string {
+				return strings.Replace(document, signed, `<saml:Assertion ID="_forged" Version="2.0">`+signed+`</saml:Assertion>`, 1)
+			})
+		}, services.ErrInvalidSAMLResponse},
+		{"email outside the tenant's domains", func(id string) string {
+			a := valid(id)
+			a.Email = "road@elsewhere.example"
+			return idp.response(t, a)
+		}, services.ErrEmailDomainNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := tt.build(beginSAMLLogin(t, service))
+			if _, err := service.ConsumeResponse(ctx, "acme", response, services.ClientInfo{}); !errors.Is(err, tt.expect) {
+				t.Errorf("Expected %v, got %v", tt.expect, err)
+			}
+		})
+	}
+}
+
+func TestSAMLService_Metadata(t *testing.T) {
+	service, _ := newTestSAMLService(t, newTestIdP(t))
+
+	metadata, err := service.Metadata("acme")
+	if err != nil {
+		t.Fatalf("Failed to build metadata: %v", err)
+	}
+	root, err := utils.ParseXML(metadata)
+	if err != nil {
+		t.Fatalf("Metadata is not valid XML: %v", err)
+	}
+	if root.Attr("entityID") != testSPEntityID {
+		t.Errorf("Expected entity ID %s, got %s", testSPEntityID, root.Attr("entityID"))
+	}
+	acs := root.Child("urn:oasis:names:tc:SAML:2.0:metadata", "SPSSODescriptor").Child("urn:oasis:names:tc:SAML:2.0:metadata", "AssertionConsumerService")
+	if acs == nil || acs.Attr("Location") != testACSURL {
+		t.Errorf("Expected assertion consumer service at %s", testACSURL)
+	}
+
+	if _, err := service.Metadata("unknown"); !errors.Is(err, services.ErrUnknownSAMLConnection) {
+		t.Errorf("Expected ErrUnknownSAMLConnection, got %v", err)
+	}
+}
@@ -0,0 +1,481 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockGroupRepo is a mock implementation of the GroupRepository interface
+type MockGroupRepo struct {
+	groups  map[uint]*models.Group
+	members map[uint]map[uint]string // user IDs to roles, by group ID
+	users   *MockUserRepo
+	nextID  uint
+}
+
+func NewMockGroupRepo(users *MockUserRepo) *MockGroupRepo {
+	return &MockGroupRepo{
+		groups:  make(map[uint]*models.Group),
+		members: make(map[uint]map[uint]string),
+		users:   users,
+		nextID:  1,
+	}
+}
+
+func (m *MockGroupRepo) Create(ctx context.Context, group *models.Group) error {
+	group.BeforeCreate()
+	group.ID = m.nextID
+	m.nextID++
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+	m.groups[group.ID] = group
+	m.members[group.ID] = make(map[uint]string)
+	return nil
+}
+
+func (m *MockGroupRepo) FindByID(ctx context.Context, id uint) (*models.Group, error) {
+	if group, exists := m.groups[id]; exists {
+		return group, nil
+	}
+	return nil, repositories.ErrGroupNotFound
+}
+
+func (m *MockGroupRepo) FindByPublicID(ctx context.Context, publicID string) (*models.Group, error) {
+	for _, group := range m.groups {
+		if group.PublicID == publicID {
+			return group, nil
+		}
+	}
+	return nil, repositories.ErrGroupNotFound
+}
+
+func (m *MockGroupRepo) List(ctx context.Context, filter repositories.GroupFilter, offset, limit int) ([]models.Group, int64, error) {
+	var groups []models.Group
+	for id := uint(1); id < m.nextID; id++ {
+		group, exists := m.groups[id]
+		if !exists || (filter.Local && !group.IsLocal()) || (!filter.Local && filter.Provider != "" && group.Provider != filter.Provider) ||
+			(filter.Name != "" && group.Name != filter.Name) || (filter.ExternalID != "" && group.ExternalID != filter.ExternalID) {
+			continue
+		}
+		groups = append(groups, *group)
+	}
+
+	total := int64(len(groups))
+	if offset >= len(groups) {
+		return []models.Group{}, total, nil
+	}
+	return groups[offset:min(offset+limit, len(groups))], total, nil
+}
+
+func (m *MockGroupRepo) Update(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+	m.groups[group.ID] = group
+	return nil
+}
+
+func (m *MockGroupRepo) Delete(ctx context.Context, id uint) error {
+	delete(m.groups, id)
+	delete(m.members, id)
+	return nil
+}
+
+func (m *MockGroupRepo) CountChildren(ctx context.Context, id uint) (int64, error) {
+	var count int64
+	for _, group := range m.groups {
+		if group.ParentID != nil && *group.ParentID == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MockGroupRepo) DescendantIDs(ctx context.Context, id uint) ([]uint, error) {
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		for childID := uint(1); childID < m.nextID; childID++ {
+			if group, exists := m.groups[childID]; exists && group.ParentID != nil && *group.ParentID == ids[i] {
+				ids = append(ids, childID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockGroupRepo) ListMembers(ctx context.Context, groupID uint) ([]models.User, error) {
+	var users []models.User
+	for id := uint(1); id < m.users.nextID; id++ {
+		if user, exists := m.users.users[id]; exists && m.members[groupID][id] != "" {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MockGroupRepo) ListMemberships(ctx context.Context, groupID uint) ([]models.GroupMembership, error) {
+	var memberships []models.GroupMembership
+	for id := uint(1); id < m.users.nextID; id++ {
+		if user, exists := m.users.users[id]; exists && m.members[groupID][id] != "" {
+			memberships = append(memberships, models.GroupMembership{UserID: user.PublicID, Name: user.Name, Email: user.Email, Role: m.members[groupID][id]})
+		}
+	}
+	return memberships, nil
+}
+
+func (m *MockGroupRepo) FindMember(ctx context.Context, groupID, userID uint) (*models.GroupMember, error) {
+	role := m.members[groupID][userID]
+	if role == "" {
+		return nil, repositories.ErrGroupMemberNotFound
+	}
+	return &models.GroupMember{GroupID: groupID, UserID: userID, Role: role}, nil
+}
+
+func (m *MockGroupRepo) SetMember(ctx context.Context, groupID, userID uint, role string) error {
+	m.members[groupID][userID] = role
+	return nil
+}
+
+func (m *MockGroupRepo) AddMembers(ctx context.Context, groupID uint, userIDs []uint) error {
+	for _, id := range userIDs {
+		if m.members[groupID][id] == "" {
+			m.members[groupID][id] = models.GroupRoleMember
+		}
+	}
+	return nil
+}
+
+func (m *MockGroupRepo) RemoveMembers(ctx context.Context, groupID uint, userIDs []uint) error {
+	for _, id := range userIDs {
+		delete(m.members[groupID], id)
+	}
+	return nil
+}
+
+func (m *MockGroupRepo) ListUserGroups(ctx context.Context, userID uint) ([]models.Group, error) {
+	// Members of a group are members of every group it is nested in
+	effective := make(map[uint]bool)
+	for groupID, members := range m.members {
+		if members[userID] == "" {
+			continue
+		}
+		for group := m.groups[groupID]; group != nil && !effective[group.ID]; group = m.parent(group) {
+			effective[group.ID] = true
+		}
+	}
+
+	var groups []models.Group
+	for id := uint(1); id < m.nextID; id++ {
+		if effective[id] {
+			groups = append(groups, *m.groups[id])
+		}
+	}
+	return groups, nil
+}
+
+// parent returns the group a group is nested in, or nil
+func (m *MockGroupRepo) parent(group *models.Group) *models.Group {
+	if group.ParentID == nil {
+		return nil
+	}
+	return m.groups[*group.ParentID]
+}
+
+func newTestSCIMService() (*services.SCIMService, *MockUserRepo) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.OIDC.Issuer = "https://id.example.com"
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	identityRepo := NewMockIdentityRepo()
+	userRepo.identities = identityRepo
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	statusService := services.NewUserStatusService(userRepo, &MockUserStatusRepo{users: userRepo}, logger)
+	return services.NewSCIMService(userRepo, NewMockGroupRepo(userRepo), identityRepo, userService, statusService, cfg, logger), userRepo
+}
+
+// patchOp builds a PATCH operation with a JSON value
+func patchOp(op, path string, value interface{}) services.SCIMPatchOperation {
+	raw, _ := json.Marshal(value)
+	return services.SCIMPatchOperation{Op: op, Path: path, Value: raw}
+}
+
+// expectSCIMError checks that err is a SCIM error with a status and type
+func expectSCIMError(t *testing.T, err error, status int, scimType string) {
+	t.Helper()
+	var scimErr *services.SCIMError
+	if !errors.As(err, &scimErr) || scimErr.Status != status || scimErr.Type != scimType {
+		t.Errorf("Expected SCIM error %d %q, got %v", status, scimType, err)
+	}
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	filter, err := services.ParseSCIMFilter(`userName eq "jane@example.com" and urn:ietf:params:scim:schemas:core:2.0:User:externalId EQ "a \"b\"" and title pr`)
+	if err != nil {
+		t.Fatalf("Expected filter to parse, got %v", err)
+	}
+	expected := services.SCIMFilter{
+		{Attribute: "username", Operator: "eq", Value: "jane@example.com"},
+		{Attribute: "externalid", Operator: "eq", Value: `a "b"`},
+		{Attribute: "title", Operator: "pr"},
+	}
+	if len(filter) != len(expected) {
+		t.Fatalf("Expected %d comparisons, got %+v", len(expected), filter)
+	}
+	for i := range expected {
+		if filter[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], filter[i])
+		}
+	}
+
+	for _, invalid := range []string{
+		``,
+		`userName eq`,
+		`userName is "jane"`,
+		`userName eq "jane`,
+		`(userName eq "jane")`,
+		`userName eq "jane" or userName eq "joe"`,
+		`emails[type eq "work"]`,
+	} {
+		if _, err := services.ParseSCIMFilter(invalid); err == nil {
+			t.Errorf("Expected filter %q to be rejected", invalid)
+		} else {
+			expectSCIMError(t, err, http.StatusBadRequest, "invalidFilter")
+		}
+	}
+}
+
+func TestSCIMService_UserLifecycle(t *testing.T) {
+	service, userRepo := newTestSCIMService()
+	ctx := context.Background()
+
+	created, err := service.CreateUser(ctx, "acme", &services.SCIMUser{
+		UserName:   "jane@acme.example",
+		ExternalID: "00u1",
+		Name:       &services.SCIMName{GivenName: "Jane", FamilyName: "Doe"},
+	})
+	if err != nil {
+		t.Fatalf("Expected user to be created, got %v", err)
+	}
+	if created.DisplayName != "Jane Doe" || created.ExternalID != "00u1" || !*created.Active || created.Meta.Version == "" {
+		t.Errorf("Unexpected resource %+v", created)
+	}
+	if created.Meta.Location != "https://id.example.com/scim/v2/Users/"+created.ID {
+		t.Errorf("Unexpected location %s", created.Meta.Location)
+	}
+	user, _ := userRepo.FindByPublicID(ctx, created.ID)
+	if !user.Passwordless {
+		t.Error("Expected provisioned user to have no password")
+	}
+
+	// Another tenant cannot see the user
+	if _, err := service.GetUser(ctx, "globex", created.ID); err == nil {
+		t.Error("Expected user to be hidden from another tenant")
+	}
+	list, err := service.ListUsers(ctx, "globex", "", 1, 10)
+	if err != nil || list.TotalResults != 0 {
+		t.Errorf("Expected no users for another tenant, got %+v, %v", list, err)
+	}
+
+	list, err = service.ListUsers(ctx, "acme", `userName eq "JANE@acme.example"`, 1, 10)
+	if err != nil || list.TotalResults != 1 {
+		t.Fatalf("Expected filter to find the user, got %+v, %v", list, err)
+	}
+	list, err = service.ListUsers(ctx, "acme", `externalId eq "00u2"`, 1, 10)
+	if err != nil || list.TotalResults != 0 {
+		t.Errorf("Expected no user with another externalId, got %+v, %v", list, err)
+	}
+	if _, err := service.ListUsers(ctx, "acme", `userName co "jane"`, 1, 10); err == nil {
+		t.Error("Expected unsupported comparison to be rejected")
+	}
+
+	// Entra sends booleans as strings
+	patched, err := service.PatchUser(ctx, "acme", created.ID, created.Meta.Version, []services.SCIMPatchOperation{
+		patchOp("Replace", "active", "False"),
+	})
+	if err != nil || *patched.Active || user.Status != models.StatusDeactivated {
+		t.Fatalf("Expected user to be deactivated, got %+v, %v", patched, err)
+	}
+
+	patched, err = service.PatchUser(ctx, "acme", created.ID, "", []services.SCIMPatchOperation{
+		patchOp("replace", "", map[string]interface{}{"active": true, "displayName": "Jane Q. Doe"}),
+	})
+	if err != nil || !*patched.Active || patched.DisplayName != "Jane Q. Doe" || user.Status != models.StatusActive {
+		t.Fatalf("Expected user to be reactivated and renamed, got %+v, %v", patched, err)
+	}
+
+	replaced, err := service.ReplaceUser(ctx, "acme", created.ID, "", &services.SCIMUser{UserName: "jane.doe@acme.example", DisplayName: "Jane Doe"})
+	if err != nil || replaced.UserName != "jane.doe@acme.example" || replaced.ExternalID != "" {
+		t.Fatalf("Expected user to be replaced, got %+v, %v", replaced, err)
+	}
+
+	if err := service.DeleteUser(ctx, "acme", created.ID, ""); err != nil {
+		t.Fatalf("Expected user to be deleted, got %v", err)
+	}
+	_, err = service.GetUser(ctx, "acme", created.ID)
+	expectSCIMError(t, err, http.StatusNotFound, "")
+}
+
+func TestSCIMService_CreatesInactiveUser(t *testing.T) {
+	service, userRepo := newTestSCIMService()
+	ctx := context.Background()
+	active := false
+
+	created, err := service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "joe@acme.example", Active: &active})
+	if err != nil {
+		t.Fatalf("Expected user to be created, got %v", err)
+	}
+	user, _ := userRepo.FindByPublicID(ctx, created.ID)
+	if *created.Active || user.Status != models.StatusDeactivated {
+		t.Errorf("Expected the user to be created deactivated, got %s", user.Status)
+	}
+
+	// Users without an externalId are keyed by their public ID
+	identities, _ := userRepo.identities.ListByUser(ctx, user.ID)
+	if len(identities) != 1 || identities[0].Subject != user.PublicID {
+		t.Errorf("Expected the tenant identity to be created with the user, got %+v", identities)
+	}
+	if _, err := service.GetUser(ctx, "acme", created.ID); err != nil {
+		t.Errorf("Expected the tenant to see the user, got %v", err)
+	}
+}
+
+func TestSCIMService_RejectsConflictsAndStaleVersions(t *testing.T) {
+	service, userRepo := newTestSCIMService()
+	ctx := context.Background()
+
+	created, err := service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "jane@acme.example", ExternalID: "00u1"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	_, err = service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "Jane@acme.example"})
+	expectSCIMError(t, err, http.StatusConflict, "uniqueness")
+	_, err = service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "joe@acme.example", ExternalID: "00u1"})
+	expectSCIMError(t, err, http.StatusConflict, "uniqueness")
+	_, err = service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "not-an-email"})
+	expectSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+
+	// Accounts the tenant did not provision are neither taken over nor visible
+	userRepo.Create(ctx, &models.User{PublicID: models.NewPublicID(), Name: "Joe", Email: "joe@acme.example", Password: "Password123!"})
+	_, err = service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "joe@acme.example"})
+	expectSCIMError(t, err, http.StatusConflict, "uniqueness")
+
+	stale := created.Meta.Version
+	time.Sleep(time.Millisecond)
+	if _, err := service.PatchUser(ctx, "acme", created.ID, stale, []services.SCIMPatchOperation{patchOp("replace", "displayName", "Jane")}); err != nil {
+		t.Fatalf("Expected patch with the current version to succeed, got %v", err)
+	}
+	_, err = service.ReplaceUser(ctx, "acme", created.ID, stale, &services.SCIMUser{UserName: "jane@acme.example"})
+	expectSCIMError(t, err, http.StatusPreconditionFailed, "")
+	err = service.DeleteUser(ctx, "acme", created.ID, stale)
+	expectSCIMError(t, err, http.StatusPreconditionFailed, "")
+}
+
+func TestSCIMService_Groups(t *testing.T) {
+	service, _ := newTestSCIMService()
+	ctx := context.Background()
+
+	var userIDs []string
+	for _, email := range []string{"a@acme.example", "b@acme.example", "c@acme.example"} {
+		user, err := service.CreateUser(ctx, "acme", &services.SCIMUser{UserName: email})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	outsider, _ := service.CreateUser(ctx, "globex", &services.SCIMUser{UserName: "x@globex.example"})
+
+	group, err := service.CreateGroup(ctx, "acme", &services.SCIMGroup{
+		DisplayName: "Engineering",
+		Members:     []services.SCIMMember{{Value: userIDs[0]}, {Value: userIDs[1]}},
+	})
+	if err != nil || len(group.Members) != 2 {
+		t.Fatalf("Expected group with two members, got %+v, %v", group, err)
+	}
+
+	_, err = service.CreateGroup(ctx, "acme", &services.SCIMGroup{DisplayName: "Engineering"})
+	expectSCIMError(t, err, http.StatusConflict, "uniqueness")
+	_, err = service.CreateGroup(ctx, "acme", &services.SCIMGroup{DisplayName: "Sales", Members: []services.SCIMMember{{Value: outsider.ID}}})
+	expectSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+
+	patched, err := service.PatchGroup(ctx, "acme", group.ID, group.Meta.Version, []services.SCIMPatchOperation{
+		patchOp("remove", `members[value eq "`+userIDs[0]+`"]`, nil),
+		patchOp("add", "members", []services.SCIMMember{{Value: userIDs[2]}}),
+		patchOp("replace", "displayName", "Platform"),
+	})
+	if err != nil || patched.DisplayName != "Platform" || len(patched.Members) != 2 ||
+		patched.Members[0].Value != userIDs[1] || patched.Members[1].Value != userIDs[2] {
+		t.Fatalf("Unexpected patched group %+v, %v", patched, err)
+	}
+	if patched.Meta.Version == group.Meta.Version {
+		t.Error("Expected membership changes to change the group version")
+	}
+
+	list, err := service.ListGroups(ctx, "acme", `displayName eq "Platform"`, 1, 10, false)
+	if err != nil || list.TotalResults != 1 {
+		t.Fatalf("Expected filter to find the group, got %+v, %v", list, err)
+	}
+	if groups := list.Resources.([]*services.SCIMGroup); groups[0].Members != nil {
+		t.Error("Expected members to be excluded")
+	}
+
+	if _, err := service.GetGroup(ctx, "globex", group.ID, true); err == nil {
+		t.Error("Expected group to be hidden from another tenant")
+	}
+	if err := service.DeleteGroup(ctx, "acme", group.ID, ""); err != nil {
+		t.Fatalf("Expected group to be deleted, got %v", err)
+	}
+}
+
+func TestSCIMService_SAMLSignInLinksProvisionedUser(t *testing.T) {
+	idp := newTestIdP(t)
+	samlService, userRepo := newTestSAMLService(t, idp)
+	federation := samlService.FederationService
+	ctx := context.Background()
+
+	logger := utils.NewLogger("info")
+	statusService := services.NewUserStatusService(userRepo, &MockUserStatusRepo{users: userRepo}, logger)
+	scimService := services.NewSCIMService(userRepo, NewMockGroupRepo(userRepo), federation.IdentityRepo, federation.UserService, statusService, federation.Config, logger)
+
+	created, err := scimService.CreateUser(ctx, "acme", &services.SCIMUser{UserName: "wile@acme.example"})
+	if err != nil {
+		t.Fatalf("Failed to provision user: %v", err)
+	}
+
+	requestID := beginSAMLLogin(t, samlService)
+	response := idp.response(t, samlAssertion{RequestID: requestID, NameID: "u-1001", Email: "wile@acme.example", Audience: testSPEntityID, Recipient: testACSURL})
+	login, err := samlService.ConsumeResponse(ctx, "acme", response, services.ClientInfo{})
+	if err != nil || login.Token == "" || login.LinkToken != "" || login.Provisioned {
+		t.Fatalf("Expected the provisioned user to be signed in, got %+v, %v", login, err)
+	}
+
+	user, _ := userRepo.FindByPublicID(ctx, created.ID)
+	identities, _ := federation.ListIdentities(ctx, user.ID)
+	if len(identities) != 2 {
+		t.Fatalf("Expected SCIM and SAML identities, got %+v", identities)
+	}
+	for _, identity := range identities {
+		err := federation.UnlinkIdentity(ctx, user.ID, identity.PublicID)
+		switch identity.Provider {
+		case "scim:acme":
+			if !errors.Is(err, services.ErrManagedIdentity) {
+				t.Errorf("Expected SCIM identity to be managed, got %v", err)
+			}
+		default:
+			if !errors.Is(err, services.ErrLastIdentity) {
+				t.Errorf("Expected SAML identity to be the last sign-in identity, got %v", err)
+			}
+		}
+	}
+}
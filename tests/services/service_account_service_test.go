@@ -0,0 +1,195 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockServiceAccountRepo is a mock implementation of the ServiceAccountRepository interface
+type MockServiceAccountRepo struct {
+	accounts map[string]*models.ServiceAccount
+	secrets  []*models.ServiceAccountSecret
+	nextID   uint
+}
+
+func NewMockServiceAccountRepo() *MockServiceAccountRepo {
+	return &MockServiceAccountRepo{
+		accounts: make(map[string]*models.ServiceAccount),
+		nextID:   1,
+	}
+}
+
+func (m *MockServiceAccountRepo) Create(ctx context.Context, account *models.ServiceAccount, secret *models.ServiceAccountSecret) error {
+	account.ID = m.nextID
+	m.nextID++
+	m.accounts[account.PublicID] = account
+	secret.ServiceAccountID = account.ID
+	m.secrets = append(m.secrets, secret)
+	return nil
+}
+
+func (m *MockServiceAccountRepo) FindByPublicID(ctx context.Context, publicID string) (*models.ServiceAccount, error) {
+	account, ok := m.accounts[publicID]
+	if !ok {
+		return nil, repositories.ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+func (m *MockServiceAccountRepo) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	for _, account := range m.accounts {
+		accounts = append(accounts, *account)
+	}
+	return accounts, nil
+}
+
+func (m *MockServiceAccountRepo) Update(ctx context.Context, account *models.ServiceAccount) error {
+	m.accounts[account.PublicID] = account
+	return nil
+}
+
+func (m *MockServiceAccountRepo) Delete(ctx context.Context, id uint) error {
+	for publicID, account := range m.accounts {
+		if account.ID == id {
+			delete(m.accounts, publicID)
+		}
+	}
+	return nil
+}
+
+func (m *MockServiceAccountRepo) ListSecrets(ctx context.Context, accountID uint) ([]models.ServiceAccountSecret, error) {
+	var secrets []models.ServiceAccountSecret
+	for _, secret := range m.secrets {
+		if secret.ServiceAccountID == accountID {
+			secrets = append(secrets, *secret)
+		}
+	}
+	return secrets, nil
+}
+
+func (m *MockServiceAccountRepo) RotateSecret(ctx context.Context, secret *models.ServiceAccountSecret, expireOthersAt time.Time) error {
+	for _, existing := range m.secrets {
+		if existing.ServiceAccountID == secret.ServiceAccountID && (existing.ExpiresAt == nil || existing.ExpiresAt.After(expireOthersAt)) {
+			expiresAt := expireOthersAt
+			existing.ExpiresAt = &expiresAt
+		}
+	}
+	m.secrets = append(m.secrets, secret)
+	return nil
+}
+
+func newTestServiceAccountService() (*services.ServiceAccountService, *config.Config) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.OAuth.AccessTokenTTL = 60
+	return services.NewServiceAccountService(NewMockServiceAccountRepo(), cfg, utils.NewLogger("info")), cfg
+}
+
+func TestServiceAccountService_ClientCredentials(t *testing.T) {
+	service, cfg := newTestServiceAccountService()
+	ctx := context.Background()
+
+	account, secret, err := service.CreateAccount(ctx, "billing", "Billing sync", []string{models.ScopeUsersRead, models.ScopeUsersExport})
+	if err != nil {
+		t.Fatalf("Failed to create service account: %v", err)
+	}
+
+	token, scopes, ttl, err := service.IssueClientCredentialsToken(ctx, account.PublicID, secret, "users:read")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if len(scopes) != 1 || scopes[0] != models.ScopeUsersRead {
+		t.Errorf("Expected only the requested scope, got %v", scopes)
+	}
+	if ttl != time.Hour {
+		t.Errorf("Expected a one hour token, got %v", ttl)
+	}
+
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if !claims.IsClientToken() || claims.Subject != account.PublicID {
+		t.Errorf("Expected a client token for %q, got subject %q", account.PublicID, claims.Subject)
+	}
+
+	if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, "wrong-secret", ""); !errors.Is(err, services.ErrInvalidClient) {
+		t.Errorf("Expected ErrInvalidClient for a wrong secret, got %v", err)
+	}
+	if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, secret, "admin:users"); !errors.Is(err, services.ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope for an ungranted scope, got %v", err)
+	}
+
+	// Removing a scope takes effect for tokens already issued
+	if _, err := service.UpdateAccount(ctx, account.PublicID, services.ServiceAccountUpdate{Scopes: []string{models.ScopeUsersExport}}); err != nil {
+		t.Fatalf("Failed to update service account: %v", err)
+	}
+	if _, remaining, err := service.AuthenticateToken(ctx, claims); err != nil || len(remaining) != 0 {
+		t.Errorf("Expected no remaining scopes, got %v (%v)", remaining, err)
+	}
+
+	disabled := true
+	if _, err := service.UpdateAccount(ctx, account.PublicID, services.ServiceAccountUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("Failed to disable service account: %v", err)
+	}
+	if _, _, err := service.AuthenticateToken(ctx, claims); err == nil {
+		t.Error("Expected tokens of a disabled account to be rejected")
+	}
+	if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, secret, ""); !errors.Is(err, services.ErrInvalidClient) {
+		t.Errorf("Expected ErrInvalidClient for a disabled account, got %v", err)
+	}
+}
+
+func TestServiceAccountService_RotateSecret(t *testing.T) {
+	service, _ := newTestServiceAccountService()
+	ctx := context.Background()
+
+	account, oldSecret, err := service.CreateAccount(ctx, "billing", "", []string{models.ScopeUsersRead})
+	if err != nil {
+		t.Fatalf("Failed to create service account: %v", err)
+	}
+
+	// With a grace period both secrets work
+	_, newSecret, err := service.RotateSecret(ctx, account.PublicID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to rotate secret: %v", err)
+	}
+	for _, secret := range []string{oldSecret, newSecret} {
+		if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, secret, ""); err != nil {
+			t.Errorf("Expected secret to work during the grace period, got %v", err)
+		}
+	}
+
+	// Without one, every previous secret stops working immediately
+	_, latestSecret, err := service.RotateSecret(ctx, account.PublicID, 0)
+	if err != nil {
+		t.Fatalf("Failed to rotate secret: %v", err)
+	}
+	for _, secret := range []string{oldSecret, newSecret} {
+		if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, secret, ""); !errors.Is(err, services.ErrInvalidClient) {
+			t.Errorf("Expected previous secret to be expired, got %v", err)
+		}
+	}
+	if _, _, _, err := service.IssueClientCredentialsToken(ctx, account.PublicID, latestSecret, ""); err != nil {
+		t.Errorf("Expected latest secret to work, got %v", err)
+	}
+}
+
+func TestServiceAccountService_RejectsUserScopes(t *testing.T) {
+	service, _ := newTestServiceAccountService()
+
+	_, _, err := service.CreateAccount(context.Background(), "billing", "", []string{models.ScopeProfileWrite})
+	var validationErr *services.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("Expected ValidationError for a profile scope, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockSessionRepo is a mock implementation of the SessionRepository interface
+type MockSessionRepo struct {
+	sessions     map[string]*models.Session
+	nextID       uint
+	lastSeenCall int
+}
+
+func NewMockSessionRepo() *MockSessionRepo {
+	return &MockSessionRepo{
+		sessions: make(map[string]*models.Session),
+		nextID:   1,
+	}
+}
+
+func (m *MockSessionRepo) Create(ctx context.Context, session *models.Session) error {
+	session.ID = m.nextID
+	m.nextID++
+	m.sessions[session.PublicID] = session
+	return nil
+}
+
+func (m *MockSessionRepo) FindByPublicID(ctx context.Context, publicID string) (*models.Session, error) {
+	session, ok := m.sessions[publicID]
+	if !ok {
+		return nil, repositories.ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *MockSessionRepo) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.IsActive(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MockSessionRepo) Revoke(ctx context.Context, userID uint, publicID string, now time.Time) error {
+	session, ok := m.sessions[publicID]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return repositories.ErrSessionNotFound
+	}
+	session.RevokedAt = &now
+	return nil
+}
+
+func (m *MockSessionRepo) RevokeAllExcept(ctx context.Context, userID uint, keepPublicID string, now time.Time) error {
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.PublicID != keepPublicID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockSessionRepo) UpdateLastSeen(ctx context.Context, lastSeen map[string]time.Time) error {
+	m.lastSeenCall++
+	for publicID, seenAt := range lastSeen {
+		if session, ok := m.sessions[publicID]; ok && session.LastSeenAt.Before(seenAt) {
+			session.LastSeenAt = seenAt
+		}
+	}
+	return nil
+}
+
+func TestSessionService_LoginCreatesSession(t *testing.T) {
+	// Setup
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	sessionRepo := NewMockSessionRepo()
+	sessionService := services.NewSessionService(sessionRepo, cfg, logger)
+	userService := services.NewUserService(NewMockUserRepo(), NewMockPasswordHistoryRepo(), sessionService, nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	client := services.ClientInfo{UserAgent: "Mozilla/5.0 (X11; Linux x86_64)", IPAddress: "203.0.113.7"}
+	token, err := userService.Login(ctx, "test@example.com", "password123", client)
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{UserAgent: "curl/8.0"}); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.SessionID == "" {
+		t.Fatal("Expected token to carry a session ID")
+	}
+
+	sessions, err := sessionService.ListSessions(ctx, user.ID, claims.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	var current *models.Session
+	for i := range sessions {
+		if sessions[i].Current {
+			current = &sessions[i]
+		}
+	}
+	if current == nil || current.PublicID != claims.SessionID {
+		t.Fatal("Expected the token's session to be marked current")
+	}
+	if current.UserAgent != client.UserAgent || current.IPAddress != client.IPAddress {
+		t.Errorf("Expected session to record the client, got %q from %q", current.UserAgent, current.IPAddress)
+	}
+}
+
+func TestSessionService_RevokeSession(t *testing.T) {
+	// Setup
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	sessionService := services.NewSessionService(NewMockSessionRepo(), cfg, logger)
+	userService := services.NewUserService(NewMockUserRepo(), NewMockPasswordHistoryRepo(), sessionService, nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	other, err := userService.RegisterUser(ctx, "Other User", "other@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+
+	// Users cannot revoke each other's sessions
+	if err := sessionService.RevokeSession(ctx, other.ID, claims.SessionID); !errors.Is(err, repositories.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := sessionService.RevokeSession(ctx, user.ID, claims.SessionID); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+
+	if _, err := userService.AuthenticateToken(ctx, claims); !errors.Is(err, services.ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked for a revoked session, got %v", err)
+	}
+}
+
+func TestSessionService_ChangePasswordKeepsCurrentSession(t *testing.T) {
+	// Setup
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	sessionService := services.NewSessionService(NewMockSessionRepo(), cfg, logger)
+	userService := services.NewUserService(NewMockUserRepo(), NewMockPasswordHistoryRepo(), sessionService, nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	current, _ := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	currentClaims, _ := utils.ValidateToken(current, cfg.JWT.Secret)
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	token, err := userService.ChangePassword(ctx, user.ID, currentClaims.SessionID, "password123", "new-password456")
+	if err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.SessionID != currentClaims.SessionID {
+		t.Errorf("Expected new token to keep session %q, got %q", currentClaims.SessionID, claims.SessionID)
+	}
+
+	sessions, err := sessionService.ListSessions(ctx, user.ID, claims.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].PublicID != claims.SessionID {
+		t.Errorf("Expected only the current session to remain, got %d sessions", len(sessions))
+	}
+}
+
+func TestSessionService_FlushLastSeen(t *testing.T) {
+	// Setup
+	cfg := &config.Config{}
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	sessionRepo := NewMockSessionRepo()
+	sessionService := services.NewSessionService(sessionRepo, cfg, logger)
+	ctx := context.Background()
+
+	session, err := sessionService.CreateSession(ctx, &models.User{ID: 1}, services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	created := session.LastSeenAt
+
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 10; i++ {
+		sessionService.Touch(session.PublicID)
+	}
+
+	// Touching only buffers activity in memory
+	if sessionRepo.lastSeenCall != 0 || !sessionRepo.sessions[session.PublicID].LastSeenAt.Equal(created) {
+		t.Fatal("Expected Touch not to write to the repository")
+	}
+
+	if err := sessionService.FlushLastSeen(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if sessionRepo.lastSeenCall != 1 {
+		t.Errorf("Expected a single batched write, got %d", sessionRepo.lastSeenCall)
+	}
+	if !sessionRepo.sessions[session.PublicID].LastSeenAt.After(created) {
+		t.Error("Expected last seen to be updated")
+	}
+
+	// Nothing is written when there was no activity
+	if err := sessionService.FlushLastSeen(ctx); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if sessionRepo.lastSeenCall != 1 {
+		t.Errorf("Expected no write without activity, got %d writes", sessionRepo.lastSeenCall)
+	}
+}
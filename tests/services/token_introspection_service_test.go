@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockRevokedTokenRepo is a mock implementation of the RevokedTokenRepository interface
+type MockRevokedTokenRepo struct {
+	tokens map[string]*models.RevokedToken
+}
+
+func NewMockRevokedTokenRepo() *MockRevokedTokenRepo {
+	return &MockRevokedTokenRepo{tokens: make(map[string]*models.RevokedToken)}
+}
+
+func (m *MockRevokedTokenRepo) Create(ctx context.Context, token *models.RevokedToken) error {
+	if _, ok := m.tokens[token.TokenID]; !ok {
+		m.tokens[token.TokenID] = token
+	}
+	return nil
+}
+
+func (m *MockRevokedTokenRepo) Exists(ctx context.Context, tokenID string) (bool, error) {
+	_, ok := m.tokens[tokenID]
+	return ok, nil
+}
+
+func (m *MockRevokedTokenRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+	for id, token := range m.tokens {
+		if token.ExpiresAt.Before(now) {
+			delete(m.tokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestTokenIntrospectionService_IntrospectAndRevoke(t *testing.T) {
+	oauthService, _, user, cfg := newTestOAuthService(t)
+	ctx := context.Background()
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(oauthService.UserRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	accessTokenService := services.NewPersonalAccessTokenService(NewMockAccessTokenRepo(), oauthService.UserRepo, logger)
+	serviceAccountService := services.NewServiceAccountService(NewMockServiceAccountRepo(), cfg, logger)
+	revocationService := services.NewTokenRevocationService(NewMockRevokedTokenRepo(), logger)
+	service := services.NewTokenIntrospectionService(userService, accessTokenService, serviceAccountService, oauthService, revocationService, nil, cfg, logger)
+
+	client, secret, err := oauthService.RegisterClient(ctx, services.OAuthClientInput{
+		Name:         "Dashboard",
+		RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		Scopes:       []string{models.ScopeProfileRead},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register client: %v", err)
+	}
+	tokens, err := oauthService.ExchangeAuthorizationCode(ctx, client.PublicID, secret, authorize(t, oauthService, user, client, ""), client.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+
+	if _, err := service.AuthenticateCaller(ctx, client.PublicID, "wrong"); err == nil {
+		t.Fatal("Expected a wrong client secret to be rejected")
+	}
+	caller, err := service.AuthenticateCaller(ctx, client.PublicID, secret)
+	if err != nil {
+		t.Fatalf("Failed to authenticate caller: %v", err)
+	}
+
+	result, err := service.Introspect(ctx, caller, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to introspect access token: %v", err)
+	}
+	if !result.Active || result.Subject != user.PublicID || result.ClientID != client.PublicID || result.TokenType != services.TokenTypeAccess {
+		t.Errorf("Expected an active access token for the user and client, got %+v", result)
+	}
+
+	result, err = service.Introspect(ctx, caller, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to introspect refresh token: %v", err)
+	}
+	if !result.Active || result.TokenType != services.TokenTypeRefresh {
+		t.Errorf("Expected an active refresh token, got %+v", result)
+	}
+
+	// Other clients may not revoke the client's tokens
+	account, accountSecret, err := serviceAccountService.CreateAccount(ctx, "reporting", "", []string{models.ScopeUsersRead})
+	if err != nil {
+		t.Fatalf("Failed to create service account: %v", err)
+	}
+	other, err := service.AuthenticateCaller(ctx, account.PublicID, accountSecret)
+	if err != nil {
+		t.Fatalf("Failed to authenticate service account: %v", err)
+	}
+	err = service.Revoke(ctx, other, tokens.AccessToken)
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != services.OAuthErrorUnauthorizedClient {
+		t.Fatalf("Expected unauthorized_client, got %v", err)
+	}
+
+	if err := service.Revoke(ctx, caller, tokens.AccessToken); err != nil {
+		t.Fatalf("Failed to revoke access token: %v", err)
+	}
+	if err := service.Revoke(ctx, caller, tokens.RefreshToken); err != nil {
+		t.Fatalf("Failed to revoke refresh token: %v", err)
+	}
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken, "not-a-token"} {
+		result, err := service.Introspect(ctx, caller, token)
+		if err != nil {
+			t.Fatalf("Failed to introspect token: %v", err)
+		}
+		if result.Active {
+			t.Errorf("Expected %.10s... to be inactive", token)
+		}
+	}
+
+	// Unknown tokens are revoked successfully
+	if err := service.Revoke(ctx, caller, "rt_unknown"); err != nil {
+		t.Errorf("Expected revoking an unknown token to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/handlers"
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+func newTestExportHandler(t *testing.T) (*handlers.UserHandler, *MockUserRepo) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+	if _, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if _, err := userService.RegisterUser(ctx, "=HYPERLINK(\"http://evil\")", "john@example.com", "password123", nil); err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	userRepo.users[1].Role = models.RoleAdmin
+	return handlers.NewUserHandler(userService, logger), userRepo
+}
+
+// exportUsers requests GET /api/users/export with a query string
+func exportUsers(t *testing.T, handler *handlers.UserHandler, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/users/export?"+query, nil)
+	rec := httptest.NewRecorder()
+	if err := handler.ExportUsers(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("Expected a response, got %v", err)
+	}
+	return rec
+}
+
+func TestUserHandler_ExportCSV(t *testing.T) {
+	handler, userRepo := newTestExportHandler(t)
+
+	rec := exportUsers(t, handler, "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/csv") {
+		t.Fatalf("Expected a CSV export, got %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	if !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), ".csv") {
+		t.Errorf("Expected a CSV attachment, got %q", rec.Header().Get(echo.HeaderContentDisposition))
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != "id,name,email,role,status,created_at,updated_at" {
+		t.Fatalf("Expected a header and two rows, got %v", records)
+	}
+	if records[1][0] != userRepo.users[1].PublicID || records[1][3] != models.RoleAdmin {
+		t.Errorf("Unexpected first row %v", records[1])
+	}
+
+	// Formulas are neutralized so spreadsheets show them as text
+	if records[2][1] != `'=HYPERLINK("http://evil")` {
+		t.Errorf("Expected the formula to be quoted, got %q", records[2][1])
+	}
+}
+
+func TestUserHandler_ExportColumnsAndFilters(t *testing.T) {
+	handler, userRepo := newTestExportHandler(t)
+
+	rec := exportUsers(t, handler, "columns=email,%20ID,email&role=admin")
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected the admin only, got %v, %v", records, err)
+	}
+	if strings.Join(records[0], ",") != "email,id" || records[1][0] != "jane@example.com" || records[1][1] != userRepo.users[1].PublicID {
+		t.Errorf("Expected the requested columns in order, got %v", records)
+	}
+
+	// The password hash is never exportable
+	for _, query := range []string{"columns=password", "columns=password_hash", "format=xml", "role=owner"} {
+		if rec := exportUsers(t, handler, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestUserHandler_ExportJSON(t *testing.T) {
+	handler, userRepo := newTestExportHandler(t)
+	hash := userRepo.users[1].Password
+
+	rec := exportUsers(t, handler, "format=json")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		t.Fatalf("Expected a JSON export, got %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	var users []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+		t.Fatalf("Expected a JSON array, got %v: %s", err, rec.Body.String())
+	}
+	if len(users) != 2 || users[0]["email"] != "jane@example.com" || users[1]["name"] != `=HYPERLINK("http://evil")` {
+		t.Errorf("Unexpected users %v", users)
+	}
+	if _, ok := users[0]["password"]; ok || strings.Contains(rec.Body.String(), hash) {
+		t.Error("Expected the password hash not to be exported")
+	}
+
+	// NDJSON has one object per line, in the requested column order
+	rec = exportUsers(t, handler, "format=ndjson&columns=name,email")
+	if !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "application/x-ndjson") {
+		t.Errorf("Expected an NDJSON export, got %s", rec.Header().Get(echo.HeaderContentType))
+	}
+	var lines []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 || lines[0] != `{"name":"Jane Doe","email":"jane@example.com"}` {
+		t.Errorf("Unexpected NDJSON lines %q", lines)
+	}
+}
@@ -0,0 +1,71 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/user/user-management-service/api/handlers"
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// updateProfile sends PUT /api/users for a user authenticated as auth records
+func updateProfile(t *testing.T, handler *handlers.UserHandler, user *models.User, auth utils.Authentication, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("authentication", auth)
+
+	if err := handler.UpdateUser(c); err != nil {
+		t.Fatalf("Expected a response, got %v", err)
+	}
+	return rec
+}
+
+func TestUserHandler_UpdateUserStepUp(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.StepUp.MaxAge = 10
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(NewMockUserRepo(), NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	handler := handlers.NewUserHandler(userService, logger)
+
+	// Provisioned users have no password to re-authenticate with
+	user, err := userService.ProvisionUser(context.Background(), "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Access tokens record no authentication, but may still edit the profile
+	if rec := updateProfile(t, handler, user, utils.Authentication{}, `{"name": "Jane Smith", "email": "jane@example.com"}`); rec.Code != http.StatusOK || user.Name != "Jane Smith" {
+		t.Errorf("Expected the name to change without a step-up, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Changing the email needs a recent password or passkey authentication
+	stale := utils.Authentication{Time: time.Now().Add(-time.Hour), Methods: []string{utils.AMRPassword}}
+	if rec := updateProfile(t, handler, user, stale, `{"email": "jane.smith@example.com"}`); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "reauthentication_required") {
+		t.Errorf("Expected the email change to need a step-up, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := updateProfile(t, handler, user, utils.NewAuthentication(utils.AMROneTimeCode), `{"email": "jane.smith@example.com"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a magic link not to allow changing the email, got %d", rec.Code)
+	}
+	if user.Email != "jane@example.com" {
+		t.Fatalf("Expected the email to be unchanged, got %s", user.Email)
+	}
+
+	if rec := updateProfile(t, handler, user, utils.NewAuthentication(utils.AMRPassword), `{"email": "jane.smith@example.com"}`); rec.Code != http.StatusOK || user.Email != "jane.smith@example.com" {
+		t.Errorf("Expected the email to change after a step-up, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
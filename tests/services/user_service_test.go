@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/user/user-management-service/config"
 	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
 	"github.com/user/user-management-service/internal/services"
 	"github.com/user/user-management-service/utils"
 )
@@ -16,57 +19,104 @@ type MockUserRepo struct {
 	users         map[uint]*models.User
 	emailToUserID map[string]uint
 	nextID        uint
+
+	// identities, if set, resolves identity filters, and groups group filters
+	identities *MockIdentityRepo
+	groups     *MockGroupRepo
+
+	foldEmailLocalPart bool
 }
 
 func NewMockUserRepo() *MockUserRepo {
 	return &MockUserRepo{
-		users:         make(map[uint]*models.User),
-		emailToUserID: make(map[string]uint),
-		nextID:        1,
+		users:              make(map[uint]*models.User),
+		emailToUserID:      make(map[string]uint),
+		nextID:             1,
+		foldEmailLocalPart: true,
 	}
 }
 
+// normalizeEmail normalizes emails the way the repository does
+func (m *MockUserRepo) normalizeEmail(email string) string {
+	return models.NormalizeEmail(email, m.foldEmailLocalPart)
+}
+
 func (m *MockUserRepo) Create(ctx context.Context, user *models.User) error {
 	// Check if email already exists
-	if _, exists := m.emailToUserID[user.Email]; exists {
+	if _, exists := m.emailToUserID[m.normalizeEmail(user.Email)]; exists {
 		return errors.New("email already exists")
 	}
 
 	user.ID = m.nextID
 	m.nextID++
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
 	m.users[user.ID] = user
-	m.emailToUserID[user.Email] = user.ID
+	m.emailToUserID[m.normalizeEmail(user.Email)] = user.ID
+	return nil
+}
+
+func (m *MockUserRepo) CreateWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) error {
+	if err := m.Create(ctx, user); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	if err := m.identities.Create(ctx, identity); err != nil {
+		delete(m.users, user.ID)
+		delete(m.emailToUserID, m.normalizeEmail(user.Email))
+		return err
+	}
 	return nil
 }
 
 func (m *MockUserRepo) FindByID(ctx context.Context, id uint) (*models.User, error) {
 	user, exists := m.users[id]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, repositories.ErrUserNotFound
 	}
 	return user, nil
 }
 
+func (m *MockUserRepo) FindByPublicID(ctx context.Context, publicID string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.PublicID == publicID {
+			return user, nil
+		}
+	}
+	return nil, repositories.ErrUserNotFound
+}
+
 func (m *MockUserRepo) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-	id, exists := m.emailToUserID[email]
+	id, exists := m.emailToUserID[m.normalizeEmail(email)]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, repositories.ErrUserNotFound
 	}
 	return m.users[id], nil
 }
 
+func (m *MockUserRepo) ExistsWithAttribute(ctx context.Context, name string, value interface{}, excludeID uint) (bool, error) {
+	for id, user := range m.users {
+		if id != excludeID && user.Attributes[name] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (m *MockUserRepo) Update(ctx context.Context, user *models.User) error {
 	if _, exists := m.users[user.ID]; !exists {
-		return errors.New("user not found")
+		return repositories.ErrUserNotFound
 	}
 
 	// If email changed, update the email map
-	oldEmail := m.users[user.ID].Email
-	if oldEmail != user.Email {
+	oldEmail := m.normalizeEmail(m.users[user.ID].Email)
+	if newEmail := m.normalizeEmail(user.Email); oldEmail != newEmail {
 		delete(m.emailToUserID, oldEmail)
-		m.emailToUserID[user.Email] = user.ID
+		m.emailToUserID[newEmail] = user.ID
 	}
 
+	user.UpdatedAt = time.Now()
 	m.users[user.ID] = user
 	return nil
 }
@@ -74,19 +124,20 @@ func (m *MockUserRepo) Update(ctx context.Context, user *models.User) error {
 func (m *MockUserRepo) Delete(ctx context.Context, id uint) error {
 	user, exists := m.users[id]
 	if !exists {
-		return errors.New("user not found")
+		return repositories.ErrUserNotFound
 	}
 
-	delete(m.emailToUserID, user.Email)
+	delete(m.emailToUserID, m.normalizeEmail(user.Email))
 	delete(m.users, id)
 	return nil
 }
 
-func (m *MockUserRepo) List(ctx context.Context, offset, limit int) ([]models.User, int64, error) {
-	// Convert map to slice
+func (m *MockUserRepo) List(ctx context.Context, filter repositories.UserFilter, offset, limit int) ([]models.User, int64, error) {
 	allUsers := make([]models.User, 0, len(m.users))
-	for _, user := range m.users {
-		allUsers = append(allUsers, *user)
+	for id := uint(1); id < m.nextID; id++ {
+		if user, exists := m.users[id]; exists && m.matches(user, filter) {
+			allUsers = append(allUsers, *user)
+		}
 	}
 
 	// Apply offset and limit
@@ -104,6 +155,90 @@ func (m *MockUserRepo) List(ctx context.Context, offset, limit int) ([]models.Us
 	return allUsers[start:end], total, nil
 }
 
+func (m *MockUserRepo) Stream(ctx context.Context, filter repositories.UserFilter, fn func(*models.User) error) error {
+	for id := uint(1); id < m.nextID; id++ {
+		user, exists := m.users[id]
+		if !exists || !m.matches(user, filter) {
+			continue
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches applies the filter criteria the mock supports
+func (m *MockUserRepo) matches(user *models.User, filter repositories.UserFilter) bool {
+	if filter.Role != "" && user.Role != filter.Role {
+		return false
+	}
+	if filter.Email != "" && m.normalizeEmail(filter.Email) != m.normalizeEmail(user.Email) {
+		return false
+	}
+	if filter.IdentityProvider != "" {
+		if m.identities == nil {
+			return false
+		}
+		identities, _ := m.identities.ListByUser(context.Background(), user.ID)
+		for _, identity := range identities {
+			if identity.Provider == filter.IdentityProvider && (filter.IdentitySubject == "" || identity.Subject == filter.IdentitySubject) {
+				return true
+			}
+		}
+		return false
+	}
+	if filter.Group != "" {
+		if m.groups == nil {
+			return false
+		}
+		group, err := m.groups.FindByPublicID(context.Background(), filter.Group)
+		if err != nil {
+			return false
+		}
+		groupIDs, _ := m.groups.DescendantIDs(context.Background(), group.ID)
+		for _, id := range groupIDs {
+			if m.groups.members[id][user.ID] != "" {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MockPasswordHistoryRepo is a mock implementation of the PasswordHistoryRepository interface
+type MockPasswordHistoryRepo struct {
+	entries map[uint][]models.PasswordHistory
+}
+
+func NewMockPasswordHistoryRepo() *MockPasswordHistoryRepo {
+	return &MockPasswordHistoryRepo{
+		entries: make(map[uint][]models.PasswordHistory),
+	}
+}
+
+func (m *MockPasswordHistoryRepo) Create(ctx context.Context, entry *models.PasswordHistory) error {
+	// Newest first
+	m.entries[entry.UserID] = append([]models.PasswordHistory{*entry}, m.entries[entry.UserID]...)
+	return nil
+}
+
+func (m *MockPasswordHistoryRepo) ListRecent(ctx context.Context, userID uint, limit int) ([]models.PasswordHistory, error) {
+	entries := m.entries[userID]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (m *MockPasswordHistoryRepo) Prune(ctx context.Context, userID uint, keep int) error {
+	if len(m.entries[userID]) > keep {
+		m.entries[userID] = m.entries[userID][:keep]
+	}
+	return nil
+}
+
 func TestUserService_Register(t *testing.T) {
 	// Setup
 	mockRepo := NewMockUserRepo()
@@ -112,11 +247,11 @@ func TestUserService_Register(t *testing.T) {
 	cfg.JWT.Expiry = 24
 	logger := utils.NewLogger("info")
 
-	userService := services.NewUserService(mockRepo, cfg, logger)
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
 	ctx := context.Background()
 
 	// Test register
-	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123")
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -126,10 +261,32 @@ func TestUserService_Register(t *testing.T) {
 	}
 
 	// Test duplicate email
-	_, err = userService.RegisterUser(ctx, "Another User", "test@example.com", "password456")
+	_, err = userService.RegisterUser(ctx, "Another User", "test@example.com", "password456", nil)
 	if err == nil {
 		t.Error("Expected error for duplicate email, got nil")
 	}
+
+	// Test duplicate email with different casing and whitespace
+	_, err = userService.RegisterUser(ctx, "Another User", " Test@EXAMPLE.com ", "password456", nil)
+	if err == nil {
+		t.Error("Expected error for duplicate email with different casing, got nil")
+	}
+
+	// Passwords that look like hashes are hashed like any other
+	hashLike, _ := utils.NewBcryptHasher(4).Hash("something-else")
+	user, err = userService.RegisterUser(ctx, "Hash User", "hash@example.com", hashLike, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Password == hashLike || user.ValidatePassword(hashLike) != nil {
+		t.Error("Expected the hash-like password to be hashed")
+	}
+
+	// Passwords that were not hashed are never saved
+	plain := &models.User{Name: "Plain", Email: "plain@example.com", Password: hashLike[:20]}
+	if err := plain.BeforeSave(); err == nil {
+		t.Error("Expected an unhashed password to be refused")
+	}
 }
 
 func TestUserService_Login(t *testing.T) {
@@ -140,28 +297,27 @@ func TestUserService_Login(t *testing.T) {
 	cfg.JWT.Expiry = 24
 	logger := utils.NewLogger("info")
 
-	userService := services.NewUserService(mockRepo, cfg, logger)
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
 	ctx := context.Background()
 
 	// Register a user for testing login
 	user := &models.User{
-		Name:     "Test User",
-		Email:    "test@example.com",
-		Password: "password123",
+		Name:  "Test User",
+		Email: "test@example.com",
 	}
 
 	// Hash the password
-	if err := user.BeforeSave(); err != nil {
+	if err := user.SetPassword("password123"); err != nil {
 		t.Fatalf("Failed to hash password: %v", err)
 	}
 
 	// Add user directly to mock repo
 	user.ID = 1
 	mockRepo.users[user.ID] = user
-	mockRepo.emailToUserID[user.Email] = user.ID
+	mockRepo.emailToUserID[mockRepo.normalizeEmail(user.Email)] = user.ID
 
 	// Test valid login
-	token, err := userService.Login(ctx, "test@example.com", "password123")
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -170,20 +326,74 @@ func TestUserService_Login(t *testing.T) {
 		t.Error("Expected token, got empty string")
 	}
 
+	// Test login with different email casing
+	if _, err := userService.Login(ctx, "TEST@Example.COM", "password123", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected case-insensitive email login, got %v", err)
+	}
+
 	// Test invalid login
-	_, err = userService.Login(ctx, "test@example.com", "wrongpassword")
+	_, err = userService.Login(ctx, "test@example.com", "wrongpassword", services.ClientInfo{})
 	if err == nil {
 		t.Error("Expected error for wrong password, got nil")
 	}
 }
 
+func TestUserService_Reauthenticate(t *testing.T) {
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.StepUp.TokenTTL = 10
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Login tokens record when and how the user authenticated
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	claims, _ := utils.ValidateToken(token, "test-secret")
+	if auth := claims.Authentication(); auth.Time.IsZero() || !auth.UsedAny(utils.AMRPassword) {
+		t.Errorf("Expected a password authentication, got %+v", auth)
+	}
+
+	if _, err := userService.Reauthenticate(ctx, user, claims.SessionID, "wrongpassword"); !errors.Is(err, services.ErrInvalidCurrentPassword) {
+		t.Errorf("Expected ErrInvalidCurrentPassword, got %v", err)
+	}
+
+	elevated, err := userService.Reauthenticate(ctx, user, claims.SessionID, "password123")
+	if err != nil {
+		t.Fatalf("Expected re-authentication to succeed, got %v", err)
+	}
+	elevatedClaims, err := utils.ValidateToken(elevated, "test-secret")
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if elevatedClaims.SessionID != claims.SessionID || elevatedClaims.Subject != user.PublicID {
+		t.Errorf("Expected a token for the same session, got %+v", elevatedClaims)
+	}
+	if ttl := elevatedClaims.ExpiresAt.Sub(elevatedClaims.IssuedAt.Time); ttl != 10*time.Minute {
+		t.Errorf("Expected a 10 minute token, got %v", ttl)
+	}
+	if !elevatedClaims.Authentication().UsedAny(utils.AMRPassword) || elevatedClaims.AuthTime.Before(claims.AuthTime.Time) {
+		t.Errorf("Expected a fresh password authentication, got %+v", elevatedClaims.Authentication())
+	}
+}
+
 func TestUserService_GetUserByID(t *testing.T) {
 	// Setup
 	mockRepo := NewMockUserRepo()
 	cfg := &config.Config{}
 	logger := utils.NewLogger("info")
 
-	userService := services.NewUserService(mockRepo, cfg, logger)
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
 	ctx := context.Background()
 
 	// Add a test user
@@ -211,3 +421,396 @@ func TestUserService_GetUserByID(t *testing.T) {
 		t.Error("Expected error for non-existent user, got nil")
 	}
 }
+
+func TestUserService_ExportUsers(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if _, err := userService.RegisterUser(ctx, "User", email, "password123", nil); err != nil {
+			t.Fatalf("Failed to register user: %v", err)
+		}
+	}
+	mockRepo.users[2].Role = models.RoleAdmin
+
+	// Test export of all users in ID order
+	var ids []uint
+	err := userService.ExportUsers(ctx, repositories.UserFilter{}, func(u *models.User) error {
+		ids = append(ids, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+		t.Errorf("Expected users [1 2 3], got %v", ids)
+	}
+
+	// Test export honours the filter
+	ids = nil
+	err = userService.ExportUsers(ctx, repositories.UserFilter{Role: models.RoleAdmin}, func(u *models.User) error {
+		ids = append(ids, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("Expected users [2], got %v", ids)
+	}
+
+	// Test callback errors abort the export
+	stopErr := errors.New("stop")
+	err = userService.ExportUsers(ctx, repositories.UserFilter{}, func(u *models.User) error {
+		return stopErr
+	})
+	if !errors.Is(err, stopErr) {
+		t.Errorf("Expected stop error, got %v", err)
+	}
+}
+
+func TestUserService_BootstrapAdmin(t *testing.T) {
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	if _, err := userService.BootstrapAdmin(ctx, "root@example.com"); !errors.Is(err, repositories.ErrUserNotFound) {
+		t.Fatalf("Expected an unregistered email to be reported, got %v", err)
+	}
+
+	user, _ := userService.RegisterUser(ctx, "Root", "root@example.com", "password123", nil)
+	admin, err := userService.BootstrapAdmin(ctx, " ROOT@example.com ")
+	if err != nil || admin == nil || admin.ID != user.ID || !mockRepo.users[user.ID].IsAdmin() {
+		t.Fatalf("Expected the user to become an admin, got %+v, %v", admin, err)
+	}
+
+	// Once there is an admin the bootstrap does nothing
+	other, _ := userService.RegisterUser(ctx, "Other", "other@example.com", "password123", nil)
+	if admin, err := userService.BootstrapAdmin(ctx, "other@example.com"); err != nil || admin != nil || mockRepo.users[other.ID].IsAdmin() {
+		t.Errorf("Expected no second admin, got %+v, %v", admin, err)
+	}
+}
+
+func TestUserService_LoginRehashesOutdatedPassword(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	// Store a user hashed with the default bcrypt hasher
+	user := &models.User{
+		Name:  "Test User",
+		Email: "test@example.com",
+	}
+	if err := user.SetPassword("password123"); err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	user.ID = 1
+	mockRepo.users[user.ID] = user
+	mockRepo.emailToUserID[mockRepo.normalizeEmail(user.Email)] = user.ID
+
+	// Switch to argon2id
+	hasher, err := utils.NewPasswordHasher(utils.HashAlgorithmArgon2id, 4, utils.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1})
+	if err != nil {
+		t.Fatalf("Failed to create hasher: %v", err)
+	}
+	models.SetPasswordHasher(hasher)
+	defer models.SetPasswordHasher(utils.NewBcryptHasher(10))
+
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if alg := utils.HashAlgorithm(mockRepo.users[1].Password); alg != utils.HashAlgorithmArgon2id {
+		t.Errorf("Expected password to be rehashed with argon2id, got %q", alg)
+	}
+
+	// The upgraded hash still authenticates
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected login with rehashed password to succeed, got %v", err)
+	}
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.PasswordPolicy.HistorySize = 2
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "first-pass", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Test wrong current password
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "wrong-pass", "second-pass"); !errors.Is(err, services.ErrInvalidCurrentPassword) {
+		t.Errorf("Expected ErrInvalidCurrentPassword, got %v", err)
+	}
+
+	// Test setting the same password
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "first-pass", "first-pass"); err == nil {
+		t.Error("Expected error for unchanged password, got nil")
+	}
+
+	// Test changing to new passwords
+	token, err := userService.ChangePassword(ctx, user.ID, "", "first-pass", "second-pass")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if token == "" {
+		t.Error("Expected token, got empty string")
+	}
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "second-pass", "third-pass"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// second-pass is still within the last 2 passwords
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "third-pass", "second-pass"); err == nil {
+		t.Error("Expected error for reusing a recent password, got nil")
+	}
+
+	// first-pass has dropped out of the history
+	if _, err := userService.ChangePassword(ctx, user.ID, "", "third-pass", "first-pass"); err != nil {
+		t.Errorf("Expected old password outside history to be allowed, got %v", err)
+	}
+}
+
+func TestUserService_ChangePasswordRevokesOldTokens(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	oldClaims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	oldClaims.IssuedAt.Time = oldClaims.IssuedAt.Add(-time.Minute)
+
+	authUser, err := userService.AuthenticateToken(ctx, oldClaims)
+	if err != nil {
+		t.Fatalf("Expected token to be valid before password change, got %v", err)
+	}
+	if authUser.ID != user.ID {
+		t.Errorf("Expected token subject to resolve to user %d, got %d", user.ID, authUser.ID)
+	}
+
+	newToken, err := userService.ChangePassword(ctx, user.ID, "", "password123", "new-password456")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := userService.AuthenticateToken(ctx, oldClaims); !errors.Is(err, services.ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+
+	newClaims, err := utils.ValidateToken(newToken, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate new token: %v", err)
+	}
+	if _, err := userService.AuthenticateToken(ctx, newClaims); err != nil {
+		t.Errorf("Expected new token to be valid, got %v", err)
+	}
+}
+
+func TestUserService_PublicID(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	parsed, err := uuid.Parse(user.PublicID)
+	if err != nil || parsed.Version() != 7 {
+		t.Fatalf("Expected UUIDv7 public ID, got %q", user.PublicID)
+	}
+
+	found, err := userService.GetUserByPublicID(ctx, user.PublicID)
+	if err != nil || found.ID != user.ID {
+		t.Errorf("Expected to find user by public ID, got %v", err)
+	}
+
+	// The token subject is the public ID, never the internal ID
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.Subject != user.PublicID {
+		t.Errorf("Expected subject %q, got %q", user.PublicID, claims.Subject)
+	}
+}
+
+func TestUserService_LoginWithExpiredPassword(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.PasswordPolicy.MaxAgeDays = 90
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Test fresh password logs in normally
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Age the password past the limit
+	changedAt := time.Now().Add(-91 * 24 * time.Hour)
+	mockRepo.users[user.ID].PasswordChangedAt = &changedAt
+
+	token, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	if !errors.Is(err, services.ErrPasswordExpired) {
+		t.Fatalf("Expected ErrPasswordExpired, got %v", err)
+	}
+
+	claims, err := utils.ValidateToken(token, cfg.JWT.Secret)
+	if err != nil {
+		t.Fatalf("Expected valid restricted token, got %v", err)
+	}
+	if claims.Scope != utils.ScopePasswordChange {
+		t.Errorf("Expected scope %q, got %q", utils.ScopePasswordChange, claims.Scope)
+	}
+
+	// Passwords set before change dates were recorded start aging at login
+	mockRepo.users[user.ID].PasswordChangedAt = nil
+	mockRepo.users[user.ID].CreatedAt = time.Now().Add(-365 * 24 * time.Hour)
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Fatalf("Expected an untracked password not to expire, got %v", err)
+	}
+	if changedAt := mockRepo.users[user.ID].PasswordChangedAt; changedAt == nil || time.Since(*changedAt) > time.Minute {
+		t.Errorf("Expected the password age to start at login, got %v", changedAt)
+	}
+}
+
+func TestUserService_Attributes(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	cfg := &config.Config{}
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	ctx := context.Background()
+
+	schema, err := services.NewAttributeSchema([]services.AttributeDefinition{
+		{Name: "department", Type: services.AttributeTypeString, Required: true, Visibility: services.VisibilityPublic},
+		{Name: "phone", Type: services.AttributeTypeString, Pattern: `^\+[0-9]{7,15}$`, Unique: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build schema: %v", err)
+	}
+	userService.AttributeSchema = schema
+
+	// Test missing required attribute and unknown attribute are both reported
+	_, err = userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", models.Attributes{"shoe_size": 42.0})
+	var validationErr *services.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Violations) != 2 {
+		t.Fatalf("Expected 2 attribute violations, got %v", err)
+	}
+
+	// Test valid attributes
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", models.Attributes{
+		"department": "Engineering",
+		"phone":      "+15551234567",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Test unique attribute
+	_, err = userService.RegisterUser(ctx, "Other User", "other@example.com", "password123", models.Attributes{
+		"department": "Sales",
+		"phone":      "+15551234567",
+	})
+	if err == nil {
+		t.Error("Expected error for duplicate unique attribute, got nil")
+	}
+
+	// Test merge on update, with nil removing an attribute
+	updated, err := userService.UpdateUser(ctx, user.ID, "", "", models.Attributes{"department": "Research", "phone": nil})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Attributes["department"] != "Research" {
+		t.Errorf("Expected department 'Research', got %v", updated.Attributes["department"])
+	}
+	if _, ok := updated.Attributes["phone"]; ok {
+		t.Error("Expected phone to be removed")
+	}
+
+	// Test invalid pattern
+	if _, err := userService.UpdateUser(ctx, user.ID, "", "", models.Attributes{"phone": "not-a-number"}); err == nil {
+		t.Error("Expected error for invalid phone format, got nil")
+	}
+
+	// Test visibility filtering
+	attrs := models.Attributes{"department": "Research", "phone": "+15551234567"}
+	if visible := schema.Visible(attrs, false); len(visible) != 1 || visible["department"] != "Research" {
+		t.Errorf("Expected only public attributes, got %v", visible)
+	}
+	if visible := schema.Visible(attrs, true); len(visible) != 2 {
+		t.Errorf("Expected all attributes, got %v", visible)
+	}
+
+	// Test filters are limited to public attributes for non-admins
+	filter := repositories.UserFilter{Attributes: map[string]string{"phone": "+15551234567"}}
+	if err := userService.ValidateAttributeFilter(filter, false); err == nil {
+		t.Error("Expected error filtering on private attribute, got nil")
+	}
+	if err := userService.ValidateAttributeFilter(filter, true); err != nil {
+		t.Errorf("Expected admin to filter on private attribute, got %v", err)
+	}
+}
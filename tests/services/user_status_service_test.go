@@ -0,0 +1,157 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockUserStatusRepo is a mock implementation of the UserStatusRepository interface
+type MockUserStatusRepo struct {
+	users       *MockUserRepo
+	transitions []models.UserStatusTransition
+}
+
+func (m *MockUserStatusRepo) ApplyTransition(ctx context.Context, user *models.User, transition *models.UserStatusTransition) error {
+	transition.UserID = user.ID
+	m.transitions = append([]models.UserStatusTransition{*transition}, m.transitions...)
+	user.Status = transition.ToStatus
+	user.StatusUntil = transition.Until
+	return nil
+}
+
+func (m *MockUserStatusRepo) ListTransitions(ctx context.Context, userID uint) ([]models.UserStatusTransition, error) {
+	var result []models.UserStatusTransition
+	for _, t := range m.transitions {
+		if t.UserID == userID {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockUserStatusRepo) FindDueReactivations(ctx context.Context, now time.Time) ([]models.User, error) {
+	var due []models.User
+	for _, user := range m.users.users {
+		if (user.Status == models.StatusSuspended || user.Status == models.StatusLocked) &&
+			user.StatusUntil != nil && !user.StatusUntil.After(now) {
+			due = append(due, *user)
+		}
+	}
+	return due, nil
+}
+
+func TestUserStatusService_SuspendAndReactivate(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	statusRepo := &MockUserStatusRepo{users: mockRepo}
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	statusService := services.NewUserStatusService(mockRepo, statusRepo, logger)
+	ctx := context.Background()
+
+	admin, err := userService.RegisterUser(ctx, "Admin", "admin@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register admin: %v", err)
+	}
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Test admins cannot change their own status
+	if _, err := statusService.Suspend(ctx, admin, admin.PublicID, "testing", nil); err == nil {
+		t.Error("Expected error suspending self, got nil")
+	}
+
+	// Test suspend
+	if _, err := statusService.Suspend(ctx, admin, user.PublicID, "abuse report", nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{})
+	var statusErr *services.AccountStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code() != "account_suspended" {
+		t.Fatalf("Expected account_suspended error, got %v", err)
+	}
+
+	// Test invalid transition
+	if _, err := statusService.Suspend(ctx, admin, user.PublicID, "again", nil); !errors.Is(err, services.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+
+	// Test reactivate
+	if _, err := statusService.Reactivate(ctx, admin, user.PublicID, "appeal accepted"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected login after reactivation, got %v", err)
+	}
+
+	// Test history records reason and actor
+	history, err := statusService.History(ctx, user.PublicID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(history) != 2 || history[1].Reason != "abuse report" || history[1].ActorID != admin.PublicID {
+		t.Errorf("Expected 2 transitions with reason and actor, got %+v", history)
+	}
+}
+
+func TestUserStatusService_AutomaticReactivation(t *testing.T) {
+	// Setup
+	mockRepo := NewMockUserRepo()
+	statusRepo := &MockUserStatusRepo{users: mockRepo}
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	logger := utils.NewLogger("info")
+
+	userService := services.NewUserService(mockRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	statusService := services.NewUserStatusService(mockRepo, statusRepo, logger)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Test User", "test@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Test past reactivation times are rejected
+	past := time.Now().Add(-time.Hour)
+	if _, err := statusService.Suspend(ctx, nil, user.PublicID, "cool down", &past); err == nil {
+		t.Error("Expected error for reactivation time in the past, got nil")
+	}
+
+	until := time.Now().Add(time.Hour)
+	if _, err := statusService.Suspend(ctx, nil, user.PublicID, "cool down", &until); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Simulate the suspension lapsing
+	lapsed := time.Now().Add(-time.Second)
+	mockRepo.users[user.ID].StatusUntil = &lapsed
+
+	// Login succeeds as soon as the suspension lapses
+	if _, err := userService.Login(ctx, "test@example.com", "password123", services.ClientInfo{}); err != nil {
+		t.Errorf("Expected login after suspension lapsed, got %v", err)
+	}
+
+	// The sweeper persists the reactivation
+	count, err := statusService.ReactivateDue(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 reactivation, got %d (%v)", count, err)
+	}
+	if statusRepo.transitions[0].ToStatus != models.StatusActive {
+		t.Errorf("Expected reactivation transition, got %+v", statusRepo.transitions[0])
+	}
+}
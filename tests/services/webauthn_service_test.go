@@ -0,0 +1,644 @@
+package services_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/config"
+	"github.com/user/user-management-service/internal/models"
+	"github.com/user/user-management-service/internal/repositories"
+	"github.com/user/user-management-service/internal/services"
+	"github.com/user/user-management-service/utils"
+)
+
+// MockWebAuthnRepo is a mock implementation of the WebAuthnRepository interface
+type MockWebAuthnRepo struct {
+	credentials map[uint]*models.WebAuthnCredential
+	challenges  map[string]*models.WebAuthnChallenge
+	nextID      uint
+}
+
+func NewMockWebAuthnRepo() *MockWebAuthnRepo {
+	return &MockWebAuthnRepo{
+		credentials: make(map[uint]*models.WebAuthnCredential),
+		challenges:  make(map[string]*models.WebAuthnChallenge),
+		nextID:      1,
+	}
+}
+
+func (m *MockWebAuthnRepo) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	credential.ID = m.nextID
+	m.nextID++
+	m.credentials[credential.ID] = credential
+	return nil
+}
+
+func (m *MockWebAuthnRepo) FindCredential(ctx context.Context, userID uint, publicID string) (*models.WebAuthnCredential, error) {
+	for _, credential := range m.credentials {
+		if credential.UserID == userID && credential.PublicID == publicID {
+			return credential, nil
+		}
+	}
+	return nil, repositories.ErrWebAuthnCredentialNotFound
+}
+
+func (m *MockWebAuthnRepo) FindCredentialByCredentialID(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	for _, credential := range m.credentials {
+		if credential.CredentialID == credentialID {
+			found := *credential
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrWebAuthnCredentialNotFound
+}
+
+func (m *MockWebAuthnRepo) ListCredentials(ctx context.Context, userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	for id := uint(1); id < m.nextID; id++ {
+		if credential, ok := m.credentials[id]; ok && credential.UserID == userID {
+			credentials = append(credentials, *credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *MockWebAuthnRepo) UpdateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	m.credentials[credential.ID] = credential
+	return nil
+}
+
+func (m *MockWebAuthnRepo) RecordCredentialUse(ctx context.Context, id uint, previousCount, signCount int64, backedUp bool, now time.Time) error {
+	credential, ok := m.credentials[id]
+	if !ok || credential.SignCount != previousCount {
+		return repositories.ErrWebAuthnCredentialNotFound
+	}
+	credential.SignCount = signCount
+	credential.BackedUp = backedUp
+	credential.LastUsedAt = &now
+	return nil
+}
+
+func (m *MockWebAuthnRepo) DeleteCredential(ctx context.Context, userID uint, publicID string) error {
+	credential, err := m.FindCredential(ctx, userID, publicID)
+	if err != nil {
+		return err
+	}
+	delete(m.credentials, credential.ID)
+	return nil
+}
+
+func (m *MockWebAuthnRepo) CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	m.challenges[challenge.PublicID] = challenge
+	return nil
+}
+
+func (m *MockWebAuthnRepo) ConsumeChallenge(ctx context.Context, publicID string, now time.Time) (*models.WebAuthnChallenge, error) {
+	challenge, ok := m.challenges[publicID]
+	if !ok || !now.Before(challenge.ExpiresAt) {
+		return nil, repositories.ErrWebAuthnChallengeNotFound
+	}
+	delete(m.challenges, publicID)
+	return challenge, nil
+}
+
+func (m *MockWebAuthnRepo) DeleteExpiredChallenges(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+	for id, challenge := range m.challenges {
+		if !now.Before(challenge.ExpiresAt) {
+			delete(m.challenges, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+const (
+	testRPID   = "id.example.com"
+	testOrigin = "https://id.example.com"
+)
+
+var testAAGUID = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+// softAuthenticator is a software WebAuthn authenticator with an ES256 credential
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+	verifyUser   bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate credential key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID, rpID: testRPID, origin: testOrigin, verifyUser: true}
+}
+
+// coseKey encodes the credential's public key
+func (a *softAuthenticator) coseKey(t *testing.T) []byte {
+	key, err := utils.EncodeCBOR(map[interface{}]interface{}{
+		1:  2,
+		3:  utils.COSEAlgES256,
+		-1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode COSE key: %v", err)
+	}
+	return key
+}
+
+// authData builds authenticator data, with the attested credential for registrations
+func (a *softAuthenticator) authData(t *testing.T, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(utils.WebAuthnFlagUserPresent | utils.WebAuthnFlagBackupEligible)
+	if a.verifyUser {
+		flags |= utils.WebAuthnFlagUserVerified
+	}
+	if attested {
+		flags |= utils.WebAuthnFlagAttestedCredential
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, testAAGUID...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey(t)...)
+	}
+	return data
+}
+
+// clientData builds the client data a browser at the authenticator's origin would send
+func (a *softAuthenticator) clientData(ceremonyType string, challenge []byte) []byte {
+	data, _ := json.Marshal(utils.CollectedClientData{
+		Type:      ceremonyType,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return data
+}
+
+// sign signs authenticator data and the client data hash with a key
+func sign(t *testing.T, key *ecdsa.PrivateKey, authData, clientData []byte) []byte {
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return signature
+}
+
+// attestation describes how the authenticator attests a new credential
+type attestation struct {
+	format string
+	key    *ecdsa.PrivateKey // signs packed attestations, the credential key when nil
+	cert   []byte            // x5c certificate of the attestation key
+}
+
+// register answers a registration ceremony
+func (a *softAuthenticator) register(t *testing.T, ceremony *services.WebAuthnCeremony, att attestation) services.WebAuthnRegistration {
+	options := ceremony.PublicKey.(*services.WebAuthnCreationOptions)
+	a.userHandle = options.User.ID
+
+	authData := a.authData(t, true)
+	clientData := a.clientData("webauthn.create", options.Challenge)
+
+	statement := map[interface{}]interface{}{}
+	if att.format == "packed" {
+		key := att.key
+		if key == nil {
+			key = a.key
+		}
+		statement["alg"] = utils.COSEAlgES256
+		statement["sig"] = sign(t, key, authData, clientData)
+		if att.cert != nil {
+			statement["x5c"] = []interface{}{att.cert}
+		}
+	}
+	object, err := utils.EncodeCBOR(map[interface{}]interface{}{
+		"fmt":      att.format,
+		"attStmt":  statement,
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode attestation object: %v", err)
+	}
+
+	return services.WebAuthnRegistration{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: services.WebAuthnAttestationResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: object,
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// assert answers a sign-in ceremony, counting the signature
+func (a *softAuthenticator) assert(t *testing.T, ceremony *services.WebAuthnCeremony) services.WebAuthnAssertion {
+	options := ceremony.PublicKey.(*services.WebAuthnRequestOptions)
+	a.signCount++
+
+	authData := a.authData(t, false)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	return services.WebAuthnAssertion{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  "public-key",
+		Response: services.WebAuthnAssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sign(t, a.key, authData, clientData),
+			UserHandle:        a.userHandle,
+		},
+	}
+}
+
+// newAttestationCertificate creates a self-signed packed attestation certificate for an AAGUID
+func newAttestationCertificate(t *testing.T, aaguid []byte) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate attestation key: %v", err)
+	}
+	extension, _ := asn1.Marshal(aaguid)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Test Vendor"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "Test Authenticator",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: extension},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create attestation certificate: %v", err)
+	}
+	return key, der
+}
+
+func newTestWebAuthnService(t *testing.T) (*services.WebAuthnService, *MockWebAuthnRepo, *services.UserService) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.Expiry = 24
+	cfg.WebAuthn.RPID = testRPID
+	cfg.WebAuthn.RPName = "Test"
+	cfg.WebAuthn.Origins = []string{testOrigin}
+	cfg.StepUp.TokenTTL = 10
+	logger := utils.NewLogger("info")
+
+	userRepo := NewMockUserRepo()
+	repo := NewMockWebAuthnRepo()
+	userService := services.NewUserService(userRepo, NewMockPasswordHistoryRepo(), services.NewSessionService(NewMockSessionRepo(), cfg, logger), nil, cfg, logger)
+	service := services.NewWebAuthnService(repo, userRepo, userService, cfg, logger)
+	userService.SecondFactor = service
+	return service, repo, userService
+}
+
+// registerPasskey registers a software authenticator for a user
+func registerPasskey(t *testing.T, service *services.WebAuthnService, user *models.User, authenticator *softAuthenticator, att attestation) (*models.WebAuthnCredential, error) {
+	ceremony, err := service.BeginRegistration(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+	return service.FinishRegistration(context.Background(), user, ceremony.CeremonyID, "", authenticator.register(t, ceremony, att))
+}
+
+// signInWithPasskey signs in without a password
+func signInWithPasskey(t *testing.T, service *services.WebAuthnService, authenticator *softAuthenticator) (string, error) {
+	ceremony, err := service.BeginLogin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin sign-in: %v", err)
+	}
+	return service.FinishLogin(context.Background(), ceremony.CeremonyID, authenticator.assert(t, ceremony), services.ClientInfo{})
+}
+
+func TestWebAuthnService_RegisterAndSignIn(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+
+	credential, err := registerPasskey(t, service, user, authenticator, attestation{format: "none"})
+	if err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+	if credential.Name != "Passkey" || credential.AttestationType != "none" || credential.AAGUID != "01020304-0506-0708-090a-0b0c0d0e0f10" ||
+		!credential.BackupEligible || len(credential.Transports) != 1 {
+		t.Errorf("Unexpected credential %+v", credential)
+	}
+
+	// The same authenticator cannot register the credential twice
+	if _, err := registerPasskey(t, service, user, authenticator, attestation{format: "none"}); !errors.Is(err, services.ErrWebAuthnCredentialExists) {
+		t.Errorf("Expected ErrWebAuthnCredentialExists, got %v", err)
+	}
+
+	token, err := signInWithPasskey(t, service, authenticator)
+	if err != nil {
+		t.Fatalf("Expected passwordless sign-in to succeed, got %v", err)
+	}
+	claims, err := utils.ValidateToken(token, "test-secret")
+	if err != nil || claims.Subject != user.PublicID {
+		t.Errorf("Expected a token for the user, got %+v, %v", claims, err)
+	}
+
+	// A ceremony is answered once
+	ceremony, _ := service.BeginLogin(ctx)
+	assertion := authenticator.assert(t, ceremony)
+	if _, err := service.FinishLogin(ctx, ceremony.CeremonyID, assertion, services.ClientInfo{}); err != nil {
+		t.Fatalf("Expected sign-in to succeed, got %v", err)
+	}
+	if _, err := service.FinishLogin(ctx, ceremony.CeremonyID, assertion, services.ClientInfo{}); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a replayed assertion to be rejected, got %v", err)
+	}
+
+	// A clone still at an older sign count is rejected
+	clone := *authenticator
+	clone.signCount = 1
+	if _, err := signInWithPasskey(t, service, &clone); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a cloned authenticator to be rejected, got %v", err)
+	}
+
+	// Passwordless sign-in requires user verification
+	authenticator.verifyUser = false
+	if _, err := signInWithPasskey(t, service, authenticator); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected sign-in without user verification to be rejected, got %v", err)
+	}
+}
+
+func TestWebAuthnService_PackedAttestation(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	credential, err := registerPasskey(t, service, user, newSoftAuthenticator(t), attestation{format: "packed"})
+	if err != nil || credential.AttestationType != "self" {
+		t.Fatalf("Expected self attestation, got %+v, %v", credential, err)
+	}
+
+	key, cert := newAttestationCertificate(t, testAAGUID)
+	credential, err = registerPasskey(t, service, user, newSoftAuthenticator(t), attestation{format: "packed", key: key, cert: cert})
+	if err != nil || credential.AttestationType != "basic" || credential.AttestationFormat != "packed" {
+		t.Fatalf("Expected basic attestation, got %+v, %v", credential, err)
+	}
+
+	// The certificate must vouch for the authenticator's model and sign the attestation
+	otherKey, otherCert := newAttestationCertificate(t, make([]byte, 16))
+	rejected := map[string]attestation{
+		"mismatched AAGUID": {format: "packed", key: otherKey, cert: otherCert},
+		"wrong signer":      {format: "packed", key: otherKey, cert: cert},
+		"unknown format":    {format: "fido-u2f"},
+	}
+	for name, att := range rejected {
+		if _, err := registerPasskey(t, service, user, newSoftAuthenticator(t), att); !errors.Is(err, services.ErrWebAuthnVerification) {
+			t.Errorf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+
+	credentials, _ := service.ListCredentials(ctx, user.ID)
+	if len(credentials) != 2 {
+		t.Errorf("Expected 2 credentials, got %d", len(credentials))
+	}
+}
+
+func TestWebAuthnService_RejectsMismatchedResponses(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, service, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	phished := *authenticator
+	phished.origin = "https://id.example.com.evil.test"
+	if _, err := signInWithPasskey(t, service, &phished); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a response from another origin to be rejected, got %v", err)
+	}
+
+	otherRP := *authenticator
+	otherRP.rpID = "example.org"
+	if _, err := signInWithPasskey(t, service, &otherRP); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a credential of another relying party to be rejected, got %v", err)
+	}
+
+	// A registration response cannot answer a sign-in ceremony
+	ceremony, _ := service.BeginLogin(ctx)
+	assertion := authenticator.assert(t, ceremony)
+	options := ceremony.PublicKey.(*services.WebAuthnRequestOptions)
+	assertion.Response.ClientDataJSON = authenticator.clientData("webauthn.create", options.Challenge)
+	if _, err := service.FinishLogin(ctx, ceremony.CeremonyID, assertion, services.ClientInfo{}); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a mismatched ceremony type to be rejected, got %v", err)
+	}
+
+	// Discoverable sign-in needs the user handle of the credential's owner
+	ceremony, _ = service.BeginLogin(ctx)
+	assertion = authenticator.assert(t, ceremony)
+	assertion.Response.UserHandle = []byte("someone-else")
+	if _, err := service.FinishLogin(ctx, ceremony.CeremonyID, assertion, services.ClientInfo{}); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a mismatched user handle to be rejected, got %v", err)
+	}
+}
+
+func TestWebAuthnService_SecondFactor(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if token, err := userService.Login(ctx, "jane@example.com", "password123", services.ClientInfo{}); err != nil || token == "" {
+		t.Fatalf("Expected login without a passkey to need no second factor, got %v", err)
+	}
+
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, service, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	_, err = userService.Login(ctx, "jane@example.com", "password123", services.ClientInfo{})
+	var secondFactorErr *services.SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+	options := secondFactorErr.Challenge.PublicKey.(*services.WebAuthnRequestOptions)
+	if len(options.AllowCredentials) != 1 || string(options.AllowCredentials[0].ID) != string(authenticator.credentialID) {
+		t.Errorf("Expected the user's credential to be allowed, got %+v", options.AllowCredentials)
+	}
+
+	// Another user's passkey cannot complete the login
+	other, _ := userService.ProvisionUser(ctx, "John Doe", "john@example.com", nil)
+	otherAuthenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, service, other, otherAuthenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+	if _, err := service.FinishLogin(ctx, secondFactorErr.Challenge.CeremonyID, otherAuthenticator.assert(t, secondFactorErr.Challenge), services.ClientInfo{}); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected another user's passkey to be rejected, got %v", err)
+	}
+
+	// A second factor does not need user verification
+	_, err = userService.Login(ctx, "jane@example.com", "password123", services.ClientInfo{})
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+	authenticator.verifyUser = false
+	token, err := service.FinishLogin(ctx, secondFactorErr.Challenge.CeremonyID, authenticator.assert(t, secondFactorErr.Challenge), services.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Expected the second factor to complete the login, got %v", err)
+	}
+	if claims, err := utils.ValidateToken(token, "test-secret"); err != nil || claims.Subject != user.PublicID {
+		t.Errorf("Expected a token for the user, got %+v, %v", claims, err)
+	}
+}
+
+func TestWebAuthnService_Reauthentication(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.RegisterUser(ctx, "Jane Doe", "jane@example.com", "password123", nil)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+	if _, err := service.BeginReauthentication(ctx, user); !errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		t.Errorf("Expected ErrWebAuthnCredentialNotFound without passkeys, got %v", err)
+	}
+
+	authenticator := newSoftAuthenticator(t)
+	if _, err := registerPasskey(t, service, user, authenticator, attestation{format: "none"}); err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	// Users with a passkey confirm their password with it
+	_, err = userService.Reauthenticate(ctx, user, "session-1", "password123")
+	var secondFactorErr *services.SecondFactorRequiredError
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+	ceremony := secondFactorErr.Challenge
+
+	// The ceremony cannot complete a login
+	if _, err := service.FinishLogin(ctx, ceremony.CeremonyID, authenticator.assert(t, ceremony), services.ClientInfo{}); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected a re-authentication ceremony to be rejected for sign-in, got %v", err)
+	}
+
+	_, err = userService.Reauthenticate(ctx, user, "session-1", "password123")
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+	ceremony = secondFactorErr.Challenge
+	other, _ := userService.ProvisionUser(ctx, "John Doe", "john@example.com", nil)
+	if _, err := service.FinishReauthentication(ctx, other, "session-2", ceremony.CeremonyID, authenticator.assert(t, ceremony)); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected another user's ceremony to be rejected, got %v", err)
+	}
+
+	_, err = userService.Reauthenticate(ctx, user, "session-1", "password123")
+	if !errors.As(err, &secondFactorErr) {
+		t.Fatalf("Expected SecondFactorRequiredError, got %v", err)
+	}
+	token, err := service.FinishReauthentication(ctx, user, "session-1", secondFactorErr.Challenge.CeremonyID, authenticator.assert(t, secondFactorErr.Challenge))
+	if err != nil {
+		t.Fatalf("Expected re-authentication to succeed, got %v", err)
+	}
+	claims, _ := utils.ValidateToken(token, "test-secret")
+	if claims.SessionID != "session-1" || !claims.Authentication().UsedAny(utils.AMRPassword) || !claims.Authentication().UsedAny(utils.AMRMultiFactor) {
+		t.Errorf("Expected a password and passkey authentication for the session, got %+v", claims)
+	}
+
+	// A passkey alone requires user verification
+	ceremony, err = service.BeginReauthentication(ctx, user)
+	if err != nil {
+		t.Fatalf("Failed to begin re-authentication: %v", err)
+	}
+	authenticator.verifyUser = false
+	if _, err := service.FinishReauthentication(ctx, user, "session-1", ceremony.CeremonyID, authenticator.assert(t, ceremony)); !errors.Is(err, services.ErrWebAuthnVerification) {
+		t.Errorf("Expected re-authentication without user verification to be rejected, got %v", err)
+	}
+	authenticator.verifyUser = true
+	ceremony, _ = service.BeginReauthentication(ctx, user)
+	token, err = service.FinishReauthentication(ctx, user, "session-1", ceremony.CeremonyID, authenticator.assert(t, ceremony))
+	if err != nil {
+		t.Fatalf("Expected re-authentication to succeed, got %v", err)
+	}
+	claims, _ = utils.ValidateToken(token, "test-secret")
+	if auth := claims.Authentication(); auth.UsedAny(utils.AMRPassword) || !auth.UsedAny(utils.AMRMultiFactor) {
+		t.Errorf("Expected a passkey authentication, got %+v", auth)
+	}
+}
+
+func TestWebAuthnService_ManageCredentials(t *testing.T) {
+	service, _, userService := newTestWebAuthnService(t)
+	ctx := context.Background()
+
+	user, err := userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	credential, err := registerPasskey(t, service, user, newSoftAuthenticator(t), attestation{format: "none"})
+	if err != nil {
+		t.Fatalf("Expected registration to succeed, got %v", err)
+	}
+
+	renamed, err := service.RenameCredential(ctx, user.ID, credential.PublicID, " Laptop ")
+	if err != nil || renamed.Name != "Laptop" {
+		t.Errorf("Expected the passkey to be renamed, got %+v, %v", renamed, err)
+	}
+	var validationErr *services.ValidationError
+	if _, err := service.RenameCredential(ctx, user.ID, credential.PublicID, " "); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a ValidationError for an empty name, got %v", err)
+	}
+
+	// Credentials of other users are not found
+	if err := service.DeleteCredential(ctx, user.ID+1, credential.PublicID); !errors.Is(err, repositories.ErrWebAuthnCredentialNotFound) {
+		t.Errorf("Expected ErrWebAuthnCredentialNotFound, got %v", err)
+	}
+	if err := service.DeleteCredential(ctx, user.ID, credential.PublicID); err != nil {
+		t.Fatalf("Expected the passkey to be deleted, got %v", err)
+	}
+	if credentials, _ := service.ListCredentials(ctx, user.ID); len(credentials) != 0 {
+		t.Errorf("Expected no credentials, got %d", len(credentials))
+	}
+}
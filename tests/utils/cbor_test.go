@@ -0,0 +1,66 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/user-management-service/utils"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	value := map[interface{}]interface{}{
+		int64(1):  int64(2),
+		int64(-1): int64(-300),
+		"fmt":     "none",
+		"sig":     []byte{0x01, 0x02},
+		"x5c":     []interface{}{[]byte{0xff}, "text"},
+	}
+
+	encoded, err := utils.EncodeCBOR(value)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, rest, err := utils.DecodeCBOR(append(encoded, 0xaa))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("Expected %v, got %v", value, decoded)
+	}
+	if !bytes.Equal(rest, []byte{0xaa}) {
+		t.Errorf("Expected the trailing byte to remain, got %x", rest)
+	}
+
+	// Keys are sorted canonically: shorter encodings first
+	again, _ := utils.EncodeCBOR(decoded)
+	if !bytes.Equal(encoded, again) {
+		t.Errorf("Expected a stable encoding, got %x and %x", encoded, again)
+	}
+}
+
+func TestDecodeCBOR_Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"truncated string", "636162"},
+		{"indefinite length", "9f01ff"},
+		{"duplicate keys", "a201020103"},
+		{"too deep", strings.Repeat("81", 20) + "01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatalf("Bad test data: %v", err)
+			}
+			if _, _, err := utils.DecodeCBOR(data); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
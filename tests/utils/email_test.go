@@ -0,0 +1,39 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/user/user-management-service/utils"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		foldLocal bool
+		expected  string
+	}{
+		{"trims and lowercases", "  Bob@Example.COM ", true, "bob@example.com"},
+		{"keeps local part case", "Bob@Example.COM", false, "Bob@example.com"},
+		{"converts IDN domain to punycode", "user@Bücher.example", true, "user@xn--bcher-kva.example"},
+		{"strips trailing dot", "user@example.com.", true, "user@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.NormalizeEmail(tt.email, tt.foldLocal)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "no-at-sign", "@example.com", "user@", "user@localhost", "us er@example.com"} {
+		if _, err := utils.NormalizeEmail(invalid, true); err == nil {
+			t.Errorf("Expected error for %q, got nil", invalid)
+		}
+	}
+}
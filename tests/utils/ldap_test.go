@@ -0,0 +1,90 @@
+package utils_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/user/user-management-service/utils"
+)
+
+func TestBERRoundTrip(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		element := utils.NewBERInteger(utils.BERTagInteger, n)
+		decoded, err := utils.DecodeBER(element.Encode())
+		if err != nil {
+			t.Fatalf("Failed to decode %d: %v", n, err)
+		}
+		if got, err := decoded.Int(); err != nil || got != n {
+			t.Errorf("Expected %d, got %d, %v", n, got, err)
+		}
+	}
+
+	// Long-form lengths and nested elements
+	long := strings.Repeat("x", 300)
+	sequence := utils.NewBERConstructed(utils.BERTagSequence,
+		utils.NewBERString(utils.BERTagOctetString, long),
+		utils.NewBERBoolean(utils.BERTagBoolean, true),
+	)
+	decoded, err := utils.ReadBERElement(bufio.NewReader(bytes.NewReader(sequence.Encode())))
+	if err != nil {
+		t.Fatalf("Failed to read sequence: %v", err)
+	}
+	if decoded.Tag != utils.BERTagSequence || decoded.Child(0).String() != long {
+		t.Errorf("Unexpected sequence %+v", decoded)
+	}
+	if b, err := decoded.Child(1).Bool(); err != nil || !b {
+		t.Errorf("Expected true, got %v, %v", b, err)
+	}
+
+	if _, err := utils.DecodeBER([]byte{0x04, 0x05, 'a'}); err == nil {
+		t.Error("Expected truncated element to be rejected")
+	}
+	if _, err := utils.ReadBERElement(bufio.NewReader(bytes.NewReader([]byte{0x30, 0x80}))); err == nil {
+		t.Error("Expected indefinite length to be rejected")
+	}
+}
+
+func TestCompileLDAPFilter(t *testing.T) {
+	filter, err := utils.CompileLDAPFilter(`(&(objectClass=person)(cn=J\2a*n*e)(!(mail=*))(userAccountControl:1.2.840.113556.1.4.803:=2))`)
+	if err != nil {
+		t.Fatalf("Expected filter to compile, got %v", err)
+	}
+	if filter.Tag != utils.LDAPFilterAnd || len(filter.Children) != 4 {
+		t.Fatalf("Unexpected filter %+v", filter)
+	}
+
+	equality := filter.Child(0)
+	if equality.Tag != utils.LDAPFilterEqualityMatch || equality.Child(0).String() != "objectClass" || equality.Child(1).String() != "person" {
+		t.Errorf("Unexpected equality match %+v", equality)
+	}
+
+	substrings := filter.Child(1).Child(1)
+	if filter.Child(1).Tag != utils.LDAPFilterSubstrings || len(substrings.Children) != 3 ||
+		substrings.Child(0).String() != "J*" || substrings.Child(1).String() != "n" || substrings.Child(2).String() != "e" {
+		t.Errorf("Unexpected substrings %+v", substrings)
+	}
+
+	present := filter.Child(2).Child(0)
+	if filter.Child(2).Tag != utils.LDAPFilterNot || present.Tag != utils.LDAPFilterPresent || present.String() != "mail" {
+		t.Errorf("Unexpected negated presence %+v", filter.Child(2))
+	}
+
+	extensible := filter.Child(3)
+	if extensible.Tag != utils.LDAPFilterExtensible || extensible.Child(0).String() != "1.2.840.113556.1.4.803" ||
+		extensible.Child(1).String() != "userAccountControl" || extensible.Child(2).String() != "2" {
+		t.Errorf("Unexpected extensible match %+v", extensible)
+	}
+
+	// The outer parentheses are optional
+	if filter, err := utils.CompileLDAPFilter("uid>=m"); err != nil || filter.Tag != utils.LDAPFilterGreaterOrEqual {
+		t.Errorf("Expected greater-or-equal filter, got %+v, %v", filter, err)
+	}
+
+	for _, invalid := range []string{"", "()", "(&)", "(cn=a", "(cn=a))", "(=a)", `(cn=a\2)`, `(cn=a\zz)`, "(cn>=a*)", "(&(cn=a)x)"} {
+		if _, err := utils.CompileLDAPFilter(invalid); err == nil {
+			t.Errorf("Expected filter %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/user/user-management-service/utils"
+)
+
+// fastArgon2Params keeps the tests quick
+var fastArgon2Params = utils.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idHasher_HashAndVerify(t *testing.T) {
+	hasher := utils.NewArgon2idHasher(fastArgon2Params)
+
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected PHC-format hash, got %s", hash)
+	}
+
+	ok, err := hasher.Verify(hash, "password123")
+	if err != nil || !ok {
+		t.Errorf("Expected password to verify, got ok=%v err=%v", ok, err)
+	}
+
+	ok, err = hasher.Verify(hash, "wrongpassword")
+	if err != nil || ok {
+		t.Errorf("Expected wrong password to fail, got ok=%v err=%v", ok, err)
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected hash with current parameters not to need rehash")
+	}
+
+	stronger := utils.NewArgon2idHasher(utils.Argon2Params{Memory: 2048, Iterations: 1, Parallelism: 1})
+	if !stronger.NeedsRehash(hash) {
+		t.Error("Expected hash with outdated parameters to need rehash")
+	}
+}
+
+func TestMultiHasher_VerifiesLegacyAlgorithms(t *testing.T) {
+	bcryptHash, err := utils.NewBcryptHasher(4).Hash("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	hasher, err := utils.NewPasswordHasher(utils.HashAlgorithmArgon2id, 4, fastArgon2Params)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ok, err := hasher.Verify(bcryptHash, "password123")
+	if err != nil || !ok {
+		t.Errorf("Expected bcrypt hash to verify, got ok=%v err=%v", ok, err)
+	}
+
+	if !hasher.NeedsRehash(bcryptHash) {
+		t.Error("Expected bcrypt hash to need rehash when argon2id is preferred")
+	}
+
+	if utils.HashAlgorithm(bcryptHash) != utils.HashAlgorithmBcrypt {
+		t.Errorf("Expected bcrypt algorithm, got %q", utils.HashAlgorithm(bcryptHash))
+	}
+
+	if utils.IsPasswordHash("password123") {
+		t.Error("Expected plain password not to be detected as a hash")
+	}
+
+	if _, err := utils.NewPasswordHasher("md5", 4, fastArgon2Params); err == nil {
+		t.Error("Expected error for unsupported algorithm, got nil")
+	}
+}
+
+func TestArgon2idHasher_RejectsZeroParameters(t *testing.T) {
+	for _, params := range []utils.Argon2Params{
+		{Memory: 1024, Iterations: 0, Parallelism: 1},
+		{Memory: 1024, Iterations: 1, Parallelism: 0},
+	} {
+		if _, err := utils.NewPasswordHasher(utils.HashAlgorithmArgon2id, 4, params); err == nil {
+			t.Errorf("Expected an error for %+v", params)
+		}
+		if _, err := utils.NewArgon2idHasher(params).Hash("password123"); err == nil {
+			t.Errorf("Expected hashing with %+v to fail", params)
+		}
+	}
+
+	// Stored hashes that would make Verify panic or match any password are refused
+	hasher := utils.NewArgon2idHasher(fastArgon2Params)
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		if ok, err := hasher.Verify(hash, "password123"); err == nil || ok {
+			t.Errorf("Expected %s to be rejected, got ok=%v err=%v", hash, ok, err)
+		}
+		if utils.IsPasswordHash(hash) {
+			t.Errorf("Expected %s not to be recognised as a hash", hash)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package utils_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/user/user-management-service/utils"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := utils.PKCEChallenge(verifier); got != challenge {
+		t.Errorf("Expected challenge %q, got %q", challenge, got)
+	}
+	if !utils.VerifyPKCE(verifier, challenge) {
+		t.Error("Expected verifier to match its challenge")
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+	}{
+		{"wrong verifier", strings.Repeat("a", 43)},
+		{"too short", "short"},
+		{"too long", strings.Repeat("a", 129)},
+		{"reserved characters", verifier[:42] + "+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if utils.VerifyPKCE(tt.verifier, challenge) {
+				t.Errorf("Expected %q to be rejected", tt.verifier)
+			}
+		})
+	}
+}
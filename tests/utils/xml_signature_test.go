@@ -0,0 +1,351 @@
+package utils_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/user-management-service/utils"
+)
+
+const (
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+)
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return key, cert
+}
+
+const testSignedDocument = `<r:Root xmlns:r="urn:root" xmlns:a="urn:a">
+  <a:Item ID="_item" z="2" a="1"><a:Issuer>issuer</a:Issuer>
+    <a:Value>alice &amp; bob</a:Value>
+  </a:Item>
+</r:Root>`
+
+// signAndSerialize signs the Item of the test document and returns the serialized document
+func signAndSerialize(t *testing.T, key *rsa.PrivateKey, cert *x509.Certificate) string {
+	signed, err := utils.SignXML([]byte(testSignedDocument), "_item", key, cert)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return string(signed)
+}
+
+func verifyItem(t *testing.T, document string, cert *x509.Certificate) (*utils.XMLElement, error) {
+	root, err := utils.ParseXML([]byte(document))
+	if err != nil {
+		t.Fatalf("Failed to parse signed document: %v", err)
+	}
+	return utils.VerifyXMLSignature(root.Child("urn:a", "Item"), []*x509.Certificate{cert}, time.Now())
+}
+
+// signedItem returns the signed Item element of a serialized test document
+func signedItem(t *testing.T, document string) string {
+	start := strings.Index(document, "<a:Item ")
+	end := strings.LastIndex(document, "</a:Item>")
+	if start < 0 || end < 0 {
+		t.Fatalf("No Item in %s", document)
+	}
+	return document[start : end+len("</a:Item>")]
+}
+
+func TestXMLSignature_SignAndVerify(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	signed := signAndSerialize(t, key, cert)
+
+	verified, err := verifyItem(t, signed, cert)
+	if err != nil {
+		t.Fatalf("Expected signature to verify, got %v", err)
+	}
+	if value := verified.Child("urn:a", "Value"); value == nil || value.Text() != "alice & bob" {
+		t.Errorf("Expected the verified item to carry its value, got %+v", value)
+	}
+	if verified.Child(utils.XMLDSigNamespace, "Signature") != nil {
+		t.Error("Expected the verified item without its signature")
+	}
+
+	_, otherCert := newTestCertificate(t)
+	if _, err := verifyItem(t, signed, otherCert); err == nil {
+		t.Error("Expected signature from another key to be rejected")
+	}
+
+	tampered := strings.Replace(signed, "alice", "mallory", 1)
+	if _, err := verifyItem(t, tampered, cert); err == nil {
+		t.Error("Expected tampered content to be rejected")
+	}
+
+	if _, err := verifyItem(t, testSignedDocument, cert); err != utils.ErrXMLSignatureMissing {
+		t.Errorf("Expected ErrXMLSignatureMissing, got %v", err)
+	}
+}
+
+func TestXMLSignature_RejectsSignatureWrapping(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	signed := signAndSerialize(t, key, cert)
+	item := signedItem(t, signed)
+	evil := strings.Replace(item, "alice", "mallory", 1)
+
+	tests := []struct {
+		name     string
+		document string
+	}{
+		// The signed item is kept, nested in one that is read in its place
+		{"signed item inside an unsigned one", strings.Replace(signed, item,
+			`<a:Item ID="_item"><a:Value>mallory</a:Value>`+item+`</a:Item>`, 1)},
+		// The signature is copied onto a forged item and the signed item
+		// hidden in the signature, where its digest would still match
+		{"signed item inside the copied signature", strings.Replace(signed, item,
+			strings.Replace(evil, "</ds:Signature>", "<ds:Object>"+item+"</ds:Object></ds:Signature>", 1), 1)},
+		// A forged item with the signed one's ID comes first in the document
+		{"forged item before the signed one", strings.Replace(signed, item, evil+item, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := verifyItem(t, tt.document, cert)
+			if err == nil {
+				t.Errorf("Expected the forged item to be rejected, verified %s", verified.Child("urn:a", "Value").Text())
+			}
+		})
+	}
+
+	// The signed item still verifies where a forged one follows it, and
+	// only what was signed is returned
+	verified, err := verifyItem(t, strings.Replace(signed, item, item+evil, 1), cert)
+	if err != nil {
+		t.Fatalf("Expected the signed item to verify, got %v", err)
+	}
+	if value := verified.Child("urn:a", "Value").Text(); value != "alice & bob" {
+		t.Errorf("Expected the signed value, got %q", value)
+	}
+}
+
+// The fixtures in testdata were signed by real identity providers, with the
+// certificates they were signed with: a Google Workspace response (from
+// crewjam/saml's test data) signed over the response, and an Okta response
+// (from goxmldsig's) with both the response and the assertion signed.
+
+func readFixture(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return string(data)
+}
+
+func readCertificate(t *testing.T, name string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(readFixture(t, name)))
+	if block == nil {
+		t.Fatalf("No certificate in %s", name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func verifyResponse(t *testing.T, document string, cert *x509.Certificate, now time.Time) (*utils.XMLElement, error) {
+	root, err := utils.ParseXML([]byte(document))
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return utils.VerifyXMLSignature(root, []*x509.Certificate{cert}, now)
+}
+
+// nameID reads the subject of the assertion in a verified response
+func nameID(response *utils.XMLElement) string {
+	assertion := response.Child(samlAssertionNamespace, "Assertion")
+	if assertion == nil || assertion.Child(samlAssertionNamespace, "Subject") == nil {
+		return ""
+	}
+	return assertion.Child(samlAssertionNamespace, "Subject").Child(samlAssertionNamespace, "NameID").Text()
+}
+
+func TestXMLSignature_GoogleResponse(t *testing.T) {
+	response := readFixture(t, "google_response.xml")
+	cert := readCertificate(t, "google_cert.pem")
+	issuedAt := time.Date(2016, 1, 5, 16, 55, 39, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		edit   func(string) string
+		now    time.Time
+		nameID string // empty if the response must be rejected
+	}{
+		{"as received", func(s string) string { return s }, issuedAt, "ross@octolabs.io"},
+		// Comments are not signed, and are not read either
+		{"comment inside the subject", func(s string) string {
+			return strings.Replace(s, "ross@octolabs.io", "ross@<!-- and a comment -->octolabs.io", 1)
+		}, issuedAt, "ross@octolabs.io"},
+		// CVE-2018-7340: the text before a comment must not be read as the whole value
+		{"comment truncating the subject", func(s string) string {
+			return strings.Replace(s, "ross@octolabs.io", "ross@octolabs.io<!-- and a comment -->.example.com", 1)
+		}, issuedAt, ""},
+		// Markup is canonicalized, content is not
+		{"reformatted tags", func(s string) string {
+			s = strings.Replace(s, `Version="2.0">`, "Version='2.0'\n  >", 1)
+			return strings.Replace(s, "<saml2p:StatusCode ", "<saml2p:StatusCode    ", 1)
+		}, issuedAt, "ross@octolabs.io"},
+		{"indented content", func(s string) string {
+			return strings.Replace(s, "<saml2p:Status>", "\n  <saml2p:Status>", 1)
+		}, issuedAt, ""},
+		{"expired certificate", func(s string) string { return s }, cert.NotAfter.Add(time.Hour), ""},
+		{"weak signature algorithm", func(s string) string {
+			return strings.Replace(s, "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256", "http://www.w3.org/2000/09/xmldsig#rsa-sha1", 1)
+		}, issuedAt, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := verifyResponse(t, tt.edit(response), cert, tt.now)
+			if tt.nameID == "" {
+				if err == nil {
+					t.Errorf("Expected the response to be rejected, read %q", nameID(verified))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the response to verify, got %v", err)
+			}
+			if got := nameID(verified); got != tt.nameID {
+				t.Errorf("Expected subject %q, got %q", tt.nameID, got)
+			}
+		})
+	}
+}
+
+func TestXMLSignature_OktaResponse(t *testing.T) {
+	response := readFixture(t, "okta_response.xml")
+	cert := readCertificate(t, "okta_cert.pem")
+	issuedAt := time.Date(2016, 3, 22, 19, 22, 57, 0, time.UTC)
+
+	// verifyBoth checks the response and then the assertion inside what it signed
+	verifyBoth := func(t *testing.T, document string) (string, error) {
+		verified, err := verifyResponse(t, document, cert, issuedAt)
+		if err != nil {
+			return "", err
+		}
+		assertion := verified.Child(samlAssertionNamespace, "Assertion")
+		if assertion == nil {
+			t.Fatal("Verified response has no assertion")
+		}
+		if _, err := utils.VerifyXMLSignature(assertion, []*x509.Certificate{cert}, issuedAt); err != nil {
+			return "", err
+		}
+		return nameID(verified), nil
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(string) string
+		nameID string
+	}{
+		{"as received", func(s string) string { return s }, "phoebe.simon@scaleft.com"},
+		// Exclusive canonicalization leaves out declarations nothing uses
+		{"unused namespace declared", func(s string) string {
+			return strings.Replace(s, "<saml2:Assertion ", `<saml2:Assertion xmlns:unused="urn:unused" `, 1)
+		}, "phoebe.simon@scaleft.com"},
+		// Prefixes are part of the canonical form
+		{"assertion prefix renamed", func(s string) string {
+			s = strings.ReplaceAll(s, "saml2:", "assertion:")
+			return strings.ReplaceAll(s, "xmlns:saml2=", "xmlns:assertion=")
+		}, ""},
+		// The signatures name xs as an inclusive namespace, so its
+		// declaration is signed even though no element uses it
+		{"inclusive namespace removed", func(s string) string {
+			return strings.Replace(s, ` xmlns:xs="http://www.w3.org/2001/XMLSchema"`, "", 1)
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyBoth(t, tt.edit(response))
+			if tt.nameID == "" {
+				if err == nil {
+					t.Errorf("Expected the response to be rejected, read %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the response to verify, got %v", err)
+			}
+			if got != tt.nameID {
+				t.Errorf("Expected subject %q, got %q", tt.nameID, got)
+			}
+		})
+	}
+
+	// The Okta assertion also verifies on its own, reading the namespaces it
+	// inherits from the response
+	root, err := utils.ParseXML([]byte(response))
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if root.Space != samlProtocolNamespace {
+		t.Fatalf("Expected a SAML response, got %s", root.Space)
+	}
+	if _, err := utils.VerifyXMLSignature(root.Child(samlAssertionNamespace, "Assertion"), []*x509.Certificate{cert}, issuedAt); err != nil {
+		t.Errorf("Expected the assertion to verify, got %v", err)
+	}
+	_, otherCert := newTestCertificate(t)
+	if _, err := utils.VerifyXMLSignature(root, []*x509.Certificate{otherCert, cert}, issuedAt); err != nil {
+		t.Errorf("Expected the response to verify against the second certificate, got %v", err)
+	}
+	if _, err := utils.VerifyXMLSignature(root, []*x509.Certificate{otherCert}, issuedAt); err == nil || errors.Is(err, utils.ErrXMLSignatureMissing) {
+		t.Errorf("Expected an untrusted certificate to be rejected, got %v", err)
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	root, err := utils.ParseXML([]byte(`<?xml version="1.0"?>
+<r:Root xmlns:r="urn:root"><r:Child a="1">alice<!-- comment --> &amp; bob<Plain xmlns="urn:d"/></r:Child></r:Root>`))
+	if err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+	child := root.Child("urn:root", "Child")
+	if child == nil || child.Attr("a") != "1" || child.Text() != "alice & bob" {
+		t.Errorf("Expected the child with its attribute and text, got %+v", child)
+	}
+	if child.Child("urn:d", "Plain") == nil {
+		t.Error("Expected the default namespace to be resolved")
+	}
+
+	if _, err := utils.ParseXML([]byte(`<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`)); err == nil {
+		t.Error("Expected a document with a DTD to be rejected")
+	}
+	if _, err := utils.ParseXML([]byte(`<p:r/>`)); err == nil {
+		t.Error("Expected an undeclared prefix to be rejected")
+	}
+	if _, err := utils.ParseXML([]byte(`<r/><r/>`)); err == nil {
+		t.Error("Expected a second root element to be rejected")
+	}
+}
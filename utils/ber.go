@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifier octet classes and the constructed flag. Tag numbers above 30
+// use a multi-octet identifier, which LDAP never needs and is not supported.
+const (
+	BERClassUniversal   byte = 0x00
+	BERClassApplication byte = 0x40
+	BERClassContext     byte = 0x80
+	BERConstructed      byte = 0x20
+)
+
+// BER universal tags
+const (
+	BERTagBoolean     byte = 0x01
+	BERTagInteger     byte = 0x02
+	BERTagOctetString byte = 0x04
+	BERTagNull        byte = 0x05
+	BERTagEnumerated  byte = 0x0a
+	BERTagSequence         = 0x10 | BERConstructed
+	BERTagSet              = 0x11 | BERConstructed
+)
+
+// berMaxLength bounds the length of a decoded element, so a corrupt or
+// hostile peer cannot make the reader allocate without limit
+const berMaxLength = 16 << 20
+
+// BERElement is a decoded or to-be-encoded BER element. Tag is the whole
+// identifier octet. Primitive elements carry Value, constructed ones Children.
+type BERElement struct {
+	Tag      byte
+	Value    []byte
+	Children []*BERElement
+}
+
+// NewBERPrimitive creates a primitive element
+func NewBERPrimitive(tag byte, value []byte) *BERElement {
+	return &BERElement{Tag: tag, Value: value}
+}
+
+// NewBERString creates an octet string element, or one with another tag
+func NewBERString(tag byte, value string) *BERElement {
+	return &BERElement{Tag: tag, Value: []byte(value)}
+}
+
+// NewBERInteger creates an integer or enumerated element
+func NewBERInteger(tag byte, n int64) *BERElement {
+	// Two's complement, big-endian, minimal length
+	value := []byte{byte(n)}
+	for n >= 0x80 || n < -0x80 {
+		n >>= 8
+		value = append([]byte{byte(n)}, value...)
+	}
+	return &BERElement{Tag: tag, Value: value}
+}
+
+// NewBERBoolean creates a boolean element
+func NewBERBoolean(tag byte, b bool) *BERElement {
+	if b {
+		return &BERElement{Tag: tag, Value: []byte{0xff}}
+	}
+	return &BERElement{Tag: tag, Value: []byte{0x00}}
+}
+
+// NewBERConstructed creates a constructed element such as a sequence
+func NewBERConstructed(tag byte, children ...*BERElement) *BERElement {
+	return &BERElement{Tag: tag | BERConstructed, Children: children}
+}
+
+// IsConstructed reports whether the element holds child elements
+func (e *BERElement) IsConstructed() bool {
+	return e.Tag&BERConstructed != 0
+}
+
+// Append adds children to a constructed element
+func (e *BERElement) Append(children ...*BERElement) *BERElement {
+	e.Children = append(e.Children, children...)
+	return e
+}
+
+// Child returns the i-th child, or nil if there is none
+func (e *BERElement) Child(i int) *BERElement {
+	if e == nil || i < 0 || i >= len(e.Children) {
+		return nil
+	}
+	return e.Children[i]
+}
+
+// String returns the value of a primitive element as a string
+func (e *BERElement) String() string {
+	if e == nil {
+		return ""
+	}
+	return string(e.Value)
+}
+
+// Int returns the value of an integer or enumerated element
+func (e *BERElement) Int() (int64, error) {
+	if e == nil || e.IsConstructed() || len(e.Value) == 0 || len(e.Value) > 8 {
+		return 0, errors.New("invalid BER integer")
+	}
+	n := int64(int8(e.Value[0]))
+	for _, b := range e.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// Bool returns the value of a boolean element
+func (e *BERElement) Bool() (bool, error) {
+	if e == nil || e.IsConstructed() || len(e.Value) != 1 {
+		return false, errors.New("invalid BER boolean")
+	}
+	return e.Value[0] != 0, nil
+}
+
+// Encode encodes the element with definite lengths
+func (e *BERElement) Encode() []byte {
+	content := e.Value
+	if e.IsConstructed() {
+		content = nil
+		for _, child := range e.Children {
+			content = append(content, child.Encode()...)
+		}
+	}
+
+	encoded := []byte{e.Tag}
+	switch n := len(content); {
+	case n < 0x80:
+		encoded = append(encoded, byte(n))
+	default:
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		encoded = append(encoded, 0x80|byte(len(length)))
+		encoded = append(encoded, length...)
+	}
+	return append(encoded, content...)
+}
+
+// ReadBERElement reads one element from a stream
+func ReadBERElement(r *bufio.Reader) (*BERElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("unsupported BER tag number")
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		octets := int(first & 0x7f)
+		if octets == 0 {
+			return nil, errors.New("indefinite BER lengths are not supported")
+		}
+		if octets > 4 {
+			return nil, errors.New("BER length too long")
+		}
+		length = 0
+		for i := 0; i < octets; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > berMaxLength {
+		return nil, fmt.Errorf("BER element of %d bytes is too large", length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return decodeBERContent(tag, content)
+}
+
+// DecodeBER decodes a single element that must span all of data
+func DecodeBER(data []byte) (*BERElement, error) {
+	elements, err := decodeBERElements(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) != 1 {
+		return nil, errors.New("expected exactly one BER element")
+	}
+	return elements[0], nil
+}
+
+// decodeBERElements decodes the consecutive elements of a constructed element's content
+func decodeBERElements(data []byte) ([]*BERElement, error) {
+	var elements []*BERElement
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("truncated BER element")
+		}
+		tag, length, header := data[0], int(data[1]), 2
+		if tag&0x1f == 0x1f {
+			return nil, errors.New("unsupported BER tag number")
+		}
+		if length&0x80 != 0 {
+			octets := length & 0x7f
+			if octets == 0 || octets > 4 || len(data) < 2+octets {
+				return nil, errors.New("invalid BER length")
+			}
+			length = 0
+			for _, b := range data[2 : 2+octets] {
+				length = length<<8 | int(b)
+			}
+			header += octets
+		}
+		if length > len(data)-header {
+			return nil, errors.New("truncated BER element")
+		}
+
+		element, err := decodeBERContent(tag, data[header:header+length])
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		data = data[header+length:]
+	}
+	return elements, nil
+}
+
+// decodeBERContent builds an element from its identifier and content octets
+func decodeBERContent(tag byte, content []byte) (*BERElement, error) {
+	element := &BERElement{Tag: tag}
+	if element.IsConstructed() {
+		children, err := decodeBERElements(content)
+		if err != nil {
+			return nil, err
+		}
+		element.Children = children
+		return element, nil
+	}
+	element.Value = content
+	return element, nil
+}
+
+// unexpectedEOF reports an element cut short by the end of the stream
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+)
+
+// cborMaxDepth limits the nesting of decoded items
+const cborMaxDepth = 16
+
+// DecodeCBOR decodes the CBOR data item at the start of data and returns it
+// with the bytes that follow it. Integers decode to int64, byte strings to
+// []byte, text to string, arrays to []interface{} and maps, whose keys must be
+// integers or text, to map[interface{}]interface{}. Tags are dropped, and
+// indefinite lengths are rejected as WebAuthn only uses definite ones.
+func DecodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBOR(data, 0)
+}
+
+func decodeCBOR(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("cbor: unexpected end of data")
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == cborSimple {
+		return decodeCBORSimple(info, data)
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		for _, b := range data[:size] {
+			arg = arg<<8 | uint64(b)
+		}
+		data = data[size:]
+	case info == 31:
+		return nil, nil, errors.New("cbor: indefinite lengths are not supported")
+	default:
+		return nil, nil, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflows int64")
+		}
+		return int64(arg), data, nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflows int64")
+		}
+		return -1 - int64(arg), data, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(data)) {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		value, rest := data[:arg], data[arg:]
+		if major == cborBytes {
+			return append([]byte(nil), value...), rest, nil
+		}
+		if !utf8.Valid(value) {
+			return nil, nil, errors.New("cbor: text is not UTF-8")
+		}
+		return string(value), rest, nil
+	case cborArray:
+		// Every item takes at least one byte
+		if arg > uint64(len(data)) {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, rest, err := decodeCBOR(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+			data = rest
+		}
+		return items, data, nil
+	case cborMap:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := decodeCBOR(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("cbor: map keys must be integers or text")
+			}
+			if _, ok := items[key]; ok {
+				return nil, nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			value, rest, err := decodeCBOR(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+			data = rest
+		}
+		return items, data, nil
+	default: // cborTag
+		return decodeCBOR(data, depth+1)
+	}
+}
+
+// decodeCBORSimple decodes booleans, null, undefined and floats
+func decodeCBORSimple(info byte, data []byte) (interface{}, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		return nil, data, nil
+	case 25:
+		if len(data) < 2 {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		return halfToFloat(binary.BigEndian.Uint16(data)), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exponent, mantissa := int(h>>10&0x1f), float64(h&0x3ff)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		value = math.Inf(1)
+		if mantissa != 0 {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if h&0x8000 != 0 {
+		value = -value
+	}
+	return value
+}
+
+// EncodeCBOR encodes a value in canonical CBOR, with map keys sorted as
+// CTAP2 requires. It supports integers, []byte, string, bool, nil,
+// []interface{}, map[interface{}]interface{} and map[string]interface{}.
+func EncodeCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buf.WriteByte(cborSimple<<5 | 20)
+		}
+	case int:
+		encodeCBORInt(buf, int64(v))
+	case int64:
+		encodeCBORInt(buf, v)
+	case uint64:
+		encodeCBORHead(buf, cborUnsigned, v)
+	case []byte:
+		encodeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		encodeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		encodeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		items := make(map[interface{}]interface{}, len(v))
+		for key, value := range v {
+			items[key] = value
+		}
+		return encodeCBOR(buf, items)
+	case map[interface{}]interface{}:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, len(v))
+		for key, value := range v {
+			encodedKey, err := EncodeCBOR(key)
+			if err != nil {
+				return err
+			}
+			encodedValue, err := EncodeCBOR(value)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{encodedKey, encodedValue})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].key, entries[j].key
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+		encodeCBORHead(buf, cborMap, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			buf.Write(e.value)
+		}
+	default:
+		return fmt.Errorf("cbor: cannot encode %T", v)
+	}
+	return nil
+}
+
+// encodeCBORInt encodes a signed integer
+func encodeCBORInt(buf *bytes.Buffer, n int64) {
+	if n >= 0 {
+		encodeCBORHead(buf, cborUnsigned, uint64(n))
+	} else {
+		encodeCBORHead(buf, cborNegative, uint64(-1-n))
+	}
+}
+
+// encodeCBORHead encodes a major type with its argument in the shortest form
+func encodeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalidEmail is returned when an email address cannot be normalized
+var ErrInvalidEmail = errors.New("invalid email format")
+
+// NormalizeEmail returns the canonical form of an email address used for
+// identity comparisons: surrounding whitespace is trimmed, the local part is
+// NFC-normalized and optionally lowercased, and the domain is converted to
+// lowercase ASCII (punycode for internationalized domains)
+func NormalizeEmail(email string, foldLocalPart bool) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local, domain := email[:at], strings.TrimSuffix(email[at+1:], ".")
+	if strings.ContainsAny(local, " \t\r\n") {
+		return "", ErrInvalidEmail
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || asciiDomain == "" || !strings.Contains(asciiDomain, ".") {
+		return "", ErrInvalidEmail
+	}
+
+	local = norm.NFC.String(local)
+	if foldLocalPart {
+		local = strings.ToLower(local)
+	}
+
+	return local + "@" + strings.ToLower(asciiDomain), nil
+}
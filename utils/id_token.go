@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKeyBits is the size of generated RSA signing keys
+const signingKeyBits = 2048
+
+// SigningKey is the RSA key ID tokens are signed with. Unlike access tokens,
+// ID tokens are verified by relying parties, so they use a key pair whose
+// public half is published as a JWK.
+type SigningKey struct {
+	ID      string
+	Private *rsa.PrivateKey
+}
+
+// JWK is a JSON Web Key describing the public half of a signing key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// GenerateSigningKey generates a new RSA signing key
+func GenerateSigningKey() (*SigningKey, error) {
+	private, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(private)
+}
+
+// LoadSigningKey loads an RSA signing key from a PEM file in PKCS#1 or PKCS#8 form
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var private *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var key interface{}
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+			var ok bool
+			if private, ok = key.(*rsa.PrivateKey); !ok {
+				err = errors.New("not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return newSigningKey(private)
+}
+
+// newSigningKey derives the key ID from the public key, so it changes whenever the key does
+func newSigningKey(private *rsa.PrivateKey) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &SigningKey{ID: base64.RawURLEncoding.EncodeToString(sum[:12]), Private: private}, nil
+}
+
+// JWK returns the public key as a JWK
+func (k *SigningKey) JWK() JWK {
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     k.ID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(k.Private.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.Private.E)).Bytes()),
+	}
+}
+
+// PublicKey decodes an RSA JWK, such as one published by an external identity provider
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.KeyType != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// IDTokenClaims represents the claims in an OpenID Connect ID token.
+// Profile and email claims are only present when their scopes were granted.
+type IDTokenClaims struct {
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	Name          string           `json:"name,omitempty"`
+	UpdatedAt     int64            `json:"updated_at,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken signs an ID token for the subject, issued by issuer to the client
+func GenerateIDToken(claims IDTokenClaims, issuer, subject, clientID string, key *SigningKey, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{clientID},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// ParseIDTokenHint verifies the signature and issuer of an ID token passed
+// back as a hint. Expired tokens are accepted, since relying parties commonly
+// send the hint long after the token expired.
+func ParseIDTokenHint(tokenString, issuer string, key *SigningKey) (*IDTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &IDTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return &key.Private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*IDTokenClaims)
+	if !ok || claims.Issuer != issuer || claims.Subject == "" || len(claims.Audience) == 0 {
+		return nil, errors.New("invalid ID token")
+	}
+	return claims, nil
+}
@@ -3,25 +3,166 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// JWTClaims represents the claims in JWT token
+// ScopePasswordChange restricts a token to changing an expired password
+const ScopePasswordChange = "password_change"
+
+// Authentication methods of the amr claim, as registered by RFC 8176
+const (
+	AMRPassword    = "pwd"
+	AMRHardwareKey = "hwk" // a passkey or security key
+	AMRMultiFactor = "mfa"
+	AMROneTimeCode = "otp" // a single-use code or link sent to the user
+	AMRFederated   = "fed" // an external identity provider
+)
+
+// Authentication describes when and how a user proved their identity
+type Authentication struct {
+	Time    time.Time
+	Methods []string
+}
+
+// NewAuthentication returns an authentication by methods that happened now
+func NewAuthentication(methods ...string) Authentication {
+	return Authentication{Time: time.Now(), Methods: methods}
+}
+
+// UsedAny reports whether any of methods was used
+func (a Authentication) UsedAny(methods ...string) bool {
+	for _, used := range a.Methods {
+		for _, method := range methods {
+			if used == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GroupClaims lists the public IDs of the groups a user belongs to in their
+// token. Users in more groups than a token holds get Overflow set instead.
+type GroupClaims struct {
+	IDs      []string
+	Overflow bool
+}
+
+// NewGroupClaims returns claims listing ids, or flagging the overflow when
+// there are more than limit
+func NewGroupClaims(ids []string, limit int) GroupClaims {
+	if len(ids) > limit {
+		return GroupClaims{Overflow: true}
+	}
+	return GroupClaims{IDs: ids}
+}
+
+// JWTClaims represents the claims in JWT token.
+// For user tokens the subject is the user's public ID and SessionID the public
+// ID of the login session the token belongs to. For client credentials tokens
+// the subject and ClientID are the client's ID, and for tokens a client holds
+// on a user's behalf the subject is the user and ClientID the client. Scope
+// lists the scopes granted to client tokens. User tokens record when and how
+// the user last authenticated in AuthTime and AMR. Impersonation tokens name
+// the admin acting as the subject in Act, and their ID is the impersonation's.
+// Login tokens list the user's groups in Groups, or set GroupsOverflow when
+// they are in too many to list.
 type JWTClaims struct {
-	UserID uint `json:"user_id"`
+	Scope          string           `json:"scope,omitempty"`
+	SessionID      string           `json:"sid,omitempty"`
+	ClientID       string           `json:"client_id,omitempty"`
+	AuthTime       *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR            []string         `json:"amr,omitempty"`
+	Act            *Actor           `json:"act,omitempty"`
+	Groups         []string         `json:"groups,omitempty"`
+	GroupsOverflow bool             `json:"groups_overflow,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID uint, secret string, expiry int) (string, error) {
-	claims := JWTClaims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(expiry))),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// Actor identifies who acts as the subject of a token, as in RFC 8693
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Scopes returns the space-separated scope claim as a list
+func (c *JWTClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Authentication returns when and how the user authenticated, with a zero
+// time for tokens that do not record it
+func (c *JWTClaims) Authentication() Authentication {
+	if c.AuthTime == nil {
+		return Authentication{Methods: c.AMR}
+	}
+	return Authentication{Time: c.AuthTime.Time, Methods: c.AMR}
+}
+
+// IsImpersonation reports whether the token lets an admin act as the subject
+func (c *JWTClaims) IsImpersonation() bool {
+	return c.Act != nil
+}
+
+// IsClientToken reports whether the token was issued to a client rather than a user
+func (c *JWTClaims) IsClientToken() bool {
+	return c.ClientID != "" && c.ClientID == c.Subject
+}
+
+// IsDelegatedToken reports whether the token was issued to a client acting for a user
+func (c *JWTClaims) IsDelegatedToken() bool {
+	return c.ClientID != "" && c.ClientID != c.Subject
+}
+
+// GenerateToken generates a new JWT token for the user's public ID and
+// session, recording how the user authenticated and the groups they are in
+func GenerateToken(subject, sessionID string, auth Authentication, groups GroupClaims, secret string, ttl time.Duration) (string, error) {
+	claims := JWTClaims{SessionID: sessionID, AMR: auth.Methods, Groups: groups.IDs, GroupsOverflow: groups.Overflow}
+	if !auth.Time.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(auth.Time)
+	}
+	return signToken(claims, subject, secret, ttl)
+}
+
+// GenerateScopedToken generates a JWT token restricted to the given scope
+func GenerateScopedToken(subject, sessionID, scope, secret string, ttl time.Duration) (string, error) {
+	return signToken(JWTClaims{SessionID: sessionID, Scope: scope}, subject, secret, ttl)
+}
+
+// GenerateClientToken generates a JWT access token for a client acting on its own behalf
+func GenerateClientToken(clientID string, scopes []string, secret string, ttl time.Duration) (string, error) {
+	return signToken(JWTClaims{ClientID: clientID, Scope: strings.Join(scopes, " ")}, clientID, secret, ttl)
+}
+
+// GenerateDelegatedToken generates a JWT access token issued to a client to act for a user
+func GenerateDelegatedToken(subject, clientID string, scopes []string, secret string, ttl time.Duration) (string, error) {
+	return signToken(JWTClaims{ClientID: clientID, Scope: strings.Join(scopes, " ")}, subject, secret, ttl)
+}
+
+// GenerateImpersonationToken generates a JWT token with which an actor acts as
+// the subject, identified by the impersonation's ID
+func GenerateImpersonationToken(subject, actor, impersonationID, secret string, ttl time.Duration) (string, error) {
+	claims := JWTClaims{Act: &Actor{Subject: actor}}
+	claims.ID = impersonationID
+	return signToken(claims, subject, secret, ttl)
+}
+
+// signToken sets the subject, a unique token ID unless claims have one, and
+// timestamps on claims and signs them
+func signToken(claims JWTClaims, subject, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	id := claims.ID
+	if id == "" {
+		id = uuid.NewString()
+	}
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        id,
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -46,7 +187,7 @@ func ValidateToken(tokenString string, secret string) (*JWTClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid && claims.Subject != "" && claims.IssuedAt != nil {
 		return claims, nil
 	}
 
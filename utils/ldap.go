@@ -0,0 +1,559 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations (RFC 4511 section 4.2)
+const (
+	LDAPBindRequest           = BERClassApplication | BERConstructed | 0
+	LDAPBindResponse          = BERClassApplication | BERConstructed | 1
+	LDAPUnbindRequest         = BERClassApplication | 2
+	LDAPSearchRequest         = BERClassApplication | BERConstructed | 3
+	LDAPSearchResultEntry     = BERClassApplication | BERConstructed | 4
+	LDAPSearchResultDone      = BERClassApplication | BERConstructed | 5
+	LDAPSearchResultReference = BERClassApplication | BERConstructed | 19
+)
+
+// LDAP filter choices (RFC 4511 section 4.5.1.7)
+const (
+	LDAPFilterAnd            = BERClassContext | BERConstructed | 0
+	LDAPFilterOr             = BERClassContext | BERConstructed | 1
+	LDAPFilterNot            = BERClassContext | BERConstructed | 2
+	LDAPFilterEqualityMatch  = BERClassContext | BERConstructed | 3
+	LDAPFilterSubstrings     = BERClassContext | BERConstructed | 4
+	LDAPFilterGreaterOrEqual = BERClassContext | BERConstructed | 5
+	LDAPFilterLessOrEqual    = BERClassContext | BERConstructed | 6
+	LDAPFilterPresent        = BERClassContext | 7
+	LDAPFilterApproxMatch    = BERClassContext | BERConstructed | 8
+	LDAPFilterExtensible     = BERClassContext | BERConstructed | 9
+)
+
+// LDAP search scopes
+const (
+	LDAPScopeBaseObject   = 0
+	LDAPScopeSingleLevel  = 1
+	LDAPScopeWholeSubtree = 2
+)
+
+// LDAPResultSuccess is the result code of a successful operation
+const LDAPResultSuccess = 0
+
+// LDAPPagedResultsOID identifies the simple paged results control (RFC 2696)
+const LDAPPagedResultsOID = "1.2.840.113556.1.4.319"
+
+// ldapControls is the context tag of the controls that follow a protocol operation
+const ldapControls = BERClassContext | BERConstructed | 0
+
+// LDAPError is an LDAP result other than success
+type LDAPError struct {
+	Code    int64
+	Message string
+}
+
+func (e *LDAPError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("LDAP result code %d", e.Code)
+	}
+	return fmt.Sprintf("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// LDAPEntry is an entry returned by a search. Attribute values are raw bytes,
+// since some, such as objectGUID, are binary.
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][][]byte
+}
+
+// Values returns the values of an attribute, matching its name case-insensitively
+func (e *LDAPEntry) Values(name string) [][]byte {
+	if values, ok := e.Attributes[name]; ok {
+		return values
+	}
+	for attribute, values := range e.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of an attribute as a string
+func (e *LDAPEntry) Value(name string) string {
+	if values := e.Values(name); len(values) > 0 {
+		return string(values[0])
+	}
+	return ""
+}
+
+// LDAPSearch describes a search request
+type LDAPSearch struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string
+}
+
+// LDAPConn is a connection to an LDAP server. Requests are sent one at a
+// time, so a connection must not be shared between goroutines.
+type LDAPConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+	timeout   time.Duration
+}
+
+// DialLDAP connects to an ldap:// or ldaps:// URL. timeout bounds the
+// connection and every request made on it.
+func DialLDAP(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*LDAPConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		conn, err = dialer.Dial("tcp", hostWithDefaultPort(u, "389"))
+	case "ldaps":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithDefaultPort(u, "636"), tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &LDAPConn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// hostWithDefaultPort returns a URL's host with the scheme's port if it has none
+func hostWithDefaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Bind authenticates with a simple bind. An empty DN and password bind anonymously.
+func (c *LDAPConn) Bind(dn, password string) error {
+	request := NewBERConstructed(LDAPBindRequest,
+		NewBERInteger(BERTagInteger, 3),
+		NewBERString(BERTagOctetString, dn),
+		NewBERString(BERClassContext|0, password),
+	)
+	if err := c.send(request); err != nil {
+		return err
+	}
+
+	response, _, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if response.Tag != LDAPBindResponse {
+		return fmt.Errorf("unexpected LDAP response 0x%x to bind", response.Tag)
+	}
+	return ldapResult(response)
+}
+
+// SearchPaged runs a search with the paged results control, calling fn for
+// each entry. Search references are not followed.
+func (c *LDAPConn) SearchPaged(search LDAPSearch, pageSize int, fn func(*LDAPEntry) error) error {
+	filter, err := CompileLDAPFilter(search.Filter)
+	if err != nil {
+		return err
+	}
+	attributes := NewBERConstructed(BERTagSequence)
+	for _, attribute := range search.Attributes {
+		attributes.Append(NewBERString(BERTagOctetString, attribute))
+	}
+
+	var cookie []byte
+	for {
+		request := NewBERConstructed(LDAPSearchRequest,
+			NewBERString(BERTagOctetString, search.BaseDN),
+			NewBERInteger(BERTagEnumerated, int64(search.Scope)),
+			NewBERInteger(BERTagEnumerated, 0), // never dereference aliases
+			NewBERInteger(BERTagInteger, 0),    // no size limit
+			NewBERInteger(BERTagInteger, 0),    // no time limit
+			NewBERBoolean(BERTagBoolean, false),
+			filter,
+			attributes,
+		)
+		control := NewBERConstructed(BERTagSequence,
+			NewBERInteger(BERTagInteger, int64(pageSize)),
+			NewBERPrimitive(BERTagOctetString, cookie),
+		)
+		if err := c.send(request, ldapControl(LDAPPagedResultsOID, true, control.Encode())); err != nil {
+			return err
+		}
+
+		cookie = nil
+		for done := false; !done; {
+			response, controls, err := c.receive()
+			if err != nil {
+				return err
+			}
+
+			switch response.Tag {
+			case LDAPSearchResultEntry:
+				entry, err := ldapEntry(response)
+				if err != nil {
+					return err
+				}
+				if err := fn(entry); err != nil {
+					return err
+				}
+			case LDAPSearchResultReference:
+			case LDAPSearchResultDone:
+				if err := ldapResult(response); err != nil {
+					return err
+				}
+				if cookie, err = pagedResultsCookie(controls); err != nil {
+					return err
+				}
+				done = true
+			default:
+				return fmt.Errorf("unexpected LDAP response 0x%x to search", response.Tag)
+			}
+		}
+
+		if len(cookie) == 0 {
+			return nil
+		}
+	}
+}
+
+// Close sends an unbind request and closes the connection
+func (c *LDAPConn) Close() error {
+	_ = c.send(NewBERPrimitive(LDAPUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// send writes a request with the next message ID
+func (c *LDAPConn) send(operation *BERElement, controls ...*BERElement) error {
+	c.messageID++
+	message := NewBERConstructed(BERTagSequence, NewBERInteger(BERTagInteger, c.messageID), operation)
+	if len(controls) > 0 {
+		message.Append(NewBERConstructed(ldapControls, controls...))
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(message.Encode())
+	return err
+}
+
+// receive reads the next response to the current request, returning its
+// protocol operation and controls
+func (c *LDAPConn) receive() (*BERElement, []*BERElement, error) {
+	for {
+		message, err := ReadBERElement(c.reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading LDAP response: %w", err)
+		}
+		if message.Tag != BERTagSequence || len(message.Children) < 2 {
+			return nil, nil, errors.New("malformed LDAP message")
+		}
+		id, err := message.Child(0).Int()
+		if err != nil {
+			return nil, nil, errors.New("malformed LDAP message ID")
+		}
+
+		// Unsolicited notifications, such as a notice of disconnection, have ID 0
+		if id == 0 {
+			return nil, nil, fmt.Errorf("LDAP server ended the session: %w", ldapResult(message.Child(1)))
+		}
+		if id != c.messageID {
+			continue
+		}
+
+		var controls []*BERElement
+		if control := message.Child(2); control != nil && control.Tag == ldapControls {
+			controls = control.Children
+		}
+		return message.Child(1), controls, nil
+	}
+}
+
+// ldapControl builds a request control
+func ldapControl(oid string, critical bool, value []byte) *BERElement {
+	return NewBERConstructed(BERTagSequence,
+		NewBERString(BERTagOctetString, oid),
+		NewBERBoolean(BERTagBoolean, critical),
+		NewBERPrimitive(BERTagOctetString, value),
+	)
+}
+
+// ldapResult turns an LDAPResult into an error unless it reports success
+func ldapResult(response *BERElement) error {
+	code, err := response.Child(0).Int()
+	if err != nil {
+		return errors.New("malformed LDAP result")
+	}
+	if code != LDAPResultSuccess {
+		return &LDAPError{Code: code, Message: response.Child(2).String()}
+	}
+	return nil
+}
+
+// ldapEntry decodes a SearchResultEntry
+func ldapEntry(response *BERElement) (*LDAPEntry, error) {
+	attributes := response.Child(1)
+	if attributes == nil || attributes.Tag != BERTagSequence {
+		return nil, errors.New("malformed LDAP search entry")
+	}
+
+	entry := &LDAPEntry{DN: response.Child(0).String(), Attributes: make(map[string][][]byte)}
+	for _, attribute := range attributes.Children {
+		values := attribute.Child(1)
+		if attribute.Tag != BERTagSequence || values == nil {
+			return nil, errors.New("malformed LDAP search entry attribute")
+		}
+		name := attribute.Child(0).String()
+		for _, value := range values.Children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.Value)
+		}
+	}
+	return entry, nil
+}
+
+// pagedResultsCookie reads the cookie of the paged results response control.
+// An empty cookie means the last page was returned.
+func pagedResultsCookie(controls []*BERElement) ([]byte, error) {
+	for _, control := range controls {
+		if control.Child(0).String() != LDAPPagedResultsOID {
+			continue
+		}
+		value := control.Child(len(control.Children) - 1)
+		decoded, err := DecodeBER(value.Value)
+		if err != nil || decoded.Tag != BERTagSequence || decoded.Child(1) == nil {
+			return nil, errors.New("malformed paged results control")
+		}
+		return decoded.Child(1).Value, nil
+	}
+	return nil, nil
+}
+
+// CompileLDAPFilter encodes a string filter (RFC 4515) such as
+// "(&(objectClass=person)(mail=*))"
+func CompileLDAPFilter(filter string) (*BERElement, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+
+	element, rest, err := compileLDAPFilter(filter, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP filter: %w", err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid LDAP filter: unexpected %q", rest)
+	}
+	return element, nil
+}
+
+// ldapMaxFilterDepth bounds the nesting of filters
+const ldapMaxFilterDepth = 32
+
+// compileLDAPFilter compiles the parenthesized filter at the start of s and
+// returns what follows it
+func compileLDAPFilter(s string, depth int) (*BERElement, string, error) {
+	if depth > ldapMaxFilterDepth {
+		return nil, "", errors.New("filter is nested too deeply")
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("expected (")
+	}
+	s = s[1:]
+
+	if s == "" {
+		return nil, "", errors.New("unterminated filter")
+	}
+	switch s[0] {
+	case '&', '|':
+		tag := byte(LDAPFilterAnd)
+		if s[0] == '|' {
+			tag = LDAPFilterOr
+		}
+		set := NewBERConstructed(tag)
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			element, rest, err := compileLDAPFilter(s, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			set.Append(element)
+			s = rest
+		}
+		if len(set.Children) == 0 {
+			return nil, "", errors.New("empty filter set")
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", errors.New("expected )")
+		}
+		return set, s[1:], nil
+	case '!':
+		element, rest, err := compileLDAPFilter(s[1:], depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("expected )")
+		}
+		return NewBERConstructed(LDAPFilterNot, element), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("unterminated filter")
+	}
+	element, err := compileLDAPItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return element, s[end+1:], nil
+}
+
+// compileLDAPItem compiles a single comparison such as "mail=*@example.com"
+func compileLDAPItem(item string) (*BERElement, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid comparison %q", item)
+	}
+	attribute, value := item[:eq], item[eq+1:]
+
+	tag := byte(LDAPFilterEqualityMatch)
+	switch attribute[len(attribute)-1] {
+	case '>':
+		tag, attribute = LDAPFilterGreaterOrEqual, attribute[:len(attribute)-1]
+	case '<':
+		tag, attribute = LDAPFilterLessOrEqual, attribute[:len(attribute)-1]
+	case '~':
+		tag, attribute = LDAPFilterApproxMatch, attribute[:len(attribute)-1]
+	case ':':
+		return compileLDAPExtensible(attribute[:len(attribute)-1], value)
+	}
+	if attribute == "" || strings.ContainsAny(attribute, "()*\\ ") {
+		return nil, fmt.Errorf("invalid attribute %q", attribute)
+	}
+
+	if tag == LDAPFilterEqualityMatch && strings.Contains(value, "*") {
+		if value == "*" {
+			return NewBERString(LDAPFilterPresent, attribute), nil
+		}
+		return compileLDAPSubstrings(attribute, value)
+	}
+
+	decoded, err := unescapeLDAPFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewBERConstructed(tag,
+		NewBERString(BERTagOctetString, attribute),
+		NewBERPrimitive(BERTagOctetString, decoded),
+	), nil
+}
+
+// compileLDAPSubstrings compiles a comparison with wildcards, such as "cn=J*n*e"
+func compileLDAPSubstrings(attribute, value string) (*BERElement, error) {
+	parts := strings.Split(value, "*")
+	substrings := NewBERConstructed(BERTagSequence)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		decoded, err := unescapeLDAPFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+
+		choice := BERClassContext | 1 // any
+		switch i {
+		case 0:
+			choice = BERClassContext | 0 // initial
+		case len(parts) - 1:
+			choice = BERClassContext | 2 // final
+		}
+		substrings.Append(NewBERPrimitive(choice, decoded))
+	}
+	return NewBERConstructed(LDAPFilterSubstrings, NewBERString(BERTagOctetString, attribute), substrings), nil
+}
+
+// compileLDAPExtensible compiles an extensible match such as
+// "userAccountControl:1.2.840.113556.1.4.803:=2", given what precedes ":="
+func compileLDAPExtensible(description, value string) (*BERElement, error) {
+	parts := strings.Split(description, ":")
+	attribute, rule, dnAttributes := parts[0], "", false
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn") && !dnAttributes:
+			dnAttributes = true
+		case part != "" && rule == "":
+			rule = part
+		default:
+			return nil, fmt.Errorf("invalid extensible match %q", description)
+		}
+	}
+	if attribute == "" && rule == "" {
+		return nil, errors.New("extensible match needs an attribute or a matching rule")
+	}
+
+	decoded, err := unescapeLDAPFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	match := NewBERConstructed(LDAPFilterExtensible)
+	if rule != "" {
+		match.Append(NewBERString(BERClassContext|1, rule))
+	}
+	if attribute != "" {
+		match.Append(NewBERString(BERClassContext|2, attribute))
+	}
+	match.Append(NewBERPrimitive(BERClassContext|3, decoded))
+	if dnAttributes {
+		match.Append(NewBERBoolean(BERClassContext|4, true))
+	}
+	return match, nil
+}
+
+// unescapeLDAPFilterValue decodes the \XX escapes of a filter value
+func unescapeLDAPFilterValue(value string) ([]byte, error) {
+	decoded := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+3 > len(value) {
+				return nil, fmt.Errorf("invalid escape in %q", value)
+			}
+			b, err := hex.DecodeString(value[i+1 : i+3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape in %q", value)
+			}
+			decoded = append(decoded, b...)
+			i += 2
+		case '(', ')', '*':
+			return nil, fmt.Errorf("unescaped %q in %q", value[i], value)
+		default:
+			decoded = append(decoded, value[i])
+		}
+	}
+	return decoded, nil
+}
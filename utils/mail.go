@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MailMessage is a plain text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// NewSMTPMailer creates a mailer that sends through an SMTP server. It
+// authenticates only when a username is set.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		From:     from,
+		Username: username,
+		Password: password,
+	}
+}
+
+// Send sends a message
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	data, err := formatMail(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, data)
+}
+
+// formatMail renders a message with its headers
+func formatMail(from string, msg MailMessage, now time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, errors.New("mail headers cannot contain line breaks")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
+
+// LogMailer writes emails to the log instead of sending them. It is meant
+// for development, since the log then holds whatever the emails contain.
+type LogMailer struct {
+	Logger *Logger
+}
+
+// NewLogMailer creates a mailer that logs emails
+func NewLogMailer(logger *Logger) *LogMailer {
+	return &LogMailer{Logger: logger}
+}
+
+// Send logs a message
+func (m *LogMailer) Send(ctx context.Context, msg MailMessage) error {
+	m.Logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("Email not sent, logged instead")
+	return nil
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+// ErrUnknownHashFormat is returned when a stored hash cannot be parsed
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes and verifies passwords
+type PasswordHasher interface {
+	// Hash returns an encoded hash that records the algorithm and parameters
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(encodedHash, password string) (bool, error)
+	// NeedsRehash reports whether the encoded hash was produced with
+	// a different algorithm or outdated parameters
+	NeedsRehash(encodedHash string) bool
+}
+
+// Argon2Params holds the tunable Argon2id parameters
+type Argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// ErrInvalidArgon2Params is returned for Argon2id parameters the algorithm cannot run with
+var ErrInvalidArgon2Params = errors.New("argon2 memory, iterations and parallelism must be positive")
+
+// Validate checks that the parameters can be hashed with
+func (p Argon2Params) Validate() error {
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return ErrInvalidArgon2Params
+	}
+	return nil
+}
+
+// DefaultArgon2Params follows the OWASP baseline recommendation
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// BcryptHasher hashes passwords with bcrypt
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher creates a bcrypt hasher with the given cost
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{Cost: cost}
+}
+
+// Hash hashes the password with bcrypt
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Verify checks a bcrypt hash
+func (h *BcryptHasher) Verify(encodedHash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NeedsRehash reports whether the hash is not bcrypt or uses a different cost
+func (h *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes passwords with Argon2id in PHC string format
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+// NewArgon2idHasher creates an Argon2id hasher with the given parameters
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2Params.KeyLength
+	}
+	return &Argon2idHasher{Params: params}
+}
+
+// Hash hashes the password with Argon2id
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	if err := h.Params.Validate(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks an Argon2id PHC hash using the parameters stored in it
+func (h *Argon2idHasher) Verify(encodedHash, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash reports whether the hash is not Argon2id or uses different parameters
+func (h *Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	params, _, _, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return true
+	}
+	return params != h.Params
+}
+
+// decodeArgon2idHash parses a $argon2id$v=19$m=..,t=..,p=..$salt$key string
+func decodeArgon2idHash(encodedHash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HashAlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if params.Validate() != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	// An empty key would match every password
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// HashAlgorithm returns the algorithm recorded in an encoded hash, or an
+// empty string if the value is not a recognised hash
+func HashAlgorithm(encodedHash string) string {
+	if _, _, _, err := decodeArgon2idHash(encodedHash); err == nil {
+		return HashAlgorithmArgon2id
+	}
+	if _, err := bcrypt.Cost([]byte(encodedHash)); err == nil && len(encodedHash) == 60 {
+		return HashAlgorithmBcrypt
+	}
+	return ""
+}
+
+// IsPasswordHash reports whether the value is an encoded hash produced by a supported hasher
+func IsPasswordHash(value string) bool {
+	return HashAlgorithm(value) != ""
+}
+
+// MultiHasher hashes new passwords with a preferred hasher while still
+// verifying hashes produced by any supported algorithm
+type MultiHasher struct {
+	Preferred PasswordHasher
+	byAlg     map[string]PasswordHasher
+}
+
+// NewPasswordHasher creates a hasher for the configured algorithm that can
+// still verify hashes stored with the other supported algorithms
+func NewPasswordHasher(algorithm string, bcryptCost int, argonParams Argon2Params) (*MultiHasher, error) {
+	if err := argonParams.Validate(); err != nil {
+		return nil, err
+	}
+
+	bcryptHasher := NewBcryptHasher(bcryptCost)
+	argonHasher := NewArgon2idHasher(argonParams)
+
+	m := &MultiHasher{
+		byAlg: map[string]PasswordHasher{
+			HashAlgorithmBcrypt:   bcryptHasher,
+			HashAlgorithmArgon2id: argonHasher,
+		},
+	}
+
+	preferred, ok := m.byAlg[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+	m.Preferred = preferred
+	return m, nil
+}
+
+// Hash hashes the password with the preferred hasher
+func (m *MultiHasher) Hash(password string) (string, error) {
+	return m.Preferred.Hash(password)
+}
+
+// Verify checks the password using the algorithm recorded in the hash
+func (m *MultiHasher) Verify(encodedHash, password string) (bool, error) {
+	hasher, ok := m.byAlg[HashAlgorithm(encodedHash)]
+	if !ok {
+		return false, ErrUnknownHashFormat
+	}
+	return hasher.Verify(encodedHash, password)
+}
+
+// NeedsRehash reports whether the hash differs from the preferred algorithm or parameters
+func (m *MultiHasher) NeedsRehash(encodedHash string) bool {
+	return m.Preferred.NeedsRehash(encodedHash)
+}
@@ -10,6 +10,7 @@ import (
 type Response struct {
 	Status     string      `json:"status"`
 	RequestID  string      `json:"request_id"`
+	Code       string      `json:"code,omitempty"`
 	Message    string      `json:"message,omitempty"`
 	Data       interface{} `json:"data,omitempty"`
 	Errors     []string    `json:"errors,omitempty"`
@@ -54,6 +55,21 @@ func ErrorResponse(c echo.Context, statusCode int, message string, errors []stri
 	})
 }
 
+// ErrorResponseWithCode returns an error response carrying a machine-readable error code
+func ErrorResponseWithCode(c echo.Context, statusCode int, code, message string) error {
+	requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+	if requestID == "" {
+		requestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	}
+
+	return c.JSON(statusCode, Response{
+		Status:    "error",
+		RequestID: requestID,
+		Code:      code,
+		Message:   message,
+	})
+}
+
 // ValidationErrorResponse returns a validation error response
 func ValidationErrorResponse(c echo.Context, message string, errors []string) error {
 	return ErrorResponse(c, http.StatusBadRequest, message, errors)
@@ -64,6 +80,11 @@ func UnauthorizedErrorResponse(c echo.Context, message string) error {
 	return ErrorResponse(c, http.StatusUnauthorized, message, nil)
 }
 
+// ForbiddenErrorResponse returns a forbidden error response
+func ForbiddenErrorResponse(c echo.Context, message string) error {
+	return ErrorResponse(c, http.StatusForbidden, message, nil)
+}
+
 // NotFoundErrorResponse returns a not found error response
 func NotFoundErrorResponse(c echo.Context, message string) error {
 	return ErrorResponse(c, http.StatusNotFound, message, nil)
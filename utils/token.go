@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// opaqueTokenBytes is the amount of randomness in an opaque token
+const opaqueTokenBytes = 32
+
+// opaqueTokenPrefixLength is the number of random characters kept in a token's display prefix
+const opaqueTokenPrefixLength = 8
+
+// GenerateOpaqueToken generates a random token of the form "<kind>_<random>".
+// The kind makes leaked tokens easy to recognise.
+func GenerateOpaqueToken(kind string) (string, error) {
+	buf := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return kind + "_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// OpaqueTokenPrefix returns the non-secret part of a token shown to identify it
+func OpaqueTokenPrefix(token string) string {
+	kind, random, ok := strings.Cut(token, "_")
+	if !ok || len(random) < opaqueTokenPrefixLength {
+		return ""
+	}
+	return kind + "_" + random[:opaqueTokenPrefixLength]
+}
+
+// HashOpaqueToken returns the SHA-256 hex digest stored in place of a token.
+// Opaque tokens are high-entropy, so a fast hash is sufficient.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Authenticator data flags
+const (
+	WebAuthnFlagUserPresent        = 0x01
+	WebAuthnFlagUserVerified       = 0x04
+	WebAuthnFlagBackupEligible     = 0x08
+	WebAuthnFlagBackedUp           = 0x10
+	WebAuthnFlagAttestedCredential = 0x40
+	WebAuthnFlagExtensions         = 0x80
+)
+
+// COSE algorithms supported for credential and attestation signatures
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// COSE key parameters
+const (
+	coseKeyType     = 1
+	coseKeyAlg      = 3
+	coseKeyCurve    = -1
+	coseKeyX        = -2
+	coseKeyY        = -3
+	coseKeyModulus  = -1
+	coseKeyExponent = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// webAuthnAAGUIDExtension is the OID of the attestation certificate extension carrying the authenticator's AAGUID
+var webAuthnAAGUIDExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// Base64URL is binary data carried in JSON as unpadded base64url, the
+// encoding WebAuthn clients use. Padded input is accepted too.
+type Base64URL []byte
+
+// MarshalJSON encodes the data as an unpadded base64url string
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a base64url string
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// CollectedClientData is the client data a WebAuthn signature covers
+type CollectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData parses a clientDataJSON
+func ParseClientData(data []byte) (*CollectedClientData, error) {
+	var clientData CollectedClientData
+	if err := json.Unmarshal(data, &clientData); err != nil {
+		return nil, fmt.Errorf("invalid client data: %w", err)
+	}
+	return &clientData, nil
+}
+
+// AuthenticatorData is the data an authenticator signs. The attested
+// credential is only present in registrations.
+type AuthenticatorData struct {
+	Raw                 []byte
+	RPIDHash            []byte
+	Flags               byte
+	SignCount           uint32
+	AAGUID              []byte
+	CredentialID        []byte
+	CredentialPublicKey []byte // COSE_Key
+}
+
+// Has reports whether a flag is set
+func (a *AuthenticatorData) Has(flag byte) bool {
+	return a.Flags&flag != 0
+}
+
+// ParseAuthenticatorData parses authenticator data
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	authData := &AuthenticatorData{
+		Raw:       data,
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.Has(WebAuthnFlagAttestedCredential) {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		authData.AAGUID = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < length {
+			return nil, errors.New("attested credential data is too short")
+		}
+		authData.CredentialID, rest = rest[:length], rest[length:]
+
+		_, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		authData.CredentialPublicKey, rest = rest[:len(rest)-len(after)], after
+	}
+	if authData.Has(WebAuthnFlagExtensions) {
+		extensions, after, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extensions: %w", err)
+		}
+		if _, ok := extensions.(map[interface{}]interface{}); !ok {
+			return nil, errors.New("extensions are not a map")
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("authenticator data has trailing bytes")
+	}
+	return authData, nil
+}
+
+// COSEKey is a credential public key
+type COSEKey struct {
+	Alg int64
+	Key crypto.PublicKey
+}
+
+// ParseCOSEKey parses an ES256, EdDSA (Ed25519) or RS256 COSE_Key
+func ParseCOSEKey(data []byte) (*COSEKey, error) {
+	decoded, rest, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid COSE key: %w", err)
+	}
+	params, ok := decoded.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("invalid COSE key: not a single map")
+	}
+	keyType, _ := params[int64(coseKeyType)].(int64)
+	alg, _ := params[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == COSEAlgES256:
+		curve, _ := params[int64(coseKeyCurve)].(int64)
+		x, _ := params[int64(coseKeyX)].([]byte)
+		y, _ := params[int64(coseKeyY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid COSE key: ES256 needs a P-256 point")
+		}
+		// ecdh checks that the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid COSE key: %w", err)
+		}
+		return &COSEKey{Alg: alg, Key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case keyType == coseKeyTypeOKP && alg == COSEAlgEdDSA:
+		curve, _ := params[int64(coseKeyCurve)].(int64)
+		x, _ := params[int64(coseKeyX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid COSE key: EdDSA needs an Ed25519 key")
+		}
+		return &COSEKey{Alg: alg, Key: ed25519.PublicKey(x)}, nil
+	case keyType == coseKeyTypeRSA && alg == COSEAlgRS256:
+		n, _ := params[int64(coseKeyModulus)].([]byte)
+		e, _ := params[int64(coseKeyExponent)].([]byte)
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e)
+		if modulus.BitLen() < 2048 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid COSE key: RS256 needs an RSA key of at least 2048 bits")
+		}
+		return &COSEKey{Alg: alg, Key: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported COSE key type %d with algorithm %d", keyType, alg)
+	}
+}
+
+// Verify checks a signature made with the key over data
+func (k *COSEKey) Verify(data, signature []byte) error {
+	switch key := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	default:
+		return errors.New("unsupported key")
+	}
+}
+
+// AttestationObject is the attestation an authenticator returns for a new credential
+type AttestationObject struct {
+	Format    string
+	Statement map[interface{}]interface{}
+	AuthData  *AuthenticatorData
+}
+
+// ParseAttestationObject parses an attestationObject
+func ParseAttestationObject(data []byte) (*AttestationObject, error) {
+	decoded, rest, err := DecodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	fields, ok := decoded.(map[interface{}]interface{})
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("invalid attestation object: not a single map")
+	}
+
+	format, _ := fields["fmt"].(string)
+	statement, _ := fields["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := fields["authData"].([]byte)
+	if format == "" || statement == nil || rawAuthData == nil {
+		return nil, errors.New("invalid attestation object: missing fmt, attStmt or authData")
+	}
+	authData, err := ParseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if !authData.Has(WebAuthnFlagAttestedCredential) {
+		return nil, errors.New("attestation has no attested credential")
+	}
+	return &AttestationObject{Format: format, Statement: statement, AuthData: authData}, nil
+}
+
+// Verify verifies the attestation statement of a credential with a public
+// key over the hash of the client data. It supports the "none" and "packed"
+// formats and returns the attestation type: "none", "self" or "basic". The
+// certificate of a basic attestation is checked, but not chained to a root.
+func (a *AttestationObject) Verify(clientDataHash []byte, credentialKey *COSEKey) (string, error) {
+	switch a.Format {
+	case "none":
+		if len(a.Statement) != 0 {
+			return "", errors.New("none attestation has a statement")
+		}
+		return "none", nil
+	case "packed":
+		return a.verifyPacked(clientDataHash, credentialKey)
+	default:
+		return "", fmt.Errorf("unsupported attestation format %q", a.Format)
+	}
+}
+
+// verifyPacked verifies a packed attestation statement
+func (a *AttestationObject) verifyPacked(clientDataHash []byte, credentialKey *COSEKey) (string, error) {
+	alg, _ := a.Statement["alg"].(int64)
+	signature, _ := a.Statement["sig"].([]byte)
+	if signature == nil {
+		return "", errors.New("packed attestation has no signature")
+	}
+	signed := append(append([]byte(nil), a.AuthData.Raw...), clientDataHash...)
+
+	chain, ok := a.Statement["x5c"].([]interface{})
+	if !ok {
+		// Self attestation signs with the credential's own key
+		if _, present := a.Statement["x5c"]; present {
+			return "", errors.New("packed attestation x5c is not an array")
+		}
+		if alg != credentialKey.Alg {
+			return "", errors.New("self attestation algorithm does not match the credential")
+		}
+		if err := credentialKey.Verify(signed, signature); err != nil {
+			return "", fmt.Errorf("self attestation: %w", err)
+		}
+		return "self", nil
+	}
+
+	if len(chain) == 0 {
+		return "", errors.New("packed attestation x5c is empty")
+	}
+	der, _ := chain[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("invalid attestation certificate: %w", err)
+	}
+	algorithms := map[int64]x509.SignatureAlgorithm{
+		COSEAlgES256: x509.ECDSAWithSHA256,
+		COSEAlgEdDSA: x509.PureEd25519,
+		COSEAlgRS256: x509.SHA256WithRSA,
+	}
+	algorithm, ok := algorithms[alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported attestation algorithm %d", alg)
+	}
+	if err := cert.CheckSignature(algorithm, signed, signature); err != nil {
+		return "", fmt.Errorf("basic attestation: %w", err)
+	}
+	if err := checkAttestationCertificate(cert, a.AuthData.AAGUID); err != nil {
+		return "", err
+	}
+	return "basic", nil
+}
+
+// checkAttestationCertificate checks the requirements on packed attestation certificates
+func checkAttestationCertificate(cert *x509.Certificate, aaguid []byte) error {
+	subject := cert.Subject
+	if cert.Version != 3 || len(subject.Country) != 1 || len(subject.Organization) != 1 ||
+		len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "Authenticator Attestation" ||
+		subject.CommonName == "" {
+		return errors.New("attestation certificate does not meet the packed attestation requirements")
+	}
+	if cert.IsCA {
+		return errors.New("attestation certificate is a CA certificate")
+	}
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(webAuthnAAGUIDExtension) {
+			continue
+		}
+		var certAAGUID []byte
+		if _, err := asn1.Unmarshal(extension.Value, &certAAGUID); err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return errors.New("attestation certificate AAGUID does not match the authenticator")
+		}
+	}
+	return nil
+}
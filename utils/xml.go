@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// xmlNamespace is the namespace the xml prefix is always bound to
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// XMLElement is an element of a parsed XML document. Unlike encoding/xml
+// unmarshalling, it keeps namespace prefixes and declarations as written, and
+// the parsed etree element its signature is checked on.
+type XMLElement struct {
+	Space    string // namespace URI
+	Prefix   string
+	Local    string
+	Attrs    []XMLAttr // attributes other than namespace declarations
+	Children []XMLNode
+	Parent   *XMLElement
+
+	namespaces map[string]string // prefix to URI, as declared on this element
+	source     *etree.Element
+}
+
+// XMLAttr is an attribute of an XMLElement
+type XMLAttr struct {
+	Space  string // namespace URI, empty for unprefixed attributes
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// XMLNode is an *XMLElement or XMLText
+type XMLNode interface{}
+
+// XMLText is character data in an XMLElement
+type XMLText string
+
+// ParseXML parses a document into a tree. Documents with a DTD are rejected,
+// since nothing this service reads needs one.
+func ParseXML(data []byte) (*XMLElement, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+
+	var root *etree.Element
+	for _, token := range doc.Child {
+		switch t := token.(type) {
+		case *etree.Element:
+			if root != nil {
+				return nil, errors.New("invalid XML: more than one root element")
+			}
+			root = t
+		case *etree.CharData:
+			if strings.TrimSpace(t.Data) != "" {
+				return nil, errors.New("invalid XML: text outside the root element")
+			}
+		case *etree.Directive:
+			return nil, errors.New("invalid XML: DTDs are not allowed")
+		}
+	}
+	if root == nil {
+		return nil, errors.New("invalid XML: incomplete document")
+	}
+	return newXMLElement(root, nil)
+}
+
+// newXMLElement builds the tree for a parsed element, resolving prefixes
+func newXMLElement(source *etree.Element, parent *XMLElement) (*XMLElement, error) {
+	element := &XMLElement{
+		Prefix:     source.Space,
+		Local:      source.Tag,
+		Parent:     parent,
+		namespaces: make(map[string]string),
+		source:     source,
+	}
+
+	for _, attr := range source.Attr {
+		switch {
+		case attr.Space == "" && attr.Key == "xmlns":
+			element.namespaces[""] = attr.Value
+		case attr.Space == "xmlns":
+			element.namespaces[attr.Key] = attr.Value
+		default:
+			element.Attrs = append(element.Attrs, XMLAttr{Prefix: attr.Space, Local: attr.Key, Value: attr.Value})
+		}
+	}
+
+	space, ok := element.LookupNamespace(element.Prefix)
+	if !ok {
+		return nil, fmt.Errorf("invalid XML: undeclared prefix %q", element.Prefix)
+	}
+	element.Space = space
+
+	for i, attr := range element.Attrs {
+		if attr.Prefix == "" {
+			continue
+		}
+		space, ok := element.LookupNamespace(attr.Prefix)
+		if !ok {
+			return nil, fmt.Errorf("invalid XML: undeclared prefix %q", attr.Prefix)
+		}
+		element.Attrs[i].Space = space
+	}
+
+	for _, token := range source.Child {
+		switch t := token.(type) {
+		case *etree.Element:
+			child, err := newXMLElement(t, element)
+			if err != nil {
+				return nil, err
+			}
+			element.Children = append(element.Children, child)
+		case *etree.CharData:
+			element.Children = append(element.Children, XMLText(t.Data))
+		case *etree.Directive:
+			return nil, errors.New("invalid XML: DTDs are not allowed")
+		}
+	}
+	return element, nil
+}
+
+// LookupNamespace returns the namespace URI a prefix is bound to at this element
+func (e *XMLElement) LookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for element := e; element != nil; element = element.Parent {
+		if space, ok := element.namespaces[prefix]; ok {
+			return space, true
+		}
+	}
+	// Unprefixed names without a default namespace are in no namespace
+	return "", prefix == ""
+}
+
+// Attr returns the value of an unprefixed attribute
+func (e *XMLElement) Attr(local string) string {
+	for _, attr := range e.Attrs {
+		if attr.Space == "" && attr.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first child element with a name
+func (e *XMLElement) Child(space, local string) *XMLElement {
+	for _, child := range e.Children {
+		if element, ok := child.(*XMLElement); ok && element.Space == space && element.Local == local {
+			return element
+		}
+	}
+	return nil
+}
+
+// ChildElements returns the child elements with a name
+func (e *XMLElement) ChildElements(space, local string) []*XMLElement {
+	var elements []*XMLElement
+	for _, child := range e.Children {
+		if element, ok := child.(*XMLElement); ok && element.Space == space && element.Local == local {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// Text returns the element's character data, without that of its children
+func (e *XMLElement) Text() string {
+	var text strings.Builder
+	for _, child := range e.Children {
+		if t, ok := child.(XMLText); ok {
+			text.WriteString(string(t))
+		}
+	}
+	return text.String()
+}
+
+// Root returns the root element of the document the element belongs to
+func (e *XMLElement) Root() *XMLElement {
+	root := e
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return root
+}
+
+// Walk calls fn for the element and every element below it, in document order
+func (e *XMLElement) Walk(fn func(*XMLElement)) {
+	fn(e)
+	for _, child := range e.Children {
+		if element, ok := child.(*XMLElement); ok {
+			element.Walk(fn)
+		}
+	}
+}
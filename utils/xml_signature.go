@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// XMLDSigNamespace is the namespace of XML signature elements
+const XMLDSigNamespace = dsig.Namespace
+
+// ErrXMLSignatureMissing is returned when an element carries no signature
+var ErrXMLSignatureMissing = errors.New("element is not signed")
+
+// xmlWeakAlgorithms are the SHA-1 signature and digest methods goxmldsig
+// still accepts but signatures are not trusted with
+var xmlWeakAlgorithms = map[string]bool{
+	dsig.RSASHA1SignatureMethod:              true,
+	dsig.ECDSASHA1SignatureMethod:            true,
+	"http://www.w3.org/2000/09/xmldsig#sha1": true,
+}
+
+// VerifyXMLSignature checks the enveloped signature of an element against
+// trusted certificates with goxmldsig, and returns the element as it was
+// signed: canonicalized, without the signature and without anything the
+// signature does not cover. Callers must only read data from the returned
+// element. Key material in the signature is only used to pick between the
+// trusted certificates, which must be valid at now.
+func VerifyXMLSignature(e *XMLElement, certs []*x509.Certificate, now time.Time) (*XMLElement, error) {
+	if e.source == nil {
+		return nil, errors.New("element was not parsed from a document")
+	}
+	if len(e.ChildElements(XMLDSigNamespace, "Signature")) == 0 {
+		return nil, ErrXMLSignatureMissing
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no trusted certificates")
+	}
+
+	var weak error
+	e.Walk(func(element *XMLElement) {
+		if element.Space == XMLDSigNamespace && (element.Local == "SignatureMethod" || element.Local == "DigestMethod") &&
+			xmlWeakAlgorithms[element.Attr("Algorithm")] {
+			weak = fmt.Errorf("unsupported signature algorithm %q", element.Attr("Algorithm"))
+		}
+	})
+	if weak != nil {
+		return nil, weak
+	}
+
+	// The element is validated on its own, so the namespaces it inherits
+	// are declared on it first
+	parentContext, err := etreeutils.NSBuildParentContext(e.source)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(parentContext, e.source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each certificate is tried on its own, so a signature without KeyInfo
+	// still verifies when the identity provider publishes several
+	for _, cert := range certs {
+		ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+		ctx.Clock = dsig.NewFakeClockAt(now)
+		var verified *etree.Element
+		verified, err = ctx.Validate(detached)
+		if errors.Is(err, dsig.ErrMissingSignature) {
+			return nil, errors.New("signature does not reference the signed element")
+		}
+		if err == nil {
+			return newXMLElement(verified, nil)
+		}
+	}
+	if len(certs) > 1 {
+		return nil, errors.New("signature does not match a trusted certificate")
+	}
+	return nil, err
+}
+
+// SignXML adds an enveloped RSA-SHA256 signature to the element of a
+// document with an ID, with the certificate in its KeyInfo, and returns the
+// signed document. As SAML requires, the signature is placed after the
+// element's Issuer if it has one.
+func SignXML(data []byte, id string, key *rsa.PrivateKey, cert *x509.Certificate) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	element := doc.FindElement(fmt.Sprintf("//[@ID='%s']", id))
+	if element == nil {
+		return nil, fmt.Errorf("no element with ID %q", id)
+	}
+
+	ctx, err := dsig.NewSigningContext(key, [][]byte{cert.Raw})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, err
+	}
+
+	// Canonicalization changes the element it is given, so the digest is
+	// taken over a detached copy
+	parentContext, err := etreeutils.NSBuildParentContext(element)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(parentContext, element)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := ctx.ConstructSignature(detached, true)
+	if err != nil {
+		return nil, err
+	}
+
+	position := 0
+	for _, child := range element.ChildElements() {
+		if child.Tag == "Issuer" {
+			position = child.Index() + 1
+		}
+		break
+	}
+	element.InsertChildAt(position, signature)
+	return doc.WriteToBytes()
+}